@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding/forwardingtest"
+	"github.com/spf13/cobra"
+)
+
+// debugCmd groups tools for debugging integrations
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Tools for debugging upstream integrations",
+}
+
+var (
+	echoListen         string
+	echoKey            string
+	echoPrivateKeyFile string
+	echoHeaders        []string
+)
+
+// echoServerCmd represents the debug echo-server command
+var echoServerCmd = &cobra.Command{
+	Use:   "echo-server",
+	Short: "Run an upstream that prints the forwarded user info it receives",
+	Long: `Run an HTTP server to use as the upstream while setting up forwarding.
+
+For every request, it prints the identity headers ("X-" headers, or the ones
+given with --header) and query parameters it receives, decrypting encrypted
+values with the forwarding key, and responds with the same report as JSON.
+
+The key is read from --key or the FORWARDING_KEY environment variable. Values
+encrypted with rsa-oaep are decrypted with --private-key-file.
+
+  chatbotgate debug echo-server --listen :8080 --key "$FORWARDING_KEY"`,
+	RunE: runEchoServer,
+}
+
+func init() {
+	echoServerCmd.Flags().StringVar(&echoListen, "listen", ":8083", "Address to listen on")
+	echoServerCmd.Flags().StringVar(&echoKey, "key", "", "Forwarding encryption key (default: $FORWARDING_KEY)")
+	echoServerCmd.Flags().StringVar(&echoPrivateKeyFile, "private-key-file", "", "Upstream's PEM private key for rsa-oaep values")
+	echoServerCmd.Flags().StringSliceVar(&echoHeaders, "header", nil, `Headers to report (default: all "X-" headers)`)
+	debugCmd.AddCommand(echoServerCmd)
+	rootCmd.AddCommand(debugCmd)
+}
+
+func runEchoServer(cmd *cobra.Command, args []string) error {
+	key := echoKey
+	if key == "" {
+		key = os.Getenv("FORWARDING_KEY")
+	}
+	var privateKeyPEM []byte
+	if echoPrivateKeyFile != "" {
+		data, err := os.ReadFile(echoPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		privateKeyPEM = data
+	}
+	decoder, err := forwardingtest.NewDecoder(key, privateKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if key == "" && privateKeyPEM == nil {
+		_, _ = fmt.Fprintln(out, "No key given: values are printed as received")
+	}
+
+	server := &http.Server{
+		Addr:              echoListen,
+		Handler:           forwardingtest.NewEchoHandler(decoder, echoHeaders, out),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	_, _ = fmt.Fprintf(out, "Echo server listening on %s\n", echoListen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
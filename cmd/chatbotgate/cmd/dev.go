@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2/oidctest"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// devCmd groups tools for local development
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Tools for local development and CI",
+}
+
+var (
+	idpListen       string
+	idpIssuer       string
+	idpClientID     string
+	idpClientSecret string
+	idpUsers        []string
+	idpUsersFile    string
+	idpAutoLogin    string
+)
+
+// idpCmd represents the dev idp command
+var idpCmd = &cobra.Command{
+	Use:   "idp",
+	Short: "Run a mock OpenID Connect provider with test users",
+	Long: `Run a fake OpenID Connect provider, so that sign-ins can be exercised
+locally and in CI without real Google, GitHub or Microsoft credentials.
+
+Configure it as a "custom" provider with issuer_url; the sign-in page lists
+the users to sign in as (or --auto-login signs one in without asking).
+
+Users are given with --user ("alice@example.com" or "Alice <alice@example.com>",
+repeatable) or --users-file, a YAML list:
+
+  - email: alice@example.com
+    name: Alice
+    claims:
+      groups: [admins]
+  - sub: bot-1
+    name: No Email
+  - email: carol@example.com
+    unverified: true
+
+Without users, a verified, an unverified and a no-email test user are served.
+
+  chatbotgate dev idp --listen :8084`,
+	RunE: runIDP,
+}
+
+func init() {
+	idpCmd.Flags().StringVar(&idpListen, "listen", ":8084", "Address to listen on")
+	idpCmd.Flags().StringVar(&idpIssuer, "issuer", "", "Issuer URL the gate reaches the provider at (default: http://localhost:<port>)")
+	idpCmd.Flags().StringVar(&idpClientID, "client-id", "chatbotgate-dev", "Client ID to accept")
+	idpCmd.Flags().StringVar(&idpClientSecret, "client-secret", "chatbotgate-dev-secret", "Client secret to accept")
+	idpCmd.Flags().StringArrayVar(&idpUsers, "user", nil, `User to offer ("email" or "Name <email>", repeatable)`)
+	idpCmd.Flags().StringVar(&idpUsersFile, "users-file", "", "YAML file listing the users")
+	idpCmd.Flags().StringVar(&idpAutoLogin, "auto-login", "", "Email or sub of a user to sign in without the picker")
+	devCmd.AddCommand(idpCmd)
+	rootCmd.AddCommand(devCmd)
+}
+
+func runIDP(cmd *cobra.Command, args []string) error {
+	users, err := loadIDPUsers()
+	if err != nil {
+		return err
+	}
+
+	issuer := idpIssuer
+	if issuer == "" {
+		_, port, err := net.SplitHostPort(idpListen)
+		if err != nil {
+			return fmt.Errorf("invalid listen address: %w", err)
+		}
+		issuer = "http://localhost:" + port
+	}
+
+	out := cmd.OutOrStdout()
+	provider, err := oidctest.NewProvider(oidctest.Options{
+		ClientID:     idpClientID,
+		ClientSecret: idpClientSecret,
+		Users:        users,
+		AutoLogin:    idpAutoLogin,
+		Log:          out,
+	})
+	if err != nil {
+		return err
+	}
+	provider.SetIssuer(issuer)
+
+	server := &http.Server{
+		Addr:              idpListen,
+		Handler:           provider,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	_, _ = fmt.Fprintf(out, "Mock OpenID Connect provider listening on %s\n\n", idpListen)
+	_, _ = fmt.Fprintf(out, `oauth2:
+  providers:
+    - id: "dev"
+      type: "custom"
+      display_name: "Dev IdP"
+      client_id: %q
+      client_secret: %q
+      issuer_url: %q
+
+`, idpClientID, idpClientSecret, issuer)
+	for _, user := range provider.Users() {
+		_, _ = fmt.Fprintf(out, "User: %s\n", describeIDPUser(user))
+	}
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// loadIDPUsers returns the users of --users-file and --user (nil for the default users)
+func loadIDPUsers() ([]oidctest.User, error) {
+	var users []oidctest.User
+	if idpUsersFile != "" {
+		data, err := os.ReadFile(idpUsersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read users file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &users); err != nil {
+			return nil, fmt.Errorf("failed to parse users file: %w", err)
+		}
+	}
+	for _, user := range idpUsers {
+		address, err := mail.ParseAddress(user)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --user %q: %w", user, err)
+		}
+		users = append(users, oidctest.User{Email: address.Address, Name: address.Name})
+	}
+	return users, nil
+}
+
+// describeIDPUser returns a one-line description of a user for the startup output
+func describeIDPUser(user oidctest.User) string {
+	description := user.Name
+	if user.Email != "" {
+		description = fmt.Sprintf("%s <%s>", user.Name, user.Email)
+		if user.Name == "" {
+			description = user.Email
+		}
+		if user.Unverified {
+			description += " (unverified)"
+		}
+	} else {
+		description += " (no email)"
+	}
+	if user.Subject != "" {
+		description += " sub=" + user.Subject
+	}
+	return description
+}
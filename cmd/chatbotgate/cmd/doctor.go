@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ideamans/chatbotgate/cmd/chatbotgate/cmd/server"
+	"github.com/spf13/cobra"
+)
+
+var doctorOptions server.DoctorOptions
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration and environment for common misconfigurations",
+	Long: `Check the configuration file and the environment it runs in for the problems
+that most often break sign-ins, and print how to fix each one:
+
+- OAuth2 callback URLs that do not match server.base_url or the tenant hosts
+- session.cookie.secure that does not suit the protocol of the base URL
+- SameSite=None cookies without Secure
+- DNS resolution of the base URLs, upstreams, Redis and OAuth2 providers
+- KVS connectivity (Redis is written and read, LevelDB directories must be writable)
+- Upstream and OAuth2 provider reachability
+- Clock skew against the Date headers of the servers reached
+
+Run it on the host (or in the container) that runs ChatbotGate, so network checks
+see what the server sees. The command exits with status 1 if any check fails.
+
+  chatbotgate doctor -c config.yaml`,
+	SilenceUsage:  true, // Failed checks are reported with their fixes: print the error once, without usage
+	SilenceErrors: true,
+	RunE:          runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().DurationVar(&doctorOptions.Timeout, "timeout", 0, "Timeout of each network check (default 5s)")
+	doctorCmd.Flags().BoolVar(&doctorOptions.SkipNetwork, "skip-network", false, "Only check the configuration, without DNS, KVS, upstream or provider requests")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	opts := doctorOptions
+	if cmd.Flags().Changed("host") {
+		opts.Host = host
+	}
+	if cmd.Flags().Changed("port") {
+		opts.Port = port
+	}
+
+	checks, err := server.RunDoctor(cmd.Context(), cfgFile, opts)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "Checking %s\n\n", cfgFile)
+	var failures, warnings int
+	for _, check := range checks {
+		mark := "✓"
+		switch check.Status {
+		case server.DoctorWarn:
+			mark = "!"
+			warnings++
+		case server.DoctorFail:
+			mark = "✗"
+			failures++
+		case server.DoctorSkip:
+			mark = "-"
+		}
+		_, _ = fmt.Fprintf(out, "%s %s: %s\n", mark, check.Name, check.Detail)
+		if check.Fix != "" {
+			_, _ = fmt.Fprintf(out, "    Fix: %s\n", check.Fix)
+		}
+	}
+
+	_, _ = fmt.Fprintf(out, "\n%d failed, %d warnings\n", failures, warnings)
+	if failures > 0 {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
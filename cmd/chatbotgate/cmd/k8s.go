@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ideamans/chatbotgate/cmd/chatbotgate/cmd/server"
+	"github.com/spf13/cobra"
+)
+
+// k8sCmd groups tools for deploying to Kubernetes
+var k8sCmd = &cobra.Command{
+	Use:   "k8s",
+	Short: "Tools for deploying to Kubernetes",
+}
+
+var manifestOptions server.ManifestOptions
+
+// manifestCmd represents the k8s manifest command
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Render Kubernetes manifests from the configuration file",
+	Long: `Render a ConfigMap, Secret, Deployment and Service running the configuration
+file, with the port, probe paths and volumes taken from the configuration.
+
+- The ConfigMap holds the configuration file as is
+- The Secret holds the environment variables it references (${VAR}), with empty
+  placeholders unless --from-env fills in their current values
+- The Deployment wires the readiness, liveness and startup probes to the health
+  endpoint under server.auth_path_prefix, with resource hints
+
+Warnings about settings that do not suit Kubernetes (secrets written into the file,
+per-pod session storage with several replicas) are printed to stderr.
+
+  chatbotgate k8s manifest -c config.yaml --namespace auth > chatbotgate.yaml
+  kubectl apply -f chatbotgate.yaml`,
+	RunE: runManifest,
+}
+
+func init() {
+	manifestCmd.Flags().StringVar(&manifestOptions.Name, "name", "chatbotgate", "Name of the resources")
+	manifestCmd.Flags().StringVar(&manifestOptions.Namespace, "namespace", "", "Namespace of the resources")
+	manifestCmd.Flags().StringVar(&manifestOptions.Image, "image", "", "Container image (default: ideamans/chatbotgate:<version>)")
+	manifestCmd.Flags().IntVar(&manifestOptions.Replicas, "replicas", 0, "Number of replicas (default: 2 with a Redis session KVS, 1 otherwise)")
+	manifestCmd.Flags().StringVar(&manifestOptions.CPURequest, "cpu-request", "100m", "CPU request")
+	manifestCmd.Flags().StringVar(&manifestOptions.MemoryRequest, "memory-request", "128Mi", "Memory request")
+	manifestCmd.Flags().StringVar(&manifestOptions.MemoryLimit, "memory-limit", "512Mi", "Memory limit")
+	manifestCmd.Flags().BoolVar(&manifestOptions.FromEnv, "from-env", false, "Fill the Secret with the current environment variable values")
+	k8sCmd.AddCommand(manifestCmd)
+	rootCmd.AddCommand(k8sCmd)
+}
+
+func runManifest(cmd *cobra.Command, args []string) error {
+	opts := manifestOptions
+	if opts.Image == "" && version != "dev" {
+		opts.Image = "ideamans/chatbotgate:" + version
+	}
+
+	manifest, warnings, err := server.RenderManifest(cfgFile, opts)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", warning)
+	}
+	_, err = cmd.OutOrStdout().Write(manifest)
+	return err
+}
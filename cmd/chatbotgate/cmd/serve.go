@@ -28,8 +28,11 @@ The server will:
 	RunE: runServe,
 }
 
+var serveChaos string
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveChaos, "chaos", "", `Inject KVS faults for development, e.g. "latency=50ms,jitter=20ms,error_rate=0.05,partial_rate=0.01"`)
 }
 
 func runServe(cmd *cobra.Command, args []string) error {
@@ -69,10 +72,23 @@ func runServe(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	logger, err := logging.NewLoggerWithFile("main", level, appConfig.Logging.Color, fileRotationConfig)
+	// With module_level, the policy logger decides per module, so the base logger lets its lowest level through
+	policy := appConfig.Logging.LogPolicy()
+	if appConfig.Logging.HasModulePolicy() {
+		level = policy.MinLevel()
+	}
+
+	baseLogger, err := logging.NewLoggerWithFile("main", level, appConfig.Logging.Color, fileRotationConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create logger: %w", err)
 	}
+	var logger logging.Logger = baseLogger
+	if scrubber, ok := appConfig.Logging.LogScrubber(); ok {
+		logger = logging.NewScrubbingLogger(logger, scrubber)
+	}
+	if appConfig.Logging.HasModulePolicy() {
+		logger = logging.NewPolicyLogger(logger, "main", policy)
+	}
 
 	// Create server configuration from command-line flags
 	cfg := server.Config{
@@ -83,6 +99,7 @@ func runServe(cmd *cobra.Command, args []string) error {
 		PortSet:    cmd.Flags().Changed("port"),
 		Logger:     logger,
 		Version:    version,
+		Chaos:      serveChaos,
 	}
 
 	// Run the server
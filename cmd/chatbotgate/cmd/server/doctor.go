@@ -0,0 +1,637 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/outbound"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// DoctorStatus is the outcome of a doctor check
+type DoctorStatus string
+
+const (
+	DoctorOK   DoctorStatus = "ok"   // Nothing to fix
+	DoctorWarn DoctorStatus = "warn" // Works, but likely not as intended
+	DoctorFail DoctorStatus = "fail" // Breaks sign-in or proxying
+	DoctorSkip DoctorStatus = "skip" // Could not be checked
+)
+
+// Clock skew thresholds: ID tokens and signed assertions are checked with small leeways
+const (
+	doctorSkewWarn = 30 * time.Second
+	doctorSkewFail = 5 * time.Minute
+)
+
+// doctorProbeKey is the key written and deleted to check Redis connectivity
+const doctorProbeKey = "chatbotgate:doctor"
+
+// DoctorOptions configures the checks of RunDoctor
+type DoctorOptions struct {
+	Host        string        // Listening host, used for the callback URL without base_url (default: from the config file, or "0.0.0.0")
+	Port        int           // Listening port (default: from the config file, or 4180)
+	Timeout     time.Duration // Timeout of each network check (default: 5 seconds)
+	SkipNetwork bool          // Only check the configuration (no DNS, KVS, upstream or provider requests)
+
+	// LookupHost resolves host names (default: net.DefaultResolver.LookupHost)
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// DoctorCheck is the result of one check of RunDoctor
+type DoctorCheck struct {
+	Name   string       // What was checked (e.g., "cookie_secure", "upstream")
+	Status DoctorStatus // Outcome
+	Detail string       // What was found
+	Fix    string       // How to fix it (warnings and failures)
+}
+
+// publicURL is a base URL the browsers reach the gate at: server.base_url, or a tenant's
+type publicURL struct {
+	scope   string   // "server" or "tenant <id>"
+	setting string   // Setting to fix (e.g., "server.base_url")
+	baseURL string   // Configured base URL ("" derives it from the listening address)
+	hosts   []string // Host names of the tenant (none for the server)
+}
+
+// doctor runs the checks of one configuration
+type doctor struct {
+	cfg    *config.Config
+	proxy  *ProxyConfig
+	opts   DoctorOptions
+	checks []DoctorCheck
+	dates  []time.Time // Date headers of the responses to network checks, compared for clock skew
+}
+
+// RunDoctor checks the configuration file for common misconfigurations: callback URLs that do not match
+// the base URL or tenant hosts, cookie flags that do not suit the protocol, and, unless SkipNetwork,
+// clock skew, KVS connectivity, upstream and provider reachability and DNS resolution.
+// Returns an error only when the configuration file cannot be read.
+func RunDoctor(ctx context.Context, configPath string, opts DoctorOptions) ([]DoctorCheck, error) {
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.LookupHost == nil {
+		opts.LookupHost = net.DefaultResolver.LookupHost
+	}
+	if serverCfg, err := loadServerConfig(configPath); err == nil {
+		if opts.Host == "" {
+			opts.Host = serverCfg.Host
+		}
+		if opts.Port == 0 {
+			opts.Port = serverCfg.Port
+		}
+	}
+	if opts.Host == "" {
+		opts.Host = "0.0.0.0"
+	}
+	if opts.Port == 0 {
+		opts.Port = 4180
+	}
+
+	d := &doctor{opts: opts}
+	cfg, err := config.NewFileLoader(configPath).Load()
+	if err != nil {
+		d.add("config", DoctorFail, err.Error(), "Run \"chatbotgate test-config\" and fix the reported settings")
+		return d.checks, nil
+	}
+	d.cfg = cfg
+	d.add("config", DoctorOK, "configuration is valid", "")
+
+	if d.proxy, err = readProxyConfig(configPath); err != nil {
+		d.add("proxy", DoctorFail, err.Error(), "Fix the proxy section of the configuration file")
+	}
+
+	for _, public := range d.publicURLs() {
+		d.checkCallbackURL(public)
+		d.checkCookieSecure(public)
+	}
+	d.checkSameSite()
+
+	if opts.SkipNetwork {
+		return d.checks, nil
+	}
+	d.checkDNS(ctx)
+	d.checkKVS(ctx)
+	d.checkUpstreams(ctx)
+	d.checkProviders(ctx)
+	d.checkClock()
+	return d.checks, nil
+}
+
+// add records the result of a check
+func (d *doctor) add(name string, status DoctorStatus, detail, fix string) {
+	d.checks = append(d.checks, DoctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// publicURLs returns the base URLs of the server and of each tenant
+func (d *doctor) publicURLs() []publicURL {
+	publics := []publicURL{{scope: "server", setting: "server.base_url", baseURL: d.cfg.Server.BaseURL}}
+	for i, tenant := range d.cfg.Tenants {
+		public := publicURL{
+			scope:   "tenant " + tenant.ID,
+			setting: fmt.Sprintf("tenants[%d].base_url", i),
+			baseURL: tenant.BaseURL,
+			hosts:   tenant.Hosts,
+		}
+		if public.baseURL == "" {
+			public.baseURL = d.cfg.Server.BaseURL
+		}
+		publics = append(publics, public)
+	}
+	return publics
+}
+
+// callbackURL returns the OAuth2 callback URL of a base URL, as the factory derives it
+func (d *doctor) callbackURL(public publicURL) string {
+	serverCfg := d.cfg.Server
+	serverCfg.BaseURL = public.baseURL
+	return serverCfg.GetCallbackURL(d.opts.Host, d.opts.Port)
+}
+
+// checkCallbackURL checks that the callback URL reaches the gate on the host that set the state cookie
+func (d *doctor) checkCallbackURL(public publicURL) {
+	name := "callback_url (" + public.scope + ")"
+	callback := d.callbackURL(public)
+
+	if public.baseURL == "" {
+		if len(public.hosts) > 0 {
+			d.add(name, DoctorFail,
+				fmt.Sprintf("callback URL is %s, not on the tenant hosts %s: the state cookie is not sent there and sign-ins fail with an invalid state", callback, strings.Join(public.hosts, ", ")),
+				fmt.Sprintf("Set %s to the public URL of the tenant (e.g., \"https://%s\")", public.setting, public.hosts[0]))
+			return
+		}
+		d.add(name, DoctorWarn,
+			fmt.Sprintf("base_url is not set: callback URL and email links use the listening address (%s)", callback),
+			fmt.Sprintf("Set %s to the public URL browsers use (e.g., \"https://chat.example.com\") and register the resulting callback URL with the providers", public.setting))
+		return
+	}
+
+	u, err := url.Parse(public.baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		d.add(name, DoctorFail,
+			fmt.Sprintf("base_url %q is not an absolute http(s) URL", public.baseURL),
+			fmt.Sprintf("Set %s to the scheme and host browsers use (e.g., \"https://chat.example.com\")", public.setting))
+		return
+	}
+
+	if path := strings.TrimRight(u.Path, "/"); path != "" {
+		if path == d.cfg.Server.GetMountPath() {
+			d.add(name, DoctorFail,
+				fmt.Sprintf("base_url ends with the mount path, which the callback URL repeats: %s", callback),
+				fmt.Sprintf("Remove %q from %s; server.mount_path is added to the callback URL", path, public.setting))
+		} else {
+			d.add(name, DoctorWarn,
+				fmt.Sprintf("base_url has the path %q, which routing does not know about: %s", path, callback),
+				fmt.Sprintf("Remove the path from %s and set server.mount_path: %q to serve ChatbotGate under it", public.setting, path))
+		}
+		return
+	}
+
+	host := u.Hostname()
+	if len(public.hosts) > 0 && d.cfg.Server.CentralAuthURL == "" && !containsHost(public.hosts, host) {
+		d.add(name, DoctorFail,
+			fmt.Sprintf("callback URL %s is not on the tenant hosts %s: the state cookie is not sent there and sign-ins fail with an invalid state", callback, strings.Join(public.hosts, ", ")),
+			fmt.Sprintf("Set %s to the public URL of the tenant (e.g., \"https://%s\")", public.setting, public.hosts[0]))
+		return
+	}
+	if domain := strings.TrimPrefix(d.cfg.Session.Cookie.Domain, "."); domain != "" && !withinDomain(host, domain) {
+		d.add(name, DoctorFail,
+			fmt.Sprintf("session.cookie.domain %q does not cover %s: browsers reject the session cookie there", d.cfg.Session.Cookie.Domain, host),
+			fmt.Sprintf("Set session.cookie.domain to a parent domain of %s, or leave it empty for a host-only cookie", host))
+		return
+	}
+	d.add(name, DoctorOK, "callback URL is "+callback+"; register it with the OAuth2 providers", "")
+}
+
+// checkCookieSecure checks that session.cookie.secure suits the protocol of the base URL
+func (d *doctor) checkCookieSecure(public publicURL) {
+	name := "cookie_secure (" + public.scope + ")"
+	u, err := url.Parse(d.callbackURL(public))
+	if err != nil {
+		return
+	}
+	secure := d.cfg.Session.Cookie.Secure
+
+	switch {
+	case u.Scheme == "https" && !secure:
+		d.add(name, DoctorWarn,
+			"session.cookie.secure is false on an https base URL: browsers also send the session cookie over plain HTTP",
+			"Set session.cookie.secure: true")
+	case u.Scheme == "http" && secure && !isLoopback(u.Hostname()):
+		d.add(name, DoctorFail,
+			fmt.Sprintf("session.cookie.secure is true on http://%s: browsers drop the session cookie and sign-ins loop back to the login page", u.Host),
+			"Serve ChatbotGate over https (and set the base URL accordingly), or set session.cookie.secure: false for local testing")
+	default:
+		d.add(name, DoctorOK, fmt.Sprintf("session.cookie.secure is %t on %s", secure, u.Scheme), "")
+	}
+}
+
+// checkSameSite checks that SameSite=None cookies are Secure, which browsers require
+func (d *doctor) checkSameSite() {
+	cookie := d.cfg.Session.Cookie
+	if cookie.GetSameSite() == http.SameSiteNoneMode && !cookie.Secure {
+		d.add("cookie_samesite", DoctorFail,
+			"session.cookie.samesite is none without secure: browsers reject the session cookie",
+			"Set session.cookie.secure: true (and serve over https), or use samesite: lax")
+		return
+	}
+	d.add("cookie_samesite", DoctorOK, "session.cookie.samesite suits session.cookie.secure", "")
+}
+
+// checkDNS resolves the host names the gate connects to or is reached at
+func (d *doctor) checkDNS(ctx context.Context) {
+	type target struct {
+		host     string
+		reached  string // What is reached at the host, for the message
+		optional bool   // Base URLs may only resolve outside the gate's network (split-horizon DNS)
+	}
+	var targets []target
+	seen := make(map[string]bool)
+	addHost := func(host, reached string, optional bool) {
+		if host == "" || seen[host] || net.ParseIP(host) != nil || isLoopback(host) {
+			return
+		}
+		seen[host] = true
+		targets = append(targets, target{host, reached, optional})
+	}
+	addURL := func(rawURL, reached string, optional bool) {
+		if u, err := url.Parse(rawURL); err == nil {
+			addHost(u.Hostname(), reached, optional)
+		}
+	}
+
+	for _, public := range d.publicURLs() {
+		addURL(public.baseURL, public.setting, true)
+	}
+	for _, upstream := range d.upstreams() {
+		addURL(upstream.URL, "the upstream", false)
+	}
+	for _, store := range d.kvsConfigs() {
+		if store.cfg.Type == "redis" {
+			host, _, err := net.SplitHostPort(store.cfg.Redis.Addr)
+			if err != nil {
+				host = store.cfg.Redis.Addr
+			}
+			addHost(host, "Redis of "+store.setting, false)
+		}
+	}
+	if d.cfg.Outbound.ProxyURL != "" {
+		// Provider host names are resolved by the proxy
+		addURL(d.cfg.Outbound.ProxyURL, "outbound.proxy_url", false)
+	} else {
+		for _, probe := range d.providerProbes() {
+			addURL(probe.url, "provider "+probe.id, false)
+		}
+	}
+
+	for _, t := range targets {
+		lookupCtx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+		addrs, err := d.opts.LookupHost(lookupCtx, t.host)
+		cancel()
+		switch {
+		case err == nil:
+			d.add("dns "+t.host, DoctorOK, fmt.Sprintf("%s resolves to %s", t.host, strings.Join(addrs, ", ")), "")
+		case t.optional:
+			d.add("dns "+t.host, DoctorWarn,
+				fmt.Sprintf("%s (%s) does not resolve from here: %v", t.host, t.reached, err),
+				"Ignore this if the name only resolves outside this network; otherwise add the DNS record")
+		default:
+			d.add("dns "+t.host, DoctorFail,
+				fmt.Sprintf("%s (%s) does not resolve: %v", t.host, t.reached, err),
+				"Check the host name, the DNS record and the resolver of this host (/etc/resolv.conf, container DNS)")
+		}
+	}
+}
+
+// doctorKVS is a KVS store of the configuration
+type doctorKVS struct {
+	setting string
+	cfg     kvs.Config
+}
+
+// kvsConfigs returns the default store and the dedicated ones
+func (d *doctor) kvsConfigs() []doctorKVS {
+	stores := []doctorKVS{{"kvs.default", d.cfg.KVS.Default}}
+	if d.cfg.KVS.Session != nil {
+		stores = append(stores, doctorKVS{"kvs.session", *d.cfg.KVS.Session})
+	}
+	if d.cfg.KVS.Token != nil {
+		stores = append(stores, doctorKVS{"kvs.token", *d.cfg.KVS.Token})
+	}
+	if d.cfg.KVS.EmailQuota != nil {
+		stores = append(stores, doctorKVS{"kvs.email_quota", *d.cfg.KVS.EmailQuota})
+	}
+	return stores
+}
+
+// checkKVS checks that the KVS stores can be used: Redis is connected to and written,
+// LevelDB directories are checked for write access (a running server holds their lock)
+func (d *doctor) checkKVS(ctx context.Context) {
+	for _, store := range d.kvsConfigs() {
+		name := "kvs (" + store.setting + ")"
+		switch store.cfg.Type {
+		case "redis":
+			d.checkRedis(ctx, name, store)
+		case "leveldb":
+			d.checkLevelDB(name, store)
+		default:
+			d.add(name, DoctorOK, "memory store: sessions are lost on restart and not shared between instances", "")
+		}
+	}
+}
+
+// checkRedis connects to a Redis store and writes, reads and deletes a probe key
+func (d *doctor) checkRedis(ctx context.Context, name string, store doctorKVS) {
+	cfg := store.cfg
+	cfg.Fallback = nil
+	s, err := kvs.New(cfg)
+	if err != nil {
+		d.add(name, DoctorFail, err.Error(),
+			fmt.Sprintf("Check %s.redis.addr, the password and that Redis accepts connections from this host", store.setting))
+		return
+	}
+	defer func() { _ = s.Close() }()
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+	err = s.Set(ctx, doctorProbeKey, []byte("ok"), time.Minute)
+	if err == nil {
+		_, err = s.Get(ctx, doctorProbeKey)
+	}
+	if err == nil {
+		err = s.Delete(ctx, doctorProbeKey)
+	}
+	if err != nil {
+		d.add(name, DoctorFail, "Redis is reachable but cannot be written: "+err.Error(),
+			"Check the ACL of the Redis user and that the instance is not read-only (a replica) or out of memory")
+		return
+	}
+	d.add(name, DoctorOK, "Redis at "+cfg.Redis.Addr+" is reachable and writable", "")
+}
+
+// checkLevelDB checks that the LevelDB directory can be written
+func (d *doctor) checkLevelDB(name string, store doctorKVS) {
+	path := store.cfg.LevelDB.Path
+	if path == "" {
+		d.add(name, DoctorWarn, "leveldb.path is not set: the store is in a temporary directory, lost on restart",
+			fmt.Sprintf("Set %s.leveldb.path to a persistent directory", store.setting))
+		return
+	}
+
+	// The directory is created on start when missing: check the nearest existing one
+	dir := path
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && info.IsDir() {
+			break
+		}
+		if err == nil || !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			d.add(name, DoctorFail, fmt.Sprintf("%s is not a usable directory: %v", dir, err),
+				fmt.Sprintf("Set %s.leveldb.path to a writable directory", store.setting))
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+	probe, err := os.CreateTemp(dir, ".chatbotgate-doctor-*")
+	if err != nil {
+		d.add(name, DoctorFail, fmt.Sprintf("%s is not writable: %v", dir, err),
+			fmt.Sprintf("Give the user running ChatbotGate write access to %s (or mount a volume there)", dir))
+		return
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+	d.add(name, DoctorOK, "LevelDB directory "+path+" is writable", "")
+}
+
+// upstreams returns the upstream of the proxy and those of the tenants, with the proxy defaults applied
+func (d *doctor) upstreams() []proxy.UpstreamConfig {
+	if d.proxy == nil {
+		return nil
+	}
+	upstreams := []proxy.UpstreamConfig{d.proxy.Proxy.upstreamWithDefaults(d.proxy.Proxy.Upstream)}
+	for _, tenant := range d.proxy.Tenants {
+		if tenant.Upstream != nil {
+			upstreams = append(upstreams, d.proxy.Proxy.upstreamWithDefaults(*tenant.Upstream))
+		}
+	}
+	return upstreams
+}
+
+// checkUpstreams requests the upstream URLs: any HTTP response means they are reachable
+func (d *doctor) checkUpstreams(ctx context.Context) {
+	for _, upstream := range d.upstreams() {
+		name := "upstream " + upstream.URL
+		client := &http.Client{
+			Timeout:       d.opts.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		if upstream.TLS != nil {
+			tlsConfig, err := proxy.NewTLSConfig(*upstream.TLS)
+			if err != nil {
+				d.add(name, DoctorFail, "invalid TLS settings: "+err.Error(), "Fix proxy.tls (or the upstream's tls)")
+				continue
+			}
+			client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		if err != nil {
+			d.add(name, DoctorFail, err.Error(), "Set the upstream url to an absolute http(s) URL")
+			continue
+		}
+		if upstream.Secret.Header != "" {
+			req.Header.Set(upstream.Secret.Header, upstream.Secret.Value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			d.add(name, DoctorFail, "upstream is not reachable: "+err.Error(), upstreamFix(err))
+			continue
+		}
+		_ = resp.Body.Close()
+		d.addDate(resp)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			d.add(name, DoctorWarn, fmt.Sprintf("upstream answers with HTTP %d", resp.StatusCode),
+				"Check the upstream application's logs")
+			continue
+		}
+		d.add(name, DoctorOK, fmt.Sprintf("upstream answers with HTTP %d", resp.StatusCode), "")
+	}
+}
+
+// upstreamFix returns the fix of an upstream connection error
+func upstreamFix(err error) string {
+	var certErr *tls.CertificateVerificationError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &certErr):
+		return "Add the upstream's CA to proxy.tls.ca_file, or set proxy.tls.server_name when the certificate is for another name"
+	case errors.As(err, &dnsErr):
+		return "Check the host name of the upstream url"
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+		return "Check firewalls and network policies between ChatbotGate and the upstream"
+	default:
+		return "Check that the upstream is running and listens on the host and port of its url (in containers, not on localhost of another container)"
+	}
+}
+
+// providerProbe is a URL of an OAuth2 provider requested to check it can be reached
+type providerProbe struct {
+	id        string
+	url       string
+	discovery bool // The URL is an OpenID Connect discovery document, which must answer 200
+}
+
+// providerProbes returns a URL of each enabled OAuth2 provider
+func (d *doctor) providerProbes() []providerProbe {
+	providers := d.cfg.OAuth2.Providers
+	for _, tenant := range d.cfg.Tenants {
+		if tenant.OAuth2 != nil {
+			providers = append(providers, tenant.OAuth2.Providers...)
+		}
+	}
+
+	var probes []providerProbe
+	seen := make(map[string]bool)
+	for _, p := range providers {
+		if p.Disabled {
+			continue
+		}
+		probe := providerProbe{id: p.ID}
+		switch p.Type {
+		case "google":
+			probe.url, probe.discovery = "https://accounts.google.com/.well-known/openid-configuration", true
+		case "microsoft":
+			probe.url, probe.discovery = "https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration", true
+		case "github":
+			probe.url = "https://github.com/login/oauth/authorize"
+		default:
+			if p.IssuerURL != "" {
+				probe.url, probe.discovery = strings.TrimRight(p.IssuerURL, "/")+"/.well-known/openid-configuration", true
+			} else {
+				probe.url = p.TokenURL
+			}
+		}
+		if probe.url != "" && !seen[probe.url] {
+			seen[probe.url] = true
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// checkProviders requests a URL of each OAuth2 provider through the outbound client, like sign-ins do
+func (d *doctor) checkProviders(ctx context.Context) {
+	probes := d.providerProbes()
+	if len(probes) == 0 {
+		return
+	}
+	outboundCfg := d.cfg.Outbound
+	outboundCfg.Timeout = d.opts.Timeout.String()
+	client, err := outbound.NewClient(outboundCfg)
+	if err != nil {
+		d.add("outbound", DoctorFail, err.Error(), "Fix the outbound section of the configuration file")
+		return
+	}
+
+	for _, probe := range probes {
+		name := "provider " + probe.id
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.url, nil)
+		if err != nil {
+			d.add(name, DoctorFail, err.Error(), "Set the provider's endpoint URLs to absolute https URLs")
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			fix := "Allow outbound HTTPS to the provider, or set outbound.proxy_url when the network requires a proxy"
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				fix = "Add the CA of the TLS-inspecting proxy or private IdP to outbound.ca_file"
+			}
+			d.add(name, DoctorFail, fmt.Sprintf("%s is not reachable: %v", probe.url, err), fix)
+			continue
+		}
+		_ = resp.Body.Close()
+		d.addDate(resp)
+		if probe.discovery && resp.StatusCode != http.StatusOK {
+			d.add(name, DoctorFail, fmt.Sprintf("discovery document %s answers with HTTP %d", probe.url, resp.StatusCode),
+				"Check issuer_url: it must be the issuer itself, without /.well-known/openid-configuration")
+			continue
+		}
+		d.add(name, DoctorOK, probe.url+" is reachable", "")
+	}
+}
+
+// addDate records the Date header of a response
+func (d *doctor) addDate(resp *http.Response) {
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		d.dates = append(d.dates, date)
+	}
+}
+
+// checkClock compares the local clock with the Date headers of the responses to the network checks
+func (d *doctor) checkClock() {
+	if len(d.dates) == 0 {
+		d.add("clock", DoctorSkip, "no response had a Date header to compare the clock with", "")
+		return
+	}
+	now := time.Now()
+	var skew time.Duration
+	for _, date := range d.dates {
+		if s := now.Sub(date).Abs(); s > skew {
+			skew = s
+		}
+	}
+	// Date headers have a resolution of one second
+	skew = skew.Truncate(time.Second)
+
+	fix := "Synchronize the clock of this host with NTP (e.g., enable systemd-timesyncd or chrony)"
+	switch {
+	case skew > doctorSkewFail:
+		d.add("clock", DoctorFail, fmt.Sprintf("clock is off by %s: ID tokens and email links are rejected as expired or not yet valid", skew), fix)
+	case skew > doctorSkewWarn:
+		d.add("clock", DoctorWarn, fmt.Sprintf("clock is off by %s", skew), fix)
+	default:
+		d.add("clock", DoctorOK, fmt.Sprintf("clock is within %s of the servers reached", doctorSkewWarn), "")
+	}
+}
+
+// containsHost reports whether hosts contains host (case-insensitive, ports ignored)
+func containsHost(hosts []string, host string) bool {
+	host = config.NormalizeHost(host)
+	for _, h := range hosts {
+		if config.NormalizeHost(h) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDomain reports whether host is domain or one of its subdomains
+func withinDomain(host, domain string) bool {
+	host, domain = strings.ToLower(host), strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// isLoopback reports whether host is localhost, which browsers treat as a secure context
+func isLoopback(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doctorBaseConfig is a valid configuration, completed with server and cookie settings by the tests
+const doctorBaseConfig = `service:
+  name: "Test"
+password_auth:
+  enabled: true
+  password: "test-password"
+proxy:
+  upstream:
+    url: "%UPSTREAM%"
+server:
+  auth_path_prefix: "/_auth"
+%SERVER%
+session:
+  cookie:
+    secret: "this-is-a-test-secret-with-32-chars"
+%COOKIE%
+`
+
+// runDoctorWith writes the base configuration with the settings and runs the doctor on it
+// server and cookie are lines of the server and session.cookie sections, extra is appended.
+func runDoctorWith(t *testing.T, upstream, server, cookie, extra string, opts DoctorOptions) map[string]DoctorCheck {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := strings.NewReplacer("%UPSTREAM%", upstream, "%SERVER%", server, "%COOKIE%", cookie).Replace(doctorBaseConfig) + extra
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	checks, err := RunDoctor(context.Background(), configPath, opts)
+	if err != nil {
+		t.Fatalf("RunDoctor() error = %v", err)
+	}
+	byName := make(map[string]DoctorCheck)
+	for _, check := range checks {
+		if check.Status != DoctorOK && check.Status != DoctorSkip && check.Fix == "" {
+			t.Errorf("%s: %s has no fix", check.Name, check.Status)
+		}
+		byName[check.Name] = check
+	}
+	if byName["config"].Status != DoctorOK {
+		t.Fatalf("config = %s: %s", byName["config"].Status, byName["config"].Detail)
+	}
+	return byName
+}
+
+func TestRunDoctor_Configuration(t *testing.T) {
+	tenant := "tenants:\n  - id: \"a\"\n    hosts: [\"a.example.com\"]\n"
+	tests := []struct {
+		name   string
+		server string
+		cookie string
+		extra  string
+		check  string
+		want   DoctorStatus
+	}{
+		{"base_url not set", "", "", "", "callback_url (server)", DoctorWarn},
+		{"base_url set", `  base_url: "https://chat.example.com"`, "", "", "callback_url (server)", DoctorOK},
+		{"base_url with mount path", "  base_url: \"https://example.com/bot\"\n  mount_path: \"/bot\"", "", "", "callback_url (server)", DoctorFail},
+		{"base_url with other path", `  base_url: "https://example.com/bot"`, "", "", "callback_url (server)", DoctorWarn},
+		{"cookie domain covering base_url", `  base_url: "https://chat.example.com"`, `    domain: ".example.com"`, "", "callback_url (server)", DoctorOK},
+		{"cookie domain not covering base_url", `  base_url: "https://chat.example.com"`, `    domain: "example.org"`, "", "callback_url (server)", DoctorFail},
+		{"tenant without base_url", "", "", tenant, "callback_url (tenant a)", DoctorFail},
+		{"tenant on another host", "", "", tenant + `    base_url: "https://b.example.com"`, "callback_url (tenant a)", DoctorFail},
+		{"tenant on its host", "", "", tenant + `    base_url: "https://a.example.com"`, "callback_url (tenant a)", DoctorOK},
+		{"insecure cookie on https", `  base_url: "https://chat.example.com"`, "", "", "cookie_secure (server)", DoctorWarn},
+		{"secure cookie on https", `  base_url: "https://chat.example.com"`, "    secure: true", "", "cookie_secure (server)", DoctorOK},
+		{"secure cookie on http", `  base_url: "http://chat.example.com"`, "    secure: true", "", "cookie_secure (server)", DoctorFail},
+		{"secure cookie on http localhost", "", "    secure: true", "", "cookie_secure (server)", DoctorOK},
+		{"samesite none with secure", "", "    secure: true\n    samesite: \"none\"", "", "cookie_samesite", DoctorOK},
+		{"samesite none without secure", "", `    samesite: "none"`, "", "cookie_samesite", DoctorFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := runDoctorWith(t, "http://127.0.0.1:1", tt.server, tt.cookie, tt.extra, DoctorOptions{SkipNetwork: true})
+			check, ok := checks[tt.check]
+			if !ok {
+				t.Fatalf("no %s check in %v", tt.check, checks)
+			}
+			if check.Status != tt.want {
+				t.Errorf("%s = %s (%s), want %s", tt.check, check.Status, check.Detail, tt.want)
+			}
+			for name := range checks {
+				if strings.HasPrefix(name, "upstream") {
+					t.Error("SkipNetwork should skip the upstream check")
+				}
+			}
+		})
+	}
+}
+
+func TestRunDoctor_Network(t *testing.T) {
+	// An upstream whose clock is 10 minutes ahead
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	lookups := make(map[string]bool)
+	opts := DoctorOptions{
+		Timeout: 2 * time.Second,
+		LookupHost: func(ctx context.Context, host string) ([]string, error) {
+			lookups[host] = true
+			return nil, errors.New("no such host")
+		},
+	}
+	kvsPath := filepath.Join(t.TempDir(), "kvs", "sessions")
+	extra := `kvs:
+  default:
+    type: "leveldb"
+    leveldb:
+      path: "` + kvsPath + `"
+  token:
+    type: "redis"
+    redis:
+      addr: "127.0.0.1:1"
+`
+	checks := runDoctorWith(t, upstream.URL, `  base_url: "https://chat.example.com"`, "    secure: true", extra, opts)
+
+	for name, want := range map[string]DoctorStatus{
+		"upstream " + upstream.URL: DoctorOK, // Any HTTP response means it is reachable
+		"clock":                    DoctorFail,
+		"kvs (kvs.default)":        DoctorOK, // The missing directory is created on start
+		"kvs (kvs.token)":          DoctorFail,
+		"dns chat.example.com":     DoctorWarn, // Base URLs may only resolve outside the network
+	} {
+		if got := checks[name]; got.Status != want {
+			t.Errorf("%s = %q (%s), want %s", name, got.Status, got.Detail, want)
+		}
+	}
+	if len(lookups) != 1 {
+		t.Errorf("looked up %v, want only the base_url host (IP addresses are not resolved)", lookups)
+	}
+
+	// An upstream that does not listen
+	checks = runDoctorWith(t, "http://127.0.0.1:1", "", "", "", opts)
+	if got := checks["upstream http://127.0.0.1:1"]; got.Status != DoctorFail {
+		t.Errorf("upstream = %q (%s), want %s", got.Status, got.Detail, DoctorFail)
+	}
+	if got := checks["clock"]; got.Status != DoctorSkip {
+		t.Errorf("clock = %q, want %s without Date headers", got.Status, DoctorSkip)
+	}
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	sharedconfig "github.com/ideamans/chatbotgate/pkg/shared/config"
+	"gopkg.in/yaml.v3"
+)
+
+// configMountDir is where the manifest mounts the configuration file (the image's default config location)
+const configMountDir = "/etc/chatbotgate"
+
+// ManifestOptions configures the Kubernetes manifests rendered by RenderManifest
+type ManifestOptions struct {
+	Name          string // Name of the resources and app.kubernetes.io/instance label (default: "chatbotgate")
+	Namespace     string // Optional: namespace of the resources
+	Image         string // Container image (default: "ideamans/chatbotgate:latest")
+	Replicas      int    // 0 = 2 with a Redis session KVS, 1 otherwise
+	CPURequest    string // default: "100m"
+	MemoryRequest string // default: "128Mi"
+	MemoryLimit   string // default: "512Mi"
+	FromEnv       bool   // Fill the Secret with the current values of the environment variables instead of placeholders
+}
+
+// manifestData is the input of manifestTemplate
+type manifestData struct {
+	ManifestOptions
+	ConfigFile    string
+	ConfigKey     string
+	Config        string
+	Env           []manifestEnv
+	Port          int
+	HealthPath    string
+	ProbeTimeout  int
+	LevelDBPath   string
+	ConfigMapName string
+	SecretName    string
+	Labels        string // Labels of the resources, also selecting the pods
+}
+
+// manifestEnv is an environment variable of the Secret
+type manifestEnv struct {
+	Name  string
+	Value string
+}
+
+var manifestTemplate = template.Must(template.New("manifest").Funcs(template.FuncMap{
+	"quote":  strconv.Quote,
+	"indent": indentLines,
+}).Parse(`# Generated by "chatbotgate k8s manifest" from {{ .ConfigFile }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .ConfigMapName }}
+{{- template "meta" . }}
+data:
+  {{ .ConfigKey }}: |
+{{ indent .Config "    " }}
+{{- if .Env }}
+---
+# Values of the ${VAR} references of the configuration
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .SecretName }}
+{{- template "meta" . }}
+type: Opaque
+stringData:
+{{- range .Env }}
+  {{ .Name }}: {{ quote .Value }}
+{{- end }}
+{{- end }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+{{- template "meta" . }}
+spec:
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+{{ indent .Labels "      " }}
+  template:
+    metadata:
+      labels:
+{{ indent .Labels "        " }}
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 1000
+        runAsGroup: 1000
+        fsGroup: 1000
+      containers:
+        - name: chatbotgate
+          image: {{ .Image }}
+          args: ["serve", "--config", {{ quote (printf "%s/%s" "` + configMountDir + `" .ConfigKey) }}]
+          ports:
+            - name: http
+              containerPort: {{ .Port }}
+{{- if .Env }}
+          envFrom:
+            - secretRef:
+                name: {{ .SecretName }}
+{{- end }}
+          # Not ready while starting or warming up (KVS connection, OIDC discovery)
+          startupProbe:
+            httpGet:
+              path: {{ .HealthPath }}
+              port: http
+            periodSeconds: 2
+            failureThreshold: 30
+          readinessProbe:
+            httpGet:
+              path: {{ .HealthPath }}
+              port: http
+            periodSeconds: 5
+            timeoutSeconds: {{ .ProbeTimeout }}
+            failureThreshold: 2
+          livenessProbe:
+            httpGet:
+              path: {{ .HealthPath }}?probe=live
+              port: http
+            periodSeconds: 10
+            timeoutSeconds: 2
+            failureThreshold: 3
+          # Keep serving while endpoints are removed; SIGTERM then drains (readiness returns 503)
+          lifecycle:
+            preStop:
+              exec:
+                command: ["sleep", "5"]
+          resources:
+            requests:
+              cpu: {{ .CPURequest }}
+              memory: {{ .MemoryRequest }}
+            limits:
+              memory: {{ .MemoryLimit }}
+          volumeMounts:
+            - name: config
+              mountPath: ` + configMountDir + `
+              readOnly: true
+{{- if .LevelDBPath }}
+            - name: kvs
+              mountPath: {{ .LevelDBPath }}
+{{- end }}
+      volumes:
+        - name: config
+          configMap:
+            name: {{ .ConfigMapName }}
+{{- if .LevelDBPath }}
+        - name: kvs
+          emptyDir: {}
+{{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+{{- template "meta" . }}
+spec:
+  selector:
+{{ indent .Labels "    " }}
+  ports:
+    - name: http
+      port: 80
+      targetPort: http
+{{- define "meta" }}
+{{- if .Namespace }}
+  namespace: {{ .Namespace }}
+{{- end }}
+  labels:
+{{ indent .Labels "    " }}
+{{- end }}
+`))
+
+// RenderManifest renders a ConfigMap, Secret, Deployment and Service running the configuration file
+// The ConfigMap holds the file as is, and the Secret the values of its ${VAR} references (placeholders
+// unless opts.FromEnv), so secrets stay out of the ConfigMap. Probes, port and volumes follow the
+// configuration. Warnings report settings that do not suit Kubernetes (inline secrets, local KVS).
+func RenderManifest(configPath string, opts ManifestOptions) ([]byte, []string, error) {
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal(sharedconfig.ExpandEnvBytes(raw), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	serverCfg, err := loadServerConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Name == "" {
+		opts.Name = "chatbotgate"
+	}
+	if opts.Image == "" {
+		opts.Image = "ideamans/chatbotgate:latest"
+	}
+	if opts.CPURequest == "" {
+		opts.CPURequest = "100m"
+	}
+	if opts.MemoryRequest == "" {
+		opts.MemoryRequest = "128Mi"
+	}
+	if opts.MemoryLimit == "" {
+		opts.MemoryLimit = "512Mi"
+	}
+
+	var warnings []string
+	sessionKVS := cfg.KVS.Default
+	if cfg.KVS.Session != nil {
+		sessionKVS = *cfg.KVS.Session
+	}
+	if sessionKVS.Type == "" {
+		sessionKVS.Type = "memory"
+	}
+	if opts.Replicas == 0 {
+		opts.Replicas = 1
+		if sessionKVS.Type == "redis" {
+			opts.Replicas = 2
+		}
+	}
+	if sessionKVS.Type != "redis" && opts.Replicas > 1 {
+		warnings = append(warnings, fmt.Sprintf("sessions are kept per pod (kvs type %q): users are signed out when routed to another replica; use redis with replicas > 1", sessionKVS.Type))
+	}
+	levelDBPath := ""
+	if sessionKVS.Type == "leveldb" {
+		levelDBPath = sessionKVS.LevelDB.Path
+		if levelDBPath == "" {
+			warnings = append(warnings, "kvs leveldb.path is not set: sessions are stored in the container's cache directory")
+		}
+	}
+	if serverCfg.Host == "127.0.0.1" || serverCfg.Host == "localhost" {
+		warnings = append(warnings, fmt.Sprintf("server.host %q is not reachable from outside the pod; use 0.0.0.0", serverCfg.Host))
+	}
+	warnings = append(warnings, inlineSecretWarnings(&cfg, string(raw))...)
+
+	port := serverCfg.Port
+	if port == 0 {
+		port = 4180
+	}
+	probeTimeout := 2
+	if len(cfg.Health.Checks) > 0 {
+		// The dependency probes run within health.timeout; leave the kubelet a second more
+		probeTimeout = int(math.Ceil(cfg.Health.GetTimeout().Seconds())) + 1
+	}
+
+	var env []manifestEnv
+	for _, name := range sharedconfig.ExtractEnvVars(string(raw)) {
+		value := ""
+		if opts.FromEnv {
+			value = os.Getenv(name)
+		}
+		env = append(env, manifestEnv{Name: name, Value: value})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+	ext := strings.ToLower(filepath.Ext(configPath))
+	if ext == ".yml" {
+		ext = ".yaml"
+	}
+	data := manifestData{
+		ManifestOptions: opts,
+		ConfigFile:      filepath.Base(configPath),
+		ConfigKey:       "config" + ext,
+		Config:          strings.TrimRight(string(raw), "\n"),
+		Env:             env,
+		Port:            port,
+		HealthPath:      normalizeHealthPrefix(cfg.Server.GetAuthPathPrefix()) + "/health",
+		ProbeTimeout:    probeTimeout,
+		LevelDBPath:     levelDBPath,
+		ConfigMapName:   opts.Name + "-config",
+		SecretName:      opts.Name + "-env",
+		Labels:          "app.kubernetes.io/name: chatbotgate\napp.kubernetes.io/instance: " + opts.Name,
+	}
+
+	var buf bytes.Buffer
+	if err := manifestTemplate.Execute(&buf, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to render manifest: %w", err)
+	}
+	return buf.Bytes(), warnings, nil
+}
+
+// inlineSecretWarnings reports secrets written into the configuration file instead of ${VAR} references,
+// since the file ends up in a ConfigMap
+func inlineSecretWarnings(cfg *config.Config, raw string) []string {
+	var warnings []string
+	for _, secret := range cfg.SecretValues() {
+		// A value expanded from ${VAR} does not appear in the file itself
+		if strings.Contains(raw, secret.Value) {
+			warnings = append(warnings, fmt.Sprintf("%s is written in the config file, which goes into the ConfigMap; use a ${VAR} reference to move it to the Secret", secret.Path))
+		}
+	}
+	return warnings
+}
+
+// normalizeHealthPrefix returns the auth path prefix with a leading and without a trailing slash ("" for "/")
+func normalizeHealthPrefix(prefix string) string {
+	if prefix = strings.Trim(prefix, "/"); prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// indentLines prefixes every non-empty line of text with indent
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeManifest decodes the documents of a rendered manifest keyed by kind
+func decodeManifest(t *testing.T, manifest []byte) map[string]map[string]interface{} {
+	t.Helper()
+	docs := make(map[string]map[string]interface{})
+	decoder := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+			return docs
+		} else if err != nil {
+			t.Fatalf("manifest is not valid YAML: %v\n%s", err, manifest)
+		}
+		docs[doc["kind"].(string)] = doc
+	}
+}
+
+// lookup follows a path of map keys and list indexes in a decoded document
+func lookup(t *testing.T, doc interface{}, path ...interface{}) interface{} {
+	t.Helper()
+	for _, key := range path {
+		switch k := key.(type) {
+		case string:
+			doc = doc.(map[string]interface{})[k]
+		case int:
+			doc = doc.([]interface{})[k]
+		}
+	}
+	return doc
+}
+
+func TestRenderManifest(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `server:
+  auth_path_prefix: "/auth"
+  port: 8080
+session:
+  cookie:
+    secret: "${COOKIE_SECRET}"
+password_auth:
+  enabled: true
+  password: "literal-password"
+kvs:
+  default:
+    type: "redis"
+    redis:
+      addr: "${REDIS_ADDR:-redis:6379}"
+health:
+  checks: ["kvs"]
+  timeout: "3s"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+	t.Setenv("COOKIE_SECRET", "cookie-secret-from-env")
+
+	manifest, warnings, err := RenderManifest(configPath, ManifestOptions{Namespace: "auth"})
+	if err != nil {
+		t.Fatalf("RenderManifest() error = %v", err)
+	}
+	docs := decodeManifest(t, manifest)
+	for _, kind := range []string{"ConfigMap", "Secret", "Deployment", "Service"} {
+		if docs[kind] == nil {
+			t.Fatalf("manifest has no %s:\n%s", kind, manifest)
+		}
+		if ns := lookup(t, docs[kind], "metadata", "namespace"); ns != "auth" {
+			t.Errorf("%s namespace = %v, want auth", kind, ns)
+		}
+	}
+
+	if got := lookup(t, docs["ConfigMap"], "data", "config.yaml"); got != content {
+		t.Errorf("ConfigMap config.yaml = %q, want the file as is", got)
+	}
+
+	// Placeholders only: the current values need --from-env
+	secretData := lookup(t, docs["Secret"], "stringData").(map[string]interface{})
+	if len(secretData) != 2 || secretData["COOKIE_SECRET"] != "" || secretData["REDIS_ADDR"] != "" {
+		t.Errorf("Secret stringData = %v, want empty COOKIE_SECRET and REDIS_ADDR", secretData)
+	}
+
+	deployment := docs["Deployment"]
+	if replicas := lookup(t, deployment, "spec", "replicas"); replicas != 2 {
+		t.Errorf("replicas = %v, want 2 with a Redis session KVS", replicas)
+	}
+	container := lookup(t, deployment, "spec", "template", "spec", "containers", 0)
+	if port := lookup(t, container, "ports", 0, "containerPort"); port != 8080 {
+		t.Errorf("containerPort = %v, want 8080", port)
+	}
+	for probe, wantPath := range map[string]string{
+		"startupProbe":   "/auth/health",
+		"readinessProbe": "/auth/health",
+		"livenessProbe":  "/auth/health?probe=live",
+	} {
+		if path := lookup(t, container, probe, "httpGet", "path"); path != wantPath {
+			t.Errorf("%s path = %v, want %s", probe, path, wantPath)
+		}
+	}
+	if timeout := lookup(t, container, "readinessProbe", "timeoutSeconds"); timeout != 4 {
+		t.Errorf("readiness timeoutSeconds = %v, want health.timeout + 1", timeout)
+	}
+	if ref := lookup(t, container, "envFrom", 0, "secretRef", "name"); ref != "chatbotgate-env" {
+		t.Errorf("envFrom secret = %v, want chatbotgate-env", ref)
+	}
+
+	// The Service selects the pods of the Deployment
+	selector := lookup(t, docs["Service"], "spec", "selector").(map[string]interface{})
+	podLabels := lookup(t, deployment, "spec", "template", "metadata", "labels").(map[string]interface{})
+	for key, value := range selector {
+		if podLabels[key] != value {
+			t.Errorf("pod label %s = %v, want %v", key, podLabels[key], value)
+		}
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "password_auth.password") {
+		t.Errorf("warnings = %v, want only the inline password", warnings)
+	}
+
+	manifest, _, err = RenderManifest(configPath, ManifestOptions{FromEnv: true})
+	if err != nil {
+		t.Fatalf("RenderManifest() error = %v", err)
+	}
+	if got := lookup(t, decodeManifest(t, manifest)["Secret"], "stringData", "COOKIE_SECRET"); got != "cookie-secret-from-env" {
+		t.Errorf("COOKIE_SECRET = %v with FromEnv, want the environment value", got)
+	}
+}
+
+func TestRenderManifest_LocalKVS(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `kvs:
+  default:
+    type: "leveldb"
+    leveldb:
+      path: "/var/lib/chatbotgate/kvs"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manifest, warnings, err := RenderManifest(configPath, ManifestOptions{Replicas: 3})
+	if err != nil {
+		t.Fatalf("RenderManifest() error = %v", err)
+	}
+	docs := decodeManifest(t, manifest)
+	if docs["Secret"] != nil {
+		t.Error("manifest should have no Secret without ${VAR} references")
+	}
+	container := lookup(t, docs["Deployment"], "spec", "template", "spec", "containers", 0)
+	if path := lookup(t, container, "readinessProbe", "httpGet", "path"); path != "/_auth/health" {
+		t.Errorf("readiness path = %v, want the default prefix", path)
+	}
+	if mount := lookup(t, container, "volumeMounts", 1, "mountPath"); mount != "/var/lib/chatbotgate/kvs" {
+		t.Errorf("KVS volume mount = %v, want the leveldb path", mount)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "replica") {
+		t.Errorf("warnings = %v, want the per-pod sessions warning", warnings)
+	}
+}
@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
@@ -125,3 +130,137 @@ service:
 		t.Error("Expected error due to incomplete config")
 	}
 }
+
+// TestMiddlewareManagerTenantRouting tests that requests are routed to tenant middleware by hostname
+func TestMiddlewareManagerTenantRouting(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, "tenants.yaml")
+	content := `
+service:
+  name: "Base Service"
+session:
+  cookie:
+    secret: "this-is-a-secret-key-with-32-characters"
+password_auth:
+  enabled: true
+  password: "base-password"
+tenants:
+  - id: "customer-a"
+    hosts: ["chat.customer-a.com"]
+    service:
+      name: "Customer A Chat"
+  - id: "customer-b"
+    hosts: ["chat.customer-b.com", "support.customer-b.com"]
+    service:
+      name: "Customer B Chat"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	logger := logging.NewSimpleLogger("test", logging.LevelError, false)
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	manager, err := NewMiddlewareManager(configPath, "localhost", 4180, nextHandler, logger)
+	if err != nil {
+		t.Fatalf("NewMiddlewareManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		host        string
+		wantService string
+	}{
+		{"base host", "localhost:4180", "Base Service"},
+		{"tenant A", "chat.customer-a.com", "Customer A Chat"},
+		{"tenant B primary host", "chat.customer-b.com", "Customer B Chat"},
+		{"tenant B alias with port", "Support.Customer-B.com:443", "Customer B Chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/_auth/login", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+
+			manager.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantService) {
+				t.Errorf("Login page for host %q does not contain service name %q", tt.host, tt.wantService)
+			}
+		})
+	}
+}
+
+func TestMiddlewareManagerUpstreamCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, "health.yaml")
+	content := `
+service:
+  name: "Base Service"
+session:
+  cookie:
+    secret: "this-is-a-secret-key-with-32-characters"
+password_auth:
+  enabled: true
+  password: "base-password"
+health:
+  checks: ["upstream"]
+tenants:
+  - id: "customer-a"
+    hosts: ["chat.customer-a.com"]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	logger := logging.NewSimpleLogger("test", logging.LevelError, false)
+	manager, err := NewMiddlewareManager(configPath, "localhost", 4180, http.NotFoundHandler(), logger)
+	if err != nil {
+		t.Fatalf("NewMiddlewareManager() error = %v", err)
+	}
+	<-manager.WarmedUp()
+
+	// Only the tenant's upstream is down
+	var probedHosts sync.Map
+	manager.SetUpstreamCheck(func(ctx context.Context, host string) error {
+		probedHosts.Store(host, true)
+		if host == "chat.customer-a.com" {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	for host, wantStatus := range map[string]int{
+		"localhost:4180":      http.StatusOK,
+		"chat.customer-a.com": http.StatusServiceUnavailable,
+	} {
+		req := httptest.NewRequest("GET", "/_auth/health", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		manager.Handler().ServeHTTP(rec, req)
+		if rec.Code != wantStatus {
+			t.Errorf("host %q: status = %d, want %d", host, rec.Code, wantStatus)
+		}
+	}
+	if _, ok := probedHosts.Load(""); !ok {
+		t.Error("the base middleware should probe the base upstream")
+	}
+
+	// The probe survives a reload
+	manager.reload(configPath)
+	req := httptest.NewRequest("GET", "/_auth/health", nil)
+	req.Host = "chat.customer-a.com"
+	rec := httptest.NewRecorder()
+	manager.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("after reload: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -1,16 +1,19 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"sync/atomic"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/core"
 	"github.com/ideamans/chatbotgate/pkg/middleware/factory"
 	"github.com/ideamans/chatbotgate/pkg/shared/filewatcher"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
 )
 
@@ -25,13 +28,24 @@ type MiddlewareManager interface {
 
 // SimpleMiddlewareManager is a simple implementation of MiddlewareManager with hot reload support
 type SimpleMiddlewareManager struct {
-	middleware    atomic.Value // Stores *middleware.Middleware
+	middleware    atomic.Value // Stores *middlewareSet
 	configPath    string
 	defaultConfig *config.Config // Default config to use when file not found
 	host          string
 	port          int
 	next          http.Handler
 	logger        logging.Logger
+	chaos         *kvs.ChaosConfig // Fault injection into the KVS stores (--chaos), nil when off
+
+	// Upstream probe of the readiness check, applied to every build of the middleware
+	upstreamCheck   func(ctx context.Context, host string) error
+	upstreamCheckMu sync.Mutex
+
+	warmedUp chan struct{} // Closed when the initial middleware has warmed up
+
+	// Periodic jobs run on the current middleware set only, and stop when draining
+	jobsMu   sync.Mutex
+	draining bool
 }
 
 // NewMiddlewareManager creates a new SimpleMiddlewareManager from config file
@@ -42,6 +56,11 @@ func NewMiddlewareManager(configPath string, host string, port int, next http.Ha
 // NewMiddlewareManagerWithDefault creates a new SimpleMiddlewareManager from config file
 // with fallback to default config when the file is not found
 func NewMiddlewareManagerWithDefault(configPath string, defaultConfig *config.Config, host string, port int, next http.Handler, logger logging.Logger) (*SimpleMiddlewareManager, error) {
+	return newMiddlewareManager(configPath, defaultConfig, host, port, next, logger, nil)
+}
+
+// newMiddlewareManager creates a new SimpleMiddlewareManager, injecting the faults of chaos into its KVS stores unless nil
+func newMiddlewareManager(configPath string, defaultConfig *config.Config, host string, port int, next http.Handler, logger logging.Logger, chaos *kvs.ChaosConfig) (*SimpleMiddlewareManager, error) {
 	if logger == nil {
 		logger = logging.NewSimpleLogger("middleware-manager", logging.LevelInfo, true)
 	}
@@ -53,19 +72,29 @@ func NewMiddlewareManagerWithDefault(configPath string, defaultConfig *config.Co
 		port:          port,
 		next:          next,
 		logger:        logger,
+		chaos:         chaos,
+		warmedUp:      make(chan struct{}),
 	}
 
 	// Build initial middleware
-	mw, err := m.buildMiddleware(configPath)
+	set, err := m.buildMiddleware(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build initial middleware: %w", err)
 	}
 
 	// Store initial middleware atomically
-	m.middleware.Store(mw)
+	m.middleware.Store(set)
 
-	// Mark middleware as ready to accept traffic
-	mw.SetReady()
+	// Warm up in the background: the readiness check reports "warming" until the middleware is ready,
+	// so load balancers wait instead of routing to a cold instance
+	go func() {
+		set.warmUp(context.Background())
+		close(m.warmedUp)
+		m.startJobs(set)
+
+		// Test provider connectivity once discovery documents are fetched
+		set.CheckProviders()
+	}()
 
 	if defaultConfig != nil && configPath == "" {
 		logger.Info("Middleware manager initialized with default config")
@@ -76,8 +105,8 @@ func NewMiddlewareManagerWithDefault(configPath string, defaultConfig *config.Co
 	return m, nil
 }
 
-// buildMiddleware builds middleware from configuration file
-func (m *SimpleMiddlewareManager) buildMiddleware(configPath string) (*middleware.Middleware, error) {
+// buildMiddleware builds the base middleware and one middleware per tenant from configuration file
+func (m *SimpleMiddlewareManager) buildMiddleware(configPath string) (*middlewareSet, error) {
 	// Load middleware configuration from YAML
 	var cfg *config.Config
 	var err error
@@ -118,7 +147,36 @@ func (m *SimpleMiddlewareManager) buildMiddleware(configPath string) (*middlewar
 
 	// Create factory for building middleware components
 	f := factory.NewDefaultFactory(m.host, m.port, m.logger)
+	f.SetChaos(m.chaos)
+
+	base, err := m.createMiddleware(f, cfg)
+	if err != nil {
+		return nil, err
+	}
 
+	set := &middlewareSet{
+		config:   cfg,
+		fallback: base,
+		byHost:   make(map[string]*middleware.Middleware),
+	}
+
+	// Build isolated middleware for each tenant (own branding, providers, access control and KVS namespaces)
+	for _, tenant := range cfg.Tenants {
+		mw, err := m.createMiddleware(f, cfg.ForTenant(tenant))
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant.ID, err)
+		}
+		for _, host := range tenant.Hosts {
+			set.byHost[config.NormalizeHost(host)] = mw
+		}
+		m.logger.Debug("Tenant middleware initialized", "tenant", tenant.ID, "hosts", tenant.Hosts)
+	}
+
+	return set, nil
+}
+
+// createMiddleware creates a single middleware instance with its own KVS stores
+func (m *SimpleMiddlewareManager) createMiddleware(f factory.Factory, cfg *config.Config) (*middleware.Middleware, error) {
 	// Create KVS stores
 	sessionKVS, tokenKVS, emailQuotaKVS, err := f.CreateKVSStores(cfg)
 	if err != nil {
@@ -159,26 +217,188 @@ func (m *SimpleMiddlewareManager) reload(configPath string) {
 		return
 	}
 
-	// Mark new middleware as ready
-	newMiddleware.SetReady()
+	m.upstreamCheckMu.Lock()
+	if m.upstreamCheck != nil {
+		newMiddleware.addUpstreamCheck(m.upstreamCheck)
+	}
+	m.upstreamCheckMu.Unlock()
+
+	// Warm up the new middleware while the current one keeps serving
+	newMiddleware.warmUp(context.Background())
+	go newMiddleware.CheckProviders()
 
 	// Atomically replace the middleware
-	m.middleware.Store(newMiddleware)
+	oldMiddleware := m.middleware.Swap(newMiddleware).(*middlewareSet)
 	m.logger.Info("Configuration reloaded successfully", "component", "middleware")
+
+	// Hand the jobs over once the running ones of the old middleware have returned
+	go func() {
+		m.jobsMu.Lock()
+		defer m.jobsMu.Unlock()
+		oldMiddleware.StopJobs()
+		oldMiddleware.ClosePlugins()
+		oldMiddleware.StopEventBus()
+		if !m.draining {
+			newMiddleware.StartJobs()
+		}
+	}()
+}
+
+// startJobs starts the periodic jobs of set, unless it was replaced by a reload or the server is draining
+func (m *SimpleMiddlewareManager) startJobs(set *middlewareSet) {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	if !m.draining && m.middleware.Load().(*middlewareSet) == set {
+		set.StartJobs()
+	}
+}
+
+// SetUpstreamCheck sets the upstream probe of the readiness check (health.checks: upstream)
+// Each middleware probes the upstream of its own host, so tenants with their own upstream check it.
+func (m *SimpleMiddlewareManager) SetUpstreamCheck(check func(ctx context.Context, host string) error) {
+	m.upstreamCheckMu.Lock()
+	m.upstreamCheck = check
+	m.upstreamCheckMu.Unlock()
+	m.middleware.Load().(*middlewareSet).addUpstreamCheck(check)
+}
+
+// Config returns the configuration of the current middleware
+func (m *SimpleMiddlewareManager) Config() *config.Config {
+	return m.middleware.Load().(*middlewareSet).config
+}
+
+// WarmedUp returns a channel closed when the initial middleware has warmed up and is ready
+func (m *SimpleMiddlewareManager) WarmedUp() <-chan struct{} {
+	return m.warmedUp
 }
 
 // SetDraining marks the middleware as draining (shutting down gracefully)
+// Periodic jobs stop, handing their leadership over to another instance.
 func (m *SimpleMiddlewareManager) SetDraining() {
-	mw := m.middleware.Load().(*middleware.Middleware)
-	mw.SetDraining()
+	set := m.middleware.Load().(*middlewareSet)
+	set.SetDraining()
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	m.draining = true
+	set.StopJobs()
 }
 
 // Handler returns the HTTP handler
 // The handler always uses the latest middleware stored atomically
 func (m *SimpleMiddlewareManager) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Load the current middleware atomically
-		mw := m.middleware.Load().(*middleware.Middleware)
-		mw.ServeHTTP(w, r)
+		// Load the current middleware atomically and pick the tenant by hostname
+		set := m.middleware.Load().(*middlewareSet)
+		set.lookup(r.Host).ServeHTTP(w, r)
 	})
 }
+
+// middlewareSet holds the base middleware and per-tenant middleware keyed by normalized hostname
+type middlewareSet struct {
+	config   *config.Config // Configuration the set was built from
+	fallback *middleware.Middleware
+	byHost   map[string]*middleware.Middleware
+}
+
+// lookup returns the middleware for the given request host, falling back to the base middleware
+func (s *middlewareSet) lookup(host string) *middleware.Middleware {
+	if mw, ok := s.byHost[config.NormalizeHost(host)]; ok {
+		return mw
+	}
+	return s.fallback
+}
+
+// all returns every distinct middleware in the set
+func (s *middlewareSet) all() []*middleware.Middleware {
+	seen := map[*middleware.Middleware]bool{s.fallback: true}
+	all := []*middleware.Middleware{s.fallback}
+	for _, mw := range s.byHost {
+		if !seen[mw] {
+			seen[mw] = true
+			all = append(all, mw)
+		}
+	}
+	return all
+}
+
+// addUpstreamCheck registers the upstream probe on all middleware in the set, bound to the host each serves
+func (s *middlewareSet) addUpstreamCheck(check func(ctx context.Context, host string) error) {
+	s.fallback.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		return check(ctx, "")
+	})
+	bound := map[*middleware.Middleware]bool{s.fallback: true}
+	for host, mw := range s.byHost {
+		if bound[mw] {
+			continue
+		}
+		bound[mw] = true
+		mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+			return check(ctx, host)
+		})
+	}
+}
+
+// warmUp warms up all middleware in the set concurrently, then marks them ready
+// Middleware that started draining in the meantime stay draining.
+func (s *middlewareSet) warmUp(ctx context.Context) {
+	all := s.all()
+	var wg sync.WaitGroup
+	for _, mw := range all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mw.WarmUp(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, mw := range all {
+		if mw.GetHealthStatus() != middleware.HealthStatusDraining {
+			mw.SetReady()
+		}
+	}
+}
+
+// CheckProviders runs the OAuth2 provider self-test of all middleware in the set
+// Results are logged and served by each middleware's admin API
+func (s *middlewareSet) CheckProviders() {
+	for _, mw := range s.all() {
+		mw.CheckProviders(context.Background())
+	}
+}
+
+// StartJobs starts the periodic jobs of all middleware in the set
+func (s *middlewareSet) StartJobs() {
+	for _, mw := range s.all() {
+		mw.StartJobs()
+	}
+}
+
+// ClosePlugins stops the plugin processes of all middleware in the set
+func (s *middlewareSet) ClosePlugins() {
+	for _, mw := range s.all() {
+		mw.ClosePlugins()
+	}
+}
+
+// StopEventBus unsubscribes all middleware in the set from the event bus
+func (s *middlewareSet) StopEventBus() {
+	for _, mw := range s.all() {
+		mw.StopEventBus()
+	}
+}
+
+// StopJobs stops the periodic jobs of all middleware in the set
+func (s *middlewareSet) StopJobs() {
+	for _, mw := range s.all() {
+		mw.StopJobs()
+	}
+}
+
+// SetDraining marks all middleware in the set as draining
+func (s *middlewareSet) SetDraining() {
+	for _, mw := range s.all() {
+		mw.SetDraining()
+	}
+}
@@ -98,6 +98,115 @@ func TestValidateProxyConfig(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "Invalid TLS minimum version",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "https://backend.internal",
+					},
+					TLS: &proxy.TLSConfig{MinVersion: "1.0"},
+				},
+			},
+			expectError: true,
+			checkError:  "proxy.tls: min_version",
+		},
+		{
+			name: "Invalid transport timeout",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+					Transport: &proxy.TransportConfig{IdleConnTimeout: "forever"},
+				},
+			},
+			expectError: true,
+			checkError:  "proxy.transport: invalid idle_conn_timeout",
+		},
+		{
+			name: "Invalid override host",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+					HostConfig: proxy.HostConfig{OverrideHost: "https://app.dify.ai/"},
+				},
+			},
+			expectError: true,
+			checkError:  "proxy: override_host must be a host name",
+		},
+		{
+			name: "Tenant upstream negative connection limit",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+				},
+				Tenants: []ProxyTenantConfig{{
+					ID: "customer-a",
+					Upstream: &proxy.UpstreamConfig{
+						URL:       "http://customer-a.internal",
+						Transport: &proxy.TransportConfig{MaxConnsPerHost: -1},
+					},
+				}},
+			},
+			expectError: true,
+			checkError:  "tenants[0].upstream.transport: transport settings must not be negative",
+		},
+		{
+			name: "Tenant upstream TLS certificate without key",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+				},
+				Tenants: []ProxyTenantConfig{{
+					ID: "customer-a",
+					Upstream: &proxy.UpstreamConfig{
+						URL: "https://customer-a.internal",
+						TLS: &proxy.TLSConfig{CertFile: "client.crt"},
+					},
+				}},
+			},
+			expectError: true,
+			checkError:  "tenants[0].upstream.tls: cert_file and key_file",
+		},
+		{
+			name: "Invalid request header pattern",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+					HeaderFilterConfig: proxy.HeaderFilterConfig{AllowedRequestHeaders: []string{"*"}},
+				},
+			},
+			expectError: true,
+			checkError:  "proxy: allowed_request_headers and blocked_request_headers must be header names",
+		},
+		{
+			name: "Tenant upstream mirror without percent",
+			cfg: &ProxyConfig{
+				Proxy: ProxyServerConfig{
+					Upstream: proxy.UpstreamConfig{
+						URL: "http://localhost:8080",
+					},
+				},
+				Tenants: []ProxyTenantConfig{{
+					ID: "customer-a",
+					Upstream: &proxy.UpstreamConfig{
+						URL:    "http://customer-a.internal",
+						Mirror: &proxy.MirrorConfig{URL: "http://customer-a-next.internal"},
+					},
+				}},
+			},
+			expectError: true,
+			checkError:  "tenants[0].upstream: mirror.percent must be greater than 0",
+		},
 		{
 			name: "Secret value without header (valid)",
 			cfg: &ProxyConfig{
@@ -450,6 +559,151 @@ proxy:
 	}
 }
 
+// TestProxyManagerTenantUpstreams tests that tenant hostnames are proxied to their own upstream
+func TestProxyManagerTenantUpstreams(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newUpstream := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+	baseServer := newUpstream("base")
+	defer baseServer.Close()
+	tenantServer := newUpstream("tenant-a")
+	defer tenantServer.Close()
+
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `
+proxy:
+  upstream:
+    url: "` + baseServer.URL + `"
+tenants:
+  - id: "a"
+    hosts: ["chat.customer-a.com"]
+    upstream:
+      url: "` + tenantServer.URL + `"
+  - id: "b"
+    hosts: ["chat.customer-b.com"]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	logger := logging.NewSimpleLogger("test", logging.LevelError, false)
+	manager, err := NewProxyManager(configPath, logger)
+	if err != nil {
+		t.Fatalf("Failed to create proxy manager: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"localhost", "base"},
+		{"chat.customer-a.com", "tenant-a"},
+		{"chat.customer-a.com:443", "tenant-a"},
+		{"chat.customer-b.com", "base"}, // No tenant upstream, falls back to proxy.upstream
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			manager.Handler().ServeHTTP(w, req)
+
+			if body := w.Body.String(); body != tt.want {
+				t.Errorf("Host %q proxied to %q, want %q", tt.host, body, tt.want)
+			}
+		})
+	}
+}
+
+// TestProxyManagerHostSettings tests the proxy host settings and their replacement by a tenant upstream
+func TestProxyManagerHostSettings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer upstream.Close()
+
+	configPath := filepath.Join(t.TempDir(), "test.yaml")
+	content := `
+proxy:
+  override_host: "app.dify.ai"
+  upstream:
+    url: "` + upstream.URL + `"
+tenants:
+  - id: "a"
+    hosts: ["chat.customer-a.com"]
+    upstream:
+      url: "` + upstream.URL + `"
+      preserve_host: true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manager, err := NewProxyManager(configPath, logging.NewSimpleLogger("test", logging.LevelError, false))
+	if err != nil {
+		t.Fatalf("Failed to create proxy manager: %v", err)
+	}
+
+	for host, want := range map[string]string{
+		"localhost":           "app.dify.ai",
+		"chat.customer-a.com": "chat.customer-a.com",
+	} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		manager.Handler().ServeHTTP(w, req)
+		if got := w.Body.String(); got != want {
+			t.Errorf("Host %q reached the upstream as %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestProxyManagerCanaryCookie(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	t.Setenv("TEST_COOKIE_SECURE", "true")
+
+	configPath := filepath.Join(t.TempDir(), "test.yaml")
+	content := `
+server:
+  mount_path: "/bot/"
+session:
+  cookie:
+    domain: ".example.com"
+    secure: ${TEST_COOKIE_SECURE}
+proxy:
+  upstream:
+    url: "` + upstream.URL + `"
+    canary:
+      url: "` + upstream.URL + `"
+      weight: 10
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manager, err := NewProxyManager(configPath, logging.NewSimpleLogger("test", logging.LevelError, false))
+	if err != nil {
+		t.Fatalf("Failed to create proxy manager: %v", err)
+	}
+
+	// The bucket cookie follows the session cookie, not the client's X-Forwarded-Proto
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	manager.Handler().ServeHTTP(w, req)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/bot" || cookies[0].Domain != "example.com" || !cookies[0].Secure {
+		t.Errorf("canary cookies = %+v, want path /bot, domain example.com and Secure", cookies)
+	}
+}
+
 // TestProxyManagerOnFileChange tests the OnFileChange method
 func TestProxyManagerOnFileChange(t *testing.T) {
 	tmpDir := t.TempDir()
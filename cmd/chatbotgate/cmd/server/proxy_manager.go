@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/proxy/core"
+	sharedconfig "github.com/ideamans/chatbotgate/pkg/shared/config"
 	"github.com/ideamans/chatbotgate/pkg/shared/filewatcher"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
 	"gopkg.in/yaml.v3"
@@ -26,17 +28,73 @@ type ProxyManager interface {
 
 // ProxyConfig represents the proxy configuration section in the config file
 type ProxyConfig struct {
-	Proxy ProxyServerConfig `yaml:"proxy" json:"proxy"`
+	Proxy   ProxyServerConfig   `yaml:"proxy" json:"proxy"`
+	Tenants []ProxyTenantConfig `yaml:"tenants" json:"tenants"` // Per-tenant upstreams (other tenant fields are read by the middleware)
+
+	canaryCookie proxy.CanaryCookieConfig // Attributes of the canary bucket cookie, from the middleware settings
+}
+
+// canaryCookieSettings is the part of the middleware settings the canary bucket cookie follows:
+// server.mount_path and the domain and Secure attribute of the session cookie
+type canaryCookieSettings struct {
+	Server struct {
+		MountPath string `yaml:"mount_path" json:"mount_path"`
+	} `yaml:"server" json:"server"`
+	Session struct {
+		Cookie struct {
+			Domain string `yaml:"domain" json:"domain"`
+			Secure bool   `yaml:"secure" json:"secure"`
+		} `yaml:"cookie" json:"cookie"`
+	} `yaml:"session" json:"session"`
+}
+
+// ProxyTenantConfig represents the proxy settings of a tenant entry
+type ProxyTenantConfig struct {
+	ID       string                `yaml:"id" json:"id"`
+	Hosts    []string              `yaml:"hosts" json:"hosts"`
+	Upstream *proxy.UpstreamConfig `yaml:"upstream" json:"upstream"` // Optional: Uses proxy.upstream when not set
 }
 
 // ProxyServerConfig represents proxy server settings
 type ProxyServerConfig struct {
-	Upstream proxy.UpstreamConfig `yaml:"upstream" json:"upstream"`
+	Upstream  proxy.UpstreamConfig   `yaml:"upstream" json:"upstream"`
+	TLS       *proxy.TLSConfig       `yaml:"tls" json:"tls"`             // Optional: TLS settings of every upstream without its own upstream.tls
+	Transport *proxy.TransportConfig `yaml:"transport" json:"transport"` // Optional: Connection pool settings of every upstream without its own upstream.transport
+	Cookies   *proxy.CookieConfig    `yaml:"cookies" json:"cookies"`     // Optional: Cookie isolation of every upstream without its own upstream.cookies
+
+	// Optional: Host header and response rewriting of every upstream without its own settings
+	// (preserve_host, override_host, rewrite_location, rewrite_cookie_domain)
+	proxy.HostConfig `yaml:",inline"`
+
+	// Optional: Request header filtering of every upstream without its own settings
+	// (allowed_request_headers, blocked_request_headers)
+	proxy.HeaderFilterConfig `yaml:",inline"`
+}
+
+// upstreamWithDefaults returns the upstream with proxy.tls, proxy.transport, proxy.cookies and the proxy
+// host settings applied unless it has its own settings
+func (c ProxyServerConfig) upstreamWithDefaults(upstream proxy.UpstreamConfig) proxy.UpstreamConfig {
+	if upstream.TLS == nil {
+		upstream.TLS = c.TLS
+	}
+	if upstream.Transport == nil {
+		upstream.Transport = c.Transport
+	}
+	if upstream.Cookies == nil {
+		upstream.Cookies = c.Cookies
+	}
+	if upstream.HostConfig.IsZero() {
+		upstream.HostConfig = c.HostConfig
+	}
+	if upstream.HeaderFilterConfig.IsZero() {
+		upstream.HeaderFilterConfig = c.HeaderFilterConfig
+	}
+	return upstream
 }
 
 // SimpleProxyManager is a simple implementation of ProxyManager with hot reload support
 type SimpleProxyManager struct {
-	handler       atomic.Value // Stores *proxy.Handler
+	handler       atomic.Value // Stores *proxyHandlerSet
 	configPath    string
 	defaultConfig *proxy.UpstreamConfig // Default config to use when file not found
 	logger        logging.Logger
@@ -78,62 +136,118 @@ func NewProxyManagerWithDefault(configPath string, defaultConfig *proxy.Upstream
 	return m, nil
 }
 
-// buildProxyHandler builds proxy handler from configuration file
-func (m *SimpleProxyManager) buildProxyHandler(configPath string) (*proxy.Handler, error) {
+// buildProxyHandler builds the base proxy handler and one handler per tenant upstream from configuration file
+func (m *SimpleProxyManager) buildProxyHandler(configPath string) (*proxyHandlerSet, error) {
 	// Load proxy configuration from YAML
-	upstreamCfg, err := loadProxyConfig(configPath)
+	cfg, err := readProxyConfig(configPath)
 	if err != nil {
 		// If config file not found and we have default config, use it
 		if errors.Is(err, os.ErrNotExist) && m.defaultConfig != nil {
-			upstreamCfg = *m.defaultConfig
-			m.logger.Debug("Using default proxy configuration", "upstream", upstreamCfg.URL)
+			cfg = &ProxyConfig{Proxy: ProxyServerConfig{Upstream: *m.defaultConfig}}
+			m.logger.Debug("Using default proxy configuration", "upstream", cfg.Proxy.Upstream.URL)
 		} else {
 			return nil, fmt.Errorf("failed to load proxy config: %w", err)
 		}
 	} else {
-		m.logger.Debug("Proxy configuration loaded and validated", "config_path", configPath, "upstream", upstreamCfg.URL)
+		m.logger.Debug("Proxy configuration loaded and validated", "config_path", configPath, "upstream", cfg.Proxy.Upstream.URL)
 	}
 
 	// Create proxy handler
-	handler, err := proxy.NewHandlerWithConfig(upstreamCfg)
+	handler, err := proxy.NewHandlerWithConfig(cfg.Proxy.upstreamWithDefaults(cfg.Proxy.Upstream))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create proxy handler: %w", err)
 	}
+	handler.SetCanaryCookie(cfg.canaryCookie)
+
+	set := &proxyHandlerSet{
+		config:   cfg,
+		fallback: handler,
+		byHost:   make(map[string]*proxy.Handler),
+	}
+
+	// Create proxy handlers for tenants with their own upstream
+	for _, tenant := range cfg.Tenants {
+		if tenant.Upstream == nil {
+			continue
+		}
+		tenantHandler, err := proxy.NewHandlerWithConfig(cfg.Proxy.upstreamWithDefaults(*tenant.Upstream))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create proxy handler for tenant %s: %w", tenant.ID, err)
+		}
+		tenantHandler.SetCanaryCookie(cfg.canaryCookie)
+		for _, host := range tenant.Hosts {
+			set.byHost[config.NormalizeHost(host)] = tenantHandler
+		}
+		if tlsCfg := cfg.Proxy.upstreamWithDefaults(*tenant.Upstream).TLS; tlsCfg != nil && tlsCfg.InsecureSkipVerify {
+			m.logger.Warn("TLS certificate verification is disabled for the upstream", "tenant", tenant.ID, "upstream", tenant.Upstream.URL)
+		}
+		m.logger.Debug("Tenant proxy handler initialized", "tenant", tenant.ID, "upstream", tenant.Upstream.URL)
+	}
 
+	if tlsCfg := cfg.Proxy.upstreamWithDefaults(cfg.Proxy.Upstream).TLS; tlsCfg != nil && tlsCfg.InsecureSkipVerify {
+		m.logger.Warn("TLS certificate verification is disabled for the upstream", "upstream", cfg.Proxy.Upstream.URL)
+	}
 	m.logger.Debug("Proxy handler initialized")
 
-	return handler, nil
+	return set, nil
 }
 
 // loadProxyConfig loads and validates proxy configuration from a YAML or JSON file
 func loadProxyConfig(path string) (proxy.UpstreamConfig, error) {
+	cfg, err := readProxyConfig(path)
+	if err != nil {
+		return proxy.UpstreamConfig{}, err
+	}
+	return cfg.Proxy.Upstream, nil
+}
+
+// readProxyConfig reads and validates the full proxy configuration (including tenants) from a YAML or JSON file
+func readProxyConfig(path string) (*ProxyConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return proxy.UpstreamConfig{}, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	var cfg ProxyConfig
 	ext := strings.ToLower(filepath.Ext(path))
+	if err := unmarshalConfigFile(ext, data, &cfg); err != nil {
+		return nil, err
+	}
+
+	// Read like the middleware reads them, with environment variables expanded
+	var cookie canaryCookieSettings
+	if err := unmarshalConfigFile(ext, sharedconfig.ExpandEnvBytes(data), &cookie); err != nil {
+		return nil, err
+	}
+	cfg.canaryCookie = proxy.CanaryCookieConfig{
+		Path:   config.ServerConfig{MountPath: cookie.Server.MountPath}.GetCookiePath(),
+		Domain: cookie.Session.Cookie.Domain,
+		Secure: cookie.Session.Cookie.Secure,
+	}
+
+	// Validate proxy configuration
+	if err := validateProxyConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("proxy config validation failed: %w", err)
+	}
 
+	return &cfg, nil
+}
+
+// unmarshalConfigFile decodes a configuration file of extension ext (.yaml, .yml or .json) into v
+func unmarshalConfigFile(ext string, data []byte, v interface{}) error {
 	switch ext {
 	case ".json":
-		if err := json.Unmarshal(data, &cfg); err != nil {
-			return proxy.UpstreamConfig{}, fmt.Errorf("failed to parse JSON config file: %w", err)
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("failed to parse JSON config file: %w", err)
 		}
 	case ".yaml", ".yml":
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return proxy.UpstreamConfig{}, fmt.Errorf("failed to parse YAML config file: %w", err)
+		if err := yaml.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("failed to parse YAML config file: %w", err)
 		}
 	default:
-		return proxy.UpstreamConfig{}, fmt.Errorf("unsupported config file format: %s (supported: .yaml, .yml, .json)", ext)
-	}
-
-	// Validate proxy configuration
-	if err := validateProxyConfig(&cfg); err != nil {
-		return proxy.UpstreamConfig{}, fmt.Errorf("proxy config validation failed: %w", err)
+		return fmt.Errorf("unsupported config file format: %s (supported: .yaml, .yml, .json)", ext)
 	}
-
-	return cfg.Proxy.Upstream, nil
+	return nil
 }
 
 // validateProxyConfig validates the proxy configuration
@@ -156,9 +270,135 @@ func validateProxyConfig(cfg *ProxyConfig) error {
 		verr.Add(fmt.Errorf("proxy.upstream.secret.value is required when header is specified"))
 	}
 
+	// Validate TLS settings (if specified); files are loaded so that missing certificates fail the reload
+	if cfg.Proxy.TLS != nil {
+		if _, err := proxy.NewTLSConfig(*cfg.Proxy.TLS); err != nil {
+			verr.Add(fmt.Errorf("proxy.tls: %w", err))
+		}
+	}
+	if cfg.Proxy.Upstream.TLS != nil {
+		if _, err := proxy.NewTLSConfig(*cfg.Proxy.Upstream.TLS); err != nil {
+			verr.Add(fmt.Errorf("proxy.upstream.tls: %w", err))
+		}
+	}
+	if cfg.Proxy.Transport != nil {
+		if err := cfg.Proxy.Transport.Validate(); err != nil {
+			verr.Add(fmt.Errorf("proxy.transport: %w", err))
+		}
+	}
+	if cfg.Proxy.Upstream.Transport != nil {
+		if err := cfg.Proxy.Upstream.Transport.Validate(); err != nil {
+			verr.Add(fmt.Errorf("proxy.upstream.transport: %w", err))
+		}
+	}
+	if cfg.Proxy.Cookies != nil {
+		if err := cfg.Proxy.Cookies.Validate(); err != nil {
+			verr.Add(fmt.Errorf("proxy.cookies: %w", err))
+		}
+	}
+	if cfg.Proxy.Upstream.Cookies != nil {
+		if err := cfg.Proxy.Upstream.Cookies.Validate(); err != nil {
+			verr.Add(fmt.Errorf("proxy.upstream.cookies: %w", err))
+		}
+	}
+	if err := cfg.Proxy.HostConfig.Validate(); err != nil {
+		verr.Add(fmt.Errorf("proxy: %w", err))
+	}
+	if err := cfg.Proxy.Upstream.HostConfig.Validate(); err != nil {
+		verr.Add(fmt.Errorf("proxy.upstream: %w", err))
+	}
+	if err := cfg.Proxy.HeaderFilterConfig.Validate(); err != nil {
+		verr.Add(fmt.Errorf("proxy: %w", err))
+	}
+	if err := cfg.Proxy.Upstream.HeaderFilterConfig.Validate(); err != nil {
+		verr.Add(fmt.Errorf("proxy.upstream: %w", err))
+	}
+	if cfg.Proxy.Upstream.Mirror != nil {
+		if err := validateMirror(*cfg.Proxy.Upstream.Mirror); err != nil {
+			verr.Add(fmt.Errorf("proxy.upstream: %w", err))
+		}
+	}
+	if cfg.Proxy.Upstream.Canary != nil {
+		if err := validateCanary(*cfg.Proxy.Upstream.Canary); err != nil {
+			verr.Add(fmt.Errorf("proxy.upstream: %w", err))
+		}
+	}
+
+	// Validate tenant upstreams (if specified)
+	for i, tenant := range cfg.Tenants {
+		if tenant.Upstream == nil {
+			continue
+		}
+		if tenant.Upstream.URL == "" {
+			verr.Add(fmt.Errorf("tenants[%d].upstream.url is required", i))
+		} else if _, err := url.Parse(tenant.Upstream.URL); err != nil {
+			verr.Add(fmt.Errorf("tenants[%d].upstream.url is not a valid URL: %w", i, err))
+		}
+		if tenant.Upstream.Secret.Header != "" && tenant.Upstream.Secret.Value == "" {
+			verr.Add(fmt.Errorf("tenants[%d].upstream.secret.value is required when header is specified", i))
+		}
+		if tenant.Upstream.TLS != nil {
+			if _, err := proxy.NewTLSConfig(*tenant.Upstream.TLS); err != nil {
+				verr.Add(fmt.Errorf("tenants[%d].upstream.tls: %w", i, err))
+			}
+		}
+		if tenant.Upstream.Transport != nil {
+			if err := tenant.Upstream.Transport.Validate(); err != nil {
+				verr.Add(fmt.Errorf("tenants[%d].upstream.transport: %w", i, err))
+			}
+		}
+		if tenant.Upstream.Cookies != nil {
+			if err := tenant.Upstream.Cookies.Validate(); err != nil {
+				verr.Add(fmt.Errorf("tenants[%d].upstream.cookies: %w", i, err))
+			}
+		}
+		if err := tenant.Upstream.HostConfig.Validate(); err != nil {
+			verr.Add(fmt.Errorf("tenants[%d].upstream: %w", i, err))
+		}
+		if err := tenant.Upstream.HeaderFilterConfig.Validate(); err != nil {
+			verr.Add(fmt.Errorf("tenants[%d].upstream: %w", i, err))
+		}
+		if tenant.Upstream.Mirror != nil {
+			if err := validateMirror(*tenant.Upstream.Mirror); err != nil {
+				verr.Add(fmt.Errorf("tenants[%d].upstream: %w", i, err))
+			}
+		}
+		if tenant.Upstream.Canary != nil {
+			if err := validateCanary(*tenant.Upstream.Canary); err != nil {
+				verr.Add(fmt.Errorf("tenants[%d].upstream: %w", i, err))
+			}
+		}
+	}
+
 	return verr.ErrorOrNil()
 }
 
+// validateMirror validates the mirror settings of an upstream, loading its TLS files
+func validateMirror(mirror proxy.MirrorConfig) error {
+	if err := mirror.Validate(); err != nil {
+		return err
+	}
+	if mirror.TLS != nil {
+		if _, err := proxy.NewTLSConfig(*mirror.TLS); err != nil {
+			return fmt.Errorf("mirror.tls: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateCanary validates the canary settings of an upstream, loading its TLS files
+func validateCanary(canary proxy.CanaryConfig) error {
+	if err := canary.Validate(); err != nil {
+		return err
+	}
+	if canary.TLS != nil {
+		if _, err := proxy.NewTLSConfig(*canary.TLS); err != nil {
+			return fmt.Errorf("canary.tls: %w", err)
+		}
+	}
+	return nil
+}
+
 // OnFileChange implements filewatcher.ChangeListener interface
 // This method is called when the configuration file changes
 func (m *SimpleProxyManager) OnFileChange(event filewatcher.ChangeEvent) {
@@ -190,8 +430,35 @@ func (m *SimpleProxyManager) reload(configPath string) {
 // The handler always uses the latest proxy handler stored atomically
 func (m *SimpleProxyManager) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Load the current handler atomically
-		h := m.handler.Load().(*proxy.Handler)
-		h.ServeHTTP(w, r)
+		// Load the current handler atomically and pick the tenant upstream by hostname
+		set := m.handler.Load().(*proxyHandlerSet)
+		set.lookup(r.Host).ServeHTTP(w, r)
 	})
 }
+
+// Config returns the configuration of the current proxy handlers
+func (m *SimpleProxyManager) Config() *ProxyConfig {
+	return m.handler.Load().(*proxyHandlerSet).config
+}
+
+// CheckUpstream probes the upstream that serves requests for host (the base upstream for "")
+// It is the upstream probe of the middleware readiness check.
+func (m *SimpleProxyManager) CheckUpstream(ctx context.Context, host string) error {
+	set := m.handler.Load().(*proxyHandlerSet)
+	return set.lookup(host).CheckUpstream(ctx)
+}
+
+// proxyHandlerSet holds the base proxy handler and per-tenant handlers keyed by normalized hostname
+type proxyHandlerSet struct {
+	config   *ProxyConfig // Configuration the set was built from
+	fallback *proxy.Handler
+	byHost   map[string]*proxy.Handler
+}
+
+// lookup returns the proxy handler for the given request host, falling back to the base upstream
+func (s *proxyHandlerSet) lookup(host string) *proxy.Handler {
+	if h, ok := s.byHost[config.NormalizeHost(host)]; ok {
+		return h
+	}
+	return s.fallback
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
 	"github.com/ideamans/chatbotgate/pkg/shared/filewatcher"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
 	"gopkg.in/yaml.v3"
 )
@@ -29,6 +30,25 @@ type Config struct {
 	PortSet    bool   // Whether port was explicitly set via flag
 	Logger     logging.Logger
 	Version    string
+	Chaos      string // Fault injection into the KVS stores (--chaos, development only; see kvs.ParseChaos)
+}
+
+// Limits of the HTTP listener against request headers sent slowly (slowloris) or oversized, which are
+// answered with an error instead of holding connections and memory. 64 KiB leaves room for the cookies
+// of upstreams, well below the 1 MiB default of net/http.
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverMaxHeaderBytes    = 64 << 10
+)
+
+// newHTTPServer creates the HTTP server of the gate
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		MaxHeaderBytes:    serverMaxHeaderBytes,
+	}
 }
 
 // ServerConfigWrapper represents the server configuration section in the config file
@@ -108,12 +128,25 @@ func Run(ctx context.Context, cfg Config) error {
 
 	logger.Info("Proxy manager initialized successfully")
 
+	// Parse the KVS fault injection of the --chaos flag
+	var chaos *kvs.ChaosConfig
+	if cfg.Chaos != "" {
+		parsed, err := kvs.ParseChaos(cfg.Chaos)
+		if err != nil {
+			return err
+		}
+		chaos = &parsed
+		logger.Warn("KVS fault injection enabled (for development only)", "chaos", cfg.Chaos)
+	}
+
 	// Create middleware manager from config file (with proxy as next handler and default config fallback)
-	middlewareManager, err := NewMiddlewareManagerWithDefault(configPath, defaultMiddlewareConfig, resolved.Host, resolved.Port, proxyManager.Handler(), logger)
+	middlewareManager, err := newMiddlewareManager(configPath, defaultMiddlewareConfig, resolved.Host, resolved.Port, proxyManager.Handler(), logger, chaos)
 	if err != nil {
 		return formatConfigError("middleware", err)
 	}
 
+	middlewareManager.SetUpstreamCheck(proxyManager.CheckUpstream)
+
 	logger.Info("Middleware manager initialized successfully")
 
 	// Create file watcher for hot reload (100ms debounce) only if config file exists
@@ -154,11 +187,9 @@ func Run(ctx context.Context, cfg Config) error {
 	}
 
 	// Create and start HTTP server
-	server := &http.Server{
-		Addr:    addr,
-		Handler: middlewareManager.Handler(),
-	}
+	server := newHTTPServer(addr, middlewareManager.Handler())
 
+	logger.Info("Startup summary", startupSummary(cfg.Version, addr, middlewareManager.Config(), proxyManager.Config(), resolved.Host, resolved.Port)...)
 	logger.Info("Starting server", "addr", addr)
 
 	// Run server in goroutine
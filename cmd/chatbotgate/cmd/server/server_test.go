@@ -1,8 +1,11 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
@@ -336,3 +339,33 @@ server:
 		})
 	}
 }
+
+func TestNewHTTPServer_MaxHeaderBytes(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Start()
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		size       int
+		wantStatus int
+	}{
+		{"within the limit", 16 << 10, http.StatusOK},
+		{"oversized", 2 * serverMaxHeaderBytes, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+			req.Header.Set("X-Large", strings.Repeat("a", tt.size))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// startupSummary returns the key-value pairs of the startup summary log: one line describing the
+// deployment, so that operators can verify it at a glance and compare it across environments
+// Values are the effective ones (defaults applied) and never contain secrets.
+func startupSummary(version, addr string, cfg *config.Config, proxyCfg *ProxyConfig, host string, port int) []interface{} {
+	callback := cfg.Server.GetCallbackURL(host, port)
+	baseURL := strings.TrimSuffix(callback, cfg.Server.GetPublicAuthPathPrefix()+"/oauth2/callback")
+	public := "http"
+	if strings.HasPrefix(baseURL, "https://") {
+		public = "https"
+	}
+
+	namespaces := cfg.KVS.Namespaces
+	namespaces.SetDefaults()
+
+	summary := []interface{}{
+		"version", version,
+		"listen", addr,
+		"base_url", baseURL,
+		"auth_methods", summaryAuthMethods(cfg),
+		"providers", summaryProviders(cfg),
+		"tenants", len(cfg.Tenants),
+		// "_store" keeps the keys clear of the log scrubbing of "*_token" fields
+		"kvs_session_store", summaryKVS(cfg.KVS.Default, cfg.KVS.Session, namespaces.Session),
+		"kvs_token_store", summaryKVS(cfg.KVS.Default, cfg.KVS.Token, namespaces.Token),
+		"kvs_email_quota_store", summaryKVS(cfg.KVS.Default, cfg.KVS.EmailQuota, namespaces.EmailQuota),
+		"forwarding_fields", len(cfg.Forwarding.EffectiveFields()),
+		"tls_listener", "off", // The server listens on plain HTTP: TLS is terminated in front of it
+		"tls_public", public,
+	}
+	if proxyCfg != nil {
+		upstreams, modes := summaryUpstreams(proxyCfg)
+		summary = append(summary, "upstreams", upstreams, "tls_upstream", modes)
+	}
+	return summary
+}
+
+// summaryAuthMethods returns the enabled authentication methods
+func summaryAuthMethods(cfg *config.Config) []string {
+	methods := []string{}
+	for _, p := range cfg.OAuth2.Providers {
+		if !p.Disabled {
+			methods = append(methods, "oauth2")
+			break
+		}
+	}
+	if cfg.EmailAuth.Enabled {
+		methods = append(methods, "email")
+	}
+	if cfg.PasswordAuth.Enabled {
+		methods = append(methods, "password")
+	}
+	if cfg.Guest.Enabled {
+		methods = append(methods, "guest")
+	}
+	if len(cfg.ServiceTokens) > 0 {
+		methods = append(methods, "service_tokens")
+	}
+	if cfg.IDP.Enabled {
+		methods = append(methods, "idp")
+	}
+	return methods
+}
+
+// summaryProviders returns the IDs of the enabled OAuth2 providers, tenant providers as "<tenant>/<id>"
+func summaryProviders(cfg *config.Config) []string {
+	providers := []string{}
+	for _, p := range cfg.OAuth2.Providers {
+		if !p.Disabled {
+			providers = append(providers, p.ID)
+		}
+	}
+	for _, tenant := range cfg.Tenants {
+		if tenant.OAuth2 == nil {
+			continue
+		}
+		for _, p := range tenant.OAuth2.Providers {
+			if !p.Disabled {
+				providers = append(providers, tenant.ID+"/"+p.ID)
+			}
+		}
+	}
+	return providers
+}
+
+// summaryKVS describes the store of a use case: "<type>[(<location>)]/<namespace>"
+// (e.g., "redis(redis:6379)/session"), as the factory creates it
+func summaryKVS(defaultCfg kvs.Config, override *kvs.Config, namespace string) string {
+	cfg := defaultCfg
+	if override != nil {
+		cfg = *override
+		namespace = override.Namespace
+	}
+	kind := cfg.Type
+	switch kind {
+	case "redis":
+		kind += "(" + cfg.Redis.Addr + ")"
+	case "leveldb":
+		if cfg.LevelDB.Path != "" {
+			kind += "(" + cfg.LevelDB.Path + ")"
+		}
+	case "":
+		kind = "memory"
+	}
+	if cfg.Fallback != nil {
+		fallback := cfg.Fallback.Type
+		if fallback == "" {
+			fallback = "memory"
+		}
+		kind += "+fallback:" + fallback
+	}
+	return kind + "/" + namespace
+}
+
+// summaryUpstreams returns the upstream URLs (tenant upstreams as "<tenant>=<url>") and their TLS modes
+func summaryUpstreams(proxyCfg *ProxyConfig) ([]string, []string) {
+	base := proxyCfg.Proxy.upstreamWithDefaults(proxyCfg.Proxy.Upstream)
+	upstreams := []string{redactedUpstreamURL(base.URL)}
+	modes := []string{upstreamTLSMode(base)}
+	for _, tenant := range proxyCfg.Tenants {
+		if tenant.Upstream == nil {
+			continue
+		}
+		upstream := proxyCfg.Proxy.upstreamWithDefaults(*tenant.Upstream)
+		upstreams = append(upstreams, tenant.ID+"="+redactedUpstreamURL(upstream.URL))
+		modes = append(modes, tenant.ID+"="+upstreamTLSMode(upstream))
+	}
+	return upstreams, modes
+}
+
+// upstreamTLSMode describes how connections to an upstream are secured:
+// "off" (http), "verify" (system roots), "custom_ca", "mtls" or "insecure"
+func upstreamTLSMode(upstream proxy.UpstreamConfig) string {
+	if !strings.HasPrefix(upstream.URL, "https://") {
+		return "off"
+	}
+	tlsCfg := upstream.TLS
+	switch {
+	case tlsCfg == nil:
+		return "verify"
+	case tlsCfg.InsecureSkipVerify:
+		return "insecure"
+	case tlsCfg.CertFile != "":
+		return "mtls"
+	case tlsCfg.CAFile != "":
+		return "custom_ca"
+	default:
+		return "verify"
+	}
+}
+
+// redactedUpstreamURL returns the upstream URL with the password of its credentials redacted
+func redactedUpstreamURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid)"
+	}
+	return u.Redacted()
+}
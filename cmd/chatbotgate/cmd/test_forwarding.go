@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/spf13/cobra"
+)
+
+// forwardingUserFile is the sample user info file of test-forwarding ("-" for stdin)
+var forwardingUserFile string
+
+// testForwardingCmd represents the test-forwarding command
+var testForwardingCmd = &cobra.Command{
+	Use:   "test-forwarding",
+	Short: "Show what user info forwarding produces for a sample user",
+	Long: `Resolve the forwarding fields of the configuration file for a sample user
+without starting the server.
+
+The sample user is a JSON object like the "." forwarding path produces:
+
+  {"username": "Alice", "email": "alice@example.com", "provider": "google",
+   "extra": {"_email": "alice@example.com", "locale": "ja"}}
+
+The command prints the headers, query parameters and body fields that would be
+forwarded (with filters applied), and for each field which destinations it set,
+which were already set by an earlier field, or why it yields no value.`,
+	RunE: runTestForwarding,
+}
+
+func init() {
+	testForwardingCmd.Flags().StringVarP(&forwardingUserFile, "user", "u", "-", `Sample user info JSON file ("-" for stdin)`)
+	rootCmd.AddCommand(testForwardingCmd)
+}
+
+func runTestForwarding(cmd *cobra.Command, args []string) error {
+	cfg, err := config.NewFileLoader(cfgFile).Load()
+	if err != nil {
+		return fmt.Errorf("failed to load middleware configuration: %w", err)
+	}
+
+	var data []byte
+	if forwardingUserFile == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(forwardingUserFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sample user info: %w", err)
+	}
+	var userInfo forwarding.UserInfo
+	if err := json.Unmarshal(data, &userInfo); err != nil {
+		return fmt.Errorf("failed to parse sample user info: %w", err)
+	}
+
+	if len(cfg.Forwarding.EffectiveFields()) == 0 {
+		return fmt.Errorf("no forwarding fields are configured")
+	}
+	forwarder, err := forwarding.NewForwarder(&cfg.Forwarding, cfg.OAuth2.Providers)
+	if err != nil {
+		return err
+	}
+	result := forwarder.DryRun(&userInfo)
+
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -188,7 +188,10 @@ func TestForwarding_E2E(t *testing.T) {
 		testEmail := "query@example.com"
 
 		// Create forwarder to simulate what middleware does
-		forwarder := forwarding.NewForwarder(&cfg.Forwarding, nil)
+		forwarder, err := forwarding.NewForwarder(&cfg.Forwarding, nil)
+		if err != nil {
+			t.Fatalf("NewForwarder() error = %v", err)
+		}
 		redirectURL := backendURL + "/dashboard"
 
 		userInfo := &forwarding.UserInfo{
@@ -155,13 +155,10 @@ export async function authenticateViaOTP(
     throw new Error(`OTP not found in email to ${email}`);
   }
 
-  // Enter OTP
-  await page.getByLabel('One-Time Password').fill(otp);
-
-  // Submit OTP
+  // Enter OTP (the form submits itself once the code is complete)
   await Promise.all([
     page.waitForURL(new RegExp(baseUrl.replace('http://', ''))),
-    page.getByRole('button', { name: 'Verify Code' }).click(),
+    page.locator('#otp-input').fill(otp),
   ]);
 
   // Verify authentication succeeded
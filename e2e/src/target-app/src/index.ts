@@ -23,7 +23,7 @@ interface UserInfo {
 
 /**
  * Decrypt AES-256-GCM encrypted data
- * Format: base64(nonce + ciphertext + tag)
+ * Format: v1:base64(nonce + ciphertext + tag)
  * This matches the Go implementation in pkg/forwarding/encryption.go
  */
 function decrypt(encryptedBase64: string): string {
@@ -31,8 +31,9 @@ function decrypt(encryptedBase64: string): string {
     // Hash the key with SHA-256 to get a consistent 32-byte key
     const keyHash = crypto.createHash('sha256').update(ENCRYPTION_KEY).digest();
 
-    // Decode base64
-    const encrypted = Buffer.from(encryptedBase64, 'base64');
+    // Strip the envelope identifier and decode base64
+    const payload = encryptedBase64.startsWith('v1:') ? encryptedBase64.slice(3) : encryptedBase64;
+    const encrypted = Buffer.from(payload, 'base64');
 
     // Extract nonce (12 bytes), ciphertext, and tag (16 bytes)
     const nonceSize = 12;
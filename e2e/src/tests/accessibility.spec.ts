@@ -0,0 +1,73 @@
+import { test, expect } from '@playwright/test';
+import AxeBuilder from '@axe-core/playwright';
+import { routeStubAuthRequests } from '../support/stub-auth-route';
+
+// WCAG 2.1 AA rule set
+const WCAG_TAGS = ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa'];
+
+const PAGES = [
+  { name: 'login', path: '/_auth/login' },
+  { name: 'login (dark theme)', path: '/_auth/login?theme=dark' },
+  { name: 'login (rtl)', path: '/_auth/login?lang=ar' },
+  { name: 'email sent', path: '/_auth/email/sent' },
+  { name: 'logout', path: '/_auth/logout' },
+  { name: 'invalid email token', path: '/_auth/email/verify?token=invalid-token' },
+];
+
+test.describe('Accessibility', () => {
+  test.beforeEach(async ({ page }) => {
+    await routeStubAuthRequests(page);
+  });
+
+  for (const { name, path } of PAGES) {
+    test(`${name} page has no WCAG 2.1 AA violations`, async ({ page }) => {
+      await page.goto(path);
+
+      const results = await new AxeBuilder({ page }).withTags(WCAG_TAGS).analyze();
+
+      expect(results.violations.map((v) => `${v.id}: ${v.help}`)).toEqual([]);
+    });
+  }
+
+  test('skip link moves focus to the main content', async ({ page }) => {
+    await page.goto('/_auth/login');
+
+    await page.keyboard.press('Tab');
+    const skipLink = page.locator('.skip-link');
+    await expect(skipLink).toBeFocused();
+    await expect(skipLink).toBeInViewport();
+
+    await page.keyboard.press('Enter');
+    await expect(page.locator('#main-content')).toBeFocused();
+  });
+
+  test('theme and language selects have accessible names', async ({ page }) => {
+    await page.goto('/_auth/login');
+
+    await expect(page.getByLabel('Theme')).toBeVisible();
+    await expect(page.getByLabel('Language')).toBeVisible();
+  });
+
+  test('OTP input is labelled', async ({ page }) => {
+    await page.goto('/_auth/email/sent');
+
+    const otpInput = page.locator('#otp-input');
+    await expect(otpInput).toHaveAttribute('autocomplete', 'one-time-code');
+    await expect(page.getByRole('group', { name: /code/i })).toBeVisible();
+  });
+
+  test('reduced motion disables transitions', async ({ browser }) => {
+    const context = await browser.newContext({ reducedMotion: 'reduce' });
+    const page = await context.newPage();
+    await routeStubAuthRequests(page);
+    await page.goto('/_auth/login');
+
+    const duration = await page
+      .locator('.btn')
+      .first()
+      .evaluate((el) => getComputedStyle(el).transitionDuration);
+    expect(parseFloat(duration)).toBeLessThan(0.01);
+
+    await context.close();
+  });
+});
@@ -39,24 +39,19 @@ test.describe('Passwordless OTP flow', () => {
     expect(otp).toMatch(/^[A-Z0-9]{12}$/);
     console.log(`Extracted OTP: ${otp}`);
 
-    // Verify that the OTP input field exists on the email sent page
-    const otpInput = page.locator('input[name="otp"]');
+    // Verify that the segmented OTP input exists on the email sent page
+    const otpInput = page.locator('#otp-input');
     await expect(otpInput).toBeVisible();
+    await expect(page.locator('.otp-segment')).toHaveCount(12);
 
     // Verify button is initially disabled
     const verifyButton = page.getByRole('button', { name: 'Verify Code' });
     await expect(verifyButton).toBeDisabled();
 
-    // Enter the OTP code
-    await otpInput.fill(otp!);
-
-    // Verify button becomes enabled (validation passes)
-    await expect(verifyButton).toBeEnabled();
-
-    // Submit the OTP form
+    // Entering the complete code distributes it across the segments and submits the form
     await Promise.all([
       page.waitForURL(/^((?!\/_auth).)*$/), // Wait for redirect away from auth pages
-      verifyButton.click(),
+      otpInput.fill(otp!),
     ]);
 
     // Verify we're logged in
@@ -81,19 +76,14 @@ test.describe('Passwordless OTP flow', () => {
 
     // Enter OTP with spaces (like it appears in the email)
     const otpWithSpaces = `${otp!.slice(0, 4)} ${otp!.slice(4, 8)} ${otp!.slice(8, 12)}`;
-    const otpInput = page.locator('input[name="otp"]');
+    const otpInput = page.locator('#otp-input');
     const verifyButton = page.getByRole('button', { name: 'Verify Code' });
 
     // Button should be disabled initially
     await expect(verifyButton).toBeDisabled();
 
+    // Spaces are dropped while distributing the code, then the form submits itself
     await otpInput.fill(otpWithSpaces);
-
-    // Button should be enabled (validation normalizes spaces)
-    await expect(verifyButton).toBeEnabled();
-
-    // Submit and verify login
-    await verifyButton.click();
     await expect(page.locator('[data-test="app-user-email"]')).toContainText(TEST_EMAIL);
   });
 
@@ -117,18 +107,12 @@ test.describe('Passwordless OTP flow', () => {
     // Create an invalid OTP by changing multiple characters
     // This ensures it passes client-side validation but fails server-side
     const invalidOTP = realOTP!.substring(0, 8) + 'XXXX';
-    const otpInput = page.locator('input[name="otp"]');
-    await otpInput.fill(invalidOTP);
-
-    // Button should be enabled with valid format
-    const verifyButton = page.getByRole('button', { name: 'Verify Code' });
-    await expect(verifyButton).toBeEnabled();
-
-    // Submit and verify server rejects it
-    await verifyButton.click();
+    // The complete code is submitted automatically and rejected by the server
+    await page.locator('#otp-input').fill(invalidOTP);
 
     // Should redirect back to email sent page with error
-    await expect(page).toHaveURL(/\/_auth\/email\/sent/);
+    await expect(page).toHaveURL(/\/_auth\/email\/sent\?error=invalid_otp/);
+    await expect(page.getByRole('alert')).toBeVisible();
   });
 
   test('correct format but wrong OTP code fails authentication', async ({ page }) => {
@@ -150,15 +134,8 @@ test.describe('Passwordless OTP flow', () => {
     // Create a wrong OTP by changing one character of the real OTP
     // This ensures it passes client-side validation but fails server-side
     const wrongOTP = realOTP!.substring(0, 11) + (realOTP![11] === 'A' ? 'B' : 'A');
-    const otpInput = page.locator('input[name="otp"]');
-    await otpInput.fill(wrongOTP);
-
-    // Wait for button to become enabled (client-side validation should pass)
-    const submitButton = page.getByRole('button', { name: 'Verify Code' });
-    await expect(submitButton).toBeEnabled();
-
-    // Submit the wrong OTP
-    await submitButton.click();
+    // The wrong OTP is submitted as soon as it is complete
+    await page.locator('#otp-input').fill(wrongOTP);
 
     // Should redirect back to email sent page (authentication failed)
     await expect(page).toHaveURL(/\/_auth\/email\/sent/);
@@ -184,8 +161,7 @@ test.describe('Passwordless OTP flow', () => {
     expect(otp).toBeTruthy();
 
     // Use OTP once
-    await page.locator('input[name="otp"]').fill(otp!);
-    await page.getByRole('button', { name: 'Verify Code' }).click();
+    await page.locator('#otp-input').fill(otp!);
     await expect(page.locator('[data-test="app-user-email"]')).toContainText(TEST_EMAIL);
 
     // Open a new page context (simulating a different session/browser)
@@ -195,8 +171,7 @@ test.describe('Passwordless OTP flow', () => {
     await newPage.goto('/_auth/email/sent');
 
     // Try to use the same OTP in the new context
-    await newPage.locator('input[name="otp"]').fill(otp!);
-    await newPage.getByRole('button', { name: 'Verify Code' }).click();
+    await newPage.locator('#otp-input').fill(otp!);
 
     // Should fail - redirect back to email sent page with error
     await expect(newPage).toHaveURL(/\/_auth\/email\/sent/);
@@ -205,6 +180,34 @@ test.describe('Passwordless OTP flow', () => {
     await newPage.close();
   });
 
+  test('pasting a code into the first segment fills every segment', async ({ page }) => {
+    await page.goto('/_auth/email/sent');
+
+    const segments = page.locator('.otp-segment');
+    await expect(segments).toHaveCount(12);
+
+    // Stop the automatic submission so the distributed value can be inspected
+    await page.locator('form[data-otp-form]').evaluate((form) => {
+      form.addEventListener('submit', (e) => e.preventDefault());
+    });
+
+    await page.locator('#otp-input').evaluate((input) => {
+      const data = new DataTransfer();
+      data.setData('text', 'abcd-efgh-2345');
+      input.dispatchEvent(new ClipboardEvent('paste', { clipboardData: data, bubbles: true, cancelable: true }));
+    });
+
+    await expect(page.locator('input[name="otp"]')).toHaveValue('ABCDEFGH2345');
+    await expect(segments.last()).toHaveValue('5');
+    await expect(page.getByRole('button', { name: 'Verify Code' })).toBeEnabled();
+
+    // Backspace on an empty segment clears the previous one
+    await segments.last().fill('');
+    await segments.last().press('Backspace');
+    await expect(segments.nth(10)).toHaveValue('');
+    await expect(page.getByRole('button', { name: 'Verify Code' })).toBeDisabled();
+  });
+
   test('email contains OTP code', async ({ page }) => {
     const TEST_EMAIL = 'otp-email-content@example.com';
     await page.goto('/');
@@ -1,14 +1,13 @@
 package main
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 
-	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding/forwardingtest"
 )
 
 // UserInfoResponse represents the response with user information
@@ -31,7 +30,10 @@ type RawHeaders struct {
 	ForwardedEmail string `json:"X-ChatbotGate-Email,omitempty"`
 }
 
-var encryptionKey string
+var (
+	encryptionKey string
+	decoder       *forwardingtest.Decoder // Decrypts forwarded values, including legacy encoding
+)
 
 func main() {
 	port := flag.Int("port", 8083, "Port to listen on")
@@ -42,6 +44,10 @@ func main() {
 		log.Fatal("Encryption key is required (use -key flag)")
 	}
 	encryptionKey = *key
+	var err error
+	if decoder, err = forwardingtest.NewDecoder(encryptionKey, nil); err != nil {
+		log.Fatal(err)
+	}
 
 	http.HandleFunc("/", handleRoot)
 	http.HandleFunc("/health", handleHealth)
@@ -161,27 +167,11 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 // decryptField attempts to decrypt a single field value
 // Returns decrypted string on success, empty string on failure
 func decryptField(encrypted string) string {
-	encryptor := forwarding.NewEncryptor(encryptionKey)
-
-	// The filter chain auto-applies base64 encoding when encrypt filter outputs binary type
-	// So the data is double base64-encoded: we need to decode once first
-	outerDecoded, err := base64.StdEncoding.DecodeString(encrypted)
-	if err != nil {
-		// Not double-encoded, try decrypting directly
-		decrypted, err := encryptor.Decrypt(encrypted)
-		if err != nil {
-			return ""
-		}
-		return decrypted
-	}
-
-	// Now decrypt (which will decode the inner base64 internally)
-	decrypted, err := encryptor.Decrypt(string(outerDecoded))
-	if err != nil {
-		// Not encrypted or decryption failed
-		return ""
+	if v := decoder.Decode(encrypted); v.Encrypted {
+		return v.Value
 	}
-	return decrypted
+	// Not encrypted or decryption failed
+	return ""
 }
 
 // Passthrough test handlers
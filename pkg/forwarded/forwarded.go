@@ -0,0 +1,262 @@
+// Package forwarded decrypts user info values that ChatbotGate forwards to upstream applications.
+//
+// Upstream backends import it to read encrypted forwarding fields (headers, query parameters and
+// JSON body fields). It depends on the standard library and golang.org/x/crypto only.
+//
+//	d := forwarded.NewDecryptor(os.Getenv("FORWARDING_KEY"))
+//	email, err := d.Decrypt(r.Header.Get("X-Auth-Email"))
+//
+// Encrypted values are envelopes: "<id>:<base64>", where the identifier names the format and the
+// algorithm. The payload is nonce || ciphertext || tag under a key derived from the SHA-256 hash of
+// the shared key (the whole hash, or its first 16 bytes for AES-128-GCM). With rsa-oaep, the gate
+// only holds the upstream's public key: the payload starts with a random AES-256-GCM key wrapped
+// with RSA-OAEP (SHA-256), which only the upstream's private key unwraps (NewPrivateKeyDecryptor).
+// Values compressed with the zip filter (before or after encrypt) are decompressed automatically.
+package forwarded
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Encryption algorithms (forwarding.encryption.algorithm)
+const (
+	AlgorithmAES256GCM        = "aes-256-gcm"
+	AlgorithmAES128GCM        = "aes-128-gcm"
+	AlgorithmChaCha20Poly1305 = "chacha20-poly1305"
+	AlgorithmRSAOAEP          = "rsa-oaep" // Hybrid: RSA-OAEP wrapped AES-256-GCM key (upstream public key)
+)
+
+// ContentKeySize is the size of the random AES-256-GCM key of rsa-oaep values
+const ContentKeySize = 32
+
+// Envelope identifiers of encrypted values
+const (
+	EnvelopeV1                 = "v1"                   // AES-256-GCM, 12-byte nonce, key = SHA-256(shared key)
+	EnvelopeV1AES128GCM        = "v1.aes-128-gcm"       // AES-128-GCM, 12-byte nonce, key = SHA-256(shared key)[:16]
+	EnvelopeV1ChaCha20Poly1305 = "v1.chacha20-poly1305" // ChaCha20-Poly1305, 12-byte nonce, key = SHA-256(shared key)
+	EnvelopeV1RSAOAEP          = "v1.rsa-oaep"          // RSA-OAEP (SHA-256) wrapped key || AES-256-GCM payload under it
+)
+
+// envelopeAlgorithms maps envelope identifiers to their algorithms
+var envelopeAlgorithms = map[string]string{
+	EnvelopeV1:                 AlgorithmAES256GCM,
+	EnvelopeV1AES128GCM:        AlgorithmAES128GCM,
+	EnvelopeV1ChaCha20Poly1305: AlgorithmChaCha20Poly1305,
+	EnvelopeV1RSAOAEP:          AlgorithmRSAOAEP,
+}
+
+// Envelope returns the envelope identifier of values encrypted with an algorithm
+func Envelope(algorithm string) (string, bool) {
+	for id, alg := range envelopeAlgorithms {
+		if alg == algorithm {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// NewAEAD returns the cipher of an algorithm for the SHA-256 hash of the shared key
+// It is shared with the gate's encrypt filter so both sides derive keys the same way.
+func NewAEAD(algorithm string, keyHash []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case AlgorithmAES256GCM, AlgorithmAES128GCM:
+		key := keyHash
+		if algorithm == AlgorithmAES128GCM {
+			key = keyHash[:16]
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmChaCha20Poly1305:
+		return chacha20poly1305.New(keyHash)
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm %q", algorithm)
+}
+
+var (
+	// ErrInvalidValue is returned when a value is not a valid encrypted envelope
+	ErrInvalidValue = errors.New("invalid encrypted value")
+
+	// ErrUnsupportedEnvelope is returned for envelope identifiers this package does not know
+	ErrUnsupportedEnvelope = errors.New("unsupported envelope")
+
+	// ErrDecryptionFailed is returned when the value was not encrypted with the key or was modified
+	ErrDecryptionFailed = errors.New("decryption failed")
+
+	// ErrKeyRequired is returned when the Decryptor lacks the key of the value's envelope
+	// (the shared key for symmetric algorithms, the private key for rsa-oaep)
+	ErrKeyRequired = errors.New("decryption key is not configured")
+
+	// ErrInvalidKey is returned when key material is not a PEM RSA key
+	ErrInvalidKey = errors.New("invalid RSA key")
+)
+
+// gzipMagic starts gzip streams (zip filter output)
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decryptor decrypts forwarded values with the shared forwarding.encryption.key,
+// or with the upstream's private key for rsa-oaep values
+type Decryptor struct {
+	key        []byte          // SHA-256 hash of the shared key (nil without one)
+	privateKey *rsa.PrivateKey // Private key of rsa-oaep values (nil without one)
+}
+
+// NewDecryptor creates a Decryptor for the shared key (forwarding.encryption.key)
+func NewDecryptor(key string) *Decryptor {
+	hash := sha256.Sum256([]byte(key))
+	return &Decryptor{key: hash[:]}
+}
+
+// NewPrivateKeyDecryptor creates a Decryptor of rsa-oaep values for the upstream's PEM private key
+// (PKCS #8 "PRIVATE KEY" or PKCS #1 "RSA PRIVATE KEY")
+func NewPrivateKeyDecryptor(privateKeyPEM []byte) (*Decryptor, error) {
+	d := &Decryptor{}
+	if err := d.SetPrivateKey(privateKeyPEM); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetPrivateKey adds the private key of rsa-oaep values, for gates mixing them with shared key fields
+func (d *Decryptor) SetPrivateKey(privateKeyPEM []byte) error {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return ErrInvalidKey
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidKey, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("%w: not an RSA key", ErrInvalidKey)
+	}
+	d.privateKey = rsaKey
+	return nil
+}
+
+// Decrypt decrypts a forwarded value and returns the plaintext
+// Values without an envelope identifier are accepted as v1 payloads (single base64 encoding).
+func (d *Decryptor) Decrypt(value string) (string, error) {
+	plaintext, err := d.Open(value)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Open is like Decrypt, returning the plaintext bytes
+// The stamp of stamped values is removed without verification (see DecryptVerified).
+func (d *Decryptor) Open(value string) ([]byte, error) {
+	plaintext, _, err := d.OpenStamped(value)
+	return plaintext, err
+}
+
+// OpenStamped is like Open, also returning the stamp of stamped values (nil for other values)
+func (d *Decryptor) OpenStamped(value string) ([]byte, *Stamp, error) {
+	id, payload, found := strings.Cut(value, ":")
+	if !found {
+		id, payload = EnvelopeV1, value
+	}
+	id, stamped := strings.CutSuffix(id, StampSuffix)
+	algorithm, ok := envelopeAlgorithms[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedEnvelope, id)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, nil, ErrInvalidValue
+	}
+	data = gunzipIfCompressed(data) // encrypt,zip
+
+	plaintext, err := d.open(algorithm, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var stamp *Stamp
+	if stamped {
+		if stamp, plaintext, err = splitStamp(plaintext); err != nil {
+			return nil, nil, err
+		}
+	}
+	return gunzipIfCompressed(plaintext), stamp, nil // zip,encrypt
+}
+
+// open decrypts a payload: nonce (12 bytes) || ciphertext || tag (16 bytes),
+// preceded by the wrapped content key for rsa-oaep
+func (d *Decryptor) open(algorithm string, data []byte) ([]byte, error) {
+	key := d.key
+	if algorithm == AlgorithmRSAOAEP {
+		if d.privateKey == nil {
+			return nil, fmt.Errorf("%w: %s needs the private key", ErrKeyRequired, algorithm)
+		}
+		size := d.privateKey.Size()
+		if len(data) < size {
+			return nil, ErrInvalidValue
+		}
+		contentKey, err := rsa.DecryptOAEP(sha256.New(), nil, d.privateKey, data[:size], nil)
+		if err != nil || len(contentKey) != ContentKeySize {
+			return nil, ErrDecryptionFailed
+		}
+		key, algorithm, data = contentKey, AlgorithmAES256GCM, data[size:]
+	} else if key == nil {
+		return nil, fmt.Errorf("%w: %s needs the shared key", ErrKeyRequired, algorithm)
+	}
+
+	aead, err := NewAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidValue
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// gunzipIfCompressed decompresses gzip data, returning other data unchanged
+func gunzipIfCompressed(data []byte) []byte {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	defer func() { _ = reader.Close() }()
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return data
+	}
+	return decompressed
+}
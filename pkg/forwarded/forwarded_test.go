@@ -0,0 +1,150 @@
+package forwarded
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// testKey is the forwarding.encryption.key of the test vectors
+const testKey = "this-is-a-32-character-encryption-key-12345"
+
+// Test vectors produced by the gate's filter chain for "alice@example.com"
+// The Node helper (sdk/node) is tested against the same vectors
+var testVectors = map[string]string{
+	"encrypt":     "v1:4jSMKeFzKSYXx2eFksiANbheF37ZW+6c62W28nos+CKb89JQscEPnFP0bDZV",
+	"encrypt,zip": "v1:H4sIAAAAAAAA/wAtANL/Ncx6s5NJrvKVdyid+KewW1kXad5alUU0XCob5XFDySS//2p14gUuAof1JmGwAwB+nu69LQAAAA==",
+	"zip,encrypt": "v1:AdzfKibTfuxGtIIZqIH8T0tk+0HTx8qMUo2Ch4qBzDEm1pmkyHIVLcyCR1Mvf5b50TLd3zywH9oB4JelU899tU3hMrus1A==",
+	"no envelope": "4jSMKeFzKSYXx2eFksiANbheF37ZW+6c62W28nos+CKb89JQscEPnFP0bDZV",
+
+	"aes-128-gcm encrypt":           "v1.aes-128-gcm:U/gP1+HyXG5BPPOTDDyxKnXf58j0is/N9ZuaIg5H0R3EFMYyx3XDrkSofoEx",
+	"aes-128-gcm encrypt,zip":       "v1.aes-128-gcm:H4sIAAAAAAAA/wAtANL/BZPZn6ley8DHOXpYYYF5PA4rmRN/JDDROEBGjfr/eZsDm+ioTHw8mtoInCHvAwAbU4VRLQAAAA==",
+	"aes-128-gcm zip,encrypt":       "v1.aes-128-gcm:Fo2OrepUuoshkwkM46ZIEYFxvaCHMqE8ubkOu41ggGj44W3l4ghkm1OWwMMlHIHNzMv7x1+/NA1IcdQ1XUz9ourBg45Tyg==",
+	"chacha20-poly1305 encrypt":     "v1.chacha20-poly1305:XzcjVoq2JiSIoYNUMSr9XuEml3nUXDrhP8IHr7wkEo4GhjGB2kA0ni18tC8q",
+	"chacha20-poly1305 encrypt,zip": "v1.chacha20-poly1305:H4sIAAAAAAAA/wAtANL/xViLs4J9E8h/3+e7z8Ne+JQhiU659DxnxDXeU2VZu6d1JJJvS66FZKTm0rrXAwDymRAJLQAAAA==",
+	"chacha20-poly1305 zip,encrypt": "v1.chacha20-poly1305:8hBuEhYOeNIPqLoDcRROlV2axmPYWSQYzDaE5ROdDzdppbs34yCQdpOHU36mocXIZq0JC532/wMya45ABR5gr2OuJk+sgA==",
+}
+
+// rsaVectors are rsa-oaep values for the public key of testdata/rsa-private.pem
+var rsaVectors = map[string]string{
+	"encrypt":     "v1.rsa-oaep:dnIIL+kAK6VeorwpvsL9ckSJkkKiNI2lxc2/h+YiMyfM7kBmPxHmrcfkMdOyp+Q6X0CnudVizKBrTVIeQYz0wsAIhHxQ5pcH9eh/dBAZJQoK5bGxoOLi9FqVHE871zUjf4XSAAHhexrTuhlGfOP4idgivfNsld4P7hHhOTAJ4wjgBqZg60OAz3KWd2H9OwfdqRgizHlMyBkIGelt6kEleNnC4OH/wZG4vRovqhlbasj43lhJsST6dQBwjoIMltTEEXLpsGmRBAnb7prT5DsUWa+x5XcoiKFG6F6HxVobW1+T8zNgTftIaxqFYAtPmvFgVogn+aDIAFeKpLBAd+omk6IIRCAiymA7amGrpNKCTfqTBVrU09eFPg/B9O9eBZbIXZKZu5vIKmlsHvZ7fg==",
+	"encrypt,zip": "v1.rsa-oaep:H4sIAAAAAAAA/wAtAdL+sDiP/9OosGllK6RIrisZnROU3sKs9cG5rOtQc7ji9RuNPpO29oE1LEqOhsda0vtkDsRxCDq6MCnliht3RNLb0t/TJl/Coj4GMLjFNOVOWyy1w47oCpC1hXU0/Ko/joE3n/n1BPMOgwDL3jw+fg1i12z9zCjiqXCJA5FMNsSNv8bcZ9HCFV1udp/otiuOGFu7JVXHJwuRQK8CqjsrlRiqczmMuSYoHvoE2sVRhu6HiMmFgCSkIC1FG1/MCcVrXtoyUXLgFAa7+4Urp0vmWk6dU88vxhsR/srKwnn6L620W2f+6KE+vAl/9Dth60+UUtis0HQ9HN7lFax9if9dh80VKspU15MSxn19r5WFBAKomn9BtzGWRmLpboEAQ8VIZmOP8i6js2FZ8qGcTwHurwMAufR1ny0BAAA=",
+	"zip,encrypt": "v1.rsa-oaep:iZE5xTpXDACKFFSMvITJxrhYYQTO+Us4kGiYBw5ZfIyEaCXvo364ZUt/4Tv/2v8XcqUg1okRpv+nHR71Q/V2Usk/sf1eMNlRWG0Ic4TzSsADSHs5+cFZEbVIqxqEtbxwFERTagsT+QJXzP3a7irQlO32Y728RrynLr30YulZEd4/A2z4RtdOtTSAl/8VCVKsn2j2A1LJn1yhX5oTsd3Vc/XfgVc829FbMTEyRzLXEbJME6AUSOTAUQAqmO7xpMWeQWaYspVgKqSq/agG4BfJBit2WAxV924BvJgx+5Kc6dGoVkBFFW1znzHj3gNHZNeTSSHZO0NFmumeLfFbYu3+aB0Tas8s8DLRMSMHnFoThhXozzomJiZnRO9FPaWB/AIa1b3/ProNKti+5Mla1stYn7SUODn/XMqqNe65yvQ3KbdmWc2xwzU=",
+}
+
+func TestDecryptor_Decrypt(t *testing.T) {
+	d := NewDecryptor(testKey)
+	for name, value := range testVectors {
+		t.Run(name, func(t *testing.T) {
+			got, err := d.Decrypt(value)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != "alice@example.com" {
+				t.Errorf("Decrypt() = %q, want alice@example.com", got)
+			}
+		})
+	}
+}
+
+func TestDecryptor_DecryptErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr error
+	}{
+		{"wrong key", "another-key-with-at-least-32-characters", testVectors["encrypt"], ErrDecryptionFailed},
+		{"unknown envelope", testKey, "v9:" + testVectors["no envelope"], ErrUnsupportedEnvelope},
+		{"not base64", testKey, "v1:not base64!", ErrInvalidValue},
+		{"too short", testKey, "v1:AAAA", ErrInvalidValue},
+		{"modified", testKey, testVectors["encrypt"][:10] + "A" + testVectors["encrypt"][11:], ErrDecryptionFailed},
+		{"wrong algorithm", testKey, "v1.aes-128-gcm:" + testVectors["no envelope"], ErrDecryptionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecryptor(tt.key).Decrypt(tt.value); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{AlgorithmAES256GCM, EnvelopeV1},
+		{AlgorithmAES128GCM, EnvelopeV1AES128GCM},
+		{AlgorithmChaCha20Poly1305, EnvelopeV1ChaCha20Poly1305},
+	}
+	for _, tt := range tests {
+		if got, ok := Envelope(tt.algorithm); !ok || got != tt.want {
+			t.Errorf("Envelope(%q) = %q, %v, want %q", tt.algorithm, got, ok, tt.want)
+		}
+	}
+	if _, ok := Envelope("aes-192-gcm"); ok {
+		t.Error("Envelope(aes-192-gcm) should not be supported")
+	}
+}
+
+func TestPrivateKeyDecryptor_Decrypt(t *testing.T) {
+	privateKeyPEM, err := os.ReadFile("testdata/rsa-private.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	d, err := NewPrivateKeyDecryptor(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("NewPrivateKeyDecryptor() error = %v", err)
+	}
+	for name, value := range rsaVectors {
+		t.Run(name, func(t *testing.T) {
+			got, err := d.Decrypt(value)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != "alice@example.com" {
+				t.Errorf("Decrypt() = %q, want alice@example.com", got)
+			}
+		})
+	}
+
+	// Keys the decryptor lacks
+	if _, err := d.Decrypt(testVectors["encrypt"]); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Decrypt(v1) error = %v, want ErrKeyRequired", err)
+	}
+	if _, err := NewDecryptor(testKey).Decrypt(rsaVectors["encrypt"]); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Decrypt(v1.rsa-oaep) without private key error = %v, want ErrKeyRequired", err)
+	}
+
+	// Shared key and private key in one decryptor
+	mixed := NewDecryptor(testKey)
+	if err := mixed.SetPrivateKey(privateKeyPEM); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	for _, value := range []string{testVectors["encrypt"], rsaVectors["encrypt"]} {
+		if got, err := mixed.Decrypt(value); err != nil || got != "alice@example.com" {
+			t.Errorf("Decrypt() = %q, %v, want alice@example.com", got, err)
+		}
+	}
+
+	modified := rsaVectors["encrypt"][:20] + "A" + rsaVectors["encrypt"][21:]
+	if _, err := d.Decrypt(modified); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Decrypt(modified) error = %v, want ErrDecryptionFailed", err)
+	}
+}
+
+func TestNewPrivateKeyDecryptor_InvalidKey(t *testing.T) {
+	publicKeyPEM, err := os.ReadFile("testdata/rsa-public.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for name, data := range map[string][]byte{"not PEM": []byte("secret"), "public key": publicKeyPEM} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewPrivateKeyDecryptor(data); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("NewPrivateKeyDecryptor() error = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
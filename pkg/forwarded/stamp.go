@@ -0,0 +1,111 @@
+package forwarded
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StampSuffix marks the envelope identifier of stamped values (e.g., "v1+stamp")
+// Stamped values carry a timestamp and nonce inside the encrypted payload (forwarding field "stamp: true"),
+// so an upstream can reject values replayed from leaked URLs.
+const StampSuffix = "+stamp"
+
+// StampSize is the size of the stamp preceding the plaintext: Unix time in seconds (8 bytes, big-endian) || nonce (16 bytes)
+const StampSize = 8 + 16
+
+// DefaultMaxAge is the validation window of NewVerifier, covering the redirect after sign-in
+const DefaultMaxAge = 5 * time.Minute
+
+// maxClockSkew is how far a stamp may lie in the future of the upstream's clock
+const maxClockSkew = time.Minute
+
+var (
+	// ErrNotStamped is returned by DecryptVerified for values without a stamp
+	ErrNotStamped = errors.New("value is not stamped")
+
+	// ErrExpired is returned for stamps outside the validation window
+	ErrExpired = errors.New("stamp expired")
+
+	// ErrReplayed is returned for nonces that were already verified
+	ErrReplayed = errors.New("value was replayed")
+)
+
+// Stamp is the timestamp and nonce of a stamped value
+type Stamp struct {
+	Time  time.Time // When the gate encrypted the value
+	Nonce string    // Random nonce (hex), unique per value
+}
+
+// splitStamp separates the stamp from the plaintext of a stamped value
+func splitStamp(plaintext []byte) (*Stamp, []byte, error) {
+	if len(plaintext) < StampSize {
+		return nil, nil, ErrInvalidValue
+	}
+	stamp := &Stamp{
+		Time:  time.Unix(int64(binary.BigEndian.Uint64(plaintext[:8])), 0),
+		Nonce: hex.EncodeToString(plaintext[8:StampSize]),
+	}
+	return stamp, plaintext[StampSize:], nil
+}
+
+// Verifier rejects stamps outside the validation window and nonces it has seen before
+// Seen nonces are kept in memory until they expire; upstreams running several instances
+// should route a user's sign-in to one instance or share nonces themselves.
+type Verifier struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // Nonce → expiry
+}
+
+// NewVerifier creates a Verifier accepting stamps up to maxAge old (DefaultMaxAge if zero)
+func NewVerifier(maxAge time.Duration) *Verifier {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	return &Verifier{maxAge: maxAge, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// Verify checks a stamp and records its nonce
+func (v *Verifier) Verify(stamp *Stamp) error {
+	now := v.now()
+	if stamp.Time.Before(now.Add(-v.maxAge)) || stamp.Time.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%w: stamped at %s", ErrExpired, stamp.Time.UTC().Format(time.RFC3339))
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Forget expired nonces; their stamps fail the window check anyway
+	for nonce, expiry := range v.seen {
+		if now.After(expiry) {
+			delete(v.seen, nonce)
+		}
+	}
+	if _, seen := v.seen[stamp.Nonce]; seen {
+		return ErrReplayed
+	}
+	v.seen[stamp.Nonce] = stamp.Time.Add(v.maxAge)
+	return nil
+}
+
+// DecryptVerified decrypts a stamped value and verifies its stamp
+// Values without a stamp are rejected with ErrNotStamped.
+func (d *Decryptor) DecryptVerified(value string, verifier *Verifier) (string, error) {
+	plaintext, stamp, err := d.OpenStamped(value)
+	if err != nil {
+		return "", err
+	}
+	if stamp == nil {
+		return "", ErrNotStamped
+	}
+	if err := verifier.Verify(stamp); err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,94 @@
+package forwarded
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Stamped test vectors for "alice@example.com", stamped at stampedAt
+var stampedVectors = map[string]string{
+	"encrypt":     "v1+stamp:gJdzioClnh3eGlQrwzPB7kxB8xI6pSQwn6A6qwf3HAUlhIHCLfGlIihKSBgbovps5e84vkFD9CT+5SCtuAH5ggmVouSv",
+	"zip,encrypt": "v1+stamp:eJD3cixSmVp+wbAhEcIj4+xmawX2kZ5gqrndwJgqpVphaEZo3KXw5VGDKAVHKNFAyQY9cYdX8YoghnFg9mZ1YncFJAyztoIXf5vY7gbRZGz3IFeWA6bbg7J7R6TtsA==",
+}
+
+var stampedAt = time.Unix(1791986725, 0)
+
+// verifierAt returns a verifier whose clock is at t
+func verifierAt(t time.Time) *Verifier {
+	v := NewVerifier(0)
+	v.now = func() time.Time { return t }
+	return v
+}
+
+func TestDecryptor_OpenStamped(t *testing.T) {
+	d := NewDecryptor(testKey)
+	plaintext, stamp, err := d.OpenStamped(stampedVectors["encrypt"])
+	if err != nil {
+		t.Fatalf("OpenStamped() error = %v", err)
+	}
+	if string(plaintext) != "alice@example.com" {
+		t.Errorf("OpenStamped() = %q, want alice@example.com", plaintext)
+	}
+	if stamp == nil || !stamp.Time.Equal(stampedAt) || stamp.Nonce != "7bda0c51b502f5fbbb7d7719a23a33c3" {
+		t.Errorf("Stamp = %+v, want the stamp of the vector", stamp)
+	}
+
+	// Plain Decrypt strips the stamp; unstamped values have no stamp
+	if got, err := d.Decrypt(stampedVectors["zip,encrypt"]); err != nil || got != "alice@example.com" {
+		t.Errorf("Decrypt() = %q, %v, want alice@example.com", got, err)
+	}
+	if _, stamp, err := d.OpenStamped(testVectors["encrypt"]); err != nil || stamp != nil {
+		t.Errorf("OpenStamped(unstamped) stamp = %+v, %v, want nil", stamp, err)
+	}
+}
+
+func TestDecryptor_DecryptVerified(t *testing.T) {
+	d := NewDecryptor(testKey)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		value   string
+		wantErr error
+	}{
+		{"fresh", stampedAt.Add(10 * time.Second), stampedVectors["encrypt"], nil},
+		{"zipped", stampedAt.Add(4 * time.Minute), stampedVectors["zip,encrypt"], nil},
+		{"expired", stampedAt.Add(DefaultMaxAge + time.Second), stampedVectors["encrypt"], ErrExpired},
+		{"from the future", stampedAt.Add(-2 * time.Minute), stampedVectors["encrypt"], ErrExpired},
+		{"not stamped", stampedAt, testVectors["encrypt"], ErrNotStamped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.DecryptVerified(tt.value, verifierAt(tt.now))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecryptVerified() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != "alice@example.com" {
+				t.Errorf("DecryptVerified() = %q, want alice@example.com", got)
+			}
+		})
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	d := NewDecryptor(testKey)
+	verifier := verifierAt(stampedAt)
+
+	if _, err := d.DecryptVerified(stampedVectors["encrypt"], verifier); err != nil {
+		t.Fatalf("First DecryptVerified() error = %v", err)
+	}
+	if _, err := d.DecryptVerified(stampedVectors["encrypt"], verifier); !errors.Is(err, ErrReplayed) {
+		t.Errorf("Second DecryptVerified() error = %v, want ErrReplayed", err)
+	}
+	if _, err := d.DecryptVerified(stampedVectors["zip,encrypt"], verifier); err != nil {
+		t.Errorf("DecryptVerified() of another nonce error = %v", err)
+	}
+
+	// Expired nonces are forgotten
+	verifier.now = func() time.Time { return stampedAt.Add(DefaultMaxAge + time.Second) }
+	_ = verifier.Verify(&Stamp{Time: verifier.now(), Nonce: "other"})
+	if len(verifier.seen) != 1 {
+		t.Errorf("Seen nonces = %d, want 1 after expiry", len(verifier.seen))
+	}
+}
@@ -26,6 +26,36 @@ func GetEmbeddedDifyCSS() string {
 	return embeddedDifyCSS
 }
 
+// Embedded OTP input script for the email sent page
+//
+//go:embed static/otp.js
+var embeddedOTPJS string
+
+// GetEmbeddedOTPJS returns the embedded OTP input script
+func GetEmbeddedOTPJS() string {
+	return embeddedOTPJS
+}
+
+// Embedded URL fragment capture script for the login page
+//
+//go:embed static/fragment.js
+var embeddedFragmentJS string
+
+// GetEmbeddedFragmentJS returns the embedded URL fragment capture script
+func GetEmbeddedFragmentJS() string {
+	return embeddedFragmentJS
+}
+
+// Embedded dismiss script of the announcement banner
+//
+//go:embed static/announcement.js
+var embeddedAnnouncementJS string
+
+// GetEmbeddedAnnouncementJS returns the embedded dismiss script of the announcement banner
+func GetEmbeddedAnnouncementJS() string {
+	return embeddedAnnouncementJS
+}
+
 // Embedded icons from web/public/icons/
 // Build: cd web && yarn build (automatically copies icons)
 //
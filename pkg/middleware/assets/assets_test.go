@@ -105,3 +105,70 @@ func TestCSSFilesAreDifferent(t *testing.T) {
 		t.Error("Main CSS and Dify CSS should have different lengths")
 	}
 }
+
+// TestLookup tests the index of embedded assets and their content hashes
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"main.css", "dify.css", "otp.js", "fragment.js", "announcement.js", "icons/google.svg", "icons/chatbotgate.svg"} {
+		asset, ok := Lookup(name)
+		if !ok {
+			t.Errorf("Lookup(%q) found nothing", name)
+			continue
+		}
+		if len(asset.Body) == 0 || asset.Hash == "" || asset.ETag != `"`+asset.Hash+`"` {
+			t.Errorf("Lookup(%q) = body of %d bytes, hash %q, ETag %q", name, len(asset.Body), asset.Hash, asset.ETag)
+		}
+		fingerprinted := FingerprintedName(name)
+		if original, hash, ok := SplitFingerprint(fingerprinted); !ok || original != name || hash != asset.Hash {
+			t.Errorf("SplitFingerprint(%q) = %q, %q, %v", fingerprinted, original, hash, ok)
+		}
+	}
+
+	for _, name := range []string{"", "icons/", "icons/../main.css", "static/main.css"} {
+		if _, ok := Lookup(name); ok {
+			t.Errorf("Lookup(%q) should find nothing", name)
+		}
+	}
+
+	if NewAsset([]byte("a")).Hash == NewAsset([]byte("b")).Hash {
+		t.Error("different contents should have different hashes")
+	}
+}
+
+// TestFingerprint tests hashed asset file names
+func TestFingerprint(t *testing.T) {
+	if got := Fingerprint("icons/google.svg", "3f2a9c1b7d4e5f60"); got != "icons/google.3f2a9c1b7d4e5f60.svg" {
+		t.Errorf("Fingerprint() = %q", got)
+	}
+	if got := FingerprintedName("missing.css"); got != "missing.css" {
+		t.Errorf("FingerprintedName() of an unknown asset = %q, want it unchanged", got)
+	}
+
+	for _, name := range []string{
+		"main.css",                  // No hash
+		"main.3f2a9c.css",           // Too short
+		"main.3f2a9c1b7d4e5f6z.css", // Not hex
+		"3f2a9c1b7d4e5f60",          // No extension
+		"main.css.3f2a9c1b7d4e5f60", // Hash after the extension
+	} {
+		if _, _, ok := SplitFingerprint(name); ok {
+			t.Errorf("SplitFingerprint(%q) should fail", name)
+		}
+	}
+}
+
+// TestContentType tests Content-Type detection of the embedded assets
+func TestContentType(t *testing.T) {
+	tests := map[string]string{
+		"main.css":         "text/css; charset=utf-8",
+		"otp.js":           "text/javascript; charset=utf-8",
+		"icons/google.svg": "image/svg+xml",
+		"favicon.png":      "image/png",
+		"favicon.ico":      "image/x-icon",
+		"unknown":          "application/octet-stream",
+	}
+	for name, want := range tests {
+		if got := ContentType(name); got != want {
+			t.Errorf("ContentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Segmented OTP input for the email sent page
+// Progressive enhancement: without JavaScript the single text input is submitted as-is.
+// With JavaScript it is replaced by one input per character that auto-advances,
+// accepts a pasted code and submits the form once the code is complete.
+(function () {
+	'use strict';
+
+	var OTP_LENGTH = 12;
+	var GROUP_SIZE = 4;
+
+	function normalize(value) {
+		return (value || '').replace(/[^A-Za-z0-9]/g, '').toUpperCase();
+	}
+
+	function init(form) {
+		var source = form.querySelector('input[name="otp"]');
+		var button = form.querySelector('button[type="submit"]');
+		if (!source || !button) return;
+
+		var segmentLabel = form.getAttribute('data-segment-label') || 'Character {n} of {total}';
+		var label = source.id ? document.querySelector('label[for="' + source.id + '"]') : null;
+		var describedBy = source.getAttribute('aria-describedby');
+		var initial = normalize(source.value);
+		var submitted = false;
+
+		var container = document.createElement('div');
+		container.className = 'otp-segments';
+		container.setAttribute('role', 'group');
+		if (label) {
+			if (!label.id) label.id = source.id + '-label';
+			container.setAttribute('aria-labelledby', label.id);
+		}
+
+		var segments = [];
+		for (var i = 0; i < OTP_LENGTH; i++) {
+			if (i > 0 && i % GROUP_SIZE === 0) {
+				var separator = document.createElement('span');
+				separator.className = 'otp-separator';
+				separator.setAttribute('aria-hidden', 'true');
+				separator.textContent = '-';
+				container.appendChild(separator);
+			}
+
+			var input = document.createElement('input');
+			input.type = 'text';
+			input.className = 'input otp-segment';
+			input.setAttribute('inputmode', 'text');
+			input.setAttribute('autocomplete', i === 0 ? 'one-time-code' : 'off');
+			input.setAttribute('autocapitalize', 'characters');
+			input.setAttribute('spellcheck', 'false');
+			input.setAttribute('aria-label', segmentLabel.replace('{n}', String(i + 1)).replace('{total}', String(OTP_LENGTH)));
+			if (describedBy) input.setAttribute('aria-describedby', describedBy);
+			input.value = initial.charAt(i);
+			segments.push(input);
+			container.appendChild(input);
+		}
+
+		// The first segment takes over the id so the existing label focuses it
+		if (source.id) {
+			segments[0].id = source.id;
+			source.removeAttribute('id');
+		}
+		source.type = 'hidden';
+		source.parentNode.insertBefore(container, source);
+
+		function value() {
+			return segments.map(function (s) { return s.value; }).join('');
+		}
+
+		function update() {
+			var code = value();
+			var complete = code.length === OTP_LENGTH;
+			source.value = code;
+			button.disabled = !complete;
+			container.classList.toggle('otp-complete', complete);
+		if (!complete) submitted = false;
+
+			if (complete && !submitted) {
+				submitted = true;
+				if (typeof form.requestSubmit === 'function') {
+					form.requestSubmit(button);
+				} else {
+					form.submit();
+				}
+			}
+		}
+
+		// fill writes characters starting at index and moves focus past the last one
+		function fill(index, chars) {
+			if (chars.length === 0) {
+				segments[index].value = '';
+				update();
+				return;
+			}
+			for (var j = 0; j < chars.length && index + j < OTP_LENGTH; j++) {
+				segments[index + j].value = chars.charAt(j);
+			}
+			segments[Math.min(index + chars.length, OTP_LENGTH - 1)].focus();
+			update();
+		}
+
+		segments.forEach(function (input, index) {
+			input.addEventListener('input', function (e) {
+				// Typing replaces the character; autofill and some mobile keyboards insert the whole code into one field
+				var typed = e.inputType === 'insertText' && e.data ? normalize(e.data) : '';
+				fill(index, typed || normalize(input.value));
+			});
+
+			input.addEventListener('paste', function (e) {
+				var text = (e.clipboardData || window.clipboardData).getData('text');
+				e.preventDefault();
+				fill(index, normalize(text));
+			});
+
+			input.addEventListener('keydown', function (e) {
+				if (e.key === 'Backspace' && input.value === '' && index > 0) {
+					e.preventDefault();
+					segments[index - 1].value = '';
+					segments[index - 1].focus();
+					update();
+				} else if (e.key === 'ArrowLeft' && index > 0) {
+					e.preventDefault();
+					segments[index - 1].focus();
+				} else if (e.key === 'ArrowRight' && index < OTP_LENGTH - 1) {
+					e.preventDefault();
+					segments[index + 1].focus();
+				}
+			});
+
+			input.addEventListener('focus', function () {
+				input.select();
+			});
+		});
+
+		// Allow another attempt after the browser restores the page from the back/forward cache
+		window.addEventListener('pageshow', function () {
+			submitted = false;
+		});
+
+		button.disabled = value().length !== OTP_LENGTH;
+	}
+
+	function start() {
+		var forms = document.querySelectorAll('form[data-otp-form]');
+		for (var i = 0; i < forms.length; i++) {
+			init(forms[i]);
+		}
+	}
+
+	if (document.readyState === 'loading') {
+		document.addEventListener('DOMContentLoaded', start);
+	} else {
+		start();
+	}
+})();
@@ -0,0 +1,131 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Asset is an embedded file with its content hash
+type Asset struct {
+	Body []byte
+	// Hash is a short hex hash of Body; asset URLs carry it in the file name (see Fingerprint),
+	// so they can be cached forever and browsers fetch changed assets right after an upgrade
+	Hash string
+	// ETag is the strong HTTP validator of Body (the quoted Hash)
+	ETag string
+}
+
+// NewAsset returns body as an asset with its content hash
+func NewAsset(body []byte) Asset {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:8])
+	return Asset{Body: body, Hash: hash, ETag: `"` + hash + `"`}
+}
+
+// embeddedAssets indexes the embedded files by their path under static/ ("main.css", "icons/google.svg")
+var embeddedAssets = sync.OnceValue(func() map[string]Asset {
+	index := map[string]Asset{
+		"main.css":        NewAsset([]byte(embeddedCSS)),
+		"dify.css":        NewAsset([]byte(embeddedDifyCSS)),
+		"otp.js":          NewAsset([]byte(embeddedOTPJS)),
+		"fragment.js":     NewAsset([]byte(embeddedFragmentJS)),
+		"announcement.js": NewAsset([]byte(embeddedAnnouncementJS)),
+	}
+	icons, _ := fs.Glob(embeddedIcons, "static/icons/*.svg")
+	for _, icon := range icons {
+		data, err := embeddedIcons.ReadFile(icon)
+		if err == nil {
+			index[icon[len("static/"):]] = NewAsset(data)
+		}
+	}
+	return index
+})
+
+// Lookup returns the embedded asset at name, a path under static/ ("main.css", "icons/google.svg")
+func Lookup(name string) (Asset, bool) {
+	asset, ok := embeddedAssets()[name]
+	return asset, ok
+}
+
+// buildTime is the commit time of the build, if recorded
+var buildTime = sync.OnceValue(func() time.Time {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return time.Time{}
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.time" {
+			if t, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+})
+
+// ModTime returns the modification time of the embedded assets: the commit time of the build,
+// or the zero time when the build did not record it (go run, tests)
+func ModTime() time.Time {
+	return buildTime()
+}
+
+// hashLength is the length of Asset.Hash
+const hashLength = 16
+
+// Fingerprint returns name with hash before the extension ("main.css" → "main.3f2a9c1b7d4e5f60.css")
+func Fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// FingerprintedName returns the fingerprinted name of the embedded asset at name,
+// or name itself when there is no such asset
+func FingerprintedName(name string) string {
+	if asset, ok := Lookup(name); ok {
+		return Fingerprint(name, asset.Hash)
+	}
+	return name
+}
+
+// SplitFingerprint splits a fingerprinted name into the asset name and the hash
+// Returns false when name does not carry a hash
+func SplitFingerprint(name string) (string, string, bool) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	dot := strings.LastIndexByte(base, '.')
+	if ext == "" || dot < 0 {
+		return "", "", false
+	}
+	hash := base[dot+1:]
+	if len(hash) != hashLength {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", "", false
+	}
+	return base[:dot] + ext, hash, true
+}
+
+// ContentType returns the Content-Type of the asset at name, by its extension
+func ContentType(name string) string {
+	switch path.Ext(name) {
+	case ".css":
+		return "text/css; charset=utf-8"
+	case ".js":
+		return "text/javascript; charset=utf-8"
+	case ".svg":
+		return "image/svg+xml"
+	case ".png":
+		return "image/png"
+	case ".ico":
+		return "image/x-icon"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -42,7 +42,13 @@ func (t *EmailTemplate) GenerateLoginEmail(loginURL, otp string, validMinutes in
 	// Get current year for copyright
 	currentYear := time.Now().Year()
 
+	textDirection := hermes.TDLeftToRight
+	if i18n.Direction(lang) == "rtl" {
+		textDirection = hermes.TDRightToLeft
+	}
+
 	h := hermes.Hermes{
+		TextDirection: textDirection,
 		Product: hermes.Product{
 			Name:          t.serviceName,
 			Link:          t.baseURL,
@@ -71,7 +77,7 @@ func (t *EmailTemplate) GenerateLoginEmail(loginURL, otp string, validMinutes in
 				{
 					Instructions: tr("email.login.instructions"),
 					Button: hermes.Button{
-						Color: "#3B82F6", // Primary blue color
+						Color: "#2563EB", // Primary blue color (AA contrast with white text)
 						Text:  tr("email.login.button"),
 						Link:  loginURL,
 					},
@@ -92,8 +98,9 @@ func (t *EmailTemplate) GenerateLoginEmail(loginURL, otp string, validMinutes in
 
 	// Format OTP: split into 4-digit groups
 	// Note: No whitespace between spans to prevent unwanted spaces when copying
+	// The code box is always left-to-right so the groups keep their order in RTL emails
 	otpHTML := fmt.Sprintf(
-		`<div style="text-align: center; margin: 24px 0;"><p style="color: #6b7280; font-size: 14px; margin-bottom: 12px;">%s</p><div style="font-family: 'Courier New', monospace; font-size: 18px; font-weight: 600; letter-spacing: 0.05em; background-color: #f3f4f6; border: 2px solid #d1d5db; border-radius: 8px; padding: 16px; display: inline-block;"><span style="margin: 0 4px;">%s</span><span style="margin: 0 4px;">%s</span><span style="margin: 0 4px;">%s</span></div></div>`,
+		`<div style="text-align: center; margin: 24px 0;"><p style="color: #6b7280; font-size: 14px; margin-bottom: 12px;">%s</p><div dir="ltr" style="font-family: 'Courier New', monospace; font-size: 18px; font-weight: 600; letter-spacing: 0.05em; background-color: #f3f4f6; border: 2px solid #d1d5db; border-radius: 8px; padding: 16px; display: inline-block;"><span style="margin: 0 4px;">%s</span><span style="margin: 0 4px;">%s</span><span style="margin: 0 4px;">%s</span></div></div>`,
 		tr("email.login.otp_label"),
 		otp[0:4], otp[4:8], otp[8:12],
 	)
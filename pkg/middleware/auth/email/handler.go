@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/ratelimit"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
@@ -89,6 +92,20 @@ func NewHandler(
 	}, nil
 }
 
+// SetHTTPClient sets the HTTP client of API-based senders (SendGrid)
+// SMTP and sendmail senders do not use HTTP and are unaffected.
+func (h *Handler) SetHTTPClient(client *http.Client) {
+	if sender, ok := h.sender.(interface{ SetHTTPClient(*http.Client) }); ok {
+		sender.SetHTTPClient(client)
+	}
+}
+
+// SetClock replaces the system clock of token and OTP expiry and of the send rate limit
+func (h *Handler) SetClock(c clock.Clock) {
+	h.tokenStore.SetClock(c)
+	h.limiter.SetClock(c)
+}
+
 // SendLoginLink sends a login link to the specified email address with redirect URL
 func (h *Handler) SendLoginLink(email string, redirectURL string, lang i18n.Language) error {
 	// Check authorization first
@@ -107,14 +124,14 @@ func (h *Handler) SendLoginLink(email string, redirectURL string, lang i18n.Lang
 		duration = 15 * time.Minute // Default
 	}
 
-	// Generate token with redirect URL
-	token, err := h.tokenStore.GenerateToken(email, redirectURL, duration)
+	// Generate token with redirect URL and the language of this email
+	token, err := h.tokenStore.GenerateTokenWithLang(email, redirectURL, string(lang), duration)
 	if err != nil {
 		return fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	// Create login URL
-	loginURL := fmt.Sprintf("%s%s/email/verify?token=%s", h.baseURL, h.authPathPrefix, token)
+	// Create login URL (lang makes the landing page render in the same language as the email)
+	loginURL := fmt.Sprintf("%s%s/email/verify?token=%s&lang=%s", h.baseURL, h.authPathPrefix, token, url.QueryEscape(string(lang)))
 
 	// Get OTP from token for email display
 	ctx := context.Background()
@@ -159,9 +176,36 @@ func (h *Handler) VerifyOTP(otp string) (email string, redirectURL string, error
 	return h.tokenStore.VerifyOTP(otp)
 }
 
-// Cleanup removes expired tokens
-func (h *Handler) Cleanup() {
-	h.tokenStore.CleanupExpired()
+// VerifyTokenWithLang verifies a login token and also returns the language of the login email
+func (h *Handler) VerifyTokenWithLang(token string) (email string, redirectURL string, lang i18n.Language, err error) {
+	email, redirectURL, code, err := h.tokenStore.VerifyTokenWithLang(token)
+	return email, redirectURL, i18n.Language(code), err
+}
+
+// VerifyOTPWithLang verifies an OTP and also returns the language of the login email
+func (h *Handler) VerifyOTPWithLang(otp string) (email string, redirectURL string, lang i18n.Language, err error) {
+	email, redirectURL, code, err := h.tokenStore.VerifyOTPWithLang(otp)
+	return email, redirectURL, i18n.Language(code), err
+}
+
+// Cleanup removes expired tokens and returns the number of deleted keys
+func (h *Handler) Cleanup() (int, error) {
+	return h.tokenStore.CleanupExpired()
+}
+
+// OutstandingTokens lists the unconsumed login links of an email address (all addresses if empty)
+func (h *Handler) OutstandingTokens(ctx context.Context, email string) ([]TokenInfo, error) {
+	return h.tokenStore.Outstanding(ctx, email)
+}
+
+// RevokeTokens invalidates the unconsumed login links and OTPs sent to an email address
+func (h *Handler) RevokeTokens(ctx context.Context, email string) (int, error) {
+	return h.tokenStore.RevokeTokens(ctx, email)
+}
+
+// RevokeToken invalidates one login link (and its OTP) by the ID listed by OutstandingTokens
+func (h *Handler) RevokeToken(ctx context.Context, id string) error {
+	return h.tokenStore.RevokeToken(ctx, id)
 }
 
 // SetSender sets the email sender (for testing)
@@ -146,6 +146,42 @@ func TestHandler_SendLoginLink(t *testing.T) {
 	}
 }
 
+func TestHandler_SendLoginLink_Language(t *testing.T) {
+	cfg := config.EmailAuthConfig{
+		Enabled:    true,
+		SenderType: "smtp",
+		SMTP: config.SMTPConfig{
+			Host: "smtp.example.com",
+			Port: 587,
+			From: "noreply@example.com",
+		},
+	}
+
+	mockSender := &MockSender{}
+	handler, _ := NewHandler(cfg, testServiceConfig(), "http://localhost:4180", "/_auth", &MockAuthzChecker{allowed: true}, testTranslator(), "test-secret", createTestTokenKVS(), createTestEmailQuotaKVS())
+	handler.sender = mockSender
+
+	if err := handler.SendLoginLink("user@example.com", "/", i18n.Japanese); err != nil {
+		t.Fatalf("SendLoginLink() error = %v", err)
+	}
+
+	// The magic link carries the language so the landing page matches the email
+	body := mockSender.HTMLCalls[0].TextBody
+	if !strings.Contains(body, "&lang=ja") {
+		t.Fatalf("login link should contain lang=ja, got %q", body)
+	}
+	tokenStart := strings.Index(body, "token=") + 6
+	token := body[tokenStart : tokenStart+strings.Index(body[tokenStart:], "&")]
+
+	_, _, lang, err := handler.VerifyTokenWithLang(token)
+	if err != nil {
+		t.Fatalf("VerifyTokenWithLang() error = %v", err)
+	}
+	if lang != i18n.Japanese {
+		t.Errorf("VerifyTokenWithLang() lang = %q, want %q", lang, i18n.Japanese)
+	}
+}
+
 func TestHandler_SendLoginLink_NotAuthorized(t *testing.T) {
 	cfg := config.EmailAuthConfig{
 		Enabled:    true,
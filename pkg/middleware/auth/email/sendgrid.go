@@ -1,9 +1,12 @@
 package email
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
@@ -14,6 +17,8 @@ type SendGridSender struct {
 	client   *sendgrid.Client
 	from     string // Email address
 	fromName string // Display name
+
+	httpClient *http.Client // Optional: client of API requests (egress proxy, CA bundle)
 }
 
 // NewSendGridSender creates a new SendGrid email sender
@@ -35,13 +40,28 @@ func NewSendGridSender(cfg config.SendGridConfig, parentEmail, parentName string
 	}
 }
 
+// SetHTTPClient sets the HTTP client used to call the SendGrid API
+func (s *SendGridSender) SetHTTPClient(client *http.Client) {
+	s.httpClient = client
+}
+
+// send posts a message with the configured HTTP client, or the SendGrid default client
+func (s *SendGridSender) send(message *mail.SGMailV3) (*rest.Response, error) {
+	if s.httpClient == nil {
+		return s.client.Send(message)
+	}
+	request := s.client.Request
+	request.Body = mail.GetRequestBody(message)
+	return (&rest.Client{HTTPClient: s.httpClient}).SendWithContext(context.Background(), request)
+}
+
 // Send sends an email via SendGrid API
 func (s *SendGridSender) Send(to, subject, body string) error {
 	from := mail.NewEmail(s.fromName, s.from)
 	toEmail := mail.NewEmail("", to)
 	message := mail.NewSingleEmail(from, subject, toEmail, body, body)
 
-	response, err := s.client.Send(message)
+	response, err := s.send(message)
 	if err != nil {
 		return fmt.Errorf("failed to send email via SendGrid: %w", err)
 	}
@@ -60,7 +80,7 @@ func (s *SendGridSender) SendHTML(to, subject, htmlBody, textBody string) error
 	toEmail := mail.NewEmail("", to)
 	message := mail.NewSingleEmail(from, subject, toEmail, textBody, htmlBody)
 
-	response, err := s.client.Send(message)
+	response, err := s.send(message)
 	if err != nil {
 		return fmt.Errorf("failed to send HTML email via SendGrid: %w", err)
 	}
@@ -241,3 +241,40 @@ func hasSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+// TestSendGridSender_HTTPClient tests that API requests use the configured HTTP client
+func TestSendGridSender_HTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var requests int
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	sender := NewSendGridSender(config.SendGridConfig{APIKey: "test-api-key", EndpointURL: server.URL, From: "test@example.com"}, "", "")
+	sender.SetHTTPClient(client)
+
+	if err := sender.Send("recipient@example.com", "Subject", "Body"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := sender.SendHTML("recipient@example.com", "Subject", "<p>Body</p>", "Body"); err != nil {
+		t.Fatalf("SendHTML() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Requests through the client = %d, want 2", requests)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -6,11 +6,15 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
@@ -31,6 +35,7 @@ type Token struct {
 	Email       string
 	OTP         string // One-Time Password (12-character alphanumeric)
 	RedirectURL string // Original URL to redirect to after authentication
+	Lang        string // Language the login email was sent in
 	CreatedAt   time.Time
 	ExpiresAt   time.Time
 	Used        bool
@@ -38,16 +43,22 @@ type Token struct {
 
 // IsValid checks if the token is still valid
 func (t *Token) IsValid() bool {
+	return t.IsValidAt(time.Now())
+}
+
+// IsValidAt checks if the token is valid at the given time
+func (t *Token) IsValidAt(now time.Time) bool {
 	if t.Used {
 		return false
 	}
-	return time.Now().Before(t.ExpiresAt)
+	return now.Before(t.ExpiresAt)
 }
 
 // TokenStore manages email authentication tokens using a KVS backend
 type TokenStore struct {
 	kvs    kvs.Store
 	secret []byte
+	clock  clock.Clock // Time of token creation and expiry checks
 }
 
 // generateOTP generates a random 12-character OTP using uppercase letters and digits
@@ -74,11 +85,23 @@ func NewTokenStore(secret string, kvsStore kvs.Store) *TokenStore {
 	return &TokenStore{
 		kvs:    kvsStore,
 		secret: []byte(secret),
+		clock:  clock.Real,
 	}
 }
 
+// SetClock replaces the system clock, e.g. with a clock.Fake in tests
+// Tokens and OTPs expire by this clock; the KVS still drops them after their TTL in real time.
+func (s *TokenStore) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+}
+
 // GenerateToken generates a new token for an email address with redirect URL
 func (s *TokenStore) GenerateToken(email string, redirectURL string, duration time.Duration) (string, error) {
+	return s.GenerateTokenWithLang(email, redirectURL, "", duration)
+}
+
+// GenerateTokenWithLang generates a new token that also remembers the language of the login email
+func (s *TokenStore) GenerateTokenWithLang(email string, redirectURL string, lang string, duration time.Duration) (string, error) {
 	// Generate OTP
 	otp, err := generateOTP()
 	if err != nil {
@@ -101,13 +124,15 @@ func (s *TokenStore) GenerateToken(email string, redirectURL string, duration ti
 	tokenValue := base64.URLEncoding.EncodeToString(tokenBytes)
 
 	// Create token
+	now := s.clock.Now()
 	token := &Token{
 		Value:       tokenValue,
 		Email:       email,
 		OTP:         otp,
 		RedirectURL: redirectURL,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(duration),
+		Lang:        lang,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(duration),
 		Used:        false,
 	}
 
@@ -135,43 +160,50 @@ func (s *TokenStore) GenerateToken(email string, redirectURL string, duration ti
 
 // VerifyToken verifies a token and returns the associated email and redirect URL
 func (s *TokenStore) VerifyToken(tokenValue string) (email string, redirectURL string, err error) {
+	email, redirectURL, _, err = s.VerifyTokenWithLang(tokenValue)
+	return email, redirectURL, err
+}
+
+// VerifyTokenWithLang verifies a token and also returns the language the login email was sent in
+func (s *TokenStore) VerifyTokenWithLang(tokenValue string) (email string, redirectURL string, lang string, err error) {
 	ctx := context.Background()
 
 	// Get token from KVS
 	data, err := s.kvs.Get(ctx, tokenValue)
 	if err != nil {
 		if errors.Is(err, kvs.ErrNotFound) {
-			return "", "", ErrTokenNotFound
+			return "", "", "", ErrTokenNotFound
 		}
-		return "", "", fmt.Errorf("failed to get token: %w", err)
+		return "", "", "", fmt.Errorf("failed to get token: %w", err)
 	}
 
 	var token Token
 	if err := json.Unmarshal(data, &token); err != nil {
-		return "", "", fmt.Errorf("failed to unmarshal token: %w", err)
+		return "", "", "", fmt.Errorf("failed to unmarshal token: %w", err)
 	}
 
 	if token.Used {
-		return "", "", ErrTokenAlreadyUsed
+		return "", "", "", ErrTokenAlreadyUsed
 	}
 
-	if time.Now().After(token.ExpiresAt) {
-		return "", "", ErrTokenExpired
+	now := s.clock.Now()
+	if now.After(token.ExpiresAt) {
+		return "", "", "", ErrTokenExpired
 	}
 
 	// Mark as used and update in KVS
 	token.Used = true
 	updatedData, err := json.Marshal(token)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal updated token: %w", err)
+		return "", "", "", fmt.Errorf("failed to marshal updated token: %w", err)
 	}
 
-	ttl := time.Until(token.ExpiresAt)
+	ttl := token.ExpiresAt.Sub(now)
 	if err := s.kvs.Set(ctx, tokenValue, updatedData, ttl); err != nil {
-		return "", "", fmt.Errorf("failed to update token: %w", err)
+		return "", "", "", fmt.Errorf("failed to update token: %w", err)
 	}
 
-	return token.Email, token.RedirectURL, nil
+	return token.Email, token.RedirectURL, token.Lang, nil
 }
 
 // normalizeOTP removes non-alphanumeric characters and takes first 12 characters
@@ -195,11 +227,17 @@ func normalizeOTP(input string) string {
 
 // VerifyOTP verifies an OTP and returns the associated email and redirect URL
 func (s *TokenStore) VerifyOTP(otpInput string) (email string, redirectURL string, err error) {
+	email, redirectURL, _, err = s.VerifyOTPWithLang(otpInput)
+	return email, redirectURL, err
+}
+
+// VerifyOTPWithLang verifies an OTP and also returns the language the login email was sent in
+func (s *TokenStore) VerifyOTPWithLang(otpInput string) (email string, redirectURL string, lang string, err error) {
 	// Normalize the input OTP
 	normalizedOTP := normalizeOTP(otpInput)
 
 	if len(normalizedOTP) != 12 {
-		return "", "", ErrTokenNotFound
+		return "", "", "", ErrTokenNotFound
 	}
 
 	ctx := context.Background()
@@ -211,15 +249,15 @@ func (s *TokenStore) VerifyOTP(otpInput string) (email string, redirectURL strin
 	tokenValueBytes, err := s.kvs.Get(ctx, otpKey)
 	if err != nil {
 		if errors.Is(err, kvs.ErrNotFound) {
-			return "", "", ErrTokenNotFound
+			return "", "", "", ErrTokenNotFound
 		}
-		return "", "", fmt.Errorf("failed to get token by OTP: %w", err)
+		return "", "", "", fmt.Errorf("failed to get token by OTP: %w", err)
 	}
 
 	tokenValue := string(tokenValueBytes)
 
 	// Now verify the actual token
-	return s.VerifyToken(tokenValue)
+	return s.VerifyTokenWithLang(tokenValue)
 }
 
 // DeleteToken removes a token from the store
@@ -239,10 +277,148 @@ func (s *TokenStore) DeleteToken(tokenValue string) {
 	_ = s.kvs.Delete(ctx, tokenValue) // Ignore errors for compatibility
 }
 
-// CleanupExpired removes expired tokens (no-op for KVS with TTL support)
-// The underlying KVS automatically handles expiration, so this is a no-op for compatibility.
-func (s *TokenStore) CleanupExpired() {
-	// No-op: KVS implementations with TTL support handle cleanup automatically
+// TokenInfo describes an outstanding login link for audits; it holds neither the token nor the OTP
+type TokenInfo struct {
+	ID          string    `json:"id"` // Stable identifier of the token, for RevokeToken
+	Email       string    `json:"email"`
+	RedirectURL string    `json:"redirect_url,omitempty"`
+	Lang        string    `json:"lang,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// tokenID derives the audit identifier of a token value, which cannot be turned back into the token
+func tokenID(tokenValue string) string {
+	sum := sha256.Sum256([]byte(tokenValue))
+	return hex.EncodeToString(sum[:8])
+}
+
+// isOTPKey reports whether a key of the token KVS is an OTP-to-token mapping
+func isOTPKey(key string) bool {
+	return strings.HasPrefix(key, "otp:")
+}
+
+// forEachToken calls fn with the key and decoded token of every token of the store
+func (s *TokenStore) forEachToken(ctx context.Context, fn func(key string, token *Token) error) error {
+	keys, err := s.kvs.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %w", err)
+	}
+	for _, key := range keys {
+		if isOTPKey(key) {
+			continue
+		}
+		data, err := s.kvs.Get(ctx, key)
+		if errors.Is(err, kvs.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		var token Token
+		if err := json.Unmarshal(data, &token); err != nil {
+			continue
+		}
+		if err := fn(key, &token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outstanding lists the unconsumed, unexpired tokens of an email address (all addresses if empty),
+// oldest first. The address is compared case-insensitively.
+func (s *TokenStore) Outstanding(ctx context.Context, email string) ([]TokenInfo, error) {
+	now := s.clock.Now()
+	infos := []TokenInfo{}
+	err := s.forEachToken(ctx, func(key string, token *Token) error {
+		if !token.IsValidAt(now) || (email != "" && !strings.EqualFold(token.Email, email)) {
+			return nil
+		}
+		infos = append(infos, TokenInfo{
+			ID:          tokenID(key),
+			Email:       token.Email,
+			RedirectURL: token.RedirectURL,
+			Lang:        token.Lang,
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+		})
+		return nil
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	return infos, err
+}
+
+// RevokeTokens deletes the unconsumed tokens of an email address, with their OTPs, so that the
+// login links and codes sent to it no longer work. Returns the number of revoked tokens.
+func (s *TokenStore) RevokeTokens(ctx context.Context, email string) (int, error) {
+	return s.revoke(ctx, func(key string, token *Token) bool {
+		return strings.EqualFold(token.Email, email)
+	})
+}
+
+// RevokeToken deletes the token with the ID listed by Outstanding, with its OTP
+// Returns ErrTokenNotFound if no unconsumed token has the ID.
+func (s *TokenStore) RevokeToken(ctx context.Context, id string) error {
+	revoked, err := s.revoke(ctx, func(key string, token *Token) bool {
+		return tokenID(key) == id
+	})
+	if err == nil && revoked == 0 {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// revoke deletes the unconsumed, unexpired tokens matching match
+func (s *TokenStore) revoke(ctx context.Context, match func(key string, token *Token) bool) (int, error) {
+	now := s.clock.Now()
+	revoked := 0
+	err := s.forEachToken(ctx, func(key string, token *Token) error {
+		if !token.IsValidAt(now) || !match(key, token) {
+			return nil
+		}
+		s.DeleteToken(key)
+		revoked++
+		return nil
+	})
+	return revoked, err
+}
+
+// CleanupExpired removes the tokens expired by the store's clock, and OTP mappings left without a token
+// KVS backends with TTL drop tokens by themselves; this catches the ones they keep until read (LevelDB).
+// Used tokens are kept until they expire, so reusing a login link reports it as used.
+// Returns the number of deleted keys.
+func (s *TokenStore) CleanupExpired() (int, error) {
+	ctx := context.Background()
+	now := s.clock.Now()
+	deleted := 0
+
+	err := s.forEachToken(ctx, func(key string, token *Token) error {
+		if now.Before(token.ExpiresAt) {
+			return nil
+		}
+		s.DeleteToken(key)
+		deleted++
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	keys, err := s.kvs.List(ctx, "otp:")
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list OTPs: %w", err)
+	}
+	for _, key := range keys {
+		tokenValue, err := s.kvs.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		if exists, err := s.kvs.Exists(ctx, string(tokenValue)); err == nil && !exists {
+			_ = s.kvs.Delete(ctx, key)
+			deleted++
+		}
+	}
+	return deleted, nil
 }
 
 // Count returns the number of tokens (for testing)
@@ -1,9 +1,13 @@
 package email
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
@@ -114,6 +118,45 @@ func TestTokenStore_VerifyToken(t *testing.T) {
 	}
 }
 
+func TestTokenStore_VerifyWithLang(t *testing.T) {
+	store := createTestTokenStore("test-secret")
+
+	token, err := store.GenerateTokenWithLang("user@example.com", "/", "ja", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateTokenWithLang() error = %v", err)
+	}
+
+	_, _, lang, err := store.VerifyTokenWithLang(token)
+	if err != nil {
+		t.Fatalf("VerifyTokenWithLang() error = %v", err)
+	}
+	if lang != "ja" {
+		t.Errorf("VerifyTokenWithLang() lang = %q, want %q", lang, "ja")
+	}
+
+	// The OTP resolves to the same token and language
+	token, err = store.GenerateTokenWithLang("user@example.com", "/", "ja", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateTokenWithLang() error = %v", err)
+	}
+	data, err := store.kvs.Get(context.Background(), token)
+	if err != nil {
+		t.Fatalf("failed to read token: %v", err)
+	}
+	var tokenObj Token
+	if err := json.Unmarshal(data, &tokenObj); err != nil {
+		t.Fatalf("failed to unmarshal token: %v", err)
+	}
+
+	_, _, lang, err = store.VerifyOTPWithLang(tokenObj.OTP)
+	if err != nil {
+		t.Fatalf("VerifyOTPWithLang() error = %v", err)
+	}
+	if lang != "ja" {
+		t.Errorf("VerifyOTPWithLang() lang = %q, want %q", lang, "ja")
+	}
+}
+
 func TestTokenStore_VerifyToken_NotFound(t *testing.T) {
 	store := createTestTokenStore("test-secret")
 
@@ -142,6 +185,39 @@ func TestTokenStore_VerifyToken_Expired(t *testing.T) {
 	}
 }
 
+func TestTokenStore_ExpiredByClock(t *testing.T) {
+	store := createTestTokenStore("test-secret")
+	fake := clock.NewFake(time.Now())
+	store.SetClock(fake)
+
+	tokenValue, err := store.GenerateToken("user@example.com", "/", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	data, _ := store.kvs.Get(context.Background(), tokenValue)
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		t.Fatalf("failed to unmarshal token: %v", err)
+	}
+	if !token.ExpiresAt.Equal(fake.Now().Add(15 * time.Minute)) {
+		t.Errorf("ExpiresAt = %v, want 15 minutes after the fake clock", token.ExpiresAt)
+	}
+
+	// The OTP resolves to the same token and expires with it
+	fake.Advance(16 * time.Minute)
+	if _, _, err := store.VerifyOTP(token.OTP); err != ErrTokenExpired {
+		t.Errorf("VerifyOTP() error = %v, want ErrTokenExpired", err)
+	}
+	if _, _, err := store.VerifyToken(tokenValue); err != ErrTokenExpired {
+		t.Errorf("VerifyToken() error = %v, want ErrTokenExpired", err)
+	}
+
+	fake.Advance(-2 * time.Minute)
+	if _, _, err := store.VerifyOTP(token.OTP); err != nil {
+		t.Errorf("VerifyOTP() before expiry error = %v", err)
+	}
+}
+
 func TestTokenStore_DeleteToken(t *testing.T) {
 	store := createTestTokenStore("test-secret")
 
@@ -209,3 +285,85 @@ func TestTokenStore_MultipleTokens(t *testing.T) {
 		t.Errorf("token2 verification failed: email=%s, redirect=%s, err=%v", email2, redirectURL2, err)
 	}
 }
+
+func TestTokenStore_OutstandingAndRevoke(t *testing.T) {
+	store := createTestTokenStore("test-secret")
+	ctx := context.Background()
+
+	first, err := store.GenerateToken("alice@example.com", "/first", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if _, err := store.GenerateToken("Alice@Example.com", "/second", 15*time.Minute); err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if _, err := store.GenerateToken("bob@example.com", "/", 15*time.Minute); err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	used, err := store.GenerateToken("alice@example.com", "/used", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if _, _, err := store.VerifyToken(used); err != nil {
+		t.Fatalf("VerifyToken() error = %v", err)
+	}
+
+	infos, err := store.Outstanding(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Outstanding() error = %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("Outstanding() = %d tokens, want the 2 unconsumed ones of alice", len(infos))
+	}
+	for _, info := range infos {
+		if info.ID == "" || info.ID == first || strings.Contains(first, info.ID) {
+			t.Errorf("Token ID %q should identify the token without revealing it", info.ID)
+		}
+	}
+	if all, _ := store.Outstanding(ctx, ""); len(all) != 3 {
+		t.Errorf("Outstanding(\"\") = %d tokens, want 3", len(all))
+	}
+
+	// Revoke one link by ID: the token and its OTP stop working
+	firstID := tokenID(first)
+	if err := store.RevokeToken(ctx, firstID); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, _, err := store.VerifyToken(first); err != ErrTokenNotFound {
+		t.Errorf("VerifyToken() after revoke error = %v, want %v", err, ErrTokenNotFound)
+	}
+	if err := store.RevokeToken(ctx, firstID); err != ErrTokenNotFound {
+		t.Errorf("RevokeToken() twice error = %v, want %v", err, ErrTokenNotFound)
+	}
+
+	revoked, err := store.RevokeTokens(ctx, "ALICE@example.com")
+	if err != nil || revoked != 1 {
+		t.Errorf("RevokeTokens() = %d, %v, want 1 token", revoked, err)
+	}
+	if infos, _ := store.Outstanding(ctx, ""); len(infos) != 1 || infos[0].Email != "bob@example.com" {
+		t.Errorf("Outstanding() after revoke = %+v, want only bob's token", infos)
+	}
+}
+
+func TestTokenStore_CleanupExpiredByClock(t *testing.T) {
+	store := createTestTokenStore("test-secret")
+	fake := clock.NewFake(time.Now())
+	store.SetClock(fake)
+
+	if _, err := store.GenerateToken("alice@example.com", "/", 15*time.Minute); err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if _, err := store.GenerateToken("bob@example.com", "/", time.Hour); err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	// Expired by the store's clock, but still in the KVS
+	fake.Advance(30 * time.Minute)
+	deleted, err := store.CleanupExpired()
+	if err != nil {
+		t.Fatalf("CleanupExpired() error = %v", err)
+	}
+	if deleted != 1 || store.Count() != 2 {
+		t.Errorf("CleanupExpired() deleted %d, %d entries left; want 1 token deleted with its OTP", deleted, store.Count())
+	}
+}
@@ -0,0 +1,272 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Client authentication methods for the token endpoint (besides client_secret)
+const (
+	ClientAuthPrivateKeyJWT = "private_key_jwt" // RFC 7523 client assertion signed with the client's private key
+	ClientAuthTLS           = "tls_client_auth" // RFC 8705 mutual TLS with the client's certificate
+)
+
+// clientAssertionType is the client_assertion_type of private_key_jwt
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long a client assertion is valid
+const clientAssertionLifetime = 5 * time.Minute
+
+// ErrClientKeyInvalid is returned when client authentication key material cannot be parsed
+var ErrClientKeyInvalid = errors.New("invalid client authentication key")
+
+// ClientAuth authenticates a client to the token endpoint without a client secret
+type ClientAuth struct {
+	method string
+	signer *JWTSigner       // Signs client assertions (private_key_jwt)
+	cert   *tls.Certificate // Client certificate (tls_client_auth)
+
+	thumbprints map[string]string // Optional "x5t" and "x5t#S256" headers of client assertions
+}
+
+// NewPrivateKeyJWTAuth creates private_key_jwt client authentication from a PEM private key
+// RSA (RS256), ECDSA P-256 (ES256) and Ed25519 (EdDSA) keys are supported; keyID is sent as "kid" when not empty.
+// With the key's certificate (optional), its thumbprints are sent as "x5t" and "x5t#S256", as Microsoft Entra requires.
+func NewPrivateKeyJWTAuth(keyPEM, certPEM []byte, keyID string) (*ClientAuth, error) {
+	signer, err := NewJWTSigner(keyPEM, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrClientKeyInvalid, err)
+	}
+
+	var thumbprints map[string]string
+	if len(certPEM) > 0 {
+		block, _ := pem.Decode(certPEM)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%w: no PEM certificate found", ErrClientKeyInvalid)
+		}
+		sha1Sum := sha1.Sum(block.Bytes)
+		sha256Sum := sha256.Sum256(block.Bytes)
+		thumbprints = map[string]string{
+			"x5t":      base64.RawURLEncoding.EncodeToString(sha1Sum[:]),
+			"x5t#S256": base64.RawURLEncoding.EncodeToString(sha256Sum[:]),
+		}
+	}
+
+	return &ClientAuth{method: ClientAuthPrivateKeyJWT, signer: signer, thumbprints: thumbprints}, nil
+}
+
+// NewTLSClientAuth creates tls_client_auth client authentication from a PEM certificate (chain) and private key
+func NewTLSClientAuth(certPEM, keyPEM []byte) (*ClientAuth, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClientKeyInvalid, err)
+	}
+	return &ClientAuth{method: ClientAuthTLS, cert: &cert}, nil
+}
+
+// Method returns the client authentication method (ClientAuthPrivateKeyJWT or ClientAuthTLS)
+func (a *ClientAuth) Method() string {
+	return a.method
+}
+
+// ClientAuthenticator is implemented by providers configured with ClientAuth
+type ClientAuthenticator interface {
+	ClientAuth() *ClientAuth
+}
+
+// clientAuthSetting is embedded in providers to hold their ClientAuth
+type clientAuthSetting struct {
+	clientAuth *ClientAuth
+}
+
+// SetClientAuth replaces the client secret with private_key_jwt or mutual TLS at the token endpoint
+func (s *clientAuthSetting) SetClientAuth(auth *ClientAuth) {
+	s.clientAuth = auth
+}
+
+// ClientAuth returns the client authentication, or nil when the client secret is used
+func (s *clientAuthSetting) ClientAuth() *ClientAuth {
+	return s.clientAuth
+}
+
+// clientAuthOf returns the ClientAuth of a provider, or nil
+func clientAuthOf(provider Provider) *ClientAuth {
+	if p, ok := provider.(ClientAuthenticator); ok {
+		return p.ClientAuth()
+	}
+	return nil
+}
+
+// exchangeCode exchanges an authorization code with the provider's client authentication
+func exchangeCode(ctx context.Context, provider Provider, config *oauth2.Config, code string) (*oauth2.Token, error) {
+	auth := clientAuthOf(provider)
+	if auth == nil {
+		return config.Exchange(ctx, code)
+	}
+
+	// The client is identified by client_id in the form, never by a secret
+	config.ClientSecret = ""
+	config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+
+	params, err := auth.tokenParams(config.ClientID, config.Endpoint.TokenURL)
+	if err != nil {
+		return nil, err
+	}
+	var opts []oauth2.AuthCodeOption
+	for key := range params {
+		opts = append(opts, oauth2.SetAuthURLParam(key, params.Get(key)))
+	}
+	return config.Exchange(auth.clientContext(ctx), code, opts...)
+}
+
+// refreshToken obtains a new token with a refresh token and the provider's client authentication
+// The refresh token is kept when the provider does not issue a new one.
+func refreshToken(ctx context.Context, provider Provider, config *oauth2.Config, refresh string) (*oauth2.Token, error) {
+	auth := clientAuthOf(provider)
+	if auth == nil {
+		return config.TokenSource(ctx, &oauth2.Token{RefreshToken: refresh}).Token()
+	}
+
+	config.ClientSecret = ""
+	config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	ctx = auth.clientContext(ctx)
+	if auth.method != ClientAuthPrivateKeyJWT {
+		return config.TokenSource(ctx, &oauth2.Token{RefreshToken: refresh}).Token()
+	}
+
+	// The library sends no extra parameters with refresh requests: post the client assertion ourselves
+	params, err := auth.tokenParams(config.ClientID, config.Endpoint.TokenURL)
+	if err != nil {
+		return nil, err
+	}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", refresh)
+	params.Set("client_id", config.ClientID)
+	return postTokenRequest(ctx, config.Endpoint.TokenURL, params, refresh)
+}
+
+// postTokenRequest posts a token request and parses the JSON token response (RFC 6749 section 5)
+// Error responses are returned as *oauth2.RetrieveError, like the library does.
+func postTokenRequest(ctx context.Context, tokenURL string, params url.Values, refresh string) (*oauth2.Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Error        string `json:"error"`
+		Description  string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &data)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || data.AccessToken == "" {
+		return nil, &oauth2.RetrieveError{Response: resp, Body: body, ErrorCode: data.Error, ErrorDescription: data.Description}
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  data.AccessToken,
+		TokenType:    data.TokenType,
+		RefreshToken: data.RefreshToken,
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refresh
+	}
+	if data.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(data.ExpiresIn) * time.Second)
+	}
+	var extra map[string]interface{}
+	_ = json.Unmarshal(body, &extra)
+	return token.WithExtra(extra), nil
+}
+
+// tokenParams returns the token request parameters that authenticate the client
+// private_key_jwt adds a fresh client assertion; tls_client_auth needs no parameters
+func (a *ClientAuth) tokenParams(clientID, tokenURL string) (url.Values, error) {
+	if a.method != ClientAuthPrivateKeyJWT {
+		return url.Values{}, nil
+	}
+	assertion, err := a.clientAssertion(clientID, tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}, nil
+}
+
+// clientContext returns ctx with an HTTP client presenting the client certificate (tls_client_auth)
+// The transport of the client already set in ctx is reused, so proxies and CA settings are kept
+func (a *ClientAuth) clientContext(ctx context.Context) context.Context {
+	if a.cert == nil {
+		return ctx
+	}
+
+	base := contextClient(ctx)
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{*a.cert}
+
+	client := *base
+	client.Transport = transport
+	return context.WithValue(ctx, oauth2.HTTPClient, &client)
+}
+
+// clientAssertion returns a signed JWT identifying the client to the token endpoint (RFC 7523 section 3)
+func (a *ClientAuth) clientAssertion(clientID, tokenURL string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": clientID,
+		"sub": clientID,
+		"aud": tokenURL,
+		"jti": hex.EncodeToString(jti),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	}
+
+	assertion, err := a.signer.Sign(claims, a.thumbprints)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return assertion, nil
+}
@@ -0,0 +1,306 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	oauth2lib "golang.org/x/oauth2"
+)
+
+// testKeyPEM encodes a private key as PKCS #8 PEM
+func testKeyPEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// testCertPEM creates a self-signed certificate for key
+func testCertPEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chatbotgate-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// verifyAssertion checks the signature and claims of a client assertion
+func verifyAssertion(t *testing.T, assertion string, public crypto.PublicKey, clientID, audience string) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Assertion has %d parts, want 3", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Invalid signature encoding: %v", err)
+	}
+	input := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(input)
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			err = errors.New("invalid ECDSA signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, input, signature) {
+			err = errors.New("invalid Ed25519 signature")
+		}
+	}
+	if err != nil {
+		t.Fatalf("Signature verification failed: %v", err)
+	}
+
+	header := make(map[string]interface{})
+	claims := make(map[string]interface{})
+	for i, v := range []interface{}{&header, &claims} {
+		data, _ := base64.RawURLEncoding.DecodeString(parts[i])
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("Invalid assertion JSON: %v", err)
+		}
+	}
+	if claims["iss"] != clientID || claims["sub"] != clientID || claims["aud"] != audience || claims["jti"] == "" {
+		t.Errorf("Claims = %v, want iss/sub %s and aud %s", claims, clientID, audience)
+	}
+	return header
+}
+
+func TestExchange_PrivateKeyJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		wantAlg string
+	}{
+		{"RSA", rsaKey, "RS256"},
+		{"ECDSA", ecKey, "ES256"},
+		{"Ed25519", edKey, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var serverURL string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("ParseForm() error = %v", err)
+					return
+				}
+				if r.PostForm.Get("client_secret") != "" {
+					t.Error("client_secret was sent")
+				}
+				if _, _, ok := r.BasicAuth(); ok {
+					t.Error("Basic auth was sent")
+				}
+				if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_assertion_type") != clientAssertionType {
+					t.Errorf("Form = %v", r.PostForm)
+				}
+				header := verifyAssertion(t, r.PostForm.Get("client_assertion"), tt.key.Public(), "client", serverURL+"/token")
+				if header["alg"] != tt.wantAlg || header["kid"] != "key-1" {
+					t.Errorf("Header = %v, want alg %s and kid key-1", header, tt.wantAlg)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+			}))
+			defer server.Close()
+			serverURL = server.URL
+
+			auth, err := NewPrivateKeyJWTAuth(testKeyPEM(t, tt.key), nil, "key-1")
+			if err != nil {
+				t.Fatalf("NewPrivateKeyJWTAuth() error = %v", err)
+			}
+			provider := NewCustomProvider("idp", "client", "unused-secret", "https://chat.example.com/_auth/oauth2/callback",
+				server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", nil, false)
+			provider.SetClientAuth(auth)
+
+			manager := NewManager()
+			manager.AddProvider(provider)
+			token, err := manager.ExchangeWithRedirect(context.Background(), "idp", "code", "https://chat.example.com/_auth/oauth2/callback")
+			if err != nil {
+				t.Fatalf("ExchangeWithRedirect() error = %v", err)
+			}
+			if token.AccessToken != "token" {
+				t.Errorf("AccessToken = %s, want token", token.AccessToken)
+			}
+			if provider.Config().ClientSecret != "unused-secret" {
+				t.Error("Exchange modified the provider config")
+			}
+		})
+	}
+}
+
+func TestRefreshToken_PrivateKeyJWT(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+			return
+		}
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("client_secret") != "" {
+			t.Errorf("Form = %v", r.PostForm)
+		}
+		verifyAssertion(t, r.PostForm.Get("client_assertion"), ecKey.Public(), "client", serverURL+"/token")
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"new-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	auth, err := NewPrivateKeyJWTAuth(testKeyPEM(t, ecKey), nil, "")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyJWTAuth() error = %v", err)
+	}
+	provider := NewCustomProvider("idp", "client", "unused-secret", "https://chat.example.com/_auth/oauth2/callback",
+		server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", nil, false)
+	provider.SetClientAuth(auth)
+	manager := NewManager()
+	manager.AddProvider(provider)
+
+	token, err := manager.RefreshToken(context.Background(), "idp", &oauth2lib.Token{AccessToken: "old", RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if token.AccessToken != "new-token" || token.RefreshToken != "refresh" || time.Until(token.Expiry) < 59*time.Minute {
+		t.Errorf("Token = %+v, want new-token, the refresh token kept and an expiry in an hour", token)
+	}
+
+	// Rejected refresh tokens are reported like the library does
+	_, err = manager.RefreshToken(context.Background(), "idp", &oauth2lib.Token{RefreshToken: "revoked"})
+	var retrieveErr *oauth2lib.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != "invalid_grant" {
+		t.Errorf("RefreshToken() error = %v, want invalid_grant", err)
+	}
+}
+
+func TestNewPrivateKeyJWTAuth_Thumbprint(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	certPEM := testCertPEM(t, key)
+
+	auth, err := NewPrivateKeyJWTAuth(testKeyPEM(t, key), certPEM, "")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyJWTAuth() error = %v", err)
+	}
+	assertion, err := auth.clientAssertion("client", "https://login.example.com/token")
+	if err != nil {
+		t.Fatalf("clientAssertion() error = %v", err)
+	}
+
+	header := verifyAssertion(t, assertion, key.Public(), "client", "https://login.example.com/token")
+	block, _ := pem.Decode(certPEM)
+	sum := sha256.Sum256(block.Bytes)
+	if header["x5t#S256"] != base64.RawURLEncoding.EncodeToString(sum[:]) || header["x5t"] == nil {
+		t.Errorf("Header = %v, want certificate thumbprints", header)
+	}
+	if _, ok := header["kid"]; ok {
+		t.Error("kid is set without a key ID")
+	}
+}
+
+func TestNewPrivateKeyJWTAuth_InvalidKey(t *testing.T) {
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name   string
+		keyPEM []byte
+	}{
+		{"not PEM", []byte("not a key")},
+		{"certificate instead of key", testCertPEM(t, p384)},
+		{"unsupported curve", testKeyPEM(t, p384)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPrivateKeyJWTAuth(tt.keyPEM, nil, ""); !errors.Is(err, ErrClientKeyInvalid) {
+				t.Errorf("NewPrivateKeyJWTAuth() error = %v, want ErrClientKeyInvalid", err)
+			}
+		})
+	}
+}
+
+func TestExchange_TLSClientAuth(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certPEM := testCertPEM(t, key)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) != 1 || r.TLS.PeerCertificates[0].Subject.CommonName != "chatbotgate-client" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "" {
+			t.Errorf("Form = %v", r.PostForm)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	auth, err := NewTLSClientAuth(certPEM, testKeyPEM(t, key))
+	if err != nil {
+		t.Fatalf("NewTLSClientAuth() error = %v", err)
+	}
+	provider := NewCustomProvider("idp", "client", "", "https://chat.example.com/_auth/oauth2/callback",
+		server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", nil, false)
+	provider.SetClientAuth(auth)
+
+	manager := NewManager()
+	manager.AddProvider(provider)
+
+	// The test server's client trusts its certificate; the client certificate is added to its transport
+	ctx := context.WithValue(context.Background(), oauth2lib.HTTPClient, server.Client())
+	token, err := manager.Exchange(ctx, "idp", "code")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if token.AccessToken != "token" {
+		t.Errorf("AccessToken = %s, want token", token.AccessToken)
+	}
+
+	// Without the certificate the server rejects the client
+	provider.SetClientAuth(nil)
+	if _, err := manager.Exchange(ctx, "idp", "code"); err == nil {
+		t.Error("Exchange() without client certificate succeeded")
+	}
+}
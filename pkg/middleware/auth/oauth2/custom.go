@@ -4,18 +4,48 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
+const (
+	// discoveryTimeout bounds a single fetch of the discovery document
+	discoveryTimeout = 10 * time.Second
+
+	// discoveryRetryInterval is the delay before fetching the discovery document again after a failure
+	discoveryRetryInterval = time.Minute
+)
+
 // CustomProvider is a generic OAuth2 provider for custom/OIDC-compatible servers
 type CustomProvider struct {
 	name               string
-	config             *oauth2.Config
-	userInfoURL        string
 	insecureSkipVerify bool
+	clientAuthSetting               // Optional: private_key_jwt or mutual TLS instead of the client secret
+	httpClient         *http.Client // Optional: client of background discovery refreshes (egress proxy, CA bundle)
+
+	// OpenID Connect discovery (SetIssuer); endpoints set in the constructor take precedence
+	issuerURL        string
+	discoveryRefresh time.Duration
+	baseConfig       *oauth2.Config // Config as constructed, before discovered endpoints are applied
+	baseUserInfoURL  string
+	baseJWKSURL      string // Set with SetJWKSURL, taking precedence over the discovered one
+	refreshing       atomic.Bool
+
+	mu            sync.RWMutex
+	config        *oauth2.Config // Replaced (never modified) when discovered endpoints change
+	userInfoURL   string
+	jwksURL       string
+	discovered    bool
+	nextDiscovery time.Time
+
+	jwks jwksCache // Keys verifying back-channel logout tokens
 }
 
 // NewCustomProvider creates a new custom OAuth2 provider
@@ -52,31 +82,161 @@ func NewCustomProvider(
 	}
 }
 
+// SetIssuer enables OpenID Connect discovery from {issuerURL}/.well-known/openid-configuration
+// Endpoints left empty in the constructor are taken from the document, which is fetched again
+// every refresh interval. Call Discover to fetch it before the first sign-in.
+func (p *CustomProvider) SetIssuer(issuerURL string, refresh time.Duration) {
+	p.issuerURL = issuerURL
+	p.discoveryRefresh = refresh
+	p.baseConfig = p.config
+	p.baseUserInfoURL = p.userInfoURL
+}
+
+// SetHTTPClient sets the HTTP client used when the request context carries none (e.g., background discovery)
+func (p *CustomProvider) SetHTTPClient(client *http.Client) {
+	p.httpClient = client
+}
+
+// Discover fetches the discovery document and applies its endpoints
+// On failure the previous endpoints are kept and the fetch is retried after a minute
+func (p *CustomProvider) Discover(ctx context.Context) error {
+	doc, err := FetchDiscovery(p.clientContext(ctx), p.issuerURL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.nextDiscovery = time.Now().Add(discoveryRetryInterval)
+		return err
+	}
+
+	config := *p.baseConfig
+	if config.Endpoint.AuthURL == "" {
+		config.Endpoint.AuthURL = doc.AuthorizationEndpoint
+	}
+	if config.Endpoint.TokenURL == "" {
+		config.Endpoint.TokenURL = doc.TokenEndpoint
+	}
+	p.config = &config
+
+	p.userInfoURL = p.baseUserInfoURL
+	if p.userInfoURL == "" {
+		p.userInfoURL = doc.UserInfoEndpoint
+	}
+	if p.baseJWKSURL == "" {
+		p.jwksURL = doc.JWKSURI
+	}
+	p.discovered = true
+	p.nextDiscovery = time.Now().Add(p.discoveryRefresh)
+	return nil
+}
+
+// refreshDiscovery fetches the discovery document when it is due
+// Until the first fetch succeeds it runs synchronously so that sign-ins do not use missing endpoints;
+// afterwards it runs in the background while the previous endpoints keep being served
+func (p *CustomProvider) refreshDiscovery() {
+	if p.issuerURL == "" {
+		return
+	}
+
+	p.mu.RLock()
+	due, discovered := time.Now().After(p.nextDiscovery), p.discovered
+	p.mu.RUnlock()
+	if !due || !p.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	refresh := func() {
+		defer p.refreshing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		defer cancel()
+		_ = p.Discover(ctx)
+	}
+	if !discovered {
+		refresh()
+		return
+	}
+	go refresh()
+}
+
+// DiscoveryURL returns the URL of the discovery document, or an empty string without issuer_url
+func (p *CustomProvider) DiscoveryURL() string {
+	if p.issuerURL == "" {
+		return ""
+	}
+	return IssuerDiscoveryURL(p.issuerURL)
+}
+
+// SetJWKSURL sets the JWKS URL verifying back-channel logout tokens, instead of the discovered one
+func (p *CustomProvider) SetJWKSURL(jwksURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.baseJWKSURL = jwksURL
+	p.jwksURL = jwksURL
+}
+
+// JWKSURL returns the JWKS URL set with SetJWKSURL or listed in the discovery document (empty before discovery)
+func (p *CustomProvider) JWKSURL() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.jwksURL
+}
+
 // Name returns the provider name
 func (p *CustomProvider) Name() string {
 	return p.name
 }
 
 // Config returns the OAuth2 config
+// With discovery enabled, the endpoints are refreshed when due
 func (p *CustomProvider) Config() *oauth2.Config {
+	p.refreshDiscovery()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.config
 }
 
+// clientContext returns ctx with the provider's HTTP client when ctx has none,
+// skipping TLS verification when insecure_skip_verify is enabled
+// The transport of the client is cloned, so proxies and CA settings are kept.
+func (p *CustomProvider) clientContext(ctx context.Context) context.Context {
+	if ctx.Value(oauth2.HTTPClient) == nil && p.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	}
+	if !p.insecureSkipVerify {
+		return ctx
+	}
+
+	base := contextClient(ctx)
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+
+	client := *base
+	client.Transport = transport
+	return context.WithValue(ctx, oauth2.HTTPClient, &client)
+}
+
 // GetUserInfo retrieves the user's information from the custom provider
 func (p *CustomProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
-	// Create HTTP client with custom transport if insecure skip verify is enabled
-	var httpClient *http.Client
-	if p.insecureSkipVerify {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		httpClient = &http.Client{Transport: transport}
-		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	config := p.Config()
+	p.mu.RLock()
+	userInfoURL := p.userInfoURL
+	p.mu.RUnlock()
+	if userInfoURL == "" {
+		return nil, errors.New("failed to get user info: no userinfo endpoint is configured or discovered")
 	}
 
-	client := p.config.Client(ctx, token)
+	// Use an HTTP client that skips TLS verification if insecure skip verify is enabled
+	client := config.Client(p.clientContext(ctx), token)
 
-	resp, err := client.Get(p.userInfoURL)
+	resp, err := client.Get(userInfoURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -122,12 +282,25 @@ func (p *CustomProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 	// Email is optional - some providers don't provide it
 	// Authorization layer will check if email is required based on whitelist configuration
 	return &UserInfo{
-		Email: email, // May be empty
-		Name:  name,
-		Extra: fullResponse, // Store complete response for custom forwarding
+		Email:         email, // May be empty
+		EmailVerified: claimVerified(fullResponse["email_verified"]) || claimVerified(fullResponse["verified_email"]),
+		Name:          name,
+		Extra:         fullResponse, // Store complete response for custom forwarding
 	}, nil
 }
 
+// claimVerified reports whether an email verification claim is true
+// Some providers (e.g., Amazon Cognito) send the OIDC email_verified claim as a string
+func claimVerified(claim interface{}) bool {
+	switch v := claim.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
 // GetUserEmail retrieves the user's email from the custom provider (deprecated, use GetUserInfo)
 func (p *CustomProvider) GetUserEmail(ctx context.Context, token *oauth2.Token) (string, error) {
 	userInfo, err := p.GetUserInfo(ctx, token)
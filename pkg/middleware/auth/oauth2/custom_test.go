@@ -171,6 +171,70 @@ func TestCustomProvider_GetUserEmail(t *testing.T) {
 	}
 }
 
+func TestCustomProvider_GetUserInfo_EmailVerified(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     map[string]interface{}
+		wantVerified bool
+	}{
+		{
+			name:         "email_verified true",
+			response:     map[string]interface{}{"email": "user@example.com", "email_verified": true},
+			wantVerified: true,
+		},
+		{
+			name:         "email_verified as string",
+			response:     map[string]interface{}{"email": "user@example.com", "email_verified": "true"},
+			wantVerified: true,
+		},
+		{
+			name:         "verified_email true",
+			response:     map[string]interface{}{"email": "user@example.com", "verified_email": true},
+			wantVerified: true,
+		},
+		{
+			name:         "email_verified false",
+			response:     map[string]interface{}{"email": "user@example.com", "email_verified": false},
+			wantVerified: false,
+		},
+		{
+			name:         "without verification field",
+			response:     map[string]interface{}{"email": "user@example.com"},
+			wantVerified: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(tt.response)
+			}))
+			defer server.Close()
+
+			provider := NewCustomProvider(
+				"custom-provider",
+				"test-client-id",
+				"test-client-secret",
+				"http://localhost/callback",
+				"https://auth.example.com/oauth/authorize",
+				"https://auth.example.com/oauth/token",
+				server.URL+"/userinfo",
+				nil,
+				false,
+			)
+
+			userInfo, err := provider.GetUserInfo(context.Background(), &oauth2lib.Token{AccessToken: "test-token"})
+			if err != nil {
+				t.Fatalf("GetUserInfo() unexpected error = %v", err)
+			}
+			if userInfo.EmailVerified != tt.wantVerified {
+				t.Errorf("GetUserInfo() EmailVerified = %v, want %v", userInfo.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
 func TestCustomProvider_GetUserEmail_InsecureSkipVerify(t *testing.T) {
 	// Create mock HTTP server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,63 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// discoveryPath is the well-known path of OpenID Connect discovery documents, relative to the issuer
+const discoveryPath = "/.well-known/openid-configuration"
+
+// DiscoveryDocument is the part of an OpenID Connect discovery document used to configure providers
+type DiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IssuerDiscoveryURL returns the discovery document URL of an issuer
+// (e.g., "https://idp.example.com/realms/main" -> "https://idp.example.com/realms/main/.well-known/openid-configuration")
+func IssuerDiscoveryURL(issuerURL string) string {
+	return strings.TrimSuffix(issuerURL, "/") + discoveryPath
+}
+
+// FetchDiscovery fetches and validates the discovery document of an issuer
+// The document must name the same issuer and list the authorization and token endpoints.
+// The HTTP client is taken from ctx (oauth2.HTTPClient), like token exchanges.
+func FetchDiscovery(ctx context.Context, issuerURL string) (*DiscoveryDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, IssuerDiscoveryURL(issuerURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch discovery document: status %d", resp.StatusCode)
+	}
+
+	var doc DiscoveryDocument
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCheckBodyBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscoveryInvalid, err)
+	}
+
+	// OIDC Discovery 1.0 section 4.3: the issuer must match the URL the document was retrieved for
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscoveryInvalid, doc.Issuer, issuerURL)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%w: authorization_endpoint and token_endpoint are required", ErrDiscoveryInvalid)
+	}
+	return &doc, nil
+}
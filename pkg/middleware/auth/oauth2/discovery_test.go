@@ -0,0 +1,128 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDiscoveryServer starts an OIDC issuer whose discovery document lists endpoints on the same server
+// issuer overrides the issuer named in the document when not empty
+func newDiscoveryServer(t *testing.T, issuer string, fetches *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		if fetches != nil {
+			fetches.Add(1)
+		}
+		name := issuer
+		if name == "" {
+			name = server.URL
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"userinfo_endpoint":%q,"jwks_uri":%q}`,
+			name, server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", server.URL+"/jwks")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchDiscovery(t *testing.T) {
+	server := newDiscoveryServer(t, "", nil)
+
+	doc, err := FetchDiscovery(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatalf("FetchDiscovery() error = %v", err)
+	}
+	if doc.TokenEndpoint != server.URL+"/token" || doc.UserInfoEndpoint != server.URL+"/userinfo" || doc.JWKSURI != server.URL+"/jwks" {
+		t.Errorf("FetchDiscovery() = %+v", doc)
+	}
+}
+
+func TestFetchDiscovery_IssuerMismatch(t *testing.T) {
+	server := newDiscoveryServer(t, "https://evil.example.com", nil)
+
+	if _, err := FetchDiscovery(context.Background(), server.URL); !errors.Is(err, ErrDiscoveryInvalid) {
+		t.Errorf("FetchDiscovery() error = %v, want ErrDiscoveryInvalid", err)
+	}
+}
+
+func TestCustomProvider_Discover(t *testing.T) {
+	server := newDiscoveryServer(t, "", nil)
+
+	// The configured userinfo endpoint takes precedence over the discovered one
+	provider := NewCustomProvider("idp", "client", "secret", "https://chat.example.com/_auth/oauth2/callback",
+		"", "", "https://idp.example.com/me", nil, false)
+	provider.SetIssuer(server.URL, time.Hour)
+
+	if err := provider.Discover(context.Background()); err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	config := provider.Config()
+	if config.Endpoint.AuthURL != server.URL+"/authorize" || config.Endpoint.TokenURL != server.URL+"/token" {
+		t.Errorf("Endpoint = %+v, want the discovered endpoints", config.Endpoint)
+	}
+	if provider.userInfoURL != "https://idp.example.com/me" {
+		t.Errorf("userInfoURL = %s, want the configured endpoint", provider.userInfoURL)
+	}
+	if provider.JWKSURL() != server.URL+"/jwks" {
+		t.Errorf("JWKSURL() = %s, want %s", provider.JWKSURL(), server.URL+"/jwks")
+	}
+	if provider.DiscoveryURL() != server.URL+"/.well-known/openid-configuration" {
+		t.Errorf("DiscoveryURL() = %s", provider.DiscoveryURL())
+	}
+}
+
+func TestCustomProvider_DiscoveryRefresh(t *testing.T) {
+	var fetches atomic.Int32
+	server := newDiscoveryServer(t, "", &fetches)
+
+	provider := NewCustomProvider("idp", "client", "secret", "https://chat.example.com/_auth/oauth2/callback",
+		"", "", "", nil, false)
+	provider.SetIssuer(server.URL, time.Hour)
+
+	// The first Config() call discovers synchronously, later calls reuse the document
+	if got := provider.Config().Endpoint.TokenURL; got != server.URL+"/token" {
+		t.Fatalf("TokenURL = %s, want %s", got, server.URL+"/token")
+	}
+	provider.Config()
+	if fetches.Load() != 1 {
+		t.Errorf("Fetches = %d, want 1", fetches.Load())
+	}
+
+	// Once due, the document is fetched again in the background
+	provider.mu.Lock()
+	provider.nextDiscovery = time.Now().Add(-time.Second)
+	provider.mu.Unlock()
+	provider.Config()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() < 2 || provider.refreshing.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Fetches = %d, want 2", fetches.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCustomProvider_WithoutIssuer(t *testing.T) {
+	provider := NewCustomProvider("idp", "client", "secret", "https://chat.example.com/_auth/oauth2/callback",
+		"https://idp.example.com/authorize", "https://idp.example.com/token", "https://idp.example.com/userinfo", nil, false)
+
+	if provider.DiscoveryURL() != "" {
+		t.Errorf("DiscoveryURL() = %s, want empty", provider.DiscoveryURL())
+	}
+	if provider.Config().Endpoint.TokenURL != "https://idp.example.com/token" {
+		t.Errorf("TokenURL = %s", provider.Config().Endpoint.TokenURL)
+	}
+}
@@ -4,15 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 )
 
+// githubAPIURL is the base URL of the GitHub REST API
+const githubAPIURL = "https://api.github.com"
+
+// maxGitHubPages limits how many pages of organizations or teams are read (100 entries per page)
+const maxGitHubPages = 10
+
 // GitHubProvider is the OAuth2 provider for GitHub
 type GitHubProvider struct {
-	id     string
-	config *oauth2.Config
+	id           string
+	config       *oauth2.Config
+	allowedOrgs  []string
+	allowedTeams []string
+
+	clientAuthSetting // Optional: private_key_jwt or mutual TLS instead of the client secret
 }
 
 // NewGitHubProvider creates a new GitHub OAuth2 provider
@@ -43,6 +55,22 @@ func NewGitHubProvider(id, clientID, clientSecret, redirectURL string, scopes []
 	}
 }
 
+// SetMembership requires users to belong to one of the organizations or teams ("org/team-slug")
+// The "read:org" scope is added so that private memberships are visible
+func (p *GitHubProvider) SetMembership(orgs, teams []string) {
+	p.allowedOrgs = orgs
+	p.allowedTeams = teams
+	if len(orgs) == 0 && len(teams) == 0 {
+		return
+	}
+	for _, scope := range p.config.Scopes {
+		if scope == "read:org" {
+			return
+		}
+	}
+	p.config.Scopes = append(append([]string{}, p.config.Scopes...), "read:org")
+}
+
 // Name returns the provider name
 func (p *GitHubProvider) Name() string {
 	return p.id
@@ -60,7 +88,7 @@ func (p *GitHubProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 	// Get user profile (name, login, avatar_url)
 	var userName string
 	var avatarURL string
-	userResp, err := client.Get("https://api.github.com/user")
+	userResp, err := client.Get(githubAPIURL + "/user")
 	if err == nil && userResp.StatusCode == 200 {
 		defer func() { _ = userResp.Body.Close() }()
 		var user struct {
@@ -78,7 +106,7 @@ func (p *GitHubProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 	}
 
 	// Get user's emails
-	resp, err := client.Get("https://api.github.com/user/emails")
+	resp, err := client.Get(githubAPIURL + "/user/emails")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user emails: %w", err)
 	}
@@ -132,10 +160,25 @@ func (p *GitHubProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 		extra["_avatar_url"] = ""
 	}
 
+	// Check organization and team membership when required
+	if len(p.allowedOrgs) > 0 || len(p.allowedTeams) > 0 {
+		orgs, teams, err := fetchGitHubMembership(client)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAccessDenied, err)
+		}
+		if !containsFold(p.allowedOrgs, orgs) && !containsFold(p.allowedTeams, teams) {
+			return nil, ErrAccessDenied
+		}
+		// Comma-separated so that they can be forwarded as extra.orgs and extra.teams
+		extra["orgs"] = strings.Join(orgs, ",")
+		extra["teams"] = strings.Join(teams, ",")
+	}
+
 	return &UserInfo{
-		Email: email,
-		Name:  userName,
-		Extra: extra,
+		Email:         email,
+		EmailVerified: true, // Only verified addresses are selected above
+		Name:          userName,
+		Extra:         extra,
 	}, nil
 }
 
@@ -147,3 +190,69 @@ func (p *GitHubProvider) GetUserEmail(ctx context.Context, token *oauth2.Token)
 	}
 	return userInfo.Email, nil
 }
+
+// fetchGitHubMembership returns the user's organization logins and teams ("org/team-slug")
+func fetchGitHubMembership(client *http.Client) ([]string, []string, error) {
+	var orgs []string
+	for page := 1; page <= maxGitHubPages; page++ {
+		var entries []struct {
+			Login string `json:"login"`
+		}
+		if err := getGitHubPage(client, "/user/orgs", page, &entries); err != nil {
+			return nil, nil, fmt.Errorf("failed to get user organizations: %w", err)
+		}
+		for _, e := range entries {
+			orgs = append(orgs, e.Login)
+		}
+		if len(entries) < 100 {
+			break
+		}
+	}
+
+	var teams []string
+	for page := 1; page <= maxGitHubPages; page++ {
+		var entries []struct {
+			Slug         string `json:"slug"`
+			Organization struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		if err := getGitHubPage(client, "/user/teams", page, &entries); err != nil {
+			return nil, nil, fmt.Errorf("failed to get user teams: %w", err)
+		}
+		for _, e := range entries {
+			teams = append(teams, e.Organization.Login+"/"+e.Slug)
+		}
+		if len(entries) < 100 {
+			break
+		}
+	}
+
+	return orgs, teams, nil
+}
+
+// getGitHubPage decodes one page (100 entries) of a GitHub API list into v
+func getGitHubPage(client *http.Client, path string, page int, v interface{}) error {
+	resp, err := client.Get(fmt.Sprintf("%s%s?per_page=100&page=%d", githubAPIURL, path, page))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// containsFold reports whether any of values is in allowed, ignoring case
+func containsFold(allowed, values []string) bool {
+	for _, a := range allowed {
+		for _, v := range values {
+			if strings.EqualFold(a, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
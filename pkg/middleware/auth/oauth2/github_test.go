@@ -3,6 +3,7 @@ package oauth2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -260,3 +261,111 @@ func TestGitHubProvider_GetUserEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestGitHubProvider_SetMembership(t *testing.T) {
+	provider := NewGitHubProvider("github", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+	provider.SetMembership([]string{"acme"}, nil)
+
+	scopes := provider.Config().Scopes
+	if len(scopes) != 3 || scopes[2] != "read:org" {
+		t.Errorf("Scopes = %v, want read:org appended", scopes)
+	}
+
+	// Setting it again does not duplicate the scope
+	provider.SetMembership([]string{"acme"}, []string{"acme/platform"})
+	if len(provider.Config().Scopes) != 3 {
+		t.Errorf("Scopes = %v, want read:org once", provider.Config().Scopes)
+	}
+}
+
+func TestGitHubProvider_GetUserInfo_Membership(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowedOrgs  []string
+		allowedTeams []string
+		orgsStatus   int
+		wantErr      bool
+		wantOrgs     string
+		wantTeams    string
+	}{
+		{
+			name:        "member of allowed org",
+			allowedOrgs: []string{"ACME"},
+			orgsStatus:  http.StatusOK,
+			wantOrgs:    "acme,widgets",
+			wantTeams:   "acme/platform",
+		},
+		{
+			name:         "member of allowed team",
+			allowedTeams: []string{"acme/platform"},
+			orgsStatus:   http.StatusOK,
+			wantOrgs:     "acme,widgets",
+			wantTeams:    "acme/platform",
+		},
+		{
+			name:         "not a member",
+			allowedOrgs:  []string{"other"},
+			allowedTeams: []string{"acme/sre"},
+			orgsStatus:   http.StatusOK,
+			wantErr:      true,
+		},
+		{
+			name:        "membership lookup fails",
+			allowedOrgs: []string{"acme"},
+			orgsStatus:  http.StatusForbidden,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"login": "octocat"})
+			})
+			mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+					{"email": "user@example.com", "primary": true, "verified": true},
+				})
+			})
+			mux.HandleFunc("/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.orgsStatus)
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+					{"login": "acme"},
+					{"login": "widgets"},
+				})
+			})
+			mux.HandleFunc("/user/teams", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+					{"slug": "platform", "organization": map[string]interface{}{"login": "acme"}},
+				})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			provider := NewGitHubProvider("github", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+			provider.SetMembership(tt.allowedOrgs, tt.allowedTeams)
+
+			ctx := context.WithValue(context.Background(), oauth2lib.HTTPClient, &http.Client{
+				Transport: &hostTransport{baseURL: server.URL},
+			})
+			userInfo, err := provider.GetUserInfo(ctx, &oauth2lib.Token{AccessToken: "test-token"})
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrAccessDenied) {
+					t.Errorf("GetUserInfo() error = %v, want ErrAccessDenied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserInfo() unexpected error = %v", err)
+			}
+			if userInfo.Extra["orgs"] != tt.wantOrgs {
+				t.Errorf("Extra[orgs] = %v, want %s", userInfo.Extra["orgs"], tt.wantOrgs)
+			}
+			if userInfo.Extra["teams"] != tt.wantTeams {
+				t.Errorf("Extra[teams] = %v, want %s", userInfo.Extra["teams"], tt.wantTeams)
+			}
+		})
+	}
+}
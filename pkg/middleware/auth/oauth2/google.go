@@ -4,15 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
+// googleDirectoryGroupsURL is the Directory API endpoint listing the groups of a user
+const googleDirectoryGroupsURL = "https://admin.googleapis.com/admin/directory/v1/groups"
+
+// googleDirectoryScope is the scope of the service account reading group memberships
+const googleDirectoryScope = "https://www.googleapis.com/auth/admin.directory.group.readonly"
+
+// maxGoogleGroupPages limits how many pages of groups are read (200 groups per page)
+const maxGoogleGroupPages = 10
+
 // GoogleProvider is the OAuth2 provider for Google
 type GoogleProvider struct {
-	id     string
-	config *oauth2.Config
+	id            string
+	config        *oauth2.Config
+	hostedDomains []string
+	directory     oauth2.TokenSource // Service account tokens for the Directory API (nil: no group lookup)
+	allowedGroups []string
+
+	clientAuthSetting // Optional: private_key_jwt or mutual TLS instead of the client secret
 }
 
 // NewGoogleProvider creates a new Google OAuth2 provider
@@ -44,6 +61,43 @@ func NewGoogleProvider(id, clientID, clientSecret, redirectURL string, scopes []
 	}
 }
 
+// NewGoogleDirectoryTokenSource returns Directory API tokens of a service account with domain-wide delegation
+// credentialsJSON is the service account key file, and adminEmail the Workspace admin it acts as.
+// Tokens are fetched with the HTTP client set in ctx with oauth2.HTTPClient, if any.
+func NewGoogleDirectoryTokenSource(ctx context.Context, credentialsJSON []byte, adminEmail string) (oauth2.TokenSource, error) {
+	conf, err := google.JWTConfigFromJSON(credentialsJSON, googleDirectoryScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account credentials: %w", err)
+	}
+	conf.Subject = adminEmail
+	return conf.TokenSource(ctx), nil
+}
+
+// SetHostedDomains requires users to belong to one of the Google Workspace domains ("hd" claim)
+func (p *GoogleProvider) SetHostedDomains(domains []string) {
+	p.hostedDomains = domains
+}
+
+// SetDirectory enables the group lookup with the Directory API
+// When allowedGroups is not empty, users must belong to one of them (group emails)
+func (p *GoogleProvider) SetDirectory(tokens oauth2.TokenSource, allowedGroups []string) {
+	p.directory = tokens
+	p.allowedGroups = allowedGroups
+}
+
+// AuthCodeOptions returns the "hd" parameter so that Google offers only accounts of the hosted domains
+// The parameter is only a hint; the domain is verified again in GetUserInfo
+func (p *GoogleProvider) AuthCodeOptions() []oauth2.AuthCodeOption {
+	switch len(p.hostedDomains) {
+	case 0:
+		return nil
+	case 1:
+		return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("hd", p.hostedDomains[0])}
+	default:
+		return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("hd", "*")} // Any Workspace account
+	}
+}
+
 // Name returns the provider name (ID)
 func (p *GoogleProvider) Name() string {
 	return p.id
@@ -54,6 +108,11 @@ func (p *GoogleProvider) Config() *oauth2.Config {
 	return p.config
 }
 
+// DiscoveryURL returns the URL of Google's OpenID Connect discovery document
+func (p *GoogleProvider) DiscoveryURL() string {
+	return "https://accounts.google.com/.well-known/openid-configuration"
+}
+
 // GetUserInfo retrieves the user's information from Google
 func (p *GoogleProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
 	client := p.config.Client(ctx, token)
@@ -75,6 +134,7 @@ func (p *GoogleProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 		GivenName     string `json:"given_name"`
 		FamilyName    string `json:"family_name"`
 		Picture       string `json:"picture"`
+		HostedDomain  string `json:"hd"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&apiUserInfo); err != nil {
@@ -94,11 +154,33 @@ func (p *GoogleProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (
 	} else {
 		extra["_avatar_url"] = ""
 	}
+	if apiUserInfo.HostedDomain != "" {
+		extra["hd"] = apiUserInfo.HostedDomain
+	}
+
+	// Check the Workspace domain when required (consumer accounts have no "hd")
+	if len(p.hostedDomains) > 0 && !containsFold(p.hostedDomains, []string{apiUserInfo.HostedDomain}) {
+		return nil, fmt.Errorf("%w: hosted domain %q is not allowed", ErrAccessDenied, apiUserInfo.HostedDomain)
+	}
+
+	// Look up group memberships when the Directory API is configured
+	if p.directory != nil {
+		groups, err := fetchGoogleGroups(ctx, p.directory, apiUserInfo.Email)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAccessDenied, err)
+		}
+		if len(p.allowedGroups) > 0 && !containsFold(p.allowedGroups, groups) {
+			return nil, ErrAccessDenied
+		}
+		// Comma-separated so that they can be forwarded as extra.groups
+		extra["groups"] = strings.Join(groups, ",")
+	}
 
 	return &UserInfo{
-		Email: apiUserInfo.Email,
-		Name:  apiUserInfo.Name,
-		Extra: extra,
+		Email:         apiUserInfo.Email,
+		EmailVerified: apiUserInfo.VerifiedEmail,
+		Name:          apiUserInfo.Name,
+		Extra:         extra,
 	}, nil
 }
 
@@ -110,3 +192,49 @@ func (p *GoogleProvider) GetUserEmail(ctx context.Context, token *oauth2.Token)
 	}
 	return userInfo.Email, nil
 }
+
+// fetchGoogleGroups returns the emails of the groups the user belongs to
+func fetchGoogleGroups(ctx context.Context, tokens oauth2.TokenSource, email string) ([]string, error) {
+	client := oauth2.NewClient(ctx, tokens)
+
+	var groups []string
+	pageToken := ""
+	for page := 0; page < maxGoogleGroupPages; page++ {
+		query := url.Values{"userKey": {email}, "maxResults": {"200"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		resp, err := client.Get(googleDirectoryGroupsURL + "?" + query.Encode())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user groups: %w", err)
+		}
+
+		var list struct {
+			Groups []struct {
+				Email string `json:"email"`
+			} `json:"groups"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = func() error {
+			defer func() { _ = resp.Body.Close() }()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to get user groups: status %d", resp.StatusCode)
+			}
+			return json.NewDecoder(resp.Body).Decode(&list)
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range list.Groups {
+			groups = append(groups, strings.ToLower(g.Email))
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		pageToken = list.NextPageToken
+	}
+
+	return groups, nil
+}
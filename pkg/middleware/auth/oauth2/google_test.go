@@ -1,7 +1,15 @@
 package oauth2
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	oauth2lib "golang.org/x/oauth2"
 )
 
 func TestNewGoogleProvider(t *testing.T) {
@@ -111,3 +119,157 @@ func TestGoogleProvider_EmptyScopes(t *testing.T) {
 		}
 	}
 }
+
+func TestGoogleProvider_AuthCodeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		wantHD  string
+	}{
+		{"no hosted domain", nil, ""},
+		{"single hosted domain", []string{"example.com"}, "hd=example.com"},
+		{"multiple hosted domains", []string{"example.com", "example.org"}, "hd=%2A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewGoogleProvider("google", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+			provider.SetHostedDomains(tt.domains)
+
+			manager := NewManager()
+			manager.AddProvider(provider)
+			authURL, err := manager.GetAuthURL("google", "state")
+			if err != nil {
+				t.Fatalf("GetAuthURL() error = %v", err)
+			}
+
+			if tt.wantHD == "" {
+				if strings.Contains(authURL, "hd=") {
+					t.Errorf("GetAuthURL() = %s, want no hd parameter", authURL)
+				}
+				return
+			}
+			if !strings.Contains(authURL, tt.wantHD) {
+				t.Errorf("GetAuthURL() = %s, want %s", authURL, tt.wantHD)
+			}
+		})
+	}
+}
+
+func TestGoogleProvider_GetUserInfo_Workspace(t *testing.T) {
+	tests := []struct {
+		name          string
+		hostedDomain  string
+		domains       []string
+		directory     bool
+		allowedGroups []string
+		groupsStatus  int
+		wantErr       bool
+		wantGroups    interface{}
+	}{
+		{
+			name:         "allowed hosted domain",
+			hostedDomain: "example.com",
+			domains:      []string{"Example.com"},
+		},
+		{
+			name:         "other hosted domain",
+			hostedDomain: "other.com",
+			domains:      []string{"example.com"},
+			wantErr:      true,
+		},
+		{
+			name:    "consumer account",
+			domains: []string{"example.com"},
+			wantErr: true,
+		},
+		{
+			name:         "groups are looked up",
+			hostedDomain: "example.com",
+			directory:    true,
+			groupsStatus: http.StatusOK,
+			wantGroups:   "staff@example.com,finance@example.com",
+		},
+		{
+			name:          "member of an allowed group",
+			hostedDomain:  "example.com",
+			directory:     true,
+			allowedGroups: []string{"finance@example.com"},
+			groupsStatus:  http.StatusOK,
+			wantGroups:    "staff@example.com,finance@example.com",
+		},
+		{
+			name:          "not a member of the allowed groups",
+			hostedDomain:  "example.com",
+			directory:     true,
+			allowedGroups: []string{"admins@example.com"},
+			groupsStatus:  http.StatusOK,
+			wantErr:       true,
+		},
+		{
+			name:         "group lookup fails",
+			hostedDomain: "example.com",
+			directory:    true,
+			groupsStatus: http.StatusForbidden,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/oauth2/v2/userinfo", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"email":          "user@example.com",
+					"verified_email": true,
+					"hd":             tt.hostedDomain,
+				})
+			})
+			mux.HandleFunc("/admin/directory/v1/groups", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("userKey") != "user@example.com" {
+					t.Errorf("userKey = %q, want user@example.com", r.URL.Query().Get("userKey"))
+				}
+				if r.Header.Get("Authorization") != "Bearer directory-token" {
+					t.Errorf("Authorization = %q, want the service account token", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(tt.groupsStatus)
+				if r.URL.Query().Get("pageToken") == "" {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"groups":        []map[string]interface{}{{"email": "staff@example.com"}},
+						"nextPageToken": "page-2",
+					})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"groups": []map[string]interface{}{{"email": "Finance@example.com"}},
+				})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			provider := NewGoogleProvider("google", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+			provider.SetHostedDomains(tt.domains)
+			if tt.directory {
+				provider.SetDirectory(oauth2lib.StaticTokenSource(&oauth2lib.Token{AccessToken: "directory-token"}), tt.allowedGroups)
+			}
+
+			ctx := context.WithValue(context.Background(), oauth2lib.HTTPClient, &http.Client{
+				Transport: &hostTransport{baseURL: server.URL},
+			})
+			userInfo, err := provider.GetUserInfo(ctx, &oauth2lib.Token{AccessToken: "test-token"})
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrAccessDenied) {
+					t.Errorf("GetUserInfo() error = %v, want ErrAccessDenied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserInfo() unexpected error = %v", err)
+			}
+			if userInfo.Extra["groups"] != tt.wantGroups {
+				t.Errorf("Extra[groups] = %v, want %v", userInfo.Extra["groups"], tt.wantGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksMaxAge is how long fetched keys are used before the JWKS is fetched again
+	jwksMaxAge = time.Hour
+
+	// jwksMinRefresh is the minimum delay between two fetches for an unknown key ID,
+	// so that tokens with made-up key IDs do not make every request fetch the JWKS
+	jwksMinRefresh = time.Minute
+)
+
+// ErrSignatureInvalid is returned when a JWT is malformed or its signature does not verify
+var ErrSignatureInvalid = errors.New("invalid JWT signature")
+
+// jsonWebKey is a key of a JWKS (RFC 7517); only signature keys are used
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksCache holds the signing keys of a provider, by key ID
+type jwksCache struct {
+	mu      sync.Mutex
+	url     string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// key returns the key with the key ID, fetching the JWKS when it is stale or does not have it
+// An empty key ID matches the only key of a JWKS with one key.
+func (c *jwksCache) key(ctx context.Context, url, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if url != c.url {
+		c.url, c.keys, c.fetched = url, nil, time.Time{}
+	}
+	if key, ok := c.lookup(kid); ok && time.Since(c.fetched) < jwksMaxAge {
+		return key, nil
+	}
+	if time.Since(c.fetched) >= jwksMinRefresh || c.keys == nil {
+		keys, err := fetchJWKS(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		c.keys, c.fetched = keys, time.Now()
+	}
+
+	key, ok := c.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: no key %q in the JWKS", ErrSignatureInvalid, kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// fetchJWKS fetches the signature keys of a JWKS; keys of unsupported types are skipped
+// The HTTP client is taken from ctx (oauth2.HTTPClient), like token exchanges.
+func fetchJWKS(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	if url == "" {
+		return nil, errors.New("failed to fetch JWKS: no JWKS URL is set or discovered")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := contextClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCheckBodyBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA, EC P-256 or Ed25519 key
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verifyJWT checks the signature of a compact JWS with the key returned for its "kid" header
+// and returns its decoded claims. RS256, ES256 and EdDSA are supported, like for client assertions.
+func verifyJWT(raw string, key func(kid string) (crypto.PublicKey, error)) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrSignatureInvalid)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrSignatureInvalid)
+	}
+
+	publicKey, err := key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	valid := false
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		valid = header.Alg == "RS256" && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if header.Alg == "ES256" && len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			valid = ecdsa.Verify(pub, digest[:], r, s)
+		}
+	case ed25519.PublicKey:
+		valid = header.Alg == "EdDSA" && ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), signature)
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: %s signature does not verify", ErrSignatureInvalid, header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed JWT", ErrSignatureInvalid)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JWT", ErrSignatureInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// BackchannelLogoutEvent is the member of the "events" claim of OIDC back-channel logout tokens
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+const (
+	// logoutTokenMaxAge is how old a logout token ("iat") may be
+	logoutTokenMaxAge = 5 * time.Minute
+
+	// logoutTokenSkew is the clock skew tolerated between the provider and this server
+	logoutTokenSkew = time.Minute
+)
+
+// ErrLogoutTokenInvalid is returned when a back-channel logout token does not verify or lacks required claims
+var ErrLogoutTokenInvalid = errors.New("invalid logout token")
+
+// LogoutClaims are the verified claims of an OIDC back-channel logout token
+// At least one of Subject and SessionID is set.
+type LogoutClaims struct {
+	Issuer    string
+	Subject   string    // "sub": log out all sessions of the user
+	SessionID string    // "sid": log out the sessions of this provider session only
+	ID        string    // "jti", to reject replays (may be empty)
+	ExpiresAt time.Time // Until when the token would be accepted
+}
+
+// LogoutTokenVerifier is implemented by providers that accept OIDC back-channel logout tokens
+type LogoutTokenVerifier interface {
+	// Issuer returns the issuer of the provider's tokens, or an empty string when unknown
+	Issuer() string
+
+	// VerifyLogoutToken checks a logout token against the provider's JWKS, issuer and client ID
+	VerifyLogoutToken(ctx context.Context, raw string) (*LogoutClaims, error)
+}
+
+// SessionClaims returns the "sub" and "sid" claims of the ID token returned with the access token,
+// which back-channel logout tokens identify sessions with. Empty without ID token.
+// The signature is not verified: the token comes from the token endpoint, not from the browser.
+func SessionClaims(token *oauth2.Token) (subject, sid string) {
+	claims, err := idTokenClaims(token)
+	if err != nil {
+		return "", ""
+	}
+	subject, _ = claims["sub"].(string)
+	sid, _ = claims["sid"].(string)
+	return subject, sid
+}
+
+// VerifyLogoutToken finds the provider that issued a back-channel logout token and verifies it
+// Returns the name of the provider and the claims identifying the sessions to log out.
+func (m *Manager) VerifyLogoutToken(ctx context.Context, raw string) (string, *LogoutClaims, error) {
+	// The issuer selects the provider, whose keys then verify the token
+	var unverified struct {
+		Issuer string `json:"iss"`
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 || decodeSegment(parts[1], &unverified) != nil || unverified.Issuer == "" {
+		return "", nil, fmt.Errorf("%w: malformed JWT", ErrLogoutTokenInvalid)
+	}
+
+	for name, provider := range m.providers {
+		verifier, ok := provider.(LogoutTokenVerifier)
+		if !ok || verifier.Issuer() == "" || !sameIssuer(verifier.Issuer(), unverified.Issuer) {
+			continue
+		}
+		claims, err := verifier.VerifyLogoutToken(m.HTTPContext(ctx), raw)
+		if err != nil {
+			return name, nil, err
+		}
+		return name, claims, nil
+	}
+	return "", nil, fmt.Errorf("%w: no provider with issuer %q", ErrLogoutTokenInvalid, unverified.Issuer)
+}
+
+// ProviderByIssuer returns the name of the provider whose issuer is issuer (front-channel logout "iss")
+func (m *Manager) ProviderByIssuer(issuer string) (string, bool) {
+	for name, provider := range m.providers {
+		verifier, ok := provider.(LogoutTokenVerifier)
+		if ok && verifier.Issuer() != "" && sameIssuer(verifier.Issuer(), issuer) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// sameIssuer compares issuer URLs, ignoring a trailing slash
+func sameIssuer(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
+
+// validateLogoutClaims checks the claims of a logout token (OIDC Back-Channel Logout 1.0, section 2.6)
+func validateLogoutClaims(claims map[string]interface{}, issuer, clientID string, now time.Time) (*LogoutClaims, error) {
+	iss, _ := claims["iss"].(string)
+	if !sameIssuer(iss, issuer) {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrLogoutTokenInvalid, iss, issuer)
+	}
+	if !audienceContains(claims["aud"], clientID) {
+		return nil, fmt.Errorf("%w: audience does not contain the client ID", ErrLogoutTokenInvalid)
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: iat is required", ErrLogoutTokenInvalid)
+	}
+	issuedAt := time.Unix(int64(iat), 0)
+	if issuedAt.After(now.Add(logoutTokenSkew)) || now.Sub(issuedAt) > logoutTokenMaxAge+logoutTokenSkew {
+		return nil, fmt.Errorf("%w: issued at %s", ErrLogoutTokenInvalid, issuedAt.UTC().Format(time.RFC3339))
+	}
+	expiresAt := issuedAt.Add(logoutTokenMaxAge + logoutTokenSkew)
+	if exp, ok := claims["exp"].(float64); ok {
+		if time.Unix(int64(exp), 0).Before(now.Add(-logoutTokenSkew)) {
+			return nil, fmt.Errorf("%w: expired", ErrLogoutTokenInvalid)
+		}
+	}
+
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[BackchannelLogoutEvent].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%w: events does not contain the back-channel logout event", ErrLogoutTokenInvalid)
+	}
+	// A nonce would make it an ID token that could be replayed as a logout token
+	if _, ok := claims["nonce"]; ok {
+		return nil, fmt.Errorf("%w: nonce is not allowed", ErrLogoutTokenInvalid)
+	}
+
+	logout := &LogoutClaims{Issuer: iss, ExpiresAt: expiresAt}
+	logout.Subject, _ = claims["sub"].(string)
+	logout.SessionID, _ = claims["sid"].(string)
+	logout.ID, _ = claims["jti"].(string)
+	if logout.Subject == "" && logout.SessionID == "" {
+		return nil, fmt.Errorf("%w: sub or sid is required", ErrLogoutTokenInvalid)
+	}
+	return logout, nil
+}
+
+// audienceContains reports whether an "aud" claim (a string or an array) contains clientID
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Issuer returns the issuer URL set with SetIssuer
+func (p *CustomProvider) Issuer() string {
+	return p.issuerURL
+}
+
+// VerifyLogoutToken checks a back-channel logout token against the keys of the discovered JWKS
+func (p *CustomProvider) VerifyLogoutToken(ctx context.Context, raw string) (*LogoutClaims, error) {
+	config := p.Config() // Runs the first discovery if it has not run yet
+	jwksURL := p.JWKSURL()
+	ctx = p.clientContext(ctx)
+
+	claims, err := verifyJWT(raw, func(kid string) (crypto.PublicKey, error) {
+		return p.jwks.key(ctx, jwksURL, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLogoutTokenInvalid, err)
+	}
+	return validateLogoutClaims(claims, p.issuerURL, config.ClientID, time.Now())
+}
@@ -0,0 +1,121 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2/oidctest"
+)
+
+func TestManager_VerifyLogoutToken(t *testing.T) {
+	server, err := oidctest.NewServer(oidctest.Options{})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.Close()
+
+	provider := NewCustomProvider("idp", "client-1", "secret", "", "", "", "", nil, false)
+	provider.SetIssuer(server.URL, time.Hour)
+	manager := NewManager()
+	manager.AddProvider(provider)
+	manager.AddProvider(NewCustomProvider("no-issuer", "client-1", "secret", "", "https://idp.example.com/auth", "https://idp.example.com/token", "", nil, false))
+
+	token, err := server.Provider.LogoutToken("client-1", "user-1", "sid-1")
+	if err != nil {
+		t.Fatalf("LogoutToken() error = %v", err)
+	}
+	name, claims, err := manager.VerifyLogoutToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyLogoutToken() error = %v", err)
+	}
+	if name != "idp" || claims.Subject != "user-1" || claims.SessionID != "sid-1" || claims.ID == "" {
+		t.Errorf("VerifyLogoutToken() = %q %+v, want the claims of idp", name, claims)
+	}
+
+	// Tokens for another client, or tampered with, are rejected
+	other, _ := server.Provider.LogoutToken("client-2", "user-1", "")
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+server.URL+`","aud":"client-1","sub":"admin"}`)) + "." + parts[2]
+	for name, raw := range map[string]string{"other audience": other, "tampered": tampered, "malformed": "abc"} {
+		if _, _, err := manager.VerifyLogoutToken(context.Background(), raw); !errors.Is(err, ErrLogoutTokenInvalid) {
+			t.Errorf("%s: VerifyLogoutToken() error = %v, want ErrLogoutTokenInvalid", name, err)
+		}
+	}
+}
+
+func TestValidateLogoutClaims(t *testing.T) {
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    "https://idp.example.com/",
+			"aud":    []interface{}{"other", "client"},
+			"iat":    float64(now.Unix()),
+			"sid":    "sid-1",
+			"events": map[string]interface{}{BackchannelLogoutEvent: map[string]interface{}{}},
+		}
+	}
+
+	if claims, err := validateLogoutClaims(valid(), "https://idp.example.com", "client", now); err != nil || claims.SessionID != "sid-1" {
+		t.Fatalf("validateLogoutClaims() = %+v, %v, want the sid", claims, err)
+	}
+
+	tests := map[string]func(map[string]interface{}){
+		"other issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"other audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"no iat":         func(c map[string]interface{}) { delete(c, "iat") },
+		"old":            func(c map[string]interface{}) { c["iat"] = float64(now.Add(-time.Hour).Unix()) },
+		"future":         func(c map[string]interface{}) { c["iat"] = float64(now.Add(time.Hour).Unix()) },
+		"expired":        func(c map[string]interface{}) { c["exp"] = float64(now.Add(-time.Hour).Unix()) },
+		"no event":       func(c map[string]interface{}) { c["events"] = map[string]interface{}{} },
+		"nonce":          func(c map[string]interface{}) { c["nonce"] = "n" },
+		"no sub nor sid": func(c map[string]interface{}) { delete(c, "sid") },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			modify(claims)
+			if _, err := validateLogoutClaims(claims, "https://idp.example.com", "client", now); !errors.Is(err, ErrLogoutTokenInvalid) {
+				t.Errorf("validateLogoutClaims() error = %v, want ErrLogoutTokenInvalid", err)
+			}
+		})
+	}
+}
+
+func TestVerifyJWT_ES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec"})
+	payload, _ := json.Marshal(map[string]string{"sub": "user-1"})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	raw := input + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	keys := func(kid string) (crypto.PublicKey, error) { return &key.PublicKey, nil }
+	claims, err := verifyJWT(raw, keys)
+	if err != nil || claims["sub"] != "user-1" {
+		t.Fatalf("verifyJWT() = %v, %v, want the claims", claims, err)
+	}
+
+	// The algorithm must match the key type
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"ec"}`))
+	if _, err := verifyJWT(noneHeader+"."+strings.Split(raw, ".")[1]+".", keys); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("verifyJWT(alg none) error = %v, want ErrSignatureInvalid", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"golang.org/x/oauth2"
@@ -20,7 +21,8 @@ var (
 
 // Manager manages OAuth2 providers and authentication flow
 type Manager struct {
-	providers map[string]Provider
+	providers  map[string]Provider
+	httpClient *http.Client // Optional: client of token exchanges and provider APIs (egress proxy, CA bundle)
 }
 
 // NewManager creates a new OAuth2 manager
@@ -35,6 +37,20 @@ func (m *Manager) AddProvider(provider Provider) {
 	m.providers[provider.Name()] = provider
 }
 
+// SetHTTPClient sets the HTTP client used to reach providers (token exchange, userinfo and provider APIs)
+// A client already set in the request context with oauth2.HTTPClient takes precedence.
+func (m *Manager) SetHTTPClient(client *http.Client) {
+	m.httpClient = client
+}
+
+// HTTPContext returns ctx carrying the manager's HTTP client (oauth2.HTTPClient) when ctx has none
+func (m *Manager) HTTPContext(ctx context.Context) context.Context {
+	if m.httpClient == nil || ctx.Value(oauth2.HTTPClient) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, m.httpClient)
+}
+
 // GetProvider retrieves a provider by name
 func (m *Manager) GetProvider(name string) (Provider, error) {
 	provider, exists := m.providers[name]
@@ -61,7 +77,7 @@ func (m *Manager) GetAuthURL(providerName, state string) (string, error) {
 	}
 
 	config := provider.Config()
-	return config.AuthCodeURL(state, oauth2.AccessTypeOffline), nil
+	return config.AuthCodeURL(state, authCodeOptions(provider)...), nil
 }
 
 // GetAuthURLWithHost generates an authorization URL for a provider with a custom redirect URL
@@ -84,8 +100,10 @@ func (m *Manager) GetAuthURLWithHost(providerName, state, hostOrBaseURL, authPat
 //   - A host with port (e.g., "localhost:4182")
 //   - Just a host (e.g., "example.com")
 //
+// extraScopes are requested in addition to the provider's scopes (e.g., optional scopes the user approved).
+//
 // Returns: (authURL, redirectURL, error)
-func (m *Manager) GetAuthURLWithRedirect(providerName, state, hostOrBaseURL, authPathPrefix string) (string, string, error) {
+func (m *Manager) GetAuthURLWithRedirect(providerName, state, hostOrBaseURL, authPathPrefix string, extraScopes ...string) (string, string, error) {
 	provider, err := m.GetProvider(providerName)
 	if err != nil {
 		return "", "", err
@@ -101,6 +119,9 @@ func (m *Manager) GetAuthURLWithRedirect(providerName, state, hostOrBaseURL, aut
 		Endpoint:     originalConfig.Endpoint,
 		Scopes:       originalConfig.Scopes,
 	}
+	if len(extraScopes) > 0 {
+		config.Scopes = append(append([]string{}, originalConfig.Scopes...), extraScopes...)
+	}
 
 	// Normalize authPathPrefix
 	redirectPath := authPathPrefix
@@ -134,7 +155,7 @@ func (m *Manager) GetAuthURLWithRedirect(providerName, state, hostOrBaseURL, aut
 	redirectURL := fmt.Sprintf("%s%s/oauth2/callback", baseURL, redirectPath)
 	config.RedirectURL = redirectURL
 
-	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	authURL := config.AuthCodeURL(state, authCodeOptions(provider)...)
 	return authURL, redirectURL, nil
 }
 
@@ -145,8 +166,8 @@ func (m *Manager) Exchange(ctx context.Context, providerName, code string) (*oau
 		return nil, err
 	}
 
-	config := provider.Config()
-	token, err := config.Exchange(ctx, code)
+	config := *provider.Config()
+	token, err := exchangeCode(m.HTTPContext(ctx), provider, &config, code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -175,7 +196,7 @@ func (m *Manager) ExchangeWithRedirect(ctx context.Context, providerName, code,
 		RedirectURL:  redirectURL,
 	}
 
-	token, err := config.Exchange(ctx, code)
+	token, err := exchangeCode(m.HTTPContext(ctx), provider, config, code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code with redirect URL %s: %w", redirectURL, err)
 	}
@@ -183,6 +204,31 @@ func (m *Manager) ExchangeWithRedirect(ctx context.Context, providerName, code,
 	return token, nil
 }
 
+// RefreshToken obtains a new token from the provider with the refresh token of token
+func (m *Manager) RefreshToken(ctx context.Context, providerName string, token *oauth2.Token) (*oauth2.Token, error) {
+	provider, err := m.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	originalConfig := provider.Config()
+	config := &oauth2.Config{
+		ClientID:     originalConfig.ClientID,
+		ClientSecret: originalConfig.ClientSecret,
+		Endpoint:     originalConfig.Endpoint,
+		Scopes:       originalConfig.Scopes,
+	}
+
+	refreshed, err := refreshToken(m.HTTPContext(ctx), provider, config, token.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	return refreshed, nil
+}
+
 // GetUserInfo retrieves the user's information using a token
 func (m *Manager) GetUserInfo(ctx context.Context, providerName string, token *oauth2.Token) (*UserInfo, error) {
 	provider, err := m.GetProvider(providerName)
@@ -190,7 +236,7 @@ func (m *Manager) GetUserInfo(ctx context.Context, providerName string, token *o
 		return nil, err
 	}
 
-	return provider.GetUserInfo(ctx, token)
+	return provider.GetUserInfo(m.HTTPContext(ctx), token)
 }
 
 // GetUserEmail retrieves the user's email using a token (deprecated, use GetUserInfo)
@@ -3,6 +3,9 @@ package oauth2
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"golang.org/x/oauth2"
@@ -132,6 +135,37 @@ func TestManager_GetAuthURL(t *testing.T) {
 	}
 }
 
+func TestManager_GetAuthURLWithRedirect_ExtraScopes(t *testing.T) {
+	manager := NewManager()
+	scopes := []string{"openid", "email"}
+	manager.AddProvider(&MockProvider{
+		name: "mock",
+		config: &oauth2.Config{
+			ClientID: "test-client-id",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/auth"},
+			Scopes:   scopes,
+		},
+	})
+
+	authURL, _, err := manager.GetAuthURLWithRedirect("mock", "test-state", "https://app.example.com", "/_auth", "calendar")
+	if err != nil {
+		t.Fatalf("GetAuthURLWithRedirect() error = %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if got := u.Query().Get("scope"); got != "openid email calendar" {
+		t.Errorf("scope = %q, want the provider's scopes and the extra scope", got)
+	}
+	if len(scopes) != 2 {
+		t.Errorf("Provider scopes = %v, should not be changed", scopes)
+	}
+
+	authURL, _, _ = manager.GetAuthURLWithRedirect("mock", "test-state", "https://app.example.com", "/_auth")
+	u, _ = url.Parse(authURL)
+	if got := u.Query().Get("scope"); got != "openid email" {
+		t.Errorf("scope = %q, want the provider's scopes only", got)
+	}
+}
+
 func TestManager_GetUserEmail(t *testing.T) {
 	manager := NewManager()
 
@@ -184,3 +218,32 @@ func TestGenerateState(t *testing.T) {
 		t.Errorf("GenerateState() returned string of length %d, expected at least 40", len(state1))
 	}
 }
+
+func TestManager_SetHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	// Token requests to an unreachable host only succeed through the manager's client
+	provider := NewCustomProvider("idp", "client", "secret", "https://chat.example.com/_auth/oauth2/callback",
+		"https://idp.invalid/authorize", "https://idp.invalid/token", "https://idp.invalid/userinfo", nil, false)
+	manager := NewManager()
+	manager.AddProvider(provider)
+	manager.SetHTTPClient(&http.Client{Transport: &hostTransport{baseURL: server.URL}})
+
+	token, err := manager.Exchange(context.Background(), "idp", "code")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if token.AccessToken != "token" {
+		t.Errorf("AccessToken = %s, want token", token.AccessToken)
+	}
+
+	// A client set in the context takes precedence
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, http.DefaultClient)
+	if got := manager.HTTPContext(ctx).Value(oauth2.HTTPClient); got != http.DefaultClient {
+		t.Errorf("HTTPContext() client = %v, want the context client", got)
+	}
+}
@@ -2,17 +2,30 @@ package oauth2
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/microsoft"
 )
 
+// graphAPIURL is the base URL of the Microsoft Graph API (v1.0)
+const graphAPIURL = "https://graph.microsoft.com/v1.0"
+
+// maxGraphPages limits how many pages of group memberships are read
+const maxGraphPages = 10
+
 // MicrosoftProvider is the OAuth2 provider for Microsoft (Azure AD)
 type MicrosoftProvider struct {
-	id     string
-	config *oauth2.Config
+	id             string
+	config         *oauth2.Config
+	allowedTenants []string
+
+	clientAuthSetting // Optional: private_key_jwt or mutual TLS instead of the client secret
 }
 
 // NewMicrosoftProvider creates a new Microsoft OAuth2 provider
@@ -45,6 +58,15 @@ func NewMicrosoftProvider(id, clientID, clientSecret, redirectURL string, scopes
 	}
 }
 
+// SetAllowedTenants requires users to belong to one of the Entra tenants (tenant IDs, "tid" claim)
+// With a single tenant, users sign in at the tenant's own endpoint instead of "common"
+func (p *MicrosoftProvider) SetAllowedTenants(tenants []string) {
+	p.allowedTenants = tenants
+	if len(tenants) == 1 {
+		p.config.Endpoint = microsoft.AzureADEndpoint(tenants[0])
+	}
+}
+
 // Name returns the provider name (ID)
 func (p *MicrosoftProvider) Name() string {
 	return p.id
@@ -55,11 +77,17 @@ func (p *MicrosoftProvider) Config() *oauth2.Config {
 	return p.config
 }
 
+// DiscoveryURL returns the URL of the OpenID Connect discovery document of the sign-in tenant
+// (e.g., https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration)
+func (p *MicrosoftProvider) DiscoveryURL() string {
+	return strings.TrimSuffix(p.config.Endpoint.TokenURL, "/oauth2/v2.0/token") + "/v2.0/.well-known/openid-configuration"
+}
+
 // GetUserInfo retrieves the user's information from Microsoft Graph API
 func (p *MicrosoftProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
 	client := p.config.Client(ctx, token)
 
-	resp, err := client.Get("https://graph.microsoft.com/v1.0/me")
+	resp, err := client.Get(graphAPIURL + "/me")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -106,10 +134,43 @@ func (p *MicrosoftProvider) GetUserInfo(ctx context.Context, token *oauth2.Token
 	extra["_username"] = apiUserInfo.DisplayName
 	extra["_avatar_url"] = "" // Microsoft doesn't provide a direct URL
 
+	// Tenant, app roles and groups come from the ID token, which was received
+	// directly from the token endpoint over TLS (OIDC Core 3.1.3.7)
+	claims, err := idTokenClaims(token)
+	if err != nil && len(p.allowedTenants) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrAccessDenied, err)
+	}
+	tenantID, _ := claims["tid"].(string)
+	if len(p.allowedTenants) > 0 && !containsFold(p.allowedTenants, []string{tenantID}) {
+		return nil, fmt.Errorf("%w: tenant %q is not allowed", ErrAccessDenied, tenantID)
+	}
+	if tenantID != "" {
+		extra["tid"] = tenantID
+	}
+	if roles := claimStrings(claims["roles"]); len(roles) > 0 {
+		// Comma-separated so that they can be forwarded as extra.roles
+		extra["roles"] = strings.Join(roles, ",")
+	}
+
+	groups := claimStrings(claims["groups"])
+	if hasGroupOverage(claims) {
+		// Too many groups for the token: read them from Graph (GroupMember.Read.All permission)
+		groups, err = fetchGraphGroups(client)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAccessDenied, err)
+		}
+	}
+	if len(groups) > 0 {
+		extra["groups"] = strings.Join(groups, ",")
+	}
+
+	// Graph does not report verification: "mail" can be set to any address, while the
+	// userPrincipalName domain must be verified by the tenant, so only the latter counts
 	return &UserInfo{
-		Email: email,
-		Name:  apiUserInfo.DisplayName,
-		Extra: extra,
+		Email:         email,
+		EmailVerified: strings.EqualFold(email, apiUserInfo.UserPrincipalName),
+		Name:          apiUserInfo.DisplayName,
+		Extra:         extra,
 	}, nil
 }
 
@@ -121,3 +182,86 @@ func (p *MicrosoftProvider) GetUserEmail(ctx context.Context, token *oauth2.Toke
 	}
 	return userInfo.Email, nil
 }
+
+// idTokenClaims decodes the claims of the ID token returned with the access token
+// The signature is not verified: the token comes from the token endpoint, not from the browser
+func idTokenClaims(token *oauth2.Token) (map[string]interface{}, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("no ID token in the token response (is the openid scope requested?)")
+	}
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token: %w", err)
+	}
+	return claims, nil
+}
+
+// hasGroupOverage reports whether the user has more groups than fit in the token,
+// which Entra signals with a "groups" entry in "_claim_names" (or "hasgroups")
+func hasGroupOverage(claims map[string]interface{}) bool {
+	if claimNames, ok := claims["_claim_names"].(map[string]interface{}); ok {
+		if _, ok := claimNames["groups"]; ok {
+			return true
+		}
+	}
+	hasGroups, _ := claims["hasgroups"].(bool)
+	return hasGroups
+}
+
+// fetchGraphGroups returns the object IDs of the groups the user belongs to, including nested ones
+func fetchGraphGroups(client *http.Client) ([]string, error) {
+	var groups []string
+	next := graphAPIURL + "/me/transitiveMemberOf/microsoft.graph.group?$select=id&$top=999"
+	for page := 0; page < maxGraphPages && next != ""; page++ {
+		resp, err := client.Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user groups: %w", err)
+		}
+
+		var list struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		err = func() error {
+			defer func() { _ = resp.Body.Close() }()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to get user groups: status %d", resp.StatusCode)
+			}
+			return json.NewDecoder(resp.Body).Decode(&list)
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range list.Value {
+			groups = append(groups, g.ID)
+		}
+		next = list.NextLink
+	}
+	return groups, nil
+}
+
+// claimStrings returns the strings of a JSON array claim
+func claimStrings(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -2,9 +2,12 @@ package oauth2
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	oauth2lib "golang.org/x/oauth2"
@@ -228,3 +231,145 @@ func TestMicrosoftProvider_GetUserEmail(t *testing.T) {
 		})
 	}
 }
+
+// testIDToken returns an unsigned JWT with the claims
+func testIDToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to encode claims: %v", err)
+	}
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestMicrosoftProvider_SetAllowedTenants(t *testing.T) {
+	provider := NewMicrosoftProvider("microsoft", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+	provider.SetAllowedTenants([]string{"72f988bf-86f1-41af-91ab-2d7cd011db47"})
+
+	if !strings.Contains(provider.Config().Endpoint.AuthURL, "/72f988bf-86f1-41af-91ab-2d7cd011db47/") {
+		t.Errorf("AuthURL = %s, want the tenant endpoint", provider.Config().Endpoint.AuthURL)
+	}
+
+	provider = NewMicrosoftProvider("microsoft", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+	provider.SetAllowedTenants([]string{"72f988bf-86f1-41af-91ab-2d7cd011db47", "11111111-2222-3333-4444-555555555555"})
+	if !strings.Contains(provider.Config().Endpoint.AuthURL, "/common/") {
+		t.Errorf("AuthURL = %s, want the common endpoint for multiple tenants", provider.Config().Endpoint.AuthURL)
+	}
+}
+
+func TestMicrosoftProvider_GetUserInfo_TenantAndRoles(t *testing.T) {
+	const tenant = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+
+	tests := []struct {
+		name        string
+		tenants     []string
+		claims      map[string]interface{}
+		graphStatus int
+		wantErr     bool
+		wantRoles   interface{}
+		wantGroups  interface{}
+		noIDToken   bool
+	}{
+		{
+			name:    "allowed tenant",
+			tenants: []string{tenant},
+			claims:  map[string]interface{}{"tid": tenant},
+		},
+		{
+			name:    "other tenant",
+			tenants: []string{tenant},
+			claims:  map[string]interface{}{"tid": "11111111-2222-3333-4444-555555555555"},
+			wantErr: true,
+		},
+		{
+			name:      "no ID token with tenant restriction",
+			tenants:   []string{tenant},
+			noIDToken: true,
+			wantErr:   true,
+		},
+		{
+			name:      "no ID token without tenant restriction",
+			noIDToken: true,
+		},
+		{
+			name:       "roles and groups claims",
+			claims:     map[string]interface{}{"tid": tenant, "roles": []string{"Admin", "Reader"}, "groups": []string{"group-1"}},
+			wantRoles:  "Admin,Reader",
+			wantGroups: "group-1",
+		},
+		{
+			name: "group overage",
+			claims: map[string]interface{}{
+				"tid":          tenant,
+				"_claim_names": map[string]interface{}{"groups": "src1"},
+			},
+			graphStatus: http.StatusOK,
+			wantGroups:  "group-1,group-2",
+		},
+		{
+			name: "group overage lookup fails",
+			claims: map[string]interface{}{
+				"tid":       tenant,
+				"hasgroups": true,
+			},
+			graphStatus: http.StatusForbidden,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/v1.0/me", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"mail":              "user@example.com",
+					"userPrincipalName": "user@example.com",
+				})
+			})
+			mux.HandleFunc("/v1.0/me/transitiveMemberOf/microsoft.graph.group", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.graphStatus)
+				if r.URL.Query().Get("page") == "" {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"value":           []map[string]interface{}{{"id": "group-1"}},
+						"@odata.nextLink": graphAPIURL + "/me/transitiveMemberOf/microsoft.graph.group?page=2",
+					})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"value": []map[string]interface{}{{"id": "group-2"}},
+				})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			provider := NewMicrosoftProvider("microsoft", "test-client-id", "test-client-secret", "http://localhost/callback", nil, false)
+			provider.SetAllowedTenants(tt.tenants)
+
+			token := &oauth2lib.Token{AccessToken: "test-token"}
+			if !tt.noIDToken {
+				token = token.WithExtra(map[string]interface{}{"id_token": testIDToken(t, tt.claims)})
+			}
+
+			ctx := context.WithValue(context.Background(), oauth2lib.HTTPClient, &http.Client{
+				Transport: &hostTransport{baseURL: server.URL},
+			})
+			userInfo, err := provider.GetUserInfo(ctx, token)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrAccessDenied) {
+					t.Errorf("GetUserInfo() error = %v, want ErrAccessDenied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserInfo() unexpected error = %v", err)
+			}
+			if userInfo.Extra["roles"] != tt.wantRoles {
+				t.Errorf("Extra[roles] = %v, want %v", userInfo.Extra["roles"], tt.wantRoles)
+			}
+			if userInfo.Extra["groups"] != tt.wantGroups {
+				t.Errorf("Extra[groups] = %v, want %v", userInfo.Extra["groups"], tt.wantGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+// Package oidctest provides a fake OpenID Connect provider with configurable users, so that
+// complete sign-in flows can run in integration tests and local development without real
+// Google, GitHub or Microsoft credentials.
+//
+//	server, _ := oidctest.NewServer(oidctest.Options{AutoLogin: "someone@example.com"})
+//	defer server.Close()
+//	// Configure a "custom" provider with issuer_url: server.URL
+//
+// The provider serves discovery, authorization (a user picker, or AutoLogin), token (with an
+// RS256 ID token), userinfo and JWKS endpoints; `chatbotgate dev idp` serves it from the command line.
+// ID tokens carry a "sid" per sign-in, and LogoutToken signs back-channel logout tokens.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint paths, relative to the issuer
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	AuthorizationPath = "/authorize"
+	TokenPath         = "/token"
+	UserInfoPath      = "/userinfo"
+	JWKSPath          = "/jwks"
+)
+
+const (
+	// DefaultTokenTTL is the lifetime of access and ID tokens when Options.TokenTTL is not set
+	DefaultTokenTTL = 5 * time.Minute
+
+	// codeTTL is the lifetime of authorization codes
+	codeTTL = 2 * time.Minute
+)
+
+// ErrUserUnidentified is returned when a user has neither a subject, an email nor a name
+var ErrUserUnidentified = errors.New("user needs a sub, email or name")
+
+// User is a user that can sign in at the provider
+type User struct {
+	Subject    string                 `yaml:"sub" json:"sub"`               // "sub" claim (default: the email, or the name)
+	Email      string                 `yaml:"email" json:"email"`           // Omitted from the claims when empty
+	Name       string                 `yaml:"name" json:"name"`             // Omitted from the claims when empty
+	Unverified bool                   `yaml:"unverified" json:"unverified"` // Sends email_verified: false
+	Claims     map[string]interface{} `yaml:"claims" json:"claims"`         // Additional userinfo and ID token claims (e.g., groups)
+}
+
+// DefaultUsers are the users of a provider created without users
+var DefaultUsers = []User{
+	{Email: "someone@example.com", Name: "Test User"},
+	{Email: "unverified@example.com", Name: "Unverified User", Unverified: true},
+	{Subject: "noemail", Name: "No Email User"},
+}
+
+// subject returns the "sub" claim of the user
+func (u User) subject() string {
+	if u.Subject != "" {
+		return u.Subject
+	}
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.Name
+}
+
+// claims returns the userinfo claims of the user
+func (u User) claims() map[string]interface{} {
+	claims := make(map[string]interface{}, len(u.Claims)+4)
+	for name, value := range u.Claims {
+		claims[name] = value
+	}
+	claims["sub"] = u.subject()
+	if u.Email != "" {
+		claims["email"] = u.Email
+		claims["email_verified"] = !u.Unverified
+	}
+	if u.Name != "" {
+		claims["name"] = u.Name
+	}
+	return claims
+}
+
+// Options configures a Provider
+type Options struct {
+	Issuer       string        // URL the provider is reached at (NewServer sets it)
+	ClientID     string        // Expected client ID (empty accepts any)
+	ClientSecret string        // Expected client secret (empty accepts any)
+	RedirectURIs []string      // Allowed redirect URIs (empty allows any)
+	Users        []User        // Users to sign in as (default: DefaultUsers)
+	AutoLogin    string        // Email or subject of a user signed in without the picker
+	TokenTTL     time.Duration // Lifetime of access and ID tokens (default: DefaultTokenTTL)
+	Log          io.Writer     // Optional: receives a line per sign-in and token request
+}
+
+// grant is an issued authorization code or access token
+type grant struct {
+	user          User
+	clientID      string
+	redirectURI   string
+	scope         string
+	nonce         string
+	codeChallenge string
+	challengeAlg  string
+	sid           string // Provider session of the sign-in ("sid" claim)
+	expiresAt     time.Time
+}
+
+// Provider is a fake OpenID Connect provider
+type Provider struct {
+	opts  Options
+	key   *rsa.PrivateKey
+	keyID string
+	now   func() time.Time
+
+	mu     sync.Mutex
+	codes  map[string]*grant
+	tokens map[string]*grant
+}
+
+// NewProvider creates a provider with a freshly generated RSA signing key
+func NewProvider(opts Options) (*Provider, error) {
+	if len(opts.Users) == 0 {
+		opts.Users = DefaultUsers
+	}
+	for i, user := range opts.Users {
+		if user.subject() == "" {
+			return nil, fmt.Errorf("users[%d]: %w", i, ErrUserUnidentified)
+		}
+	}
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	thumbprint := sha256.Sum256(key.N.Bytes())
+
+	return &Provider{
+		opts:   opts,
+		key:    key,
+		keyID:  hex.EncodeToString(thumbprint[:8]),
+		now:    time.Now,
+		codes:  make(map[string]*grant),
+		tokens: make(map[string]*grant),
+	}, nil
+}
+
+// SetIssuer sets the URL the provider is reached at
+func (p *Provider) SetIssuer(issuer string) {
+	p.opts.Issuer = strings.TrimSuffix(issuer, "/")
+}
+
+// Issuer returns the issuer URL
+func (p *Provider) Issuer() string {
+	return p.opts.Issuer
+}
+
+// PublicKey returns the key that verifies ID tokens
+func (p *Provider) PublicKey() *rsa.PublicKey {
+	return &p.key.PublicKey
+}
+
+// Users returns the users that can sign in
+func (p *Provider) Users() []User {
+	return p.opts.Users
+}
+
+// ServeHTTP serves the provider's endpoints
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case DiscoveryPath:
+		p.handleDiscovery(w, r)
+	case AuthorizationPath:
+		p.handleAuthorize(w, r)
+	case TokenPath:
+		p.handleToken(w, r)
+	case UserInfoPath:
+		p.handleUserInfo(w, r)
+	case JWKSPath:
+		p.handleJWKS(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Server is a Provider served by an httptest.Server, with the issuer set to its URL
+type Server struct {
+	*httptest.Server
+	Provider *Provider
+}
+
+// NewServer starts a provider on a local port; call Close when done
+func NewServer(opts Options) (*Server, error) {
+	provider, err := NewProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+	server := httptest.NewServer(provider)
+	provider.SetIssuer(server.URL)
+	return &Server{Server: server, Provider: provider}, nil
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.opts.Issuer,
+		"authorization_endpoint":                p.opts.Issuer + AuthorizationPath,
+		"token_endpoint":                        p.opts.Issuer + TokenPath,
+		"userinfo_endpoint":                     p.opts.Issuer + UserInfoPath,
+		"jwks_uri":                              p.opts.Issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"backchannel_logout_supported":          true,
+		"backchannel_logout_session_supported":  true,
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorizeParams are the parameters of an authorization request kept through the user picker
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method",
+}
+
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	// Errors before the redirect URI is validated are shown, not redirected (RFC 6749 section 4.1.2.1)
+	clientID, redirectURI := params.Get("client_id"), params.Get("redirect_uri")
+	if clientID == "" || (p.opts.ClientID != "" && clientID != p.opts.ClientID) {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(redirectURI); err != nil || !u.IsAbs() || !p.redirectAllowed(redirectURI) {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if params.Get("response_type") != "code" {
+		redirectError(w, r, redirectURI, params.Get("state"), "unsupported_response_type")
+		return
+	}
+	if method := params.Get("code_challenge_method"); method != "" && method != "S256" && method != "plain" {
+		redirectError(w, r, redirectURI, params.Get("state"), "invalid_request")
+		return
+	}
+
+	login := params.Get("login_hint")
+	if r.Method == http.MethodPost {
+		if params.Get("deny") != "" {
+			redirectError(w, r, redirectURI, params.Get("state"), "access_denied")
+			return
+		}
+		login = params.Get("user")
+	} else if login == "" {
+		login = p.opts.AutoLogin
+	}
+	if login == "" {
+		p.renderPicker(w, params)
+		return
+	}
+	user, ok := p.findUser(login)
+	if !ok {
+		if r.Method == http.MethodPost {
+			http.Error(w, "unknown user", http.StatusBadRequest)
+			return
+		}
+		p.renderPicker(w, params)
+		return
+	}
+
+	code := randomToken()
+	challengeAlg := params.Get("code_challenge_method")
+	if challengeAlg == "" {
+		challengeAlg = "plain"
+	}
+	p.mu.Lock()
+	p.codes[code] = &grant{
+		user:          user,
+		clientID:      clientID,
+		redirectURI:   redirectURI,
+		scope:         params.Get("scope"),
+		nonce:         params.Get("nonce"),
+		codeChallenge: params.Get("code_challenge"),
+		challengeAlg:  challengeAlg,
+		sid:           randomToken(),
+		expiresAt:     p.now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+	p.logf("authorize: signed in %s for client %s", user.subject(), clientID)
+
+	query := url.Values{"code": {code}}
+	if state := params.Get("state"); state != "" {
+		query.Set("state", state)
+	}
+	http.Redirect(w, r, withQuery(redirectURI, query), http.StatusFound)
+}
+
+// redirectAllowed reports whether a redirect URI is registered (any is allowed without RedirectURIs)
+func (p *Provider) redirectAllowed(redirectURI string) bool {
+	if len(p.opts.RedirectURIs) == 0 {
+		return true
+	}
+	for _, allowed := range p.opts.RedirectURIs {
+		if redirectURI == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// findUser returns the user with an email or subject
+func (p *Provider) findUser(login string) (User, bool) {
+	for _, user := range p.opts.Users {
+		if user.subject() == login || (user.Email != "" && strings.EqualFold(user.Email, login)) {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// pickerTemplate lists the users, posting the choice back with the authorization request
+var pickerTemplate = template.Must(template.New("picker").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Mock OpenID Connect Provider</title></head>
+<body>
+<h1>Sign in as</h1>
+<form method="post">
+{{range .Params}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}{{range .Users}}<p><button type="submit" name="user" value="{{.Subject}}">{{if .Name}}{{.Name}}{{else}}{{.Subject}}{{end}}{{if .Email}} &lt;{{.Email}}&gt;{{end}}{{if .Unverified}} (unverified){{end}}</button></p>
+{{end}}<p><button type="submit" name="deny" value="1">Deny access</button></p>
+</form>
+</body>
+</html>
+`))
+
+type pickerParam struct {
+	Name  string
+	Value string
+}
+
+func (p *Provider) renderPicker(w http.ResponseWriter, params url.Values) {
+	data := struct {
+		Params []pickerParam
+		Users  []User
+	}{}
+	for _, name := range authorizeParams {
+		if value := params.Get(name); value != "" {
+			data.Params = append(data.Params, pickerParam{Name: name, Value: value})
+		}
+	}
+	for _, user := range p.opts.Users {
+		user.Subject = user.subject()
+		data.Users = append(data.Users, user)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = pickerTemplate.Execute(w, data)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		// client_secret_basic credentials are form-encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || !p.clientAuthenticated(clientID, clientSecret) {
+		p.logf("token: invalid client %q", clientID)
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Codes are single-use, even when the exchange fails
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || p.now().After(g.expiresAt) || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if g.codeChallenge != "" && !verifyChallenge(g.codeChallenge, g.challengeAlg, r.PostForm.Get("code_verifier")) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := p.now()
+	idToken, err := p.idToken(g, now)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	accessToken := randomToken()
+	p.mu.Lock()
+	token := *g
+	token.expiresAt = now.Add(p.opts.TokenTTL)
+	p.tokens[accessToken] = &token
+	p.mu.Unlock()
+	p.logf("token: issued tokens for %s", g.user.subject())
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.opts.TokenTTL / time.Second),
+		"id_token":     idToken,
+	}
+	if g.scope != "" {
+		response["scope"] = g.scope
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+// clientAuthenticated reports whether the client credentials match the configured ones
+func (p *Provider) clientAuthenticated(clientID, clientSecret string) bool {
+	if p.opts.ClientID != "" && clientID != p.opts.ClientID {
+		return false
+	}
+	return p.opts.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.opts.ClientSecret)) == 1
+}
+
+// verifyChallenge checks a PKCE code verifier against the challenge of the authorization request
+func verifyChallenge(challenge, method, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(verifier)) == 1
+}
+
+// idToken returns the RS256-signed ID token of a grant
+func (p *Provider) idToken(g *grant, now time.Time) (string, error) {
+	claims := g.user.claims()
+	claims["iss"] = p.opts.Issuer
+	claims["aud"] = g.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.opts.TokenTTL).Unix()
+	claims["sid"] = g.sid
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	return p.sign(claims)
+}
+
+// LogoutToken returns an RS256-signed OIDC back-channel logout token for clientID
+// It logs out the sessions of the subject, or of the provider session sid when not empty
+// ("sid" claim of the ID token); one of the two is required.
+func (p *Provider) LogoutToken(clientID, subject, sid string) (string, error) {
+	now := p.now()
+	claims := map[string]interface{}{
+		"iss":    p.opts.Issuer,
+		"aud":    clientID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(2 * time.Minute).Unix(),
+		"jti":    randomToken(),
+		"events": map[string]interface{}{"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{}},
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	return p.sign(claims)
+}
+
+// sign returns the claims as a JWT signed with the provider's key
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	g, found := p.tokens[accessToken]
+	p.mu.Unlock()
+	if !ok || !found || p.now().After(g.expiresAt) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, g.user.claims())
+}
+
+// logf writes a line to Options.Log
+func (p *Provider) logf(format string, args ...interface{}) {
+	if p.opts.Log != nil {
+		_, _ = fmt.Fprintf(p.opts.Log, format+"\n", args...)
+	}
+}
+
+// redirectError sends an authorization error back to the client (RFC 6749 section 4.1.2.1)
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code string) {
+	query := url.Values{"error": {code}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	http.Redirect(w, r, withQuery(redirectURI, query), http.StatusFound)
+}
+
+// withQuery adds query parameters to a URL that may already have some
+func withQuery(rawURL string, query url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	values := u.Query()
+	for name, value := range query {
+		values[name] = value
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// tokenError writes a token endpoint error response (RFC 6749 section 5.2)
+func tokenError(w http.ResponseWriter, status int, code string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// randomToken returns a random token for codes and access tokens
+func randomToken() string {
+	return rand.Text()
+}
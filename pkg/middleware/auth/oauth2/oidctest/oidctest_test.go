@@ -0,0 +1,326 @@
+package oidctest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	chatbotoauth2 "github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testClientID     = "test-client"
+	testClientSecret = "test-secret"
+	testRedirectURI  = "http://gate.example.com/_auth/oauth2/callback"
+)
+
+// noRedirectClient returns redirects as responses, like a browser before it follows them
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func newTestServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	opts.ClientID, opts.ClientSecret = testClientID, testClientSecret
+	server, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testConfig(server *Server) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURI,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + AuthorizationPath,
+			TokenURL: server.URL + TokenPath,
+		},
+	}
+}
+
+// authorize sends an authorization request and returns the query of the redirect back to the client
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	resp, err := noRedirectClient.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET authorize error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return redirectQuery(t, resp)
+}
+
+func redirectQuery(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURI) {
+		t.Fatalf("Location = %q, want a redirect to %q", location, testRedirectURI)
+	}
+	return location.Query()
+}
+
+func TestServer_CustomProviderSignIn(t *testing.T) {
+	server := newTestServer(t, Options{AutoLogin: "someone@example.com"})
+
+	provider := chatbotoauth2.NewCustomProvider("dev", testClientID, testClientSecret, testRedirectURI, "", "", "", nil, false)
+	provider.SetIssuer(server.URL, time.Hour)
+	if err := provider.Discover(context.Background()); err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if provider.JWKSURL() != server.URL+JWKSPath {
+		t.Errorf("JWKSURL() = %q, want %q", provider.JWKSURL(), server.URL+JWKSPath)
+	}
+
+	query := authorize(t, provider.Config().AuthCodeURL("state-1"))
+	if query.Get("state") != "state-1" {
+		t.Errorf("state = %q, want %q", query.Get("state"), "state-1")
+	}
+	token, err := provider.Config().Exchange(context.Background(), query.Get("code"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	userInfo, err := provider.GetUserInfo(context.Background(), token)
+	if err != nil {
+		t.Fatalf("GetUserInfo() error = %v", err)
+	}
+	if userInfo.Email != "someone@example.com" || userInfo.Name != "Test User" || !userInfo.EmailVerified {
+		t.Errorf("GetUserInfo() = %+v, want the verified Test User", userInfo)
+	}
+}
+
+func TestServer_Picker(t *testing.T) {
+	server := newTestServer(t, Options{Users: []User{
+		{Email: "alice@example.com", Name: "Alice", Claims: map[string]interface{}{"groups": []string{"admins"}}},
+		{Email: "bob@example.com", Name: "Bob"},
+	}})
+	authURL := testConfig(server).AuthCodeURL("state-1")
+
+	resp, err := http.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET authorize error = %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Alice &lt;alice@example.com&gt;") || !strings.Contains(string(page), `value="state-1"`) {
+		t.Fatalf("picker page does not list the users with the request:\n%s", page)
+	}
+
+	form := url.Values{}
+	parsed, _ := url.Parse(authURL)
+	for name, values := range parsed.Query() {
+		form[name] = values
+	}
+	form.Set("user", "bob@example.com")
+	resp, err = noRedirectClient.PostForm(server.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatalf("POST authorize error = %v", err)
+	}
+	_ = resp.Body.Close()
+	query := redirectQuery(t, resp)
+
+	token, err := testConfig(server).Exchange(context.Background(), query.Get("code"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	claims := verifyIDToken(t, server.Provider.PublicKey(), token.Extra("id_token").(string))
+	if claims["email"] != "bob@example.com" || claims["aud"] != testClientID || claims["iss"] != server.URL {
+		t.Errorf("ID token claims = %v, want Bob's for the test client", claims)
+	}
+
+	form.Del("user")
+	form.Set("deny", "1")
+	resp, err = noRedirectClient.PostForm(server.URL+AuthorizationPath, form)
+	if err != nil {
+		t.Fatalf("POST authorize error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if query := redirectQuery(t, resp); query.Get("error") != "access_denied" {
+		t.Errorf("denied error = %q, want access_denied", query.Get("error"))
+	}
+}
+
+func TestServer_LoginHint(t *testing.T) {
+	server := newTestServer(t, Options{})
+	authURL := testConfig(server).AuthCodeURL("s", oauth2.SetAuthURLParam("login_hint", "noemail"), oauth2.SetAuthURLParam("nonce", "n-1"))
+
+	token, err := testConfig(server).Exchange(context.Background(), authorize(t, authURL).Get("code"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	claims := verifyIDToken(t, server.Provider.PublicKey(), token.Extra("id_token").(string))
+	if claims["sub"] != "noemail" || claims["nonce"] != "n-1" {
+		t.Errorf("ID token claims = %v, want the no-email user with the nonce", claims)
+	}
+	if _, ok := claims["email"]; ok {
+		t.Errorf("ID token claims = %v, want no email", claims)
+	}
+}
+
+func TestServer_TokenErrors(t *testing.T) {
+	server := newTestServer(t, Options{AutoLogin: "someone@example.com"})
+	config := testConfig(server)
+
+	tests := []struct {
+		name   string
+		config func() *oauth2.Config
+		code   func() string
+		want   string
+	}{
+		{
+			name: "wrong secret",
+			config: func() *oauth2.Config {
+				c := *config
+				c.ClientSecret = "wrong"
+				return &c
+			},
+			code: func() string { return authorize(t, config.AuthCodeURL("s")).Get("code") },
+			want: "invalid_client",
+		},
+		{
+			name:   "unknown code",
+			config: func() *oauth2.Config { return config },
+			code:   func() string { return "dummy" },
+			want:   "invalid_grant",
+		},
+		{
+			name: "redirect URI mismatch",
+			config: func() *oauth2.Config {
+				c := *config
+				c.RedirectURL = "http://other.example.com/callback"
+				return &c
+			},
+			code: func() string { return authorize(t, config.AuthCodeURL("s")).Get("code") },
+			want: "invalid_grant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.config().Exchange(context.Background(), tt.code())
+			var retrieveErr *oauth2.RetrieveError
+			if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != tt.want {
+				t.Errorf("Exchange() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("code reuse", func(t *testing.T) {
+		code := authorize(t, config.AuthCodeURL("s")).Get("code")
+		if _, err := config.Exchange(context.Background(), code); err != nil {
+			t.Fatalf("first Exchange() error = %v", err)
+		}
+		if _, err := config.Exchange(context.Background(), code); err == nil {
+			t.Error("second Exchange() succeeded, want invalid_grant")
+		}
+	})
+}
+
+func TestServer_PKCE(t *testing.T) {
+	server := newTestServer(t, Options{AutoLogin: "someone@example.com"})
+	config := testConfig(server)
+	verifier := oauth2.GenerateVerifier()
+	code := authorize(t, config.AuthCodeURL("s", oauth2.S256ChallengeOption(verifier))).Get("code")
+
+	if _, err := config.Exchange(context.Background(), code, oauth2.VerifierOption("wrong-verifier")); err == nil {
+		t.Fatal("Exchange() with the wrong verifier succeeded")
+	}
+	code = authorize(t, config.AuthCodeURL("s", oauth2.S256ChallengeOption(verifier))).Get("code")
+	if _, err := config.Exchange(context.Background(), code, oauth2.VerifierOption(verifier)); err != nil {
+		t.Errorf("Exchange() error = %v", err)
+	}
+}
+
+func TestServer_UserInfoExpiry(t *testing.T) {
+	server := newTestServer(t, Options{AutoLogin: "someone@example.com", TokenTTL: time.Minute})
+	config := testConfig(server)
+	token, err := config.Exchange(context.Background(), authorize(t, config.AuthCodeURL("s")).Get("code"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", server.URL+UserInfoPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET userinfo error = %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := get(); status != http.StatusOK {
+		t.Fatalf("userinfo status = %d, want 200", status)
+	}
+	server.Provider.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if status := get(); status != http.StatusUnauthorized {
+		t.Errorf("userinfo status after expiry = %d, want 401", status)
+	}
+}
+
+func TestServer_AuthorizeRejectsUnknownRedirect(t *testing.T) {
+	server := newTestServer(t, Options{AutoLogin: "someone@example.com", RedirectURIs: []string{testRedirectURI}})
+	config := testConfig(server)
+	config.RedirectURL = "http://evil.example.com/callback"
+
+	resp, err := noRedirectClient.Get(config.AuthCodeURL("s"))
+	if err != nil {
+		t.Fatalf("GET authorize error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 without a redirect", resp.StatusCode)
+	}
+}
+
+func TestNewProvider_UnidentifiedUser(t *testing.T) {
+	if _, err := NewProvider(Options{Users: []User{{Claims: map[string]interface{}{"role": "x"}}}}); !errors.Is(err, ErrUserUnidentified) {
+		t.Errorf("NewProvider() error = %v, want ErrUserUnidentified", err)
+	}
+}
+
+// verifyIDToken checks the RS256 signature of an ID token and returns its claims
+func verifyIDToken(t *testing.T, key *rsa.PublicKey, idToken string) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("ID token has %d parts, want 3", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("invalid signature encoding: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("ID token signature does not verify: %v", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("invalid payload encoding: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	return claims
+}
@@ -13,13 +13,23 @@ var (
 
 	// ErrEmailNotFound is returned when user email is not found in OAuth2 response
 	ErrEmailNotFound = errors.New("user email not found in OAuth2 response")
+
+	// ErrAccessDenied is returned when the user does not meet the provider's membership requirements
+	ErrAccessDenied = errors.New("user does not meet the membership requirements")
+
+	// ErrDiscoveryInvalid is returned when an OpenID Connect discovery document is malformed or names another issuer
+	ErrDiscoveryInvalid = errors.New("invalid OpenID Connect discovery document")
+
+	// ErrNoRefreshToken is returned when a token cannot be refreshed because the provider issued no refresh token
+	ErrNoRefreshToken = errors.New("no refresh token")
 )
 
 // UserInfo represents user information from OAuth2 provider
 type UserInfo struct {
-	Email string                 // User's email address
-	Name  string                 // User's display name (optional)
-	Extra map[string]interface{} // Additional data from OAuth2 provider (for custom forwarding)
+	Email         string                 // User's email address
+	EmailVerified bool                   // Whether the provider has verified the email address
+	Name          string                 // User's display name (optional)
+	Extra         map[string]interface{} // Additional data from OAuth2 provider (for custom forwarding)
 }
 
 // Provider is an interface for OAuth2 providers
@@ -30,3 +40,17 @@ type Provider interface {
 	// Deprecated: Use GetUserInfo instead
 	GetUserEmail(ctx context.Context, token *oauth2.Token) (string, error)
 }
+
+// AuthCodeOptioner is implemented by providers that add parameters to the authorization URL
+type AuthCodeOptioner interface {
+	AuthCodeOptions() []oauth2.AuthCodeOption
+}
+
+// authCodeOptions returns the authorization URL options of a provider
+func authCodeOptions(provider Provider) []oauth2.AuthCodeOption {
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOffline}
+	if p, ok := provider.(AuthCodeOptioner); ok {
+		opts = append(opts, p.AuthCodeOptions()...)
+	}
+	return opts
+}
@@ -0,0 +1,235 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// MaxClockSkew is the clock difference to a provider above which the self-test reports a problem
+// ID tokens and signed client assertions are usually rejected beyond a few minutes of skew
+const MaxClockSkew = time.Minute
+
+// maxCheckBodyBytes limits how much of a discovery document or token endpoint response is read
+const maxCheckBodyBytes = 1 << 20
+
+// selfTestCode is the authorization code sent to token endpoints by the self-test
+// Providers reject it, which proves the endpoint is reachable without issuing a token
+const selfTestCode = "chatbotgate-self-test"
+
+// Discoverer is implemented by providers that publish an OpenID Connect discovery document
+// DiscoveryURL returns an empty string when the provider has none (e.g., a custom provider without issuer_url)
+type Discoverer interface {
+	DiscoveryURL() string
+}
+
+// ProviderCheck is the result of a provider connectivity self-test
+type ProviderCheck struct {
+	Provider         string    `json:"provider"`                     // Provider ID
+	Reachable        bool      `json:"reachable"`                    // Whether the token endpoint answered
+	TokenEndpoint    string    `json:"token_endpoint"`               // Configured token endpoint
+	DiscoveryURL     string    `json:"discovery_url,omitempty"`      // OpenID Connect discovery document, if the provider has one
+	Status           int       `json:"status,omitempty"`             // HTTP status of the token endpoint probe
+	ClockSkewSeconds float64   `json:"clock_skew_seconds,omitempty"` // Provider clock minus local clock (from the Date header)
+	RedirectURL      string    `json:"redirect_url"`                 // Callback URL to register with the provider
+	Hints            []string  `json:"hints,omitempty"`              // Likely configuration problems
+	Error            string    `json:"error,omitempty"`              // First connection error
+	CheckedAt        time.Time `json:"checked_at"`
+}
+
+// OK reports whether the provider is reachable and no problems were found
+func (c ProviderCheck) OK() bool {
+	return c.Reachable && c.Error == "" && len(c.Hints) == 0
+}
+
+// CheckProvider tests that a provider's discovery document and token endpoint are reachable
+// The token endpoint is probed with a dummy authorization code, and its error response is used
+// to hint at invalid client credentials or a redirect URI mismatch.
+// The HTTP client is taken from ctx (oauth2.HTTPClient), like token exchanges.
+func CheckProvider(ctx context.Context, provider Provider) ProviderCheck {
+	cfg := provider.Config()
+	check := ProviderCheck{
+		Provider:      provider.Name(),
+		TokenEndpoint: cfg.Endpoint.TokenURL,
+		RedirectURL:   cfg.RedirectURL,
+		CheckedAt:     time.Now(),
+	}
+	client := contextClient(ctx)
+
+	if d, ok := provider.(Discoverer); ok && d.DiscoveryURL() != "" {
+		check.DiscoveryURL = d.DiscoveryURL()
+		if err := checkDiscovery(ctx, client, &check); err != nil {
+			check.Error = fmt.Sprintf("discovery document: %v", err)
+		}
+	}
+
+	if err := probeTokenEndpoint(ctx, client, cfg, clientAuthOf(provider), &check); err != nil && check.Error == "" {
+		check.Error = fmt.Sprintf("token endpoint: %v", err)
+	}
+
+	check.Hints = append(check.Hints, RedirectURLHints(cfg.RedirectURL)...)
+	return check
+}
+
+// checkDiscovery fetches the discovery document and compares its token endpoint with the configured one
+func checkDiscovery(ctx context.Context, client *http.Client, check *ProviderCheck) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.DiscoveryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	check.recordClockSkew(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCheckBodyBytes)).Decode(&doc); err != nil {
+		return fmt.Errorf("invalid document: %w", err)
+	}
+	if doc.TokenEndpoint != "" && doc.TokenEndpoint != check.TokenEndpoint {
+		check.Hints = append(check.Hints, fmt.Sprintf("Discovery document lists token endpoint %s, but %s is configured", doc.TokenEndpoint, check.TokenEndpoint))
+	}
+	return nil
+}
+
+// probeTokenEndpoint posts a dummy authorization code to the token endpoint
+// The client authenticates like in token exchanges (client secret, private_key_jwt or mutual TLS).
+// Any response below 500 proves the endpoint is reachable; OAuth2 error codes become hints
+func probeTokenEndpoint(ctx context.Context, client *http.Client, cfg *oauth2.Config, auth *ClientAuth, check *ProviderCheck) error {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {selfTestCode},
+		"redirect_uri": {cfg.RedirectURL},
+		"client_id":    {cfg.ClientID},
+	}
+	if auth == nil {
+		form.Set("client_secret", cfg.ClientSecret)
+	} else {
+		params, err := auth.tokenParams(cfg.ClientID, cfg.Endpoint.TokenURL)
+		if err != nil {
+			return err
+		}
+		for key := range params {
+			form.Set(key, params.Get(key))
+		}
+		client = contextClient(auth.clientContext(context.WithValue(ctx, oauth2.HTTPClient, client)))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	check.recordClockSkew(resp)
+	check.Status = resp.StatusCode
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	check.Reachable = true
+
+	// GitHub answers with 200 and an error in the body, others with 400/401
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCheckBodyBytes))
+	if hint := tokenErrorHint(resp.Header.Get("Content-Type"), body); hint != "" {
+		check.Hints = append(check.Hints, hint)
+	}
+	return nil
+}
+
+// tokenErrorHint translates the OAuth2 error code of a token endpoint response into a hint
+// invalid_grant is the expected answer to the dummy code and yields no hint
+func tokenErrorHint(contentType string, body []byte) string {
+	var code string
+	if strings.Contains(contentType, "json") {
+		var resp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &resp) == nil {
+			code = resp.Error
+		}
+	} else if values, err := url.ParseQuery(string(body)); err == nil {
+		code = values.Get("error")
+	}
+
+	switch code {
+	case "invalid_client", "unauthorized_client", "incorrect_client_credentials":
+		return "Token endpoint rejected the client credentials; check client_id and client_secret"
+	case "redirect_uri_mismatch":
+		return "Token endpoint reported a redirect URI mismatch; register the redirect URL with the provider"
+	}
+	return ""
+}
+
+// recordClockSkew stores the difference between the provider's Date header and the local clock
+// Skew beyond MaxClockSkew adds a hint once
+func (c *ProviderCheck) recordClockSkew(resp *http.Response) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	skew := time.Until(date).Round(time.Second)
+	if c.ClockSkewSeconds == 0 {
+		c.ClockSkewSeconds = skew.Seconds()
+		if skew > MaxClockSkew || skew < -MaxClockSkew {
+			c.Hints = append(c.Hints, fmt.Sprintf("Local clock differs from the provider by %s; synchronize the system clock (NTP)", skew))
+		}
+	}
+}
+
+// RedirectURLHints returns likely problems of a callback URL that providers would reject or never reach
+func RedirectURLHints(redirectURL string) []string {
+	if redirectURL == "" {
+		return []string{"No redirect URL is configured"}
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Host == "" {
+		return []string{fmt.Sprintf("Redirect URL %q is not an absolute URL; check server.base_url", redirectURL)}
+	}
+
+	if isLoopbackHost(u.Hostname()) {
+		return []string{fmt.Sprintf("Redirect URL %s points to this machine; set server.base_url to the public URL unless this is a development setup", redirectURL)}
+	}
+	if u.Scheme == "http" {
+		return []string{fmt.Sprintf("Redirect URL %s uses http; most providers only accept https except for localhost", redirectURL)}
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether a host name refers to the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// contextClient returns the HTTP client set in ctx with oauth2.HTTPClient, or http.DefaultClient
+func contextClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
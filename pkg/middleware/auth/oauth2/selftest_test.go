@@ -0,0 +1,138 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	oauth2lib "golang.org/x/oauth2"
+)
+
+func TestCheckProvider_Discovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"token_endpoint":"https://oauth2.googleapis.com/token"}`))
+		case "/token":
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != selfTestCode || r.PostForm.Get("client_id") != "client" {
+				t.Errorf("Unexpected token request: %v", r.PostForm)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		default:
+			t.Errorf("Unexpected request: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGoogleProvider("google", "client", "secret", "https://chat.example.com/_auth/oauth2/callback", nil, false)
+	ctx := context.WithValue(context.Background(), oauth2lib.HTTPClient, &http.Client{Transport: &hostTransport{baseURL: server.URL}})
+
+	check := CheckProvider(ctx, provider)
+
+	if !check.Reachable || check.Status != http.StatusBadRequest || check.Error != "" {
+		t.Errorf("Check = %+v, want reachable with status 400 and no error", check)
+	}
+	if check.DiscoveryURL != provider.DiscoveryURL() {
+		t.Errorf("DiscoveryURL = %s, want %s", check.DiscoveryURL, provider.DiscoveryURL())
+	}
+	if !check.OK() {
+		t.Errorf("OK() = false, hints: %v", check.Hints)
+	}
+}
+
+func TestCheckProvider_Problems(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		contentType   string
+		body          string
+		date          time.Time
+		wantReachable bool
+		wantHint      string
+	}{
+		{"server error", http.StatusBadGateway, "text/plain", "bad gateway", time.Time{}, false, ""},
+		{"invalid client", http.StatusUnauthorized, "application/json", `{"error":"invalid_client"}`, time.Time{}, true, "client credentials"},
+		{"GitHub form error", http.StatusOK, "application/x-www-form-urlencoded", "error=incorrect_client_credentials", time.Time{}, true, "client credentials"},
+		{"redirect mismatch", http.StatusBadRequest, "application/json", `{"error":"redirect_uri_mismatch"}`, time.Time{}, true, "redirect URI mismatch"},
+		{"clock skew", http.StatusBadRequest, "application/json", `{"error":"invalid_grant"}`, time.Now().Add(-10 * time.Minute), true, "Local clock differs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tt.date.IsZero() {
+					w.Header().Set("Date", tt.date.UTC().Format(http.TimeFormat))
+				}
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			provider := NewCustomProvider("sso", "client", "secret", "https://chat.example.com/_auth/oauth2/callback",
+				server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", nil, false)
+
+			check := CheckProvider(context.Background(), provider)
+
+			if check.Reachable != tt.wantReachable {
+				t.Errorf("Reachable = %v, want %v (error: %s)", check.Reachable, tt.wantReachable, check.Error)
+			}
+			if !tt.wantReachable && check.Error == "" {
+				t.Error("Error is empty for an unreachable provider")
+			}
+			if tt.wantHint == "" {
+				return
+			}
+			if len(check.Hints) != 1 || !strings.Contains(check.Hints[0], tt.wantHint) {
+				t.Errorf("Hints = %v, want one containing %q", check.Hints, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestRedirectURLHints(t *testing.T) {
+	tests := []struct {
+		redirectURL string
+		wantHint    string
+	}{
+		{"https://chat.example.com/_auth/oauth2/callback", ""},
+		{"http://chat.example.com/_auth/oauth2/callback", "uses http"},
+		{"http://localhost:4180/_auth/oauth2/callback", "points to this machine"},
+		{"http://127.0.0.1:4180/_auth/oauth2/callback", "points to this machine"},
+		{"/_auth/oauth2/callback", "not an absolute URL"},
+		{"", "No redirect URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.redirectURL, func(t *testing.T) {
+			hints := RedirectURLHints(tt.redirectURL)
+			if tt.wantHint == "" {
+				if len(hints) != 0 {
+					t.Errorf("RedirectURLHints() = %v, want none", hints)
+				}
+				return
+			}
+			if len(hints) != 1 || !strings.Contains(hints[0], tt.wantHint) {
+				t.Errorf("RedirectURLHints() = %v, want one containing %q", hints, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestMicrosoftProvider_DiscoveryURL(t *testing.T) {
+	provider := NewMicrosoftProvider("microsoft", "client", "secret", "https://chat.example.com/_auth/oauth2/callback", nil, false)
+	if got, want := provider.DiscoveryURL(), "https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration"; got != want {
+		t.Errorf("DiscoveryURL() = %s, want %s", got, want)
+	}
+
+	provider.SetAllowedTenants([]string{"72f988bf-86f1-41af-91ab-2d7cd011db47"})
+	if got, want := provider.DiscoveryURL(), "https://login.microsoftonline.com/72f988bf-86f1-41af-91ab-2d7cd011db47/v2.0/.well-known/openid-configuration"; got != want {
+		t.Errorf("DiscoveryURL() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrSigningKeyInvalid is returned when a PEM private key cannot be parsed or has an unsupported type
+var ErrSigningKeyInvalid = errors.New("invalid signing key")
+
+// JWTSigner signs JWTs with a private key
+// RSA (RS256), ECDSA P-256 (ES256) and Ed25519 (EdDSA) keys are supported, the algorithms verifyJWT accepts.
+type JWTSigner struct {
+	signer crypto.Signer
+	alg    string // JWS algorithm of signer
+	keyID  string // Optional "kid" header
+}
+
+// NewJWTSigner creates a JWTSigner from a PEM private key (PKCS #8, PKCS #1 RSA or SEC 1 EC)
+// keyID is sent as the "kid" header when not empty.
+func NewJWTSigner(keyPEM []byte, keyID string) (*JWTSigner, error) {
+	signer, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	var alg string
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		alg = "RS256"
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ECDSA keys must use the P-256 curve", ErrSigningKeyInvalid)
+		}
+		alg = "ES256"
+	case ed25519.PrivateKey:
+		alg = "EdDSA"
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrSigningKeyInvalid, signer)
+	}
+	return &JWTSigner{signer: signer, alg: alg, keyID: keyID}, nil
+}
+
+// Algorithm returns the JWS algorithm of the key ("RS256", "ES256" or "EdDSA")
+func (s *JWTSigner) Algorithm() string {
+	return s.alg
+}
+
+// KeyID returns the "kid" header of the signed JWTs (may be empty)
+func (s *JWTSigner) KeyID() string {
+	return s.keyID
+}
+
+// Sign returns a compact JWS of the claims
+// The "alg", "typ" and "kid" headers are set; extra adds other headers (e.g., "x5t").
+func (s *JWTSigner) Sign(claims interface{}, extra map[string]string) (string, error) {
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.keyID != "" {
+		header["kid"] = s.keyID
+	}
+	for name, value := range extra {
+		header[name] = value
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	signature, err := s.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// PublicJWK returns the public key as a JSON Web Key (RFC 7517), to be published in a JWKS
+func (s *JWTSigner) PublicJWK() map[string]string {
+	jwk := map[string]string{"use": "sig", "alg": s.alg}
+	if s.keyID != "" {
+		jwk["kid"] = s.keyID
+	}
+	switch key := s.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk["kty"], jwk["crv"] = "EC", "P-256"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
+		jwk["y"] = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk["kty"], jwk["crv"] = "OKP", "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(key)
+	}
+	return jwk
+}
+
+// Thumbprint returns the JWK thumbprint of the public key (RFC 7638), usable as a key ID
+func (s *JWTSigner) Thumbprint() string {
+	// The required members only, in lexicographic order (json.Marshal sorts map keys)
+	jwk := s.PublicJWK()
+	required := make(map[string]string)
+	for _, name := range []string{"crv", "e", "kty", "n", "x", "y"} {
+		if value, ok := jwk[name]; ok {
+			required[name] = value
+		}
+	}
+	data, _ := json.Marshal(required)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Verify checks that a compact JWS was signed with the key and returns its decoded claims
+// Only the signature is checked: callers validate "iss", "exp" and the other claims.
+func (s *JWTSigner) Verify(raw string) (map[string]interface{}, error) {
+	return verifyJWT(raw, func(kid string) (crypto.PublicKey, error) {
+		if kid != s.keyID {
+			return nil, fmt.Errorf("%w: unknown key ID %q", ErrSignatureInvalid, kid)
+		}
+		return s.signer.Public(), nil
+	})
+}
+
+// sign signs a JWS signing input with the algorithm of the key
+func (s *JWTSigner) sign(input []byte) ([]byte, error) {
+	switch s.alg {
+	case "RS256":
+		digest := sha256.Sum256(input)
+		return s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case "ES256":
+		digest := sha256.Sum256(input)
+		der, err := s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaJWSSignature(der, 32)
+	default: // EdDSA signs the message itself
+		return s.signer.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+}
+
+// ecdsaJWSSignature converts an ASN.1 ECDSA signature to the fixed-size r||s form of JWS (RFC 7518 section 3.4)
+func ecdsaJWSSignature(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 2*size)
+	sig.R.FillBytes(out[:size])
+	sig.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// parsePrivateKey parses a PEM private key (PKCS #8, PKCS #1 RSA or SEC 1 EC)
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrSigningKeyInvalid)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrSigningKeyInvalid, key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported PEM block %q", ErrSigningKeyInvalid, block.Type)
+}
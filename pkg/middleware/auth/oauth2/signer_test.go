@@ -0,0 +1,90 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJWTSigner_SignVerifiesWithPublicJWK(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	for alg, key := range map[string]crypto.Signer{"RS256": rsaKey, "ES256": ecKey, "EdDSA": edKey} {
+		t.Run(alg, func(t *testing.T) {
+			signer, err := NewJWTSigner(testKeyPEM(t, key), "key-1")
+			if err != nil {
+				t.Fatalf("NewJWTSigner() error = %v", err)
+			}
+			if signer.Algorithm() != alg {
+				t.Errorf("Algorithm() = %q, want %q", signer.Algorithm(), alg)
+			}
+
+			raw, err := signer.Sign(map[string]string{"sub": "user-1"}, nil)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			// The published key verifies the token, as a relying party reading the JWKS would
+			data, _ := json.Marshal(signer.PublicJWK())
+			var jwk jsonWebKey
+			if err := json.Unmarshal(data, &jwk); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			publicKey, err := jwk.publicKey()
+			if err != nil {
+				t.Fatalf("publicKey() error = %v", err)
+			}
+			claims, err := verifyJWT(raw, func(kid string) (crypto.PublicKey, error) {
+				if kid != "key-1" {
+					t.Errorf("kid = %q, want key-1", kid)
+				}
+				return publicKey, nil
+			})
+			if err != nil || claims["sub"] != "user-1" {
+				t.Errorf("verifyJWT() = %v, %v, want the claims", claims, err)
+			}
+		})
+	}
+}
+
+func TestJWTSigner_Thumbprint(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a, _ := NewJWTSigner(testKeyPEM(t, key), "")
+	b, _ := NewJWTSigner(testKeyPEM(t, key), "other-kid")
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c, _ := NewJWTSigner(testKeyPEM(t, other), "")
+
+	if a.Thumbprint() != b.Thumbprint() {
+		t.Error("Thumbprint() should not depend on the key ID")
+	}
+	if a.Thumbprint() == c.Thumbprint() || len(a.Thumbprint()) != 43 {
+		t.Errorf("Thumbprint() = %q, want a distinct base64url SHA-256", a.Thumbprint())
+	}
+}
+
+func TestJWTSigner_Verify(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer, _ := NewJWTSigner(testKeyPEM(t, key), "key-1")
+	otherSigner, _ := NewJWTSigner(testKeyPEM(t, other), "key-1")
+
+	raw, _ := signer.Sign(map[string]string{"sub": "user-1"}, nil)
+	if claims, err := signer.Verify(raw); err != nil || claims["sub"] != "user-1" {
+		t.Errorf("Verify() = %v, %v, want the claims", claims, err)
+	}
+	if _, err := otherSigner.Verify(raw); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("Verify(other key) error = %v, want ErrSignatureInvalid", err)
+	}
+	renamed, _ := NewJWTSigner(testKeyPEM(t, key), "key-2")
+	if _, err := renamed.Verify(raw); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("Verify(other kid) error = %v, want ErrSignatureInvalid", err)
+	}
+}
@@ -17,3 +17,17 @@ func (t *testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 	return http.DefaultTransport.RoundTrip(req)
 }
+
+// hostTransport sends requests to a test server, keeping their path and query
+type hostTransport struct {
+	baseURL string
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := req.URL.Parse(t.baseURL + req.URL.RequestURI())
+	if err != nil {
+		return nil, err
+	}
+	req.URL = target
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
@@ -19,8 +21,10 @@ type Handler struct {
 	sessionStore   kvs.Store
 	cookieConfig   config.CookieConfig
 	authPathPrefix string
+	mountPath      string // server.mount_path: path of the session cookie and the default redirect
 	translator     *i18n.Translator
 	logger         logging.Logger
+	clock          clock.Clock // Time of session creation
 }
 
 // NewHandler creates a new password authentication handler
@@ -32,9 +36,20 @@ func NewHandler(cfg config.PasswordAuthConfig, sessionStore kvs.Store, cookieCon
 		authPathPrefix: authPathPrefix,
 		translator:     translator,
 		logger:         logger,
+		clock:          clock.Real,
 	}
 }
 
+// SetClock replaces the system clock, e.g. with a clock.Fake in tests
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = clock.OrReal(c)
+}
+
+// SetMountPath sets the path the application is mounted under (server.mount_path, "" for the root)
+func (h *Handler) SetMountPath(mountPath string) {
+	h.mountPath = mountPath
+}
+
 // HandleLogin handles the password login
 func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -67,6 +82,7 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create session
+	now := h.clock.Now()
 	sessionID := generateSessionID()
 	sess := &session.Session{
 		ID:       sessionID,
@@ -77,15 +93,15 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			"_email":      "password@localhost",
 			"_username":   "Password User",
 			"_avatar_url": "",
-			"auth_time":   time.Now().Format(time.RFC3339),
+			"auth_time":   now.Format(time.RFC3339),
 		},
-		CreatedAt:     time.Now(),
-		ExpiresAt:     time.Now().Add(7 * 24 * time.Hour), // 7 days default
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(7 * 24 * time.Hour), // 7 days default
 		Authenticated: true,
 	}
 
 	// Save session
-	if err := session.Set(h.sessionStore, sessionID, sess); err != nil {
+	if err := session.SetAt(h.sessionStore, sessionID, sess, now); err != nil {
 		h.logger.Error("Failed to save session", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -93,11 +109,16 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	// Set cookie
 	expireDuration, _ := h.cookieConfig.GetExpireDuration()
+	cookiePath := "/"
+	if h.mountPath != "" {
+		cookiePath = h.mountPath
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     h.cookieConfig.Name,
 		Value:    sessionID,
-		Path:     "/",
-		Expires:  time.Now().Add(expireDuration),
+		Path:     cookiePath,
+		Domain:   h.cookieConfig.Domain,
+		Expires:  time.Now().Add(expireDuration), // Read by the browser, so not the injected clock
 		Secure:   h.cookieConfig.Secure,
 		HttpOnly: h.cookieConfig.HTTPOnly,
 		SameSite: h.cookieConfig.GetSameSite(),
@@ -108,7 +129,7 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	// Return redirect URL
 	redirectURL := r.URL.Query().Get("redirect")
 	if redirectURL == "" {
-		redirectURL = "/"
+		redirectURL = h.mountPath + "/"
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -119,9 +140,12 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SessionIDPrefix starts the IDs of password sessions
+const SessionIDPrefix = "pwd_"
+
 // generateSessionID generates a random session ID
 func generateSessionID() string {
-	return fmt.Sprintf("pwd_%d", time.Now().UnixNano())
+	return fmt.Sprintf("%s%d", SessionIDPrefix, time.Now().UnixNano())
 }
 
 // RenderPasswordForm renders the password form HTML
@@ -144,13 +168,13 @@ func (h *Handler) RenderPasswordForm(lang i18n.Language) string {
 	if prefix[0] != '/' {
 		prefix = "/" + prefix
 	}
-	iconPath := prefix + "/assets/icons/password.svg"
+	iconPath := prefix + "/assets/" + assets.FingerprintedName("icons/password.svg")
 
 	return fmt.Sprintf(`
 <form id="password-form">
 	<div class="form-group">
 		<label class="label" for="password-input">%s</label>
-		<input type="password" id="password-input" name="password" class="input" placeholder="Enter password" required />
+		<input type="password" id="password-input" name="password" class="input" placeholder="Enter password" autocomplete="current-password" required />
 	</div>
 	<button type="submit" id="password-button" class="btn btn-primary provider-btn">
 		<img src="%s" alt="Password">
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/session"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
@@ -318,7 +319,7 @@ func TestRenderPasswordForm(t *testing.T) {
 	}
 
 	// Should contain password icon path
-	if !bytes.Contains([]byte(htmlEN), []byte(`/_auth/assets/icons/password.svg`)) {
+	if !bytes.Contains([]byte(htmlEN), []byte("/_auth/assets/"+assets.FingerprintedName("icons/password.svg"))) {
 		t.Error("RenderPasswordForm() should contain password icon path")
 	}
 
@@ -341,7 +342,7 @@ func TestRenderPasswordForm_CustomAuthPrefix(t *testing.T) {
 	html := handler.RenderPasswordForm(i18n.English)
 
 	// Should use custom prefix for icon path
-	if !bytes.Contains([]byte(html), []byte(`/custom-auth/assets/icons/password.svg`)) {
+	if !bytes.Contains([]byte(html), []byte("/custom-auth/assets/"+assets.FingerprintedName("icons/password.svg"))) {
 		t.Error("RenderPasswordForm() should use custom auth prefix for icon path")
 	}
 }
@@ -358,7 +359,7 @@ func TestRenderPasswordForm_EmptyAuthPrefix(t *testing.T) {
 	html := handler.RenderPasswordForm(i18n.English)
 
 	// Should use default /_auth prefix
-	if !bytes.Contains([]byte(html), []byte(`/_auth/assets/icons/password.svg`)) {
+	if !bytes.Contains([]byte(html), []byte("/_auth/assets/"+assets.FingerprintedName("icons/password.svg"))) {
 		t.Error("RenderPasswordForm() should use default /_auth prefix when authPathPrefix is empty")
 	}
 }
@@ -2,6 +2,7 @@ package authz
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 )
@@ -18,50 +19,95 @@ type Checker interface {
 }
 
 // EmailChecker checks authorization based on email whitelist
+// The whitelist can be replaced at runtime with SetEmails (admin API)
 type EmailChecker struct {
+	mu             sync.RWMutex
+	entries        []string
 	allowedEmails  map[string]bool
 	allowedDomains []string
+	allowedHashes  map[string]bool           // Entries given as email hashes (privacy.minimize)
+	hashEmail      func(email string) string // Hash function of allowedHashes, or nil
 }
 
 // NewEmailChecker creates a new EmailChecker from configuration
 func NewEmailChecker(cfg config.AccessControlConfig) *EmailChecker {
+	c := &EmailChecker{}
+	c.SetEmails(cfg.Emails)
+	return c
+}
+
+// SetEmails replaces the whitelist with entries in the format of access_control.emails
+func (c *EmailChecker) SetEmails(entries []string) {
 	// Convert allowed entries to emails and domains
 	// Entries starting with @ are domains, others are email addresses
 	emailMap := make(map[string]bool)
+	hashMap := make(map[string]bool)
 	var domains []string
+	var kept []string
 
-	for _, entry := range cfg.Emails {
+	for _, entry := range entries {
 		entry = strings.TrimSpace(entry)
 		if entry == "" {
 			continue
 		}
+		kept = append(kept, entry)
 
 		if strings.HasPrefix(entry, "@") {
 			// Domain entry
 			domains = append(domains, strings.ToLower(entry))
+		} else if config.IsEmailHash(entry) {
+			// Email hash entry, matched by hashing the email
+			hashMap[strings.ToLower(entry)] = true
 		} else {
 			// Email address entry
 			emailMap[strings.ToLower(entry)] = true
 		}
 	}
 
-	return &EmailChecker{
-		allowedEmails:  emailMap,
-		allowedDomains: domains,
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = kept
+	c.allowedEmails = emailMap
+	c.allowedDomains = domains
+	c.allowedHashes = hashMap
+}
+
+// SetEmailHasher sets the hash function of the allowlist entries given as email hashes
+// (privacy.minimize); without it, such entries match no email.
+func (c *EmailChecker) SetEmailHasher(hash func(email string) string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashEmail = hash
+}
+
+// Emails returns the entries of the whitelist
+func (c *EmailChecker) Emails() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.entries...)
 }
 
 // RequiresEmail returns true if email-based authorization is required
 // Returns false if no whitelist is configured (authentication alone is sufficient)
 func (c *EmailChecker) RequiresEmail() bool {
-	return len(c.allowedEmails) > 0 || len(c.allowedDomains) > 0
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.requiresEmail()
+}
+
+// requiresEmail reports whether a whitelist is configured; c.mu must be held
+func (c *EmailChecker) requiresEmail() bool {
+	return len(c.allowedEmails) > 0 || len(c.allowedDomains) > 0 || len(c.allowedHashes) > 0
 }
 
 // IsAllowed checks if an email address is authorized
 // If no whitelist is configured, always returns true
 func (c *EmailChecker) IsAllowed(email string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// If no whitelist is configured, allow all authenticated users
-	if !c.RequiresEmail() {
+	if !c.requiresEmail() {
 		return true
 	}
 
@@ -71,6 +117,9 @@ func (c *EmailChecker) IsAllowed(email string) bool {
 	if c.allowedEmails[email] {
 		return true
 	}
+	if len(c.allowedHashes) > 0 && c.hashEmail != nil && c.allowedHashes[c.hashEmail(email)] {
+		return true
+	}
 
 	// Check if email domain is in the allowed domains
 	parts := strings.Split(email, "@")
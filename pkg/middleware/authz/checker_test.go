@@ -192,3 +192,44 @@ func TestEmailChecker_RequiresEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestEmailChecker_SetEmails(t *testing.T) {
+	checker := NewEmailChecker(config.AccessControlConfig{Emails: []string{"user@example.com"}})
+
+	checker.SetEmails([]string{" @company.com ", ""})
+	if checker.IsAllowed("user@example.com") {
+		t.Error("IsAllowed(user@example.com) = true after the whitelist was replaced")
+	}
+	if !checker.IsAllowed("alice@company.com") {
+		t.Error("IsAllowed(alice@company.com) = false, want true")
+	}
+	if got := checker.Emails(); len(got) != 1 || got[0] != "@company.com" {
+		t.Errorf("Emails() = %v, want [@company.com]", got)
+	}
+
+	checker.SetEmails(nil)
+	if checker.RequiresEmail() {
+		t.Error("RequiresEmail() = true with an empty whitelist")
+	}
+}
+
+func TestEmailChecker_HashedEntries(t *testing.T) {
+	privacy := config.PrivacyConfig{Minimize: true, Salt: "test-salt-0123456789"}
+	checker := NewEmailChecker(config.AccessControlConfig{Emails: []string{privacy.HashEmail("alice@example.com")}})
+	if !checker.RequiresEmail() {
+		t.Error("RequiresEmail() = false with a hashed entry")
+	}
+
+	// Without hasher, hashed entries match nothing
+	if checker.IsAllowed("alice@example.com") {
+		t.Error("IsAllowed() = true without hasher")
+	}
+
+	checker.SetEmailHasher(privacy.HashEmail)
+	if !checker.IsAllowed("Alice@Example.com") {
+		t.Error("IsAllowed(Alice@Example.com) = false, want true")
+	}
+	if checker.IsAllowed("bob@example.com") {
+		t.Error("IsAllowed(bob@example.com) = true, want false")
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Announcement severities
+const (
+	SeverityInfo     = "info"     // Default: neutral notice
+	SeverityWarning  = "warning"  // E.g., planned maintenance
+	SeverityCritical = "critical" // E.g., an ongoing outage
+)
+
+// AnnouncementConfig is a banner shown on the login and error pages, e.g. a planned maintenance notice
+// It can be replaced at runtime via the admin API (/_auth/admin/announcement).
+type AnnouncementConfig struct {
+	Message  string            `yaml:"message" json:"message"`              // Banner text in Markdown (emphasis, links, code); empty disables the banner
+	Messages map[string]string `yaml:"messages" json:"messages,omitempty"`  // Optional: Text per language ("en", "ja", "ar", "he"), falling back to message
+	Severity string            `yaml:"severity" json:"severity,omitempty"`  // Optional: "info" (default), "warning" or "critical"
+	StartsAt time.Time         `yaml:"starts_at" json:"starts_at,omitzero"` // Optional: Shown from this time (RFC 3339, e.g., "2026-03-14T22:00:00Z")
+	EndsAt   time.Time         `yaml:"ends_at" json:"ends_at,omitzero"`     // Optional: Shown until this time
+}
+
+// Enabled reports whether the announcement has a message
+func (a AnnouncementConfig) Enabled() bool {
+	if a.Message != "" {
+		return true
+	}
+	for _, message := range a.Messages {
+		if message != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveAt reports whether the announcement is shown at now
+func (a AnnouncementConfig) ActiveAt(now time.Time) bool {
+	if !a.Enabled() {
+		return false
+	}
+	if !a.StartsAt.IsZero() && now.Before(a.StartsAt) {
+		return false
+	}
+	return a.EndsAt.IsZero() || now.Before(a.EndsAt)
+}
+
+// MessageFor returns the text of the announcement in lang
+func (a AnnouncementConfig) MessageFor(lang string) string {
+	if message := a.Messages[lang]; message != "" {
+		return message
+	}
+	if a.Message != "" {
+		return a.Message
+	}
+	// Only translations: the English one, else any
+	if message := a.Messages["en"]; message != "" {
+		return message
+	}
+	for _, message := range a.Messages {
+		if message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// GetSeverity returns the severity of the announcement
+func (a AnnouncementConfig) GetSeverity() string {
+	if a.Severity == "" {
+		return SeverityInfo
+	}
+	return a.Severity
+}
+
+// Validate checks the announcement
+func (a AnnouncementConfig) Validate() error {
+	verr := NewValidationError()
+
+	switch a.GetSeverity() {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		verr.Add(fmt.Errorf("announcement.severity: %w", ErrAnnouncementSeverityInvalid))
+	}
+
+	if !a.StartsAt.IsZero() && !a.EndsAt.IsZero() && !a.EndsAt.After(a.StartsAt) {
+		verr.Add(fmt.Errorf("announcement.ends_at: %w", ErrAnnouncementWindowInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementConfig_Validate(t *testing.T) {
+	start := time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		announcement AnnouncementConfig
+		wantErr      error
+	}{
+		{"no announcement", AnnouncementConfig{}, nil},
+		{"valid announcement", AnnouncementConfig{Message: "Maintenance", Severity: SeverityWarning, StartsAt: start, EndsAt: start.Add(time.Hour)}, nil},
+		{"invalid severity", AnnouncementConfig{Message: "Maintenance", Severity: "urgent"}, ErrAnnouncementSeverityInvalid},
+		{"end before start", AnnouncementConfig{Message: "Maintenance", StartsAt: start, EndsAt: start.Add(-time.Hour)}, ErrAnnouncementWindowInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.announcement.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnnouncementConfig_ActiveAt(t *testing.T) {
+	start := time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC)
+	announcement := AnnouncementConfig{Message: "Maintenance", StartsAt: start, EndsAt: start.Add(time.Hour)}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"before start", start.Add(-time.Minute), false},
+		{"at start", start, true},
+		{"within window", start.Add(30 * time.Minute), true},
+		{"at end", start.Add(time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := announcement.ActiveAt(tt.now); got != tt.want {
+				t.Errorf("ActiveAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (AnnouncementConfig{StartsAt: start}).ActiveAt(start) {
+		t.Error("ActiveAt() of an announcement without message should be false")
+	}
+}
+
+func TestAnnouncementConfig_MessageFor(t *testing.T) {
+	announcement := AnnouncementConfig{Message: "Maintenance tonight", Messages: map[string]string{"ja": "今夜メンテナンス"}}
+	if got := announcement.MessageFor("ja"); got != "今夜メンテナンス" {
+		t.Errorf("MessageFor(ja) = %q", got)
+	}
+	if got := announcement.MessageFor("he"); got != "Maintenance tonight" {
+		t.Errorf("MessageFor(he) = %q, want the default message", got)
+	}
+
+	translated := AnnouncementConfig{Messages: map[string]string{"en": "Maintenance", "ja": "メンテナンス"}}
+	if !translated.Enabled() {
+		t.Error("Announcement with translations only should be enabled")
+	}
+	if got := translated.MessageFor("ar"); got != "Maintenance" {
+		t.Errorf("MessageFor(ar) = %q, want the English message", got)
+	}
+}
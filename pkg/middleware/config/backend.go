@@ -0,0 +1,100 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// Chatbot backends supported by ForwardingConfig.Backend
+const (
+	BackendOpenAI    = "openai"    // OpenAI-compatible APIs (user field in the JSON body)
+	BackendFlowise   = "flowise"   // Flowise prediction API (overrideConfig.vars.user in the JSON body)
+	BackendLibreChat = "librechat" // LibreChat behind a trusted proxy (X-Forwarded-Email / X-Forwarded-User headers)
+)
+
+// BackendProfile describes how a chatbot backend identifies end users
+type BackendProfile struct {
+	BodyPath string            // Path prefix of API requests whose JSON body gets the body fields (empty: all paths)
+	Fields   []ForwardingField // Forwarding fields added when the backend is selected
+}
+
+// backendProfiles holds the built-in backend profiles
+var backendProfiles = map[string]BackendProfile{
+	BackendOpenAI: {
+		BodyPath: "/v1",
+		Fields: []ForwardingField{
+			{Path: "email", Body: "user"},
+		},
+	},
+	BackendFlowise: {
+		BodyPath: "/api/v1/prediction",
+		Fields: []ForwardingField{
+			{Path: "email", Body: "overrideConfig.vars.user"},
+		},
+	},
+	BackendLibreChat: {
+		Fields: []ForwardingField{
+			{Path: "email", Header: "X-Forwarded-Email"},
+			{Path: "username", Header: "X-Forwarded-User"},
+			{Path: "email", Header: "X-Forwarded-User"}, // Email auth has no username
+		},
+	},
+}
+
+// LookupBackendProfile returns the built-in profile for a backend name
+func LookupBackendProfile(name string) (BackendProfile, bool) {
+	profile, ok := backendProfiles[strings.ToLower(name)]
+	return profile, ok
+}
+
+// BackendNames returns the names of the built-in backend profiles in alphabetical order
+func BackendNames() []string {
+	names := make([]string, 0, len(backendProfiles))
+	for name := range backendProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EffectiveFields returns the configured fields followed by the backend profile's fields
+// Profile fields whose header or body target is already configured are skipped,
+// so explicit fields always override the profile
+func (f ForwardingConfig) EffectiveFields() []ForwardingField {
+	profile, ok := LookupBackendProfile(f.Backend)
+	if !ok {
+		return f.Fields
+	}
+
+	headers := make(map[string]bool)
+	bodies := make(map[string]bool)
+	for _, field := range f.Fields {
+		if field.Header != "" {
+			headers[strings.ToLower(field.Header)] = true
+		}
+		if field.Body != "" {
+			bodies[field.Body] = true
+		}
+	}
+
+	fields := append([]ForwardingField{}, f.Fields...)
+	for _, field := range profile.Fields {
+		if headers[strings.ToLower(field.Header)] || bodies[field.Body] {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// GetBodyPath returns the path prefix of requests whose JSON body gets the body fields
+// Defaults to the backend profile's API path, or "/" (all paths) without a backend
+func (f ForwardingConfig) GetBodyPath() string {
+	if f.BodyPath != "" {
+		return f.BodyPath
+	}
+	if profile, ok := LookupBackendProfile(f.Backend); ok && profile.BodyPath != "" {
+		return profile.BodyPath
+	}
+	return "/"
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForwardingConfig_EffectiveFields(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ForwardingConfig
+		want []ForwardingField
+	}{
+		{
+			name: "no backend",
+			cfg:  ForwardingConfig{Fields: []ForwardingField{{Path: "email", Header: "X-Email"}}},
+			want: []ForwardingField{{Path: "email", Header: "X-Email"}},
+		},
+		{
+			name: "profile only",
+			cfg:  ForwardingConfig{Backend: BackendOpenAI},
+			want: []ForwardingField{{Path: "email", Body: "user"}},
+		},
+		{
+			name: "backend name is case-insensitive",
+			cfg:  ForwardingConfig{Backend: "Flowise"},
+			want: []ForwardingField{{Path: "email", Body: "overrideConfig.vars.user"}},
+		},
+		{
+			name: "explicit body field overrides profile",
+			cfg: ForwardingConfig{
+				Backend: BackendOpenAI,
+				Fields:  []ForwardingField{{Path: "username", Body: "user"}},
+			},
+			want: []ForwardingField{{Path: "username", Body: "user"}},
+		},
+		{
+			name: "explicit header overrides profile headers",
+			cfg: ForwardingConfig{
+				Backend: BackendLibreChat,
+				Fields:  []ForwardingField{{Path: "extra.login", Header: "x-forwarded-user"}},
+			},
+			want: []ForwardingField{
+				{Path: "extra.login", Header: "x-forwarded-user"},
+				{Path: "email", Header: "X-Forwarded-Email"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.EffectiveFields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectiveFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardingConfig_GetBodyPath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ForwardingConfig
+		want string
+	}{
+		{"default", ForwardingConfig{}, "/"},
+		{"backend profile", ForwardingConfig{Backend: BackendFlowise}, "/api/v1/prediction"},
+		{"backend without body path", ForwardingConfig{Backend: BackendLibreChat}, "/"},
+		{"explicit", ForwardingConfig{Backend: BackendOpenAI, BodyPath: "/api/openai"}, "/api/openai"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.GetBodyPath(); got != tt.want {
+				t.Errorf("GetBodyPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ClaimUsername is the claim that also sets the session's display name
+const ClaimUsername = "username"
+
+// claimNamePattern restricts claim names to lowercase identifiers (e.g., "department", "avatar_url")
+var claimNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// reservedClaims cannot be mapped because authorization depends on them
+var reservedClaims = map[string]bool{
+	"email":  true,
+	"groups": true,
+	"roles":  true,
+	"amr":    true,
+}
+
+// ClaimMapping derives a normalized claim from provider-specific Extra data at sign-in
+// The claim is stored as "_<claim>" in the session's Extra (like "_email" and "_username"),
+// so forwarding can use "extra._department" regardless of the provider.
+// Entries for the same claim are tried in order; the first non-empty value wins.
+type ClaimMapping struct {
+	Claim     string   `yaml:"claim" json:"claim"`         // Normalized claim name (e.g., "department", "locale", "avatar_url"; "username" also sets the display name)
+	From      []string `yaml:"from" json:"from"`           // Extra paths tried in order (e.g., "department", "extra.org.department", "_avatar_url")
+	Providers []string `yaml:"providers" json:"providers"` // Optional: Provider IDs this entry applies to (default: all providers)
+}
+
+// ClaimKey returns the session Extra key of the claim
+func (c ClaimMapping) ClaimKey() string {
+	return "_" + c.Claim
+}
+
+// AppliesTo reports whether the entry applies to a provider ID
+func (c ClaimMapping) AppliesTo(providerID string) bool {
+	if len(c.Providers) == 0 {
+		return true
+	}
+	for _, id := range c.Providers {
+		if id == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// validateClaimsMapping checks the claims_mapping entries against the configured providers
+func validateClaimsMapping(mappings []ClaimMapping, providers []OAuth2Provider) error {
+	verr := NewValidationError()
+
+	known := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		known[p.ID] = true
+	}
+
+	for i, mapping := range mappings {
+		switch {
+		case !claimNamePattern.MatchString(mapping.Claim):
+			verr.Add(fmt.Errorf("claims_mapping[%d].claim: %w", i, ErrClaimNameInvalid))
+		case reservedClaims[mapping.Claim]:
+			verr.Add(fmt.Errorf("claims_mapping[%d].claim: %w: %s", i, ErrClaimReserved, mapping.Claim))
+		}
+		if len(mapping.From) == 0 {
+			verr.Add(fmt.Errorf("claims_mapping[%d].from: %w", i, ErrClaimFromRequired))
+		}
+		for j, path := range mapping.From {
+			if path == "" {
+				verr.Add(fmt.Errorf("claims_mapping[%d].from[%d]: %w", i, j, ErrClaimFromRequired))
+			}
+		}
+		for j, id := range mapping.Providers {
+			if !known[id] {
+				verr.Add(fmt.Errorf("claims_mapping[%d].providers[%d]: %w: %s", i, j, ErrClaimProviderUnknown, id))
+			}
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateClaimsMapping(t *testing.T) {
+	providers := []OAuth2Provider{{ID: "google", Type: "google"}, {ID: "azure", Type: "microsoft"}}
+
+	tests := []struct {
+		name     string
+		mappings []ClaimMapping
+		wantErr  error
+	}{
+		{"empty", nil, nil},
+		{"valid", []ClaimMapping{
+			{Claim: "department", From: []string{"extension_Department"}, Providers: []string{"azure"}},
+			{Claim: "department", From: []string{"department"}},
+			{Claim: "avatar_url", From: []string{"picture", "_avatar_url"}},
+		}, nil},
+		{"invalid claim name", []ClaimMapping{{Claim: "Department", From: []string{"department"}}}, ErrClaimNameInvalid},
+		{"empty claim name", []ClaimMapping{{From: []string{"department"}}}, ErrClaimNameInvalid},
+		{"reserved claim", []ClaimMapping{{Claim: "email", From: []string{"mail"}}}, ErrClaimReserved},
+		{"no source", []ClaimMapping{{Claim: "locale"}}, ErrClaimFromRequired},
+		{"empty source", []ClaimMapping{{Claim: "locale", From: []string{""}}}, ErrClaimFromRequired},
+		{"unknown provider", []ClaimMapping{{Claim: "locale", From: []string{"locale"}, Providers: []string{"github"}}}, ErrClaimProviderUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateClaimsMapping(tt.mappings, providers)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateClaimsMapping() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateClaimsMapping() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimMapping_AppliesTo(t *testing.T) {
+	all := ClaimMapping{Claim: "locale"}
+	azure := ClaimMapping{Claim: "locale", Providers: []string{"azure"}}
+
+	if !all.AppliesTo("google") || !azure.AppliesTo("azure") || azure.AppliesTo("google") {
+		t.Error("AppliesTo() does not match the providers list")
+	}
+	if all.ClaimKey() != "_locale" {
+		t.Errorf("ClaimKey() = %s, want _locale", all.ClaimKey())
+	}
+}
@@ -1,44 +1,113 @@
 package config
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
 	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Service       ServiceConfig       `yaml:"service" json:"service"`
-	Server        ServerConfig        `yaml:"server" json:"server"`
-	Session       SessionConfig       `yaml:"session" json:"session"`
-	OAuth2        OAuth2Config        `yaml:"oauth2" json:"oauth2"`
-	EmailAuth     EmailAuthConfig     `yaml:"email_auth" json:"email_auth"`
-	PasswordAuth  PasswordAuthConfig  `yaml:"password_auth" json:"password_auth"`
-	AccessControl AccessControlConfig `yaml:"access_control" json:"access_control"`
-	Logging       LoggingConfig       `yaml:"logging" json:"logging"`
-	KVS           KVSConfig           `yaml:"kvs" json:"kvs"`               // KVS storage configuration
-	Forwarding    ForwardingConfig    `yaml:"forwarding" json:"forwarding"` // User info forwarding configuration
-	Assets        AssetsConfig        `yaml:"assets" json:"assets"`         // Assets configuration
+	Service         ServiceConfig         `yaml:"service" json:"service"`
+	Server          ServerConfig          `yaml:"server" json:"server"`
+	Session         SessionConfig         `yaml:"session" json:"session"`
+	OAuth2          OAuth2Config          `yaml:"oauth2" json:"oauth2"`
+	EmailAuth       EmailAuthConfig       `yaml:"email_auth" json:"email_auth"`
+	PasswordAuth    PasswordAuthConfig    `yaml:"password_auth" json:"password_auth"`
+	AccessControl   AccessControlConfig   `yaml:"access_control" json:"access_control"`
+	Logging         LoggingConfig         `yaml:"logging" json:"logging"`
+	KVS             KVSConfig             `yaml:"kvs" json:"kvs"`                           // KVS storage configuration
+	Forwarding      ForwardingConfig      `yaml:"forwarding" json:"forwarding"`             // User info forwarding configuration
+	Assets          AssetsConfig          `yaml:"assets" json:"assets"`                     // Assets configuration
+	Dify            DifyConfig            `yaml:"dify" json:"dify"`                         // Optional: Dify integration (server-side API key and per-user conversations)
+	Guest           GuestConfig           `yaml:"guest" json:"guest"`                       // Optional: Anonymous guest access with a request quota
+	IDP             IDPConfig             `yaml:"idp" json:"idp"`                           // Optional: OpenID Connect provider for downstream apps ("IdP mode")
+	ServiceTokens   []ServiceTokenConfig  `yaml:"service_tokens" json:"service_tokens"`     // Optional: Credentials of internal callers passing through without a session
+	Plugins         []PluginConfig        `yaml:"plugins" json:"plugins"`                   // Optional: External filter processes (request veto, identity headers, custom auth callbacks)
+	Redirect        RedirectConfig        `yaml:"redirect" json:"redirect"`                 // Optional: Constraints on the redirect target after login
+	LoginExperiment LoginExperimentConfig `yaml:"login_experiment" json:"login_experiment"` // Optional: A/B test of login page variants
+	Announcement    AnnouncementConfig    `yaml:"announcement" json:"announcement"`         // Optional: Banner on the login and error pages (e.g., maintenance notices)
+	Errors          ErrorsConfig          `yaml:"errors" json:"errors"`                     // Optional: 404 and 403 responses (branded page, upstream or JSON)
+	StreamLimits    []StreamLimitConfig   `yaml:"stream_limits" json:"stream_limits"`       // Optional: Size and time limits of proxied responses per path (e.g., LLM streams)
+	Privacy         PrivacyConfig         `yaml:"privacy" json:"privacy"`                   // Optional: PII minimization (hashed emails, approved forwarding fields)
+	ProviderTokens  ProviderTokensConfig  `yaml:"provider_tokens" json:"provider_tokens"`   // Optional: Endpoint exchanging session references for the OAuth2 provider's current access token
+	Outbound        OutboundConfig        `yaml:"outbound" json:"outbound"`                 // Optional: Forward proxy and CA bundle for outbound calls (OAuth2, SendGrid)
+	Health          HealthConfig          `yaml:"health" json:"health"`                     // Optional: Dependency probes of the readiness check
+	ClaimsMapping   []ClaimMapping        `yaml:"claims_mapping" json:"claims_mapping"`     // Optional: Normalized session claims derived from provider-specific Extra data
+	Tenants         []TenantConfig        `yaml:"tenants" json:"tenants"`                   // Optional: Per-hostname tenant overrides (multi-tenant mode)
 }
 
 // ServiceConfig contains service-level settings
 type ServiceConfig struct {
-	Name        string `yaml:"name" json:"name"`
-	Description string `yaml:"description" json:"description"`
-	IconURL     string `yaml:"icon_url" json:"icon_url"`     // Icon URL for auth header (48px icon)
-	LogoURL     string `yaml:"logo_url" json:"logo_url"`     // Logo URL for auth header (larger logo image)
-	LogoWidth   string `yaml:"logo_width" json:"logo_width"` // Logo width (e.g., "100px", "150px", "200px", default: "200px")
+	Name             string                    `yaml:"name" json:"name"`
+	Description      string                    `yaml:"description" json:"description"`
+	IconURL          string                    `yaml:"icon_url" json:"icon_url"`                     // Icon URL for auth header (48px icon)
+	LogoURL          string                    `yaml:"logo_url" json:"logo_url"`                     // Logo URL for auth header (larger logo image)
+	LogoWidth        string                    `yaml:"logo_width" json:"logo_width"`                 // Logo width (e.g., "100px", "150px", "200px", default: "200px")
+	Favicon          string                    `yaml:"favicon" json:"favicon"`                       // Optional: Path of an .ico, .png or .svg file used as favicon of the auth pages (default: icon_url, or the ChatbotGate icon)
+	Theme            ThemeConfig               `yaml:"theme" json:"theme"`                           // Optional: Theming tokens for white-labeling the auth pages
+	CustomHeadHTML   string                    `yaml:"custom_head_html" json:"custom_head_html"`     // Optional: Raw HTML inserted at the end of <head> on auth pages (e.g., analytics snippets)
+	CustomFooterHTML string                    `yaml:"custom_footer_html" json:"custom_footer_html"` // Optional: Raw HTML inserted at the end of <body> on auth pages (e.g., support links, legal footer)
+	CustomPages      map[string]CustomPageHTML `yaml:"custom_pages" json:"custom_pages"`             // Optional: Per-page snippets overriding the service-wide ones (keys: login, logout, email_sent, forbidden, email_required, email_unverified, not_found, server_error, upstream_error, guest_limit, scope_consent)
+	CustomScriptSrc  []string                  `yaml:"custom_script_src" json:"custom_script_src"`   // Optional: Extra CSP script-src sources required by custom snippets (e.g., "https://www.googletagmanager.com")
 }
 
 // ServerConfig contains authentication server settings
 type ServerConfig struct {
-	AuthPathPrefix string `yaml:"auth_path_prefix" json:"auth_path_prefix"` // Path prefix for authentication endpoints (default: "/_auth")
-	BaseURL        string `yaml:"base_url" json:"base_url"`                 // Optional: Base URL for email links and OAuth2 callback (e.g., "https://example.com:8443" or "http://localhost:4181")
-	Development    bool   `yaml:"development" json:"development"`           // Enable development mode (relaxes CSP for inline scripts, default: false)
+	AuthPathPrefix      string   `yaml:"auth_path_prefix" json:"auth_path_prefix"`                       // Path prefix for authentication endpoints (default: "/_auth")
+	MountPath           string   `yaml:"mount_path" json:"mount_path"`                                   // Optional: Sub-path ChatbotGate is served under (e.g., "/bot" for https://example.com/bot/), added to links, redirects and cookie paths
+	BaseURL             string   `yaml:"base_url" json:"base_url"`                                       // Optional: Base URL for email links and OAuth2 callback (e.g., "https://example.com:8443" or "http://localhost:4181")
+	Development         bool     `yaml:"development" json:"development"`                                 // Enable development mode (relaxes CSP for inline scripts, default: false)
+	AllowedOrigins      []string `yaml:"allowed_origins" json:"allowed_origins"`                         // Optional: Origins allowed to call the session check and metadata endpoints via CORS ("*" allows any)
+	CentralAuthURL      string   `yaml:"central_auth_url" json:"central_auth_url"`                       // Optional: Base URL of the instance that handles login for all subdomains (e.g., "https://auth.example.com"), requires session.cookie.domain
+	AdminToken          string   `yaml:"admin_token" json:"admin_token" secret:"true"`                   // Optional: Bearer token for the admin API (admin endpoints are disabled when empty, min 32 characters)
+	IntrospectionSecret string   `yaml:"introspection_secret" json:"introspection_secret" secret:"true"` // Optional: Shared secret of upstream services calling the token introspection endpoint (disabled when empty, min 32 characters)
+	DefaultRedirect     string   `yaml:"default_redirect" json:"default_redirect"`                       // Optional: Landing path after login when no original URL was saved, e.g. a direct visit to the login page (default: "/")
+}
+
+// GetDefaultRedirect returns the landing path after login when no original URL was saved
+// If not set, returns "/"
+func (s ServerConfig) GetDefaultRedirect() string {
+	if s.DefaultRedirect == "" {
+		return "/"
+	}
+	return s.DefaultRedirect
+}
+
+// GetCentralAuthHost returns the host (without port) of CentralAuthURL
+// Returns an empty string if central auth is not configured or the URL is invalid
+func (s ServerConfig) GetCentralAuthHost() string {
+	if s.CentralAuthURL == "" {
+		return ""
+	}
+	u, err := url.Parse(s.CentralAuthURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// IsOriginAllowed reports whether the given Origin header value is permitted for CORS requests
+func (s ServerConfig) IsOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetAuthPathPrefix returns the authentication path prefix
@@ -50,9 +119,33 @@ func (s ServerConfig) GetAuthPathPrefix() string {
 	return s.AuthPathPrefix
 }
 
+// GetMountPath returns the sub-path ChatbotGate is served under, without a trailing slash
+// Returns "" when ChatbotGate is served at the root.
+func (s ServerConfig) GetMountPath() string {
+	return strings.TrimRight(s.MountPath, "/")
+}
+
+// GetPublicAuthPathPrefix returns the authentication path prefix as seen by browsers: the mount path
+// followed by the auth path prefix (e.g., "/bot/_auth"). Links, redirects and callback URLs use it.
+func (s ServerConfig) GetPublicAuthPathPrefix() string {
+	prefix := strings.TrimRight(s.GetAuthPathPrefix(), "/")
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return s.GetMountPath() + prefix
+}
+
+// GetCookiePath returns the Path of the cookies set by ChatbotGate: the mount path, or "/"
+func (s ServerConfig) GetCookiePath() string {
+	if mount := s.GetMountPath(); mount != "" {
+		return mount
+	}
+	return "/"
+}
+
 // GetCallbackURL returns the OAuth2 callback URL
-// Automatically generated from BaseURL and AuthPathPrefix
-// Format: {base_url}{auth_path_prefix}/oauth2/callback
+// Automatically generated from BaseURL, MountPath and AuthPathPrefix
+// Format: {base_url}{mount_path}{auth_path_prefix}/oauth2/callback
 // If BaseURL is not set, defaults to http://host:port
 func (s ServerConfig) GetCallbackURL(host string, port int) string {
 	baseURL := s.BaseURL
@@ -65,24 +158,46 @@ func (s ServerConfig) GetCallbackURL(host string, port int) string {
 		}
 	}
 
-	prefix := s.GetAuthPathPrefix()
-	return baseURL + prefix + "/oauth2/callback"
+	return baseURL + s.GetPublicAuthPathPrefix() + "/oauth2/callback"
 }
 
 // SessionConfig contains session management settings
 // Note: Session storage backend is configured via kvs.default or kvs.session
 type SessionConfig struct {
-	Cookie CookieConfig `yaml:"cookie" json:"cookie"`
+	Cookie    CookieConfig           `yaml:"cookie" json:"cookie"`
+	Metadata  MetadataConfig         `yaml:"metadata" json:"metadata"`   // Optional: Per-user key-value metadata API for upstream apps
+	Extra     ExtraConfig            `yaml:"extra" json:"extra"`         // Optional: Provider data kept in sessions (allow/deny keys, size budget)
+	GC        SessionGCConfig        `yaml:"gc" json:"gc"`               // Optional: Periodic deletion of expired session records
+	Refresh   SessionRefreshConfig   `yaml:"refresh" json:"refresh"`     // Optional: Keep-alive endpoint for long sessions (sliding expiry, expiry header)
+	WebSocket WebSocketSessionConfig `yaml:"websocket" json:"websocket"` // Optional: Closing of proxied WebSocket connections whose session ended
 }
 
 // CookieConfig contains session cookie settings
 type CookieConfig struct {
 	Name     string `yaml:"name" json:"name"`
-	Secret   string `yaml:"secret" json:"secret"`
+	Secret   string `yaml:"secret" json:"secret" secret:"true"`
 	Expire   string `yaml:"expire" json:"expire"`
 	Secure   bool   `yaml:"secure" json:"secure"`
 	HTTPOnly bool   `yaml:"httponly" json:"httponly"`
 	SameSite string `yaml:"samesite" json:"samesite"`
+	Domain   string `yaml:"domain" json:"domain"` // Optional: Parent domain shared by subdomains for single sign-on (e.g., ".example.com")
+}
+
+// MatchesDomain reports whether host (optionally with port) is covered by the cookie domain
+// Always returns false when no cookie domain is configured (host-only cookies)
+func (c CookieConfig) MatchesDomain(host string) bool {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain == "" || host == "" {
+		return false
+	}
+
+	// Strip port from host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
 }
 
 // GetExpireDuration returns the cookie expiration as a time.Duration
@@ -115,20 +230,70 @@ type OAuth2Provider struct {
 	Type         string `yaml:"type" json:"type"`                 // Provider type: "google", "github", "microsoft", "custom"
 	DisplayName  string `yaml:"display_name" json:"display_name"` // Display name shown in UI
 	ClientID     string `yaml:"client_id" json:"client_id"`
-	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret" secret:"true"`
 	Disabled     bool   `yaml:"disabled" json:"disabled"` // If true, provider is hidden from login page
 	IconURL      string `yaml:"icon_url" json:"icon_url"` // Optional custom icon URL (if not set, uses default icon based on provider type)
+	Icon         string `yaml:"icon" json:"icon"`         // Optional inline icon: SVG markup ("<svg ...>") or a "data:image/..." URI (takes precedence over icon_url)
+
+	// Token endpoint client authentication for providers that prohibit client secrets
+	// Key material is read from the *_file path, or given inline as PEM (e.g., "${IDP_CLIENT_KEY}")
+	ClientAuthMethod string `yaml:"client_auth_method" json:"client_auth_method"` // Optional: "client_secret" (default), "private_key_jwt" or "tls_client_auth"
+	ClientKey        string `yaml:"client_key" json:"client_key" secret:"true"`   // PEM private key signing client assertions, or of the TLS client certificate
+	ClientKeyFile    string `yaml:"client_key_file" json:"client_key_file"`       // Path of the PEM private key (alternative to client_key)
+	ClientKeyID      string `yaml:"client_key_id" json:"client_key_id"`           // Optional: "kid" header of client assertions (private_key_jwt)
+	ClientCert       string `yaml:"client_cert" json:"client_cert"`               // PEM client certificate (tls_client_auth; optional thumbprint for private_key_jwt)
+	ClientCertFile   string `yaml:"client_cert_file" json:"client_cert_file"`     // Path of the PEM client certificate (alternative to client_cert)
+
+	// Optional: Reject accounts whose email address the provider has not verified
+	// (Google verified_email, OIDC email_verified; GitHub only returns verified addresses)
+	RequireVerifiedEmail bool `yaml:"require_verified_email" json:"require_verified_email"`
+
+	// Optional: Accept OIDC front-channel logout iframes of the provider at {auth_path_prefix}/oauth2/frontchannel-logout
+	FrontchannelLogout bool `yaml:"frontchannel_logout" json:"frontchannel_logout"`
+
+	// Login page layout
+	Order       int    `yaml:"order" json:"order"`               // Optional: Sort order on the login page (lower first, ties keep config order)
+	Section     string `yaml:"section" json:"section"`           // Optional: Heading to group this provider under (e.g., "Company SSO", "Social")
+	MoreOptions bool   `yaml:"more_options" json:"more_options"` // If true, provider is hidden behind the "Other options" expander
+
+	// Google provider settings (only used when Type is "google")
+	// Group memberships are read with the Directory API by a service account with domain-wide delegation
+	HostedDomains            []string `yaml:"hosted_domains" json:"hosted_domains"`                         // Optional: Google Workspace domains a user must belong to ("hd" claim)
+	DirectoryCredentialsFile string   `yaml:"directory_credentials_file" json:"directory_credentials_file"` // Optional: Service account key file (JSON) for the group lookup
+	DirectoryAdminEmail      string   `yaml:"directory_admin_email" json:"directory_admin_email"`           // Workspace admin the service account acts as (required with the key file)
+	AllowedGroups            []string `yaml:"allowed_groups" json:"allowed_groups"`                         // Optional: Group emails a user must belong to (any of; requires the group lookup)
+
+	// Microsoft provider settings (only used when Type is "microsoft")
+	// App roles ("roles" claim) and groups ("groups" claim, read from Graph on overage) are always stored in the session
+	AllowedTenants []string `yaml:"allowed_tenants" json:"allowed_tenants"` // Optional: Entra tenant IDs a user must belong to ("tid" claim)
+
+	// GitHub provider settings (only used when Type is "github")
+	// Membership is checked with the GitHub API at sign-in; the "read:org" scope is requested automatically
+	AllowedOrgs  []string `yaml:"allowed_orgs" json:"allowed_orgs"`   // Optional: Organization logins a user must belong to (any of)
+	AllowedTeams []string `yaml:"allowed_teams" json:"allowed_teams"` // Optional: Teams as "org/team-slug" a user must belong to (any of)
 
 	// Custom provider settings (only used when Type is "custom")
-	AuthURL            string `yaml:"auth_url" json:"auth_url"`                         // Custom authorization endpoint
-	TokenURL           string `yaml:"token_url" json:"token_url"`                       // Custom token endpoint
-	UserInfoURL        string `yaml:"userinfo_url" json:"userinfo_url"`                 // Custom userinfo endpoint
-	JWKSURL            string `yaml:"jwks_url" json:"jwks_url"`                         // Optional OIDC JWKS URL
+	// With issuer_url, endpoints that are not set are read from the OpenID Connect discovery document
+	IssuerURL          string `yaml:"issuer_url" json:"issuer_url"`                     // Optional: OIDC issuer (e.g., "https://idp.example.com/realms/main")
+	DiscoveryRefresh   string `yaml:"discovery_refresh" json:"discovery_refresh"`       // Optional: How often the discovery document is fetched again (default: "1h")
+	AuthURL            string `yaml:"auth_url" json:"auth_url"`                         // Custom authorization endpoint (optional with issuer_url)
+	TokenURL           string `yaml:"token_url" json:"token_url"`                       // Custom token endpoint (optional with issuer_url)
+	UserInfoURL        string `yaml:"userinfo_url" json:"userinfo_url"`                 // Custom userinfo endpoint (optional with issuer_url)
+	JWKSURL            string `yaml:"jwks_url" json:"jwks_url"`                         // Optional: JWKS URL verifying back-channel logout tokens (default: discovered)
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"` // Allow HTTP for testing (default: false)
 
 	// OAuth2 scopes to request
 	Scopes      []string `yaml:"scopes" json:"scopes"`             // OAuth2 scopes to request (e.g., ["openid", "email", "profile", "analytics"])
 	ResetScopes bool     `yaml:"reset_scopes" json:"reset_scopes"` // If true, replaces default scopes; if false, adds to default scopes (default: false)
+
+	// Optional: Extra scopes users approve or skip on a consent step before signing in (e.g., calendar access)
+	OptionalScopes []OptionalScope `yaml:"optional_scopes" json:"optional_scopes"`
+}
+
+// OptionalScope is an OAuth2 scope requested only when the user approves it
+type OptionalScope struct {
+	Scope       string `yaml:"scope" json:"scope"`             // OAuth2 scope (e.g., "https://www.googleapis.com/auth/calendar.readonly")
+	Description string `yaml:"description" json:"description"` // Optional: What the scope is used for, shown on the consent step (default: the scope)
 }
 
 // EmailAuthConfig contains email authentication settings
@@ -184,7 +349,7 @@ type SMTPConfig struct {
 	Host     string `yaml:"host" json:"host"`
 	Port     int    `yaml:"port" json:"port"`
 	Username string `yaml:"username" json:"username"`
-	Password string `yaml:"password" json:"password"`
+	Password string `yaml:"password" json:"password" secret:"true"`
 	From     string `yaml:"from,omitempty" json:"from,omitempty"`           // Optional: Override email_auth.from
 	FromName string `yaml:"from_name,omitempty" json:"from_name,omitempty"` // Optional: Override email_auth.from_name
 	TLS      bool   `yaml:"tls" json:"tls"`
@@ -204,7 +369,7 @@ func (s SMTPConfig) GetFromAddress(parentEmail, parentName string) (string, stri
 
 // SendGridConfig contains SendGrid API settings
 type SendGridConfig struct {
-	APIKey      string `yaml:"api_key" json:"api_key"`
+	APIKey      string `yaml:"api_key" json:"api_key" secret:"true"`
 	From        string `yaml:"from,omitempty" json:"from,omitempty"`           // Optional: Override email_auth.from
 	FromName    string `yaml:"from_name,omitempty" json:"from_name,omitempty"` // Optional: Override email_auth.from_name
 	EndpointURL string `yaml:"endpoint_url" json:"endpoint_url"`               // Optional custom endpoint URL (default: https://api.sendgrid.com)
@@ -256,8 +421,8 @@ func (e EmailTokenConfig) GetTokenExpireDuration() (time.Duration, error) {
 // This is a simple authentication method that requires a password
 // Useful for initial setup and testing without requiring email or OAuth2 configuration
 type PasswordAuthConfig struct {
-	Enabled  bool   `yaml:"enabled" json:"enabled"`   // Enable password authentication
-	Password string `yaml:"password" json:"password"` // Password for authentication
+	Enabled  bool   `yaml:"enabled" json:"enabled"`                 // Enable password authentication
+	Password string `yaml:"password" json:"password" secret:"true"` // Password for authentication
 }
 
 // AccessControlConfig contains access control settings
@@ -268,9 +433,11 @@ type AccessControlConfig struct {
 
 // LoggingConfig contains logging settings
 type LoggingConfig struct {
-	Level string             `yaml:"level" json:"level"`
-	Color bool               `yaml:"color" json:"color"`
-	File  *FileLoggingConfig `yaml:"file,omitempty" json:"file,omitempty"` // Optional file logging configuration
+	Level       string             `yaml:"level" json:"level"`
+	ModuleLevel ModuleLevelConfig  `yaml:"module_level,omitempty" json:"module_level,omitempty"` // Optional level and sampling of sub-modules
+	Scrubbing   string             `yaml:"scrubbing,omitempty" json:"scrubbing,omitempty"`       // Redaction of tokens, cookies, OTPs and emails: "standard" (default), "strict" or "off"
+	Color       bool               `yaml:"color" json:"color"`
+	File        *FileLoggingConfig `yaml:"file,omitempty" json:"file,omitempty"` // Optional file logging configuration
 }
 
 // FileLoggingConfig contains file logging and rotation settings
@@ -303,6 +470,10 @@ type KVSConfig struct {
 
 	// Namespace prefixes for shared KVS (has defaults)
 	Namespaces NamespaceConfig `yaml:"namespaces" json:"namespaces"`
+
+	// Optional in-process cache of session reads, saving a KVS round trip on most proxied requests
+	// Logouts and revocations invalidate it, on all instances when the session KVS is Redis
+	SessionCache kvs.CacheConfig `yaml:"session_cache" json:"session_cache"`
 }
 
 // NamespaceConfig defines the key prefixes for each use case when sharing a KVS
@@ -342,6 +513,44 @@ func (c *Config) Validate() error {
 		verr.Add(ErrCookieSecretTooShort)
 	}
 
+	// Validate session metadata API
+	if err := c.Session.Metadata.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate persisted provider data settings
+	if err := c.Session.Extra.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate session garbage collection
+	if err := c.Session.GC.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the session cache
+	if ttl := c.KVS.SessionCache.TTL; ttl != "" {
+		if d, err := time.ParseDuration(ttl); err != nil || d <= 0 {
+			verr.Add(fmt.Errorf("kvs.session_cache.ttl: %w", ErrSessionCacheTTLInvalid))
+		}
+	}
+
+	// Validate the session checks of WebSocket connections
+	if err := c.Session.WebSocket.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the session refresh endpoint
+	expire, _ := c.Session.Cookie.GetExpireDuration()
+	if err := c.Session.Refresh.Validate(expire); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate provider-specific OAuth2 settings
+	if err := c.OAuth2.Validate(); err != nil {
+		verr.Add(err)
+	}
+
 	// Check at least one authentication method is available (OAuth2, email, or agreement)
 	hasAvailableOAuth2 := false
 	for _, p := range c.OAuth2.Providers {
@@ -358,11 +567,148 @@ func (c *Config) Validate() error {
 		verr.Add(ErrNoAuthMethod)
 	}
 
+	// Validate central auth (cross-subdomain SSO) configuration
+	if c.Server.CentralAuthURL != "" {
+		if c.Session.Cookie.Domain == "" {
+			verr.Add(ErrCentralAuthDomainRequired)
+		} else if host := c.Server.GetCentralAuthHost(); host == "" || !c.Session.Cookie.MatchesDomain(host) {
+			verr.Add(ErrCentralAuthURLInvalid)
+		}
+	}
+
+	// Validate theming tokens
+	if err := c.Service.Theme.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate custom HTML snippets
+	if err := c.Service.validateCustomHTML(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate favicon file type
+	if err := c.Service.validateFavicon(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate Dify integration
+	if err := c.Dify.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate guest access
+	if err := c.Guest.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the OpenID Connect provider mode
+	if err := c.IDP.Validate(c.Server); err != nil {
+		verr.Add(err)
+	}
+
+	if err := validateServiceTokens(c.ServiceTokens); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate plugins
+	if err := validatePlugins(c.Plugins); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate PII minimization
+	if err := c.validatePrivacy(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the provider token endpoint
+	if err := c.ProviderTokens.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the stream limits
+	if err := validateStreamLimits(c.StreamLimits); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the error responses
+	if err := c.Errors.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the announcement banner
+	if err := c.Announcement.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the login page experiment
+	if err := c.LoginExperiment.Validate(c.OAuth2.Providers); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate post-login redirect constraints
+	if err := c.Redirect.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate outbound HTTP settings
+	if err := c.Outbound.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate readiness probes
+	if err := c.Health.Validate(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate claims mapping
+	if err := validateClaimsMapping(c.ClaimsMapping, c.OAuth2.Providers); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate the default landing path (also the redirect fallback when redirect.fallback is not set)
+	if c.Server.DefaultRedirect != "" {
+		if !isLocalPath(c.Server.DefaultRedirect) {
+			verr.Add(fmt.Errorf("server.default_redirect: %w", ErrDefaultRedirectInvalid))
+		} else if c.Redirect.Fallback == "" && !c.Redirect.AllowsTarget(c.Server.DefaultRedirect) {
+			verr.Add(fmt.Errorf("server.default_redirect: %w", ErrRedirectFallbackRejected))
+		}
+	}
+
+	// Validate admin API token
+	if c.Server.AdminToken != "" && len(c.Server.AdminToken) < 32 {
+		verr.Add(ErrAdminTokenTooShort)
+	}
+	if c.Server.IntrospectionSecret != "" && len(c.Server.IntrospectionSecret) < 32 {
+		verr.Add(ErrIntrospectionSecretTooShort)
+	}
+
+	// Validate mount path: a plain local path, as it is prefixed to links and cookie paths
+	if mount := c.Server.MountPath; mount != "" {
+		if !isLocalPath(mount) || strings.ContainsAny(mount, "?#;% \t") || strings.Contains(mount, "/..") {
+			verr.Add(ErrMountPathInvalid)
+		}
+	}
+
+	// Validate tenant configuration
+	if err := c.validateTenants(); err != nil {
+		verr.Add(err)
+	}
+
 	// Validate forwarding configuration
 	if err := c.validateForwarding(); err != nil {
 		verr.Add(err)
 	}
 
+	// Validate per-module logging
+	if err := c.Logging.validateModuleLevel(); err != nil {
+		verr.Add(err)
+	}
+
+	// Validate log scrubbing
+	if err := c.Logging.validateScrubbing(); err != nil {
+		verr.Add(err)
+	}
+
 	// Validate rules configuration
 	if err := c.AccessControl.Rules.Validate(); err != nil {
 		verr.Add(fmt.Errorf("access_control.rules: %w", err))
@@ -371,16 +717,48 @@ func (c *Config) Validate() error {
 	return verr.ErrorOrNil()
 }
 
+// isRSAPublicKeyPEM reports whether data is a PEM RSA public key of 2048 bits or more (PKIX or PKCS #1)
+func isRSAPublicKeyPEM(data string) bool {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return false
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return false
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	return err == nil && ok && rsaKey.N.BitLen() >= 2048
+}
+
 // validateForwarding validates the forwarding configuration
 func (c *Config) validateForwarding() error {
 	fwd := &c.Forwarding
 
-	// No fields defined, nothing to validate
-	if len(fwd.Fields) == 0 {
-		return nil
+	verr := NewValidationError()
+
+	if fwd.Backend != "" {
+		if _, ok := LookupBackendProfile(fwd.Backend); !ok {
+			verr.Add(fmt.Errorf("forwarding.backend: %w", ErrForwardingBackendUnknown))
+		}
+	}
+	if fwd.BodyPath != "" && !strings.HasPrefix(fwd.BodyPath, "/") {
+		verr.Add(fmt.Errorf("forwarding.body_path: %w", ErrForwardingBodyPathInvalid))
+	}
+	if err := fwd.Audit.Validate(); err != nil {
+		verr.Add(err)
 	}
 
-	verr := NewValidationError()
+	// No fields defined, nothing else to validate
+	if len(fwd.Fields) == 0 {
+		return verr.ErrorOrNil()
+	}
 
 	// Check if encryption is needed
 	needsEncryption := false
@@ -401,25 +779,71 @@ func (c *Config) validateForwarding() error {
 		if fwd.Encryption == nil {
 			verr.Add(ErrEncryptionConfigRequired)
 		} else {
-			if fwd.Encryption.Key == "" {
-				verr.Add(ErrEncryptionKeyRequired)
-			} else if len(fwd.Encryption.Key) < 32 {
-				verr.Add(ErrEncryptionKeyTooShort)
+			// Symmetric algorithms use the shared key, rsa-oaep the upstream's public key
+			needsKey, needsPublicKey := false, false
+			for _, field := range fwd.Fields {
+				if !field.Filters.Has("encrypt") {
+					continue
+				}
+				if field.EncryptionAlgorithm(*fwd.Encryption) == "rsa-oaep" {
+					needsPublicKey = true
+				} else {
+					needsKey = true
+				}
+			}
+
+			if needsKey {
+				if fwd.Encryption.Key == "" {
+					verr.Add(ErrEncryptionKeyRequired)
+				} else if len(fwd.Encryption.Key) < 32 {
+					verr.Add(ErrEncryptionKeyTooShort)
+				}
+			}
+			if needsPublicKey && fwd.Encryption.PublicKey == "" && fwd.Encryption.PublicKeyFile == "" {
+				verr.Add(fmt.Errorf("forwarding.encryption.public_key: %w", ErrEncryptionPublicKeyRequired))
+			}
+			if !encryptionAlgorithms[fwd.Encryption.GetAlgorithm()] {
+				verr.Add(fmt.Errorf("forwarding.encryption.algorithm: %w", ErrEncryptionAlgorithmUnsupported))
 			}
 		}
 	}
+	if fwd.Encryption != nil && fwd.Encryption.PublicKey != "" && fwd.Encryption.PublicKeyFile != "" {
+		verr.Add(fmt.Errorf("forwarding.encryption.public_key_file: %w", ErrClientKeySourceConflict))
+	}
+	// Files are read when the forwarder is created, which fails on an invalid key
+	if fwd.Encryption != nil && fwd.Encryption.PublicKey != "" && !isRSAPublicKeyPEM(fwd.Encryption.PublicKey) {
+		verr.Add(fmt.Errorf("forwarding.encryption.public_key: %w", ErrEncryptionPublicKeyInvalid))
+	}
 
 	// Validate each field
 	for i, field := range fwd.Fields {
-		// Path is required
-		if field.Path == "" {
-			verr.Add(fmt.Errorf("forwarding.fields[%d]: path is required", i))
+		// Exactly one of Path or Expr is required
+		if field.Path == "" && field.Expr == "" {
+			verr.Add(fmt.Errorf("forwarding.fields[%d]: path or expr is required", i))
 			continue
 		}
+		if field.Path != "" && field.Expr != "" {
+			verr.Add(fmt.Errorf("forwarding.fields[%d]: path and expr are exclusive", i))
+		}
+		if field.Expr != "" {
+			if _, err := expr.CompileValue(field.Expr); err != nil {
+				verr.Add(fmt.Errorf("forwarding.fields[%d].expr: %w", i, err))
+			}
+		}
 
-		// At least one of Query or Header must be specified
-		if field.Query == "" && field.Header == "" {
-			verr.Add(fmt.Errorf("forwarding.fields[%d]: at least one of 'query' or 'header' must be specified", i))
+		// At least one of Query, Header or Body must be specified
+		if field.Query == "" && field.Header == "" && field.Body == "" {
+			verr.Add(fmt.Errorf("forwarding.fields[%d]: at least one of 'query', 'header' or 'body' must be specified", i))
+		}
+
+		// Body fields are dot-separated object keys
+		if field.Body != "" {
+			for _, key := range strings.Split(field.Body, ".") {
+				if key == "" {
+					verr.Add(fmt.Errorf("forwarding.fields[%d]: invalid body field '%s'", i, field.Body))
+					break
+				}
+			}
 		}
 
 		// Validate filters
@@ -430,6 +854,26 @@ func (c *Config) validateForwarding() error {
 				verr.Add(fmt.Errorf("forwarding.fields[%d]: invalid filter '%s' (valid: encrypt, zip, base64)", i, filter))
 			}
 		}
+
+		// Validate the per-field algorithm override
+		if field.Algorithm != "" {
+			if !encryptionAlgorithms[field.Algorithm] {
+				verr.Add(fmt.Errorf("forwarding.fields[%d].algorithm: %w", i, ErrEncryptionAlgorithmUnsupported))
+			} else if !field.Filters.Has("encrypt") {
+				verr.Add(fmt.Errorf("forwarding.fields[%d].algorithm: %w", i, ErrEncryptionAlgorithmWithoutEncrypt))
+			}
+		}
+		if fwd.Encryption != nil && fwd.Encryption.LegacyEncoding && field.Filters.Has("encrypt") &&
+			field.EncryptionAlgorithm(*fwd.Encryption) != "aes-256-gcm" {
+			verr.Add(fmt.Errorf("forwarding.fields[%d]: %w", i, ErrEncryptionLegacyAlgorithm))
+		}
+		if field.Stamp {
+			if !field.Filters.Has("encrypt") {
+				verr.Add(fmt.Errorf("forwarding.fields[%d].stamp: %w", i, ErrForwardingStampWithoutEncrypt))
+			} else if fwd.Encryption != nil && fwd.Encryption.LegacyEncoding {
+				verr.Add(fmt.Errorf("forwarding.fields[%d].stamp: %w", i, ErrForwardingStampLegacy))
+			}
+		}
 	}
 
 	return verr.ErrorOrNil()
@@ -437,21 +881,59 @@ func (c *Config) validateForwarding() error {
 
 // ForwardingConfig contains user info forwarding settings
 type ForwardingConfig struct {
-	Encryption *EncryptionConfig `yaml:"encryption,omitempty" json:"encryption,omitempty"` // Optional encryption settings
-	Fields     []ForwardingField `yaml:"fields" json:"fields"`                             // Field forwarding definitions
+	Encryption *EncryptionConfig     `yaml:"encryption,omitempty" json:"encryption,omitempty"` // Optional encryption settings
+	Fields     []ForwardingField     `yaml:"fields" json:"fields"`                             // Field forwarding definitions
+	Backend    string                `yaml:"backend,omitempty" json:"backend,omitempty"`       // Optional: Chatbot backend profile adding its user fields ("openai", "flowise", "librechat")
+	BodyPath   string                `yaml:"body_path,omitempty" json:"body_path,omitempty"`   // Optional: Path prefix of requests whose JSON body gets the body fields (default: the backend's API path, or all paths)
+	Audit      ForwardingAuditConfig `yaml:"audit,omitempty" json:"audit,omitempty"`           // Optional: Audit log of the identity forwarded with each request
 }
 
 // ForwardingField defines how to forward a single field
 type ForwardingField struct {
-	Path    string     `yaml:"path" json:"path"`                           // Dot-separated path to field (e.g., "email", "userinfo.avatar_url", "." for entire object)
+	Path    string     `yaml:"path,omitempty" json:"path,omitempty"`       // Dot-separated path to field (e.g., "email", "userinfo.avatar_url", "." for entire object)
+	Expr    string     `yaml:"expr,omitempty" json:"expr,omitempty"`       // CEL expression computing the value, instead of path (e.g., 'email.split("@")[0]')
 	Query   string     `yaml:"query,omitempty" json:"query,omitempty"`     // Query parameter name for login redirect (optional)
 	Header  string     `yaml:"header,omitempty" json:"header,omitempty"`   // HTTP header name for all requests (optional)
+	Body    string     `yaml:"body,omitempty" json:"body,omitempty"`       // Dot-separated JSON body field for API requests under body_path (optional, e.g., "user", "overrideConfig.vars.user")
 	Filters FilterList `yaml:"filters,omitempty" json:"filters,omitempty"` // Filters to apply (e.g., "encrypt,zip" or ["encrypt", "zip"])
+
+	// Algorithm overrides encryption.algorithm for this field's encrypt filter (optional)
+	Algorithm string `yaml:"algorithm,omitempty" json:"algorithm,omitempty"`
+
+	// Stamp adds a timestamp and nonce inside the encrypted value, so upstreams can reject values
+	// replayed from leaked URLs (optional, requires the encrypt filter; recommended for query fields)
+	Stamp bool `yaml:"stamp,omitempty" json:"stamp,omitempty"`
+}
+
+// EncryptionAlgorithm returns the algorithm of the field's encrypt filter
+func (f ForwardingField) EncryptionAlgorithm(encryption EncryptionConfig) string {
+	if f.Algorithm != "" {
+		return f.Algorithm
+	}
+	return encryption.GetAlgorithm()
+}
+
+// Source returns the path or expression the field value comes from
+func (f ForwardingField) Source() string {
+	if f.Expr != "" {
+		return f.Expr
+	}
+	return f.Path
 }
 
 // FilterList represents a list of filters (can be comma-separated string or array)
 type FilterList []string
 
+// Has reports whether the list contains a filter
+func (f FilterList) Has(name string) bool {
+	for _, filter := range f {
+		if filter == name {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalYAML implements custom YAML unmarshaling to support both string and array formats
 func (f *FilterList) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// Try array format first
@@ -487,10 +969,22 @@ func (f *FilterList) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 // EncryptionConfig contains encryption settings
 type EncryptionConfig struct {
-	Key       string `yaml:"key" json:"key"`                                 // Encryption key (required if encrypt filter is used)
-	Algorithm string `yaml:"algorithm,omitempty" json:"algorithm,omitempty"` // Encryption algorithm (default: "aes-256-gcm")
+	Key       string `yaml:"key" json:"key" secret:"true"`                   // Encryption key (required if encrypt filter is used)
+	Algorithm string `yaml:"algorithm,omitempty" json:"algorithm,omitempty"` // Encryption algorithm: "aes-256-gcm" (default), "aes-128-gcm", "chacha20-poly1305" or "rsa-oaep"
+
+	// Upstream's PEM RSA public key for rsa-oaep (inline, e.g. "${UPSTREAM_PUBLIC_KEY}", or from file)
+	// Only the upstream's private key decrypts these values; key is not needed when all fields use rsa-oaep
+	PublicKey     string `yaml:"public_key,omitempty" json:"public_key,omitempty"`
+	PublicKeyFile string `yaml:"public_key_file,omitempty" json:"public_key_file,omitempty"` // Path of the PEM public key (alternative to public_key)
+
+	// LegacyEncoding base64-encodes encrypted values twice, as earlier versions did
+	// (compatibility for upstreams that decode twice; new setups should leave it off)
+	LegacyEncoding bool `yaml:"legacy_encoding,omitempty" json:"legacy_encoding,omitempty"`
 }
 
+// encryptionAlgorithms are the supported encryption algorithms
+var encryptionAlgorithms = map[string]bool{"aes-256-gcm": true, "aes-128-gcm": true, "chacha20-poly1305": true, "rsa-oaep": true}
+
 // GetAlgorithm returns the encryption algorithm with default value
 func (e EncryptionConfig) GetAlgorithm() string {
 	if e.Algorithm == "" {
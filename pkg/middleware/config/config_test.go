@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"testing"
 	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
 func TestEmailAuthConfig_GetFromAddress(t *testing.T) {
@@ -519,16 +522,76 @@ func TestConfig_ValidateForwarding(t *testing.T) {
 					{Query: "test"},
 				},
 			},
-			wantErr: errors.New("path is required"),
+			wantErr: errors.New("path or expr is required"),
+		},
+		{
+			name: "valid expression",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Expr: `email.split("@")[0]`, Header: "X-User-Id"},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid expression",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Expr: `email.split(`, Header: "X-User-Id"},
+				},
+			},
+			wantErr: expr.ErrExpressionInvalid,
 		},
 		{
-			name: "missing query and header",
+			name: "path and expression",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Path: "email", Expr: "email", Header: "X-Email"},
+				},
+			},
+			wantErr: errors.New("path and expr are exclusive"),
+		},
+		{
+			name: "missing query, header and body",
 			forwarding: ForwardingConfig{
 				Fields: []ForwardingField{
 					{Path: "email"},
 				},
 			},
-			wantErr: errors.New("at least one of 'query' or 'header' must be specified"),
+			wantErr: errors.New("at least one of 'query', 'header' or 'body' must be specified"),
+		},
+		{
+			name: "body only",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Path: "email", Body: "metadata.user"},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "empty body key",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Path: "email", Body: "metadata..user"},
+				},
+			},
+			wantErr: errors.New("invalid body field 'metadata..user'"),
+		},
+		{
+			name:       "backend without fields",
+			forwarding: ForwardingConfig{Backend: BackendFlowise},
+			wantErr:    nil,
+		},
+		{
+			name:       "unknown backend",
+			forwarding: ForwardingConfig{Backend: "rasa"},
+			wantErr:    ErrForwardingBackendUnknown,
+		},
+		{
+			name:       "relative body path",
+			forwarding: ForwardingConfig{Backend: BackendOpenAI, BodyPath: "v1"},
+			wantErr:    ErrForwardingBodyPathInvalid,
 		},
 		{
 			name: "encrypt filter without encryption config",
@@ -560,6 +623,155 @@ func TestConfig_ValidateForwarding(t *testing.T) {
 			},
 			wantErr: ErrEncryptionKeyTooShort,
 		},
+		{
+			name: "chacha20-poly1305 with aes-128-gcm field override",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Key:       "this-is-a-32-character-encryption-key",
+					Algorithm: "chacha20-poly1305",
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}},
+					{Path: "username", Header: "X-User", Filters: []string{"encrypt"}, Algorithm: "aes-128-gcm"},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "unsupported encryption algorithm",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Key:       "this-is-a-32-character-encryption-key",
+					Algorithm: "aes-192-gcm",
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}},
+				},
+			},
+			wantErr: ErrEncryptionAlgorithmUnsupported,
+		},
+		{
+			name: "unsupported field algorithm",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{Key: "this-is-a-32-character-encryption-key"},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Algorithm: "rot13"},
+				},
+			},
+			wantErr: ErrEncryptionAlgorithmUnsupported,
+		},
+		{
+			name: "field algorithm without encrypt filter",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Algorithm: "aes-128-gcm"},
+				},
+			},
+			wantErr: ErrEncryptionAlgorithmWithoutEncrypt,
+		},
+		{
+			name: "rsa-oaep with public key only",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Algorithm:     "rsa-oaep",
+					PublicKeyFile: "/etc/chatbotgate/upstream.pub.pem",
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "rsa-oaep without public key",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{Key: "this-is-a-32-character-encryption-key"},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Algorithm: "rsa-oaep"},
+				},
+			},
+			wantErr: ErrEncryptionPublicKeyRequired,
+		},
+		{
+			name: "rsa-oaep field mixed with shared key field needs the key",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{PublicKey: "-----BEGIN PUBLIC KEY-----"},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Algorithm: "rsa-oaep"},
+					{Path: "username", Header: "X-User", Filters: []string{"encrypt"}},
+				},
+			},
+			wantErr: ErrEncryptionKeyRequired,
+		},
+		{
+			name: "invalid inline public key",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{Algorithm: "rsa-oaep", PublicKey: "-----BEGIN PUBLIC KEY-----"},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}},
+				},
+			},
+			wantErr: ErrEncryptionPublicKeyInvalid,
+		},
+		{
+			name: "public key inline and from file",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Algorithm:     "rsa-oaep",
+					PublicKey:     "-----BEGIN PUBLIC KEY-----",
+					PublicKeyFile: "/etc/chatbotgate/upstream.pub.pem",
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}},
+				},
+			},
+			wantErr: ErrClientKeySourceConflict,
+		},
+		{
+			name: "stamped query field",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{Key: "this-is-a-32-character-encryption-key"},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Stamp: true},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "stamp without encrypt filter",
+			forwarding: ForwardingConfig{
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Stamp: true},
+				},
+			},
+			wantErr: ErrForwardingStampWithoutEncrypt,
+		},
+		{
+			name: "stamp with legacy encoding",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Key:            "this-is-a-32-character-encryption-key",
+					LegacyEncoding: true,
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Stamp: true},
+				},
+			},
+			wantErr: ErrForwardingStampLegacy,
+		},
+		{
+			name: "legacy encoding with chacha20-poly1305",
+			forwarding: ForwardingConfig{
+				Encryption: &EncryptionConfig{
+					Key:            "this-is-a-32-character-encryption-key",
+					LegacyEncoding: true,
+				},
+				Fields: []ForwardingField{
+					{Path: "email", Query: "email", Filters: []string{"encrypt"}, Algorithm: "chacha20-poly1305"},
+				},
+			},
+			wantErr: ErrEncryptionLegacyAlgorithm,
+		},
 	}
 
 	for _, tt := range tests {
@@ -822,6 +1034,7 @@ func TestServerConfig_GetCallbackURL(t *testing.T) {
 		name    string
 		baseURL string
 		prefix  string
+		mount   string
 		host    string
 		port    int
 		want    string
@@ -850,6 +1063,15 @@ func TestServerConfig_GetCallbackURL(t *testing.T) {
 			port:    4180,
 			want:    "http://localhost:4180/_auth/oauth2/callback",
 		},
+		{
+			name:    "mounted under a sub-path",
+			baseURL: "https://example.com",
+			prefix:  "",
+			mount:   "/bot/",
+			host:    "localhost",
+			port:    4180,
+			want:    "https://example.com/bot/_auth/oauth2/callback",
+		},
 	}
 
 	for _, tt := range tests {
@@ -857,6 +1079,7 @@ func TestServerConfig_GetCallbackURL(t *testing.T) {
 			cfg := ServerConfig{
 				BaseURL:        tt.baseURL,
 				AuthPathPrefix: tt.prefix,
+				MountPath:      tt.mount,
 			}
 			got := cfg.GetCallbackURL(tt.host, tt.port)
 			if got != tt.want {
@@ -866,6 +1089,259 @@ func TestServerConfig_GetCallbackURL(t *testing.T) {
 	}
 }
 
+func TestServerConfig_IsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{
+			name:    "no allowed origins",
+			allowed: nil,
+			origin:  "https://www.example.com",
+			want:    false,
+		},
+		{
+			name:    "exact match",
+			allowed: []string{"https://www.example.com"},
+			origin:  "https://www.example.com",
+			want:    true,
+		},
+		{
+			name:    "case-insensitive match with trailing slash",
+			allowed: []string{"https://WWW.example.com/"},
+			origin:  "https://www.example.com",
+			want:    true,
+		},
+		{
+			name:    "different origin",
+			allowed: []string{"https://www.example.com"},
+			origin:  "https://evil.example.com",
+			want:    false,
+		},
+		{
+			name:    "wildcard",
+			allowed: []string{"*"},
+			origin:  "https://any.example.org",
+			want:    true,
+		},
+		{
+			name:    "empty origin",
+			allowed: []string{"*"},
+			origin:  "",
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ServerConfig{AllowedOrigins: tt.allowed}
+			got := cfg.IsOriginAllowed(tt.origin)
+			if got != tt.want {
+				t.Errorf("IsOriginAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieConfig_MatchesDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		host   string
+		want   bool
+	}{
+		{name: "no domain configured", domain: "", host: "app1.example.com", want: false},
+		{name: "subdomain with leading dot", domain: ".example.com", host: "app1.example.com", want: true},
+		{name: "subdomain without leading dot", domain: "example.com", host: "app2.example.com", want: true},
+		{name: "apex domain", domain: ".example.com", host: "example.com", want: true},
+		{name: "host with port", domain: ".example.com", host: "app1.example.com:8443", want: true},
+		{name: "case-insensitive", domain: ".Example.com", host: "APP1.example.com", want: true},
+		{name: "different domain", domain: ".example.com", host: "app1.example.org", want: false},
+		{name: "suffix without dot boundary", domain: ".example.com", host: "evilexample.com", want: false},
+		{name: "empty host", domain: ".example.com", host: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CookieConfig{Domain: tt.domain}
+			got := cfg.MatchesDomain(tt.host)
+			if got != tt.want {
+				t.Errorf("MatchesDomain(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateCentralAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		centralAuthURL string
+		cookieDomain   string
+		wantErr        error
+	}{
+		{
+			name:           "central auth disabled",
+			centralAuthURL: "",
+			cookieDomain:   "",
+			wantErr:        nil,
+		},
+		{
+			name:           "valid central auth",
+			centralAuthURL: "https://auth.example.com",
+			cookieDomain:   ".example.com",
+			wantErr:        nil,
+		},
+		{
+			name:           "missing cookie domain",
+			centralAuthURL: "https://auth.example.com",
+			cookieDomain:   "",
+			wantErr:        ErrCentralAuthDomainRequired,
+		},
+		{
+			name:           "central host outside cookie domain",
+			centralAuthURL: "https://auth.example.org",
+			cookieDomain:   ".example.com",
+			wantErr:        ErrCentralAuthURLInvalid,
+		},
+		{
+			name:           "relative central auth URL",
+			centralAuthURL: "/auth",
+			cookieDomain:   ".example.com",
+			wantErr:        ErrCentralAuthURLInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Service: ServiceConfig{Name: "Test Service"},
+				Server:  ServerConfig{CentralAuthURL: tt.centralAuthURL},
+				Session: SessionConfig{
+					Cookie: CookieConfig{
+						Secret: "this-is-a-secret-key-with-32-characters",
+						Domain: tt.cookieDomain,
+					},
+				},
+				PasswordAuth: PasswordAuthConfig{Enabled: true, Password: "secret"},
+			}
+
+			err := cfg.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateAdminToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "admin API disabled", token: "", wantErr: false},
+		{name: "valid token", token: "admin-token-with-at-least-32-characters", wantErr: false},
+		{name: "token too short", token: "short-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Service: ServiceConfig{Name: "Test Service"},
+				Server:  ServerConfig{AdminToken: tt.token},
+				Session: SessionConfig{
+					Cookie: CookieConfig{Secret: "this-is-a-secret-key-with-32-characters"},
+				},
+				PasswordAuth: PasswordAuthConfig{Enabled: true, Password: "secret"},
+			}
+
+			err := cfg.Validate()
+			if tt.wantErr {
+				if !errors.Is(err, ErrAdminTokenTooShort) {
+					t.Errorf("Validate() error = %v, want %v", err, ErrAdminTokenTooShort)
+				}
+			} else if err != nil {
+				t.Errorf("Validate() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateIntrospectionSecret(t *testing.T) {
+	for secret, want := range map[string]error{
+		"":                                  nil,
+		"introspection-secret-of-32-chars!": nil,
+		"short-secret":                      ErrIntrospectionSecretTooShort,
+	} {
+		cfg := &Config{
+			Service: ServiceConfig{Name: "Test Service"},
+			Server:  ServerConfig{IntrospectionSecret: secret},
+			Session: SessionConfig{
+				Cookie: CookieConfig{Secret: "this-is-a-secret-key-with-32-characters"},
+			},
+			PasswordAuth: PasswordAuthConfig{Enabled: true, Password: "secret"},
+		}
+		if err := cfg.Validate(); want == nil && err != nil || !errors.Is(err, want) {
+			t.Errorf("Validate(%q) error = %v, want %v", secret, err, want)
+		}
+	}
+}
+
+func TestServerConfig_MountPath(t *testing.T) {
+	tests := []struct {
+		mount, prefix               string
+		wantMount, wantPublic, want string
+	}{
+		{"", "", "", "/_auth", "/"},
+		{"/bot", "", "/bot", "/bot/_auth", "/bot"},
+		{"/apps/bot/", "/_oauth2/", "/apps/bot", "/apps/bot/_oauth2", "/apps/bot"},
+	}
+	for _, tt := range tests {
+		cfg := ServerConfig{MountPath: tt.mount, AuthPathPrefix: tt.prefix}
+		if got := cfg.GetMountPath(); got != tt.wantMount {
+			t.Errorf("GetMountPath(%q) = %q, want %q", tt.mount, got, tt.wantMount)
+		}
+		if got := cfg.GetPublicAuthPathPrefix(); got != tt.wantPublic {
+			t.Errorf("GetPublicAuthPathPrefix(%q) = %q, want %q", tt.mount, got, tt.wantPublic)
+		}
+		if got := cfg.GetCookiePath(); got != tt.want {
+			t.Errorf("GetCookiePath(%q) = %q, want %q", tt.mount, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_ValidateMountPath(t *testing.T) {
+	for mount, want := range map[string]error{
+		"":             nil,
+		"/bot":         nil,
+		"/apps/bot/":   nil,
+		"bot":          ErrMountPathInvalid,
+		"//evil.com":   ErrMountPathInvalid,
+		"/bot?x=1":     ErrMountPathInvalid,
+		"/apps/../bot": ErrMountPathInvalid,
+	} {
+		cfg := &Config{
+			Service: ServiceConfig{Name: "Test Service"},
+			Server:  ServerConfig{MountPath: mount},
+			Session: SessionConfig{
+				Cookie: CookieConfig{Secret: "this-is-a-secret-key-with-32-characters"},
+			},
+			PasswordAuth: PasswordAuthConfig{Enabled: true, Password: "secret"},
+		}
+		if err := cfg.Validate(); want == nil && err != nil || !errors.Is(err, want) {
+			t.Errorf("Validate(%q) error = %v, want %v", mount, err, want)
+		}
+	}
+}
+
 func TestCookieConfig_GetSameSite(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1141,3 +1617,30 @@ func TestNamespaceConfig_SetDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Validate_SessionCacheTTL(t *testing.T) {
+	baseConfig := func() *Config {
+		return &Config{
+			Service: ServiceConfig{Name: "Test Service"},
+			Session: SessionConfig{Cookie: CookieConfig{Secret: "this-is-a-secret-key-with-32-characters"}},
+			OAuth2: OAuth2Config{
+				Providers: []OAuth2Provider{{ID: "google", Type: "google", ClientID: "test", ClientSecret: "test"}},
+			},
+		}
+	}
+
+	for _, ttl := range []string{"", "30s"} {
+		cfg := baseConfig()
+		cfg.KVS.SessionCache = kvs.CacheConfig{Enabled: true, TTL: ttl}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate() with ttl %q error = %v", ttl, err)
+		}
+	}
+	for _, ttl := range []string{"5", "-5s"} {
+		cfg := baseConfig()
+		cfg.KVS.SessionCache = kvs.CacheConfig{Enabled: true, TTL: ttl}
+		if err := cfg.Validate(); !errors.Is(err, ErrSessionCacheTTLInvalid) {
+			t.Errorf("Validate() with ttl %q error = %v, want %v", ttl, err, ErrSessionCacheTTLInvalid)
+		}
+	}
+}
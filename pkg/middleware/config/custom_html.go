@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Auth page names used as keys of ServiceConfig.CustomPages
+const (
+	PageLogin           = "login"
+	PageLogout          = "logout"
+	PageEmailSent       = "email_sent"
+	PageForbidden       = "forbidden"
+	PageEmailRequired   = "email_required"
+	PageEmailUnverified = "email_unverified"
+	PageNotFound        = "not_found"
+	PageServerError     = "server_error"
+	PageUpstreamError   = "upstream_error"
+	PageGuestLimit      = "guest_limit"
+	PageScopeConsent    = "scope_consent"
+)
+
+// knownPages lists the auth pages that accept custom HTML
+var knownPages = map[string]bool{
+	PageLogin:           true,
+	PageLogout:          true,
+	PageEmailSent:       true,
+	PageForbidden:       true,
+	PageEmailRequired:   true,
+	PageEmailUnverified: true,
+	PageNotFound:        true,
+	PageServerError:     true,
+	PageUpstreamError:   true,
+	PageGuestLimit:      true,
+	PageScopeConsent:    true,
+}
+
+// CustomPageHTML contains custom HTML snippets for a single auth page
+type CustomPageHTML struct {
+	HeadHTML   string `yaml:"head_html" json:"head_html"`     // Optional: Overrides service.custom_head_html on this page
+	FooterHTML string `yaml:"footer_html" json:"footer_html"` // Optional: Overrides service.custom_footer_html on this page
+}
+
+// CustomHTMLFor returns the head and footer HTML for the given page
+// Per-page snippets take precedence over the service-wide ones
+func (s ServiceConfig) CustomHTMLFor(page string) (head, footer string) {
+	head, footer = s.CustomHeadHTML, s.CustomFooterHTML
+	if p, ok := s.CustomPages[page]; ok {
+		if p.HeadHTML != "" {
+			head = p.HeadHTML
+		}
+		if p.FooterHTML != "" {
+			footer = p.FooterHTML
+		}
+	}
+	return head, footer
+}
+
+// validateCustomHTML validates custom page keys and CSP script sources
+func (s ServiceConfig) validateCustomHTML() error {
+	verr := NewValidationError()
+
+	pages := make([]string, 0, len(s.CustomPages))
+	for page := range s.CustomPages {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	for _, page := range pages {
+		if !knownPages[page] {
+			verr.Add(fmt.Errorf("service.custom_pages.%s: %w", page, ErrCustomPageUnknown))
+		}
+	}
+
+	for i, src := range s.CustomScriptSrc {
+		if src == "" || strings.ContainsAny(src, "; ,\t\r\n") {
+			verr.Add(fmt.Errorf("service.custom_script_src[%d]: %w", i, ErrCSPSourceInvalid))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServiceConfig_CustomHTMLFor(t *testing.T) {
+	s := ServiceConfig{
+		CustomHeadHTML:   "<head-global>",
+		CustomFooterHTML: "<footer-global>",
+		CustomPages: map[string]CustomPageHTML{
+			PageLogin:       {HeadHTML: "<head-login>"},
+			PageServerError: {FooterHTML: "<footer-500>"},
+		},
+	}
+
+	tests := []struct {
+		page       string
+		wantHead   string
+		wantFooter string
+	}{
+		{PageLogin, "<head-login>", "<footer-global>"},
+		{PageServerError, "<head-global>", "<footer-500>"},
+		{PageLogout, "<head-global>", "<footer-global>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			head, footer := s.CustomHTMLFor(tt.page)
+			if head != tt.wantHead || footer != tt.wantFooter {
+				t.Errorf("CustomHTMLFor(%q) = (%q, %q), want (%q, %q)", tt.page, head, footer, tt.wantHead, tt.wantFooter)
+			}
+		})
+	}
+}
+
+func TestServiceConfig_ValidateCustomHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		service ServiceConfig
+		wantErr error
+	}{
+		{"empty", ServiceConfig{}, nil},
+		{
+			"valid",
+			ServiceConfig{
+				CustomPages:     map[string]CustomPageHTML{PageLogin: {}, PageNotFound: {}},
+				CustomScriptSrc: []string{"https://www.googletagmanager.com", "'sha256-abc='"},
+			},
+			nil,
+		},
+		{"unknown page", ServiceConfig{CustomPages: map[string]CustomPageHTML{"signup": {}}}, ErrCustomPageUnknown},
+		{"source injection", ServiceConfig{CustomScriptSrc: []string{"https://a.example.com; object-src *"}}, ErrCSPSourceInvalid},
+		{"empty source", ServiceConfig{CustomScriptSrc: []string{""}}, ErrCSPSourceInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.service.validateCustomHTML()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateCustomHTML() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateCustomHTML() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
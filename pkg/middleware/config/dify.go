@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Session values that can be written into Dify's user field
+const (
+	DifyUserEmail    = "email"    // Email address (default)
+	DifyUserUsername = "username" // Display name from the OAuth2 provider, falling back to the email address
+	DifyUserUserpart = "userpart" // Local part of the email address (before @)
+)
+
+// DifyConfig contains the Dify integration settings
+// The Dify app API key stays on the server: it is added to proxied Dify API requests of
+// authenticated users, and the user is written into Dify's "user" field so that
+// conversations are attributed per user
+type DifyConfig struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled"`               // Enable the Dify integration
+	APIKey    string `yaml:"api_key" json:"api_key" secret:"true"` // Dify app API key (e.g., "app-xxxx"), sent as "Authorization: Bearer" to the upstream (required when enabled)
+	APIPath   string `yaml:"api_path" json:"api_path"`             // Path prefix of the Dify API (default: "/v1")
+	UserField string `yaml:"user_field" json:"user_field"`         // Value written into Dify's user field: "email", "username" or "userpart" (default: "email")
+
+	// Embedded chat widget (served at {auth_path_prefix}/dify/embed.js, also without enabled)
+	WidgetToken string `yaml:"widget_token" json:"widget_token" secret:"true"` // Optional: Token of the Dify web app from its embed snippet (enables embed.js)
+}
+
+// GetAPIPath returns the Dify API path prefix without a trailing slash
+// If not set, returns the default "/v1"
+func (d DifyConfig) GetAPIPath() string {
+	path := strings.TrimSuffix(d.APIPath, "/")
+	if path == "" {
+		return "/v1"
+	}
+	return path
+}
+
+// GetUserField returns the session value written into Dify's user field
+// If not set, returns the default "email"
+func (d DifyConfig) GetUserField() string {
+	if d.UserField == "" {
+		return DifyUserEmail
+	}
+	return d.UserField
+}
+
+// Validate checks the Dify integration settings
+func (d DifyConfig) Validate() error {
+	verr := NewValidationError()
+
+	// The token is embedded in generated JavaScript and used as an element ID
+	for _, c := range d.WidgetToken {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			verr.Add(fmt.Errorf("dify.widget_token: %w", ErrDifyWidgetTokenInvalid))
+			break
+		}
+	}
+
+	if !d.Enabled {
+		return verr.ErrorOrNil()
+	}
+
+	if d.APIKey == "" {
+		verr.Add(ErrDifyAPIKeyRequired)
+	}
+
+	if d.APIPath != "" && !strings.HasPrefix(d.APIPath, "/") {
+		verr.Add(fmt.Errorf("dify.api_path: %w", ErrDifyAPIPathInvalid))
+	}
+
+	switch d.GetUserField() {
+	case DifyUserEmail, DifyUserUsername, DifyUserUserpart:
+	default:
+		verr.Add(fmt.Errorf("dify.user_field: %w", ErrDifyUserFieldInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDifyConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dify    DifyConfig
+		wantErr error
+	}{
+		{"disabled", DifyConfig{}, nil},
+		{"disabled ignores other fields", DifyConfig{UserField: "unknown"}, nil},
+		{"valid", DifyConfig{Enabled: true, APIKey: "app-xxxx", APIPath: "/api/v1", UserField: DifyUserUserpart}, nil},
+		{"missing api key", DifyConfig{Enabled: true}, ErrDifyAPIKeyRequired},
+		{"relative api path", DifyConfig{Enabled: true, APIKey: "app-xxxx", APIPath: "v1"}, ErrDifyAPIPathInvalid},
+		{"unknown user field", DifyConfig{Enabled: true, APIKey: "app-xxxx", UserField: "sub"}, ErrDifyUserFieldInvalid},
+		{"widget only", DifyConfig{WidgetToken: "AbC_12-x"}, nil},
+		{"widget token injection", DifyConfig{WidgetToken: "x');alert(1)//"}, ErrDifyWidgetTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dify.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDifyConfig_Defaults(t *testing.T) {
+	d := DifyConfig{}
+	if got := d.GetAPIPath(); got != "/v1" {
+		t.Errorf("GetAPIPath() = %q, want /v1", got)
+	}
+	if got := d.GetUserField(); got != DifyUserEmail {
+		t.Errorf("GetUserField() = %q, want %q", got, DifyUserEmail)
+	}
+
+	d.APIPath = "/dify/v1/"
+	if got := d.GetAPIPath(); got != "/dify/v1" {
+		t.Errorf("GetAPIPath() = %q, want /dify/v1", got)
+	}
+}
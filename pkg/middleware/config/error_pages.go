@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Error response modes
+const (
+	ErrorModePage  = "page"  // Default: the branded error page (JSON for clients that prefer it)
+	ErrorModeProxy = "proxy" // The upstream answers
+	ErrorModeJSON  = "json"  // Always JSON, e.g. for API-only deployments
+)
+
+// ErrorsConfig configures the 404 and 403 responses of the gate
+type ErrorsConfig struct {
+	NotFound  ErrorResponseConfig `yaml:"not_found" json:"not_found"` // Unknown paths under the auth path prefix
+	Forbidden ErrorResponseConfig `yaml:"forbidden" json:"forbidden"` // Denied access (authorization, access rules, step-up)
+}
+
+// ErrorResponseConfig configures the response of one error status
+type ErrorResponseConfig struct {
+	Mode string `yaml:"mode" json:"mode"` // Optional: "page" (default), "proxy" or "json"
+	Path string `yaml:"path" json:"path"` // proxy: Upstream path whose response is served with the error status (required for forbidden; not_found without path passes unknown auth paths to the upstream like any other path)
+	JSON string `yaml:"json" json:"json"` // Optional: JSON body of the json mode and of clients preferring JSON (default: {"error": "not_found" or "forbidden", "message": ...})
+}
+
+// GetMode returns the mode of the error response
+func (e ErrorResponseConfig) GetMode() string {
+	if e.Mode == "" {
+		return ErrorModePage
+	}
+	return e.Mode
+}
+
+// PassesThrough reports whether requests are passed to the upstream as they are (proxy mode without path)
+func (e ErrorResponseConfig) PassesThrough() bool {
+	return e.GetMode() == ErrorModeProxy && e.Path == ""
+}
+
+// Validate checks the error responses
+func (e ErrorsConfig) Validate() error {
+	verr := NewValidationError()
+	e.NotFound.validate("errors.not_found", false, verr)
+	e.Forbidden.validate("errors.forbidden", true, verr)
+	return verr.ErrorOrNil()
+}
+
+// validate checks the error response at field; requirePath makes the proxy mode require a path
+func (e ErrorResponseConfig) validate(field string, requirePath bool, verr *ValidationError) {
+	switch e.GetMode() {
+	case ErrorModePage, ErrorModeJSON:
+	case ErrorModeProxy:
+		if requirePath && e.Path == "" {
+			verr.Add(fmt.Errorf("%s.path: %w", field, ErrErrorPathRequired))
+		}
+	default:
+		verr.Add(fmt.Errorf("%s.mode: %w", field, ErrErrorModeInvalid))
+	}
+
+	if e.Path != "" && !isLocalPath(e.Path) {
+		verr.Add(fmt.Errorf("%s.path: %w", field, ErrErrorPathInvalid))
+	}
+	if e.JSON != "" && !json.Valid([]byte(e.JSON)) {
+		verr.Add(fmt.Errorf("%s.json: %w", field, ErrErrorJSONInvalid))
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorsConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  ErrorsConfig
+		wantErr error
+	}{
+		{"defaults", ErrorsConfig{}, nil},
+		{"proxied unknown paths", ErrorsConfig{NotFound: ErrorResponseConfig{Mode: ErrorModeProxy}}, nil},
+		{"proxied forbidden page", ErrorsConfig{Forbidden: ErrorResponseConfig{Mode: ErrorModeProxy, Path: "/403.html"}}, nil},
+		{"custom json", ErrorsConfig{NotFound: ErrorResponseConfig{Mode: ErrorModeJSON, JSON: `{"code": 404}`}}, nil},
+		{"invalid mode", ErrorsConfig{NotFound: ErrorResponseConfig{Mode: "redirect"}}, ErrErrorModeInvalid},
+		{"proxied forbidden without path", ErrorsConfig{Forbidden: ErrorResponseConfig{Mode: ErrorModeProxy}}, ErrErrorPathRequired},
+		{"absolute path", ErrorsConfig{NotFound: ErrorResponseConfig{Mode: ErrorModeProxy, Path: "https://example.com/404"}}, ErrErrorPathInvalid},
+		{"invalid json", ErrorsConfig{Forbidden: ErrorResponseConfig{Mode: ErrorModeJSON, JSON: `{"code":`}}, ErrErrorJSONInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.errors.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestErrorResponseConfig_PassesThrough(t *testing.T) {
+	if (ErrorResponseConfig{}).PassesThrough() {
+		t.Error("Page mode should not pass through")
+	}
+	if !(ErrorResponseConfig{Mode: ErrorModeProxy}).PassesThrough() {
+		t.Error("Proxy mode without path should pass through")
+	}
+	if (ErrorResponseConfig{Mode: ErrorModeProxy, Path: "/404.html"}).PassesThrough() {
+		t.Error("Proxy mode with path should serve the upstream page instead")
+	}
+}
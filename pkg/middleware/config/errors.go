@@ -29,4 +29,370 @@ var (
 
 	// ErrEncryptionConfigRequired is returned when encrypt filter is used but encryption config is not provided
 	ErrEncryptionConfigRequired = errors.New("encryption configuration is required when 'encrypt' filter is used")
+
+	// ErrEncryptionAlgorithmUnsupported is returned for unknown encryption algorithms
+	ErrEncryptionAlgorithmUnsupported = errors.New("encryption algorithm must be aes-256-gcm, aes-128-gcm, chacha20-poly1305 or rsa-oaep")
+
+	// ErrForwardingStampWithoutEncrypt is returned when a field sets stamp without the encrypt filter
+	ErrForwardingStampWithoutEncrypt = errors.New("stamp requires the 'encrypt' filter")
+
+	// ErrForwardingStampLegacy is returned when stamp is combined with legacy encoding, which has no envelope to mark stamped values
+	ErrForwardingStampLegacy = errors.New("stamp is not supported with legacy_encoding")
+
+	// ErrEncryptionPublicKeyRequired is returned when rsa-oaep is used without the upstream's public key
+	ErrEncryptionPublicKeyRequired = errors.New("public_key or public_key_file is required by rsa-oaep")
+
+	// ErrEncryptionPublicKeyInvalid is returned when the inline public key is not a PEM RSA public key of 2048 bits or more
+	ErrEncryptionPublicKeyInvalid = errors.New("public_key must be a PEM RSA public key of 2048 bits or more")
+
+	// ErrEncryptionLegacyAlgorithm is returned when legacy encoding is combined with another algorithm than aes-256-gcm
+	ErrEncryptionLegacyAlgorithm = errors.New("legacy_encoding supports aes-256-gcm only")
+
+	// ErrEncryptionAlgorithmWithoutEncrypt is returned when a field sets an algorithm without the encrypt filter
+	ErrEncryptionAlgorithmWithoutEncrypt = errors.New("algorithm requires the 'encrypt' filter")
+
+	// ErrCentralAuthDomainRequired is returned when central auth is configured without a cookie domain
+	ErrCentralAuthDomainRequired = errors.New("session.cookie.domain is required when server.central_auth_url is set")
+
+	// ErrCentralAuthURLInvalid is returned when the central auth URL is not within the cookie domain
+	ErrCentralAuthURLInvalid = errors.New("server.central_auth_url must be an absolute URL within session.cookie.domain")
+
+	// ErrTenantIDRequired is returned when a tenant has no ID
+	ErrTenantIDRequired = errors.New("tenant id is required")
+
+	// ErrTenantHostsRequired is returned when a tenant has no hostnames
+	ErrTenantHostsRequired = errors.New("tenant hosts are required")
+
+	// ErrAdminTokenTooShort is returned when the admin API token is too short
+	ErrAdminTokenTooShort = errors.New("server.admin_token must be at least 32 characters")
+
+	// ErrIntrospectionSecretTooShort is returned when the introspection shared secret is too short
+	ErrIntrospectionSecretTooShort = errors.New("server.introspection_secret must be at least 32 characters")
+
+	// ErrMountPathInvalid is returned when the mount path is not a plain path starting with "/"
+	ErrMountPathInvalid = errors.New("server.mount_path must be a path starting with \"/\" (e.g., \"/bot\"), without query, fragment or \"..\"")
+
+	// ErrServiceTokenNameRequired is returned when a service token has no name
+	ErrServiceTokenNameRequired = errors.New("service token name is required")
+
+	// ErrServiceTokenNameDuplicate is returned when two service tokens have the same name
+	ErrServiceTokenNameDuplicate = errors.New("service token name must be unique")
+
+	// ErrServiceTokenCredentialRequired is returned when a service token has neither a token nor a client certificate subject
+	ErrServiceTokenCredentialRequired = errors.New("service token requires token or client_cert_subject")
+
+	// ErrServiceTokenCredentialConflict is returned when a service token has both a token and a client certificate subject
+	ErrServiceTokenCredentialConflict = errors.New("service token must set only one of token and client_cert_subject")
+
+	// ErrServiceTokenTooShort is returned when a service token is too short
+	ErrServiceTokenTooShort = errors.New("service token must be at least 32 characters")
+
+	// ErrServiceTokenPathsRequired is returned when a service token allows no paths
+	ErrServiceTokenPathsRequired = errors.New("service token paths are required")
+
+	// ErrServiceTokenPathInvalid is returned when a service token path is not a valid glob starting with "/"
+	ErrServiceTokenPathInvalid = errors.New("service token path must be a valid glob pattern starting with \"/\"")
+
+	// ErrServiceTokenMethodInvalid is returned when a service token method is not an HTTP method
+	ErrServiceTokenMethodInvalid = errors.New("service token method must be an HTTP method")
+
+	// ErrPluginNameRequired is returned when a plugin has no name
+	ErrPluginNameRequired = errors.New("plugin name is required")
+
+	// ErrPluginNameInvalid is returned when a plugin name cannot be used in the callback path
+	ErrPluginNameInvalid = errors.New("plugin name must only contain lowercase letters, digits, \"-\" and \"_\"")
+
+	// ErrPluginNameDuplicate is returned when two plugins have the same name
+	ErrPluginNameDuplicate = errors.New("plugin name must be unique")
+
+	// ErrPluginCommandRequired is returned when a plugin has no command
+	ErrPluginCommandRequired = errors.New("plugin command is required")
+
+	// ErrPluginHooksRequired is returned when a plugin handles no hook
+	ErrPluginHooksRequired = errors.New("plugin hooks are required")
+
+	// ErrPluginHookInvalid is returned when a plugin hook is not "request" or "callback"
+	ErrPluginHookInvalid = errors.New("plugin hook must be \"request\" or \"callback\"")
+
+	// ErrPluginPathInvalid is returned when a plugin path is not a valid glob starting with "/"
+	ErrPluginPathInvalid = errors.New("plugin path must be a valid glob pattern starting with \"/\"")
+
+	// ErrPluginTimeoutInvalid is returned when a plugin timeout is not a positive duration
+	ErrPluginTimeoutInvalid = errors.New("plugin timeout must be a positive duration")
+
+	// ErrExperimentNameInvalid is returned when an experiment or variant name cannot be used in the bucketing cookie
+	ErrExperimentNameInvalid = errors.New("experiment and variant names must only contain lowercase letters, digits, \"-\" and \"_\"")
+
+	// ErrExperimentVariantDuplicate is returned when two variants of the login experiment have the same name
+	ErrExperimentVariantDuplicate = errors.New("variant name must be unique")
+
+	// ErrExperimentPercentInvalid is returned when a variant's share of visitors is not between 1 and 100
+	ErrExperimentPercentInvalid = errors.New("variant percent must be between 1 and 100")
+
+	// ErrExperimentPercentTotal is returned when the shares of the variants do not add up to 100
+	ErrExperimentPercentTotal = errors.New("variant percents must add up to 100")
+
+	// ErrExperimentProviderUnknown is returned when a variant orders a provider that is not configured
+	ErrExperimentProviderUnknown = errors.New("provider_order must only list configured provider IDs")
+
+	// ErrExperimentButtonStyleInvalid is returned when a variant's button style is not supported
+	ErrExperimentButtonStyleInvalid = errors.New("button style must be one of: secondary, primary, ghost")
+
+	// ErrAnnouncementSeverityInvalid is returned when the announcement severity is not supported
+	ErrAnnouncementSeverityInvalid = errors.New("announcement severity must be one of: info, warning, critical")
+
+	// ErrAnnouncementWindowInvalid is returned when the announcement ends before it starts
+	ErrAnnouncementWindowInvalid = errors.New("announcement must end after it starts")
+
+	// ErrSessionMaxLifetimeInvalid is returned when the maximum lifetime of sliding sessions is not a positive duration
+	ErrSessionMaxLifetimeInvalid = errors.New("session max lifetime must be a positive duration (e.g., \"720h\")")
+
+	// ErrSessionMaxLifetimeTooShort is returned when the maximum lifetime of sliding sessions is shorter than the session lifetime
+	ErrSessionMaxLifetimeTooShort = errors.New("session max lifetime must not be shorter than session.cookie.expire")
+
+	// ErrWebSocketIntervalInvalid is returned when the session check interval of WebSocket connections is too short
+	ErrWebSocketIntervalInvalid = errors.New("websocket session check interval must be a duration of at least 1s")
+
+	// ErrWebSocketGraceInvalid is returned when the grace period of WebSocket connections is not a duration
+	ErrWebSocketGraceInvalid = errors.New("websocket grace must be a non-negative duration (e.g., \"30s\")")
+
+	// ErrWebSocketCloseCodeInvalid is returned when the WebSocket close code cannot be sent by a server
+	ErrWebSocketCloseCodeInvalid = errors.New("websocket close code must be 1000, 1001, 1008 or between 3000 and 4999")
+
+	// ErrStreamLimitPathsRequired is returned when a stream limit has no path patterns
+	ErrStreamLimitPathsRequired = errors.New("stream limit paths are required")
+
+	// ErrStreamLimitPathInvalid is returned when a stream limit path pattern is not a valid glob starting with /
+	ErrStreamLimitPathInvalid = errors.New("stream limit path must be a glob pattern starting with /")
+
+	// ErrStreamLimitBytesInvalid is returned when a stream limit byte count is negative
+	ErrStreamLimitBytesInvalid = errors.New("stream limit max_response_bytes must not be negative")
+
+	// ErrStreamLimitDurationInvalid is returned when a stream limit duration is not a positive duration
+	ErrStreamLimitDurationInvalid = errors.New("stream limit max_duration must be a positive duration (e.g., \"5m\")")
+
+	// ErrStreamLimitRequired is returned when a stream limit sets neither limit
+	ErrStreamLimitRequired = errors.New("stream limit must set max_response_bytes or max_duration")
+
+	// ErrErrorModeInvalid is returned when an error response mode is not supported
+	ErrErrorModeInvalid = errors.New("error response mode must be one of: page, proxy, json")
+
+	// ErrErrorPathRequired is returned when the forbidden response is proxied without upstream path
+	ErrErrorPathRequired = errors.New("path is required for the proxy mode")
+
+	// ErrErrorPathInvalid is returned when the upstream path of an error response is not a local path
+	ErrErrorPathInvalid = errors.New("path must be a local path starting with '/'")
+
+	// ErrErrorJSONInvalid is returned when the JSON body of an error response is not valid JSON
+	ErrErrorJSONInvalid = errors.New("json must be valid JSON")
+
+	// ErrThemeValueInvalid is returned when a theming token contains characters that are not allowed in CSS values
+	ErrThemeValueInvalid = errors.New("theme value must not contain ';', '{', '}', '<', '>', '\\' or comments")
+
+	// ErrThemeCardStyleInvalid is returned when the card style is not one of the supported styles
+	ErrThemeCardStyleInvalid = errors.New("card style must be one of: elevated, flat, bordered")
+
+	// ErrCustomPageUnknown is returned when custom HTML is configured for an unknown auth page
+	ErrCustomPageUnknown = errors.New("unknown page (valid: login, logout, email_sent, forbidden, email_required, email_unverified, not_found, server_error, upstream_error, guest_limit, scope_consent)")
+
+	// ErrCSPSourceInvalid is returned when a CSP source is empty or contains separators
+	ErrCSPSourceInvalid = errors.New("CSP source must be a single non-empty token without ';', ',' or whitespace")
+
+	// ErrDifyAPIKeyRequired is returned when the Dify integration is enabled without an API key
+	ErrDifyAPIKeyRequired = errors.New("dify.api_key is required when dify is enabled")
+
+	// ErrDifyAPIPathInvalid is returned when the Dify API path does not start with "/"
+	ErrDifyAPIPathInvalid = errors.New("API path must start with '/'")
+
+	// ErrDifyUserFieldInvalid is returned when the Dify user field is not supported
+	ErrDifyUserFieldInvalid = errors.New("user field must be one of: email, username, userpart")
+
+	// ErrDifyWidgetTokenInvalid is returned when the Dify widget token contains characters other than letters, digits, '-' and '_'
+	ErrDifyWidgetTokenInvalid = errors.New("widget token must contain only letters, digits, '-' and '_'")
+
+	// ErrForwardingBackendUnknown is returned when forwarding.backend is not a built-in backend profile
+	ErrForwardingBackendUnknown = errors.New("unknown backend (valid: flowise, librechat, openai)")
+
+	// ErrForwardingBodyPathInvalid is returned when forwarding.body_path does not start with "/"
+	ErrForwardingBodyPathInvalid = errors.New("body path must start with '/'")
+
+	// ErrForwardingAuditPathRequired is returned when the forwarding audit log is enabled without a file path
+	ErrForwardingAuditPathRequired = errors.New("audit log file path is required")
+
+	// ErrForwardingAuditRetentionInvalid is returned when a rotation or retention setting of the audit log is negative
+	ErrForwardingAuditRetentionInvalid = errors.New("audit log max_size_mb, max_backups and max_age must not be negative")
+
+	// ErrPrivacySaltRequired is returned when PII minimization is enabled without salt
+	ErrPrivacySaltRequired = errors.New("salt is required when privacy.minimize is enabled")
+
+	// ErrPrivacySaltTooShort is returned when the salt of email hashes is shorter than 16 characters
+	ErrPrivacySaltTooShort = errors.New("salt must be at least 16 characters")
+
+	// ErrPrivacyFieldNotApproved is returned when PII minimization is enabled and a forwarding field is not in privacy.forwarded_fields
+	ErrPrivacyFieldNotApproved = errors.New("field is not in privacy.forwarded_fields")
+
+	// ErrPrivacyIDPConflict is returned when PII minimization and the IdP mode are both enabled
+	ErrPrivacyIDPConflict = errors.New("IdP mode cannot issue email claims when privacy.minimize is enabled")
+
+	// ErrPrivacyEmailHashInvalid is returned when an allowlist entry looks like an email hash but is not one, or privacy.minimize is disabled
+	ErrPrivacyEmailHashInvalid = errors.New("hashed allowlist entries must be hmac-sha256:<64 hex digits> and require privacy.minimize")
+
+	// ErrMetadataLimitInvalid is returned when a session metadata limit is negative
+	ErrMetadataLimitInvalid = errors.New("limit must not be negative")
+
+	// ErrSessionGCIntervalInvalid is returned when session.gc.interval is not a duration of at least a minute
+	ErrSessionGCIntervalInvalid = errors.New("session GC interval must be a duration of at least 1m")
+
+	// ErrSessionGCBatchSizeInvalid is returned when session.gc.batch_size is negative
+	ErrSessionGCBatchSizeInvalid = errors.New("session GC batch size must not be negative")
+
+	// ErrGuestSessionTTLInvalid is returned when guest.session_ttl is not a positive duration
+	ErrGuestSessionTTLInvalid = errors.New("session TTL must be a positive duration (e.g., \"1h\")")
+
+	// ErrGuestRequestLimitInvalid is returned when guest.request_limit is negative
+	ErrGuestRequestLimitInvalid = errors.New("request limit must not be negative")
+
+	// ErrGuestStartLimitInvalid is returned when guest.start_limit_per_minute is negative
+	ErrGuestStartLimitInvalid = errors.New("start limit must not be negative")
+
+	// ErrGuestLimitPathInvalid is returned when guest.limit_path does not start with "/"
+	ErrGuestLimitPathInvalid = errors.New("limit path must start with '/'")
+
+	// ErrRedirectPatternInvalid is returned when a redirect allow or deny pattern is not a valid glob starting with "/"
+	ErrRedirectPatternInvalid = errors.New("pattern must be a valid glob starting with '/'")
+
+	// ErrRedirectFallbackInvalid is returned when redirect.fallback is not a local path
+	ErrRedirectFallbackInvalid = errors.New("fallback must be a path starting with '/'")
+
+	// ErrRedirectFallbackRejected is returned when redirect.fallback is itself rejected by the allow or deny patterns
+	ErrRedirectFallbackRejected = errors.New("fallback must be allowed by redirect.allow and redirect.deny")
+
+	// ErrDefaultRedirectInvalid is returned when server.default_redirect is not a local path
+	ErrDefaultRedirectInvalid = errors.New("default redirect must be a path starting with '/'")
+
+	// ErrOAuth2OptionUnsupported is returned when a provider option is set for a provider type that does not support it
+	ErrOAuth2OptionUnsupported = errors.New("option is not supported by this provider type")
+
+	// ErrGitHubTeamInvalid is returned when an allowed_teams entry is not in "org/team-slug" form
+	ErrGitHubTeamInvalid = errors.New("team must be in \"org/team-slug\" form")
+
+	// ErrGoogleHostedDomainInvalid is returned when a hosted_domains entry is not a bare domain name
+	ErrGoogleHostedDomainInvalid = errors.New("hosted domain must be a domain name (e.g., \"example.com\")")
+
+	// ErrGoogleDirectoryIncomplete is returned when only one of directory_credentials_file and directory_admin_email is set
+	ErrGoogleDirectoryIncomplete = errors.New("directory_credentials_file and directory_admin_email must be set together")
+
+	// ErrGoogleDirectoryRequired is returned when allowed_groups is set without the Directory API group lookup
+	ErrGoogleDirectoryRequired = errors.New("allowed_groups requires directory_credentials_file and directory_admin_email")
+
+	// ErrMicrosoftTenantInvalid is returned when an allowed_tenants entry is not a tenant ID
+	ErrMicrosoftTenantInvalid = errors.New("tenant must be a tenant ID (GUID, e.g., \"72f988bf-86f1-41af-91ab-2d7cd011db47\")")
+
+	// ErrOptionalScopeInvalid is returned when an optional scope is empty or not a single scope
+	ErrOptionalScopeInvalid = errors.New("optional scope must be a single scope without spaces")
+
+	// ErrOptionalScopeDuplicate is returned when an optional scope is listed twice or also in scopes
+	ErrOptionalScopeDuplicate = errors.New("optional scope is listed twice or also in scopes")
+
+	// ErrProviderIconInvalid is returned when a provider icon is neither SVG markup nor an image data URI
+	ErrProviderIconInvalid = errors.New("icon must be SVG markup (\"<svg ...>\") or a \"data:image/...\" URI")
+
+	// ErrProviderIDReserved is returned when a provider ID is one of the auth method IDs of the admin API
+	ErrProviderIDReserved = errors.New("provider id must not be \"email\" or \"password\" (reserved for the built-in auth methods)")
+
+	// ErrIssuerURLInvalid is returned when a custom provider's issuer_url is not an absolute http(s) URL
+	ErrIssuerURLInvalid = errors.New("issuer URL must be an absolute http(s) URL (e.g., \"https://idp.example.com\")")
+
+	// ErrDiscoveryRefreshInvalid is returned when discovery_refresh is not a positive duration
+	ErrDiscoveryRefreshInvalid = errors.New("discovery refresh must be a positive duration (e.g., \"1h\")")
+
+	// ErrClientAuthMethodInvalid is returned when client_auth_method is not a supported method
+	ErrClientAuthMethodInvalid = errors.New("client auth method must be \"client_secret\", \"private_key_jwt\" or \"tls_client_auth\"")
+
+	// ErrClientKeyRequired is returned when private_key_jwt or tls_client_auth has no private key
+	ErrClientKeyRequired = errors.New("client_key or client_key_file is required by this client auth method")
+
+	// ErrClientCertRequired is returned when tls_client_auth has no client certificate
+	ErrClientCertRequired = errors.New("client_cert or client_cert_file is required by tls_client_auth")
+
+	// ErrClientKeySourceConflict is returned when key material is set both inline and as a file
+	ErrClientKeySourceConflict = errors.New("set either the inline value or the *_file path, not both")
+
+	// ErrOutboundProxyURLInvalid is returned when outbound.proxy_url is not an absolute http, https or socks5 URL
+	ErrOutboundProxyURLInvalid = errors.New("proxy URL must be an http://, https:// or socks5:// URL with a host")
+
+	// ErrOutboundNoProxyInvalid is returned when an outbound.no_proxy entry is not a host, domain or CIDR
+	ErrOutboundNoProxyInvalid = errors.New("no_proxy entries must be host names, \".domain\" suffixes or CIDR ranges")
+
+	// ErrOutboundTimeoutInvalid is returned when outbound.timeout is not a positive duration
+	ErrOutboundTimeoutInvalid = errors.New("timeout must be a positive duration (e.g., \"30s\")")
+
+	// ErrExtraKeyInvalid is returned when a session.extra allow or deny entry is empty
+	ErrExtraKeyInvalid = errors.New("key must not be empty")
+
+	// ErrClaimNameInvalid is returned when a claims_mapping claim is not a lowercase identifier
+	ErrClaimNameInvalid = errors.New("claim must be a lowercase identifier (e.g., \"department\")")
+
+	// ErrClaimReserved is returned when claims_mapping targets a claim used for authorization
+	ErrClaimReserved = errors.New("claim is reserved for authorization and cannot be mapped")
+
+	// ErrClaimFromRequired is returned when a claims_mapping entry has no (or an empty) source path
+	ErrClaimFromRequired = errors.New("at least one non-empty source path is required")
+
+	// ErrClaimProviderUnknown is returned when a claims_mapping entry names an unconfigured provider
+	ErrClaimProviderUnknown = errors.New("unknown OAuth2 provider ID")
+
+	// ErrFaviconTypeInvalid is returned when service.favicon is not an .ico, .png or .svg file
+	ErrFaviconTypeInvalid = errors.New("favicon must be an .ico, .png or .svg file")
+
+	// ErrLogLevelInvalid is returned when a logging.module_level level is not debug, info, warn or error
+	ErrLogLevelInvalid = errors.New("log level must be debug, info, warn or error")
+
+	// ErrLogSamplingInvalid is returned when sample_every or per_second of logging.module_level is negative
+	ErrLogSamplingInvalid = errors.New("sample_every and per_second must not be negative")
+
+	// ErrLogScrubbingInvalid is returned when logging.scrubbing is not standard, strict or off
+	ErrLogScrubbingInvalid = errors.New("scrubbing must be standard, strict or off")
+
+	// ErrHealthCheckUnknown is returned when health.checks contains a probe other than kvs, upstream or smtp
+	ErrHealthCheckUnknown = errors.New("health check must be kvs, upstream or smtp")
+
+	// ErrHealthTimeoutInvalid is returned when health.timeout is not a positive duration
+	ErrHealthTimeoutInvalid = errors.New("health check timeout must be a positive duration (e.g., \"2s\")")
+
+	// ErrHealthCacheTTLInvalid is returned when health.cache_ttl is not a positive duration
+	ErrHealthCacheTTLInvalid = errors.New("health check cache TTL must be a positive duration (e.g., \"5s\")")
+
+	// ErrSessionCacheTTLInvalid is returned when kvs.session_cache.ttl is not a positive duration
+	ErrSessionCacheTTLInvalid = errors.New("session cache TTL must be a positive duration (e.g., \"5s\")")
+
+	// ErrIDPBaseURLRequired is returned when the IdP mode is enabled without server.base_url, which the issuer is derived from
+	ErrIDPBaseURLRequired = errors.New("server.base_url is required when idp is enabled")
+
+	// ErrIDPSigningKeyRequired is returned when the IdP mode is enabled without a signing key
+	ErrIDPSigningKeyRequired = errors.New("signing key is required when idp is enabled")
+
+	// ErrIDPTokenTTLInvalid is returned when idp.token_ttl is not a positive duration
+	ErrIDPTokenTTLInvalid = errors.New("token TTL must be a positive duration (e.g., \"1h\")")
+
+	// ErrIDPClientsRequired is returned when the IdP mode is enabled without clients
+	ErrIDPClientsRequired = errors.New("at least one client is required when idp is enabled")
+
+	// ErrIDPClientIDRequired is returned when an IdP client has no client_id
+	ErrIDPClientIDRequired = errors.New("client ID is required")
+
+	// ErrIDPClientIDDuplicate is returned when two IdP clients have the same client_id
+	ErrIDPClientIDDuplicate = errors.New("client ID must be unique")
+
+	// ErrIDPClientSecretRequired is returned when an IdP client has no client_secret
+	ErrIDPClientSecretRequired = errors.New("client secret is required")
+
+	// ErrIDPRedirectURIInvalid is returned when an IdP client has no redirect URI, or one that is not an absolute http(s) URL without fragment
+	ErrIDPRedirectURIInvalid = errors.New("redirect URIs must be absolute http(s) URLs without fragment")
+
+	// ErrProviderTokensSecretTooShort is returned when the provider token endpoint is enabled without a secret of at least 32 characters
+	ErrProviderTokensSecretTooShort = errors.New("provider token secret must be at least 32 characters")
+
+	// ErrProviderTokensRefreshBeforeInvalid is returned when provider_tokens.refresh_before is not a non-negative duration
+	ErrProviderTokensRefreshBeforeInvalid = errors.New("refresh before must be a non-negative duration (e.g., \"1m\")")
 )
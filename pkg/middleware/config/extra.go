@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExtraConfig controls which provider data (Extra) is persisted in sessions
+// Some providers return large profiles (e.g., full userinfo documents) that bloat KVS entries
+// and forwarding; keys are the top-level names of Extra (e.g., "avatar_url", "picture")
+type ExtraConfig struct {
+	Allow    []string `yaml:"allow" json:"allow"`         // Optional: Keys to keep (default: all keys)
+	Deny     []string `yaml:"deny" json:"deny"`           // Optional: Keys to drop (checked before allow)
+	MaxBytes int      `yaml:"max_bytes" json:"max_bytes"` // Optional: Maximum JSON size of Extra; the largest values are dropped first (default: unlimited)
+}
+
+// IsZero reports whether Extra is persisted as returned by the provider
+func (e ExtraConfig) IsZero() bool {
+	return len(e.Allow) == 0 && len(e.Deny) == 0 && e.MaxBytes == 0
+}
+
+// Prune returns the Extra data to persist and the sorted names of the dropped keys
+// Reserved keys (e.g., groups used by access control) are never dropped and count against max_bytes.
+// extra itself is not modified.
+func (e ExtraConfig) Prune(extra map[string]interface{}, reserved ...string) (map[string]interface{}, []string) {
+	if e.IsZero() || len(extra) == 0 {
+		return extra, nil
+	}
+
+	isReserved := make(map[string]bool, len(reserved))
+	for _, key := range reserved {
+		isReserved[key] = true
+	}
+
+	kept := make(map[string]interface{}, len(extra))
+	var dropped []string
+	for key, value := range extra {
+		if isReserved[key] || e.keeps(key) {
+			kept[key] = value
+		} else {
+			dropped = append(dropped, key)
+		}
+	}
+
+	if e.MaxBytes > 0 {
+		dropped = append(dropped, e.trim(kept, isReserved)...)
+	}
+
+	sort.Strings(dropped)
+	return kept, dropped
+}
+
+// keeps reports whether a key passes the deny and allow lists
+func (e ExtraConfig) keeps(key string) bool {
+	for _, denied := range e.Deny {
+		if key == denied {
+			return false
+		}
+	}
+	if len(e.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range e.Allow {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// trim drops the largest non-reserved values from kept until its JSON fits in max_bytes
+// Ties are broken by key name so that the result does not depend on map order
+func (e ExtraConfig) trim(kept map[string]interface{}, isReserved map[string]bool) []string {
+	size := jsonSize(kept)
+	if size <= e.MaxBytes {
+		return nil
+	}
+
+	type entry struct {
+		key  string
+		size int
+	}
+	var entries []entry
+	for key, value := range kept {
+		if !isReserved[key] {
+			entries = append(entries, entry{key, jsonSize(map[string]interface{}{key: value})})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	var dropped []string
+	for _, en := range entries {
+		if size <= e.MaxBytes {
+			break
+		}
+		delete(kept, en.key)
+		dropped = append(dropped, en.key)
+		size = jsonSize(kept)
+	}
+	return dropped
+}
+
+// jsonSize returns the size of a value encoded as JSON, as stored in the session
+func jsonSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// Validate checks the Extra persistence settings
+func (e ExtraConfig) Validate() error {
+	verr := NewValidationError()
+
+	for i, key := range e.Allow {
+		if strings.TrimSpace(key) == "" {
+			verr.Add(fmt.Errorf("session.extra.allow[%d]: %w", i, ErrExtraKeyInvalid))
+		}
+	}
+	for i, key := range e.Deny {
+		if strings.TrimSpace(key) == "" {
+			verr.Add(fmt.Errorf("session.extra.deny[%d]: %w", i, ErrExtraKeyInvalid))
+		}
+	}
+	if e.MaxBytes < 0 {
+		verr.Add(fmt.Errorf("session.extra.max_bytes: %w", ErrMetadataLimitInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
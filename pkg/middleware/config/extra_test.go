@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtraConfig_Prune(t *testing.T) {
+	extra := map[string]interface{}{
+		"_email":   "user@example.com",
+		"picture":  "https://example.com/p.jpg",
+		"raw":      strings.Repeat("x", 200),
+		"groups":   "staff,admins",
+		"location": "Tokyo",
+	}
+
+	tests := []struct {
+		name        string
+		cfg         ExtraConfig
+		wantKeys    []string
+		wantDropped []string
+	}{
+		{"no settings", ExtraConfig{}, []string{"_email", "groups", "location", "picture", "raw"}, nil},
+		{"deny", ExtraConfig{Deny: []string{"raw", "location"}}, []string{"_email", "groups", "picture"}, []string{"location", "raw"}},
+		{"allow keeps reserved", ExtraConfig{Allow: []string{"_email"}}, []string{"_email", "groups"}, []string{"location", "picture", "raw"}},
+		{"deny before allow", ExtraConfig{Allow: []string{"_email", "picture"}, Deny: []string{"picture"}}, []string{"_email", "groups"}, []string{"location", "picture", "raw"}},
+		{"size budget drops largest first", ExtraConfig{MaxBytes: 120}, []string{"_email", "groups", "location", "picture"}, []string{"raw"}},
+		{"reserved keys are not trimmed", ExtraConfig{MaxBytes: 10}, []string{"groups"}, []string{"_email", "location", "picture", "raw"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, dropped := tt.cfg.Prune(extra, "groups")
+
+			var keys []string
+			for _, key := range []string{"_email", "groups", "location", "picture", "raw"} {
+				if _, ok := kept[key]; ok {
+					keys = append(keys, key)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("Kept keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("Dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+
+	if len(extra) != 5 {
+		t.Error("Prune() modified its input")
+	}
+}
+
+func TestExtraConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   ExtraConfig
+		wantErr error
+	}{
+		{"empty", ExtraConfig{}, nil},
+		{"valid", ExtraConfig{Allow: []string{"picture"}, Deny: []string{"raw"}, MaxBytes: 4096}, nil},
+		{"empty allow key", ExtraConfig{Allow: []string{""}}, ErrExtraKeyInvalid},
+		{"empty deny key", ExtraConfig{Deny: []string{" "}}, ErrExtraKeyInvalid},
+		{"negative max bytes", ExtraConfig{MaxBytes: -1}, ErrMetadataLimitInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.extra.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
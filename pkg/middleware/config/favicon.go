@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// faviconTypes maps the file extensions accepted by ServiceConfig.Favicon to their content types
+var faviconTypes = map[string]string{
+	".ico": "image/x-icon",
+	".png": "image/png",
+	".svg": "image/svg+xml",
+}
+
+// FaviconType returns the content type of the configured favicon file ("" when none is configured)
+func (s ServiceConfig) FaviconType() string {
+	return faviconTypes[strings.ToLower(filepath.Ext(s.Favicon))]
+}
+
+// validateFavicon validates the file type of the favicon
+func (s ServiceConfig) validateFavicon() error {
+	if s.Favicon != "" && s.FaviconType() == "" {
+		return fmt.Errorf("service.favicon: %w", ErrFaviconTypeInvalid)
+	}
+	return nil
+}
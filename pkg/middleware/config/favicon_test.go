@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServiceConfig_Favicon(t *testing.T) {
+	tests := []struct {
+		name     string
+		favicon  string
+		wantType string
+		wantErr  error
+	}{
+		{"none", "", "", nil},
+		{"ico", "/etc/chatbotgate/favicon.ico", "image/x-icon", nil},
+		{"png", "brand/Icon.PNG", "image/png", nil},
+		{"svg", "icon.svg", "image/svg+xml", nil},
+		{"unsupported type", "icon.gif", "", ErrFaviconTypeInvalid},
+		{"no extension", "favicon", "", ErrFaviconTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := ServiceConfig{Favicon: tt.favicon}
+			if got := service.FaviconType(); got != tt.wantType {
+				t.Errorf("FaviconType() = %q, want %q", got, tt.wantType)
+			}
+			err := service.validateFavicon()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateFavicon() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateFavicon() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
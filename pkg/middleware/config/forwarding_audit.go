@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+// ForwardingAuditConfig records the identity forwarded to the upstream with each authenticated request,
+// one JSON line per request in an audit log file, for data-processing audits
+type ForwardingAuditConfig struct {
+	Enabled bool              `yaml:"enabled" json:"enabled"` // Optional: Write the audit log (default: false)
+	Privacy bool              `yaml:"privacy" json:"privacy"` // Optional: Record keyed hashes of the user and of the forwarded values instead of the values (default: false)
+	File    FileLoggingConfig `yaml:"file" json:"file"`       // Required when enabled: Audit log path, rotation and retention (max_age days, max_backups)
+}
+
+// Validate checks the audit log settings
+func (a ForwardingAuditConfig) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+
+	verr := NewValidationError()
+	if a.File.Path == "" {
+		verr.Add(fmt.Errorf("forwarding.audit.file.path: %w", ErrForwardingAuditPathRequired))
+	}
+	if a.File.MaxSizeMB < 0 || a.File.MaxBackups < 0 || a.File.MaxAge < 0 {
+		verr.Add(fmt.Errorf("forwarding.audit.file: %w", ErrForwardingAuditRetentionInvalid))
+	}
+	return verr.ErrorOrNil()
+}
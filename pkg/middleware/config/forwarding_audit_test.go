@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestForwardingAuditConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ForwardingAuditConfig
+		wantErr error
+	}{
+		{"disabled", ForwardingAuditConfig{}, nil},
+		{"valid", ForwardingAuditConfig{Enabled: true, Privacy: true, File: FileLoggingConfig{Path: "/var/log/chatbotgate/audit.log", MaxAge: 365}}, nil},
+		{"no path", ForwardingAuditConfig{Enabled: true}, ErrForwardingAuditPathRequired},
+		{"negative retention", ForwardingAuditConfig{Enabled: true, File: FileLoggingConfig{Path: "audit.log", MaxAge: -1}}, ErrForwardingAuditRetentionInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Defaults of the guest access mode
+const (
+	DefaultGuestSessionTTL          = time.Hour // Lifetime of a guest session
+	DefaultGuestRequestLimit        = 20        // Counted requests per guest session
+	DefaultGuestStartLimitPerMinute = 10        // Guest sessions started per client IP and minute
+)
+
+// GuestConfig contains the anonymous guest access settings
+// Visitors can try the chatbot from the login page without signing in: they get a
+// temporary session with provider "guest" and no email, and a small request quota
+// after which they are asked to sign in
+type GuestConfig struct {
+	Enabled        bool   `yaml:"enabled" json:"enabled"`                 // Show "Continue as guest" on the login page
+	SessionTTL     string `yaml:"session_ttl" json:"session_ttl"`         // Lifetime of guest sessions (default: "1h")
+	RequestLimit   int    `yaml:"request_limit" json:"request_limit"`     // Counted requests per guest session (default: 20)
+	LimitPath      string `yaml:"limit_path" json:"limit_path"`           // Optional: Only count requests under this path prefix (e.g., "/v1/chat-messages")
+	UpgradeMessage string `yaml:"upgrade_message" json:"upgrade_message"` // Optional: Sign-in prompt shown to guests (default: translated message)
+
+	StartLimitPerMinute int `yaml:"start_limit_per_minute" json:"start_limit_per_minute"` // Guest sessions a client IP can start per minute (default: 10)
+}
+
+// GetSessionTTL returns the lifetime of guest sessions
+// If not set or invalid, returns DefaultGuestSessionTTL
+func (g GuestConfig) GetSessionTTL() time.Duration {
+	ttl, err := time.ParseDuration(g.SessionTTL)
+	if err != nil || ttl <= 0 {
+		return DefaultGuestSessionTTL
+	}
+	return ttl
+}
+
+// GetRequestLimit returns the number of counted requests allowed per guest session
+// If not set, returns DefaultGuestRequestLimit
+func (g GuestConfig) GetRequestLimit() int {
+	if g.RequestLimit <= 0 {
+		return DefaultGuestRequestLimit
+	}
+	return g.RequestLimit
+}
+
+// GetStartLimitPerMinute returns the number of guest sessions a client IP can start per minute
+// If not set, returns DefaultGuestStartLimitPerMinute
+func (g GuestConfig) GetStartLimitPerMinute() int {
+	if g.StartLimitPerMinute <= 0 {
+		return DefaultGuestStartLimitPerMinute
+	}
+	return g.StartLimitPerMinute
+}
+
+// CountsRequest reports whether a request counts against the guest quota
+// Page loads and preflights (GET, HEAD, OPTIONS) are free; other methods under LimitPath are counted
+func (g GuestConfig) CountsRequest(method, path string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+	prefix := strings.TrimSuffix(g.LimitPath, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Validate checks the guest access settings
+func (g GuestConfig) Validate() error {
+	verr := NewValidationError()
+
+	if !g.Enabled {
+		return nil
+	}
+
+	if g.SessionTTL != "" {
+		if ttl, err := time.ParseDuration(g.SessionTTL); err != nil || ttl <= 0 {
+			verr.Add(fmt.Errorf("guest.session_ttl: %w", ErrGuestSessionTTLInvalid))
+		}
+	}
+
+	if g.RequestLimit < 0 {
+		verr.Add(fmt.Errorf("guest.request_limit: %w", ErrGuestRequestLimitInvalid))
+	}
+
+	if g.StartLimitPerMinute < 0 {
+		verr.Add(fmt.Errorf("guest.start_limit_per_minute: %w", ErrGuestStartLimitInvalid))
+	}
+
+	if g.LimitPath != "" && !strings.HasPrefix(g.LimitPath, "/") {
+		verr.Add(fmt.Errorf("guest.limit_path: %w", ErrGuestLimitPathInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
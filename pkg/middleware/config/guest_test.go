@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGuestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		guest   GuestConfig
+		wantErr error
+	}{
+		{"disabled", GuestConfig{SessionTTL: "invalid"}, nil},
+		{"defaults", GuestConfig{Enabled: true}, nil},
+		{"valid", GuestConfig{Enabled: true, SessionTTL: "30m", RequestLimit: 5, LimitPath: "/v1/chat-messages"}, nil},
+		{"invalid session ttl", GuestConfig{Enabled: true, SessionTTL: "soon"}, ErrGuestSessionTTLInvalid},
+		{"negative session ttl", GuestConfig{Enabled: true, SessionTTL: "-1h"}, ErrGuestSessionTTLInvalid},
+		{"negative request limit", GuestConfig{Enabled: true, RequestLimit: -1}, ErrGuestRequestLimitInvalid},
+		{"negative start limit", GuestConfig{Enabled: true, StartLimitPerMinute: -1}, ErrGuestStartLimitInvalid},
+		{"relative limit path", GuestConfig{Enabled: true, LimitPath: "v1"}, ErrGuestLimitPathInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.guest.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGuestConfig_Defaults(t *testing.T) {
+	var g GuestConfig
+	if got := g.GetSessionTTL(); got != DefaultGuestSessionTTL {
+		t.Errorf("GetSessionTTL() = %v, want %v", got, DefaultGuestSessionTTL)
+	}
+	if got := g.GetRequestLimit(); got != DefaultGuestRequestLimit {
+		t.Errorf("GetRequestLimit() = %d, want %d", got, DefaultGuestRequestLimit)
+	}
+
+	g = GuestConfig{SessionTTL: "15m", RequestLimit: 3}
+	if got := g.GetSessionTTL(); got != 15*time.Minute {
+		t.Errorf("GetSessionTTL() = %v, want 15m", got)
+	}
+	if got := g.GetRequestLimit(); got != 3 {
+		t.Errorf("GetRequestLimit() = %d, want 3", got)
+	}
+}
+
+func TestGuestConfig_CountsRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		limitPath string
+		method    string
+		path      string
+		want      bool
+	}{
+		{"post counts", "", "POST", "/api/chat", true},
+		{"get is free", "", "GET", "/api/chat", false},
+		{"preflight is free", "", "OPTIONS", "/api/chat", false},
+		{"under limit path", "/v1/chat-messages", "POST", "/v1/chat-messages", true},
+		{"outside limit path", "/v1/chat-messages", "POST", "/v1/files/upload", false},
+		{"limit path is a path prefix", "/v1/chat", "POST", "/v1/chat-messages", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GuestConfig{Enabled: true, LimitPath: tt.limitPath}
+			if got := g.CountsRequest(tt.method, tt.path); got != tt.want {
+				t.Errorf("CountsRequest(%s, %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
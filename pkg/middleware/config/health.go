@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHealthCheckTimeout is the timeout of each dependency probe of the readiness check
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// DefaultHealthCheckCacheTTL is how long the results of the dependency probes are reused by readiness requests
+const DefaultHealthCheckCacheTTL = 5 * time.Second
+
+// Dependency probes of the readiness check (health.checks)
+const (
+	HealthCheckKVS      = "kvs"      // Round trip to the session KVS
+	HealthCheckUpstream = "upstream" // HEAD request to the upstream of the proxy
+	HealthCheckSMTP     = "smtp"     // Connection to the SMTP server (sender_type: smtp only)
+)
+
+// HealthConfig contains the dependency probes of the readiness check (/_auth/health)
+// The liveness check (/_auth/health?probe=live) never probes dependencies.
+type HealthConfig struct {
+	Checks   []string `yaml:"checks" json:"checks"`       // Optional: Dependencies probed by the readiness check ("kvs", "upstream", "smtp"; default: none)
+	Timeout  string   `yaml:"timeout" json:"timeout"`     // Optional: Timeout of each probe (default: "2s")
+	CacheTTL string   `yaml:"cache_ttl" json:"cache_ttl"` // Optional: How long probe results are reused (default: "5s")
+}
+
+// Enabled reports whether the dependency probe name is enabled
+func (h HealthConfig) Enabled(name string) bool {
+	for _, check := range h.Checks {
+		if check == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTimeout returns the timeout of each dependency probe
+// If not set or invalid, returns DefaultHealthCheckTimeout
+func (h HealthConfig) GetTimeout() time.Duration {
+	timeout, err := time.ParseDuration(h.Timeout)
+	if err != nil || timeout <= 0 {
+		return DefaultHealthCheckTimeout
+	}
+	return timeout
+}
+
+// GetCacheTTL returns how long the results of the dependency probes are reused
+// If not set or invalid, returns DefaultHealthCheckCacheTTL
+func (h HealthConfig) GetCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(h.CacheTTL)
+	if err != nil || ttl <= 0 {
+		return DefaultHealthCheckCacheTTL
+	}
+	return ttl
+}
+
+// Validate checks the dependency probe settings
+func (h HealthConfig) Validate() error {
+	verr := NewValidationError()
+
+	for i, check := range h.Checks {
+		switch check {
+		case HealthCheckKVS, HealthCheckUpstream, HealthCheckSMTP:
+		default:
+			verr.Add(fmt.Errorf("health.checks[%d]: %w", i, ErrHealthCheckUnknown))
+		}
+	}
+
+	if h.Timeout != "" {
+		if timeout, err := time.ParseDuration(h.Timeout); err != nil || timeout <= 0 {
+			verr.Add(fmt.Errorf("health.timeout: %w", ErrHealthTimeoutInvalid))
+		}
+	}
+
+	if h.CacheTTL != "" {
+		if ttl, err := time.ParseDuration(h.CacheTTL); err != nil || ttl <= 0 {
+			verr.Add(fmt.Errorf("health.cache_ttl: %w", ErrHealthCacheTTLInvalid))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		health  HealthConfig
+		wantErr error
+	}{
+		{"empty", HealthConfig{}, nil},
+		{"all checks", HealthConfig{Checks: []string{"kvs", "upstream", "smtp"}, Timeout: "500ms"}, nil},
+		{"unknown check", HealthConfig{Checks: []string{"kvs", "database"}}, ErrHealthCheckUnknown},
+		{"invalid timeout", HealthConfig{Timeout: "soon"}, ErrHealthTimeoutInvalid},
+		{"zero timeout", HealthConfig{Timeout: "0s"}, ErrHealthTimeoutInvalid},
+		{"invalid cache TTL", HealthConfig{CacheTTL: "-5s"}, ErrHealthCacheTTLInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.health.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthConfig_Defaults(t *testing.T) {
+	health := HealthConfig{}
+	if health.Enabled(HealthCheckKVS) {
+		t.Error("no probe should be enabled by default")
+	}
+	if got := health.GetTimeout(); got != DefaultHealthCheckTimeout {
+		t.Errorf("GetTimeout() = %v, want %v", got, DefaultHealthCheckTimeout)
+	}
+	if got := health.GetCacheTTL(); got != DefaultHealthCheckCacheTTL {
+		t.Errorf("GetCacheTTL() = %v, want %v", got, DefaultHealthCheckCacheTTL)
+	}
+
+	health = HealthConfig{Checks: []string{"upstream"}, Timeout: "750ms"}
+	if !health.Enabled(HealthCheckUpstream) || health.Enabled(HealthCheckSMTP) {
+		t.Errorf("Enabled() does not follow checks %v", health.Checks)
+	}
+	if got := health.GetTimeout(); got != 750*time.Millisecond {
+		t.Errorf("GetTimeout() = %v, want 750ms", got)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultIDPTokenTTL is the lifetime of the ID and access tokens issued in IdP mode
+const DefaultIDPTokenTTL = time.Hour
+
+// IDPConfig contains the OpenID Connect provider settings ("IdP mode")
+// Users signed in to ChatbotGate, by any of its methods, can sign in to the registered downstream
+// apps with the authorization code flow. The issuer is {base_url}{auth_path_prefix}/idp, with the
+// discovery document at {issuer}/.well-known/openid-configuration.
+type IDPConfig struct {
+	Enabled        bool        `yaml:"enabled" json:"enabled"`                       // Issue ID tokens to the registered clients
+	SigningKey     string      `yaml:"signing_key" json:"signing_key" secret:"true"` // PEM private key signing ID tokens: RSA, ECDSA P-256 or Ed25519 (or signing_key_file)
+	SigningKeyFile string      `yaml:"signing_key_file" json:"signing_key_file"`     // Path of the PEM private key (alternative to signing_key)
+	SigningKeyID   string      `yaml:"signing_key_id" json:"signing_key_id"`         // Optional: "kid" of the key in the JWKS (default: derived from the public key)
+	TokenTTL       string      `yaml:"token_ttl" json:"token_ttl"`                   // Lifetime of ID and access tokens (default: "1h")
+	Clients        []IDPClient `yaml:"clients" json:"clients"`                       // Downstream apps allowed to sign users in
+}
+
+// IDPClient is a downstream app registered with the IdP mode
+type IDPClient struct {
+	ClientID     string   `yaml:"client_id" json:"client_id"`                       // Client ID the app is configured with
+	ClientSecret string   `yaml:"client_secret" json:"client_secret" secret:"true"` // Secret authenticating the app at the token endpoint (client_secret_basic or client_secret_post)
+	RedirectURIs []string `yaml:"redirect_uris" json:"redirect_uris"`               // Exact redirect URIs of the app (e.g., "https://wiki.example.com/oauth/callback")
+}
+
+// GetIssuer returns the issuer URL of the IdP mode: {base_url}{mount_path}{auth_path_prefix}/idp
+func (c IDPConfig) GetIssuer(server ServerConfig) string {
+	return server.BaseURL + server.GetPublicAuthPathPrefix() + "/idp"
+}
+
+// GetTokenTTL returns the lifetime of the issued tokens
+// If not set or invalid, returns DefaultIDPTokenTTL
+func (c IDPConfig) GetTokenTTL() time.Duration {
+	ttl, err := time.ParseDuration(c.TokenTTL)
+	if err != nil || ttl <= 0 {
+		return DefaultIDPTokenTTL
+	}
+	return ttl
+}
+
+// Validate checks the IdP mode settings
+// The issuer is derived from server.base_url, which must be set.
+func (c IDPConfig) Validate(server ServerConfig) error {
+	verr := NewValidationError()
+
+	if !c.Enabled {
+		return nil
+	}
+
+	if server.BaseURL == "" {
+		verr.Add(fmt.Errorf("idp: %w", ErrIDPBaseURLRequired))
+	}
+	if c.SigningKey == "" && c.SigningKeyFile == "" {
+		verr.Add(fmt.Errorf("idp.signing_key: %w", ErrIDPSigningKeyRequired))
+	} else if c.SigningKey != "" && c.SigningKeyFile != "" {
+		verr.Add(fmt.Errorf("idp.signing_key_file: %w", ErrClientKeySourceConflict))
+	}
+	if c.TokenTTL != "" {
+		if ttl, err := time.ParseDuration(c.TokenTTL); err != nil || ttl <= 0 {
+			verr.Add(fmt.Errorf("idp.token_ttl: %w", ErrIDPTokenTTLInvalid))
+		}
+	}
+
+	if len(c.Clients) == 0 {
+		verr.Add(fmt.Errorf("idp.clients: %w", ErrIDPClientsRequired))
+	}
+	seen := make(map[string]bool)
+	for i, client := range c.Clients {
+		if client.ClientID == "" {
+			verr.Add(fmt.Errorf("idp.clients[%d].client_id: %w", i, ErrIDPClientIDRequired))
+		} else if seen[client.ClientID] {
+			verr.Add(fmt.Errorf("idp.clients[%d].client_id: %w", i, ErrIDPClientIDDuplicate))
+		}
+		seen[client.ClientID] = true
+
+		if client.ClientSecret == "" {
+			verr.Add(fmt.Errorf("idp.clients[%d].client_secret: %w", i, ErrIDPClientSecretRequired))
+		}
+		if len(client.RedirectURIs) == 0 {
+			verr.Add(fmt.Errorf("idp.clients[%d].redirect_uris: %w", i, ErrIDPRedirectURIInvalid))
+		}
+		for j, uri := range client.RedirectURIs {
+			if u, err := url.Parse(uri); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+				verr.Add(fmt.Errorf("idp.clients[%d].redirect_uris[%d]: %w", i, j, ErrIDPRedirectURIInvalid))
+			}
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// ModuleLevelConfig is logging.module_level: a level for all sub-modules ("debug"),
+// or settings per module path, each applying to the sub-modules of the path too:
+//
+//	module_level:
+//	  main/middleware: debug
+//	  main/proxy:
+//	    level: debug
+//	    sample_every: 100
+//	    per_second: 20
+type ModuleLevelConfig struct {
+	Level   string                         // Level of all sub-modules (string form)
+	Modules map[string]ModuleLoggingConfig // Settings per module path (map form)
+}
+
+// ModuleLoggingConfig contains the logging settings of a module and its sub-modules
+// Sampling only drops debug and info messages; warnings and errors are always logged.
+type ModuleLoggingConfig struct {
+	Level       string `yaml:"level,omitempty" json:"level,omitempty"`               // Log level (default: the level of the parent module)
+	SampleEvery int    `yaml:"sample_every,omitempty" json:"sample_every,omitempty"` // Log 1 of every N messages with the same text (default: all)
+	PerSecond   int    `yaml:"per_second,omitempty" json:"per_second,omitempty"`     // Log at most N messages per second (default: no cap)
+}
+
+// UnmarshalYAML implements custom YAML unmarshaling to support both string and map formats
+func (m *ModuleLevelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var level string
+	if err := unmarshal(&level); err == nil {
+		*m = ModuleLevelConfig{Level: level}
+		return nil
+	}
+	var modules map[string]ModuleLoggingConfig
+	if err := unmarshal(&modules); err != nil {
+		return err
+	}
+	*m = ModuleLevelConfig{Modules: modules}
+	return nil
+}
+
+// UnmarshalYAML implements custom YAML unmarshaling to support a bare level ("main/proxy: debug")
+func (m *ModuleLoggingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var level string
+	if err := unmarshal(&level); err == nil {
+		*m = ModuleLoggingConfig{Level: level}
+		return nil
+	}
+	type plain ModuleLoggingConfig
+	return unmarshal((*plain)(m))
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling to support both string and map formats
+func (m *ModuleLevelConfig) UnmarshalJSON(data []byte) error {
+	var level string
+	if err := json.Unmarshal(data, &level); err == nil {
+		*m = ModuleLevelConfig{Level: level}
+		return nil
+	}
+	var modules map[string]ModuleLoggingConfig
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return err
+	}
+	*m = ModuleLevelConfig{Modules: modules}
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling to support a bare level ("main/proxy": "debug")
+func (m *ModuleLoggingConfig) UnmarshalJSON(data []byte) error {
+	var level string
+	if err := json.Unmarshal(data, &level); err == nil {
+		*m = ModuleLoggingConfig{Level: level}
+		return nil
+	}
+	type plain ModuleLoggingConfig
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// LogPolicy returns the per-module levels and sampling of the logging settings
+// Sub-modules log at the main level unless module_level says otherwise.
+func (l LoggingConfig) LogPolicy() logging.Policy {
+	policy := logging.Policy{
+		Level:       logging.ParseLevel(l.Level),
+		ModuleLevel: logging.ParseLevel(l.Level),
+	}
+	if l.ModuleLevel.Level != "" {
+		policy.ModuleLevel = logging.ParseLevel(l.ModuleLevel.Level)
+	}
+	if len(l.ModuleLevel.Modules) > 0 {
+		policy.Modules = make(map[string]logging.ModuleRule, len(l.ModuleLevel.Modules))
+		for path, module := range l.ModuleLevel.Modules {
+			policy.Modules[path] = logging.ModuleRule{
+				Level:    module.Level,
+				Sampling: logging.Sampling{Every: module.SampleEvery, PerSecond: module.PerSecond},
+			}
+		}
+	}
+	return policy
+}
+
+// HasModulePolicy reports whether module_level changes the level or sampling of any module
+func (l LoggingConfig) HasModulePolicy() bool {
+	return l.ModuleLevel.Level != "" || len(l.ModuleLevel.Modules) > 0
+}
+
+// Values of LoggingConfig.Scrubbing
+const (
+	ScrubbingStandard = "standard"
+	ScrubbingStrict   = "strict"
+	ScrubbingOff      = "off"
+)
+
+// LogScrubber returns the scrubber of the logging settings, and false when scrubbing is off
+func (l LoggingConfig) LogScrubber() (logging.Scrubber, bool) {
+	switch l.Scrubbing {
+	case ScrubbingOff:
+		return logging.Scrubber{}, false
+	case ScrubbingStrict:
+		return logging.Scrubber{Strict: true}, true
+	default:
+		return logging.Scrubber{}, true
+	}
+}
+
+// validateScrubbing validates logging.scrubbing
+func (l LoggingConfig) validateScrubbing() error {
+	switch l.Scrubbing {
+	case "", ScrubbingStandard, ScrubbingStrict, ScrubbingOff:
+		return nil
+	default:
+		return fmt.Errorf("logging.scrubbing: %w", ErrLogScrubbingInvalid)
+	}
+}
+
+// validLogLevels are the accepted values of logging levels
+var validLogLevels = map[string]bool{"debug": true, "info": true, "warn": true, "warning": true, "error": true}
+
+// validateModuleLevel validates the levels and sampling of logging.module_level
+func (l LoggingConfig) validateModuleLevel() error {
+	verr := NewValidationError()
+	if l.ModuleLevel.Level != "" && !validLogLevels[strings.ToLower(l.ModuleLevel.Level)] {
+		verr.Add(fmt.Errorf("logging.module_level: %w", ErrLogLevelInvalid))
+	}
+	for path, module := range l.ModuleLevel.Modules {
+		if module.Level != "" && !validLogLevels[strings.ToLower(module.Level)] {
+			verr.Add(fmt.Errorf("logging.module_level.%s.level: %w", path, ErrLogLevelInvalid))
+		}
+		if module.SampleEvery < 0 || module.PerSecond < 0 {
+			verr.Add(fmt.Errorf("logging.module_level.%s: %w", path, ErrLogSamplingInvalid))
+		}
+	}
+	return verr.ErrorOrNil()
+}
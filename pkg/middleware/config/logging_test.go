@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+	"gopkg.in/yaml.v3"
+)
+
+func TestModuleLevelConfig_UnmarshalYAML(t *testing.T) {
+	var cfg LoggingConfig
+	if err := yaml.Unmarshal([]byte(`level: info
+module_level: debug
+`), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.ModuleLevel.Level != "debug" || cfg.ModuleLevel.Modules != nil {
+		t.Errorf("string form: ModuleLevel = %+v", cfg.ModuleLevel)
+	}
+
+	cfg = LoggingConfig{}
+	if err := yaml.Unmarshal([]byte(`level: info
+module_level:
+  main/middleware: debug
+  main/proxy:
+    sample_every: 100
+    per_second: 20
+`), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := map[string]ModuleLoggingConfig{
+		"main/middleware": {Level: "debug"},
+		"main/proxy":      {SampleEvery: 100, PerSecond: 20},
+	}
+	if len(cfg.ModuleLevel.Modules) != len(want) {
+		t.Fatalf("map form: Modules = %+v", cfg.ModuleLevel.Modules)
+	}
+	for path, module := range want {
+		if cfg.ModuleLevel.Modules[path] != module {
+			t.Errorf("Modules[%q] = %+v, want %+v", path, cfg.ModuleLevel.Modules[path], module)
+		}
+	}
+}
+
+func TestModuleLevelConfig_UnmarshalJSON(t *testing.T) {
+	var cfg LoggingConfig
+	if err := json.Unmarshal([]byte(`{"module_level": {"main/proxy": "warn", "main/middleware": {"per_second": 5}}}`), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.ModuleLevel.Modules["main/proxy"].Level != "warn" || cfg.ModuleLevel.Modules["main/middleware"].PerSecond != 5 {
+		t.Errorf("Modules = %+v", cfg.ModuleLevel.Modules)
+	}
+
+	cfg = LoggingConfig{}
+	if err := json.Unmarshal([]byte(`{"module_level": "debug"}`), &cfg); err != nil || cfg.ModuleLevel.Level != "debug" {
+		t.Errorf("string form: ModuleLevel = %+v, error = %v", cfg.ModuleLevel, err)
+	}
+}
+
+func TestLoggingConfig_LogPolicy(t *testing.T) {
+	cfg := LoggingConfig{Level: "warn"}
+	if cfg.HasModulePolicy() {
+		t.Error("HasModulePolicy() = true without module_level")
+	}
+	if policy := cfg.LogPolicy(); policy.Level != logging.LevelWarn || policy.ModuleLevel != logging.LevelWarn {
+		t.Errorf("sub-modules should log at the main level, got %+v", policy)
+	}
+
+	cfg.ModuleLevel = ModuleLevelConfig{Modules: map[string]ModuleLoggingConfig{
+		"main/proxy": {Level: "debug", SampleEvery: 10, PerSecond: 50},
+	}}
+	policy := cfg.LogPolicy()
+	want := logging.ModuleRule{Level: "debug", Sampling: logging.Sampling{Every: 10, PerSecond: 50}}
+	if !cfg.HasModulePolicy() || policy.Modules["main/proxy"] != want {
+		t.Errorf("Modules = %+v, want main/proxy: %+v", policy.Modules, want)
+	}
+}
+
+func TestLoggingConfig_ValidateModuleLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  ModuleLevelConfig
+		wantErr error
+	}{
+		{"none", ModuleLevelConfig{}, nil},
+		{"string form", ModuleLevelConfig{Level: "DEBUG"}, nil},
+		{"invalid string form", ModuleLevelConfig{Level: "verbose"}, ErrLogLevelInvalid},
+		{"map form", ModuleLevelConfig{Modules: map[string]ModuleLoggingConfig{"main/proxy": {Level: "warn", PerSecond: 10}}}, nil},
+		{"invalid level", ModuleLevelConfig{Modules: map[string]ModuleLoggingConfig{"main/proxy": {Level: "trace"}}}, ErrLogLevelInvalid},
+		{"negative sampling", ModuleLevelConfig{Modules: map[string]ModuleLoggingConfig{"main/proxy": {SampleEvery: -1}}}, ErrLogSamplingInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LoggingConfig{ModuleLevel: tt.module}.validateModuleLevel()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateModuleLevel() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateModuleLevel() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoggingConfig_Scrubbing(t *testing.T) {
+	tests := []struct {
+		scrubbing  string
+		wantOn     bool
+		wantStrict bool
+		wantErr    error
+	}{
+		{"", true, false, nil},
+		{"standard", true, false, nil},
+		{"strict", true, true, nil},
+		{"off", false, false, nil},
+		{"paranoid", true, false, ErrLogScrubbingInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scrubbing, func(t *testing.T) {
+			cfg := LoggingConfig{Scrubbing: tt.scrubbing}
+			scrubber, on := cfg.LogScrubber()
+			if on != tt.wantOn || scrubber.Strict != tt.wantStrict {
+				t.Errorf("LogScrubber() = %+v, %v, want strict %v, %v", scrubber, on, tt.wantStrict, tt.wantOn)
+			}
+			if err := cfg.validateScrubbing(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateScrubbing() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Provider button styles of login page variants (button classes of the stylesheet)
+const (
+	ButtonStyleSecondary = "secondary" // Default: outlined buttons
+	ButtonStylePrimary   = "primary"   // Filled buttons in the primary color
+	ButtonStyleGhost     = "ghost"     // Borderless buttons
+)
+
+// experimentNamePattern restricts experiment and variant names to what can appear in the bucketing cookie
+var experimentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoginExperimentConfig is an A/B test of login page variants
+// Visitors are assigned a variant by percentage and keep it through a bucketing cookie;
+// the login page views and the logins of each variant are recorded with the login stats.
+type LoginExperimentConfig struct {
+	Name     string               `yaml:"name" json:"name"`         // Required with variants: Experiment name in the stats and the cookie (renaming reassigns all visitors)
+	Variants []LoginVariantConfig `yaml:"variants" json:"variants"` // Variants and their share of visitors (percentages adding up to 100); no variants disables the experiment
+}
+
+// LoginVariantConfig is one variant of the login page; settings left empty keep the regular page
+type LoginVariantConfig struct {
+	Name          string   `yaml:"name" json:"name"`                     // Required: Variant name in the stats and the cookie (e.g., "control", "social-first")
+	Percent       int      `yaml:"percent" json:"percent"`               // Required: Share of visitors assigned to the variant (1-100)
+	Title         string   `yaml:"title" json:"title"`                   // Optional: Page title replacing the translated "Sign in"
+	Description   string   `yaml:"description" json:"description"`       // Optional: Text replacing service.description
+	ProviderOrder []string `yaml:"provider_order" json:"provider_order"` // Optional: Provider IDs listed first, in this order (the others follow in their regular order)
+	ButtonStyle   string   `yaml:"button_style" json:"button_style"`     // Optional: Style of the provider buttons: "secondary" (default), "primary" or "ghost"
+}
+
+// Enabled reports whether the experiment has variants
+func (e LoginExperimentConfig) Enabled() bool {
+	return len(e.Variants) > 0
+}
+
+// GetButtonStyle returns the provider button style of the variant
+func (v LoginVariantConfig) GetButtonStyle() string {
+	if v.ButtonStyle == "" {
+		return ButtonStyleSecondary
+	}
+	return v.ButtonStyle
+}
+
+// Validate checks the experiment against the configured providers
+func (e LoginExperimentConfig) Validate(providers []OAuth2Provider) error {
+	if !e.Enabled() {
+		return nil
+	}
+	verr := NewValidationError()
+
+	if !experimentNamePattern.MatchString(e.Name) {
+		verr.Add(fmt.Errorf("login_experiment.name: %w", ErrExperimentNameInvalid))
+	}
+
+	providerIDs := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		providerIDs[p.ID] = true
+	}
+
+	names := make(map[string]bool)
+	total := 0
+	for i, v := range e.Variants {
+		field := fmt.Sprintf("login_experiment.variants[%d]", i)
+		switch {
+		case !experimentNamePattern.MatchString(v.Name):
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrExperimentNameInvalid))
+		case names[v.Name]:
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrExperimentVariantDuplicate))
+		}
+		names[v.Name] = true
+
+		if v.Percent < 1 || v.Percent > 100 {
+			verr.Add(fmt.Errorf("%s.percent: %w", field, ErrExperimentPercentInvalid))
+		}
+		total += v.Percent
+
+		for j, id := range v.ProviderOrder {
+			if !providerIDs[id] {
+				verr.Add(fmt.Errorf("%s.provider_order[%d]: %w: %s", field, j, ErrExperimentProviderUnknown, id))
+			}
+		}
+
+		switch v.GetButtonStyle() {
+		case ButtonStyleSecondary, ButtonStylePrimary, ButtonStyleGhost:
+		default:
+			verr.Add(fmt.Errorf("%s.button_style: %w", field, ErrExperimentButtonStyleInvalid))
+		}
+	}
+	if total != 100 {
+		verr.Add(fmt.Errorf("login_experiment.variants: %w (got %d)", ErrExperimentPercentTotal, total))
+	}
+
+	return verr.ErrorOrNil()
+}
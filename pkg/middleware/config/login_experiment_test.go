@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoginExperimentConfig_Validate(t *testing.T) {
+	providers := []OAuth2Provider{{ID: "google"}, {ID: "github"}}
+	valid := func() LoginExperimentConfig {
+		return LoginExperimentConfig{
+			Name: "signin-copy",
+			Variants: []LoginVariantConfig{
+				{Name: "control", Percent: 50},
+				{Name: "github-first", Percent: 50, ProviderOrder: []string{"github"}, ButtonStyle: ButtonStylePrimary},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*LoginExperimentConfig)
+		wantErr error
+	}{
+		{"valid experiment", func(e *LoginExperimentConfig) {}, nil},
+		{"no variants", func(e *LoginExperimentConfig) { e.Name, e.Variants = "", nil }, nil},
+		{"missing name", func(e *LoginExperimentConfig) { e.Name = "" }, ErrExperimentNameInvalid},
+		{"invalid variant name", func(e *LoginExperimentConfig) { e.Variants[0].Name = "Control:A" }, ErrExperimentNameInvalid},
+		{"duplicate variant", func(e *LoginExperimentConfig) { e.Variants[1].Name = "control" }, ErrExperimentVariantDuplicate},
+		{"zero percent", func(e *LoginExperimentConfig) { e.Variants[0].Percent, e.Variants[1].Percent = 0, 100 }, ErrExperimentPercentInvalid},
+		{"percents not adding up", func(e *LoginExperimentConfig) { e.Variants[0].Percent = 40 }, ErrExperimentPercentTotal},
+		{"unknown provider", func(e *LoginExperimentConfig) { e.Variants[1].ProviderOrder = []string{"gitlab"} }, ErrExperimentProviderUnknown},
+		{"invalid button style", func(e *LoginExperimentConfig) { e.Variants[1].ButtonStyle = "round" }, ErrExperimentButtonStyleInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			experiment := valid()
+			tt.modify(&experiment)
+			err := experiment.Validate(providers)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import "fmt"
+
+// Default limits of the session metadata API
+const (
+	DefaultMetadataMaxKeys      = 32   // Maximum number of keys per session
+	DefaultMetadataMaxValueSize = 4096 // Maximum size of a value in bytes
+)
+
+// MetadataConfig contains the session metadata API settings
+// Upstream apps read and write small per-user key-value data (e.g., selected assistant)
+// at {auth_path_prefix}/api/metadata; the data is stored in the session and expires with it
+type MetadataConfig struct {
+	Enabled      bool `yaml:"enabled" json:"enabled"`               // Enable the metadata API
+	MaxKeys      int  `yaml:"max_keys" json:"max_keys"`             // Maximum number of keys per session (default: 32)
+	MaxValueSize int  `yaml:"max_value_size" json:"max_value_size"` // Maximum size of a value in bytes (default: 4096)
+}
+
+// GetMaxKeys returns the maximum number of keys per session
+// If not set, returns DefaultMetadataMaxKeys
+func (m MetadataConfig) GetMaxKeys() int {
+	if m.MaxKeys <= 0 {
+		return DefaultMetadataMaxKeys
+	}
+	return m.MaxKeys
+}
+
+// GetMaxValueSize returns the maximum size of a value in bytes
+// If not set, returns DefaultMetadataMaxValueSize
+func (m MetadataConfig) GetMaxValueSize() int {
+	if m.MaxValueSize <= 0 {
+		return DefaultMetadataMaxValueSize
+	}
+	return m.MaxValueSize
+}
+
+// Validate checks the session metadata API settings
+func (m MetadataConfig) Validate() error {
+	verr := NewValidationError()
+
+	if m.MaxKeys < 0 {
+		verr.Add(fmt.Errorf("session.metadata.max_keys: %w", ErrMetadataLimitInvalid))
+	}
+	if m.MaxValueSize < 0 {
+		verr.Add(fmt.Errorf("session.metadata.max_value_size: %w", ErrMetadataLimitInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
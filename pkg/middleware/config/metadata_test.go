@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMetadataConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata MetadataConfig
+		wantErr  error
+	}{
+		{"defaults", MetadataConfig{Enabled: true}, nil},
+		{"custom limits", MetadataConfig{Enabled: true, MaxKeys: 8, MaxValueSize: 256}, nil},
+		{"negative max keys", MetadataConfig{MaxKeys: -1}, ErrMetadataLimitInvalid},
+		{"negative max value size", MetadataConfig{MaxValueSize: -1}, ErrMetadataLimitInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetadataConfig_Defaults(t *testing.T) {
+	var m MetadataConfig
+	if got := m.GetMaxKeys(); got != DefaultMetadataMaxKeys {
+		t.Errorf("GetMaxKeys() = %d, want %d", got, DefaultMetadataMaxKeys)
+	}
+	if got := m.GetMaxValueSize(); got != DefaultMetadataMaxValueSize {
+		t.Errorf("GetMaxValueSize() = %d, want %d", got, DefaultMetadataMaxValueSize)
+	}
+
+	m = MetadataConfig{MaxKeys: 4, MaxValueSize: 100}
+	if got := m.GetMaxKeys(); got != 4 {
+		t.Errorf("GetMaxKeys() = %d, want 4", got)
+	}
+	if got := m.GetMaxValueSize(); got != 100 {
+		t.Errorf("GetMaxValueSize() = %d, want 100", got)
+	}
+}
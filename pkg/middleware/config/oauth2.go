@@ -0,0 +1,222 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Token endpoint client authentication methods (OAuth2Provider.ClientAuthMethod)
+const (
+	ClientAuthSecret        = "client_secret"   // Client secret (default)
+	ClientAuthPrivateKeyJWT = "private_key_jwt" // Client assertion signed with client_key
+	ClientAuthTLS           = "tls_client_auth" // Mutual TLS with client_cert and client_key
+)
+
+// DefaultDiscoveryRefresh is how often OpenID Connect discovery documents are fetched again
+const DefaultDiscoveryRefresh = time.Hour
+
+// GetDiscoveryRefresh returns how often the provider's discovery document is fetched again
+// If not set or invalid, returns DefaultDiscoveryRefresh
+func (p OAuth2Provider) GetDiscoveryRefresh() time.Duration {
+	refresh, err := time.ParseDuration(p.DiscoveryRefresh)
+	if err != nil || refresh <= 0 {
+		return DefaultDiscoveryRefresh
+	}
+	return refresh
+}
+
+// IconSource returns the image source of the provider's custom icon:
+// the inline icon as a data URI, or icon_url (empty when neither is set)
+func (p OAuth2Provider) IconSource() string {
+	icon := strings.TrimSpace(p.Icon)
+	switch {
+	case icon == "":
+		return p.IconURL
+	case strings.HasPrefix(icon, "<"):
+		// Rendered in <img>, so scripts in the SVG never run
+		return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(icon))
+	default:
+		return icon
+	}
+}
+
+// GetClientAuthMethod returns the token endpoint client authentication method
+// If not set, returns ClientAuthSecret
+func (p OAuth2Provider) GetClientAuthMethod() string {
+	if p.ClientAuthMethod == "" {
+		return ClientAuthSecret
+	}
+	return p.ClientAuthMethod
+}
+
+// OptionalScope returns the optional scope of the provider named scope, or nil
+func (p OAuth2Provider) OptionalScope(scope string) *OptionalScope {
+	for i := range p.OptionalScopes {
+		if p.OptionalScopes[i].Scope == scope {
+			return &p.OptionalScopes[i]
+		}
+	}
+	return nil
+}
+
+// GetDescription returns the text shown for the scope on the consent step
+func (s OptionalScope) GetDescription() string {
+	if s.Description == "" {
+		return s.Scope
+	}
+	return s.Description
+}
+
+// Validate validates provider-specific OAuth2 settings
+func (c OAuth2Config) Validate() error {
+	verr := NewValidationError()
+
+	for i, p := range c.Providers {
+		// The admin API enables and disables providers and the built-in auth methods by the same IDs
+		if p.ID == "email" || p.ID == "password" {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].id: %w", i, ErrProviderIDReserved))
+		}
+
+		if icon := strings.TrimSpace(p.Icon); icon != "" && !isSVGMarkup(icon) && !strings.HasPrefix(icon, "data:image/") {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].icon: %w", i, ErrProviderIconInvalid))
+		}
+
+		if p.Type != "github" {
+			if len(p.AllowedOrgs) > 0 {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_orgs: %w", i, ErrOAuth2OptionUnsupported))
+			}
+			if len(p.AllowedTeams) > 0 {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_teams: %w", i, ErrOAuth2OptionUnsupported))
+			}
+		}
+		if p.Type != "google" {
+			options := []struct {
+				name string
+				set  bool
+			}{
+				{"hosted_domains", len(p.HostedDomains) > 0},
+				{"directory_credentials_file", p.DirectoryCredentialsFile != ""},
+				{"directory_admin_email", p.DirectoryAdminEmail != ""},
+				{"allowed_groups", len(p.AllowedGroups) > 0},
+			}
+			for _, option := range options {
+				if option.set {
+					verr.Add(fmt.Errorf("oauth2.providers[%d].%s: %w", i, option.name, ErrOAuth2OptionUnsupported))
+				}
+			}
+		}
+		if p.Type != "microsoft" && len(p.AllowedTenants) > 0 {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_tenants: %w", i, ErrOAuth2OptionUnsupported))
+		}
+		if p.Type != "custom" {
+			if p.IssuerURL != "" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].issuer_url: %w", i, ErrOAuth2OptionUnsupported))
+			}
+			if p.DiscoveryRefresh != "" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].discovery_refresh: %w", i, ErrOAuth2OptionUnsupported))
+			}
+		}
+
+		for j, team := range p.AllowedTeams {
+			if org, slug, ok := strings.Cut(team, "/"); !ok || org == "" || slug == "" || strings.Contains(slug, "/") {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_teams[%d]: %w", i, j, ErrGitHubTeamInvalid))
+			}
+		}
+
+		for j, domain := range p.HostedDomains {
+			if domain == "" || strings.ContainsAny(domain, "@/ ") || domain == "*" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].hosted_domains[%d]: %w", i, j, ErrGoogleHostedDomainInvalid))
+			}
+		}
+		if (p.DirectoryCredentialsFile == "") != (p.DirectoryAdminEmail == "") {
+			verr.Add(fmt.Errorf("oauth2.providers[%d]: %w", i, ErrGoogleDirectoryIncomplete))
+		} else if len(p.AllowedGroups) > 0 && p.DirectoryCredentialsFile == "" {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_groups: %w", i, ErrGoogleDirectoryRequired))
+		}
+
+		switch p.GetClientAuthMethod() {
+		case ClientAuthSecret:
+		case ClientAuthPrivateKeyJWT, ClientAuthTLS:
+			if p.ClientKey == "" && p.ClientKeyFile == "" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].client_key: %w", i, ErrClientKeyRequired))
+			}
+			if p.GetClientAuthMethod() == ClientAuthTLS && p.ClientCert == "" && p.ClientCertFile == "" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].client_cert: %w", i, ErrClientCertRequired))
+			}
+		default:
+			verr.Add(fmt.Errorf("oauth2.providers[%d].client_auth_method: %w", i, ErrClientAuthMethodInvalid))
+		}
+		if p.ClientKey != "" && p.ClientKeyFile != "" {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].client_key_file: %w", i, ErrClientKeySourceConflict))
+		}
+		if p.ClientCert != "" && p.ClientCertFile != "" {
+			verr.Add(fmt.Errorf("oauth2.providers[%d].client_cert_file: %w", i, ErrClientKeySourceConflict))
+		}
+
+		if p.IssuerURL != "" {
+			if u, err := url.Parse(p.IssuerURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].issuer_url: %w", i, ErrIssuerURLInvalid))
+			}
+		}
+		if p.DiscoveryRefresh != "" {
+			if refresh, err := time.ParseDuration(p.DiscoveryRefresh); err != nil || refresh <= 0 {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].discovery_refresh: %w", i, ErrDiscoveryRefreshInvalid))
+			}
+		}
+
+		seen := make(map[string]bool, len(p.Scopes)+len(p.OptionalScopes))
+		for _, scope := range p.Scopes {
+			seen[scope] = true
+		}
+		for j, scope := range p.OptionalScopes {
+			switch {
+			case scope.Scope == "" || strings.ContainsAny(scope.Scope, " \t"):
+				verr.Add(fmt.Errorf("oauth2.providers[%d].optional_scopes[%d].scope: %w", i, j, ErrOptionalScopeInvalid))
+			case seen[scope.Scope]:
+				verr.Add(fmt.Errorf("oauth2.providers[%d].optional_scopes[%d].scope: %w", i, j, ErrOptionalScopeDuplicate))
+			}
+			seen[scope.Scope] = true
+		}
+
+		for j, tenant := range p.AllowedTenants {
+			if !isTenantID(tenant) {
+				verr.Add(fmt.Errorf("oauth2.providers[%d].allowed_tenants[%d]: %w", i, j, ErrMicrosoftTenantInvalid))
+			}
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
+
+// isTenantID reports whether s is a GUID (8-4-4-4-12 hexadecimal digits) like Entra tenant IDs
+func isTenantID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isSVGMarkup reports whether s is SVG markup, optionally with an XML declaration
+func isSVGMarkup(s string) bool {
+	if strings.HasPrefix(s, "<?xml") {
+		if end := strings.Index(s, "?>"); end >= 0 {
+			s = strings.TrimSpace(s[end+2:])
+		}
+	}
+	return strings.HasPrefix(s, "<svg")
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// Plugin hooks
+const (
+	PluginHookRequest  = "request"  // Called for requests passed to the upstream: may deny them or set upstream request headers
+	PluginHookCallback = "callback" // Serves {auth_path_prefix}/plugins/{name}/callback: may sign a user in
+)
+
+// defaultPluginTimeout is the time a plugin has to answer a call when timeout is not set
+const defaultPluginTimeout = 2 * time.Second
+
+// pluginNamePattern restricts plugin names to what can appear in the callback path
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// PluginConfig is an external filter process for logic too bespoke for the rules engine
+// The process is started on first use and exchanges one JSON object per line over stdin and stdout
+// (see pkg/middleware/plugins). It is restarted when it fails, and should exit when stdin closes.
+type PluginConfig struct {
+	Name     string   `yaml:"name" json:"name"`           // Required: Plugin name in logs and the callback path (lowercase letters, digits, "-" and "_")
+	Command  []string `yaml:"command" json:"command"`     // Required: Executable and arguments (e.g., ["/usr/local/bin/policy", "--strict"])
+	Hooks    []string `yaml:"hooks" json:"hooks"`         // Required: "request" and/or "callback"
+	Paths    []string `yaml:"paths" json:"paths"`         // Optional: Path patterns the request hook runs on (globs like redirect patterns, default: all)
+	Timeout  string   `yaml:"timeout" json:"timeout"`     // Optional: Time to answer a call (default: "2s")
+	FailOpen bool     `yaml:"fail_open" json:"fail_open"` // Optional: Pass requests through when the plugin fails (default: false, 503)
+}
+
+// HasHook reports whether the plugin handles the hook
+func (p PluginConfig) HasHook(hook string) bool {
+	for _, h := range p.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPath reports whether the request hook runs on the path
+func (p PluginConfig) MatchesPath(path string) bool {
+	if len(p.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range p.Paths {
+		if matchRedirectPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTimeout returns the time the plugin has to answer a call
+func (p PluginConfig) GetTimeout() time.Duration {
+	if d, err := time.ParseDuration(p.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultPluginTimeout
+}
+
+// validatePlugins checks the plugins
+func validatePlugins(plugins []PluginConfig) error {
+	verr := NewValidationError()
+
+	names := make(map[string]bool)
+	for i, p := range plugins {
+		field := fmt.Sprintf("plugins[%d]", i)
+		switch {
+		case p.Name == "":
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrPluginNameRequired))
+		case !pluginNamePattern.MatchString(p.Name):
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrPluginNameInvalid))
+		case names[p.Name]:
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrPluginNameDuplicate))
+		}
+		names[p.Name] = true
+
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			verr.Add(fmt.Errorf("%s.command: %w", field, ErrPluginCommandRequired))
+		}
+
+		if len(p.Hooks) == 0 {
+			verr.Add(fmt.Errorf("%s.hooks: %w", field, ErrPluginHooksRequired))
+		}
+		for j, hook := range p.Hooks {
+			if hook != PluginHookRequest && hook != PluginHookCallback {
+				verr.Add(fmt.Errorf("%s.hooks[%d]: %w", field, j, ErrPluginHookInvalid))
+			}
+		}
+
+		for j, pattern := range p.Paths {
+			if _, err := glob.Compile(pattern); err != nil || !strings.HasPrefix(pattern, "/") {
+				verr.Add(fmt.Errorf("%s.paths[%d]: %w", field, j, ErrPluginPathInvalid))
+			}
+		}
+
+		if p.Timeout != "" {
+			if d, err := time.ParseDuration(p.Timeout); err != nil || d <= 0 {
+				verr.Add(fmt.Errorf("%s.timeout: %w", field, ErrPluginTimeoutInvalid))
+			}
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatePlugins(t *testing.T) {
+	valid := PluginConfig{Name: "policy", Command: []string{"/usr/local/bin/policy"}, Hooks: []string{PluginHookRequest}}
+
+	tests := []struct {
+		name    string
+		modify  func(*PluginConfig)
+		wantErr error
+	}{
+		{"valid plugin", func(p *PluginConfig) {}, nil},
+		{"valid paths and timeout", func(p *PluginConfig) { p.Paths, p.Timeout = []string{"/api/**"}, "500ms" }, nil},
+		{"missing name", func(p *PluginConfig) { p.Name = "" }, ErrPluginNameRequired},
+		{"invalid name", func(p *PluginConfig) { p.Name = "SSO/bridge" }, ErrPluginNameInvalid},
+		{"missing command", func(p *PluginConfig) { p.Command = nil }, ErrPluginCommandRequired},
+		{"missing hooks", func(p *PluginConfig) { p.Hooks = nil }, ErrPluginHooksRequired},
+		{"invalid hook", func(p *PluginConfig) { p.Hooks = []string{"response"} }, ErrPluginHookInvalid},
+		{"relative path", func(p *PluginConfig) { p.Paths = []string{"api/*"} }, ErrPluginPathInvalid},
+		{"invalid timeout", func(p *PluginConfig) { p.Timeout = "soon" }, ErrPluginTimeoutInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := valid
+			tt.modify(&plugin)
+			err := validatePlugins([]PluginConfig{plugin})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validatePlugins() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validatePlugins() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validatePlugins([]PluginConfig{valid, valid}); !errors.Is(err, ErrPluginNameDuplicate) {
+		t.Errorf("validatePlugins(duplicate) error = %v, want %v", err, ErrPluginNameDuplicate)
+	}
+}
+
+func TestPluginConfig_MatchesPath(t *testing.T) {
+	plugin := PluginConfig{Paths: []string{"/api/**", "/admin"}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/api/chat", true},
+		{"/admin", true},
+		{"/admin/users", false},
+		{"/chat", false},
+	}
+	for _, tt := range tests {
+		if got := plugin.MatchesPath(tt.path); got != tt.want {
+			t.Errorf("MatchesPath(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if !(PluginConfig{}).MatchesPath("/chat") {
+		t.Error("MatchesPath() without paths should match every path")
+	}
+}
+
+func TestPluginConfig_GetTimeout(t *testing.T) {
+	if got := (PluginConfig{}).GetTimeout(); got != defaultPluginTimeout {
+		t.Errorf("GetTimeout() = %v, want %v", got, defaultPluginTimeout)
+	}
+	if got := (PluginConfig{Timeout: "500ms"}).GetTimeout(); got != 500*time.Millisecond {
+		t.Errorf("GetTimeout() = %v, want 500ms", got)
+	}
+}
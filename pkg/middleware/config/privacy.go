@@ -0,0 +1,88 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// EmailHashPrefix starts the email hashes of PII minimization (privacy.minimize)
+const EmailHashPrefix = "hmac-sha256:"
+
+// PrivacyConfig contains the data minimization settings
+type PrivacyConfig struct {
+	Minimize        bool     `yaml:"minimize" json:"minimize"`                 // Optional: Keep only a salted hash of the email in sessions and logs (default: false)
+	Salt            string   `yaml:"salt" json:"salt" secret:"true"`           // Required with minimize: Key of the email hashes (min 16 characters; changing it makes existing hashes unmatchable)
+	ForwardedFields []string `yaml:"forwarded_fields" json:"forwarded_fields"` // With minimize: Paths or expressions of the forwarding fields allowed to reach the upstream (default: none)
+}
+
+// HashEmail returns the salted hash of an email, the same for any letter case
+// Values that already are email hashes are returned as they are.
+func (p PrivacyConfig) HashEmail(email string) string {
+	if IsEmailHash(email) {
+		return strings.ToLower(email)
+	}
+	mac := hmac.New(sha256.New, []byte(p.Salt))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return EmailHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEmailHash reports whether s is an email hash made by HashEmail
+func IsEmailHash(s string) bool {
+	rest, ok := strings.CutPrefix(strings.ToLower(s), EmailHashPrefix)
+	if !ok || len(rest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(rest)
+	return err == nil
+}
+
+// ForwardsField reports whether a forwarding field may be forwarded
+// Without minimize every field may; with it only the fields of forwarded_fields.
+func (p PrivacyConfig) ForwardsField(field ForwardingField) bool {
+	if !p.Minimize {
+		return true
+	}
+	for _, source := range p.ForwardedFields {
+		if source == field.Source() {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePrivacy validates the data minimization settings against the features handling emails
+func (c *Config) validatePrivacy() error {
+	p := c.Privacy
+	verr := NewValidationError()
+
+	for i, entry := range c.AccessControl.Emails {
+		if strings.HasPrefix(strings.ToLower(entry), EmailHashPrefix) && (!p.Minimize || !IsEmailHash(entry)) {
+			verr.Add(fmt.Errorf("access_control.emails[%d]: %w", i, ErrPrivacyEmailHashInvalid))
+		}
+	}
+	if !p.Minimize {
+		return verr.ErrorOrNil()
+	}
+
+	switch {
+	case p.Salt == "":
+		verr.Add(fmt.Errorf("privacy.salt: %w", ErrPrivacySaltRequired))
+	case len(p.Salt) < 16:
+		verr.Add(fmt.Errorf("privacy.salt: %w", ErrPrivacySaltTooShort))
+	}
+	// The backend profile's fields count too: they reach the upstream like the configured ones
+	for _, field := range c.Forwarding.EffectiveFields() {
+		if !p.ForwardsField(field) {
+			verr.Add(fmt.Errorf("forwarding field %q: %w", field.Source(), ErrPrivacyFieldNotApproved))
+		}
+	}
+	// ID tokens carry the email and a subject derived from it
+	if c.IDP.Enabled {
+		verr.Add(fmt.Errorf("idp.enabled: %w", ErrPrivacyIDPConflict))
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrivacyConfig_HashEmail(t *testing.T) {
+	p := PrivacyConfig{Minimize: true, Salt: "test-salt-0123456789"}
+
+	hash := p.HashEmail("Alice@Example.com ")
+	if !IsEmailHash(hash) || !strings.HasPrefix(hash, EmailHashPrefix) {
+		t.Fatalf("HashEmail() = %q, want an email hash", hash)
+	}
+	if p.HashEmail("alice@example.com") != hash {
+		t.Error("HashEmail() should not depend on letter case and spaces")
+	}
+	if p.HashEmail(hash) != hash {
+		t.Error("HashEmail() of a hash should return it")
+	}
+	if (PrivacyConfig{Salt: "another-salt-0123456789"}).HashEmail("alice@example.com") == hash {
+		t.Error("HashEmail() should depend on the salt")
+	}
+
+	for _, s := range []string{"alice@example.com", EmailHashPrefix + "abc", EmailHashPrefix + strings.Repeat("z", 64)} {
+		if IsEmailHash(s) {
+			t.Errorf("IsEmailHash(%q) = true", s)
+		}
+	}
+}
+
+func TestConfig_ValidatePrivacy(t *testing.T) {
+	privacy := PrivacyConfig{Minimize: true, Salt: "test-salt-0123456789", ForwardedFields: []string{"email"}}
+	hash := privacy.HashEmail("alice@example.com")
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{"disabled", Config{Forwarding: ForwardingConfig{Fields: []ForwardingField{{Path: "username", Header: "X-User"}}}}, nil},
+		{"approved fields", Config{
+			Privacy:       privacy,
+			Forwarding:    ForwardingConfig{Fields: []ForwardingField{{Path: "email", Header: "X-Email"}}},
+			AccessControl: AccessControlConfig{Emails: []string{hash, "@example.com"}},
+		}, nil},
+		{"no salt", Config{Privacy: PrivacyConfig{Minimize: true}}, ErrPrivacySaltRequired},
+		{"short salt", Config{Privacy: PrivacyConfig{Minimize: true, Salt: "short"}}, ErrPrivacySaltTooShort},
+		{"field not approved", Config{
+			Privacy:    privacy,
+			Forwarding: ForwardingConfig{Fields: []ForwardingField{{Path: "username", Header: "X-User"}}},
+		}, ErrPrivacyFieldNotApproved},
+		{"backend field not approved", Config{
+			Privacy:    PrivacyConfig{Minimize: true, Salt: privacy.Salt},
+			Forwarding: ForwardingConfig{Backend: "openai"},
+		}, ErrPrivacyFieldNotApproved},
+		{"idp", Config{Privacy: privacy, IDP: IDPConfig{Enabled: true}}, ErrPrivacyIDPConflict},
+		{"hashed entry without minimize", Config{AccessControl: AccessControlConfig{Emails: []string{hash}}}, ErrPrivacyEmailHashInvalid},
+		{"malformed hashed entry", Config{Privacy: privacy, AccessControl: AccessControlConfig{Emails: []string{EmailHashPrefix + "abc"}}}, ErrPrivacyEmailHashInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validatePrivacy()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validatePrivacy() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validatePrivacy() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultProviderTokenRefreshBefore is how long before their expiry provider access tokens are refreshed
+// when provider_tokens.refresh_before is not set
+const DefaultProviderTokenRefreshBefore = time.Minute
+
+// ProviderTokensConfig contains the settings of the provider token endpoint (/_auth/provider-token)
+// When enabled, the OAuth2 provider's tokens are kept (encrypted) in the session, and upstream services
+// exchange the session reference forwarded as "extra.session_ref" for a current access token.
+type ProviderTokensConfig struct {
+	Enabled       bool   `yaml:"enabled" json:"enabled"`               // Optional: Keep provider tokens in sessions and serve the endpoint (default: false)
+	Secret        string `yaml:"secret" json:"secret" secret:"true"`   // Required when enabled: Shared secret of upstream services calling the endpoint (min 32 characters)
+	RefreshBefore string `yaml:"refresh_before" json:"refresh_before"` // Optional: Refresh access tokens expiring within this duration (default: "1m")
+}
+
+// GetRefreshBefore returns how long before its expiry an access token is refreshed
+// If not set or invalid, returns DefaultProviderTokenRefreshBefore
+func (p ProviderTokensConfig) GetRefreshBefore() time.Duration {
+	d, err := time.ParseDuration(p.RefreshBefore)
+	if err != nil || d < 0 {
+		return DefaultProviderTokenRefreshBefore
+	}
+	return d
+}
+
+// Validate checks the provider token endpoint settings
+func (p ProviderTokensConfig) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	verr := NewValidationError()
+
+	if len(p.Secret) < 32 {
+		verr.Add(fmt.Errorf("provider_tokens.secret: %w", ErrProviderTokensSecretTooShort))
+	}
+	if p.RefreshBefore != "" {
+		if d, err := time.ParseDuration(p.RefreshBefore); err != nil || d < 0 {
+			verr.Add(fmt.Errorf("provider_tokens.refresh_before: %w", ErrProviderTokensRefreshBeforeInvalid))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
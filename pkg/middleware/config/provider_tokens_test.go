@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProviderTokensConfig_Validate(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+
+	tests := []struct {
+		name    string
+		config  ProviderTokensConfig
+		wantErr error
+	}{
+		{"disabled", ProviderTokensConfig{RefreshBefore: "soon"}, nil},
+		{"valid", ProviderTokensConfig{Enabled: true, Secret: secret, RefreshBefore: "5m"}, nil},
+		{"no secret", ProviderTokensConfig{Enabled: true}, ErrProviderTokensSecretTooShort},
+		{"short secret", ProviderTokensConfig{Enabled: true, Secret: "short"}, ErrProviderTokensSecretTooShort},
+		{"invalid refresh_before", ProviderTokensConfig{Enabled: true, Secret: secret, RefreshBefore: "soon"}, ErrProviderTokensRefreshBeforeInvalid},
+		{"negative refresh_before", ProviderTokensConfig{Enabled: true, Secret: secret, RefreshBefore: "-1m"}, ErrProviderTokensRefreshBeforeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderTokensConfig_GetRefreshBefore(t *testing.T) {
+	if got := (ProviderTokensConfig{}).GetRefreshBefore(); got != DefaultProviderTokenRefreshBefore {
+		t.Errorf("GetRefreshBefore() = %v, want %v", got, DefaultProviderTokenRefreshBefore)
+	}
+	if got := (ProviderTokensConfig{RefreshBefore: "0s"}).GetRefreshBefore(); got != 0 {
+		t.Errorf("GetRefreshBefore() = %v, want 0", got)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// RedirectConfig constrains the target of the redirect after login
+// Patterns are globs (like access control "minimatch" rules) matched against the path of the
+// saved target URL, without the query string. A rejected target sends the user to Fallback,
+// or to server.default_redirect when no fallback is set.
+type RedirectConfig struct {
+	Allow    []string `yaml:"allow" json:"allow"`       // Optional: Path patterns the redirect may target (e.g., "/chat/**"; empty: any path)
+	Deny     []string `yaml:"deny" json:"deny"`         // Optional: Path patterns the redirect never targets, checked before allow (e.g., "/api/**", "/logout")
+	Fallback string   `yaml:"fallback" json:"fallback"` // Optional: Landing path used when the target is rejected (default: server.default_redirect)
+}
+
+// AllowsTarget reports whether the post-login redirect may target redirectURL
+// Absolute URLs (central authentication) are checked by their path
+func (r RedirectConfig) AllowsTarget(redirectURL string) bool {
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return false
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	for _, pattern := range r.Deny {
+		if matchRedirectPattern(pattern, path) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range r.Allow {
+		if matchRedirectPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRedirectPattern matches a path against a glob pattern; invalid patterns never match
+func matchRedirectPattern(pattern, path string) bool {
+	g, err := glob.Compile(pattern)
+	return err == nil && g.Match(path)
+}
+
+// Validate checks the redirect settings
+func (r RedirectConfig) Validate() error {
+	verr := NewValidationError()
+
+	for i, pattern := range r.Allow {
+		if _, err := glob.Compile(pattern); err != nil || !strings.HasPrefix(pattern, "/") {
+			verr.Add(fmt.Errorf("redirect.allow[%d]: %w", i, ErrRedirectPatternInvalid))
+		}
+	}
+	for i, pattern := range r.Deny {
+		if _, err := glob.Compile(pattern); err != nil || !strings.HasPrefix(pattern, "/") {
+			verr.Add(fmt.Errorf("redirect.deny[%d]: %w", i, ErrRedirectPatternInvalid))
+		}
+	}
+
+	// The fallback is used as is, so it must be a local path that the rules accept
+	if r.Fallback != "" {
+		if !isLocalPath(r.Fallback) {
+			verr.Add(fmt.Errorf("redirect.fallback: %w", ErrRedirectFallbackInvalid))
+		} else if !r.AllowsTarget(r.Fallback) {
+			verr.Add(fmt.Errorf("redirect.fallback: %w", ErrRedirectFallbackRejected))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
+
+// isLocalPath reports whether p is a path on this host (starts with "/" but is not protocol-relative)
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.Contains(p, "://")
+}
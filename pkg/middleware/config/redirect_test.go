@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedirectConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect RedirectConfig
+		wantErr  error
+	}{
+		{"empty", RedirectConfig{}, nil},
+		{"valid", RedirectConfig{Allow: []string{"/chat/**"}, Deny: []string{"/api/**"}, Fallback: "/chat/"}, nil},
+		{"relative pattern", RedirectConfig{Deny: []string{"api/*"}}, ErrRedirectPatternInvalid},
+		{"invalid glob", RedirectConfig{Allow: []string{"/chat/[a"}}, ErrRedirectPatternInvalid},
+		{"absolute fallback", RedirectConfig{Fallback: "https://evil.com/"}, ErrRedirectFallbackInvalid},
+		{"protocol-relative fallback", RedirectConfig{Fallback: "//evil.com"}, ErrRedirectFallbackInvalid},
+		{"denied fallback", RedirectConfig{Deny: []string{"/admin/**"}, Fallback: "/admin/home"}, ErrRedirectFallbackRejected},
+		{"fallback outside allow", RedirectConfig{Allow: []string{"/chat/**"}, Fallback: "/"}, ErrRedirectFallbackRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.redirect.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedirectConfig_AllowsTarget(t *testing.T) {
+	redirect := RedirectConfig{
+		Allow: []string{"/chat/**", "/app"},
+		Deny:  []string{"/chat/admin/**", "/logout"},
+	}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/chat/123", true},
+		{"/chat/123?tab=history", true},
+		{"/app", true},
+		{"/app/settings", false},
+		{"/chat/admin/users", false},
+		{"/logout", false},
+		{"/api/v1/messages", false},
+		{"https://app.example.com/chat/123", true},
+		{"https://app.example.com/logout", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := redirect.AllowsTarget(tt.target); got != tt.want {
+				t.Errorf("AllowsTarget(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+
+	if !(RedirectConfig{}).AllowsTarget("/anything") {
+		t.Error("Empty config should allow any target")
+	}
+	if (RedirectConfig{Deny: []string{"/api/**"}}).AllowsTarget("/api/chat") {
+		t.Error("Deny-only config should reject denied targets")
+	}
+}
+
+func TestConfig_Validate_DefaultRedirect(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultRedirect string
+		redirect        RedirectConfig
+		wantErr         error
+	}{
+		{"empty", "", RedirectConfig{}, nil},
+		{"valid", "/chat", RedirectConfig{}, nil},
+		{"absolute", "https://example.com/chat", RedirectConfig{}, ErrDefaultRedirectInvalid},
+		{"denied without fallback", "/api/chat", RedirectConfig{Deny: []string{"/api/**"}}, ErrRedirectFallbackRejected},
+		{"denied with fallback", "/api/chat", RedirectConfig{Deny: []string{"/api/**"}, Fallback: "/"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Service:   ServiceConfig{Name: "Test"},
+				Server:    ServerConfig{DefaultRedirect: tt.defaultRedirect},
+				Session:   SessionConfig{Cookie: CookieConfig{Secret: "this-is-a-very-long-secret-key-for-testing"}},
+				EmailAuth: EmailAuthConfig{Enabled: true},
+				Redirect:  tt.redirect,
+			}
+			err := cfg.Validate()
+			if tt.wantErr == nil {
+				if errors.Is(err, ErrDefaultRedirectInvalid) || errors.Is(err, ErrRedirectFallbackRejected) {
+					t.Errorf("Validate() error = %v, want no redirect error", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := (ServerConfig{}).GetDefaultRedirect(); got != "/" {
+		t.Errorf("GetDefaultRedirect() = %q, want /", got)
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// secretKeys are the configuration keys whose string values are secrets (in lower case,
+// as the KVS settings have no JSON names)
+// The fields holding secrets are tagged secret:"true", and tests check that their keys are listed here.
+var secretKeys = map[string]bool{
+	"secret":               true,
+	"client_secret":        true,
+	"introspection_secret": true,
+	"admin_token":          true,
+	"token":                true,
+	"password":             true,
+	"api_key":              true,
+	"widget_token":         true,
+	"key":                  true,
+	"client_key":           true,
+	"signing_key":          true,
+	"salt":                 true,
+}
+
+// IsSecretKey reports whether a string value of the configuration key is a secret
+// parent is the key of its section: "namespaces" holds KVS key prefixes, never secrets.
+func IsSecretKey(key, parent string) bool {
+	return secretKeys[strings.ToLower(key)] && !strings.EqualFold(parent, "namespaces")
+}
+
+// SecretValue is a secret set in the configuration
+type SecretValue struct {
+	Path  string // Dot-separated path of the setting, with list indexes (e.g., "oauth2.providers[0].client_secret")
+	Value string
+}
+
+// SecretValues returns the secrets set in the configuration, sorted by path
+func (c *Config) SecretValues() []SecretValue {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+
+	var secrets []SecretValue
+	collectSecrets(decoded, "", "", &secrets)
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Path < secrets[j].Path })
+	return secrets
+}
+
+// collectSecrets appends the secrets of a decoded configuration section at path to secrets
+func collectSecrets(v interface{}, path, parent string, secrets *[]SecretValue) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range value {
+			key := strings.ToLower(k)
+			nestedPath := key
+			if path != "" {
+				nestedPath = path + "." + key
+			}
+			if s, ok := nested.(string); ok {
+				if s != "" && IsSecretKey(key, parent) {
+					*secrets = append(*secrets, SecretValue{Path: nestedPath, Value: s})
+				}
+				continue
+			}
+			collectSecrets(nested, nestedPath, key, secrets)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			collectSecrets(nested, fmt.Sprintf("%s[%d]", path, i), parent, secrets)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+func TestConfig_SecretValues(t *testing.T) {
+	cfg := &Config{
+		Session:        SessionConfig{Cookie: CookieConfig{Secret: "cookie-secret"}},
+		OAuth2:         OAuth2Config{Providers: []OAuth2Provider{{ID: "google", ClientSecret: "client-secret"}}},
+		EmailAuth:      EmailAuthConfig{SMTP: SMTPConfig{Password: "smtp-password"}, SendGrid: SendGridConfig{APIKey: "sendgrid-key"}},
+		Forwarding:     ForwardingConfig{Encryption: &EncryptionConfig{Key: "encryption-key"}},
+		KVS:            KVSConfig{Default: kvs.Config{Redis: kvs.RedisConfig{Password: "redis-password"}}, Namespaces: NamespaceConfig{Token: "token"}},
+		ProviderTokens: ProviderTokensConfig{Secret: "provider-tokens-secret"},
+		Privacy:        PrivacyConfig{Salt: "privacy-salt"},
+	}
+
+	want := map[string]string{
+		"session.cookie.secret":             "cookie-secret",
+		"oauth2.providers[0].client_secret": "client-secret",
+		"email_auth.smtp.password":          "smtp-password",
+		"email_auth.sendgrid.api_key":       "sendgrid-key",
+		"forwarding.encryption.key":         "encryption-key",
+		"kvs.default.redis.password":        "redis-password",
+		"provider_tokens.secret":            "provider-tokens-secret",
+		"privacy.salt":                      "privacy-salt",
+	}
+	got := cfg.SecretValues()
+	if len(got) != len(want) {
+		t.Errorf("SecretValues() = %v, want %d secrets", got, len(want))
+	}
+	for _, secret := range got {
+		if want[secret.Path] != secret.Value {
+			t.Errorf("SecretValues() has %s = %q, want %q", secret.Path, secret.Value, want[secret.Path])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ServiceTokenConfig is a credential of an internal caller (cron job, monitoring) that passes
+// through the gate without a browser session, on its paths only. The caller authenticates with
+// "Authorization: Bearer <token>", or with a verified TLS client certificate when the middleware
+// is served over mutual TLS.
+type ServiceTokenConfig struct {
+	Name              string   `yaml:"name" json:"name"`                               // Required: Caller name in logs and the X-Auth-Service header (e.g., "uptime-monitor")
+	Token             string   `yaml:"token" json:"token" secret:"true"`               // Bearer token (min 32 characters)
+	ClientCertSubject string   `yaml:"client_cert_subject" json:"client_cert_subject"` // Or: Common Name or DNS SAN of a verified TLS client certificate
+	Paths             []string `yaml:"paths" json:"paths"`                             // Required: Path patterns the caller may access (globs, "*" within a segment and "**" across segments, e.g., "/api/health", "/api/reports/**")
+	Methods           []string `yaml:"methods" json:"methods"`                         // Optional: Allowed HTTP methods (default: all)
+}
+
+// ServiceTokenScope is the compiled scope of a service token: the paths and methods it may access
+type ServiceTokenScope struct {
+	methods []string
+	paths   []glob.Glob
+}
+
+// Scope compiles the path patterns of the service token, once rather than on every request
+// Patterns are compiled with "/" as separator: "*" matches within a path segment, "**" across segments.
+func (s ServiceTokenConfig) Scope() (*ServiceTokenScope, error) {
+	scope := &ServiceTokenScope{methods: s.Methods}
+	for _, pattern := range s.Paths {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrServiceTokenPathInvalid, pattern)
+		}
+		scope.paths = append(scope.paths, g)
+	}
+	return scope, nil
+}
+
+// Allows reports whether the caller may send a request with the method to the URL
+// Paths the upstream could resolve to another path are never allowed (dot segments, empty segments,
+// backslashes, encoded slashes), so that "/api/reports/**" does not match "/api/reports/../admin".
+func (s *ServiceTokenScope) Allows(method string, u *url.URL) bool {
+	if len(s.methods) > 0 {
+		allowed := false
+		for _, m := range s.methods {
+			if strings.EqualFold(m, method) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if !isCanonicalPath(u) {
+		return false
+	}
+	for _, g := range s.paths {
+		if g.Match(u.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCanonicalPath reports whether the path of u is absolute and already clean, without encoded slashes
+// A trailing slash is allowed.
+func isCanonicalPath(u *url.URL) bool {
+	p := u.Path
+	if !strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return false
+	}
+	raw := strings.ToLower(u.RawPath)
+	if strings.Contains(raw, "%2f") || strings.Contains(raw, "%5c") {
+		return false
+	}
+	clean := path.Clean(p)
+	return p == clean || p == clean+"/"
+}
+
+// validateServiceTokens checks the service tokens
+func validateServiceTokens(tokens []ServiceTokenConfig) error {
+	verr := NewValidationError()
+
+	names := make(map[string]bool)
+	for i, t := range tokens {
+		field := fmt.Sprintf("service_tokens[%d]", i)
+		if t.Name == "" {
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrServiceTokenNameRequired))
+		} else if names[t.Name] {
+			verr.Add(fmt.Errorf("%s.name: %w", field, ErrServiceTokenNameDuplicate))
+		}
+		names[t.Name] = true
+
+		switch {
+		case t.Token != "" && t.ClientCertSubject != "":
+			verr.Add(fmt.Errorf("%s: %w", field, ErrServiceTokenCredentialConflict))
+		case t.Token == "" && t.ClientCertSubject == "":
+			verr.Add(fmt.Errorf("%s: %w", field, ErrServiceTokenCredentialRequired))
+		case t.Token != "" && len(t.Token) < 32:
+			verr.Add(fmt.Errorf("%s.token: %w", field, ErrServiceTokenTooShort))
+		}
+
+		if len(t.Paths) == 0 {
+			verr.Add(fmt.Errorf("%s.paths: %w", field, ErrServiceTokenPathsRequired))
+		}
+		for j, pattern := range t.Paths {
+			if _, err := glob.Compile(pattern, '/'); err != nil || !strings.HasPrefix(pattern, "/") {
+				verr.Add(fmt.Errorf("%s.paths[%d]: %w", field, j, ErrServiceTokenPathInvalid))
+			}
+		}
+		for j, method := range t.Methods {
+			if !isHTTPMethod(method) {
+				verr.Add(fmt.Errorf("%s.methods[%d]: %w", field, j, ErrServiceTokenMethodInvalid))
+			}
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
+
+// isHTTPMethod reports whether method is a standard HTTP method (case-insensitive)
+func isHTTPMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return true
+	}
+	return false
+}
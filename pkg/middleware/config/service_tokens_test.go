@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+const testServiceToken = "service-token-with-at-least-32-characters"
+
+func TestValidateServiceTokens(t *testing.T) {
+	valid := ServiceTokenConfig{Name: "monitor", Token: testServiceToken, Paths: []string{"/api/health"}}
+
+	tests := []struct {
+		name    string
+		modify  func(*ServiceTokenConfig)
+		wantErr error
+	}{
+		{"valid token", func(s *ServiceTokenConfig) {}, nil},
+		{"valid client certificate", func(s *ServiceTokenConfig) { s.Token, s.ClientCertSubject = "", "cron.internal" }, nil},
+		{"missing name", func(s *ServiceTokenConfig) { s.Name = "" }, ErrServiceTokenNameRequired},
+		{"missing credential", func(s *ServiceTokenConfig) { s.Token = "" }, ErrServiceTokenCredentialRequired},
+		{"both credentials", func(s *ServiceTokenConfig) { s.ClientCertSubject = "cron.internal" }, ErrServiceTokenCredentialConflict},
+		{"short token", func(s *ServiceTokenConfig) { s.Token = "short" }, ErrServiceTokenTooShort},
+		{"missing paths", func(s *ServiceTokenConfig) { s.Paths = nil }, ErrServiceTokenPathsRequired},
+		{"relative path", func(s *ServiceTokenConfig) { s.Paths = []string{"api/*"} }, ErrServiceTokenPathInvalid},
+		{"invalid method", func(s *ServiceTokenConfig) { s.Methods = []string{"FETCH"} }, ErrServiceTokenMethodInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := valid
+			tt.modify(&token)
+			err := validateServiceTokens([]ServiceTokenConfig{token})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateServiceTokens() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateServiceTokens() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validateServiceTokens([]ServiceTokenConfig{valid, valid}); !errors.Is(err, ErrServiceTokenNameDuplicate) {
+		t.Errorf("validateServiceTokens(duplicate) error = %v, want %v", err, ErrServiceTokenNameDuplicate)
+	}
+}
+
+func TestServiceTokenScope_Allows(t *testing.T) {
+	token := ServiceTokenConfig{Paths: []string{"/api/health", "/api/reports/**", "/api/jobs/*"}, Methods: []string{"get"}}
+	scope, err := token.Scope()
+	if err != nil {
+		t.Fatalf("Scope() error = %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/api/health", true},
+		{"GET", "/api/reports/2026/10", true},
+		{"GET", "/api/reports/2026/", true},
+		{"GET", "/api/jobs/42", true},
+		{"POST", "/api/health", false},
+		{"GET", "/api/healthz", false},
+		{"GET", "/chat", false},
+		{"GET", "/api/jobs/42/logs", false}, // "*" stays within a segment
+		{"GET", "/api/reports/../admin", false},
+		{"GET", "/api/reports/%2e%2e/admin", false},
+		{"GET", "/api/reports/./2026", false},
+		{"GET", "/api/reports//2026", false},
+		{"GET", "/api/reports/..%2fadmin", false},
+		{"GET", "/api/reports/2026%2F10", false},
+		{"GET", "/api/reports/..\\admin", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.path)
+		if err != nil {
+			t.Fatalf("url.Parse(%q) error = %v", tt.path, err)
+		}
+		if got := scope.Allows(tt.method, u); got != tt.want {
+			t.Errorf("Allows(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of the session garbage collection
+const (
+	DefaultSessionGCInterval  = time.Hour
+	DefaultSessionGCBatchSize = 500
+)
+
+// SessionGCConfig contains the session garbage collection settings
+// A periodic job, run by one instance, deletes the expired session records of the session KVS.
+// Useful with backends that keep expired keys until read (LevelDB); Redis expires them by itself.
+type SessionGCConfig struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled"`       // Enable the session GC job
+	Interval  string `yaml:"interval" json:"interval"`     // Time between two runs (default: "1h")
+	BatchSize int    `yaml:"batch_size" json:"batch_size"` // Session records read between two checks for cancellation (default: 500)
+}
+
+// GetInterval returns the time between two runs
+// If not set or invalid, returns DefaultSessionGCInterval
+func (g SessionGCConfig) GetInterval() time.Duration {
+	interval, err := time.ParseDuration(g.Interval)
+	if err != nil || interval <= 0 {
+		return DefaultSessionGCInterval
+	}
+	return interval
+}
+
+// GetBatchSize returns the number of session records read per batch
+// If not set, returns DefaultSessionGCBatchSize
+func (g SessionGCConfig) GetBatchSize() int {
+	if g.BatchSize <= 0 {
+		return DefaultSessionGCBatchSize
+	}
+	return g.BatchSize
+}
+
+// Validate checks the session garbage collection settings
+func (g SessionGCConfig) Validate() error {
+	verr := NewValidationError()
+
+	if g.Interval != "" {
+		if interval, err := time.ParseDuration(g.Interval); err != nil || interval < time.Minute {
+			verr.Add(fmt.Errorf("session.gc.interval: %w", ErrSessionGCIntervalInvalid))
+		}
+	}
+	if g.BatchSize < 0 {
+		verr.Add(fmt.Errorf("session.gc.batch_size: %w", ErrSessionGCBatchSizeInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
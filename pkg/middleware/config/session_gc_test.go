@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionGCConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gc      SessionGCConfig
+		wantErr error
+	}{
+		{"defaults", SessionGCConfig{Enabled: true}, nil},
+		{"custom", SessionGCConfig{Enabled: true, Interval: "15m", BatchSize: 100}, nil},
+		{"invalid interval", SessionGCConfig{Interval: "hourly"}, ErrSessionGCIntervalInvalid},
+		{"interval too short", SessionGCConfig{Interval: "10s"}, ErrSessionGCIntervalInvalid},
+		{"negative batch size", SessionGCConfig{BatchSize: -1}, ErrSessionGCBatchSizeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.gc.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionGCConfig_Defaults(t *testing.T) {
+	var gc SessionGCConfig
+	if got := gc.GetInterval(); got != DefaultSessionGCInterval {
+		t.Errorf("GetInterval() = %v, want %v", got, DefaultSessionGCInterval)
+	}
+	if got := gc.GetBatchSize(); got != DefaultSessionGCBatchSize {
+		t.Errorf("GetBatchSize() = %d, want %d", got, DefaultSessionGCBatchSize)
+	}
+
+	gc = SessionGCConfig{Interval: "30m", BatchSize: 50}
+	if got := gc.GetInterval(); got != 30*time.Minute {
+		t.Errorf("GetInterval() = %v, want 30m", got)
+	}
+	if got := gc.GetBatchSize(); got != 50 {
+		t.Errorf("GetBatchSize() = %d, want 50", got)
+	}
+}
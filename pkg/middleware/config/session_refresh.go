@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultSessionMaxLifetime caps sliding sessions when session.refresh.max_lifetime is not set
+const DefaultSessionMaxLifetime = 30 * 24 * time.Hour
+
+// SessionRefreshConfig contains the settings of the session refresh endpoint (/_auth/session/refresh)
+// The endpoint always reports the expiry of the session; with sliding sessions, POST also extends it.
+type SessionRefreshConfig struct {
+	Sliding       bool   `yaml:"sliding" json:"sliding"`               // Optional: POST extends the session to cookie.expire from now (default: false)
+	MaxLifetime   string `yaml:"max_lifetime" json:"max_lifetime"`     // Optional: Sliding sessions never outlive this since login (default: "720h")
+	ExpiresHeader bool   `yaml:"expires_header" json:"expires_header"` // Optional: Add X-ChatbotGate-Session-Expires to proxied responses
+}
+
+// GetMaxLifetime returns the longest time a sliding session lasts since login
+// If not set or invalid, returns DefaultSessionMaxLifetime
+func (r SessionRefreshConfig) GetMaxLifetime() time.Duration {
+	lifetime, err := time.ParseDuration(r.MaxLifetime)
+	if err != nil || lifetime <= 0 {
+		return DefaultSessionMaxLifetime
+	}
+	return lifetime
+}
+
+// Validate checks the session refresh settings against the session lifetime (session.cookie.expire)
+func (r SessionRefreshConfig) Validate(expire time.Duration) error {
+	verr := NewValidationError()
+
+	if r.MaxLifetime != "" {
+		if lifetime, err := time.ParseDuration(r.MaxLifetime); err != nil || lifetime <= 0 {
+			verr.Add(fmt.Errorf("session.refresh.max_lifetime: %w", ErrSessionMaxLifetimeInvalid))
+		} else if lifetime < expire {
+			verr.Add(fmt.Errorf("session.refresh.max_lifetime: %w", ErrSessionMaxLifetimeTooShort))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionRefreshConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxLifetime string
+		wantErr     error
+	}{
+		{"default", "", nil},
+		{"valid", "720h", nil},
+		{"invalid", "a month", ErrSessionMaxLifetimeInvalid},
+		{"shorter than the session", "1h", ErrSessionMaxLifetimeTooShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SessionRefreshConfig{Sliding: true, MaxLifetime: tt.maxLifetime}.Validate(24 * time.Hour)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionRefreshConfig_GetMaxLifetime(t *testing.T) {
+	if got := (SessionRefreshConfig{}).GetMaxLifetime(); got != DefaultSessionMaxLifetime {
+		t.Errorf("GetMaxLifetime() = %v, want %v", got, DefaultSessionMaxLifetime)
+	}
+	if got := (SessionRefreshConfig{MaxLifetime: "48h"}).GetMaxLifetime(); got != 48*time.Hour {
+		t.Errorf("GetMaxLifetime() = %v, want 48h", got)
+	}
+}
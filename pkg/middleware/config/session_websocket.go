@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of the session checks of WebSocket connections
+const (
+	DefaultWebSocketCheckInterval = time.Minute
+	DefaultWebSocketCloseCode     = 4401 // In the range of application close codes; "401" for the frontend
+)
+
+// WebSocketSessionConfig contains the settings of the session checks of proxied WebSocket connections
+// The session of an open connection is checked again periodically and when it is due to expire;
+// once it has expired or been revoked (logout, admin API), the connection is closed with CloseCode.
+type WebSocketSessionConfig struct {
+	Disabled  bool   `yaml:"disabled" json:"disabled"`     // Optional: Let connections outlive their session (default: false)
+	Interval  string `yaml:"interval" json:"interval"`     // Optional: Time between two checks of the session (default: "1m", at least "1s")
+	Grace     string `yaml:"grace" json:"grace"`           // Optional: Time a connection stays open after its session ended (default: "0s")
+	CloseCode int    `yaml:"close_code" json:"close_code"` // Optional: WebSocket close code sent to the browser (default: 4401)
+}
+
+// GetInterval returns the time between two checks of the session
+// If not set or invalid, returns DefaultWebSocketCheckInterval
+func (w WebSocketSessionConfig) GetInterval() time.Duration {
+	interval, err := time.ParseDuration(w.Interval)
+	if err != nil || interval <= 0 {
+		return DefaultWebSocketCheckInterval
+	}
+	return interval
+}
+
+// GetGrace returns the time a connection stays open after its session ended
+func (w WebSocketSessionConfig) GetGrace() time.Duration {
+	grace, err := time.ParseDuration(w.Grace)
+	if err != nil || grace < 0 {
+		return 0
+	}
+	return grace
+}
+
+// GetCloseCode returns the close code of connections whose session ended
+// If not set, returns DefaultWebSocketCloseCode
+func (w WebSocketSessionConfig) GetCloseCode() int {
+	if w.CloseCode == 0 {
+		return DefaultWebSocketCloseCode
+	}
+	return w.CloseCode
+}
+
+// Validate checks the session checks of WebSocket connections
+func (w WebSocketSessionConfig) Validate() error {
+	verr := NewValidationError()
+
+	if w.Interval != "" {
+		if interval, err := time.ParseDuration(w.Interval); err != nil || interval < time.Second {
+			verr.Add(fmt.Errorf("session.websocket.interval: %w", ErrWebSocketIntervalInvalid))
+		}
+	}
+	if w.Grace != "" {
+		if grace, err := time.ParseDuration(w.Grace); err != nil || grace < 0 {
+			verr.Add(fmt.Errorf("session.websocket.grace: %w", ErrWebSocketGraceInvalid))
+		}
+	}
+	// Codes a server may send: normal closure, going away, policy violation, and the registered and application ranges
+	if code := w.CloseCode; code != 0 && code != 1000 && code != 1001 && code != 1008 && (code < 3000 || code > 4999) {
+		verr.Add(fmt.Errorf("session.websocket.close_code: %w", ErrWebSocketCloseCodeInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
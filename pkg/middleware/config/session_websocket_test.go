@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebSocketSessionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  WebSocketSessionConfig
+		wantErr error
+	}{
+		{"defaults", WebSocketSessionConfig{}, nil},
+		{"valid", WebSocketSessionConfig{Interval: "30s", Grace: "1m", CloseCode: 4000}, nil},
+		{"policy violation", WebSocketSessionConfig{CloseCode: 1008}, nil},
+		{"interval too short", WebSocketSessionConfig{Interval: "100ms"}, ErrWebSocketIntervalInvalid},
+		{"negative grace", WebSocketSessionConfig{Grace: "-1s"}, ErrWebSocketGraceInvalid},
+		{"reserved close code", WebSocketSessionConfig{CloseCode: 1006}, ErrWebSocketCloseCodeInvalid},
+		{"close code out of range", WebSocketSessionConfig{CloseCode: 5000}, ErrWebSocketCloseCodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebSocketSessionConfig_Defaults(t *testing.T) {
+	var cfg WebSocketSessionConfig
+	if cfg.GetInterval() != DefaultWebSocketCheckInterval || cfg.GetGrace() != 0 || cfg.GetCloseCode() != DefaultWebSocketCloseCode {
+		t.Errorf("Defaults = %v, %v, %d", cfg.GetInterval(), cfg.GetGrace(), cfg.GetCloseCode())
+	}
+	cfg = WebSocketSessionConfig{Interval: "30s", Grace: "5s", CloseCode: 4000}
+	if cfg.GetInterval() != 30*time.Second || cfg.GetGrace() != 5*time.Second || cfg.GetCloseCode() != 4000 {
+		t.Errorf("Configured = %v, %v, %d", cfg.GetInterval(), cfg.GetGrace(), cfg.GetCloseCode())
+	}
+}
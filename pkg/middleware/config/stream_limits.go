@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// StreamLimitConfig limits the proxied responses of matching paths, e.g. LLM chat streams
+// A response exceeding a limit is cut: the connection is aborted, so the client sees an incomplete response.
+type StreamLimitConfig struct {
+	Paths            []string `yaml:"paths" json:"paths"`                           // Required: Path patterns (globs like redirect patterns, e.g., "/v1/chat-messages", "/api/stream/**")
+	MaxResponseBytes int64    `yaml:"max_response_bytes" json:"max_response_bytes"` // Optional: Response body bytes sent to the client (default: 0, no limit)
+	MaxDuration      string   `yaml:"max_duration" json:"max_duration"`             // Optional: Time from the request to the end of the response (e.g., "5m"; default: no limit)
+}
+
+// Matches reports whether the limits apply to the path
+func (s StreamLimitConfig) Matches(path string) bool {
+	for _, pattern := range s.Paths {
+		if matchRedirectPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaxDuration returns the time limit of responses, or 0 without limit
+func (s StreamLimitConfig) GetMaxDuration() time.Duration {
+	d, err := time.ParseDuration(s.MaxDuration)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// StreamLimitFor returns the first stream limit matching the path, or nil
+func (c *Config) StreamLimitFor(path string) *StreamLimitConfig {
+	for i := range c.StreamLimits {
+		if c.StreamLimits[i].Matches(path) {
+			return &c.StreamLimits[i]
+		}
+	}
+	return nil
+}
+
+// validateStreamLimits checks the stream limits
+func validateStreamLimits(limits []StreamLimitConfig) error {
+	verr := NewValidationError()
+
+	for i, l := range limits {
+		field := fmt.Sprintf("stream_limits[%d]", i)
+		if len(l.Paths) == 0 {
+			verr.Add(fmt.Errorf("%s.paths: %w", field, ErrStreamLimitPathsRequired))
+		}
+		for j, pattern := range l.Paths {
+			if _, err := glob.Compile(pattern); err != nil || !strings.HasPrefix(pattern, "/") {
+				verr.Add(fmt.Errorf("%s.paths[%d]: %w", field, j, ErrStreamLimitPathInvalid))
+			}
+		}
+		if l.MaxResponseBytes < 0 {
+			verr.Add(fmt.Errorf("%s.max_response_bytes: %w", field, ErrStreamLimitBytesInvalid))
+		}
+		if l.MaxDuration != "" {
+			if d, err := time.ParseDuration(l.MaxDuration); err != nil || d <= 0 {
+				verr.Add(fmt.Errorf("%s.max_duration: %w", field, ErrStreamLimitDurationInvalid))
+			}
+		}
+		if l.MaxResponseBytes == 0 && l.MaxDuration == "" {
+			verr.Add(fmt.Errorf("%s: %w", field, ErrStreamLimitRequired))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
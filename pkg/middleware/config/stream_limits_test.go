@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateStreamLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  []StreamLimitConfig
+		wantErr error
+	}{
+		{"none", nil, nil},
+		{"valid", []StreamLimitConfig{{Paths: []string{"/v1/chat-messages", "/api/stream/**"}, MaxResponseBytes: 1 << 20, MaxDuration: "5m"}}, nil},
+		{"bytes only", []StreamLimitConfig{{Paths: []string{"/api/**"}, MaxResponseBytes: 1024}}, nil},
+		{"no paths", []StreamLimitConfig{{MaxDuration: "5m"}}, ErrStreamLimitPathsRequired},
+		{"relative path", []StreamLimitConfig{{Paths: []string{"api/**"}, MaxDuration: "5m"}}, ErrStreamLimitPathInvalid},
+		{"invalid glob", []StreamLimitConfig{{Paths: []string{"/api/["}, MaxDuration: "5m"}}, ErrStreamLimitPathInvalid},
+		{"negative bytes", []StreamLimitConfig{{Paths: []string{"/api/**"}, MaxResponseBytes: -1, MaxDuration: "5m"}}, ErrStreamLimitBytesInvalid},
+		{"invalid duration", []StreamLimitConfig{{Paths: []string{"/api/**"}, MaxDuration: "soon"}}, ErrStreamLimitDurationInvalid},
+		{"zero duration", []StreamLimitConfig{{Paths: []string{"/api/**"}, MaxDuration: "0s"}}, ErrStreamLimitDurationInvalid},
+		{"no limit", []StreamLimitConfig{{Paths: []string{"/api/**"}}}, ErrStreamLimitRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStreamLimits(tt.limits)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("validateStreamLimits() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateStreamLimits() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_StreamLimitFor(t *testing.T) {
+	cfg := &Config{StreamLimits: []StreamLimitConfig{
+		{Paths: []string{"/v1/chat-messages"}, MaxDuration: "1m"},
+		{Paths: []string{"/v1/**"}, MaxResponseBytes: 1024},
+	}}
+
+	if l := cfg.StreamLimitFor("/v1/chat-messages"); l == nil || l.GetMaxDuration() != time.Minute {
+		t.Errorf("StreamLimitFor(/v1/chat-messages) = %+v, want the first limit", l)
+	}
+	if l := cfg.StreamLimitFor("/v1/completion-messages"); l == nil || l.MaxResponseBytes != 1024 {
+		t.Errorf("StreamLimitFor(/v1/completion-messages) = %+v, want the second limit", l)
+	}
+	if l := cfg.StreamLimitFor("/app"); l != nil {
+		t.Errorf("StreamLimitFor(/app) = %+v, want nil", l)
+	}
+}
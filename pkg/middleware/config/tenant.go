@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TenantConfig overrides parts of the base configuration for requests to specific hostnames.
+// Sections that are not set inherit the base (top-level) configuration.
+// Each tenant gets its own KVS namespaces, so sessions and tokens are never shared between tenants.
+// The upstream for each tenant is configured alongside in the proxy section of the same entry.
+type TenantConfig struct {
+	ID              string               `yaml:"id" json:"id"`                             // Unique tenant identifier, appended to KVS namespaces (required)
+	Hosts           []string             `yaml:"hosts" json:"hosts"`                       // Hostnames served by this tenant (required, e.g., ["chat.customer-a.com"])
+	BaseURL         string               `yaml:"base_url" json:"base_url"`                 // Optional: Overrides server.base_url (email links and OAuth2 callback)
+	DefaultRedirect string               `yaml:"default_redirect" json:"default_redirect"` // Optional: Overrides server.default_redirect (landing path after a direct login)
+	Service         *ServiceConfig       `yaml:"service" json:"service"`                   // Optional: Overrides service branding
+	OAuth2          *OAuth2Config        `yaml:"oauth2" json:"oauth2"`                     // Optional: Overrides OAuth2 providers
+	EmailAuth       *EmailAuthConfig     `yaml:"email_auth" json:"email_auth"`             // Optional: Overrides email authentication
+	PasswordAuth    *PasswordAuthConfig  `yaml:"password_auth" json:"password_auth"`       // Optional: Overrides password authentication
+	AccessControl   *AccessControlConfig `yaml:"access_control" json:"access_control"`     // Optional: Overrides access control
+	Forwarding      *ForwardingConfig    `yaml:"forwarding" json:"forwarding"`             // Optional: Overrides user info forwarding
+	Dify            *DifyConfig          `yaml:"dify" json:"dify"`                         // Optional: Overrides the Dify integration (e.g., a different app API key)
+}
+
+// NormalizeHost lowercases a hostname and strips any port (e.g., "Chat.Example.com:443" -> "chat.example.com")
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// ForTenant returns a copy of the configuration with the tenant's overrides applied
+// KVS namespaces are suffixed with the tenant ID to isolate sessions, tokens and email quotas
+func (c *Config) ForTenant(t TenantConfig) *Config {
+	cfg := *c
+	cfg.Tenants = nil
+
+	if t.BaseURL != "" {
+		cfg.Server.BaseURL = t.BaseURL
+	}
+	if t.DefaultRedirect != "" {
+		cfg.Server.DefaultRedirect = t.DefaultRedirect
+	}
+	if t.Service != nil {
+		cfg.Service = *t.Service
+	}
+	if t.OAuth2 != nil {
+		cfg.OAuth2 = *t.OAuth2
+	}
+	if t.EmailAuth != nil {
+		cfg.EmailAuth = *t.EmailAuth
+	}
+	if t.PasswordAuth != nil {
+		cfg.PasswordAuth = *t.PasswordAuth
+	}
+	if t.AccessControl != nil {
+		cfg.AccessControl = *t.AccessControl
+	}
+	if t.Forwarding != nil {
+		cfg.Forwarding = *t.Forwarding
+	}
+	if t.Dify != nil {
+		cfg.Dify = *t.Dify
+	}
+
+	// Isolate tenant data in the KVS
+	// "_" (not ":") keeps tenant keys out of prefix scans of the base namespace on Redis
+	cfg.KVS.Namespaces.SetDefaults()
+	cfg.KVS.Namespaces.Session += "_" + t.ID
+	cfg.KVS.Namespaces.Token += "_" + t.ID
+	cfg.KVS.Namespaces.EmailQuota += "_" + t.ID
+	if c.KVS.Session != nil {
+		sessionCfg := *c.KVS.Session
+		sessionCfg.Namespace = tenantNamespace(sessionCfg.Namespace, "session", t.ID)
+		cfg.KVS.Session = &sessionCfg
+	}
+	if c.KVS.Token != nil {
+		tokenCfg := *c.KVS.Token
+		tokenCfg.Namespace = tenantNamespace(tokenCfg.Namespace, "token", t.ID)
+		cfg.KVS.Token = &tokenCfg
+	}
+	if c.KVS.EmailQuota != nil {
+		emailQuotaCfg := *c.KVS.EmailQuota
+		emailQuotaCfg.Namespace = tenantNamespace(emailQuotaCfg.Namespace, "email_quota", t.ID)
+		cfg.KVS.EmailQuota = &emailQuotaCfg
+	}
+
+	return &cfg
+}
+
+// tenantNamespace appends the tenant ID to a namespace, using fallback when the namespace is empty
+func tenantNamespace(namespace, fallback, tenantID string) string {
+	if namespace == "" {
+		namespace = fallback
+	}
+	return namespace + "_" + tenantID
+}
+
+// validateTenants validates the tenant configuration
+// Each tenant must have a unique ID and hostnames, and its merged configuration must be valid
+func (c *Config) validateTenants() error {
+	if len(c.Tenants) == 0 {
+		return nil
+	}
+
+	verr := NewValidationError()
+	ids := make(map[string]bool)
+	hosts := make(map[string]string)
+
+	for i, t := range c.Tenants {
+		if t.ID == "" {
+			verr.Add(fmt.Errorf("tenants[%d]: %w", i, ErrTenantIDRequired))
+			continue
+		}
+		if ids[t.ID] {
+			verr.Add(fmt.Errorf("tenants[%d]: duplicate tenant id '%s'", i, t.ID))
+		}
+		ids[t.ID] = true
+
+		if len(t.Hosts) == 0 {
+			verr.Add(fmt.Errorf("tenants[%d]: %w", i, ErrTenantHostsRequired))
+		}
+		for _, host := range t.Hosts {
+			normalized := NormalizeHost(host)
+			if other, exists := hosts[normalized]; exists {
+				verr.Add(fmt.Errorf("tenants[%d]: host '%s' is already assigned to tenant '%s'", i, host, other))
+				continue
+			}
+			hosts[normalized] = t.ID
+		}
+
+		if err := c.ForTenant(t).Validate(); err != nil {
+			verr.Add(fmt.Errorf("tenants[%d] (%s): %w", i, t.ID, err))
+		}
+	}
+
+	return verr.ErrorOrNil()
+}
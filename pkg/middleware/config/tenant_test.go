@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"chat.example.com", "chat.example.com"},
+		{"Chat.Example.COM", "chat.example.com"},
+		{"chat.example.com:8443", "chat.example.com"},
+		{"chat.example.com.", "chat.example.com"},
+		{"[::1]:4180", "::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := NormalizeHost(tt.host); got != tt.want {
+				t.Errorf("NormalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ForTenant(t *testing.T) {
+	base := &Config{
+		Service: ServiceConfig{Name: "Base"},
+		Server:  ServerConfig{BaseURL: "https://base.example.com"},
+		OAuth2: OAuth2Config{
+			Providers: []OAuth2Provider{{ID: "google", Type: "google"}},
+		},
+		AccessControl: AccessControlConfig{Emails: []string{"@base.example.com"}},
+		KVS: KVSConfig{
+			Session: &kvs.Config{Type: "redis", Namespace: "sess"},
+		},
+	}
+	tenant := TenantConfig{
+		ID:              "acme",
+		Hosts:           []string{"chat.acme.com"},
+		BaseURL:         "https://chat.acme.com",
+		DefaultRedirect: "/chat",
+		Service:         &ServiceConfig{Name: "Acme Chat"},
+		AccessControl:   &AccessControlConfig{Emails: []string{"@acme.com"}},
+	}
+	base.Tenants = []TenantConfig{tenant}
+
+	cfg := base.ForTenant(tenant)
+
+	if cfg.Service.Name != "Acme Chat" {
+		t.Errorf("Service.Name = %q, want Acme Chat", cfg.Service.Name)
+	}
+	if cfg.Server.BaseURL != "https://chat.acme.com" {
+		t.Errorf("Server.BaseURL = %q, want tenant base URL", cfg.Server.BaseURL)
+	}
+	if cfg.Server.DefaultRedirect != "/chat" {
+		t.Errorf("Server.DefaultRedirect = %q, want tenant default redirect", cfg.Server.DefaultRedirect)
+	}
+	if len(cfg.OAuth2.Providers) != 1 || cfg.OAuth2.Providers[0].ID != "google" {
+		t.Errorf("OAuth2 providers should be inherited from base, got %+v", cfg.OAuth2.Providers)
+	}
+	if len(cfg.AccessControl.Emails) != 1 || cfg.AccessControl.Emails[0] != "@acme.com" {
+		t.Errorf("AccessControl.Emails = %v, want [@acme.com]", cfg.AccessControl.Emails)
+	}
+	if cfg.Tenants != nil {
+		t.Error("Tenant config should not contain nested tenants")
+	}
+
+	// KVS namespaces are isolated per tenant
+	if cfg.KVS.Namespaces.Session != "session_acme" {
+		t.Errorf("Namespaces.Session = %q, want session_acme", cfg.KVS.Namespaces.Session)
+	}
+	if cfg.KVS.Namespaces.Token != "token_acme" {
+		t.Errorf("Namespaces.Token = %q, want token_acme", cfg.KVS.Namespaces.Token)
+	}
+	if cfg.KVS.Session == nil || cfg.KVS.Session.Namespace != "sess_acme" {
+		t.Errorf("Dedicated session KVS namespace not isolated: %+v", cfg.KVS.Session)
+	}
+
+	// Base configuration is not modified
+	if base.Service.Name != "Base" || base.KVS.Session.Namespace != "sess" {
+		t.Error("ForTenant must not modify the base configuration")
+	}
+}
+
+func TestConfig_ValidateTenants(t *testing.T) {
+	newBase := func(tenants ...TenantConfig) *Config {
+		return &Config{
+			Service: ServiceConfig{Name: "Base"},
+			Session: SessionConfig{
+				Cookie: CookieConfig{Secret: "this-is-a-secret-key-with-32-characters"},
+			},
+			PasswordAuth: PasswordAuthConfig{Enabled: true, Password: "secret"},
+			Tenants:      tenants,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		config     *Config
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			name:   "no tenants",
+			config: newBase(),
+		},
+		{
+			name: "valid tenants",
+			config: newBase(
+				TenantConfig{ID: "a", Hosts: []string{"a.example.com"}},
+				TenantConfig{ID: "b", Hosts: []string{"b.example.com"}},
+			),
+		},
+		{
+			name:    "missing ID",
+			config:  newBase(TenantConfig{Hosts: []string{"a.example.com"}}),
+			wantErr: ErrTenantIDRequired,
+		},
+		{
+			name:    "missing hosts",
+			config:  newBase(TenantConfig{ID: "a"}),
+			wantErr: ErrTenantHostsRequired,
+		},
+		{
+			name: "duplicate ID",
+			config: newBase(
+				TenantConfig{ID: "a", Hosts: []string{"a.example.com"}},
+				TenantConfig{ID: "a", Hosts: []string{"b.example.com"}},
+			),
+			wantErrMsg: "duplicate tenant id",
+		},
+		{
+			name: "duplicate host",
+			config: newBase(
+				TenantConfig{ID: "a", Hosts: []string{"chat.example.com"}},
+				TenantConfig{ID: "b", Hosts: []string{"Chat.Example.com"}},
+			),
+			wantErrMsg: "already assigned",
+		},
+		{
+			name: "invalid tenant override",
+			config: newBase(TenantConfig{
+				ID:           "a",
+				Hosts:        []string{"a.example.com"},
+				Service:      &ServiceConfig{Name: ""},
+				PasswordAuth: &PasswordAuthConfig{Enabled: true, Password: "secret"},
+			}),
+			wantErr: ErrServiceNameRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == nil && tt.wantErrMsg == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() expected error, got nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErrMsg != "" && !strings.Contains(err.Error(), tt.wantErrMsg) {
+				t.Errorf("Validate() error = %v, want message containing %q", err, tt.wantErrMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Card styles supported by ThemeConfig.CardStyle
+const (
+	CardStyleElevated = "elevated" // Border and shadow (default)
+	CardStyleFlat     = "flat"     // No border and no shadow
+	CardStyleBordered = "bordered" // Border without shadow
+)
+
+// ThemeConfig contains theming tokens for the authentication pages
+// Values are injected as CSS variable overrides after the embedded stylesheet
+type ThemeConfig struct {
+	PrimaryColor      string `yaml:"primary_color" json:"primary_color"`             // Optional: Primary color for buttons and focus rings (e.g., "#0ea5e9")
+	PrimaryHoverColor string `yaml:"primary_hover_color" json:"primary_hover_color"` // Optional: Hover color for primary buttons (default: primary_color)
+	BorderRadius      string `yaml:"border_radius" json:"border_radius"`             // Optional: Border radius for cards, buttons and inputs (e.g., "12px")
+	FontFamily        string `yaml:"font_family" json:"font_family"`                 // Optional: Font family for the page body (e.g., "'Inter', sans-serif")
+	BackgroundImage   string `yaml:"background_image" json:"background_image"`       // Optional: Background image URL for the page body
+	CardStyle         string `yaml:"card_style" json:"card_style"`                   // Optional: Card style ("elevated", "flat", "bordered", default: "elevated")
+}
+
+// IsEmpty returns true if no theming token is configured
+func (t ThemeConfig) IsEmpty() bool {
+	return t == ThemeConfig{}
+}
+
+// Validate checks that every theming token is safe to embed in a stylesheet
+func (t ThemeConfig) Validate() error {
+	verr := NewValidationError()
+
+	values := []struct {
+		name  string
+		value string
+	}{
+		{"primary_color", t.PrimaryColor},
+		{"primary_hover_color", t.PrimaryHoverColor},
+		{"border_radius", t.BorderRadius},
+		{"font_family", t.FontFamily},
+	}
+	for _, v := range values {
+		if !IsSafeCSSValue(v.value) {
+			verr.Add(fmt.Errorf("service.theme.%s: %w", v.name, ErrThemeValueInvalid))
+		}
+	}
+
+	// The background image is embedded in url("..."), so quotes and backslashes are not allowed either
+	if !IsSafeCSSValue(t.BackgroundImage) || strings.ContainsAny(t.BackgroundImage, `"'\() `) {
+		verr.Add(fmt.Errorf("service.theme.background_image: %w", ErrThemeValueInvalid))
+	}
+
+	switch t.CardStyle {
+	case "", CardStyleElevated, CardStyleFlat, CardStyleBordered:
+	default:
+		verr.Add(fmt.Errorf("service.theme.card_style: %w", ErrThemeCardStyleInvalid))
+	}
+
+	return verr.ErrorOrNil()
+}
+
+// IsSafeCSSValue returns true if the value cannot break out of a CSS declaration
+// Empty values are considered safe
+func IsSafeCSSValue(value string) bool {
+	if strings.ContainsAny(value, ";{}<>\\\n\r") {
+		return false
+	}
+	return !strings.Contains(value, "/*")
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestThemeConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		theme   ThemeConfig
+		wantErr error
+	}{
+		{"empty", ThemeConfig{}, nil},
+		{
+			"valid",
+			ThemeConfig{
+				PrimaryColor:      "#0ea5e9",
+				PrimaryHoverColor: "rgb(2, 132, 199)",
+				BorderRadius:      "12px",
+				FontFamily:        "'Inter', sans-serif",
+				BackgroundImage:   "https://example.com/bg.png",
+				CardStyle:         CardStyleBordered,
+			},
+			nil,
+		},
+		{"declaration injection", ThemeConfig{PrimaryColor: "red; color: blue"}, ErrThemeValueInvalid},
+		{"rule injection", ThemeConfig{FontFamily: "serif } body { display: none"}, ErrThemeValueInvalid},
+		{"markup injection", ThemeConfig{BorderRadius: "4px</style>"}, ErrThemeValueInvalid},
+		{"comment", ThemeConfig{PrimaryColor: "red /* x */"}, ErrThemeValueInvalid},
+		{"background url breakout", ThemeConfig{BackgroundImage: `https://example.com/a.png") , url("x`}, ErrThemeValueInvalid},
+		{"unknown card style", ThemeConfig{CardStyle: "glass"}, ErrThemeCardStyleInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.theme.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_Theme(t *testing.T) {
+	cfg := &Config{
+		Service: ServiceConfig{
+			Name:  "Test",
+			Theme: ThemeConfig{PrimaryColor: "red;}"},
+		},
+		Session:   SessionConfig{Cookie: CookieConfig{Secret: "this-is-a-very-long-secret-key-for-testing"}},
+		EmailAuth: EmailAuthConfig{Enabled: true},
+	}
+
+	if err := cfg.Validate(); !errors.Is(err, ErrThemeValueInvalid) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrThemeValueInvalid)
+	}
+}
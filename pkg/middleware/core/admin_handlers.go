@@ -0,0 +1,526 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/email"
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+const (
+	authMethodEmail    = "email"    // Auth method ID for email authentication
+	authMethodPassword = "password" // Auth method ID for password authentication
+)
+
+// maxDryRunBodyBytes limits the sample user info of the forwarding dry run
+const maxDryRunBodyBytes = 1 << 20
+
+// maxAdminBodyBytes limits the JSON bodies of the other admin endpoints
+const maxAdminBodyBytes = 64 << 10
+
+var (
+	// ErrUnknownAuthMethod is returned when an auth method ID does not match any configured method
+	ErrUnknownAuthMethod = errors.New("unknown authentication method")
+
+	// ErrAllowlistNotEditable is returned when the authorization checker has no editable email allowlist
+	ErrAllowlistNotEditable = errors.New("allowlist is not editable")
+
+	// ErrAllowlistEntryInvalid is returned for allowlist entries that are neither an email nor an @domain
+	ErrAllowlistEntryInvalid = errors.New("invalid allowlist entry")
+)
+
+// editableAllowlist is implemented by authorization checkers whose email allowlist can be replaced (authz.EmailChecker)
+type editableAllowlist interface {
+	Emails() []string
+	SetEmails(entries []string)
+}
+
+// AuthMethodStatus represents the runtime status of an authentication method
+type AuthMethodStatus struct {
+	ID      string `json:"id"`      // Provider ID, "email" or "password"
+	Type    string `json:"type"`    // Provider type ("google", "github", ...), "email" or "password"
+	Enabled bool   `json:"enabled"` // False when disabled at runtime via the admin API
+}
+
+// AuthMethods returns the status of all configured authentication methods
+// OAuth2 providers are listed in configuration order, followed by email and password auth
+func (m *Middleware) AuthMethods() []AuthMethodStatus {
+	var methods []AuthMethodStatus
+
+	if m.oauthManager != nil {
+		for _, p := range m.config.OAuth2.Providers {
+			if _, err := m.oauthManager.GetProvider(p.ID); err != nil {
+				continue // Disabled in config or failed to register
+			}
+			methods = append(methods, AuthMethodStatus{ID: p.ID, Type: p.Type, Enabled: m.isAuthMethodEnabled(p.ID)})
+		}
+	}
+	if m.emailHandler != nil {
+		methods = append(methods, AuthMethodStatus{ID: authMethodEmail, Type: authMethodEmail, Enabled: m.isAuthMethodEnabled(authMethodEmail)})
+	}
+	if m.passwordHandler != nil {
+		methods = append(methods, AuthMethodStatus{ID: authMethodPassword, Type: authMethodPassword, Enabled: m.isAuthMethodEnabled(authMethodPassword)})
+	}
+
+	return methods
+}
+
+// SetAuthMethodEnabled enables or disables an authentication method at runtime
+// The change takes effect immediately, on all instances sharing a Redis session KVS,
+// and lasts until the configuration is reloaded
+func (m *Middleware) SetAuthMethodEnabled(id string, enabled bool) error {
+	if err := m.setAuthMethodEnabled(id, enabled); err != nil {
+		return err
+	}
+	m.publishEvent(context.Background(), eventAuthMethod, authMethodEvent{ID: id, Enabled: enabled})
+	return nil
+}
+
+// setAuthMethodEnabled enables or disables an authentication method on this instance
+func (m *Middleware) setAuthMethodEnabled(id string, enabled bool) error {
+	found := false
+	for _, method := range m.AuthMethods() {
+		if method.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrUnknownAuthMethod
+	}
+
+	m.disabledAuthMethodsMu.Lock()
+	defer m.disabledAuthMethodsMu.Unlock()
+	if enabled {
+		delete(m.disabledAuthMethods, id)
+	} else {
+		m.disabledAuthMethods[id] = true
+	}
+	m.loginPages.reset()
+	return nil
+}
+
+// Allowlist returns the entries of the email allowlist (access_control.emails, or as replaced via the admin API)
+// ok is false when the authorization checker has no editable allowlist.
+func (m *Middleware) Allowlist() (entries []string, ok bool) {
+	allowlist, ok := m.authzChecker.(editableAllowlist)
+	if !ok {
+		return nil, false
+	}
+	return allowlist.Emails(), true
+}
+
+// SetAllowlist replaces the email allowlist at runtime, on all instances sharing a Redis session KVS
+// Entries are email addresses, @domains or email hashes (privacy.minimize); the change applies to
+// sign-ins from now on (revoke the sessions of removed users with RevokeSessions) and lasts until the
+// configuration is reloaded.
+// A nil entries restores access_control.emails.
+func (m *Middleware) SetAllowlist(entries []string) error {
+	restore := entries == nil
+	if restore {
+		entries = m.config.AccessControl.Emails
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasPrefix(entry, "@") && !isValidEmail(entry) && !m.isAllowlistHash(entry) {
+			return fmt.Errorf("%w: %q", ErrAllowlistEntryInvalid, entry)
+		}
+	}
+	if err := m.setAllowlist(entries); err != nil {
+		return err
+	}
+
+	event := allowlistEvent{Emails: entries, Restore: restore}
+	if restore {
+		event.Emails = nil
+	}
+	m.publishEvent(context.Background(), eventAllowlist, event)
+	return nil
+}
+
+// setAllowlist replaces the email allowlist on this instance
+func (m *Middleware) setAllowlist(entries []string) error {
+	allowlist, ok := m.authzChecker.(editableAllowlist)
+	if !ok {
+		return ErrAllowlistNotEditable
+	}
+	allowlist.SetEmails(entries)
+	return nil
+}
+
+// RevokeSessions signs out a user: their sessions are deleted from the session KVS, and sessions
+// of the email created until now are rejected by all instances sharing a Redis session KVS,
+// including ones still served from an instance's session cache. Returns the number of deleted sessions.
+func (m *Middleware) RevokeSessions(ctx context.Context, email string) (int, error) {
+	// With privacy.minimize sessions hold the hash of the email (which may also be given directly)
+	email = m.sessionEmail(email)
+	revokedAt := m.clock.Now()
+	m.recordRevocation(email, revokedAt)
+	m.publishEvent(ctx, eventSessionsRevoked, sessionsRevokedEvent{Email: email, RevokedAt: revokedAt})
+
+	sessions, err := session.List(kvs.Uncached(m.sessionStore))
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, sess := range sessions {
+		if sess.ID == "" || !strings.EqualFold(sess.Email, email) {
+			continue
+		}
+		if err := session.Delete(m.sessionStore, sess.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// isAuthMethodEnabled reports whether an authentication method has not been disabled at runtime
+func (m *Middleware) isAuthMethodEnabled(id string) bool {
+	m.disabledAuthMethodsMu.RLock()
+	defer m.disabledAuthMethodsMu.RUnlock()
+	return !m.disabledAuthMethods[id]
+}
+
+// handleAdmin handles the admin API (/_auth/admin/...)
+// Requires "Authorization: Bearer <server.admin_token>"; the API is disabled when no token is configured
+//
+// Endpoints:
+//   - GET  /_auth/admin/config                    Effective configuration (secrets redacted), providers and rule checks
+//   - GET  /_auth/admin/auth-methods              List authentication methods and their status
+//   - POST /_auth/admin/auth-methods/{id}/enable  Enable a provider, "email" or "password"
+//   - POST /_auth/admin/auth-methods/{id}/disable Disable a provider, "email" or "password"
+//   - GET  /_auth/admin/providers/check           Results of the last OAuth2 provider self-test (runs it if none)
+//   - POST /_auth/admin/providers/check           Run the OAuth2 provider self-test now
+//   - POST /_auth/admin/forwarding/dry-run        Show the forwarding output for the sample user info in the body
+//   - GET  /_auth/admin/allowlist                 Email allowlist entries
+//   - PUT  /_auth/admin/allowlist                 Replace the allowlist with {"emails": [...]}
+//   - DELETE /_auth/admin/allowlist               Restore access_control.emails
+//   - GET  /_auth/admin/announcement              Announcement banner of the auth pages
+//   - PUT  /_auth/admin/announcement              Replace the banner with {"message": "...", "severity": ..., ...}
+//   - DELETE /_auth/admin/announcement            Restore the configured announcement
+//   - POST /_auth/admin/sessions/revoke           Sign out the user {"email": "..."} everywhere
+//   - GET  /_auth/admin/sessions/export           Encrypted archive of the live sessions (see session_transfer.go)
+//   - POST /_auth/admin/sessions/import           Store the sessions of an exported archive (the body)
+//   - GET  /_auth/admin/jobs                      Job leadership of this instance and state of the periodic jobs
+//   - GET  /_auth/admin/login-stats[?days=30]     Daily logins, unique users, failures and latency per provider
+//   - GET  /_auth/admin/email-tokens[?email=]     Outstanding (unconsumed) login links, of one address or all
+//   - DELETE /_auth/admin/email-tokens?email=     Revoke the login links and OTPs sent to an address
+//   - DELETE /_auth/admin/email-tokens/{id}       Revoke one login link and its OTP
+//
+// Changes are broadcast to the instances sharing a Redis session KVS (see events.go).
+func (m *Middleware) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if m.config.Server.AdminToken == "" {
+		writeAPIError(w, http.StatusNotFound, "Not Found", "Admin API is not enabled")
+		return
+	}
+
+	if !m.isAdminAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeAPIError(w, http.StatusUnauthorized, "Unauthorized", "Valid admin token is required")
+		return
+	}
+
+	prefix := m.config.Server.GetAuthPathPrefix()
+	path := extractPathParam(r.URL.Path, joinAuthPath(prefix, "/admin/"))
+	parts := strings.Split(path, "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "config":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is accepted")
+			return
+		}
+		dump, err := m.ConfigDump()
+		if err != nil {
+			m.logger.Error("Failed to dump configuration", "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to dump configuration")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, dump)
+
+	case len(parts) == 1 && parts[0] == "auth-methods":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is accepted")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, m.AuthMethods())
+
+	case len(parts) == 3 && parts[0] == "auth-methods" && (parts[2] == "enable" || parts[2] == "disable"):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is accepted")
+			return
+		}
+		id, enabled := parts[1], parts[2] == "enable"
+		if err := m.SetAuthMethodEnabled(id, enabled); err != nil {
+			writeAPIError(w, http.StatusNotFound, "Not Found", err.Error()+": "+id)
+			return
+		}
+		m.logger.Info("Authentication method changed via admin API", "id", id, "enabled", enabled)
+		writeAPIJSON(w, http.StatusOK, AuthMethodStatus{ID: id, Type: m.authMethodType(id), Enabled: enabled})
+
+	case len(parts) == 2 && parts[0] == "providers" && parts[1] == "check":
+		var checks []oauth2.ProviderCheck
+		switch r.Method {
+		case http.MethodGet:
+			checks = m.ProviderChecks()
+			if checks == nil {
+				checks = m.CheckProviders(r.Context())
+			}
+		case http.MethodPost:
+			checks = m.CheckProviders(r.Context())
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET, POST are accepted")
+			return
+		}
+		if checks == nil {
+			checks = []oauth2.ProviderCheck{}
+		}
+		writeAPIJSON(w, http.StatusOK, checks)
+
+	case len(parts) == 2 && parts[0] == "forwarding" && parts[1] == "dry-run":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is accepted")
+			return
+		}
+		dryRunner, ok := m.forwarder.(forwarding.DryRunner)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Not Found", "No forwarding fields are configured")
+			return
+		}
+		var userInfo forwarding.UserInfo
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDryRunBodyBytes)).Decode(&userInfo); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", "Body must be user info JSON: "+err.Error())
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, dryRunner.DryRun(&userInfo))
+
+	case len(parts) == 1 && parts[0] == "jobs":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is accepted")
+			return
+		}
+		leader, statuses := m.JobStatuses()
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+			"instance": m.jobs.ID(),
+			"leader":   leader,
+			"jobs":     statuses,
+		})
+
+	case len(parts) == 1 && parts[0] == "login-stats":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is accepted")
+			return
+		}
+		days := defaultLoginStatsDays
+		if v := r.URL.Query().Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxLoginStatsDays {
+				writeAPIError(w, http.StatusBadRequest, "Bad Request", fmt.Sprintf("days must be between 1 and %d", maxLoginStatsDays))
+				return
+			}
+			days = n
+		}
+		report, err := m.LoginStats(r.Context(), days)
+		if err != nil {
+			m.logger.Error("Failed to read login stats", "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to read login stats")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, report)
+
+	case (len(parts) == 1 || len(parts) == 2) && parts[0] == "email-tokens":
+		m.handleAdminEmailTokens(w, r, parts[1:])
+
+	case len(parts) == 1 && parts[0] == "allowlist":
+		m.handleAdminAllowlist(w, r)
+
+	case len(parts) == 1 && parts[0] == "announcement":
+		m.handleAdminAnnouncement(w, r)
+
+	case len(parts) == 2 && parts[0] == "sessions" && parts[1] == "revoke":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is accepted")
+			return
+		}
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&body); err != nil || (!isValidEmail(body.Email) && !m.isAllowlistHash(body.Email)) {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", `Body must be {"email": "<address>"}`)
+			return
+		}
+		deleted, err := m.RevokeSessions(r.Context(), body.Email)
+		if err != nil {
+			m.logger.Error("Failed to revoke sessions", "email", m.logEmail(body.Email), "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to delete sessions; new requests with them are rejected anyway")
+			return
+		}
+		m.logger.Info("Sessions revoked via admin API", "email", m.logEmail(body.Email), "deleted", deleted)
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"email": body.Email, "deleted": deleted})
+
+	case len(parts) == 2 && parts[0] == "sessions" && parts[1] == "export":
+		m.handleAdminSessionExport(w, r)
+
+	case len(parts) == 2 && parts[0] == "sessions" && parts[1] == "import":
+		m.handleAdminSessionImport(w, r)
+
+	default:
+		writeAPIError(w, http.StatusNotFound, "Not Found", "Unknown admin endpoint")
+	}
+}
+
+// handleAdminEmailTokens handles /_auth/admin/email-tokens and /_auth/admin/email-tokens/{id}
+func (m *Middleware) handleAdminEmailTokens(w http.ResponseWriter, r *http.Request, id []string) {
+	if m.emailHandler == nil {
+		writeAPIError(w, http.StatusNotFound, "Not Found", "Email authentication is not enabled")
+		return
+	}
+	address := r.URL.Query().Get("email")
+
+	switch {
+	case len(id) == 0 && r.Method == http.MethodGet:
+		tokens, err := m.emailHandler.OutstandingTokens(r.Context(), address)
+		if err != nil {
+			m.logger.Error("Failed to list email tokens", "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to list email tokens")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+
+	case len(id) == 0 && r.Method == http.MethodDelete:
+		if !isValidEmail(address) {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", "The email query parameter is required")
+			return
+		}
+		revoked, err := m.emailHandler.RevokeTokens(r.Context(), address)
+		if err != nil {
+			m.logger.Error("Failed to revoke email tokens", "email", m.logEmail(address), "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to revoke email tokens")
+			return
+		}
+		m.logger.Info("Email tokens revoked via admin API", "email", m.logEmail(address), "revoked", revoked)
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"revoked": revoked})
+
+	case len(id) == 1 && r.Method == http.MethodDelete:
+		err := m.emailHandler.RevokeToken(r.Context(), id[0])
+		if errors.Is(err, email.ErrTokenNotFound) {
+			writeAPIError(w, http.StatusNotFound, "Not Found", "No outstanding email token with this ID")
+			return
+		} else if err != nil {
+			m.logger.Error("Failed to revoke email token", "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to revoke email token")
+			return
+		}
+		m.logger.Info("Email token revoked via admin API", "id", id[0])
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"revoked": 1})
+
+	default:
+		allow := "GET, DELETE"
+		if len(id) == 1 {
+			allow = "DELETE"
+		}
+		w.Header().Set("Allow", allow)
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only "+allow+" are accepted")
+	}
+}
+
+// handleAdminAllowlist handles /_auth/admin/allowlist (GET, PUT, DELETE)
+func (m *Middleware) handleAdminAllowlist(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.Allowlist(); !ok {
+		writeAPIError(w, http.StatusNotFound, "Not Found", ErrAllowlistNotEditable.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Emails []string `json:"emails"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", `Body must be {"emails": [...]}: `+err.Error())
+			return
+		}
+		// An empty allowlist lets every authenticated user in: require DELETE to go back to the configuration
+		if len(body.Emails) == 0 {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", "emails must not be empty; DELETE restores access_control.emails")
+			return
+		}
+		if err := m.SetAllowlist(body.Emails); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", err.Error())
+			return
+		}
+		m.logger.Info("Allowlist replaced via admin API", "entries", len(body.Emails))
+	case http.MethodDelete:
+		if err := m.SetAllowlist(nil); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", err.Error())
+			return
+		}
+		m.logger.Info("Allowlist restored via admin API")
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET, PUT, DELETE are accepted")
+		return
+	}
+
+	entries, _ := m.Allowlist()
+	if entries == nil {
+		entries = []string{}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string][]string{"emails": entries})
+}
+
+// isAdminAuthorized checks the bearer token using constant-time comparison
+func (m *Middleware) isAdminAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(m.config.Server.AdminToken)) == 1
+}
+
+// authMethodType returns the type of a configured authentication method
+func (m *Middleware) authMethodType(id string) string {
+	for _, method := range m.AuthMethods() {
+		if method.ID == id {
+			return method.Type
+		}
+	}
+	return ""
+}
+
+// writeAPIJSON writes a JSON response for the JSON APIs (admin, metadata)
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes a JSON error response for the JSON APIs (admin, metadata)
+func writeAPIError(w http.ResponseWriter, status int, message, detail string) {
+	writeAPIJSON(w, status, map[string]string{
+		"error":  message,
+		"detail": detail,
+	})
+}
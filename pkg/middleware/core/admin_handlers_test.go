@@ -0,0 +1,553 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/email"
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/jobs"
+)
+
+const testAdminToken = "admin-token-with-at-least-32-characters"
+
+// newAdminTestMiddleware creates a middleware with two OAuth2 providers and the admin API enabled
+func newAdminTestMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	cfg := newTestConfig()
+	cfg.Server.AdminToken = testAdminToken
+	cfg.OAuth2.Providers = []config.OAuth2Provider{
+		{ID: "google", Type: "google"},
+		{ID: "github", Type: "github"},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+	mw.oauthManager.AddProvider(&mockProvider{name: "google"})
+	mw.oauthManager.AddProvider(&mockProvider{name: "github"})
+	return mw
+}
+
+func adminRequest(method, path, token string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAdmin_Authorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		wantStatus int
+	}{
+		{"admin API disabled", "", testAdminToken, http.StatusNotFound},
+		{"missing token", testAdminToken, "", http.StatusUnauthorized},
+		{"wrong token", testAdminToken, "wrong-token", http.StatusUnauthorized},
+		{"valid token", testAdminToken, testAdminToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Server.AdminToken = tt.adminToken
+			mw, _ := newTestMiddleware(t, cfg)
+
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/auth-methods", tt.token))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
+
+func TestAdmin_ListAuthMethods(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/auth-methods", testAdminToken))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var methods []AuthMethodStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &methods); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(methods) != 2 {
+		t.Fatalf("Expected 2 auth methods, got %d", len(methods))
+	}
+	// Configuration order is preserved
+	if methods[0].ID != "google" || methods[1].ID != "github" {
+		t.Errorf("Unexpected method order: %+v", methods)
+	}
+	for _, m := range methods {
+		if !m.Enabled {
+			t.Errorf("Method %s should be enabled by default", m.ID)
+		}
+	}
+}
+
+func TestAdmin_DisableAndEnableProvider(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	// Disable google
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/auth-methods/google/disable", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Disable status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Login page no longer shows google
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/login", nil))
+	body := rec.Body.String()
+	if strings.Contains(body, "/_auth/oauth2/start/google") {
+		t.Error("Disabled provider should not be shown on login page")
+	}
+	if !strings.Contains(body, "/_auth/oauth2/start/github") {
+		t.Error("Enabled provider should still be shown on login page")
+	}
+
+	// OAuth2 start is rejected for the disabled provider
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("OAuth2 start status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Re-enable google
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/auth-methods/google/enable", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Enable status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/login", nil))
+	if !strings.Contains(rec.Body.String(), "/_auth/oauth2/start/google") {
+		t.Error("Re-enabled provider should be shown on login page")
+	}
+}
+
+func TestAdmin_DisableDuringSignIn(t *testing.T) {
+	hasSession := func(rec *httptest.ResponseRecorder) bool {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "_test_session" && c.Value != "" {
+				return true
+			}
+		}
+		return false
+	}
+	setEnabled := func(t *testing.T, mw *Middleware, id, action string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/auth-methods/"+id+"/"+action, testAdminToken))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d, want %d", action, id, rec.Code, http.StatusOK)
+		}
+	}
+
+	t.Run("OAuth2 callback", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Server.AdminToken = testAdminToken
+		cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "google", Type: "google"}}
+		mw, _ := newTestMiddleware(t, cfg)
+		mw.authzChecker = authz.NewEmailChecker(cfg.AccessControl)
+		mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+		t.Cleanup(mockProvider.Close)
+		mw.oauthManager.AddProvider(mockProvider)
+
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil))
+		started := rec.Result().Cookies()
+		callback := func() *httptest.ResponseRecorder {
+			var state string
+			for _, c := range started {
+				if c.Name == "oauth_state" {
+					state = c.Value
+				}
+			}
+			req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?state="+state+"&code=test-auth-code", nil)
+			for _, c := range started {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// Disabled between the start and the callback
+		setEnabled(t, mw, "google", "disable")
+		if rec := callback(); rec.Code != http.StatusServiceUnavailable || hasSession(rec) {
+			t.Errorf("Callback status = %d, want %d without a session", rec.Code, http.StatusServiceUnavailable)
+		}
+
+		setEnabled(t, mw, "google", "enable")
+		if rec := callback(); rec.Code != http.StatusFound || !hasSession(rec) {
+			t.Errorf("Callback status = %d, want a sign-in once enabled again: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("email link and OTP", func(t *testing.T) {
+		mw := newAdminTestMiddleware(t)
+		mw.authzChecker = authz.NewEmailChecker(mw.config.AccessControl)
+		mockSender := &mockEmailSender{}
+		mw.emailHandler = createEmailHandler(t, mockSender, config.AccessControlConfig{}, 10)
+		if err := mw.emailHandler.SendLoginLink("user@example.com", "/", "en"); err != nil {
+			t.Fatalf("SendLoginLink() error = %v", err)
+		}
+		token := extractTokenFromEmail(mockSender.sentEmails[0])
+		otp := extractOTPFromEmail(mockSender.sentEmails[0])
+		verifyLink := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/email/verify?token="+token, nil))
+			return rec
+		}
+
+		// Disabled between the send and the verification
+		setEnabled(t, mw, authMethodEmail, "disable")
+		if rec := verifyLink(); rec.Code != http.StatusServiceUnavailable || hasSession(rec) {
+			t.Errorf("Link verification status = %d, want %d without a session", rec.Code, http.StatusServiceUnavailable)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/_auth/email/verify-otp", strings.NewReader(url.Values{"otp": {otp}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable || hasSession(rec) {
+			t.Errorf("OTP verification status = %d, want %d without a session", rec.Code, http.StatusServiceUnavailable)
+		}
+
+		// The link was not used up while disabled
+		setEnabled(t, mw, authMethodEmail, "enable")
+		if rec := verifyLink(); rec.Code != http.StatusFound || !hasSession(rec) {
+			t.Errorf("Link verification status = %d, want a sign-in once enabled again", rec.Code)
+		}
+	})
+}
+
+func TestAdmin_InvalidRequests(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"unknown method ID", http.MethodPost, "/_auth/admin/auth-methods/facebook/disable", http.StatusNotFound},
+		{"email not configured", http.MethodPost, "/_auth/admin/auth-methods/email/disable", http.StatusNotFound},
+		{"GET on action", http.MethodGet, "/_auth/admin/auth-methods/google/disable", http.StatusMethodNotAllowed},
+		{"POST on list", http.MethodPost, "/_auth/admin/auth-methods", http.StatusMethodNotAllowed},
+		{"unknown action", http.MethodPost, "/_auth/admin/auth-methods/google/toggle", http.StatusNotFound},
+		{"unknown endpoint", http.MethodGet, "/_auth/admin/unknown", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, adminRequest(tt.method, tt.path, testAdminToken))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAdmin_ProviderCheck(t *testing.T) {
+	var probes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Server.AdminToken = testAdminToken
+	cfg.Server.BaseURL = "https://chat.example.com"
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "sso", Type: "custom"}}
+	mw, _ := newTestMiddleware(t, cfg)
+	mw.oauthManager.AddProvider(oauth2.NewCustomProvider(
+		"sso", "client", "wrong-secret", "https://chat.example.com/_auth/oauth2/callback",
+		server.URL+"/authorize", server.URL+"/token", server.URL+"/userinfo", nil, false,
+	))
+
+	// GET runs the check when none has run yet
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/providers/check", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var checks []oauth2.ProviderCheck
+	if err := json.Unmarshal(rec.Body.Bytes(), &checks); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(checks) != 1 {
+		t.Fatalf("Got %d checks, want 1", len(checks))
+	}
+	check := checks[0]
+	if check.Provider != "sso" || !check.Reachable || check.Status != http.StatusBadRequest {
+		t.Errorf("Check = %+v, want reachable sso with status 400", check)
+	}
+	if len(check.Hints) != 1 || !strings.Contains(check.Hints[0], "client credentials") {
+		t.Errorf("Hints = %v, want the client credentials hint", check.Hints)
+	}
+
+	// GET returns the stored result, POST runs the check again
+	mw.ServeHTTP(httptest.NewRecorder(), adminRequest(http.MethodGet, "/_auth/admin/providers/check", testAdminToken))
+	if probes.Load() != 1 {
+		t.Errorf("Probes after second GET = %d, want 1", probes.Load())
+	}
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/providers/check", testAdminToken))
+	if rec.Code != http.StatusOK || probes.Load() != 2 {
+		t.Errorf("POST: status = %d, probes = %d; want 200 and 2", rec.Code, probes.Load())
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/providers/check", testAdminToken))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAdmin_ForwardingDryRun(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	// Without forwarding fields there is nothing to show
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/forwarding/dry-run", testAdminToken))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Status without forwarder = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	mw.forwarder = newTestForwarder(t, &config.ForwardingConfig{
+		Fields: []config.ForwardingField{
+			{Path: "extra.preferred_username", Header: "X-User"},
+			{Path: "email", Header: "X-User"},
+		},
+	})
+
+	req := adminRequest(http.MethodPost, "/_auth/admin/forwarding/dry-run", testAdminToken)
+	req.Body = io.NopCloser(strings.NewReader(`{"email":"alice@example.com","provider":"google"}`))
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var result forwarding.DryRunResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if result.Headers["X-User"] != "alice@example.com" || len(result.Fields) != 2 || result.Fields[0].Error == "" {
+		t.Errorf("DryRun = %+v, want X-User from the email fallback", result)
+	}
+
+	req = adminRequest(http.MethodPost, "/_auth/admin/forwarding/dry-run", testAdminToken)
+	req.Body = io.NopCloser(strings.NewReader(`not json`))
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status for invalid JSON = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_Jobs(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	ran := make(chan struct{})
+	mw.AddJob(jobs.Job{Name: "cleanup", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(ran)
+		return nil
+	}})
+
+	// The only instance on a memory KVS leads
+	mw.StartJobs()
+	<-ran
+	mw.StopJobs()
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/jobs", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var result struct {
+		Instance string        `json:"instance"`
+		Leader   bool          `json:"leader"`
+		Jobs     []jobs.Status `json:"jobs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	// The builtin login stats flush is listed first
+	if result.Instance == "" || result.Leader || len(result.Jobs) != 2 || result.Jobs[1].Name != "cleanup" || result.Jobs[1].Runs != 1 {
+		t.Errorf("Jobs = %+v, want one run of cleanup and no leadership after StopJobs", result)
+	}
+}
+
+func TestAdmin_EmailTokens(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	// Without email authentication there are no tokens to audit
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/email-tokens", testAdminToken))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Status without email auth = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	mw.emailHandler = createEmailHandler(t, &mockEmailSender{}, config.AccessControlConfig{}, 10)
+	for _, address := range []string{"alice@example.com", "alice@example.com", "bob@example.com"} {
+		if err := mw.emailHandler.SendLoginLink(address, "/", "en"); err != nil {
+			t.Fatalf("SendLoginLink() error = %v", err)
+		}
+	}
+
+	listTokens := func(query string) []email.TokenInfo {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/email-tokens"+query, testAdminToken))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("List status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var result struct {
+			Tokens []email.TokenInfo `json:"tokens"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		return result.Tokens
+	}
+	if tokens := listTokens("?email=alice@example.com"); len(tokens) != 2 {
+		t.Fatalf("alice's tokens = %d, want 2", len(tokens))
+	}
+
+	// Revoke bob's link by ID, then all of alice's
+	bob := listTokens("?email=bob@example.com")
+	if len(bob) != 1 {
+		t.Fatalf("bob's tokens = %d, want 1", len(bob))
+	}
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/email-tokens/"+bob[0].ID, testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Revoke by ID status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/email-tokens/"+bob[0].ID, testAdminToken))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Revoke of a revoked ID status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/email-tokens?email=alice@example.com", testAdminToken))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"revoked":2`) {
+		t.Errorf("Revoke by email = %d %s, want 2 revoked", rec.Code, rec.Body.String())
+	}
+	if tokens := listTokens(""); len(tokens) != 0 {
+		t.Errorf("Outstanding tokens after revoke = %d, want 0", len(tokens))
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/email-tokens", testAdminToken))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Revoke without email status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_SessionExportImport(t *testing.T) {
+	source := newAdminTestMiddleware(t)
+	aliceID := storeTestSession(t, source.sessionStore, "alice@example.com")
+	storeTestSession(t, source.sessionStore, "bob@example.com")
+
+	rec := httptest.NewRecorder()
+	source.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/sessions/export", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Export status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-Session-Count"); got != "2" {
+		t.Errorf("X-Session-Count = %q, want 2", got)
+	}
+	archive := rec.Body.Bytes()
+	if strings.Contains(string(archive), "alice@example.com") {
+		t.Error("Archive should be encrypted")
+	}
+
+	importArchive := func(mw *Middleware) *httptest.ResponseRecorder {
+		req := adminRequest(http.MethodPost, "/_auth/admin/sessions/import", testAdminToken)
+		req.Body = io.NopCloser(strings.NewReader(string(archive)))
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	target := newAdminTestMiddleware(t)
+	rec = importArchive(target)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"imported":2`) {
+		t.Fatalf("Import = %d %s, want 2 imported sessions", rec.Code, rec.Body.String())
+	}
+	sess, err := session.Get(target.sessionStore, aliceID)
+	if err != nil || sess.Email != "alice@example.com" {
+		t.Errorf("Imported session = %v, %v; want alice's session", sess, err)
+	}
+
+	rec = importArchive(target)
+	if !strings.Contains(rec.Body.String(), `"imported":0,"skipped":2`) {
+		t.Errorf("Second import = %s, want existing sessions skipped", rec.Body.String())
+	}
+
+	cfg := newTestConfig()
+	cfg.Server.AdminToken = testAdminToken
+	cfg.Session.Cookie.Secret = "another-secret-key-with-32-characters"
+	other, _ := newTestMiddleware(t, cfg)
+	if rec := importArchive(other); rec.Code != http.StatusBadRequest {
+		t.Errorf("Import with another cookie secret = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	source.ServeHTTP(rec, adminRequest(http.MethodPost, "/_auth/admin/sessions/export", testAdminToken))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST export = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestImportSessions_SkipsExpired(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	storeTestSession(t, mw.sessionStore, "alice@example.com")
+	archive, count, err := mw.ExportSessions(context.Background())
+	if err != nil || count != 1 {
+		t.Fatalf("ExportSessions = %d, %v", count, err)
+	}
+
+	target := newAdminTestMiddleware(t)
+	target.clock = clock.NewFake(time.Now().Add(2 * time.Hour))
+	result, err := target.ImportSessions(context.Background(), archive)
+	if err != nil {
+		t.Fatalf("ImportSessions failed: %v", err)
+	}
+	if result.Imported != 0 || result.Skipped != 1 {
+		t.Errorf("ImportSessions = %+v, want the expired session skipped", result)
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/russross/blackfriday/v2"
+)
+
+// announcementCookieName holds the ID of the announcement the visitor dismissed (set by announcement.js)
+const announcementCookieName = "_chatbotgate_announcement"
+
+// announcementMarkdownFlags renders banner Markdown without raw HTML, and with safe links opened in a new tab
+const announcementMarkdownFlags = blackfriday.SkipHTML | blackfriday.Safelink |
+	blackfriday.NofollowLinks | blackfriday.NoreferrerLinks | blackfriday.HrefTargetBlank
+
+// announcementTemplate renders the banner; the dismiss button is shown by announcement.js
+var announcementTemplate = template.Must(template.New("announcement").Parse(
+	`<div class="announcement announcement-{{.Severity}}" role="{{if eq .Severity "info"}}status{{else}}alert{{end}}" data-announcement-id="{{.ID}}" data-cookie-path="{{.CookiePath}}">
+<div class="announcement-message">{{.Message}}</div>
+<button type="button" class="announcement-dismiss" aria-label="{{.DismissLabel}}" hidden>&times;</button>
+</div>
+<script src="{{.Script}}"></script>`))
+
+// Announcement returns the announcement of the auth pages (announcement, or as replaced via the admin API)
+func (m *Middleware) Announcement() config.AnnouncementConfig {
+	m.announcementMu.RLock()
+	defer m.announcementMu.RUnlock()
+	if m.announcement != nil {
+		return *m.announcement
+	}
+	return m.config.Announcement
+}
+
+// SetAnnouncement replaces the announcement at runtime, on all instances sharing a Redis session KVS
+// An announcement without message removes the banner; a nil announcement restores the configuration.
+// The change lasts until the configuration file is reloaded.
+func (m *Middleware) SetAnnouncement(announcement *config.AnnouncementConfig) error {
+	if announcement != nil {
+		if err := announcement.Validate(); err != nil {
+			return err
+		}
+	}
+	m.setAnnouncement(announcement)
+	m.publishEvent(context.Background(), eventAnnouncement, announcementEvent{Announcement: announcement, Restore: announcement == nil})
+	return nil
+}
+
+// setAnnouncement replaces the announcement on this instance
+func (m *Middleware) setAnnouncement(announcement *config.AnnouncementConfig) {
+	m.announcementMu.Lock()
+	m.announcement = announcement
+	m.announcementMu.Unlock()
+	m.loginPages.reset()
+}
+
+// announcementID identifies an announcement, so dismissing it does not hide the next one
+func announcementID(announcement config.AnnouncementConfig) string {
+	data, _ := json.Marshal(announcement)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// visibleAnnouncement returns the ID of the announcement shown to the visitor now, or ""
+// when there is none, or the visitor dismissed it
+func (m *Middleware) visibleAnnouncement(r *http.Request) string {
+	announcement := m.Announcement()
+	if !announcement.ActiveAt(m.clock.Now()) {
+		return ""
+	}
+	id := announcementID(announcement)
+	if cookie, err := r.Cookie(announcementCookieName); err == nil && cookie.Value == id {
+		return ""
+	}
+	return id
+}
+
+// announcementBanner renders the banner of the announcement with the ID id in lang
+// Returns "" when id is empty or no longer the current announcement.
+func (m *Middleware) announcementBanner(id string, lang i18n.Language) template.HTML {
+	announcement := m.Announcement()
+	if id == "" || announcementID(announcement) != id {
+		return ""
+	}
+
+	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{Flags: announcementMarkdownFlags})
+	message := blackfriday.Run([]byte(announcement.MessageFor(string(lang))), blackfriday.WithRenderer(renderer))
+
+	var buf bytes.Buffer
+	err := announcementTemplate.Execute(&buf, map[string]interface{}{
+		"ID":           id,
+		"Severity":     announcement.GetSeverity(),
+		"Message":      template.HTML(strings.TrimSpace(string(message))),
+		"DismissLabel": m.translator.T(lang, "ui.announcement.dismiss"),
+		"CookiePath":   m.config.Server.GetCookiePath(),
+		"Script":       assetURL(m.config.Server.GetPublicAuthPathPrefix(), "announcement.js"),
+	})
+	if err != nil {
+		m.logger.Error("Failed to render announcement", "error", err)
+		return ""
+	}
+	return template.HTML(buf.String())
+}
+
+// pageAnnouncement returns the banner shown to the visitor on an error page
+func (m *Middleware) pageAnnouncement(r *http.Request, lang i18n.Language) template.HTML {
+	return m.announcementBanner(m.visibleAnnouncement(r), lang)
+}
+
+// handleAdminAnnouncement serves GET, PUT and DELETE /_auth/admin/announcement
+func (m *Middleware) handleAdminAnnouncement(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var announcement config.AnnouncementConfig
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&announcement); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", "Body must be an announcement JSON: "+err.Error())
+			return
+		}
+		if err := m.SetAnnouncement(&announcement); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", err.Error())
+			return
+		}
+		m.logger.Info("Announcement replaced via admin API", "severity", announcement.GetSeverity(), "enabled", announcement.Enabled())
+	case http.MethodDelete:
+		_ = m.SetAnnouncement(nil)
+		m.logger.Info("Announcement restored via admin API")
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET, PUT, DELETE are accepted")
+		return
+	}
+
+	announcement := m.Announcement()
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"announcement": announcement,
+		"active":       announcement.ActiveAt(m.clock.Now()),
+	})
+}
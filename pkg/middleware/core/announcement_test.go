@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+func announcementLoginPage(t *testing.T, mw *Middleware, cookie string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: announcementCookieName, Value: cookie})
+	}
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Login page status = %d, want 200", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestAnnouncement_LoginPage(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	mw.config.Announcement = config.AnnouncementConfig{
+		Message:  "**Maintenance** tonight, see [status](https://status.example.com) <img src=x onerror=alert(1)> [x](javascript:alert(1))",
+		Messages: map[string]string{"ja": "今夜メンテナンス"},
+		Severity: config.SeverityWarning,
+	}
+
+	body := announcementLoginPage(t, mw, "")
+	if !strings.Contains(body, `class="announcement announcement-warning" role="alert"`) {
+		t.Fatal("Login page should show the warning banner")
+	}
+	if !strings.Contains(body, "<strong>Maintenance</strong>") || !strings.Contains(body, `href="https://status.example.com"`) {
+		t.Error("Banner should render the Markdown message")
+	}
+	if strings.Contains(body, "onerror") || strings.Contains(body, "javascript:alert") {
+		t.Error("Banner should strip raw HTML and unsafe links")
+	}
+	if !strings.Contains(body, `src="/_auth/assets/announcement.`) {
+		t.Error("Banner should load the dismiss script")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	req.Header.Set("Accept-Language", "ja")
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "今夜メンテナンス") {
+		t.Error("Japanese login page should show the Japanese message")
+	}
+
+	// Dismissed by the visitor
+	id := announcementID(mw.config.Announcement)
+	if body := announcementLoginPage(t, mw, id); strings.Contains(body, `class="announcement `) {
+		t.Error("Dismissed banner should not be shown")
+	}
+
+	// A new announcement is shown again
+	mw.config.Announcement.Message = "Maintenance postponed"
+	mw.loginPages.reset()
+	if body := announcementLoginPage(t, mw, id); !strings.Contains(body, "Maintenance postponed") {
+		t.Error("Changed announcement should be shown despite the dismissal of the previous one")
+	}
+}
+
+func TestAnnouncement_Window(t *testing.T) {
+	start := time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start.Add(-time.Minute))
+
+	mw := newAdminTestMiddleware(t)
+	mw.clock = fake
+	mw.config.Announcement = config.AnnouncementConfig{Message: "Maintenance in progress", StartsAt: start, EndsAt: start.Add(time.Hour)}
+
+	if body := announcementLoginPage(t, mw, ""); strings.Contains(body, "Maintenance in progress") {
+		t.Error("Banner should not be shown before starts_at")
+	}
+	fake.Advance(2 * time.Minute)
+	if body := announcementLoginPage(t, mw, ""); !strings.Contains(body, "Maintenance in progress") {
+		t.Error("Banner should be shown between starts_at and ends_at")
+	}
+	fake.Advance(time.Hour)
+	if body := announcementLoginPage(t, mw, ""); strings.Contains(body, "Maintenance in progress") {
+		t.Error("Banner should not be shown after ends_at")
+	}
+}
+
+func TestAnnouncement_ErrorPage(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	mw.config.Announcement = config.AnnouncementConfig{Message: "Outage of the email provider", Severity: config.SeverityCritical}
+
+	rec := httptest.NewRecorder()
+	mw.handle404(rec, httptest.NewRequest(http.MethodGet, "/_auth/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Status = %d, want 404", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "announcement-critical") || !strings.Contains(rec.Body.String(), "Outage of the email provider") {
+		t.Error("Error page should show the banner")
+	}
+}
+
+func TestAdmin_Announcement(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	mw.config.Announcement = config.AnnouncementConfig{Message: "From the configuration"}
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/_auth/admin/announcement", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := put(`{"message": "Maintenance at 22:00 UTC", "severity": "warning"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Announcement config.AnnouncementConfig `json:"announcement"`
+		Active       bool                      `json:"active"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if resp.Announcement.Message != "Maintenance at 22:00 UTC" || !resp.Active {
+		t.Errorf("Response = %+v, want the active new announcement", resp)
+	}
+	if body := announcementLoginPage(t, mw, ""); !strings.Contains(body, "Maintenance at 22:00 UTC") {
+		t.Error("Login page should show the announcement set via the admin API")
+	}
+
+	if rec := put(`{"message": "x", "severity": "urgent"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid severity status = %d, want 400", rec.Code)
+	}
+	if rec := put(`not json`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid body status = %d, want 400", rec.Code)
+	}
+	if got := mw.Announcement().Message; got != "Maintenance at 22:00 UTC" {
+		t.Errorf("Announcement after invalid requests = %q, want it unchanged", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/announcement", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE status = %d", rec.Code)
+	}
+	if got := mw.Announcement().Message; got != "From the configuration" {
+		t.Errorf("Announcement after DELETE = %q, want the configuration", got)
+	}
+	if body := announcementLoginPage(t, mw, ""); !strings.Contains(body, "From the configuration") {
+		t.Error("Login page should show the configured announcement again")
+	}
+}
+
+func TestHandleAnnouncementJS(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/assets/announcement.js", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), announcementCookieName) {
+		t.Error("Script should set the dismiss cookie")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
 	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
@@ -61,12 +62,12 @@ func TestBuildStyleLinks_DifyDisabled(t *testing.T) {
 	result := middleware.buildStyleLinks()
 
 	// Should only contain main.css
-	if !strings.Contains(result, "/_auth/assets/main.css") {
+	if !strings.Contains(result, `/_auth/assets/main.`) {
 		t.Error("buildStyleLinks() should contain main.css link")
 	}
 
 	// Should NOT contain dify.css
-	if strings.Contains(result, "dify.css") {
+	if strings.Contains(result, "dify.") {
 		t.Error("buildStyleLinks() should not contain dify.css link when optimization is disabled")
 	}
 }
@@ -118,11 +119,11 @@ func TestBuildStyleLinks_DifyEnabled(t *testing.T) {
 	result := middleware.buildStyleLinks()
 
 	// Should contain both main.css and dify.css
-	if !strings.Contains(result, "/_auth/assets/main.css") {
+	if !strings.Contains(result, `/_auth/assets/main.`) {
 		t.Error("buildStyleLinks() should contain main.css link")
 	}
 
-	if !strings.Contains(result, "/_auth/assets/dify.css") {
+	if !strings.Contains(result, "/_auth/assets/"+assets.FingerprintedName("dify.css")) {
 		t.Error("buildStyleLinks() should contain dify.css link when optimization is enabled")
 	}
 }
@@ -174,11 +175,11 @@ func TestBuildStyleLinks_CustomPrefix(t *testing.T) {
 	result := middleware.buildStyleLinks()
 
 	// Should use custom prefix
-	if !strings.Contains(result, "/_custom_auth/assets/main.css") {
+	if !strings.Contains(result, `/_custom_auth/assets/main.`) {
 		t.Error("buildStyleLinks() should use custom auth path prefix for main.css")
 	}
 
-	if !strings.Contains(result, "/_custom_auth/assets/dify.css") {
+	if !strings.Contains(result, "/_custom_auth/assets/"+assets.FingerprintedName("dify.css")) {
 		t.Error("buildStyleLinks() should use custom auth path prefix for dify.css")
 	}
 }
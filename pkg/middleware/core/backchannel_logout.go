@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// logoutTokenKeyPrefix is the prefix of the IDs ("jti") of the logout tokens already processed,
+// kept in the session KVS until the tokens expire so that they cannot be replayed
+const logoutTokenKeyPrefix = "logout-jti:"
+
+// handleBackchannelLogout handles OIDC back-channel logout requests (POST /_auth/oauth2/backchannel-logout)
+// The provider posts a logout token signed with the keys of its JWKS; the sessions it names are deleted.
+// Responses follow OIDC Back-Channel Logout 1.0 section 2.8: 200 on success, 400 for invalid tokens.
+func (m *Middleware) handleBackchannelLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is accepted")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	logoutToken := r.PostFormValue("logout_token")
+	if logoutToken == "" || m.oauthManager == nil {
+		writeAPIJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "logout_token is required"})
+		return
+	}
+
+	providerName, claims, err := m.oauthManager.VerifyLogoutToken(r.Context(), logoutToken)
+	if err != nil {
+		m.logger.Warn("Back-channel logout rejected", "provider", providerName, "error", err)
+		writeAPIJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "invalid logout token"})
+		return
+	}
+
+	if claims.ID != "" {
+		replayed, err := m.markLogoutToken(r.Context(), providerName, claims)
+		if err != nil {
+			m.logger.Error("Failed to record logout token", "provider", providerName, "error", err)
+			writeAPIJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		} else if replayed {
+			m.logger.Warn("Back-channel logout rejected: token already used", "provider", providerName)
+			writeAPIJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "logout token already used"})
+			return
+		}
+	}
+
+	deleted, err := m.logoutProviderSessions(r.Context(), providerName, claims)
+	if err != nil {
+		m.logger.Error("Back-channel logout failed: could not delete sessions", "provider", providerName, "error", err)
+		writeAPIJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	m.logger.Info("Back-channel logout", "provider", providerName, "by_sid", claims.SessionID != "", "deleted", deleted)
+	w.WriteHeader(http.StatusOK)
+}
+
+// markLogoutToken records the ID of a logout token and reports whether it was recorded already
+func (m *Middleware) markLogoutToken(ctx context.Context, providerName string, claims *oauth2.LogoutClaims) (bool, error) {
+	key := logoutTokenKeyPrefix + providerName + ":" + claims.ID
+	exists, err := kvs.Uncached(m.sessionStore).Exists(ctx, key)
+	if err != nil || exists {
+		return exists, err
+	}
+	ttl := time.Until(claims.ExpiresAt)
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return false, m.sessionStore.Set(ctx, key, []byte("1"), ttl)
+}
+
+// logoutProviderSessions deletes the sessions of the provider named by a logout token: the sessions
+// of its "sid" when it has one, otherwise all sessions of its "sub". Returns the number of deleted sessions.
+// Deleting through the session cache invalidates the copies of the other instances sharing a Redis KVS.
+func (m *Middleware) logoutProviderSessions(ctx context.Context, providerName string, claims *oauth2.LogoutClaims) (int, error) {
+	sessions, err := session.List(kvs.Uncached(m.sessionStore))
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, sess := range sessions {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		if sess.ID == "" || sess.Provider != providerName || !matchesLogoutClaims(sess, claims) {
+			continue
+		}
+		if err := session.Delete(m.sessionStore, sess.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// matchesLogoutClaims reports whether a session is one of those a logout token names
+func matchesLogoutClaims(sess *session.Session, claims *oauth2.LogoutClaims) bool {
+	if claims.SessionID != "" {
+		// Both claims must match when the token has both
+		return sess.ProviderSID == claims.SessionID && (claims.Subject == "" || sess.Subject == claims.Subject)
+	}
+	return sess.Subject != "" && sess.Subject == claims.Subject
+}
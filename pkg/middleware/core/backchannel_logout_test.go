@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2/oidctest"
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// newBackchannelTestMiddleware creates a middleware with a custom provider "idp" signing in at a fake OIDC provider
+func newBackchannelTestMiddleware(t *testing.T) (*Middleware, kvs.Store, *oidctest.Server) {
+	t.Helper()
+
+	server, err := oidctest.NewServer(oidctest.Options{AutoLogin: "someone@example.com", ClientID: "client-1"})
+	if err != nil {
+		t.Fatalf("Failed to start OIDC provider: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "idp", Type: "custom"}}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.authzChecker = authz.NewEmailChecker(cfg.AccessControl)
+
+	provider := oauth2.NewCustomProvider("idp", "client-1", "secret", "", "", "", "", nil, false)
+	provider.SetIssuer(server.URL, time.Hour)
+	mw.oauthManager.AddProvider(provider)
+	return mw, store, server
+}
+
+// postLogoutToken posts a back-channel logout request and returns the response status
+func postLogoutToken(t *testing.T, mw *Middleware, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/_auth/oauth2/backchannel-logout", strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestBackchannelLogout_SignInStoresClaims(t *testing.T) {
+	mw, store, _ := newBackchannelTestMiddleware(t)
+
+	// Start, sign in at the provider (auto login), and come back to the callback with the cookies
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/idp", nil))
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		t.Fatalf("Provider redirect = %q, want a code", resp.Header.Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?"+callback.RawQuery, nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Callback status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body.String())
+	}
+
+	var sessionID string
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "_test_session" {
+			sessionID = cookie.Value
+		}
+	}
+	sess, err := session.Get(store, sessionID)
+	if err != nil {
+		t.Fatalf("Session not stored: %v", err)
+	}
+	if sess.Subject != "someone@example.com" || sess.ProviderSID == "" {
+		t.Errorf("Session subject = %q, sid = %q, want the ID token claims", sess.Subject, sess.ProviderSID)
+	}
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	mw, store, server := newBackchannelTestMiddleware(t)
+
+	now := time.Now()
+	for _, s := range []*session.Session{
+		{ID: "laptop", Provider: "idp", Subject: "alice", ProviderSID: "sid-laptop"},
+		{ID: "phone", Provider: "idp", Subject: "alice", ProviderSID: "sid-phone"},
+		{ID: "bob", Provider: "idp", Subject: "bob", ProviderSID: "sid-bob"},
+		{ID: "other-provider", Provider: "google", Subject: "alice"},
+	} {
+		s.CreatedAt, s.ExpiresAt, s.Authenticated = now, now.Add(time.Hour), true
+		if err := session.Set(store, s.ID, s); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	exists := func(id string) bool {
+		_, err := session.Get(store, id)
+		return err == nil
+	}
+
+	// A "sid" logs out one provider session
+	token, _ := server.Provider.LogoutToken("client-1", "alice", "sid-laptop")
+	if code := postLogoutToken(t, mw, token); code != http.StatusOK {
+		t.Fatalf("Logout status = %d, want %d", code, http.StatusOK)
+	}
+	if exists("laptop") || !exists("phone") {
+		t.Errorf("laptop exists = %v, phone exists = %v, want only the laptop logged out", exists("laptop"), exists("phone"))
+	}
+
+	// The same token cannot be replayed
+	if code := postLogoutToken(t, mw, token); code != http.StatusBadRequest {
+		t.Errorf("Replay status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// A "sub" alone logs out all sessions of the user with the provider
+	token, _ = server.Provider.LogoutToken("client-1", "alice", "")
+	if code := postLogoutToken(t, mw, token); code != http.StatusOK {
+		t.Fatalf("Logout status = %d, want %d", code, http.StatusOK)
+	}
+	if exists("phone") || !exists("bob") || !exists("other-provider") {
+		t.Errorf("phone, bob, other-provider exist = %v %v %v, want only alice's idp sessions logged out", exists("phone"), exists("bob"), exists("other-provider"))
+	}
+
+	// Invalid tokens
+	wrongClient, _ := server.Provider.LogoutToken("client-2", "bob", "")
+	for name, token := range map[string]string{"wrong audience": wrongClient, "garbage": "a.b.c", "missing": ""} {
+		if code := postLogoutToken(t, mw, token); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", name, code, http.StatusBadRequest)
+		}
+	}
+	if !exists("bob") {
+		t.Error("Invalid tokens should not log out anyone")
+	}
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/backchannel-logout", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
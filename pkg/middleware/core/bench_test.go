@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+)
+
+// newBenchProxyPath returns the middleware wrapping next, with the default forwarding fields
+// and a stored session, plus a request template carrying the session cookie
+func newBenchProxyPath(tb testing.TB, next http.Handler) (http.Handler, *http.Request) {
+	tb.Helper()
+
+	cfg := newTestConfig()
+	cfg.Forwarding = config.ForwardingConfig{
+		Fields: []config.ForwardingField{
+			{Path: "email", Header: "X-ChatbotGate-Email"},
+			{Path: "username", Header: "X-ChatbotGate-User"},
+			{Path: "provider", Header: "X-ChatbotGate-Provider"},
+		},
+	}
+	mw, store := newTestMiddleware(tb, cfg)
+	mw.forwarder = newTestForwarder(tb, &cfg.Forwarding)
+	sessionID := storeTestSession(tb, store, "user@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/app/chat?conversation=1", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+	return mw.Wrap(next), req
+}
+
+// discardHandler is an upstream that answers without doing any work
+var discardHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// BenchmarkServeHTTP_Authenticated measures the middleware on the session-validated path
+// (cookie parse, KVS get, header forwarding) without the upstream
+func BenchmarkServeHTTP_Authenticated(b *testing.B) {
+	handler, req := newBenchProxyPath(b, discardHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := req.Clone(req.Context())
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+// BenchmarkServeHTTP_AuthenticatedProxy measures the whole path through the reverse proxy
+func BenchmarkServeHTTP_AuthenticatedProxy(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	proxyHandler, err := proxy.NewHandler(upstream.URL)
+	if err != nil {
+		b.Fatalf("Failed to create proxy: %v", err)
+	}
+	handler, req := newBenchProxyPath(b, proxyHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := req.Clone(req.Context())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status = %d, want 200", rec.Code)
+		}
+	}
+}
+
+// BenchmarkServeHTTP_Unauthenticated measures the redirect to the login page
+func BenchmarkServeHTTP_Unauthenticated(b *testing.B) {
+	handler, req := newBenchProxyPath(b, discardHandler)
+	req.Header.Del("Cookie")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := req.Clone(req.Context())
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func BenchmarkMatchPath(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		matchPath("/app/chat", "/_auth", "/oauth2/start/")
+		matchPath("/app/chat", "/_auth", "/login")
+	}
+}
+
+// authenticatedPathAllocBudget is the allocation budget of one request on the session-validated path
+// (including the request clone and recorder of the test); raise it only with a reason
+const authenticatedPathAllocBudget = 30
+
+func TestServeHTTP_AuthenticatedAllocationBudget(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation budgets do not hold with the race detector")
+	}
+	handler, req := newBenchProxyPath(t, discardHandler)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r := req.Clone(req.Context())
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	})
+	if allocs > authenticatedPathAllocBudget {
+		t.Errorf("session-validated request allocates %.0f times, budget is %d", allocs, authenticatedPathAllocBudget)
+	}
+}
+
+// BenchmarkHandleLogin measures serving the login page, as under a login storm
+func BenchmarkHandleLogin(b *testing.B) {
+	mw, _ := newTestMiddleware(b, newTestConfig())
+	mw.SetReady()
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	req.Header.Set("Accept-Language", "ja,en;q=0.8")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := req.Clone(req.Context())
+		mw.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+// loginPageAllocBudget is the allocation budget of serving a prerendered login page
+// (including the request clone and recorder of the test); raise it only with a reason
+const loginPageAllocBudget = 40
+
+func TestHandleLogin_AllocationBudget(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation budgets do not hold with the race detector")
+	}
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	mw.SetReady()
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	req.Header.Set("Accept-Language", "ja,en;q=0.8")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r := req.Clone(req.Context())
+		mw.ServeHTTP(httptest.NewRecorder(), r)
+	})
+	if allocs > loginPageAllocBudget {
+		t.Errorf("login page request allocates %.0f times, budget is %d", allocs, loginPageAllocBudget)
+	}
+}
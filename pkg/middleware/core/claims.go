@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+)
+
+// mapClaims returns a copy of the provider's Extra data with the claims_mapping claims added
+// and the Extra keys of the claims found. extra itself is not modified.
+func (m *Middleware) mapClaims(providerID string, extra map[string]interface{}) (map[string]interface{}, []string) {
+	if len(m.config.ClaimsMapping) == 0 {
+		return extra, nil
+	}
+
+	mapped := make(map[string]interface{}, len(extra)+len(m.config.ClaimsMapping))
+	for key, value := range extra {
+		mapped[key] = value
+	}
+
+	resolved := make(map[string]bool)
+	var keys []string
+	for _, mapping := range m.config.ClaimsMapping {
+		if resolved[mapping.Claim] || !mapping.AppliesTo(providerID) {
+			continue
+		}
+		if value := claimValue(extra, mapping); value != "" {
+			mapped[mapping.ClaimKey()] = value
+			resolved[mapping.Claim] = true
+			keys = append(keys, mapping.ClaimKey())
+		}
+	}
+	return mapped, keys
+}
+
+// claimValue returns the first non-empty value of the mapping's source paths
+// Paths address the provider's Extra data, with an optional "extra." prefix as in forwarding
+func claimValue(extra map[string]interface{}, mapping config.ClaimMapping) string {
+	for _, path := range mapping.From {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "."), "extra.")
+		if value := forwarding.GetValueByPath(extra, path); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+func TestMapClaims(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ClaimsMapping = []config.ClaimMapping{
+		{Claim: "department", From: []string{"extension_Department"}, Providers: []string{"azure"}},
+		{Claim: "department", From: []string{"extra.org.department", "department"}},
+		{Claim: "locale", From: []string{"locale", "preferredLanguage"}},
+		{Claim: "username", From: []string{"displayName"}},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	tests := []struct {
+		name       string
+		provider   string
+		extra      map[string]interface{}
+		wantClaims map[string]interface{}
+	}{
+		{
+			name:     "provider-specific entry first",
+			provider: "azure",
+			extra: map[string]interface{}{
+				"extension_Department": "Sales",
+				"preferredLanguage":    "ja-JP",
+				"displayName":          "Taro Yamada",
+			},
+			wantClaims: map[string]interface{}{"_department": "Sales", "_locale": "ja-JP", "_username": "Taro Yamada"},
+		},
+		{
+			name:     "generic fallback with nested path",
+			provider: "keycloak",
+			extra: map[string]interface{}{
+				"extension_Department": "ignored for other providers",
+				"org":                  map[string]interface{}{"department": "Support"},
+				"locale":               "en",
+			},
+			wantClaims: map[string]interface{}{"_department": "Support", "_locale": "en"},
+		},
+		{
+			name:       "no source value",
+			provider:   "google",
+			extra:      map[string]interface{}{"picture": "https://example.com/p.jpg"},
+			wantClaims: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapped, keys := mw.mapClaims(tt.provider, tt.extra)
+
+			claims := make(map[string]interface{})
+			for _, key := range keys {
+				claims[key] = mapped[key]
+			}
+			if !reflect.DeepEqual(claims, tt.wantClaims) {
+				t.Errorf("Claims = %v, want %v", claims, tt.wantClaims)
+			}
+			for key := range tt.extra {
+				if _, ok := mapped[key]; !ok {
+					t.Errorf("Extra key %q was removed", key)
+				}
+			}
+			if _, ok := tt.extra["_department"]; ok {
+				t.Error("mapClaims() modified its input")
+			}
+		})
+	}
+}
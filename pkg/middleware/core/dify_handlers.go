@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/dify"
+)
+
+// difyWidgetConfig is the subset of window.difyChatbotConfig set by the generated embed.js
+type difyWidgetConfig struct {
+	Token           string            `json:"token"`
+	BaseURL         string            `json:"baseUrl"`
+	SystemVariables map[string]string `json:"systemVariables,omitempty"`
+	UserVariables   map[string]string `json:"userVariables,omitempty"`
+}
+
+// handleDifyEmbedJS serves a bootstrap script for the Dify chat widget ({prefix}/dify/embed.js)
+// Sites embed it with <script src=".../dify/embed.js" defer></script> instead of a hand-edited snippet:
+// it points the widget at this gate (so the chat iframe is authenticated) and, when the request
+// carries a session and comes from a page of this site or of server.allowed_origins, passes the user
+// to Dify so conversations are attributed per user.
+func (m *Middleware) handleDifyEmbedJS(w http.ResponseWriter, r *http.Request) {
+	difyCfg := m.config.Dify
+	if difyCfg.WidgetToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	baseURL := m.config.Server.BaseURL
+	if baseURL == "" {
+		baseURL = requestOrigin(r)
+	}
+
+	widget := difyWidgetConfig{
+		Token:   difyCfg.WidgetToken,
+		BaseURL: baseURL,
+	}
+	if sess, ok := m.lookupSession(r); ok && m.embedsIdentity(r, baseURL) {
+		widget.SystemVariables = map[string]string{
+			"user_id": dify.UserID(difyCfg.GetUserField(), sess.Email, sess.Name),
+		}
+		if sess.Name != "" {
+			widget.UserVariables = map[string]string{"name": sess.Name}
+		}
+	}
+
+	// json.Marshal escapes <, > and &, so the values cannot break out of the script
+	configJSON, err := json.Marshal(widget)
+	if err != nil {
+		m.logger.Error("Failed to encode Dify widget config", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	srcJSON, _ := json.Marshal(baseURL + "/embed.min.js")
+	tokenJSON, _ := json.Marshal(difyCfg.WidgetToken)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Generated by ChatbotGate: configures the Dify chat widget to use this gate\n")
+	buf.WriteString("window.difyChatbotConfig = Object.assign({}, window.difyChatbotConfig, ")
+	buf.Write(configJSON)
+	buf.WriteString(");\n")
+	buf.WriteString("(function () {\n")
+	buf.WriteString("\tvar script = document.createElement('script');\n")
+	buf.WriteString("\tscript.src = ")
+	buf.Write(srcJSON)
+	buf.WriteString(";\n\tscript.id = ")
+	buf.Write(tokenJSON)
+	buf.WriteString(";\n\tscript.defer = true;\n")
+	buf.WriteString("\tdocument.head.appendChild(script);\n")
+	buf.WriteString("})();\n")
+
+	// The script depends on the session cookie and must never be shared between users
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Add("Vary", "Cookie")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// embedsIdentity reports whether the embed script may carry the user of the session
+// Scripts are fetched cross-site with the session cookie (SameSite=None), so any page including the
+// script would read the visitor's identity (XSSI). The user is only embedded for pages of this site
+// (Sec-Fetch-Site) or of an origin listed in server.allowed_origins ("*" does not count), told by the
+// Referer as browsers send no Origin with script requests. Requests telling neither get no user.
+func (m *Middleware) embedsIdentity(r *http.Request, baseURL string) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "same-site", "none":
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil || referer.Scheme == "" || referer.Host == "" {
+			return false
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+	if r.Header.Get("Sec-Fetch-Site") == "" && strings.EqualFold(origin, strings.TrimSuffix(baseURL, "/")) {
+		return true // Browsers without fetch metadata
+	}
+	for _, allowed := range m.config.Server.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
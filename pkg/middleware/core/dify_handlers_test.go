@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleDifyEmbedJS(t *testing.T) {
+	t.Run("disabled without widget token", func(t *testing.T) {
+		mw, _ := newTestMiddleware(t, newTestConfig())
+
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/dify/embed.js", nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	cfg := newTestConfig()
+	cfg.Dify.WidgetToken = "AbC123"
+	cfg.Dify.UserField = "userpart"
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	t.Run("anonymous", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/dify/embed.js", nil)
+		req.Host = "chat.example.com"
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+			t.Errorf("Content-Type = %q, want text/javascript", ct)
+		}
+		if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+			t.Errorf("Cache-Control = %q, want no-store", cc)
+		}
+
+		body := rec.Body.String()
+		for _, want := range []string{
+			`"token":"AbC123"`,
+			`"baseUrl":"https://chat.example.com"`,
+			`script.src = "https://chat.example.com/embed.min.js"`,
+			`script.id = "AbC123"`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected script to contain %q, got:\n%s", want, body)
+			}
+		}
+		if strings.Contains(body, "user_id") {
+			t.Error("Did not expect a user for anonymous requests")
+		}
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/dify/embed.js", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		req.Header.Set("Sec-Fetch-Site", "same-origin")
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); !strings.Contains(body, `"systemVariables":{"user_id":"user"}`) {
+			t.Errorf("Expected the session user in the script, got:\n%s", body)
+		}
+	})
+
+	t.Run("identity only for pages of the site", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Dify.WidgetToken = "AbC123"
+		cfg.Server.BaseURL = "https://chat.example.com"
+		cfg.Server.AllowedOrigins = []string{"https://partner.example.org", "*"}
+		mw, store := newTestMiddleware(t, cfg)
+		sessionID := storeTestSession(t, store, "user@example.com")
+
+		tests := []struct {
+			name     string
+			headers  map[string]string
+			wantUser bool
+		}{
+			{"same site", map[string]string{"Sec-Fetch-Site": "same-site"}, true},
+			{"cross site", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://evil.example.net/page"}, false},
+			{"cross site without referer", map[string]string{"Sec-Fetch-Site": "cross-site"}, false},
+			{"allowed origin", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://partner.example.org/help"}, true},
+			{"referer of the gate without fetch metadata", map[string]string{"Referer": "https://chat.example.com/chat"}, true},
+			{"cross site with a referer of the gate", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://chat.example.com/chat"}, false},
+			{"no metadata", nil, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/_auth/dify/embed.js", nil)
+				req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+				for name, value := range tt.headers {
+					req.Header.Set(name, value)
+				}
+				rec := httptest.NewRecorder()
+				mw.ServeHTTP(rec, req)
+
+				if got := strings.Contains(rec.Body.String(), "user_id"); got != tt.wantUser {
+					t.Errorf("user in the script = %v, want %v:\n%s", got, tt.wantUser, rec.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("base url from config", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.Dify.WidgetToken = "AbC123"
+		cfg.Server.BaseURL = "https://gate.example.com"
+		mw, _ := newTestMiddleware(t, cfg)
+
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/dify/embed.js", nil))
+
+		if body := rec.Body.String(); !strings.Contains(body, `"baseUrl":"https://gate.example.com"`) {
+			t.Errorf("Expected the configured base URL, got:\n%s", body)
+		}
+	})
+}
@@ -155,6 +155,10 @@ func extractTokenFromEmail(sentEmail sentEmail) string {
 			parts := strings.Split(line, "token=")
 			if len(parts) >= 2 {
 				token := strings.TrimSpace(parts[1])
+				// Drop following query parameters (e.g., &lang=en)
+				if i := strings.Index(token, "&"); i != -1 {
+					token = token[:i]
+				}
 				// Remove any trailing punctuation
 				token = strings.Trim(token, ".,;:!?")
 				return token
@@ -691,3 +695,48 @@ func TestExtractUserpart(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleEmailVerify_PropagatesLanguage(t *testing.T) {
+	cfg := newTestConfig()
+	mw, _ := newTestMiddleware(t, cfg)
+	mockSender := &mockEmailSender{}
+	mw.emailHandler = createEmailHandler(t, mockSender, config.AccessControlConfig{}, 10)
+	mw.authzChecker = authz.NewEmailChecker(config.AccessControlConfig{})
+
+	if err := mw.emailHandler.SendLoginLink("user@example.com", "/", i18n.Japanese); err != nil {
+		t.Fatalf("Failed to send login link: %v", err)
+	}
+	token := extractTokenFromEmail(mockSender.sentEmails[0])
+	if !strings.Contains(mockSender.sentEmails[0].textBody, "token="+token+"&lang=ja") {
+		t.Fatal("login link should carry the email language")
+	}
+
+	// A successful verification remembers the language of the email
+	req := httptest.NewRequest(http.MethodGet, "/_auth/email/verify?token="+token, nil)
+	req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusFound)
+	}
+	var langCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "lang" {
+			langCookie = c
+		}
+	}
+	if langCookie == nil || langCookie.Value != "ja" {
+		t.Errorf("lang cookie = %v, want ja", langCookie)
+	}
+
+	// The error page for a used link renders in the language carried by the link
+	req = httptest.NewRequest(http.MethodGet, "/_auth/email/verify?token="+token+"&lang=ja", nil)
+	req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+	w = httptest.NewRecorder()
+	mw.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "無効または期限切れのトークン") {
+		t.Error("invalid token page should be rendered in Japanese")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
@@ -102,6 +103,51 @@ func TestHandleEmailSent(t *testing.T) {
 	}
 }
 
+// TestHandleEmailSent_OTPInput tests the segmented OTP input markup and the invalid code alert
+func TestHandleEmailSent_OTPInput(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	t.Run("script and form hooks", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/_auth/email/sent", nil)
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		for _, want := range []string{
+			`<script src="/_auth/assets/` + assets.FingerprintedName("otp.js") + `" defer></script>`,
+			`data-otp-form`,
+			`data-segment-label="Character {n} of {total}"`,
+			`name="otp"`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected body to contain %q", want)
+			}
+		}
+		if strings.Contains(body, `role="alert"`) {
+			t.Error("Did not expect an error alert without ?error")
+		}
+		// Without JavaScript the single input must remain submittable
+		if strings.Contains(body, "disabled") {
+			t.Error("Verify button must not be disabled in the server-rendered markup")
+		}
+	})
+
+	t.Run("invalid otp error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/_auth/email/sent?error=invalid_otp", nil)
+		req.Header.Set("Accept-Language", "ja")
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		if !strings.Contains(body, `role="alert"`) {
+			t.Error("Expected an error alert")
+		}
+		if !strings.Contains(body, "コードが無効か期限切れです") {
+			t.Error("Expected the translated invalid code message")
+		}
+	})
+}
+
 // TestHandleForbidden tests the forbidden (403) error page
 func TestHandleForbidden(t *testing.T) {
 	cfg := &config.Config{
@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
@@ -326,3 +328,91 @@ func TestHandle500(t *testing.T) {
 		})
 	}
 }
+
+// TestHandleUpstreamError tests the branded 502/504 pages shown when the upstream cannot be reached
+func TestHandleUpstreamError(t *testing.T) {
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	// Reserve a port and close it so connections are refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	upstreamURL := "http://" + ln.Addr().String()
+	_ = ln.Close()
+
+	upstream, err := proxy.NewHandler(upstreamURL)
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	handler := mw.Wrap(upstream)
+
+	t.Run("connection refused renders 502 page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chat?id=1", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusBadGateway)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{"502 - Bad Gateway", "Service Unavailable", `href="/chat?id=1"`, "Try Again", "Request ID"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected body to contain %q", want)
+			}
+		}
+		reqID := rec.Header().Get("X-Request-ID")
+		if reqID == "" || !strings.Contains(body, reqID) {
+			t.Errorf("Expected request ID %q in header and body", reqID)
+		}
+		if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", cc)
+		}
+	})
+
+	t.Run("client request ID is reused", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chat", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		req.Header.Set("X-Request-ID", "lb-1234")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Request-ID"); got != "lb-1234" {
+			t.Errorf("X-Request-ID = %q, want lb-1234", got)
+		}
+	})
+
+	t.Run("non-GET offers no retry link", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/chat", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusBadGateway)
+		}
+		if strings.Contains(rec.Body.String(), "Try Again") {
+			t.Error("Did not expect a retry link for POST")
+		}
+	})
+
+	t.Run("timeout renders localized 504 page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chat", nil)
+		req.Header.Set("Accept-Language", "ja")
+		rec := httptest.NewRecorder()
+		mw.handleUpstreamError(rec, req, http.StatusGatewayTimeout, errors.New("timeout"))
+
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{"504 - Gateway Timeout", "サービスが応答しません", "再試行"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected body to contain %q", want)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+)
+
+// errorResponseConfig returns the configuration of the 404 or 403 response
+func (m *Middleware) errorResponseConfig(status int) config.ErrorResponseConfig {
+	if status == http.StatusForbidden {
+		return m.config.Errors.Forbidden
+	}
+	return m.config.Errors.NotFound
+}
+
+// serveConfiguredError answers a 404 or 403 as errors.not_found or errors.forbidden configures:
+// the upstream's page (proxy mode), or JSON (json mode, or page mode for clients preferring JSON).
+// Reports false when the gate's own page is to be rendered.
+func (m *Middleware) serveConfiguredError(w http.ResponseWriter, r *http.Request, status int) bool {
+	cfg := m.errorResponseConfig(status)
+	switch cfg.GetMode() {
+	case config.ErrorModeProxy:
+		if m.next == nil || cfg.Path == "" {
+			return false
+		}
+		m.serveUpstreamErrorPage(w, r, status, cfg.Path)
+		return true
+	case config.ErrorModeJSON:
+		m.writeErrorJSON(w, r, status, cfg)
+		return true
+	default:
+		if !prefersJSON(r) {
+			return false
+		}
+		m.writeErrorJSON(w, r, status, cfg)
+		return true
+	}
+}
+
+// writeErrorJSON writes the JSON body of the error response
+func (m *Middleware) writeErrorJSON(w http.ResponseWriter, r *http.Request, status int, cfg config.ErrorResponseConfig) {
+	if cfg.JSON != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(cfg.JSON))
+		return
+	}
+
+	lang := i18n.DetectLanguage(r)
+	code, messageKey := "not_found", "error.notfound.message"
+	if status == http.StatusForbidden {
+		code, messageKey = "forbidden", "error.forbidden.message"
+	}
+	writeAPIJSON(w, status, map[string]string{
+		"error":   code,
+		"message": m.translator.T(lang, messageKey),
+	})
+}
+
+// serveUpstreamErrorPage serves the upstream's response for path with status, e.g. the 403 page of the app
+// The upstream gets a bare GET without credentials: the denied request itself never reaches it.
+func (m *Middleware) serveUpstreamErrorPage(w http.ResponseWriter, r *http.Request, status int, path string) {
+	r2 := r.Clone(r.Context())
+	r2.Method = http.MethodGet
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	r2.URL.RawQuery = ""
+	r2.RequestURI = ""
+	r2.Body = http.NoBody
+	r2.ContentLength = 0
+	for _, header := range []string{"Authorization", "Cookie", "Content-Type", "Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		r2.Header.Del(header)
+	}
+	m.stripAuthHeaders(r2)
+
+	ctx := proxy.WithErrorHandler(r2.Context(), m.handleUpstreamError)
+	m.next.ServeHTTP(&errorStatusWriter{ResponseWriter: w, status: status}, r2.WithContext(ctx))
+}
+
+// errorStatusWriter replaces the status of the upstream's response with the error status
+// Upstream failures (5xx) keep their status, so a broken error page is not reported as a 404 or 403.
+type errorStatusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *errorStatusWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status < http.StatusInternalServerError {
+		status = w.status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorStatusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// prefersJSON reports whether the Accept header of the request ranks JSON above HTML
+// Browsers accept text/html explicitly; API clients send application/json (or a +json type) alone.
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		switch {
+		case mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")):
+			jsonQ = max(jsonQ, q)
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case mediaType == "*/*" || mediaType == "text/*":
+			// Wildcards accept HTML at their quality, without preferring JSON
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// isScriptRequest reports whether the request was made by a script (XHR or fetch) rather than a page navigation
+// X-Requested-With is set by jQuery and similar libraries, Sec-Fetch-Mode by browsers on fetch and XHR requests.
+func isScriptRequest(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest") {
+		return true
+	}
+	switch r.Header.Get("Sec-Fetch-Mode") {
+	case "cors", "same-origin":
+		return true
+	}
+	return prefersJSON(r)
+}
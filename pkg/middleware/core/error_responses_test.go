@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+func TestPrefersJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"application/json", true},
+		{"application/json, text/plain, */*", false},
+		{"application/problem+json", true},
+		{"application/json;q=0.9, text/html;q=0.5", true},
+		{"text/html, application/json", false},
+		{"application/json;q=0", false},
+		{"*/*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := prefersJSON(req); got != tt.want {
+				t.Errorf("prefersJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrors_UnknownAuthPath(t *testing.T) {
+	cfg := newTestConfig()
+	mw, _ := newTestMiddleware(t, cfg)
+	var upstreamPath string
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	// Page mode: the branded page, or JSON for API clients
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/unknown", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Page mode: status = %d, content type = %q, want the 404 page", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/unknown", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusNotFound || body["error"] != "not_found" {
+		t.Errorf("Page mode for a JSON client: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	// JSON mode with a custom body
+	cfg.Errors.NotFound = config.ErrorResponseConfig{Mode: config.ErrorModeJSON, JSON: `{"code":"missing"}`}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/unknown", nil))
+	if rec.Code != http.StatusNotFound || rec.Body.String() != `{"code":"missing"}` {
+		t.Errorf("JSON mode: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	// Proxy mode: unknown auth paths are handled like any other path
+	cfg.Errors.NotFound = config.ErrorResponseConfig{Mode: config.ErrorModeProxy}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/unknown", nil))
+	if rec.Code != http.StatusFound {
+		t.Errorf("Proxy mode without session: status = %d, want the login redirect", rec.Code)
+	}
+	if upstreamPath != "" {
+		t.Errorf("Upstream should not be reached without session, got %q", upstreamPath)
+	}
+
+	// Known endpoints are not affected
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/login", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Login page status = %d, want 200", rec.Code)
+	}
+}
+
+func TestErrors_ForbiddenUpstreamPage(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Errors.Forbidden = config.ErrorResponseConfig{Mode: config.ErrorModeProxy, Path: "/errors/403.html"}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	var upstream *http.Request
+	mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<h1>App forbidden page</h1>"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/delete?id=1", strings.NewReader("id=1"))
+	req.Header.Set("Cookie", "_test_session=abc")
+	req.Header.Set("X-Authenticated", "true")
+	rec := httptest.NewRecorder()
+	mw.handleForbidden(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Status = %d, want 403", rec.Code)
+	}
+	if rec.Body.String() != "<h1>App forbidden page</h1>" {
+		t.Errorf("Body = %q, want the upstream page", rec.Body.String())
+	}
+	if upstream == nil {
+		t.Fatal("Upstream should be asked for the error page")
+	}
+	if upstream.Method != http.MethodGet || upstream.URL.Path != "/errors/403.html" || upstream.URL.RawQuery != "" {
+		t.Errorf("Upstream request = %s %s, want GET /errors/403.html", upstream.Method, upstream.URL)
+	}
+	if upstream.Header.Get("Cookie") != "" || upstream.Header.Get("X-Authenticated") != "" {
+		t.Error("Upstream error page request should carry no credentials")
+	}
+}
+
+func TestErrors_ForbiddenJSON(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Errors.Forbidden = config.ErrorResponseConfig{Mode: config.ErrorModeJSON}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	rec := httptest.NewRecorder()
+	mw.handleForbidden(rec, httptest.NewRequest(http.MethodGet, "/private", nil))
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON body %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code != http.StatusForbidden || body["error"] != "forbidden" || body["message"] == "" {
+		t.Errorf("Status = %d, body = %v", rec.Code, body)
+	}
+}
+
+func TestRedirectToLogin_ScriptRequests(t *testing.T) {
+	cfg := newTestConfig()
+	mw, _ := newTestMiddleware(t, cfg)
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"navigation", "Sec-Fetch-Mode", "navigate", http.StatusFound},
+		{"image", "Sec-Fetch-Mode", "no-cors", http.StatusFound},
+		{"fetch", "Sec-Fetch-Mode", "cors", http.StatusUnauthorized},
+		{"same-origin fetch", "Sec-Fetch-Mode", "same-origin", http.StatusUnauthorized},
+		{"jQuery", "X-Requested-With", "XMLHttpRequest", http.StatusUnauthorized},
+		{"API client", "Accept", "application/json", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/messages", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("Status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Invalid JSON body %q: %v", rec.Body.String(), err)
+			}
+			if body["error"] != "unauthenticated" || body["login_url"] != "/_auth/login" {
+				t.Errorf("Body = %v", body)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == redirectCookieName {
+					t.Error("Script requests should not become the redirect target after login")
+				}
+			}
+		})
+	}
+
+	// Central auth: the login page of the central host
+	cfg.Server.CentralAuthURL = "https://auth.example.com"
+	cfg.Session.Cookie.Domain = ".example.com"
+	req := httptest.NewRequest(http.MethodGet, "/api/messages?lang=ja", nil)
+	req.Host = "app1.example.com"
+	req.Header.Set("Sec-Fetch-Mode", "cors")
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	var body map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusUnauthorized || body["login_url"] != "https://auth.example.com/_auth/login?lang=ja" {
+		t.Errorf("Central auth: status = %d, body = %v", rec.Code, body)
+	}
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// eventsTopic is the broadcast topic of the event bus, within the namespace of the session KVS
+const eventsTopic = "events"
+
+// Event types of the event bus
+const (
+	eventAuthMethod      = "auth_method"      // An authentication method was enabled or disabled
+	eventAllowlist       = "allowlist"        // The email allowlist was replaced or restored
+	eventSessionsRevoked = "sessions_revoked" // The sessions of a user were revoked
+	eventAnnouncement    = "announcement"     // The announcement banner was replaced or restored
+)
+
+// busEvent is a message of the event bus
+type busEvent struct {
+	Type   string          `json:"type"`
+	Origin string          `json:"origin"` // Instance that published the event, which applied it already
+	Data   json.RawMessage `json:"data"`
+}
+
+// authMethodEvent is the data of an auth_method event
+type authMethodEvent struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// allowlistEvent is the data of an allowlist event
+type allowlistEvent struct {
+	Emails  []string `json:"emails,omitempty"`
+	Restore bool     `json:"restore,omitempty"` // Back to access_control.emails
+}
+
+// sessionsRevokedEvent is the data of a sessions_revoked event
+type sessionsRevokedEvent struct {
+	Email     string    `json:"email"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// announcementEvent is the data of an announcement event
+type announcementEvent struct {
+	Announcement *config.AnnouncementConfig `json:"announcement,omitempty"`
+	Restore      bool                       `json:"restore,omitempty"` // Back to the configured announcement
+}
+
+// startEventBus subscribes to the admin actions of the other instances sharing the session KVS
+// Instances are only connected by a store that can broadcast (Redis); otherwise admin actions
+// affect the instance that receives them only.
+func (m *Middleware) startEventBus() {
+	broadcaster, ok := kvs.Uncached(m.sessionStore).(kvs.Broadcaster)
+	if !ok {
+		return
+	}
+
+	origin := make([]byte, 8)
+	if _, err := rand.Read(origin); err != nil {
+		m.logger.Warn("Event bus disabled: failed to generate instance ID", "error", err)
+		return
+	}
+	m.eventsOrigin = hex.EncodeToString(origin)
+
+	stop, err := broadcaster.SubscribeBroadcasts(eventsTopic, m.handleBusEvent)
+	if err != nil {
+		m.logger.Warn("Event bus unavailable, admin actions only affect this instance", "error", err)
+		return
+	}
+	m.events = broadcaster
+	m.stopEvents = stop
+}
+
+// StopEventBus unsubscribes from the event bus
+// The server calls it when a reload replaces the middleware, whose replacement subscribes by itself.
+func (m *Middleware) StopEventBus() {
+	m.stopEventsMu.Lock()
+	stop := m.stopEvents
+	m.stopEvents = nil
+	m.stopEventsMu.Unlock()
+	if stop == nil {
+		return
+	}
+	if err := stop(); err != nil {
+		m.logger.Warn("Failed to unsubscribe from the event bus", "error", err)
+	}
+}
+
+// publishEvent broadcasts an admin action this instance has applied, so the other instances apply it too
+func (m *Middleware) publishEvent(ctx context.Context, eventType string, data interface{}) {
+	if m.events == nil {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		m.logger.Error("Failed to encode event", "event", eventType, "error", err)
+		return
+	}
+	payload, err := json.Marshal(busEvent{Type: eventType, Origin: m.eventsOrigin, Data: raw})
+	if err != nil {
+		m.logger.Error("Failed to encode event", "event", eventType, "error", err)
+		return
+	}
+	if err := m.events.Broadcast(ctx, eventsTopic, payload); err != nil {
+		m.logger.Warn("Failed to broadcast event, other instances are not updated", "event", eventType, "error", err)
+	}
+}
+
+// handleBusEvent applies an admin action published by another instance
+func (m *Middleware) handleBusEvent(payload []byte) {
+	var event busEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		m.logger.Warn("Ignoring invalid event", "error", err)
+		return
+	}
+	if event.Origin == m.eventsOrigin {
+		return
+	}
+
+	switch event.Type {
+	case eventAuthMethod:
+		var data authMethodEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			m.logger.Warn("Ignoring invalid event", "event", event.Type, "error", err)
+			return
+		}
+		if err := m.setAuthMethodEnabled(data.ID, data.Enabled); err != nil {
+			m.logger.Warn("Ignoring event for an unknown authentication method", "id", data.ID)
+			return
+		}
+		m.logger.Info("Authentication method changed by another instance", "id", data.ID, "enabled", data.Enabled)
+
+	case eventAllowlist:
+		var data allowlistEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			m.logger.Warn("Ignoring invalid event", "event", event.Type, "error", err)
+			return
+		}
+		emails := data.Emails
+		if data.Restore {
+			emails = m.config.AccessControl.Emails
+		}
+		if err := m.setAllowlist(emails); err != nil {
+			m.logger.Warn("Ignoring allowlist event", "error", err)
+			return
+		}
+		m.logger.Info("Allowlist changed by another instance", "entries", len(emails), "restored", data.Restore)
+
+	case eventSessionsRevoked:
+		var data sessionsRevokedEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			m.logger.Warn("Ignoring invalid event", "event", event.Type, "error", err)
+			return
+		}
+		m.recordRevocation(data.Email, data.RevokedAt)
+		m.logger.Info("Sessions revoked by another instance", "email", m.logEmail(data.Email))
+
+	case eventAnnouncement:
+		var data announcementEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			m.logger.Warn("Ignoring invalid event", "event", event.Type, "error", err)
+			return
+		}
+		if data.Restore {
+			data.Announcement = nil
+		} else if data.Announcement == nil {
+			data.Announcement = &config.AnnouncementConfig{}
+		}
+		m.setAnnouncement(data.Announcement)
+		m.logger.Info("Announcement changed by another instance", "restored", data.Restore)
+
+	default:
+		m.logger.Debug("Ignoring unknown event", "event", event.Type)
+	}
+}
+
+// recordRevocation rejects the sessions of email created before revokedAt from now on
+// Revocations older than the session lifetime are dropped, since their sessions have expired.
+func (m *Middleware) recordRevocation(email string, revokedAt time.Time) {
+	expired := m.clock.Now().Add(-m.sessionLifetime())
+
+	m.revokedSessionsMu.Lock()
+	defer m.revokedSessionsMu.Unlock()
+	if m.revokedSessions == nil {
+		m.revokedSessions = make(map[string]time.Time)
+	}
+	for e, at := range m.revokedSessions {
+		if at.Before(expired) {
+			delete(m.revokedSessions, e)
+		}
+	}
+	email = strings.ToLower(email)
+	if revokedAt.After(m.revokedSessions[email]) {
+		m.revokedSessions[email] = revokedAt
+	}
+}
+
+// isSessionRevoked reports whether sess was created before the sessions of its user were revoked
+func (m *Middleware) isSessionRevoked(sess *session.Session) bool {
+	if sess.Email == "" {
+		return false
+	}
+	m.revokedSessionsMu.RLock()
+	defer m.revokedSessionsMu.RUnlock()
+	revokedAt, ok := m.revokedSessions[strings.ToLower(sess.Email)]
+	return ok && !sess.CreatedAt.After(revokedAt)
+}
@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// newClusterTestMiddleware creates a middleware with a Redis session store, the admin API
+// and an email allowlist, as one instance of a cluster sharing the Redis server
+func newClusterTestMiddleware(t *testing.T, server *miniredis.Miniredis) (*Middleware, kvs.Store) {
+	t.Helper()
+
+	sessionStore, err := kvs.NewRedisStore("session", kvs.RedisConfig{Addr: server.Addr()})
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	t.Cleanup(func() { _ = sessionStore.Close() })
+
+	cfg := newTestConfig()
+	cfg.Server.AdminToken = testAdminToken
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "google", Type: "google"}}
+	cfg.AccessControl.Emails = []string{"alice@example.com", "@example.org"}
+
+	manager := oauth2.NewManager()
+	manager.AddProvider(&mockProvider{name: "google"})
+	mw, err := New(
+		cfg,
+		sessionStore,
+		manager,
+		nil, // email handler
+		nil, // password handler
+		authz.NewEmailChecker(cfg.AccessControl),
+		nil, // forwarder
+		nil, // rules evaluator
+		i18n.NewTranslator(),
+		logging.NewTestLogger(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	return mw, sessionStore
+}
+
+// eventually polls cond until it holds, as events are delivered asynchronously
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventBus_AuthMethod(t *testing.T) {
+	server := miniredis.RunT(t)
+	mw1, _ := newClusterTestMiddleware(t, server)
+	mw2, _ := newClusterTestMiddleware(t, server)
+
+	if err := mw1.SetAuthMethodEnabled("google", false); err != nil {
+		t.Fatalf("SetAuthMethodEnabled() error = %v", err)
+	}
+	eventually(t, func() bool { return !mw2.isAuthMethodEnabled("google") }, "google was not disabled on the other instance")
+
+	if err := mw2.SetAuthMethodEnabled("google", true); err != nil {
+		t.Fatalf("SetAuthMethodEnabled() error = %v", err)
+	}
+	eventually(t, func() bool { return mw1.isAuthMethodEnabled("google") }, "google was not re-enabled on the other instance")
+}
+
+func TestEventBus_Stop(t *testing.T) {
+	server := miniredis.RunT(t)
+	mw1, _ := newClusterTestMiddleware(t, server)
+	mw2, _ := newClusterTestMiddleware(t, server)
+	mw3, _ := newClusterTestMiddleware(t, server)
+
+	// A middleware replaced by a reload no longer applies the events
+	mw2.StopEventBus()
+	mw2.StopEventBus()
+	if err := mw1.SetAuthMethodEnabled("google", false); err != nil {
+		t.Fatalf("SetAuthMethodEnabled() error = %v", err)
+	}
+	eventually(t, func() bool { return !mw3.isAuthMethodEnabled("google") }, "google was not disabled on the subscribed instance")
+	time.Sleep(50 * time.Millisecond)
+	if !mw2.isAuthMethodEnabled("google") {
+		t.Error("an unsubscribed instance applied the event")
+	}
+}
+
+func TestEventBus_Allowlist(t *testing.T) {
+	server := miniredis.RunT(t)
+	mw1, _ := newClusterTestMiddleware(t, server)
+	mw2, _ := newClusterTestMiddleware(t, server)
+
+	req := adminRequest(http.MethodPut, "/_auth/admin/allowlist", testAdminToken)
+	req.Body = io.NopCloser(strings.NewReader(`{"emails":["bob@example.com"]}`))
+	rec := httptest.NewRecorder()
+	mw1.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT allowlist status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	eventually(t, func() bool {
+		return mw2.authzChecker.IsAllowed("bob@example.com") && !mw2.authzChecker.IsAllowed("alice@example.com")
+	}, "allowlist was not replaced on the other instance")
+
+	rec = httptest.NewRecorder()
+	mw2.ServeHTTP(rec, adminRequest(http.MethodDelete, "/_auth/admin/allowlist", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE allowlist status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	eventually(t, func() bool {
+		return mw1.authzChecker.IsAllowed("alice@example.com") && !mw1.authzChecker.IsAllowed("bob@example.com")
+	}, "allowlist was not restored on the other instance")
+}
+
+func TestEventBus_RevokeSessions(t *testing.T) {
+	server := miniredis.RunT(t)
+	mw1, store := newClusterTestMiddleware(t, server)
+	mw2, _ := newClusterTestMiddleware(t, server)
+
+	now := time.Now()
+	for id, email := range map[string]string{"alice-1": "alice@example.com", "alice-2": "Alice@Example.com", "carol": "carol@example.org"} {
+		if err := session.Set(store, id, &session.Session{
+			ID:            id,
+			Email:         email,
+			Provider:      "google",
+			CreatedAt:     now.Add(-time.Minute),
+			ExpiresAt:     now.Add(time.Hour),
+			Authenticated: true,
+		}); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	deleted, err := mw1.RevokeSessions(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("RevokeSessions() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("RevokeSessions() deleted = %d, want 2", deleted)
+	}
+	if _, err := session.Get(store, "carol"); err != nil {
+		t.Errorf("Session of another user was deleted: %v", err)
+	}
+
+	// The other instance also rejects sessions it may still have cached, but not newer ones
+	old := &session.Session{Email: "alice@example.com", CreatedAt: now.Add(-time.Minute)}
+	eventually(t, func() bool { return mw2.isSessionRevoked(old) }, "revocation was not received by the other instance")
+	if mw2.isSessionRevoked(&session.Session{Email: "alice@example.com", CreatedAt: time.Now().Add(time.Second)}) {
+		t.Error("Sessions created after the revocation should be accepted")
+	}
+}
+
+func TestAdmin_Allowlist(t *testing.T) {
+	mw, _ := newClusterTestMiddleware(t, miniredis.RunT(t))
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/allowlist", testAdminToken))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"@example.org"`) {
+		t.Fatalf("GET allowlist = %d %s, want the configured entries", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"empty list", http.MethodPut, `{"emails":[]}`, http.StatusBadRequest},
+		{"invalid entry", http.MethodPut, `{"emails":["not-an-email"]}`, http.StatusBadRequest},
+		{"invalid JSON", http.MethodPut, `nope`, http.StatusBadRequest},
+		{"wrong method", http.MethodPost, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := adminRequest(tt.method, "/_auth/admin/allowlist", testAdminToken)
+			req.Body = io.NopCloser(strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// Without an email allowlist checker there is nothing to edit
+	rec = httptest.NewRecorder()
+	newAdminTestMiddleware(t).ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/allowlist", testAdminToken))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status without allowlist = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdmin_RevokeSessions(t *testing.T) {
+	mw, store := newTestMiddleware(t, func() *config.Config {
+		cfg := newTestConfig()
+		cfg.Server.AdminToken = testAdminToken
+		return cfg
+	}())
+
+	sess := &session.Session{
+		ID:            "alice",
+		Email:         "alice@example.com",
+		CreatedAt:     time.Now().Add(-time.Minute),
+		ExpiresAt:     time.Now().Add(time.Hour),
+		Authenticated: true,
+	}
+	if err := session.Set(store, sess.ID, sess); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	req := adminRequest(http.MethodPost, "/_auth/admin/sessions/revoke", testAdminToken)
+	req.Body = io.NopCloser(strings.NewReader(`{"email":"alice@example.com"}`))
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted":1`) {
+		t.Fatalf("Revoke = %d %s, want 1 deleted session", rec.Code, rec.Body.String())
+	}
+	if !mw.isSessionRevoked(sess) {
+		t.Error("Revoked session should be rejected")
+	}
+
+	req = adminRequest(http.MethodPost, "/_auth/admin/sessions/revoke", testAdminToken)
+	req.Body = io.NopCloser(strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status without email = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
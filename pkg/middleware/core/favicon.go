@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// rootIconPaths are the site icon paths browsers request without being told (e.g. on bookmarking)
+var rootIconPaths = map[string]bool{
+	"/favicon.ico":                      true,
+	"/apple-touch-icon.png":             true,
+	"/apple-touch-icon-precomposed.png": true,
+}
+
+// favicon is the operator-supplied favicon file (service.favicon)
+type favicon struct {
+	name  string // Name under /assets/, e.g. "favicon.png"
+	asset assets.Asset
+}
+
+// loadFavicon reads the favicon file of the service (nil when none is configured)
+func loadFavicon(service config.ServiceConfig) (*favicon, error) {
+	if service.Favicon == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(service.Favicon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service.favicon: %w", err)
+	}
+	return &favicon{
+		name:  "favicon" + strings.ToLower(filepath.Ext(service.Favicon)),
+		asset: assets.NewAsset(data),
+	}, nil
+}
+
+// faviconURL returns the URL and content type of the auth pages' icon: the favicon file,
+// service.icon_url (content type unknown), or the embedded ChatbotGate icon
+func (m *Middleware) faviconURL() (string, string) {
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+	switch {
+	case m.favicon != nil:
+		return joinAuthPath(prefix, "/assets/"+assets.Fingerprint(m.favicon.name, m.favicon.asset.Hash)), m.config.Service.FaviconType()
+	case m.config.Service.IconURL != "":
+		return m.config.Service.IconURL, ""
+	default:
+		return assetURL(prefix, "icons/chatbotgate.svg"), "image/svg+xml"
+	}
+}
+
+// buildIconLinksHTML generates the favicon, apple-touch-icon and web manifest link tags
+// iOS ignores SVG touch icons, so apple-touch-icon is only linked for other images
+func (m *Middleware) buildIconLinksHTML() string {
+	iconURL, iconType := m.faviconURL()
+	links := `<link rel="icon" href="` + template.HTMLEscapeString(iconURL) + `"`
+	if iconType != "" {
+		links += ` type="` + iconType + `"`
+	}
+	links += `>`
+	if iconType != "image/svg+xml" {
+		links += `
+<link rel="apple-touch-icon" href="` + template.HTMLEscapeString(iconURL) + `">`
+	}
+	manifestPath := joinAuthPath(m.config.Server.GetPublicAuthPathPrefix(), "/manifest.webmanifest")
+	return links + `
+<link rel="manifest" href="` + template.HTMLEscapeString(manifestPath) + `">`
+}
+
+// webManifest is a minimal web app manifest, so bookmarked and installed auth pages carry the service name and icon
+type webManifest struct {
+	Name        string            `json:"name"`
+	ShortName   string            `json:"short_name"`
+	Description string            `json:"description,omitempty"`
+	StartURL    string            `json:"start_url"`
+	Display     string            `json:"display"`
+	ThemeColor  string            `json:"theme_color,omitempty"`
+	Icons       []webManifestIcon `json:"icons"`
+}
+
+// webManifestIcon is an icon of a web app manifest
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type,omitempty"`
+}
+
+// buildWebManifest generates the web manifest of the service
+func (m *Middleware) buildWebManifest() assets.Asset {
+	iconURL, iconType := m.faviconURL()
+	data, _ := json.Marshal(webManifest{
+		Name:        m.config.Service.Name,
+		ShortName:   m.config.Service.Name,
+		Description: m.config.Service.Description,
+		StartURL:    "/",
+		Display:     "browser",
+		ThemeColor:  m.config.Service.Theme.PrimaryColor,
+		Icons:       []webManifestIcon{{Src: iconURL, Sizes: "any", Type: iconType}},
+	})
+	return assets.NewAsset(data)
+}
+
+// handleWebManifest serves the web manifest, revalidated by ETag since its URL is not fingerprinted
+func (m *Middleware) handleWebManifest(w http.ResponseWriter, r *http.Request) {
+	serveAsset(w, r, "application/manifest+json", m.staticFragments().manifest, "no-cache")
+}
+
+// redirectRootIcon sends browsers asking for /favicon.ico or an apple-touch-icon before signing in
+// to the icon of the auth pages, instead of the login page
+func (m *Middleware) redirectRootIcon(w http.ResponseWriter, r *http.Request) bool {
+	if !rootIconPaths[r.URL.Path] {
+		return false
+	}
+	iconURL, _ := m.faviconURL()
+	http.Redirect(w, r, iconURL, http.StatusFound)
+	return true
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// getPage serves a GET request to path and returns the recorder
+func getPage(mw *Middleware, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestFavicon_Default(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	iconURL := "/_auth/assets/" + assets.FingerprintedName("icons/chatbotgate.svg")
+
+	body := getPage(mw, "/_auth/login").Body.String()
+	for _, want := range []string{
+		`<link rel="icon" href="` + iconURL + `" type="image/svg+xml">`,
+		`<link rel="manifest" href="/_auth/manifest.webmanifest">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("login page does not contain %q", want)
+		}
+	}
+	if strings.Contains(body, "apple-touch-icon") {
+		t.Error("an SVG icon should not be linked as apple-touch-icon")
+	}
+
+	// Browsers asking for the root icons before signing in are sent to the icon, not the login page
+	for _, path := range []string{"/favicon.ico", "/apple-touch-icon.png", "/apple-touch-icon-precomposed.png"} {
+		rec := getPage(mw, path)
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != iconURL {
+			t.Errorf("%s: status = %d, Location = %q, want a redirect to %q", path, rec.Code, rec.Header().Get("Location"), iconURL)
+		}
+	}
+	if rec := getPage(mw, iconURL); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("icon: status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestFavicon_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brand.png")
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	if err := os.WriteFile(path, png, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig()
+	cfg.Service.Favicon = path
+	cfg.Service.IconURL = "https://cdn.example.com/icon.svg" // The file takes precedence
+	mw, _ := newTestMiddleware(t, cfg)
+	iconURL := "/_auth/assets/" + assets.Fingerprint("favicon.png", assets.NewAsset(png).Hash)
+
+	body := getPage(mw, "/_auth/login").Body.String()
+	for _, want := range []string{
+		`<link rel="icon" href="` + iconURL + `" type="image/png">`,
+		`<link rel="apple-touch-icon" href="` + iconURL + `">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("login page does not contain %q", want)
+		}
+	}
+
+	rec := getPage(mw, iconURL)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(png) {
+		t.Fatalf("favicon: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("favicon: Content-Type = %q, Cache-Control = %q", rec.Header().Get("Content-Type"), rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestFavicon_IconURL(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.IconURL = "https://cdn.example.com/icon.png"
+	mw, _ := newTestMiddleware(t, cfg)
+
+	body := getPage(mw, "/_auth/login").Body.String()
+	for _, want := range []string{
+		`<link rel="icon" href="https://cdn.example.com/icon.png">`,
+		`<link rel="apple-touch-icon" href="https://cdn.example.com/icon.png">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("login page does not contain %q", want)
+		}
+	}
+	if rec := getPage(mw, "/favicon.ico"); rec.Header().Get("Location") != cfg.Service.IconURL {
+		t.Errorf("/favicon.ico redirects to %q, want %q", rec.Header().Get("Location"), cfg.Service.IconURL)
+	}
+}
+
+func TestFavicon_MissingFile(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.Favicon = filepath.Join(t.TempDir(), "missing.ico")
+	store, _ := kvs.NewMemoryStore("test", kvs.MemoryConfig{})
+	defer func() { _ = store.Close() }()
+
+	_, err := New(cfg, store, oauth2.NewManager(), nil, nil, nil, nil, nil, i18n.NewTranslator(), logging.NewTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "service.favicon") {
+		t.Errorf("New() error = %v, want a service.favicon read error", err)
+	}
+}
+
+func TestWebManifest(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.Description = "Internal assistant"
+	cfg.Service.Theme.PrimaryColor = "#0ea5e9"
+	mw, _ := newTestMiddleware(t, cfg)
+
+	rec := getPage(mw, "/_auth/manifest.webmanifest")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Header().Get("Content-Type") != "application/manifest+json" || rec.Header().Get("ETag") == "" {
+		t.Errorf("Content-Type = %q, ETag = %q", rec.Header().Get("Content-Type"), rec.Header().Get("ETag"))
+	}
+
+	var manifest webManifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if manifest.Name != "Test Service" || manifest.Description != "Internal assistant" || manifest.ThemeColor != "#0ea5e9" || manifest.StartURL != "/" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if len(manifest.Icons) != 1 || manifest.Icons[0].Src != "/_auth/assets/"+assets.FingerprintedName("icons/chatbotgate.svg") {
+		t.Errorf("manifest icons = %+v", manifest.Icons)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// forwardingAuditHashPrefix marks the hashed values of the audit log in privacy mode
+const forwardingAuditHashPrefix = "hmac-sha256:"
+
+// Audit log files by path, shared by the middleware of all tenants and of reloaded configurations
+// so that a single writer rotates each file. Rotation settings apply from the first use of a path.
+var (
+	forwardingAuditLogs   = make(map[string]io.Writer)
+	forwardingAuditLogsMu sync.Mutex
+)
+
+// forwardingAuditLog returns the writer of the audit log file of cfg
+func forwardingAuditLog(cfg config.FileLoggingConfig) io.Writer {
+	forwardingAuditLogsMu.Lock()
+	defer forwardingAuditLogsMu.Unlock()
+
+	if w, ok := forwardingAuditLogs[cfg.Path]; ok {
+		return w
+	}
+	w := logging.NewRotatingFile(logging.FileRotationConfig{
+		Path:       cfg.Path,
+		MaxSizeMB:  cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	})
+	forwardingAuditLogs[cfg.Path] = w
+	return w
+}
+
+// forwardingAuditRecord is a line of the forwarding audit log
+type forwardingAuditRecord struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id,omitempty"` // X-Request-ID of the request, if any
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Provider  string            `json:"provider"`
+	User      string            `json:"user"`             // Email, or the guest ID of guests
+	Fields    map[string]string `json:"fields"`           // Forwarded values by destination (e.g., "header:X-Email", "body:user", "dify:user")
+	Hashed    bool              `json:"hashed,omitempty"` // User and field values are keyed hashes (privacy mode)
+}
+
+// auditForwarding writes the identity forwarded with the request to the audit log (forwarding.audit)
+// difyUser is the user set on Dify API requests, or "".
+func (m *Middleware) auditForwarding(r *http.Request, sess *session.Session, difyUser string) {
+	if m.forwardingAudit == nil {
+		return
+	}
+
+	fields := make(map[string]string)
+	var bodyPaths []string
+	for _, field := range m.config.Forwarding.EffectiveFields() {
+		if field.Header != "" {
+			if value := r.Header.Get(field.Header); value != "" {
+				fields["header:"+http.CanonicalHeaderKey(field.Header)] = value
+			}
+		}
+		if field.Body != "" {
+			bodyPaths = append(bodyPaths, field.Body)
+		}
+	}
+	for path, value := range forwarding.JSONBodyFields(r, bodyPaths) {
+		fields["body:"+path] = value
+	}
+	if difyUser != "" {
+		fields["dify:user"] = difyUser
+	}
+
+	user := sess.Email
+	if user == "" {
+		user, _ = sess.Extra[guestIDKey].(string)
+	}
+
+	record := forwardingAuditRecord{
+		Time:      m.clock.Now().UTC(),
+		RequestID: r.Header.Get(requestIDHeader),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Provider:  sess.Provider,
+		User:      user,
+		Fields:    fields,
+	}
+	if m.config.Forwarding.Audit.Privacy {
+		record.User = m.auditHash(record.User)
+		for k, v := range record.Fields {
+			record.Fields[k] = m.auditHash(v)
+		}
+		record.Hashed = true
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		m.logger.Warn("Failed to encode forwarding audit record", "error", err)
+		return
+	}
+	if _, err := m.forwardingAudit.Write(append(data, '\n')); err != nil {
+		m.logger.Warn("Failed to write forwarding audit record", "error", err)
+	}
+}
+
+// auditHash returns the keyed hash of an audit log value in privacy mode
+// The key derives from session.cookie.secret: equal values have equal hashes, which cannot be
+// checked against guessed values without the secret.
+func (m *Middleware) auditHash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte("forwarding-audit:"+m.config.Session.Cookie.Secret))
+	mac.Write([]byte(value))
+	return forwardingAuditHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
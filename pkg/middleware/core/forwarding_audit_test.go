@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// newAuditTestMiddleware returns a middleware forwarding the email as a header and a body field,
+// with its audit records written to the returned buffer
+func newAuditTestMiddleware(t *testing.T, privacy bool) (*Middleware, *bytes.Buffer, string) {
+	t.Helper()
+
+	cfg := newTestConfig()
+	cfg.Forwarding = config.ForwardingConfig{
+		Fields: []config.ForwardingField{
+			{Path: "email", Header: "X-Email", Body: "user"},
+			{Path: "username", Header: "x-user-name"},
+		},
+		Audit: config.ForwardingAuditConfig{Privacy: privacy},
+	}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.forwarder = newTestForwarder(t, &cfg.Forwarding)
+	var buf bytes.Buffer
+	mw.forwardingAudit = &buf
+	return mw, &buf, storeTestSession(t, store, "user@example.com")
+}
+
+func auditRequest(t *testing.T, mw *Middleware, sessionID string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat-messages", strings.NewReader(`{"query":"hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, "req-123")
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+	rec := httptest.NewRecorder()
+	mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", rec.Code)
+	}
+}
+
+func TestForwardingAudit(t *testing.T) {
+	mw, buf, sessionID := newAuditTestMiddleware(t, false)
+	auditRequest(t, mw, sessionID)
+
+	var record forwardingAuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Audit log %q: %v", buf.String(), err)
+	}
+	if record.User != "user@example.com" || record.Provider != "google" || record.Hashed {
+		t.Errorf("Record = %+v", record)
+	}
+	if record.Method != http.MethodPost || record.Path != "/v1/chat-messages" || record.RequestID != "req-123" {
+		t.Errorf("Request of the record = %s %s (%s)", record.Method, record.Path, record.RequestID)
+	}
+	want := map[string]string{
+		"header:X-Email":     "user@example.com",
+		"header:X-User-Name": "Test User",
+		"body:user":          "user@example.com",
+	}
+	if len(record.Fields) != len(want) {
+		t.Errorf("Fields = %v, want %v", record.Fields, want)
+	}
+	for k, v := range want {
+		if record.Fields[k] != v {
+			t.Errorf("Fields[%s] = %q, want %q", k, record.Fields[k], v)
+		}
+	}
+}
+
+func TestForwardingAudit_Privacy(t *testing.T) {
+	mw, buf, sessionID := newAuditTestMiddleware(t, true)
+	auditRequest(t, mw, sessionID)
+	auditRequest(t, mw, sessionID)
+
+	if strings.Contains(buf.String(), "user@example.com") || strings.Contains(buf.String(), "Test User") {
+		t.Fatalf("Audit log in privacy mode has plain values: %s", buf.String())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Audit log has %d records, want 2", len(lines))
+	}
+	var record, again forwardingAuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.User != record.User || again.Fields["header:X-User-Name"] != record.Fields["header:X-User-Name"] {
+		t.Errorf("Hashes of the same values differ: %s", buf.String())
+	}
+	if !record.Hashed || !strings.HasPrefix(record.User, forwardingAuditHashPrefix) {
+		t.Errorf("User = %q, want a hash", record.User)
+	}
+	// The same value has the same hash, wherever it is
+	if record.Fields["header:X-Email"] != record.User || record.Fields["body:user"] != record.User {
+		t.Errorf("Fields = %v, want the hash of the user for the email", record.Fields)
+	}
+}
+
+func TestForwardingAudit_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := newTestConfig()
+	cfg.Forwarding.Audit = config.ForwardingAuditConfig{Enabled: true, File: config.FileLoggingConfig{Path: path}}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	// A reloaded middleware shares the writer of the file
+	reloaded, _ := newTestMiddleware(t, cfg)
+	if reloaded.forwardingAudit != mw.forwardingAudit {
+		t.Error("Middleware with the same audit log path should share its writer")
+	}
+
+	auditRequest(t, mw, sessionID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"user":"user@example.com"`) {
+		t.Errorf("Audit log = %q", data)
+	}
+}
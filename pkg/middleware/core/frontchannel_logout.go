@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// frontchannelLogoutPage is the empty page rendered in the provider's logout iframe
+const frontchannelLogoutPage = `<!DOCTYPE html><html><head><meta charset="utf-8"><title>Logged out</title></head><body></body></html>`
+
+// handleFrontchannelLogout handles OIDC front-channel logout requests (GET /_auth/oauth2/frontchannel-logout)
+// The provider's logout page loads this URL in an iframe. The session of the cookie is deleted when it is
+// a session of a provider with frontchannel_logout, and with "iss" and "sid" the sessions of that provider
+// session are deleted server side too, since browsers may not send the cookie to third-party iframes.
+func (m *Middleware) handleFrontchannelLogout(w http.ResponseWriter, r *http.Request) {
+	if !m.hasFrontchannelLogout() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The spec requires both parameters when either is sent
+	issuer, sid := r.URL.Query().Get("iss"), r.URL.Query().Get("sid")
+	if (issuer == "") != (sid == "") {
+		http.Error(w, "iss and sid must be sent together", http.StatusBadRequest)
+		return
+	}
+	providerName := ""
+	if issuer != "" {
+		name, ok := m.oauthManager.ProviderByIssuer(issuer)
+		if !ok || !m.acceptsFrontchannelLogout(name) {
+			m.logger.Warn("Front-channel logout rejected: unknown issuer", "issuer", issuer)
+			http.Error(w, "Unknown issuer", http.StatusBadRequest)
+			return
+		}
+		providerName = name
+
+		deleted, err := m.logoutProviderSessions(r.Context(), name, &oauth2.LogoutClaims{Issuer: issuer, SessionID: sid})
+		if err != nil {
+			m.logger.Error("Front-channel logout failed: could not delete sessions", "provider", name, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		m.logger.Info("Front-channel logout", "provider", name, "by_sid", true, "deleted", deleted)
+	}
+
+	if cookie, err := r.Cookie(m.config.Session.Cookie.Name); err == nil {
+		// Sessions of other providers, or of other provider sessions, are kept
+		sess, err := session.Get(m.sessionStore, cookie.Value)
+		matches := err != nil || (m.acceptsFrontchannelLogout(sess.Provider) &&
+			(providerName == "" || (sess.Provider == providerName && sess.ProviderSID == sid)))
+		if matches {
+			if err == nil {
+				_ = session.Delete(m.sessionStore, cookie.Value)
+				m.logger.Info("Front-channel logout", "provider", sess.Provider, "by_sid", false, "deleted", 1)
+			}
+
+			// Browsers store the cleared cookie in the provider's iframe only with samesite "none"
+			http.SetCookie(w, &http.Cookie{
+				Name:     m.config.Session.Cookie.Name,
+				Value:    "",
+				Path:     m.config.Server.GetCookiePath(),
+				Domain:   m.config.Session.Cookie.Domain,
+				MaxAge:   -1,
+				HttpOnly: true,
+				Secure:   m.config.Session.Cookie.Secure,
+				SameSite: m.config.Session.Cookie.GetSameSite(),
+			})
+		}
+	}
+
+	// The page is framed by the provider, so frame-ancestors and X-Frame-Options are not set
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(frontchannelLogoutPage))
+}
+
+// hasFrontchannelLogout reports whether any OAuth2 provider is configured with frontchannel_logout
+func (m *Middleware) hasFrontchannelLogout() bool {
+	if m.oauthManager == nil {
+		return false
+	}
+	for _, p := range m.config.OAuth2.Providers {
+		if p.FrontchannelLogout && !p.Disabled {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsFrontchannelLogout reports whether the OAuth2 provider is configured with frontchannel_logout
+func (m *Middleware) acceptsFrontchannelLogout(providerName string) bool {
+	for _, p := range m.config.OAuth2.Providers {
+		if p.ID == providerName {
+			return p.FrontchannelLogout && !p.Disabled
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+func TestFrontchannelLogout(t *testing.T) {
+	mw, store, server := newBackchannelTestMiddleware(t)
+
+	now := time.Now()
+	for _, s := range []*session.Session{
+		{ID: "laptop", Provider: "idp", Subject: "alice", ProviderSID: "sid-laptop"},
+		{ID: "phone", Provider: "idp", Subject: "alice", ProviderSID: "sid-phone"},
+		{ID: "google", Provider: "google", Subject: "alice"},
+	} {
+		s.CreatedAt, s.ExpiresAt, s.Authenticated = now, now.Add(time.Hour), true
+		if err := session.Set(store, s.ID, s); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	exists := func(id string) bool {
+		_, err := session.Get(store, id)
+		return err == nil
+	}
+	logout := func(query url.Values, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/frontchannel-logout?"+query.Encode(), nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "_test_session", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Not found until a provider enables it
+	if rec := logout(nil, "laptop"); rec.Code != http.StatusNotFound || !exists("laptop") {
+		t.Fatalf("Disabled status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	mw.config.OAuth2.Providers[0].FrontchannelLogout = true
+
+	// "iss" and "sid" log out the provider session without the cookie
+	rec := logout(url.Values{"iss": {server.URL}, "sid": {"sid-laptop"}}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Logout status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Header().Get("X-Frame-Options") != "" || rec.Header().Get("Cache-Control") != "no-cache, no-store" {
+		t.Errorf("Headers = %v, want a frameable, uncached page", rec.Header())
+	}
+	if exists("laptop") || !exists("phone") {
+		t.Errorf("laptop exists = %v, phone exists = %v, want only the laptop logged out", exists("laptop"), exists("phone"))
+	}
+
+	// Without parameters, the session of the cookie is logged out and the cookie cleared
+	rec = logout(nil, "phone")
+	if rec.Code != http.StatusOK || exists("phone") {
+		t.Errorf("Cookie logout status = %d, phone exists = %v, want it logged out", rec.Code, exists("phone"))
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Cookies = %v, want the session cookie cleared", cookies)
+	}
+
+	// Sessions of providers without frontchannel_logout are kept
+	if rec := logout(nil, "google"); rec.Code != http.StatusOK || !exists("google") || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("Other provider: status = %d, exists = %v, want the session kept", rec.Code, exists("google"))
+	}
+
+	// Invalid parameters
+	for name, query := range map[string]url.Values{
+		"iss without sid": {"iss": {server.URL}},
+		"unknown issuer":  {"iss": {"https://evil.example.com"}, "sid": {"sid-phone"}},
+	} {
+		if rec := logout(query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// browserNormalize applies what browsers do to a Location value before resolving it:
+// tabs and newlines are removed and backslashes are treated as slashes (WHATWG URL parsing)
+func browserNormalize(location string) string {
+	location = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(location)
+	return strings.ReplaceAll(location, "\\", "/")
+}
+
+// redirectHost returns the host a browser on base ends up at when redirected to location
+func redirectHost(t *testing.T, base, location string) (string, bool) {
+	t.Helper()
+	ref, err := url.Parse(strings.TrimLeft(browserNormalize(location), "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x0b\x0c\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f "))
+	if err != nil {
+		return "", false
+	}
+	baseURL, _ := url.Parse(base)
+	return strings.ToLower(baseURL.ResolveReference(ref).Hostname()), true
+}
+
+func FuzzIsValidRedirectURL(f *testing.F) {
+	seeds := []string{
+		"/", "/chat", "/chat?q=1#top", "//evil.com", "/\\evil.com", "\\/evil.com", "/\t/evil.com",
+		"/%2F%2Fevil.com", "/%2e%2e/%2e%2e/evil", "/..//evil.com", "https://evil.com", "/x://y",
+		"/\r\n/evil.com", "/@evil.com", " /evil", "/\x00/evil.com", "javascript:alert(1)",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, redirectURL string) {
+		if !isValidRedirectURL(redirectURL) {
+			return
+		}
+		if !strings.HasPrefix(browserNormalize(redirectURL), "/") {
+			t.Fatalf("isValidRedirectURL(%q) = true for a URL that is not a local path", redirectURL)
+		}
+		host, ok := redirectHost(t, "https://gate.example.com/", redirectURL)
+		if ok && host != "gate.example.com" {
+			t.Fatalf("isValidRedirectURL(%q) = true, but a browser leaves for %q", redirectURL, host)
+		}
+	})
+}
+
+func FuzzIsAllowedRedirectURL(f *testing.F) {
+	seeds := []string{
+		"/chat", "https://app.example.com/chat", "https://example.com", "https://evil.com",
+		"https://app.example.com.evil.com/", "https://evil.com\\@app.example.com/", "https://app.example.com\\.evil.com/",
+		"https://evil.com#.example.com", "https://evil.com?.example.com", "https://user@app.example.com/",
+		"https://EVIL.com%2f.example.com/", "http://app.example.com:8080/", "https:/\\evil.com", "//app.example.com/",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	cfg := newTestConfig()
+	cfg.Session.Cookie.Domain = ".example.com"
+	m := &Middleware{config: cfg}
+
+	f.Fuzz(func(t *testing.T, redirectURL string) {
+		if !m.isAllowedRedirectURL(redirectURL) {
+			return
+		}
+		host, ok := redirectHost(t, "https://gate.example.com/", redirectURL)
+		if !ok {
+			return
+		}
+		if host != "example.com" && !strings.HasSuffix(host, ".example.com") {
+			t.Fatalf("isAllowedRedirectURL(%q) = true, but a browser leaves for %q", redirectURL, host)
+		}
+	})
+}
+
+func FuzzJoinAuthPath(f *testing.F) {
+	seeds := [][2]string{
+		{"", "/login"}, {"/_auth", "/login"}, {"/_auth/", "login"}, {"_auth", "/oauth2/start/"},
+		{"/", "/login"}, {"//", "//login"}, {"/a/b", ""}, {"/_auth//", "/x"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, prefix, endpoint string) {
+		joined := joinAuthPath(prefix, endpoint)
+		if !strings.HasPrefix(joined, "/") {
+			t.Fatalf("joinAuthPath(%q, %q) = %q, want an absolute path", prefix, endpoint, joined)
+		}
+		if endpoint == "" || strings.HasPrefix(endpoint, "/") {
+			if !strings.HasSuffix(joined, endpoint) {
+				t.Fatalf("joinAuthPath(%q, %q) = %q, want it to end with the endpoint", prefix, endpoint, joined)
+			}
+		}
+		if !strings.Contains(prefix, "//") && !strings.Contains(endpoint, "//") && strings.Contains(joined, "//") {
+			t.Fatalf("joinAuthPath(%q, %q) = %q has a double slash at the join", prefix, endpoint, joined)
+		}
+	})
+}
+
+func FuzzExtractPathParam(f *testing.F) {
+	seeds := [][2]string{
+		{"/_auth/oauth2/start/google", "/_auth/oauth2/start/"},
+		{"/_auth/oauth2/start/google/", "/_auth/oauth2/start/"},
+		{"/_auth/oauth2/start/../admin", "/_auth/oauth2/start/"},
+		{"/_auth/admin/auth-methods/google/enable", "/_auth/admin/"},
+		{"/_auth/admin/auth-methods//enable", "/_auth/admin/"},
+		{"/_auth/api/metadata/theme?x=1", "/_auth/api/metadata/"},
+		{"/_auth/assets/icons/./google.svg", "/_auth/assets/icons/"},
+		{"/_auth/oauth2/start", "/_auth/oauth2/start/"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, path, prefix string) {
+		param := extractPathParam(path, prefix)
+		if param == "" {
+			return
+		}
+		if !strings.HasPrefix(path, prefix+param) {
+			t.Fatalf("extractPathParam(%q, %q) = %q, which does not follow the prefix", path, prefix, param)
+		}
+		if strings.Contains(param, "?") || strings.HasSuffix(param, "/") {
+			t.Fatalf("extractPathParam(%q, %q) = %q keeps a query or trailing slash", path, prefix, param)
+		}
+		for _, segment := range strings.Split(param, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				t.Fatalf("extractPathParam(%q, %q) = %q has an empty or dot segment", path, prefix, param)
+			}
+		}
+	})
+}
@@ -12,5 +12,7 @@ func TestMain(m *testing.M) {
 		// Ignore known background goroutines from external libraries
 		goleak.IgnoreTopFunction("internal/poll.runtime_pollWait"),
 		goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"),
+		// Audit log files stay open for the process (see forwardingAuditLog)
+		goleak.IgnoreTopFunction("gopkg.in/natefinch/lumberjack%2ev2.(*Logger).millRun"),
 	)
 }
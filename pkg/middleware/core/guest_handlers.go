@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// guestProvider is the session provider of anonymous guest sessions
+const guestProvider = "guest"
+
+// guestStartKeyPrefix is the prefix of the rate limit buckets of guest session starts in the session KVS, per client IP
+const guestStartKeyPrefix = "guest_start:"
+
+// guestIDKey is the session Extra key holding the anonymous guest identifier (e.g., "guest-1a2b3c4d5e6f7a8b")
+// Forward it with the "extra.guest_id" path to tell guests apart upstream
+const guestIDKey = "guest_id"
+
+// handleGuestStart starts an anonymous guest session (POST /_auth/guest/start)
+// Guests have no email and a request quota; signing in later replaces the guest session. A guest
+// starting again keeps its session and quota, and each client IP can only start a few sessions a minute.
+func (m *Middleware) handleGuestStart(w http.ResponseWriter, r *http.Request) {
+	if !m.config.Guest.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Never downgrade a signed-in user to a guest, and never renew the quota of a guest
+	if _, ok := m.lookupSession(r); ok {
+		http.Redirect(w, r, m.publicPath(m.getRedirectURL(w, r)), http.StatusFound)
+		return
+	}
+	if !m.guestStarts.Allow(guestStartKeyPrefix + clientIP(r)) {
+		m.logger.Warn("Guest session start rate limited", "remote_addr", r.RemoteAddr)
+		m.handleGuestLimit(w, r)
+		return
+	}
+	// The expired or revoked session of the cookie is replaced
+	if cookie, err := r.Cookie(m.config.Session.Cookie.Name); err == nil && cookie.Value != "" {
+		_ = session.Delete(m.sessionStore, cookie.Value)
+	}
+
+	sessionID, err := generateSessionID()
+	if err != nil {
+		m.logger.Error("Failed to generate session ID", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	guestID, err := generateGuestID()
+	if err != nil {
+		m.logger.Error("Failed to generate guest ID", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ttl := m.config.Guest.GetSessionTTL()
+	now := m.clock.Now()
+	sess := &session.Session{
+		ID:            sessionID,
+		Provider:      guestProvider,
+		Extra:         map[string]interface{}{guestIDKey: guestID},
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+		Authenticated: true,
+	}
+
+	if err := session.SetAt(m.sessionStore, sessionID, sess, now); err != nil {
+		m.logger.Error("Failed to store guest session", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.config.Session.Cookie.Name,
+		Value:    sessionID,
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: m.config.Session.Cookie.HTTPOnly,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: m.config.Session.Cookie.GetSameSite(),
+	})
+
+	m.logger.Info("Guest session started", "guest_id", guestID)
+
+	http.Redirect(w, r, m.publicPath(m.getRedirectURL(w, r)), http.StatusFound)
+}
+
+// consumeGuestQuota counts a guest request against the session's quota
+// Returns false (after rendering the sign-in prompt) when the quota is used up
+func (m *Middleware) consumeGuestQuota(w http.ResponseWriter, r *http.Request, sess *session.Session) bool {
+	guestCfg := m.config.Guest
+	if !guestCfg.CountsRequest(r.Method, r.URL.Path) {
+		return true
+	}
+
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	if err != nil {
+		return true // Not reachable: the session was looked up from this cookie
+	}
+
+	m.sessionWriteMu.Lock()
+	defer m.sessionWriteMu.Unlock()
+
+	// Re-read under the lock (past the session cache) so concurrent requests are all counted
+	if current, err := session.GetAt(kvs.Uncached(m.sessionStore), cookie.Value, m.clock.Now()); err == nil {
+		sess = current
+	}
+
+	if sess.Requests >= guestCfg.GetRequestLimit() {
+		m.logger.Debug("Guest quota exhausted", "guest_id", sess.Extra[guestIDKey], "path", r.URL.Path)
+		m.handleGuestLimit(w, r)
+		return false
+	}
+
+	sess.Requests++
+	if err := session.SetAt(m.sessionStore, cookie.Value, sess, m.clock.Now()); err != nil {
+		// Fail open like the email rate limiter: a KVS hiccup should not break the chat
+		m.logger.Warn("Failed to update guest quota", "error", err)
+	}
+	return true
+}
+
+// handleGuestLimit displays the sign-in prompt when a guest's quota is used up (429)
+func (m *Middleware) handleGuestLimit(w http.ResponseWriter, r *http.Request) {
+	lang := i18n.DetectLanguage(r)
+	theme := i18n.DetectTheme(r)
+	t := func(key string) string { return m.translator.T(lang, key) }
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+
+	// Build page data
+	pageData := m.buildPageData(lang, theme, config.PageGuestLimit, "error.guest_limit.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
+	pageData.Subtitle = t("error.guest_limit.heading")
+
+	message := m.config.Guest.UpgradeMessage
+	if message == "" {
+		message = t("error.guest_limit.message")
+	}
+
+	data := ErrorPageData{
+		PageData:    pageData,
+		Message:     message,
+		ActionURL:   joinAuthPath(prefix, "/login"),
+		ActionLabel: t("error.guest_limit.signin"),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Render template
+	if err := renderErrorTemplate(w, m.templates.guestLimit, data, http.StatusTooManyRequests, m); err != nil {
+		m.logger.Error("Failed to render guest limit template", "error", err)
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+}
+
+// generateGuestID generates a random, non-secret identifier for a guest session
+func generateGuestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return guestProvider + "-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+func TestHandleGuestStart(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		mw, _ := newTestMiddleware(t, newTestConfig())
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	cfg := newTestConfig()
+	cfg.Guest = config.GuestConfig{Enabled: true}
+	mw, store := newTestMiddleware(t, cfg)
+
+	t.Run("GET is rejected", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/guest/start", nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+		}
+	})
+
+	t.Run("creates a guest session", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil)
+		req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: "/chat"})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/chat" {
+			t.Errorf("Location = %q, want /chat", loc)
+		}
+
+		var sessionID string
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == cfg.Session.Cookie.Name {
+				sessionID = c.Value
+				if c.MaxAge != int(config.DefaultGuestSessionTTL.Seconds()) {
+					t.Errorf("cookie MaxAge = %d, want guest session TTL", c.MaxAge)
+				}
+			}
+		}
+		if sessionID == "" {
+			t.Fatal("Expected a session cookie")
+		}
+
+		sess, err := session.Get(store, sessionID)
+		if err != nil {
+			t.Fatalf("session.Get() error = %v", err)
+		}
+		if sess.Provider != guestProvider || sess.Email != "" {
+			t.Errorf("session provider = %q, email = %q, want guest without email", sess.Provider, sess.Email)
+		}
+		if id, _ := sess.Extra[guestIDKey].(string); !strings.HasPrefix(id, "guest-") {
+			t.Errorf("guest ID = %q, want guest- prefix", id)
+		}
+	})
+
+	t.Run("guests keep their session and quota", func(t *testing.T) {
+		sess := &session.Session{ID: "guest-session", Provider: guestProvider, Requests: 7, Authenticated: true,
+			CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+		if err := session.Set(store, sess.ID, sess); err != nil {
+			t.Fatalf("session.Set() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sess.ID})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == cfg.Session.Cookie.Name {
+				t.Errorf("Unexpected session cookie %q", c.Value)
+			}
+		}
+		if got, err := session.Get(store, sess.ID); err != nil || got.Requests != 7 {
+			t.Errorf("guest session = %+v, %v, want the quota kept", got, err)
+		}
+	})
+
+	t.Run("signed-in users keep their session", func(t *testing.T) {
+		sessionID := storeTestSession(t, store, "user@example.com")
+		req := httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == cfg.Session.Cookie.Name {
+				t.Errorf("Unexpected session cookie %q", c.Value)
+			}
+		}
+	})
+}
+
+func TestHandleGuestStart_RateLimit(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Guest = config.GuestConfig{Enabled: true, StartLimitPerMinute: 2}
+	mw, store := newTestMiddleware(t, cfg)
+
+	start := func(remoteAddr, forwardedFor, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// An expired guest session is replaced, not kept in the KVS
+	expired := &session.Session{ID: "expired-guest", Provider: guestProvider, Authenticated: true,
+		CreatedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)}
+	if err := session.SetAt(store, expired.ID, expired, expired.CreatedAt); err != nil {
+		t.Fatalf("session.SetAt() error = %v", err)
+	}
+	if rec := start("203.0.113.7:1234", "", expired.ID); rec.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if exists, _ := store.Exists(context.Background(), expired.ID); exists {
+		t.Error("expired guest session was kept")
+	}
+
+	if rec := start("203.0.113.7:1234", "", ""); rec.Code != http.StatusFound {
+		t.Fatalf("second start status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if rec := start("203.0.113.7:1234", "", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third start status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// Forged X-Forwarded-For from a public address does not escape the limit
+	if rec := start("203.0.113.7:1234", "198.51.100.1", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("forged X-Forwarded-For status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// Other clients, also behind a local reverse proxy, have their own limit
+	if rec := start("203.0.113.8:1234", "", ""); rec.Code != http.StatusFound {
+		t.Errorf("other client status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	if rec := start("127.0.0.1:1234", "198.51.100.1, 198.51.100.2", ""); rec.Code != http.StatusFound {
+		t.Errorf("client behind a proxy status = %d, want %d", rec.Code, http.StatusFound)
+	}
+}
+
+func TestGuestQuota(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Guest = config.GuestConfig{Enabled: true, RequestLimit: 2}
+	mw, _ := newTestMiddleware(t, cfg)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Start a guest session
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_auth/guest/start", nil))
+	var guestCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == cfg.Session.Cookie.Name {
+			guestCookie = c
+		}
+	}
+	if guestCookie == nil {
+		t.Fatal("Expected a guest session cookie")
+	}
+
+	send := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/chat", strings.NewReader(`{}`))
+		req.AddCookie(guestCookie)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := send(http.MethodPost); rec.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+
+	rec = send(http.MethodPost)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(rec.Body.String(), `href="/_auth/login"`) {
+		t.Error("Expected the sign-in prompt to link to the login page")
+	}
+
+	// Page loads are not counted
+	if rec := send(http.MethodGet); rec.Code != http.StatusOK {
+		t.Errorf("GET status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHandleLogin_Guest(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Guest = config.GuestConfig{Enabled: true, UpgradeMessage: "Sign in to save your chats."}
+	mw, store := newTestMiddleware(t, cfg)
+
+	rec := httptest.NewRecorder()
+	mw.handleLogin(rec, httptest.NewRequest(http.MethodGet, "/_auth/login", nil))
+	if !strings.Contains(rec.Body.String(), `action="/_auth/guest/start"`) {
+		t.Error("Expected the login page to offer guest access")
+	}
+
+	// Guests see the upgrade prompt instead of the guest button
+	if err := session.Set(store, "guest-session", &session.Session{
+		Provider:      guestProvider,
+		Authenticated: true,
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("session.Set() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: "guest-session"})
+	rec = httptest.NewRecorder()
+	mw.handleLogin(rec, req)
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "Sign in to save your chats.") {
+		t.Error("Expected the configured upgrade message")
+	}
+	if strings.Contains(body, `action="/_auth/guest/start"`) {
+		t.Error("Guests should not be offered guest access again")
+	}
+}
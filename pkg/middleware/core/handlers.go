@@ -1,103 +1,256 @@
 package middleware
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
-	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/session"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 )
 
 // handleLogin displays the login page using html/template
+// Rendered pages are cached per language, theme, notice, announcement and experiment variant (see loginPageCache)
 func (m *Middleware) handleLogin(w http.ResponseWriter, r *http.Request) {
-	lang := i18n.DetectLanguage(r)
-	theme := i18n.DetectTheme(r)
+	key := loginPageKey{
+		lang:  i18n.DetectLanguage(r),
+		theme: i18n.DetectTheme(r),
+		// Routes with step-up requirements send signed-in users back here
+		reauth: r.URL.Query().Get(reauthQuery) == "1",
+	}
+
+	// Guests are prompted to sign in to lift the quota
+	if m.config.Guest.Enabled {
+		if sess, ok := m.lookupSession(r); ok && sess.Provider == guestProvider {
+			key.guest = true
+		}
+	}
+
+	// The announcement banner, unless the visitor dismissed it
+	key.announcement = m.visibleAnnouncement(r)
+
+	// Visitors of the login experiment see the page of their variant
+	variant, assigned := m.loginVariant(r)
+	if variant != nil {
+		key.variant = variant.Name
+		if assigned {
+			m.setExperimentCookie(w, variant)
+		}
+		m.recordExperimentView(variant)
+	}
+
+	body, err := m.loginPage(key)
+	if err != nil {
+		m.logger.Error("Failed to render login template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	_ = m.writeHTML(w, http.StatusOK, body)
+}
+
+// loginPage returns the rendered login page variant of key, rendering it on first use
+func (m *Middleware) loginPage(key loginPageKey) ([]byte, error) {
+	body, generation, ok := m.loginPages.get(key)
+	if ok {
+		return body, nil
+	}
+
+	lang := key.lang
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 
 	// Build common page data
-	pageData := m.buildPageData(lang, theme, "login.title")
+	pageData := m.buildPageData(lang, key.theme, config.PageLogin, "login.title")
+	pageData.Announcement = m.announcementBanner(key.announcement, lang)
+
+	// Build provider data (ordered and grouped per configuration)
+	providerDataList := m.buildProviderDataList(t, prefix)
+	variant := m.experimentVariant(key.variant)
+	if variant != nil {
+		orderVariantProviders(providerDataList, variant.ProviderOrder)
+	}
+	sections, moreProviders := groupProviderData(providerDataList)
+
+	// Build login page data
+	data := LoginPageData{
+		PageData:         pageData,
+		Providers:        providerDataList,
+		ProviderSections: sections,
+		MoreProviders:    moreProviders,
+		EmailEnabled:     m.emailHandler != nil && m.isAuthMethodEnabled(authMethodEmail),
+		PasswordEnabled:  m.passwordHandler != nil && m.isAuthMethodEnabled(authMethodPassword),
+		EmailSendPath:    joinAuthPath(prefix, "/email/send"),
+		EmailIconPath:    assetURL(prefix, "icons/email.svg"),
+		GuestEnabled:     m.config.Guest.Enabled,
+		GuestStartPath:   joinAuthPath(prefix, "/guest/start"),
+		FragmentScript:   assetURL(prefix, "fragment.js"),
+		ButtonClass:      "btn-" + config.ButtonStyleSecondary,
+		Translations: LoginTranslations{
+			Or:            t("login.or"),
+			EmailLabel:    t("login.email.label"),
+			EmailSave:     t("login.email.save"),
+			EmailSubmit:   t("login.email.submit"),
+			ThemeAuto:     t("ui.theme.auto"),
+			ThemeLight:    t("ui.theme.light"),
+			ThemeDark:     t("ui.theme.dark"),
+			LanguageEn:    t("ui.language.en"),
+			LanguageJa:    t("ui.language.ja"),
+			LanguageAr:    t("ui.language.ar"),
+			LanguageHe:    t("ui.language.he"),
+			ThemeLabel:    t("ui.theme"),
+			LanguageLabel: t("ui.language"),
+			MoreOptions:   t("login.more_options"),
+			GuestContinue: t("login.guest.continue"),
+		},
+	}
+
+	if variant != nil {
+		applyLoginVariant(&data, variant)
+	}
+
+	if key.reauth {
+		data.ReauthNotice = t("login.reauth.notice")
+	}
+
+	if key.guest && data.GuestEnabled {
+		data.IsGuest = true
+		data.GuestNotice = m.config.Guest.UpgradeMessage
+		if data.GuestNotice == "" {
+			data.GuestNotice = t("login.guest.notice")
+		}
+	}
+
+	// Add password form HTML if enabled
+	if data.PasswordEnabled {
+		data.PasswordFormHTML = template.HTML(m.passwordHandler.RenderPasswordForm(lang))
+	}
+
+	var buf bytes.Buffer
+	if err := m.templates.login.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	body = buf.Bytes()
+	m.loginPages.put(key, generation, body)
+	return body, nil
+}
+
+// buildProviderDataList builds the login page data for all enabled OAuth2 providers
+// Providers are sorted by their configured order, then by position in the configuration;
+// providers without a configuration entry are listed last in name order
+func (m *Middleware) buildProviderDataList(t func(string) string, prefix string) []ProviderData {
+	// Index provider configuration by ID
+	configIndex := make(map[string]int)
+	for i, providerCfg := range m.config.OAuth2.Providers {
+		if _, exists := configIndex[providerCfg.ID]; !exists {
+			configIndex[providerCfg.ID] = i
+		}
+	}
 
-	// Build provider data
-	var providerDataList []ProviderData
 	providers := m.oauthManager.GetProviders()
+	sort.SliceStable(providers, func(i, j int) bool {
+		ci, iok := configIndex[providers[i].Name()]
+		cj, jok := configIndex[providers[j].Name()]
+		switch {
+		case iok && jok:
+			oi, oj := m.config.OAuth2.Providers[ci].Order, m.config.OAuth2.Providers[cj].Order
+			if oi != oj {
+				return oi < oj
+			}
+			return ci < cj
+		case iok != jok:
+			return iok
+		default:
+			return providers[i].Name() < providers[j].Name()
+		}
+	})
+
+	var providerDataList []ProviderData
 	for _, p := range providers {
 		providerName := p.Name()
 
-		// Find icon URL from config
-		var iconPath string
-		for _, providerCfg := range m.config.OAuth2.Providers {
-			if providerCfg.Type == providerName && providerCfg.IconURL != "" {
-				// Use custom icon URL from config
-				iconPath = providerCfg.IconURL
-				break
-			}
+		// Skip providers disabled at runtime via the admin API
+		if !m.isAuthMethodEnabled(providerName) {
+			continue
+		}
+
+		// Custom icon and display name from config
+		var providerCfg config.OAuth2Provider
+		if i, ok := configIndex[providerName]; ok {
+			providerCfg = m.config.OAuth2.Providers[i]
 		}
+		iconPath := providerCfg.IconSource()
 
-		// If no custom icon URL, use default embedded icon
+		// If no custom icon, use the default embedded icon of the provider type
 		if iconPath == "" {
-			iconName := providerName
+			iconName := providerCfg.Type
+			if iconName == "" {
+				iconName = providerName
+			}
 			knownIcons := map[string]bool{
 				"google":    true,
 				"github":    true,
 				"microsoft": true,
 				"facebook":  true,
 			}
-			if !knownIcons[providerName] {
+			if !knownIcons[iconName] {
 				iconName = "oidc" // Default to OIDC icon for custom providers
 			}
-			iconPath = joinAuthPath(prefix, "/assets/icons/"+iconName+".svg")
+			iconPath = assetURL(prefix, "icons/"+iconName+".svg")
 		}
 
-		providerDataList = append(providerDataList, ProviderData{
-			Name:     providerName,
-			IconPath: iconPath,
-			URL:      joinAuthPath(prefix, "/oauth2/start/"+providerName),
-			Label:    fmt.Sprintf(t("login.oauth2.continue"), providerName),
-		})
-	}
+		label := providerCfg.DisplayName
+		if label == "" {
+			label = providerName
+		}
 
-	// Build login page data
-	data := LoginPageData{
-		PageData:        pageData,
-		Providers:       providerDataList,
-		EmailEnabled:    m.emailHandler != nil,
-		PasswordEnabled: m.passwordHandler != nil,
-		EmailSendPath:   joinAuthPath(prefix, "/email/send"),
-		EmailIconPath:   joinAuthPath(prefix, "/assets/icons/email.svg"),
-		Translations: LoginTranslations{
-			Or:          t("login.or"),
-			EmailLabel:  t("login.email.label"),
-			EmailSave:   t("login.email.save"),
-			EmailSubmit: t("login.email.submit"),
-			ThemeAuto:   t("ui.theme.auto"),
-			ThemeLight:  t("ui.theme.light"),
-			ThemeDark:   t("ui.theme.dark"),
-			LanguageEn:  t("ui.language.en"),
-			LanguageJa:  t("ui.language.ja"),
-		},
-	}
+		data := ProviderData{
+			Name:        providerName,
+			IconPath:    template.URL(iconPath),
+			URL:         joinAuthPath(prefix, "/oauth2/start/"+providerName),
+			Label:       fmt.Sprintf(t("login.oauth2.continue"), label),
+			Section:     providerCfg.Section,
+			MoreOptions: providerCfg.MoreOptions,
+		}
 
-	// Add password form HTML if enabled
-	if m.passwordHandler != nil {
-		data.PasswordFormHTML = template.HTML(m.passwordHandler.RenderPasswordForm(lang))
+		providerDataList = append(providerDataList, data)
 	}
 
-	// Render template
-	if err := renderTemplate(w, m.templates.login, data, m); err != nil {
-		m.logger.Error("Failed to render login template", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	return providerDataList
+}
+
+// groupProviderData splits providers into headed sections and the "Other options" list
+// Sections appear in the order of their first provider; the order within a section is preserved
+func groupProviderData(providers []ProviderData) ([]ProviderSection, []ProviderData) {
+	var sections []ProviderSection
+	var more []ProviderData
+	sectionIndex := make(map[string]int)
+
+	for _, p := range providers {
+		if p.MoreOptions {
+			more = append(more, p)
+			continue
+		}
+		i, exists := sectionIndex[p.Section]
+		if !exists {
+			i = len(sections)
+			sectionIndex[p.Section] = i
+			sections = append(sections, ProviderSection{Heading: p.Section})
+		}
+		sections[i].Providers = append(sections[i].Providers, p)
 	}
+
+	return sections, more
 }
 
 // handleLogout logs out the user using html/template
@@ -105,7 +258,7 @@ func (m *Middleware) handleLogout(w http.ResponseWriter, r *http.Request) {
 	lang := i18n.DetectLanguage(r)
 	theme := i18n.DetectTheme(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 
 	// Get session cookie
 	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
@@ -118,13 +271,14 @@ func (m *Middleware) handleLogout(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     m.config.Session.Cookie.Name,
 		Value:    "",
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
 		MaxAge:   -1,
 		HttpOnly: true,
 	})
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "logout.title")
+	pageData := m.buildPageData(lang, theme, config.PageLogout, "logout.title")
 	pageData.Subtitle = t("logout.heading")
 
 	data := LogoutPageData{
@@ -147,10 +301,10 @@ func (m *Middleware) handleEmailSent(w http.ResponseWriter, r *http.Request) {
 	lang := i18n.DetectLanguage(r)
 	theme := i18n.DetectTheme(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "email.sent.title")
+	pageData := m.buildPageData(lang, theme, config.PageEmailSent, "email.sent.title")
 	pageData.Subtitle = t("email.sent.heading")
 
 	data := EmailSentPageData{
@@ -159,11 +313,16 @@ func (m *Middleware) handleEmailSent(w http.ResponseWriter, r *http.Request) {
 		Detail:         t("email.sent.detail"),
 		OTPLabel:       t("email.sent.otp_label"),
 		OTPPlaceholder: t("email.sent.otp_placeholder"),
+		OTPSegment:     t("email.sent.otp_segment"),
+		OTPScriptPath:  assetURL(prefix, "otp.js"),
 		VerifyButton:   t("email.sent.verify_button"),
 		BackLabel:      t("email.sent.back"),
 		LoginURL:       joinAuthPath(prefix, "/login"),
 		VerifyOTPPath:  joinAuthPath(prefix, "/email/verify-otp"),
 	}
+	if r.URL.Query().Get("error") == "invalid_otp" {
+		data.OTPError = t("email.sent.otp_invalid")
+	}
 
 	// Render template
 	if err := renderTemplate(w, m.templates.emailSent, data, m); err != nil {
@@ -175,13 +334,18 @@ func (m *Middleware) handleEmailSent(w http.ResponseWriter, r *http.Request) {
 
 // handleForbidden displays the access denied page using html/template
 func (m *Middleware) handleForbidden(w http.ResponseWriter, r *http.Request) {
+	if m.serveConfiguredError(w, r, http.StatusForbidden) {
+		return
+	}
+
 	lang := i18n.DetectLanguage(r)
 	theme := i18n.DetectTheme(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "error.forbidden.title")
+	pageData := m.buildPageData(lang, theme, config.PageForbidden, "error.forbidden.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
 	pageData.Subtitle = t("error.forbidden.heading")
 
 	data := ErrorPageData{
@@ -204,10 +368,11 @@ func (m *Middleware) handleEmailFetchError(w http.ResponseWriter, r *http.Reques
 	lang := i18n.DetectLanguage(r)
 	theme := i18n.DetectTheme(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "error.email_required.title")
+	pageData := m.buildPageData(lang, theme, config.PageEmailRequired, "error.email_required.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
 	pageData.Subtitle = t("error.email_required.heading")
 
 	data := ErrorPageData{
@@ -225,14 +390,56 @@ func (m *Middleware) handleEmailFetchError(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// handleEmailUnverified displays the error page for accounts whose email the provider has not verified
+func (m *Middleware) handleEmailUnverified(w http.ResponseWriter, r *http.Request) {
+	lang := i18n.DetectLanguage(r)
+	theme := i18n.DetectTheme(r)
+	t := func(key string) string { return m.translator.T(lang, key) }
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+
+	// Build page data
+	pageData := m.buildPageData(lang, theme, config.PageEmailUnverified, "error.email_unverified.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
+	pageData.Subtitle = t("error.email_unverified.heading")
+
+	data := ErrorPageData{
+		PageData:    pageData,
+		Message:     t("error.email_unverified.message"),
+		ActionURL:   joinAuthPath(prefix, "/login"),
+		ActionLabel: t("login.back"),
+	}
+
+	// Render template
+	if err := renderErrorTemplate(w, m.templates.emailUnverified, data, http.StatusForbidden, m); err != nil {
+		m.logger.Error("Failed to render email unverified template", "error", err)
+		http.Error(w, "Email not verified", http.StatusForbidden)
+		return
+	}
+}
+
+// requiresVerifiedEmail reports whether the OAuth2 provider is configured with require_verified_email
+func (m *Middleware) requiresVerifiedEmail(providerName string) bool {
+	for _, p := range m.config.OAuth2.Providers {
+		if p.ID == providerName {
+			return p.RequireVerifiedEmail
+		}
+	}
+	return false
+}
+
 // handle404 displays the 404 Not Found page using html/template
 func (m *Middleware) handle404(w http.ResponseWriter, r *http.Request) {
+	if m.serveConfiguredError(w, r, http.StatusNotFound) {
+		return
+	}
+
 	lang := i18n.DetectLanguage(r)
 	theme := i18n.DetectTheme(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "error.notfound.title")
+	pageData := m.buildPageData(lang, theme, config.PageNotFound, "error.notfound.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
 	pageData.Subtitle = t("error.notfound.heading")
 
 	data := ErrorPageData{
@@ -257,7 +464,8 @@ func (m *Middleware) handle500(w http.ResponseWriter, r *http.Request, err error
 	t := func(key string) string { return m.translator.T(lang, key) }
 
 	// Build page data
-	pageData := m.buildPageData(lang, theme, "error.server.title")
+	pageData := m.buildPageData(lang, theme, config.PageServerError, "error.server.title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
 	pageData.Subtitle = t("error.server.heading")
 
 	data := ErrorPageData{
@@ -290,6 +498,52 @@ func (m *Middleware) handle500(w http.ResponseWriter, r *http.Request, err error
 	}
 }
 
+// handleUpstreamError displays the 502/504 page when the upstream cannot be reached
+// It is installed on proxied requests through proxy.WithErrorHandler
+func (m *Middleware) handleUpstreamError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	lang := i18n.DetectLanguage(r)
+	theme := i18n.DetectTheme(r)
+	t := func(key string) string { return m.translator.T(lang, key) }
+	reqID := requestID(r)
+
+	m.logger.Error("Upstream request failed", "status", status, "method", r.Method, "path", r.URL.Path, "request_id", reqID, "error", err)
+
+	keyPrefix := "error.upstream"
+	if status == http.StatusGatewayTimeout {
+		keyPrefix = "error.timeout"
+	}
+
+	// Build page data
+	pageData := m.buildPageData(lang, theme, config.PageUpstreamError, keyPrefix+".title")
+	pageData.Announcement = m.pageAnnouncement(r, lang)
+	pageData.Subtitle = t(keyPrefix + ".heading")
+
+	data := ErrorPageData{
+		PageData:       pageData,
+		Message:        t(keyPrefix + ".message"),
+		ActionURL:      "/",
+		ActionLabel:    t("error.server.home"),
+		RequestID:      reqID,
+		RequestIDLabel: t("error.request_id"),
+	}
+
+	// Only safe methods can be retried by following a link
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		data.RetryURL = r.URL.RequestURI()
+		data.RetryLabel = t("error.upstream.retry")
+	}
+
+	w.Header().Set(requestIDHeader, reqID)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Render template
+	if renderErr := renderErrorTemplate(w, m.templates.upstream, data, status, m); renderErr != nil {
+		m.logger.Error("Failed to render upstream error template", "error", renderErr)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+}
+
 // HealthResponse represents the JSON response for health check
 type HealthResponse struct {
 	Status     string `json:"status"`      // Current health status (starting/ready/draining/etc.)
@@ -298,6 +552,15 @@ type HealthResponse struct {
 	Since      string `json:"since"`       // ISO8601 timestamp of when middleware started
 	Detail     string `json:"detail"`      // Human-readable detail message
 	RetryAfter *int   `json:"retry_after"` // Retry after N seconds (only present when 503)
+
+	// Checks holds the results of the dependency probes enabled in health.checks (readiness only)
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+
+	// SessionGC reports the session garbage collection runs of this instance (readiness only, when session.gc is enabled)
+	SessionGC *SessionGCStats `json:"session_gc,omitempty"`
+
+	// StreamLimits counts the responses cut by stream_limits on this instance (readiness only, when stream limits are configured)
+	StreamLimits *StreamLimitStats `json:"stream_limits,omitempty"`
 }
 
 // Health Check Strategy
@@ -312,13 +575,14 @@ type HealthResponse struct {
 //
 // Readiness vs Liveness:
 //   - Readiness: Returns 200 when ready to accept traffic, 503 when starting/draining
+//     or when a dependency probe enabled in health.checks (kvs, upstream, smtp) fails
 //   - Liveness:  Always returns 200 if process is alive (no dependency checks)
 //
 // Health States:
 //   - starting   → Initial state after middleware creation
+//   - warming    → Warm-up in progress (during WarmUp() call)
 //   - ready      → Middleware is ready (after SetReady() call)
 //   - draining   → Graceful shutdown in progress (after SetDraining() call)
-//   - warming    → (Reserved for future use, e.g., cache warming)
 //   - migrating  → (Reserved for future use, e.g., data migration)
 //   - prefilling → (Reserved for future use, e.g., connection pool setup)
 //
@@ -329,9 +593,10 @@ type HealthResponse struct {
 //
 // Lifecycle:
 //   1. Middleware created → status="starting", ready=false
-//   2. Initialization complete → SetReady() → status="ready", ready=true
-//   3. SIGTERM received → SetDraining() → status="draining", ready=false
-//   4. Server shutdown → connections drained → process exit
+//   2. Server listening → WarmUp() → status="warming", ready=false
+//   3. Initialization complete → SetReady() → status="ready", ready=true
+//   4. SIGTERM received → SetDraining() → status="draining", ready=false
+//   5. Server shutdown → connections drained → process exit
 //
 // Container Orchestration:
 //   - Docker/ECS: Use /_auth/health for health checks
@@ -409,17 +674,35 @@ func (m *Middleware) handleReadiness(w http.ResponseWriter, r *http.Request) {
 		Ready:  ready,
 		Since:  m.healthStarted.Format(time.RFC3339),
 	}
+	if m.config.Session.GC.Enabled {
+		stats := m.SessionGCStats()
+		response.SessionGC = &stats
+	}
+	if len(m.config.StreamLimits) > 0 {
+		stats := m.StreamLimitStats()
+		response.StreamLimits = &stats
+	}
+
+	// Probe dependencies only once the middleware itself is ready
+	checksOK := true
+	if ready {
+		response.Checks, checksOK = m.runHealthChecks(r.Context())
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if ready {
+	if ready && checksOK {
 		// Ready to accept traffic
 		response.Detail = "ok"
 		w.WriteHeader(http.StatusOK)
 	} else {
-		// Not ready yet (starting, warming, draining, etc.)
+		// Not ready yet (starting, warming, draining, etc.) or a dependency is unavailable
 		retryAfter := 5
 		response.Detail = "warming up"
+		if ready {
+			response.Ready = false
+			response.Detail = "dependency unavailable: " + strings.Join(failedHealthChecks(response.Checks), ", ")
+		}
 		response.RetryAfter = &retryAfter
 
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
@@ -429,20 +712,29 @@ func (m *Middleware) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(response)
 }
 
-// handleMainCSS serves the embedded CSS
+// handleMainCSS serves the embedded CSS followed by the theme overrides from service.theme
 func (m *Middleware) handleMainCSS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/css; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(assets.GetEmbeddedCSS()))
+	m.serveEmbeddedAsset(w, r, "main.css")
 }
 
 // handleDifyCSS serves the embedded Dify CSS for iframe optimizations
 func (m *Middleware) handleDifyCSS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/css; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(assets.GetEmbeddedDifyCSS()))
+	m.serveEmbeddedAsset(w, r, "dify.css")
+}
+
+// handleOTPJS serves the embedded segmented OTP input script
+func (m *Middleware) handleOTPJS(w http.ResponseWriter, r *http.Request) {
+	m.serveEmbeddedAsset(w, r, "otp.js")
+}
+
+// handleFragmentJS serves the embedded URL fragment capture script of the login page
+func (m *Middleware) handleFragmentJS(w http.ResponseWriter, r *http.Request) {
+	m.serveEmbeddedAsset(w, r, "fragment.js")
+}
+
+// handleAnnouncementJS serves the embedded dismiss script of the announcement banner
+func (m *Middleware) handleAnnouncementJS(w http.ResponseWriter, r *http.Request) {
+	m.serveEmbeddedAsset(w, r, "announcement.js")
 }
 
 // handleIcon serves the embedded SVG icons
@@ -451,19 +743,68 @@ func (m *Middleware) handleIcon(w http.ResponseWriter, r *http.Request) {
 	prefix := m.config.Server.GetAuthPathPrefix()
 	fullPrefix := joinAuthPath(prefix, "/assets/icons/")
 	iconName := extractPathParam(r.URL.Path, fullPrefix)
-	iconPath := "static/icons/" + iconName
 
-	// Read the icon file from embedded filesystem
-	data, err := assets.GetEmbeddedIcons().ReadFile(iconPath)
-	if err != nil {
+	m.serveEmbeddedAsset(w, r, "icons/"+iconName)
+}
+
+// handleAsset serves the other paths under /assets/: the favicon file and fingerprinted names of the assets
+// (e.g. main.3f2a9c1b7d4e5f60.css, see assetURL)
+func (m *Middleware) handleAsset(w http.ResponseWriter, r *http.Request) {
+	prefix := m.config.Server.GetAuthPathPrefix()
+	m.serveEmbeddedAsset(w, r, extractPathParam(r.URL.Path, joinAuthPath(prefix, "/assets/")))
+}
+
+// lookupAsset returns the asset at name: the themed main.css, the favicon file, or an embedded asset
+func (m *Middleware) lookupAsset(name string) (assets.Asset, bool) {
+	if name == "main.css" {
+		return m.staticFragments().mainCSS, true
+	}
+	if m.favicon != nil && name == m.favicon.name {
+		return m.favicon.asset, true
+	}
+	return assets.Lookup(name)
+}
+
+// serveEmbeddedAsset serves the asset at name or at its fingerprinted name, or 404 Not Found
+//
+// Plain names are cached for a year and revalidated by ETag. Fingerprinted names are immutable;
+// a hash of another release (e.g. a page rendered before an upgrade) gets the current content
+// without caching, so it is never pinned under the wrong name.
+func (m *Middleware) serveEmbeddedAsset(w http.ResponseWriter, r *http.Request, name string) {
+	if asset, ok := m.lookupAsset(name); ok {
+		serveAsset(w, r, assets.ContentType(name), asset, "public, max-age=31536000") // Cache for 1 year
+		return
+	}
+
+	original, hash, ok := assets.SplitFingerprint(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	asset, ok := m.lookupAsset(original)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
+	cacheControl := "public, max-age=31536000, immutable"
+	if asset.Hash != hash {
+		cacheControl = "no-cache"
+	}
+	serveAsset(w, r, assets.ContentType(original), asset, cacheControl)
+}
 
-	w.Header().Set("Content-Type", "image/svg+xml")
-	w.Header().Set("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(data)
+// serveAsset serves an asset with its ETag, and answers conditional requests
+// (If-None-Match, If-Modified-Since) with 304 Not Modified
+func serveAsset(w http.ResponseWriter, r *http.Request, contentType string, asset assets.Asset, cacheControl string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", asset.ETag)
+	http.ServeContent(w, r, "", assets.ModTime(), bytes.NewReader(asset.Body))
+}
+
+// assetURL returns the fingerprinted URL of the embedded asset at name under the auth path prefix
+func assetURL(prefix, name string) string {
+	return joinAuthPath(prefix, "/assets/"+assets.FingerprintedName(name))
 }
 
 // buildAuthHeader generates the auth header HTML based on configuration
@@ -473,6 +814,25 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 	fullPrefix := joinAuthPath(prefix, "/oauth2/start/")
 	providerName := extractPathParam(r.URL.Path, fullPrefix)
 
+	// Reject providers disabled at runtime via the admin API
+	if !m.isAuthMethodEnabled(providerName) {
+		m.logger.Warn("OAuth2 login attempted with disabled provider", "provider", providerName)
+		http.Error(w, "Provider is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Ask for the provider's optional scopes first (the consent form posts back here)
+	extraScopes, ok := m.consentScopes(w, r, providerName)
+	if !ok {
+		return
+	}
+
+	m.redirectToProvider(w, r, providerName, extraScopes)
+}
+
+// redirectToProvider starts the authorization code flow of the provider, requesting extraScopes
+// in addition to the provider's scopes
+func (m *Middleware) redirectToProvider(w http.ResponseWriter, r *http.Request, providerName string, extraScopes []string) {
 	// Generate state for CSRF protection
 	state, err := oauth2.GenerateState()
 	if err != nil {
@@ -489,12 +849,12 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 	var authURL, redirectURL string
 	if m.config.Server.BaseURL != "" {
 		// Use configured base URL
-		authURL, redirectURL, err = m.oauthManager.GetAuthURLWithRedirect(providerName, state, m.config.Server.BaseURL, prefix)
+		authURL, redirectURL, err = m.oauthManager.GetAuthURLWithRedirect(providerName, state, m.config.Server.BaseURL, m.config.Server.GetPublicAuthPathPrefix(), extraScopes...)
 		m.logger.Debug("Generated OAuth2 auth URL", "provider", providerName, "base_url", m.config.Server.BaseURL, "redirect_url", redirectURL)
 	} else {
 		// Use request host (dynamic)
 		requestHost := r.Host
-		authURL, redirectURL, err = m.oauthManager.GetAuthURLWithRedirect(providerName, state, requestHost, prefix)
+		authURL, redirectURL, err = m.oauthManager.GetAuthURLWithRedirect(providerName, state, requestHost, m.config.Server.GetPublicAuthPathPrefix(), extraScopes...)
 		m.logger.Debug("Generated OAuth2 auth URL", "provider", providerName, "request_host", requestHost, "redirect_url", redirectURL)
 	}
 	if err != nil {
@@ -503,11 +863,23 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Step-up sign-ins ask the provider to authenticate the user again
+	if stepUpCookie, err := r.Cookie(stepUpCookieName); err == nil {
+		authURL = withStepUpParams(authURL, stepUpCookie.Value)
+		http.SetCookie(w, &http.Cookie{
+			Name:   stepUpCookieName,
+			Value:  "",
+			Path:   m.config.Server.GetCookiePath(),
+			Domain: m.config.Session.Cookie.Domain,
+			MaxAge: -1,
+		})
+	}
+
 	// Store state in a cookie for verification
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_state",
 		Value:    state,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
 		MaxAge:   600, // 10 minutes
 		HttpOnly: true,
 		Secure:   m.config.Session.Cookie.Secure,
@@ -518,7 +890,7 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_provider",
 		Value:    providerName,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
 		MaxAge:   600,
 		HttpOnly: true,
 		Secure:   m.config.Session.Cookie.Secure,
@@ -529,7 +901,7 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_redirect_url",
 		Value:    redirectURL,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
 		MaxAge:   600,
 		HttpOnly: true,
 		Secure:   m.config.Session.Cookie.Secure,
@@ -542,6 +914,8 @@ func (m *Middleware) handleOAuth2Start(w http.ResponseWriter, r *http.Request) {
 
 // handleOAuth2Callback handles the OAuth2 callback
 func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+
 	// Get state from cookie
 	stateCookie, err := r.Cookie("oauth_state")
 	if err != nil {
@@ -558,6 +932,13 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Flows started before the provider was disabled via the admin API do not sign in
+	if !m.isAuthMethodEnabled(providerCookie.Value) {
+		m.logger.Warn("OAuth2 callback with disabled provider", "provider", providerCookie.Value)
+		http.Error(w, "Provider is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Get redirect URL from cookie
 	redirectURLCookie, err := r.Cookie("oauth_redirect_url")
 	if err != nil {
@@ -571,6 +952,7 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	if state != stateCookie.Value {
 		m.logger.Debug("State verification failed", "expected", stateCookie.Value, "actual", state)
 		m.logger.Error("OAuth2 authentication failed: state mismatch")
+		m.recordLoginFailure(providerCookie.Value, loginFailureStateMismatch)
 		http.Error(w, "Invalid state", http.StatusBadRequest)
 		return
 	}
@@ -579,6 +961,7 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		m.logger.Error("OAuth2 authentication failed: authorization code not found")
+		m.recordLoginFailure(providerCookie.Value, loginFailureMissingCode)
 		http.Error(w, "Authorization code not found", http.StatusBadRequest)
 		return
 	}
@@ -590,6 +973,7 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	token, err := m.oauthManager.ExchangeWithRedirect(r.Context(), providerName, code, oauthRedirectURL)
 	if err != nil {
 		m.logger.Error("Failed to exchange code", "error", err, "redirect_url", oauthRedirectURL)
+		m.recordLoginFailure(providerName, loginFailureExchange)
 		http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
 		return
 	}
@@ -605,12 +989,37 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 		name = userInfo.Name
 	}
 
+	// Deny users outside the provider's required organizations or teams
+	if errors.Is(err, oauth2.ErrAccessDenied) {
+		m.logger.Info("OAuth2 authentication denied: membership requirement not met", "error", err, "provider", providerName)
+		m.recordLoginFailure(providerName, loginFailureMembership)
+		m.handleForbidden(w, r)
+		return
+	}
+
+	// Never trust an email address the provider has not verified when required
+	if m.requiresVerifiedEmail(providerName) {
+		if err != nil || email == "" {
+			m.logger.Error("OAuth2 authentication failed: verified email required but could not be retrieved", "provider", providerName)
+			m.recordLoginFailure(providerName, loginFailureEmailFetch)
+			m.handleEmailFetchError(w, r)
+			return
+		}
+		if !userInfo.EmailVerified {
+			m.logger.Info("OAuth2 authentication denied: email not verified by provider", "email", m.logEmail(email), "provider", providerName)
+			m.recordLoginFailure(providerName, loginFailureEmailUnverified)
+			m.handleEmailUnverified(w, r)
+			return
+		}
+	}
+
 	// Check if email-based authorization is required
 	if m.authzChecker.RequiresEmail() {
 		// Whitelist configured - email is required for authorization
 		if err != nil {
 			m.logger.Debug("Email fetch failed", "error", err, "provider", providerName)
 			m.logger.Error("OAuth2 authentication failed: email required for authorization but could not be retrieved", "provider", providerName)
+			m.recordLoginFailure(providerName, loginFailureEmailFetch)
 			m.handleEmailFetchError(w, r)
 			return
 		}
@@ -618,13 +1027,15 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 		// Check if email was actually provided by the OAuth2 provider
 		if email == "" {
 			m.logger.Error("OAuth2 authentication failed: email required for authorization but not provided by OAuth2 provider", "provider", providerName)
+			m.recordLoginFailure(providerName, loginFailureEmailFetch)
 			m.handleEmailFetchError(w, r)
 			return
 		}
 
 		// Check authorization
 		if !m.authzChecker.IsAllowed(email) {
-			m.logger.Info("OAuth2 authentication denied: user not authorized", "email", maskEmail(email), "provider", providerName)
+			m.logger.Info("OAuth2 authentication denied: user not authorized", "email", m.logEmail(email), "provider", providerName)
+			m.recordLoginFailure(providerName, loginFailureNotAuthorized)
 			m.handleForbidden(w, r)
 			return
 		}
@@ -638,6 +1049,12 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	// Scope upgrades add to the signed-in session instead of replacing it
+	if upgradeCookie, err := r.Cookie(scopeUpgradeCookieName); err == nil {
+		m.completeScopeUpgrade(w, r, providerName, upgradeCookie.Value, token, userInfo)
+		return
+	}
+
 	// Delete any existing session to prevent session fixation attacks
 	if oldCookie, err := r.Cookie(m.config.Session.Cookie.Name); err == nil {
 		_ = session.Delete(m.sessionStore, oldCookie.Value)
@@ -659,26 +1076,66 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	// Safely extract Extra data, handling nil userInfo case
 	var extra map[string]interface{}
 	if userInfo != nil && userInfo.Extra != nil {
-		extra = userInfo.Extra
+		// Derive normalized claims before pruning so that they can come from dropped keys
+		mapped, claimKeys := m.mapClaims(providerName, userInfo.Extra)
+		for _, key := range claimKeys {
+			if key == "_"+config.ClaimUsername {
+				name, _ = mapped[key].(string)
+			}
+		}
+
+		var dropped []string
+		extra, dropped = m.config.Session.Extra.Prune(mapped, append(claimKeys, reservedExtraKeys...)...)
+		if len(dropped) > 0 {
+			m.logger.Debug("Provider data pruned from session", "provider", providerName, "keys", dropped)
+		}
 	} else {
 		extra = make(map[string]interface{})
 	}
 
+	// Optional scopes approved on the consent step
+	granted, _ := token.Extra("scope").(string)
+	if scopes := m.grantedScopes(r, providerName, granted); len(scopes) > 0 {
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[grantedScopesKey] = strings.Join(scopes, ",")
+	}
+
+	// Kept for back-channel logout, whose tokens name the provider's user or session
+	subject, providerSID := oauth2.SessionClaims(token)
+	if subject == "" && userInfo != nil {
+		subject, _ = userInfo.Extra["sub"].(string)
+	}
+
+	now := m.clock.Now()
 	sess := &session.Session{
 		ID:            sessionID,
 		Email:         email,
 		Name:          name,
 		Provider:      providerName,
 		Extra:         extra, // Store additional user data for custom forwarding
-		CreatedAt:     time.Now(),
-		ExpiresAt:     time.Now().Add(duration),
+		Subject:       subject,
+		ProviderSID:   providerSID,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(duration),
 		Authenticated: true,
 	}
 
+	m.minimizeSession(sess)
+
+	// Kept for the provider token endpoint
+	if err := m.keepProviderToken(sess, token); err != nil {
+		m.logger.Error("Failed to keep provider token", "provider", providerName, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	// Store session
-	if err := session.Set(m.sessionStore, sessionID, sess); err != nil {
+	if err := session.SetAt(m.sessionStore, sessionID, sess, now); err != nil {
 		m.logger.Debug("Session store failed", "error", err)
 		m.logger.Error("OAuth2 authentication failed: could not store session")
+		m.recordLoginFailure(providerName, loginFailureSession)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -687,47 +1144,27 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	http.SetCookie(w, &http.Cookie{
 		Name:     m.config.Session.Cookie.Name,
 		Value:    sessionID,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
 		MaxAge:   int(duration.Seconds()),
 		HttpOnly: m.config.Session.Cookie.HTTPOnly,
 		Secure:   m.config.Session.Cookie.Secure,
 		SameSite: m.config.Session.Cookie.GetSameSite(),
 	})
 
-	// Clear OAuth cookies
-	http.SetCookie(w, &http.Cookie{
-		Name:   "oauth_state",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:   "oauth_provider",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:   "oauth_redirect_url",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
+	m.clearOAuthCookies(w)
 
 	// Log success after all session/cookie operations succeed
-	m.logger.Info("OAuth2 authentication successful", "email", maskEmail(email), "name", name, "provider", providerName)
+	m.logger.Info("OAuth2 authentication successful", "email", m.logEmail(email), "name", sess.Name, "provider", providerName)
+	m.recordLogin(providerName, email, started)
+	m.recordExperimentLogin(r)
 
 	// Get redirect URL
 	redirectURL := m.getRedirectURL(w, r)
 
 	// Add user info to query string if forwarding is enabled
 	if m.forwarder != nil {
-		fwdUserInfo := &forwarding.UserInfo{
-			Username: name,
-			Email:    email,
-			Extra:    userInfo.Extra,
-			Provider: providerName,
-		}
+		fwdUserInfo := forwardingUserInfo(sess)
 		if modifiedURL, err := m.forwarder.AddToQueryString(redirectURL, fwdUserInfo); err == nil {
 			redirectURL = modifiedURL
 		} else {
@@ -736,7 +1173,19 @@ func (m *Middleware) handleOAuth2Callback(w http.ResponseWriter, r *http.Request
 	}
 
 	// Redirect to original URL or home
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	http.Redirect(w, r, m.publicPath(redirectURL), http.StatusFound)
+}
+
+// clearOAuthCookies deletes the cookies of the authorization code flow
+func (m *Middleware) clearOAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{"oauth_state", "oauth_provider", "oauth_redirect_url", scopeUpgradeCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Value:  "",
+			Path:   m.config.Server.GetCookiePath(),
+			MaxAge: -1,
+		})
+	}
 }
 
 // generateSessionID generates a random session ID
@@ -767,6 +1216,12 @@ func (m *Middleware) handleEmailSend(w http.ResponseWriter, r *http.Request) {
 	lang := i18n.DetectLanguage(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
 
+	// Reject when email authentication is disabled at runtime via the admin API
+	if !m.isAuthMethodEnabled(authMethodEmail) {
+		http.Error(w, "Email authentication is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, t("error.invalid_request"), http.StatusBadRequest)
 		return
@@ -780,55 +1235,68 @@ func (m *Middleware) handleEmailSend(w http.ResponseWriter, r *http.Request) {
 
 	// Validate email address to prevent SMTP injection
 	if !isValidEmail(email) {
-		m.logger.Warn("Invalid email address format", "email", maskEmail(email))
+		m.logger.Warn("Invalid email address format", "email", m.logEmail(email))
 		http.Error(w, t("error.invalid_email"), http.StatusBadRequest)
 		return
 	}
 
 	// Check authorization before sending
 	if !m.authzChecker.IsAllowed(email) {
-		m.logger.Info("Email authentication denied: user not authorized", "email", maskEmail(email))
+		m.logger.Info("Email authentication denied: user not authorized", "email", m.logEmail(email))
+		m.recordLoginFailure(authMethodEmail, loginFailureNotAuthorized)
 		m.handleForbidden(w, r)
 		return
 	}
 
 	// Get redirect URL from cookie (where user originally wanted to go)
-	redirectURL := "/"
+	redirectURL := m.config.Server.GetDefaultRedirect()
 	if cookie, err := r.Cookie(redirectCookieName); err == nil && cookie.Value != "" {
-		if isValidRedirectURL(cookie.Value) {
-			redirectURL = cookie.Value
+		if m.allowsRedirectTarget(cookie.Value) {
+			// The link may be opened in another browser, so the fragment goes into the token too
+			redirectURL = m.withRedirectFragment(w, r, cookie.Value)
+		} else {
+			redirectURL = m.redirectFallback()
 		}
 	}
 
 	// Send login link with redirect URL embedded in token
 	err := m.emailHandler.SendLoginLink(email, redirectURL, lang)
 	if err != nil {
-		m.logger.Debug("Email send failed", "email", maskEmail(email), "error", err)
+		m.logger.Debug("Email send failed", "email", m.logEmail(email), "error", err)
 
 		// Check if this is a rate limit error
 		if strings.Contains(err.Error(), "rate limit exceeded") {
-			m.logger.Warn("Email authentication rate limited", "email", maskEmail(email))
+			m.logger.Warn("Email authentication rate limited", "email", m.logEmail(email))
+			m.recordLoginFailure(authMethodEmail, loginFailureRateLimited)
 			http.Error(w, t("error.rate_limit"), http.StatusTooManyRequests)
 			return
 		}
 
-		m.logger.Error("Email authentication failed: could not send login link", "email", maskEmail(email))
+		m.logger.Error("Email authentication failed: could not send login link", "email", m.logEmail(email))
+		m.recordLoginFailure(authMethodEmail, loginFailureSendFailed)
 		http.Error(w, t("error.internal"), http.StatusInternalServerError)
 		return
 	}
-	m.logger.Info("Login link sent", "email", maskEmail(email))
+	m.logger.Info("Login link sent", "email", m.logEmail(email))
 
 	// Redirect to email sent page
-	prefix := m.config.Server.GetAuthPathPrefix()
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 	emailSentPath := joinAuthPath(prefix, "/email/sent")
 	http.Redirect(w, r, emailSentPath, http.StatusSeeOther)
 }
 
 // handleEmailSent shows the email sent confirmation page with OTP input
 func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
 	lang := i18n.DetectLanguage(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
 
+	// Links sent before email authentication was disabled via the admin API do not sign in
+	if !m.isAuthMethodEnabled(authMethodEmail) {
+		http.Error(w, "Email authentication is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		http.Error(w, t("error.invalid_request"), http.StatusBadRequest)
@@ -836,14 +1304,16 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify token and get redirect URL
-	email, redirectURL, err := m.emailHandler.VerifyToken(token)
+	// The link carries ?lang= of the login email, so the error page below already renders in that language
+	email, redirectURL, tokenLang, err := m.emailHandler.VerifyTokenWithLang(token)
 	if err != nil {
 		m.logger.Debug("Token verification failed", "error", err)
 		m.logger.Error("Email authentication failed: invalid or expired token")
+		m.recordLoginFailure(authMethodEmail, loginFailureInvalidToken)
 		theme := i18n.DetectTheme(r)
 
 		// Use embedded CSS
-		prefix := m.config.Server.GetAuthPathPrefix()
+		prefix := m.config.Server.GetPublicAuthPathPrefix()
 		loginPath := joinAuthPath(prefix, "/login")
 
 		themeClass := ""
@@ -856,10 +1326,10 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 			// ThemeAuto: no class
 		}
 
-		iconPath := joinAuthPath(prefix, "/assets/icons/chatbotgate.svg")
+		iconPath := assetURL(prefix, "icons/chatbotgate.svg")
 
 		html := `<!DOCTYPE html>
-<html lang="` + string(lang) + `" class="` + themeClass + `">
+<html lang="` + string(lang) + `" dir="` + i18n.Direction(lang) + `" class="` + themeClass + `">
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
@@ -867,20 +1337,21 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 ` + m.buildStyleLinks() + `
 </head>
 <body>
-<div class="auth-container">
+<a href="#main-content" class="skip-link">` + t("ui.skip_to_content") + `</a>
+<main id="main-content" class="auth-container" tabindex="-1">
 	<div style="width: 100%; max-width: 28rem;">
 		<div class="card auth-card">
 			` + m.buildAuthHeader(prefix) + `
 			` + m.buildAuthSubtitle(t("email.invalid.heading")) + `
-			<div class="alert alert-error" style="text-align: left; margin-bottom: var(--spacing-md);"><strong>Error:</strong> ` + t("email.invalid.message") + ` This link cannot be used to authenticate.</div>
+			<div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);"><strong>Error:</strong> ` + t("email.invalid.message") + ` This link cannot be used to authenticate.</div>
 			<a href="` + loginPath + `" class="btn btn-primary" style="width: 100%; margin-top: var(--spacing-md);">` + t("email.invalid.retry") + `</a>
 		</div>
 		<a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-			<img src="` + iconPath + `" alt="ChatbotGate Logo">
+			<img src="` + iconPath + `" alt="">
 			Protected by ChatbotGate
 		</a>
 	</div>
-</div>
+</main>
 </body>
 </html>`
 		m.setSecurityHeaders(w)
@@ -893,13 +1364,14 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 	// Check authorization if whitelist is configured
 	if m.authzChecker.RequiresEmail() {
 		if !m.authzChecker.IsAllowed(email) {
-			m.logger.Info("Email authentication denied: user not authorized", "email", maskEmail(email))
+			m.logger.Info("Email authentication denied: user not authorized", "email", m.logEmail(email))
+			m.recordLoginFailure(authMethodEmail, loginFailureNotAuthorized)
 			m.handleForbidden(w, r)
 			return
 		}
-		m.logger.Debug("User authorized", "email", maskEmail(email))
+		m.logger.Debug("User authorized", "email", m.logEmail(email))
 	} else {
-		m.logger.Debug("No whitelist configured, skipping authorization check", "email", maskEmail(email))
+		m.logger.Debug("No whitelist configured, skipping authorization check", "email", m.logEmail(email))
 	}
 
 	// Delete any existing session to prevent session fixation attacks
@@ -928,21 +1400,25 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 	extra["_avatar_url"] = ""
 	extra["userpart"] = userpart
 
+	now := m.clock.Now()
 	sess := &session.Session{
 		ID:            sessionID,
 		Email:         email,
 		Name:          userpart, // Set Name to userpart for consistency with forwarding
 		Provider:      "email",
 		Extra:         extra,
-		CreatedAt:     time.Now(),
-		ExpiresAt:     time.Now().Add(duration),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(duration),
 		Authenticated: true,
 	}
 
+	m.minimizeSession(sess)
+
 	// Store session
-	if err := session.Set(m.sessionStore, sessionID, sess); err != nil {
+	if err := session.SetAt(m.sessionStore, sessionID, sess, now); err != nil {
 		m.logger.Debug("Session store failed", "error", err)
 		m.logger.Error("Email authentication failed: could not store session")
+		m.recordLoginFailure(authMethodEmail, loginFailureSession)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -951,14 +1427,22 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     m.config.Session.Cookie.Name,
 		Value:    sessionID,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
 		MaxAge:   int(duration.Seconds()),
 		HttpOnly: m.config.Session.Cookie.HTTPOnly,
 		Secure:   m.config.Session.Cookie.Secure,
 		SameSite: m.config.Session.Cookie.GetSameSite(),
 	})
 
-	m.logger.Info("Email authentication successful", "email", maskEmail(email))
+	m.logger.Info("Email authentication successful", "email", m.logEmail(email))
+	m.recordLogin(authMethodEmail, email, started)
+	m.recordExperimentLogin(r)
+
+	// Keep the language the login email was sent in for subsequent auth pages
+	if lang, ok := i18n.ParseLanguage(string(tokenLang)); ok {
+		setLanguageCookie(w, lang)
+	}
 
 	// Use redirect URL from token, or fall back to cookie or home page
 	if redirectURL == "" {
@@ -968,24 +1452,21 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 		http.SetCookie(w, &http.Cookie{
 			Name:   redirectCookieName,
 			Value:  "",
-			Path:   "/",
+			Path:   m.config.Server.GetCookiePath(),
+			Domain: m.config.Session.Cookie.Domain,
 			MaxAge: -1,
 		})
 	}
 
 	// Validate redirect URL to prevent open redirect attacks
-	if !isValidRedirectURL(redirectURL) {
-		redirectURL = "/"
+	// The rules are checked again because they may have changed since the token was issued
+	if !m.allowsRedirectTarget(redirectURL) {
+		redirectURL = m.redirectFallback()
 	}
 
 	// Add user info to query string if forwarding is enabled
 	if m.forwarder != nil {
-		fwdUserInfo := &forwarding.UserInfo{
-			Username: userpart,
-			Email:    email,
-			Extra:    extra,
-			Provider: "email",
-		}
+		fwdUserInfo := forwardingUserInfo(sess)
 		if modifiedURL, err := m.forwarder.AddToQueryString(redirectURL, fwdUserInfo); err == nil {
 			redirectURL = modifiedURL
 		} else {
@@ -994,11 +1475,12 @@ func (m *Middleware) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Redirect to original URL or home
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	http.Redirect(w, r, m.publicPath(redirectURL), http.StatusFound)
 }
 
 // handleEmailVerifyOTP verifies the OTP and creates a session
 func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
 	lang := i18n.DetectLanguage(r)
 	t := func(key string) string { return m.translator.T(lang, key) }
 
@@ -1007,6 +1489,12 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Codes sent before email authentication was disabled via the admin API do not sign in
+	if !m.isAuthMethodEnabled(authMethodEmail) {
+		http.Error(w, "Email authentication is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, t("error.invalid_request"), http.StatusBadRequest)
@@ -1020,13 +1508,14 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 	}
 
 	// Verify OTP and get redirect URL
-	email, redirectURL, err := m.emailHandler.VerifyOTP(otp)
+	email, redirectURL, tokenLang, err := m.emailHandler.VerifyOTPWithLang(otp)
 	if err != nil {
 		m.logger.Debug("OTP verification failed", "error", err)
 		m.logger.Error("Email authentication failed: invalid or expired OTP")
+		m.recordLoginFailure(authMethodEmail, loginFailureInvalidOTP)
 
 		// Redirect back to email sent page with error
-		prefix := m.config.Server.GetAuthPathPrefix()
+		prefix := m.config.Server.GetPublicAuthPathPrefix()
 		emailSentPath := joinAuthPath(prefix, "/email/sent")
 		http.Redirect(w, r, emailSentPath+"?error=invalid_otp", http.StatusFound)
 		return
@@ -1035,13 +1524,14 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 	// Check authorization if whitelist is configured
 	if m.authzChecker.RequiresEmail() {
 		if !m.authzChecker.IsAllowed(email) {
-			m.logger.Info("Email authentication denied: user not authorized", "email", maskEmail(email))
+			m.logger.Info("Email authentication denied: user not authorized", "email", m.logEmail(email))
+			m.recordLoginFailure(authMethodEmail, loginFailureNotAuthorized)
 			m.handleForbidden(w, r)
 			return
 		}
-		m.logger.Debug("User authorized", "email", maskEmail(email))
+		m.logger.Debug("User authorized", "email", m.logEmail(email))
 	} else {
-		m.logger.Debug("No whitelist configured, skipping authorization check", "email", maskEmail(email))
+		m.logger.Debug("No whitelist configured, skipping authorization check", "email", m.logEmail(email))
 	}
 
 	// Delete any existing session to prevent session fixation attacks
@@ -1070,20 +1560,24 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 	extra["_avatar_url"] = ""
 	extra["userpart"] = userpart
 
+	now := m.clock.Now()
 	sess := &session.Session{
 		ID:            sessionID,
 		Email:         email,
 		Name:          userpart, // Set Name to userpart for consistency with forwarding
 		Provider:      "email",
 		Extra:         extra,
-		CreatedAt:     time.Now(),
-		ExpiresAt:     time.Now().Add(duration),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(duration),
 		Authenticated: true,
 	}
 
+	m.minimizeSession(sess)
+
 	// Store session
-	if err := session.Set(m.sessionStore, sessionID, sess); err != nil {
+	if err := session.SetAt(m.sessionStore, sessionID, sess, now); err != nil {
 		m.logger.Error("Failed to store session", "error", err)
+		m.recordLoginFailure(authMethodEmail, loginFailureSession)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -1092,14 +1586,22 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 	http.SetCookie(w, &http.Cookie{
 		Name:     m.config.Session.Cookie.Name,
 		Value:    sessionID,
-		Path:     "/",
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
 		MaxAge:   int(duration.Seconds()),
 		HttpOnly: m.config.Session.Cookie.HTTPOnly,
 		Secure:   m.config.Session.Cookie.Secure,
 		SameSite: m.config.Session.Cookie.GetSameSite(),
 	})
 
-	m.logger.Info("Email authentication successful via OTP", "email", maskEmail(email))
+	m.logger.Info("Email authentication successful via OTP", "email", m.logEmail(email))
+	m.recordLogin(authMethodEmail, email, started)
+	m.recordExperimentLogin(r)
+
+	// Keep the language the login email was sent in for subsequent auth pages
+	if lang, ok := i18n.ParseLanguage(string(tokenLang)); ok {
+		setLanguageCookie(w, lang)
+	}
 
 	// Use redirect URL from token, or fall back to cookie or home page
 	if redirectURL == "" {
@@ -1109,24 +1611,21 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 		http.SetCookie(w, &http.Cookie{
 			Name:   redirectCookieName,
 			Value:  "",
-			Path:   "/",
+			Path:   m.config.Server.GetCookiePath(),
+			Domain: m.config.Session.Cookie.Domain,
 			MaxAge: -1,
 		})
 	}
 
 	// Validate redirect URL to prevent open redirect attacks
-	if !isValidRedirectURL(redirectURL) {
-		redirectURL = "/"
+	// The rules are checked again because they may have changed since the token was issued
+	if !m.allowsRedirectTarget(redirectURL) {
+		redirectURL = m.redirectFallback()
 	}
 
 	// Add user info to query string if forwarding is enabled
 	if m.forwarder != nil {
-		fwdUserInfo := &forwarding.UserInfo{
-			Username: userpart,
-			Email:    email,
-			Extra:    extra,
-			Provider: "email",
-		}
+		fwdUserInfo := forwardingUserInfo(sess)
 		if modifiedURL, err := m.forwarder.AddToQueryString(redirectURL, fwdUserInfo); err == nil {
 			redirectURL = modifiedURL
 		} else {
@@ -1135,14 +1634,14 @@ func (m *Middleware) handleEmailVerifyOTP(w http.ResponseWriter, r *http.Request
 	}
 
 	// Redirect to original URL or home
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	http.Redirect(w, r, m.publicPath(redirectURL), http.StatusFound)
 }
 
 // handleForbidden displays the access denied page
 
 // buildStyleLinks generates stylesheet link tags (temporary wrapper for backward compatibility)
 func (m *Middleware) buildStyleLinks() string {
-	return m.buildStyleLinksHTML()
+	return string(m.staticFragments().styleLinks)
 }
 
 // buildAuthHeader generates auth header HTML (temporary wrapper for backward compatibility)
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// HealthCheck probes a dependency of the readiness check, returning an error when it is unavailable
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckResult is the outcome of a dependency probe in the readiness response
+// The error itself is only logged, since the health endpoint is public.
+type HealthCheckResult struct {
+	Status     string `json:"status"`      // "ok", "timeout" or "unavailable"
+	DurationMs int64  `json:"duration_ms"` // How long the probe took
+}
+
+// AddHealthCheck registers a dependency probe of the readiness check (/_auth/health)
+// The probe only runs when its name is listed in health.checks, so liveness and the default
+// readiness stay dependency-free. Registering a name again replaces the probe.
+func (m *Middleware) AddHealthCheck(name string, check HealthCheck) {
+	m.healthChecksMu.Lock()
+	defer m.healthChecksMu.Unlock()
+	if m.healthChecks == nil {
+		m.healthChecks = make(map[string]HealthCheck)
+	}
+	m.healthChecks[name] = check
+	m.healthResults.invalidate()
+}
+
+// healthResults caches the last round of dependency probes for health.cache_ttl
+// Only one round runs at a time: readiness requests arriving meanwhile wait for its results.
+type healthResults struct {
+	mu      sync.Mutex
+	results map[string]HealthCheckResult
+	ok      bool
+	at      time.Time     // When the last round finished, zero when none
+	running chan struct{} // Closed when the round in progress finishes, nil when none
+}
+
+// invalidate makes the next readiness request run a new round
+func (h *healthResults) invalidate() {
+	h.mu.Lock()
+	h.at = time.Time{}
+	h.mu.Unlock()
+}
+
+// registerBuiltinHealthChecks registers the probes the middleware can run by itself (KVS and SMTP)
+// The upstream probe is registered by the server, which owns the proxy.
+func (m *Middleware) registerBuiltinHealthChecks() {
+	if m.sessionStore != nil {
+		m.AddHealthCheck(config.HealthCheckKVS, func(ctx context.Context) error {
+			_, err := m.sessionStore.Exists(ctx, "health-probe")
+			return err
+		})
+	}
+	if m.config.EmailAuth.Enabled && m.config.EmailAuth.SenderType == "smtp" {
+		smtpCfg := m.config.EmailAuth.SMTP
+		m.AddHealthCheck(config.HealthCheckSMTP, func(ctx context.Context) error {
+			return probeSMTP(ctx, smtpCfg)
+		})
+	}
+}
+
+// probeSMTP connects to the SMTP server and waits for its greeting, without authenticating
+func probeSMTP(ctx context.Context, smtpCfg config.SMTPConfig) error {
+	addr := net.JoinHostPort(smtpCfg.Host, strconv.Itoa(smtpCfg.Port))
+	var conn net.Conn
+	var err error
+	if smtpCfg.TLS {
+		conn, err = (&tls.Dialer{Config: &tls.Config{ServerName: smtpCfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("unexpected SMTP greeting: %w", err)
+	}
+	_ = text.PrintfLine("QUIT")
+	return nil
+}
+
+// runHealthChecks returns the results of the enabled dependency probes, reusing the last round for
+// health.cache_ttl so the public health endpoint cannot make the gate hammer its dependencies
+// Returns nil when no probe is enabled, and whether all probes succeeded.
+func (m *Middleware) runHealthChecks(ctx context.Context) (map[string]HealthCheckResult, bool) {
+	h := &m.healthResults
+	h.mu.Lock()
+	if running := h.running; running != nil {
+		h.mu.Unlock()
+		select {
+		case <-running:
+		case <-ctx.Done():
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.results, h.ok
+	}
+	if !h.at.IsZero() && m.clock.Now().Sub(h.at) < m.config.Health.GetCacheTTL() {
+		defer h.mu.Unlock()
+		return h.results, h.ok
+	}
+	running := make(chan struct{})
+	h.running = running
+	h.mu.Unlock()
+
+	// The round is shared, so a client going away must not cancel it
+	results, ok := m.probeHealthChecks(context.WithoutCancel(ctx))
+
+	h.mu.Lock()
+	h.results, h.ok, h.at = results, ok, m.clock.Now()
+	h.running = nil
+	h.mu.Unlock()
+	close(running)
+	return results, ok
+}
+
+// probeHealthChecks runs the enabled dependency probes concurrently, each with health.timeout
+func (m *Middleware) probeHealthChecks(ctx context.Context) (map[string]HealthCheckResult, bool) {
+	m.healthChecksMu.RLock()
+	checks := make(map[string]HealthCheck)
+	for name, check := range m.healthChecks {
+		if m.config.Health.Enabled(name) {
+			checks[name] = check
+		}
+	}
+	m.healthChecksMu.RUnlock()
+	if len(checks) == 0 {
+		return nil, true
+	}
+
+	timeout := m.config.Health.GetTimeout()
+	results := make(map[string]HealthCheckResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(probeCtx)
+			result := HealthCheckResult{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "unavailable"
+				if errors.Is(err, context.DeadlineExceeded) || probeCtx.Err() != nil {
+					result.Status = "timeout"
+				}
+				m.logger.Warn("Health check failed", "check", name, "error", err)
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != "ok" {
+			return results, false
+		}
+	}
+	return results, true
+}
+
+// failedHealthChecks returns the names of the failed probes, sorted
+func failedHealthChecks(results map[string]HealthCheckResult) []string {
+	var failed []string
+	for name, result := range results {
+		if result.Status != "ok" {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
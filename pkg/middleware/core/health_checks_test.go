@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// readiness serves a readiness probe and decodes the response
+func readiness(t *testing.T, mw *Middleware) (int, HealthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mw.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/_auth/health", nil))
+	var response HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, response
+}
+
+func TestHealthChecks_NotEnabled(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	mw.SetReady()
+	mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	// Probes only run when listed in health.checks
+	code, response := readiness(t, mw)
+	if code != http.StatusOK || response.Checks != nil {
+		t.Errorf("status = %d, checks = %v, want 200 without checks", code, response.Checks)
+	}
+}
+
+func TestHealthChecks_Readiness(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Health.Checks = []string{"kvs", "upstream"}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.SetReady()
+	fake := clock.NewFake(time.Now())
+	mw.SetClock(fake)
+
+	var upstreamErr error
+	mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		return upstreamErr
+	})
+
+	code, response := readiness(t, mw)
+	if code != http.StatusOK || !response.Ready {
+		t.Fatalf("status = %d, ready = %v, want 200", code, response.Ready)
+	}
+	if response.Checks["kvs"].Status != "ok" || response.Checks["upstream"].Status != "ok" {
+		t.Errorf("checks = %+v, want kvs and upstream ok", response.Checks)
+	}
+
+	upstreamErr = errors.New("dial tcp 10.0.0.5:8080: connection refused")
+	fake.Advance(config.DefaultHealthCheckCacheTTL)
+	code, response = readiness(t, mw)
+	if code != http.StatusServiceUnavailable || response.Ready || response.RetryAfter == nil {
+		t.Errorf("status = %d, ready = %v, want 503 with retry_after", code, response.Ready)
+	}
+	if response.Status != "ready" || response.Detail != "dependency unavailable: upstream" {
+		t.Errorf("status = %q, detail = %q", response.Status, response.Detail)
+	}
+	if response.Checks["upstream"].Status != "unavailable" {
+		t.Errorf("upstream check = %+v, want unavailable", response.Checks["upstream"])
+	}
+
+	_ = store.Close()
+	fake.Advance(config.DefaultHealthCheckCacheTTL)
+	if _, response = readiness(t, mw); response.Detail != "dependency unavailable: kvs, upstream" {
+		t.Errorf("detail = %q, want both dependencies", response.Detail)
+	}
+
+	// Liveness never probes dependencies
+	rec := httptest.NewRecorder()
+	mw.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/_auth/health?probe=live", nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "checks") {
+		t.Errorf("liveness: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHealthChecks_Cached(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Health.Checks = []string{"upstream"}
+	cfg.Health.CacheTTL = "10s"
+	mw, _ := newTestMiddleware(t, cfg)
+	mw.SetReady()
+	fake := clock.NewFake(time.Now())
+	mw.SetClock(fake)
+
+	var probes atomic.Int32
+	release := make(chan struct{})
+	mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		probes.Add(1)
+		<-release
+		return nil
+	})
+
+	// Concurrent requests share one round of probes
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code, _ := readiness(t, mw); code != http.StatusOK {
+				t.Errorf("status = %d, want 200", code)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := probes.Load(); got != 1 {
+		t.Errorf("concurrent requests probed %d times, want 1", got)
+	}
+
+	// The results are reused until health.cache_ttl has passed
+	fake.Advance(9 * time.Second)
+	if _, response := readiness(t, mw); response.Checks["upstream"].Status != "ok" || probes.Load() != 1 {
+		t.Errorf("checks = %+v, probes = %d, want the cached results", response.Checks, probes.Load())
+	}
+	fake.Advance(time.Second)
+	readiness(t, mw)
+	if got := probes.Load(); got != 2 {
+		t.Errorf("probes = %d after cache_ttl, want 2", got)
+	}
+}
+
+func TestHealthChecks_Timeout(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Health.Checks = []string{"upstream"}
+	cfg.Health.Timeout = "20ms"
+	mw, _ := newTestMiddleware(t, cfg)
+	mw.SetReady()
+	mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, response := readiness(t, mw)
+	if code != http.StatusServiceUnavailable || response.Checks["upstream"].Status != "timeout" {
+		t.Errorf("status = %d, checks = %+v, want 503 with an upstream timeout", code, response.Checks)
+	}
+}
+
+func TestHealthChecks_NotReadyDoesNotProbe(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Health.Checks = []string{"upstream"}
+	mw, _ := newTestMiddleware(t, cfg)
+	probed := false
+	mw.AddHealthCheck(config.HealthCheckUpstream, func(ctx context.Context) error {
+		probed = true
+		return nil
+	})
+
+	if code, response := readiness(t, mw); code != http.StatusServiceUnavailable || response.Detail != "warming up" || probed {
+		t.Errorf("status = %d, detail = %q, probed = %v, want 503 without probing", code, response.Detail, probed)
+	}
+}
+
+func TestProbeSMTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 mail.example.com ESMTP ready\r\n"))
+			_ = conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	if err := probeSMTP(context.Background(), config.SMTPConfig{Host: "127.0.0.1", Port: addr.Port}); err != nil {
+		t.Errorf("probeSMTP() error = %v", err)
+	}
+
+	_ = listener.Close()
+	if err := probeSMTP(context.Background(), config.SMTPConfig{Host: "127.0.0.1", Port: addr.Port}); err == nil {
+		t.Error("probeSMTP() should fail when the server is down")
+	}
+}
@@ -1,13 +1,22 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"net"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 )
 
 const (
-	redirectCookieName = "_oauth2_redirect" // Cookie name for storing redirect URL
+	redirectCookieName         = "_oauth2_redirect"          // Cookie name for storing redirect URL
+	redirectFragmentCookieName = "_oauth2_redirect_fragment" // Cookie set by the login page script with the URL fragment
+	maxRedirectFragmentLength  = 1024                        // Longer fragments are dropped
+	requestIDHeader            = "X-Request-ID"              // Header carrying the request ID shown on upstream error pages
+	maxRequestIDLength         = 128                         // Longer client-supplied request IDs are replaced
 )
 
 // staticResourcePaths are paths that should not trigger authentication or be saved as redirect URLs
@@ -30,12 +39,14 @@ func isStaticResource(path string) bool {
 }
 
 // isValidRedirectURL validates a redirect URL to prevent open redirect attacks
-// Only allows relative URLs that start with "/" and do not contain "://" or start with "//"
+// Only allows relative URLs that start with "/" and do not contain "://" or start with "//".
+// The checks apply to the URL as browsers read it, so "/\evil.com" and "/\t/evil.com" are rejected too.
 func isValidRedirectURL(redirectURL string) bool {
 	// Empty URL is not valid
 	if redirectURL == "" {
 		return false
 	}
+	redirectURL = browserNormalizeURL(redirectURL)
 
 	// Must start with "/" for relative URL
 	if !strings.HasPrefix(redirectURL, "/") {
@@ -55,31 +66,176 @@ func isValidRedirectURL(redirectURL string) bool {
 	return true
 }
 
+// browserURLReplacer removes tabs and newlines and turns backslashes into slashes,
+// as browsers do when parsing a URL (WHATWG URL Standard)
+var browserURLReplacer = strings.NewReplacer("\t", "", "\r", "", "\n", "", "\\", "/")
+
+// browserNormalizeURL returns the URL a browser would actually follow for rawURL
+func browserNormalizeURL(rawURL string) string {
+	return browserURLReplacer.Replace(rawURL)
+}
+
+// isAllowedRedirectURL validates a redirect URL for this middleware
+// In addition to relative URLs, absolute http(s) URLs are allowed when their host is covered by
+// the configured cookie domain, so users can return to the subdomain they came from after SSO
+func (m *Middleware) isAllowedRedirectURL(redirectURL string) bool {
+	if isValidRedirectURL(redirectURL) {
+		return true
+	}
+
+	if m.config.Session.Cookie.Domain == "" {
+		return false
+	}
+
+	u, err := url.Parse(browserNormalizeURL(redirectURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return false
+	}
+
+	return m.config.Session.Cookie.MatchesDomain(u.Host)
+}
+
+// isCentralAuthHost reports whether the request was made to the central auth host
+func (m *Middleware) isCentralAuthHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.EqualFold(host, m.config.Server.GetCentralAuthHost())
+}
+
+// requestOrigin returns the scheme and host of the request (e.g., "https://app1.example.com")
+// X-Forwarded-Proto is honored because the middleware usually runs behind a TLS-terminating proxy
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// clientIP returns the IP address of the client, e.g. for rate limits
+// Behind a reverse proxy on a loopback or private address, the last X-Forwarded-For entry (the address
+// the proxy saw) is used; other X-Forwarded-For entries can be forged by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			entries := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(entries[len(entries)-1]); net.ParseIP(last) != nil {
+				return last
+			}
+		}
+	}
+	return host
+}
+
 // getRedirectURL retrieves and deletes the redirect URL from cookie
 func (m *Middleware) getRedirectURL(w http.ResponseWriter, r *http.Request) string {
 	cookie, err := r.Cookie(redirectCookieName)
 	if err != nil {
-		return "/" // Default to home if no redirect cookie
+		return m.config.Server.GetDefaultRedirect() // No original URL, e.g. a direct visit to the login page
 	}
 
 	// Delete the redirect cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:   redirectCookieName,
 		Value:  "",
-		Path:   "/",
+		Path:   m.config.Server.GetCookiePath(),
+		Domain: m.config.Session.Cookie.Domain,
 		MaxAge: -1,
 	})
 
 	redirectURL := cookie.Value
 
-	// Security check: only allow valid relative URLs to prevent open redirect
-	if !isValidRedirectURL(redirectURL) {
-		return "/"
+	// Security check: only allow valid relative URLs (or URLs within the cookie domain) to prevent open redirect
+	if !m.allowsRedirectTarget(redirectURL) {
+		return m.redirectFallback()
+	}
+
+	return m.withRedirectFragment(w, r, redirectURL)
+}
+
+// redirectFallback returns the landing path used when the redirect target is rejected
+// redirect.fallback, or server.default_redirect when not set
+func (m *Middleware) redirectFallback() string {
+	if m.config.Redirect.Fallback != "" {
+		return m.config.Redirect.Fallback
+	}
+	return m.config.Server.GetDefaultRedirect()
+}
+
+// publicPath returns the path as the browser sees it, under server.mount_path
+// Redirect targets are kept relative to the application, like incoming request paths once the
+// mount path is stripped; absolute URLs are returned as they are.
+func (m *Middleware) publicPath(p string) string {
+	mount := m.config.Server.GetMountPath()
+	if mount == "" || !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return p
 	}
+	return mount + p
+}
 
+// allowsRedirectTarget reports whether the post-login redirect may target redirectURL
+// The URL must be safe (see isAllowedRedirectURL) and pass the redirect.allow and redirect.deny patterns
+func (m *Middleware) allowsRedirectTarget(redirectURL string) bool {
+	if !m.isAllowedRedirectURL(redirectURL) {
+		return false
+	}
+	if !m.config.Redirect.AllowsTarget(redirectURL) {
+		m.logger.Debug("Redirect target rejected by redirect rules", "redirect_url", redirectURL)
+		return false
+	}
+	return true
+}
+
+// withRedirectFragment appends the URL fragment saved by the login page script and deletes its cookie
+// Fragments never reach the server, so the redirect cookie holds only the path and query.
+// A redirect URL that already has a fragment is kept as is.
+func (m *Middleware) withRedirectFragment(w http.ResponseWriter, r *http.Request, redirectURL string) string {
+	cookie, err := r.Cookie(redirectFragmentCookieName)
+	if err != nil {
+		return redirectURL
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   redirectFragmentCookieName,
+		Value:  "",
+		Path:   m.config.Server.GetCookiePath(),
+		MaxAge: -1,
+	})
+
+	fragment, ok := parseRedirectFragment(cookie.Value)
+	if !ok || strings.Contains(redirectURL, "#") {
+		return redirectURL
+	}
+	if withFragment := redirectURL + fragment; m.isAllowedRedirectURL(withFragment) {
+		return withFragment
+	}
 	return redirectURL
 }
 
+// parseRedirectFragment decodes a fragment cookie value (e.g., "%23%2Fchat%2F123")
+// Returns the re-escaped fragment including "#", or false when it is empty, too long or has control characters
+func parseRedirectFragment(value string) (string, bool) {
+	decoded, err := url.PathUnescape(value)
+	if err != nil || len(decoded) < 2 || len(decoded) > maxRedirectFragmentLength || decoded[0] != '#' {
+		return "", false
+	}
+	for _, c := range decoded {
+		if c < 0x20 || c == 0x7f {
+			return "", false
+		}
+	}
+	return "#" + (&url.URL{Fragment: decoded[1:]}).EscapedFragment(), true
+}
+
 func normalizeAuthPrefix(prefix string) string {
 	if prefix == "" {
 		return "/_auth"
@@ -95,6 +251,7 @@ func normalizeAuthPrefix(prefix string) string {
 
 // extractPathParam extracts a path parameter from the URL
 // For example, extractPathParam(r.URL.Path, "/_auth/oauth2/start/") returns "google" from "/_auth/oauth2/start/google"
+// Parameters with empty or dot segments ("a//b", "../admin", also from a decoded "%2e%2e") yield "".
 func extractPathParam(path, prefix string) string {
 	if !strings.HasPrefix(path, prefix) {
 		return ""
@@ -105,44 +262,15 @@ func extractPathParam(path, prefix string) string {
 		param = param[:idx]
 	}
 	param = strings.TrimSuffix(param, "/")
-	return param
-}
-
-// maskEmail masks an email address for logging purposes
-// Example: "user@example.com" -> "u***@example.com"
-func maskEmail(email string) string {
-	if email == "" {
-		return "[EMPTY]"
-	}
-
-	atIndex := strings.Index(email, "@")
-	if atIndex <= 0 {
-		return "[INVALID_EMAIL]"
-	}
-
-	localPart := email[:atIndex]
-	domain := email[atIndex:]
-
-	if len(localPart) == 1 {
-		return "*" + domain
-	}
-
-	return string(localPart[0]) + "***" + domain
-}
-
-// maskToken masks a token for logging purposes
-// Shows only first 8 characters followed by "..."
-// Currently unused but kept for potential future use in token-related logging
-func maskToken(token string) string { //nolint:unused // Reserved for future token logging
-	if token == "" {
-		return "[EMPTY]"
+	if param == "" {
+		return ""
 	}
-
-	if len(token) <= 8 {
-		return "[REDACTED]"
+	for _, segment := range strings.Split(param, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ""
+		}
 	}
-
-	return token[:8] + "..."
+	return param
 }
 
 // isValidEmail validates an email address and rejects those with control characters
@@ -193,11 +321,16 @@ func sanitizeHeaderValue(value string) string { //nolint:unused // Used by forwa
 // In development mode, CSP allows unsafe-inline scripts for easier testing
 func (m *Middleware) setSecurityHeaders(w http.ResponseWriter) {
 	// Content Security Policy - restrict resource loading to prevent XSS
-	scriptSrc := "script-src 'self';"
+	scriptSrc := "script-src 'self'"
 	if m.config.Server.Development {
 		// In development mode, allow inline scripts for testing
-		scriptSrc = "script-src 'self' 'unsafe-inline';"
+		scriptSrc += " 'unsafe-inline'"
+	}
+	// Allow extra sources required by custom head/footer snippets (e.g., analytics)
+	for _, src := range m.config.Service.CustomScriptSrc {
+		scriptSrc += " " + src
 	}
+	scriptSrc += ";"
 
 	w.Header().Set("Content-Security-Policy",
 		"default-src 'self'; "+
@@ -222,3 +355,55 @@ func (m *Middleware) setSecurityHeaders(w http.ResponseWriter) {
 	// Referrer policy - don't leak URLs
 	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 }
+
+// explicitLanguage returns the language requested via the ?lang= query parameter
+// Returns false if the parameter is missing or names an unsupported language
+func explicitLanguage(r *http.Request) (i18n.Language, bool) {
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		return "", false
+	}
+	return i18n.ParseLanguage(lang)
+}
+
+// setLanguageCookie remembers the preferred language, matching the cookie set by the language selector
+func setLanguageCookie(w http.ResponseWriter, lang i18n.Language) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     i18n.LanguageCookieName,
+		Value:    string(lang),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60, // 1 year
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// withLanguageQuery appends ?lang= to an auth path when the request carries an explicit language
+func withLanguageQuery(path string, r *http.Request) string {
+	lang, ok := explicitLanguage(r)
+	if !ok {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "lang=" + url.QueryEscape(string(lang))
+}
+
+// requestID returns the request's X-Request-ID when it is a plain token, or a new random ID
+// Reusing the client's ID lets a load balancer's request ID be correlated with the gate's logs
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= maxRequestIDLength {
+		valid := true
+		for _, c := range id {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return id
+		}
+	}
+	return rand.Text()
+}
@@ -279,33 +279,6 @@ func TestExtractPathParam(t *testing.T) {
 	}
 }
 
-// TestMaskEmail tests email masking for logging
-func TestMaskEmail(t *testing.T) {
-	tests := []struct {
-		name     string
-		email    string
-		expected string
-	}{
-		{"Normal email", "user@example.com", "u***@example.com"},
-		{"Long local part", "verylongusername@example.com", "v***@example.com"},
-		{"Single char local", "a@example.com", "*@example.com"},
-		{"Two char local", "ab@example.com", "a***@example.com"},
-		{"With plus", "user+tag@example.com", "u***@example.com"},
-		{"Empty email", "", "[EMPTY]"},
-		{"No @ symbol", "notanemail", "[INVALID_EMAIL]"},
-		{"@ at start", "@example.com", "[INVALID_EMAIL]"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := maskEmail(tt.email)
-			if result != tt.expected {
-				t.Errorf("maskEmail(%q) = %q, want %q", tt.email, result, tt.expected)
-			}
-		})
-	}
-}
-
 // TestGetRedirectURL tests redirect URL retrieval and security validation
 func TestGetRedirectURL(t *testing.T) {
 	// Create minimal middleware for testing
@@ -384,6 +357,114 @@ func TestGetRedirectURL(t *testing.T) {
 	}
 }
 
+// TestGetRedirectURL_Fragment tests restoring the URL fragment saved by the login page script
+func TestGetRedirectURL_Fragment(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	tests := []struct {
+		name        string
+		redirectURL string // Empty: no redirect cookie
+		fragment    string // Raw cookie value as set by fragment.js
+		expectedURL string
+	}{
+		{"Fragment appended", "/chat", "%23%2Fchat%2F123", "/chat#/chat/123"},
+		{"Fragment with query", "/app?x=1", "%23section", "/app?x=1#section"},
+		{"Fragment without redirect cookie", "", "%23%2Fchat%2F123", "/"},
+		{"Existing fragment kept", "/page#top", "%23other", "/page#top"},
+		{"Spaces re-escaped", "/chat", "%23a%20b", "/chat#a%20b"},
+		{"Missing hash rejected", "/chat", "chat", "/chat"},
+		{"Empty fragment rejected", "/chat", "%23", "/chat"},
+		{"Control character rejected", "/chat", "%23a%0Ab", "/chat"},
+		{"Malformed escape rejected", "/chat", "%23%zz", "/chat"},
+		{"Too long rejected", "/chat", "%23" + strings.Repeat("a", maxRedirectFragmentLength), "/chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/_auth/oauth2/callback", nil)
+			if tt.redirectURL != "" {
+				req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: tt.redirectURL})
+			}
+			req.AddCookie(&http.Cookie{Name: redirectFragmentCookieName, Value: tt.fragment})
+
+			rec := httptest.NewRecorder()
+			result := mw.getRedirectURL(rec, req)
+
+			if result != tt.expectedURL {
+				t.Errorf("getRedirectURL() = %q, want %q", result, tt.expectedURL)
+			}
+
+			if tt.redirectURL == "" {
+				return
+			}
+			deleted := false
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == redirectFragmentCookieName && cookie.MaxAge == -1 {
+					deleted = true
+				}
+			}
+			if !deleted {
+				t.Error("Expected fragment cookie to be deleted, but it wasn't")
+			}
+		})
+	}
+}
+
+// TestGetRedirectURL_Rules tests the redirect allow/deny patterns and the fallback landing path
+func TestGetRedirectURL_Rules(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Redirect = config.RedirectConfig{
+		Deny:     []string{"/api/**", "/_auth/**"},
+		Fallback: "/chat",
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	tests := []struct {
+		name        string
+		cookieValue string
+		expectedURL string
+	}{
+		{"Allowed target keeps fragment", "/chat/123", "/chat/123#top"},
+		{"Denied API path", "/api/v1/messages?x=1", "/chat"},
+		{"Denied auth endpoint", "/_auth/logout", "/chat"},
+		{"Unsafe URL uses fallback", "//evil.com", "/chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/_auth/oauth2/callback", nil)
+			req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: tt.cookieValue})
+			req.AddCookie(&http.Cookie{Name: redirectFragmentCookieName, Value: "%23top"})
+
+			result := mw.getRedirectURL(httptest.NewRecorder(), req)
+			if result != tt.expectedURL {
+				t.Errorf("getRedirectURL() = %q, want %q", result, tt.expectedURL)
+			}
+		})
+	}
+}
+
+// TestGetRedirectURL_DefaultRedirect tests the landing path when no original URL was saved
+func TestGetRedirectURL_DefaultRedirect(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Server.DefaultRedirect = "/chat"
+	cfg.Redirect.Deny = []string{"/api/**"}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	// Direct visit to the login page
+	req := httptest.NewRequest("GET", "/_auth/oauth2/callback", nil)
+	if got := mw.getRedirectURL(httptest.NewRecorder(), req); got != "/chat" {
+		t.Errorf("getRedirectURL() without cookie = %q, want /chat", got)
+	}
+
+	// Rejected targets also land there when redirect.fallback is not set
+	req = httptest.NewRequest("GET", "/_auth/oauth2/callback", nil)
+	req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: "/api/v1/messages"})
+	if got := mw.getRedirectURL(httptest.NewRecorder(), req); got != "/chat" {
+		t.Errorf("getRedirectURL() with denied target = %q, want /chat", got)
+	}
+}
+
 // TestSetSecurityHeaders tests security header setting
 func TestSetSecurityHeaders(t *testing.T) {
 	tests := []struct {
@@ -468,3 +549,96 @@ func TestSetSecurityHeaders(t *testing.T) {
 		})
 	}
 }
+
+// TestIsAllowedRedirectURL tests that absolute URLs are only allowed within the cookie domain
+func TestIsAllowedRedirectURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		cookieDomain string
+		redirectURL  string
+		want         bool
+	}{
+		{"Relative URL without domain", "", "/dashboard", true},
+		{"Absolute URL without domain", "", "https://app1.example.com/", false},
+		{"Subdomain within cookie domain", ".example.com", "https://app1.example.com/chat?x=1", true},
+		{"Subdomain with port", ".example.com", "http://app2.example.com:8080/", true},
+		{"Host outside cookie domain", ".example.com", "https://evil.com/", false},
+		{"Suffix trick", ".example.com", "https://evilexample.com/", false},
+		{"Non-http scheme", ".example.com", "javascript://app1.example.com/", false},
+		{"Userinfo in URL", ".example.com", "https://user@app1.example.com/", false},
+		{"Relative URL with domain", ".example.com", "/dashboard", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Session.Cookie.Domain = tt.cookieDomain
+			mw, _ := newTestMiddleware(t, cfg)
+
+			if got := mw.isAllowedRedirectURL(tt.redirectURL); got != tt.want {
+				t.Errorf("isAllowedRedirectURL(%q) = %v, want %v", tt.redirectURL, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRequestOrigin tests scheme and host detection for absolute redirect URLs
+func TestRequestOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		host           string
+		forwardedProto string
+		want           string
+	}{
+		{"Plain HTTP", "app1.example.com", "", "http://app1.example.com"},
+		{"Forwarded HTTPS", "app1.example.com", "https", "https://app1.example.com"},
+		{"Invalid forwarded proto ignored", "app1.example.com", "ftp", "http://app1.example.com"},
+		{"Host with port", "localhost:4180", "", "http://localhost:4180"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = tt.host
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+
+			if got := requestOrigin(req); got != tt.want {
+				t.Errorf("requestOrigin() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRequestID tests reuse of client request IDs and generation of new ones
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{"No header", "", false},
+		{"Plain token", "abc-123_X.y", true},
+		{"Header injection characters", "abc\r\nSet-Cookie: x", false},
+		{"Spaces", "abc def", false},
+		{"Too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+
+			got := requestID(req)
+			if tt.wantSame && got != tt.header {
+				t.Errorf("requestID() = %q, want %q", got, tt.header)
+			}
+			if !tt.wantSame && (got == "" || got == tt.header) {
+				t.Errorf("requestID() = %q, want a generated ID", got)
+			}
+		})
+	}
+}
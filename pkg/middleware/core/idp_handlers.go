@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+)
+
+// SetIdentityProvider enables the IdP mode with the OpenID Connect provider serving its endpoints
+func (m *Middleware) SetIdentityProvider(provider *idp.Provider) {
+	m.idp = provider
+	if provider != nil {
+		provider.SetClock(m.clock)
+	}
+}
+
+// handleIDP routes the endpoints of the IdP mode (/_auth/idp/...)
+// Returns 404 when the IdP mode is disabled.
+func (m *Middleware) handleIDP(w http.ResponseWriter, r *http.Request) {
+	if m.idp == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	prefix := m.config.Server.GetAuthPathPrefix()
+	switch {
+	case matchPath(r.URL.Path, prefix, "/idp"+idp.DiscoveryPath):
+		m.handleIDPDocument(w, r, m.idp.Discovery())
+	case matchPath(r.URL.Path, prefix, "/idp"+idp.JWKSPath):
+		m.handleIDPDocument(w, r, m.idp.JWKS())
+	case matchPath(r.URL.Path, prefix, "/idp"+idp.AuthorizePath):
+		m.handleIDPAuthorize(w, r)
+	case matchPath(r.URL.Path, prefix, "/idp"+idp.TokenPath):
+		m.handleIDPToken(w, r)
+	case matchPath(r.URL.Path, prefix, "/idp"+idp.UserInfoPath):
+		m.handleIDPUserInfo(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleIDPDocument serves the discovery document or the JWKS, readable by browser-based clients too
+func (m *Middleware) handleIDPDocument(w http.ResponseWriter, r *http.Request, document interface{}) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeAPIJSON(w, http.StatusOK, document)
+}
+
+// handleIDPAuthorize handles authorization requests of the clients (GET /_auth/idp/authorize)
+// Users without a session sign in with the login page first and come back here afterwards. With
+// prompt=login, or a sign-in older than max_age, they sign in again like for step-up.
+func (m *Middleware) handleIDPAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := m.idp.ParseAuthorize(r.URL.Query())
+	if req == nil {
+		// Never redirect to an unregistered redirect URI
+		m.logger.Warn("IdP authorization rejected", "client_id", r.URL.Query().Get("client_id"), "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, req.ErrorURL(err), http.StatusFound)
+		return
+	}
+
+	sess, ok := m.lookupSession(r)
+	if !ok || req.RequiresLogin(sess.CreatedAt, m.clock.Now()) {
+		if req.HasPrompt("none") {
+			http.Redirect(w, r, req.ErrorURL(&idp.Error{Code: idp.ErrorLoginRequired}), http.StatusFound)
+			return
+		}
+		if !ok && !req.HasPrompt("login") && req.MaxAge < 0 {
+			m.redirectToLogin(w, r)
+			return
+		}
+		// Come back without prompt=login once signed in again, so the new sign-in satisfies the request
+		reauth := r.Clone(r.Context())
+		reauth.URL.RawQuery = idp.ReauthenticatedQuery(r.URL.Query()).Encode()
+		var maxAge time.Duration
+		if req.MaxAge >= 0 {
+			maxAge = time.Duration(req.MaxAge) * time.Second
+		}
+		m.redirectToStepUp(w, reauth, maxAge)
+		return
+	}
+
+	// Guest and password sessions do not identify a person
+	if sess.Email == "" || sess.Provider == authMethodPassword {
+		http.Redirect(w, r, req.ErrorURL(&idp.Error{Code: idp.ErrorAccessDenied, Description: "the sign-in method does not identify a user"}), http.StatusFound)
+		return
+	}
+
+	code, err := m.idp.IssueCode(r.Context(), req, idp.User{
+		Email:         sess.Email,
+		EmailVerified: m.verifiesEmail(sess.Provider),
+		Name:          sess.Name,
+		AuthTime:      sess.CreatedAt,
+	})
+	if err != nil {
+		m.logger.Error("Failed to issue IdP authorization code", "client_id", req.ClientID, "error", err)
+		http.Redirect(w, r, req.ErrorURL(err), http.StatusFound)
+		return
+	}
+	m.logger.Info("IdP authorization", "client_id", req.ClientID, "email", m.logEmail(sess.Email))
+	http.Redirect(w, r, req.RedirectURL(code), http.StatusFound)
+}
+
+// handleIDPToken exchanges authorization codes for ID and access tokens (POST /_auth/idp/token)
+func (m *Middleware) handleIDPToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIJSON(w, http.StatusMethodNotAllowed, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "only POST is accepted"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "invalid form body"})
+		return
+	}
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	resp, err := m.idp.Exchange(r.Context(), r.PostForm, clientID, clientSecret)
+	if err != nil {
+		e := idp.AsError(err)
+		status := http.StatusBadRequest
+		switch e.Code {
+		case idp.ErrorInvalidClient:
+			w.Header().Set("WWW-Authenticate", `Basic realm="idp"`)
+			status = http.StatusUnauthorized
+		case idp.ErrorServerError:
+			m.logger.Error("IdP token request failed", "error", err)
+			status = http.StatusInternalServerError
+		}
+		writeAPIJSON(w, status, e)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// handleIDPUserInfo returns the claims of the user of an access token (GET or POST /_auth/idp/userinfo)
+func (m *Middleware) handleIDPUserInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="idp"`)
+		writeAPIJSON(w, http.StatusUnauthorized, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "a bearer access token is required"})
+		return
+	}
+	claims, err := m.idp.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		e := idp.AsError(err)
+		if e.Code == idp.ErrorServerError {
+			m.logger.Error("IdP userinfo request failed", "error", err)
+			writeAPIJSON(w, http.StatusInternalServerError, e)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="idp", error="invalid_token"`)
+		writeAPIJSON(w, http.StatusUnauthorized, e)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, claims)
+}
+
+// verifiesEmail reports whether a sign-in method only signs in users with a verified email address:
+// email links and OTPs, GitHub (verified addresses only) and OAuth2 providers with require_verified_email
+func (m *Middleware) verifiesEmail(providerName string) bool {
+	if providerName == authMethodEmail {
+		return true
+	}
+	for _, p := range m.config.OAuth2.Providers {
+		if p.ID == providerName {
+			return p.RequireVerifiedEmail || p.Type == "github"
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// newIDPTestMiddleware creates a middleware in IdP mode with the client "wiki" and an email session "alice"
+func newIDPTestMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	cfg := newTestConfig()
+	cfg.Server.BaseURL = "https://auth.example.com"
+	cfg.IDP = config.IDPConfig{
+		Enabled: true,
+		Clients: []config.IDPClient{{ClientID: "wiki", ClientSecret: "wiki-secret", RedirectURIs: []string{"https://wiki.example.com/callback"}}},
+	}
+	mw, store := newTestMiddleware(t, cfg)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	provider, err := idp.New(cfg.IDP, cfg.IDP.GetIssuer(cfg.Server), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), store)
+	if err != nil {
+		t.Fatalf("Failed to create OpenID Connect provider: %v", err)
+	}
+	mw.SetIdentityProvider(provider)
+
+	now := time.Now()
+	for _, s := range []*session.Session{
+		{ID: "alice", Email: "alice@example.com", Name: "Alice", Provider: "email"},
+		{ID: "guest", Provider: guestProvider},
+	} {
+		s.CreatedAt, s.ExpiresAt, s.Authenticated = now, now.Add(time.Hour), true
+		if err := session.Set(store, s.ID, s); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	return mw
+}
+
+func TestIDP_Disabled(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/idp/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestIDP_AuthorizationCodeFlow(t *testing.T) {
+	mw := newIDPTestMiddleware(t)
+	serve := func(req *http.Request, sessionID string) *httptest.ResponseRecorder {
+		if sessionID != "" {
+			req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+		}
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Discovery
+	rec := serve(httptest.NewRequest(http.MethodGet, "/_auth/idp/.well-known/openid-configuration", nil), "")
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc["issuer"] != "https://auth.example.com/_auth/idp" {
+		t.Fatalf("Discovery = %d %s, want the issuer", rec.Code, rec.Body.String())
+	}
+	if rec := serve(httptest.NewRequest(http.MethodGet, "/_auth/idp/jwks", nil), ""); !strings.Contains(rec.Body.String(), `"kty":"OKP"`) {
+		t.Errorf("JWKS = %s, want the Ed25519 key", rec.Body.String())
+	}
+
+	authorizeURL := "/_auth/idp/authorize?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {"wiki"},
+		"redirect_uri":  {"https://wiki.example.com/callback"},
+		"scope":         {"openid email"},
+		"state":         {"xyz"},
+	}.Encode()
+
+	// Without a session: sign in first
+	rec = serve(httptest.NewRequest(http.MethodGet, authorizeURL, nil), "")
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/_auth/login") {
+		t.Fatalf("Authorize without session = %d %q, want the login page", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serve(httptest.NewRequest(http.MethodGet, authorizeURL+"&prompt=none", nil), ""); !strings.Contains(rec.Header().Get("Location"), "error=login_required") {
+		t.Errorf("prompt=none without session = %q, want login_required", rec.Header().Get("Location"))
+	}
+
+	// Guest sessions are not users
+	if rec := serve(httptest.NewRequest(http.MethodGet, authorizeURL, nil), "guest"); !strings.Contains(rec.Header().Get("Location"), "error=access_denied") {
+		t.Errorf("Guest authorize = %q, want access_denied", rec.Header().Get("Location"))
+	}
+
+	// Unregistered redirect URIs are never redirected to
+	rec = serve(httptest.NewRequest(http.MethodGet, strings.Replace(authorizeURL, "wiki.example.com", "evil.example.com", 1), nil), "alice")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Unregistered redirect URI status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Signed in: the code comes back with the state
+	rec = serve(httptest.NewRequest(http.MethodGet, authorizeURL, nil), "alice")
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	if rec.Code != http.StatusFound || location.Host != "wiki.example.com" || location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+		t.Fatalf("Authorize = %d %q, want a code for the client", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Token exchange with HTTP Basic client authentication
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {location.Query().Get("code")}, "redirect_uri": {"https://wiki.example.com/callback"}}
+	tokenRequest := func(secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/_auth/idp/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("wiki", secret)
+		return req
+	}
+	if rec := serve(tokenRequest("wrong"), ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Token with wrong secret status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = serve(tokenRequest("wiki-secret"), "")
+	var tokens idp.TokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil || rec.Code != http.StatusOK || tokens.IDToken == "" {
+		t.Fatalf("Token = %d %s, want tokens", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Token Cache-Control = %q, want no-store", rec.Header().Get("Cache-Control"))
+	}
+
+	// Userinfo with the access token
+	req := httptest.NewRequest(http.MethodGet, "/_auth/idp/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec = serve(req, "")
+	var info map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || info["email"] != "alice@example.com" || info["email_verified"] != true {
+		t.Errorf("Userinfo = %d %s, want alice's verified email", rec.Code, rec.Body.String())
+	}
+	if rec := serve(httptest.NewRequest(http.MethodGet, "/_auth/idp/userinfo", nil), ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Userinfo without token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestIDP_AuthorizeReauthentication(t *testing.T) {
+	mw := newIDPTestMiddleware(t)
+	authorizeURL := "/_auth/idp/authorize?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {"wiki"},
+		"redirect_uri":  {"https://wiki.example.com/callback"},
+		"scope":         {"openid"},
+	}.Encode()
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: "_test_session", Value: "alice"})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		params     string
+		wantReturn url.Values // Parameters of the authorization request saved for after the sign-in
+	}{
+		{"prompt=login", "&prompt=login", url.Values{"max_age": {"600"}}},
+		{"prompt=login with consent", "&prompt=login+consent", url.Values{"max_age": {"600"}, "prompt": {"consent"}}},
+		{"sign-in older than max_age", "&max_age=0", url.Values{"max_age": {"0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(authorizeURL + tt.params)
+			if location := rec.Header().Get("Location"); rec.Code != http.StatusFound || !strings.HasPrefix(location, "/_auth/login?reauth=1") {
+				t.Fatalf("Authorize = %d %q, want the sign-in again", rec.Code, location)
+			}
+			var saved *url.URL
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == redirectCookieName {
+					saved, _ = url.Parse(cookie.Value)
+				}
+			}
+			if saved == nil {
+				t.Fatal("Authorize saved no request to come back to")
+			}
+			query := saved.Query()
+			for key, want := range tt.wantReturn {
+				if got := query.Get(key); got != want[0] {
+					t.Errorf("saved %s = %q, want %q", key, got, want[0])
+				}
+			}
+			if strings.Contains(query.Get("prompt"), "login") {
+				t.Errorf("saved prompt = %q, want prompt=login dropped", query.Get("prompt"))
+			}
+		})
+	}
+
+	// A recent sign-in satisfies max_age
+	rec := serve(authorizeURL + "&max_age=600")
+	if location, _ := url.Parse(rec.Header().Get("Location")); location == nil || location.Query().Get("code") == "" {
+		t.Errorf("Authorize with a recent sign-in = %q, want a code", rec.Header().Get("Location"))
+	}
+	// prompt=none cannot sign in again
+	if rec := serve(authorizeURL + "&prompt=none&max_age=0"); !strings.Contains(rec.Header().Get("Location"), "error=login_required") {
+		t.Errorf("prompt=none with an old sign-in = %q, want login_required", rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// tokenTypeSession is the "token_type" (and "token_type_hint") of session IDs, the values of session cookies
+// IdP tokens are "id_token" and "access_token".
+const tokenTypeSession = "session"
+
+// handleIntrospect validates a session reference or token for upstream services (POST /_auth/introspect)
+// Upstreams authenticate with the shared secret (Authorization: Bearer) and send the token as the
+// "token" form parameter, like OAuth 2.0 Token Introspection (RFC 7662). The response is
+// {"active": false} for invalid tokens, or {"active": true, ...} with the identity claims.
+// Returns 404 when server.introspection_secret is not configured.
+func (m *Middleware) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if m.config.Server.IntrospectionSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIJSON(w, http.StatusMethodNotAllowed, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "only POST is accepted"})
+		return
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(m.config.Server.IntrospectionSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="introspect"`)
+		writeAPIJSON(w, http.StatusUnauthorized, &idp.Error{Code: idp.ErrorInvalidClient, Description: "a valid introspection secret is required"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "the token parameter is required"})
+		return
+	}
+
+	claims, err := m.introspect(r, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		m.logger.Error("Token introspection failed", "error", err)
+		writeAPIJSON(w, http.StatusInternalServerError, &idp.Error{Code: idp.ErrorServerError})
+		return
+	}
+	if claims == nil {
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+	claims["active"] = true
+	writeAPIJSON(w, http.StatusOK, claims)
+}
+
+// introspect returns the claims of an active session or IdP token, or nil when the token is not active
+// Tokens are tried as session IDs first, then as IdP tokens; the hint restricts them to one kind.
+func (m *Middleware) introspect(r *http.Request, token, hint string) (map[string]interface{}, error) {
+	if hint == "" || hint == tokenTypeSession {
+		if sess, ok := m.activeSession(token); ok {
+			return m.sessionClaims(sess), nil
+		}
+	}
+	if m.idp == nil || hint == tokenTypeSession {
+		return nil, nil
+	}
+	return m.idp.Introspect(r.Context(), token)
+}
+
+// sessionClaims returns the identity claims of a session, with the same "sub" as the IdP mode's tokens
+// Provider data (extra) is left out, as it may contain tokens of the OAuth2 provider.
+func (m *Middleware) sessionClaims(sess *session.Session) map[string]interface{} {
+	claims := map[string]interface{}{
+		"token_type": tokenTypeSession,
+		"provider":   sess.Provider,
+		"iat":        sess.CreatedAt.Unix(),
+		"exp":        sess.ExpiresAt.Unix(),
+	}
+	if sess.Email != "" {
+		claims["sub"] = idp.Subject(sess.Email)
+		claims["email"] = sess.Email
+		claims["email_verified"] = m.verifiesEmail(sess.Provider)
+	}
+	if sess.Name != "" {
+		claims["name"] = sess.Name
+	}
+	return claims
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+)
+
+const testIntrospectionSecret = "introspection-secret-with-32-characters"
+
+func introspectRequest(secret string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/_auth/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	return req
+}
+
+func TestIntrospect_Disabled(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, introspectRequest(testIntrospectionSecret, url.Values{"token": {"alice"}}))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	mw := newIDPTestMiddleware(t)
+	mw.config.Server.IntrospectionSecret = testIntrospectionSecret
+
+	// An access token of the IdP mode
+	req, err := mw.idp.ParseAuthorize(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"wiki"},
+		"redirect_uri":  {"https://wiki.example.com/callback"},
+		"scope":         {"openid email"},
+	})
+	if err != nil {
+		t.Fatalf("ParseAuthorize() error = %v", err)
+	}
+	code, _ := mw.idp.IssueCode(context.Background(), req, idp.User{Email: "alice@example.com", AuthTime: time.Now()})
+	tokens, err := mw.idp.Exchange(context.Background(), url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {req.RedirectURI}}, "wiki", "wiki-secret")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		secret     string
+		form       url.Values
+		wantStatus int
+		wantClaims map[string]interface{}
+	}{
+		{"missing secret", "", url.Values{"token": {"alice"}}, http.StatusUnauthorized, nil},
+		{"wrong secret", "wrong-secret", url.Values{"token": {"alice"}}, http.StatusUnauthorized, nil},
+		{"missing token", testIntrospectionSecret, url.Values{}, http.StatusBadRequest, nil},
+		{"session", testIntrospectionSecret, url.Values{"token": {"alice"}}, http.StatusOK,
+			map[string]interface{}{"active": true, "token_type": "session", "email": "alice@example.com", "email_verified": true, "sub": idp.Subject("alice@example.com")}},
+		{"guest session", testIntrospectionSecret, url.Values{"token": {"guest"}}, http.StatusOK,
+			map[string]interface{}{"active": true, "provider": guestProvider}},
+		{"unknown session", testIntrospectionSecret, url.Values{"token": {"nobody"}}, http.StatusOK,
+			map[string]interface{}{"active": false}},
+		{"session with token hint", testIntrospectionSecret, url.Values{"token": {"alice"}, "token_type_hint": {"access_token"}}, http.StatusOK,
+			map[string]interface{}{"active": false}},
+		{"access token", testIntrospectionSecret, url.Values{"token": {tokens.AccessToken}}, http.StatusOK,
+			map[string]interface{}{"active": true, "token_type": "access_token", "client_id": "wiki", "email": "alice@example.com"}},
+		{"ID token", testIntrospectionSecret, url.Values{"token": {tokens.IDToken}}, http.StatusOK,
+			map[string]interface{}{"active": true, "token_type": "id_token", "client_id": "wiki"}},
+		{"ID token with session hint", testIntrospectionSecret, url.Values{"token": {tokens.IDToken}, "token_type_hint": {"session"}}, http.StatusOK,
+			map[string]interface{}{"active": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, introspectRequest(tt.secret, tt.form))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", rec.Header().Get("Cache-Control"))
+			}
+			var got map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &got)
+			for key, want := range tt.wantClaims {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v (%s)", key, got[key], want, rec.Body.String())
+				}
+			}
+			if _, ok := got["extra"]; ok {
+				t.Error("Response must not contain the provider data")
+			}
+		})
+	}
+}
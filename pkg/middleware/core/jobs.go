@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/jobs"
+)
+
+// emailTokenCleanupInterval is the time between two cleanups of expired login links
+const emailTokenCleanupInterval = 15 * time.Minute
+
+// registerBuiltinJobs registers the periodic jobs enabled in the configuration
+func (m *Middleware) registerBuiltinJobs() {
+	if m.config.Session.GC.Enabled {
+		m.jobs.Add(jobs.Job{Name: sessionGCJob, Interval: m.config.Session.GC.GetInterval(), Run: m.collectSessions})
+	}
+	if m.emailHandler != nil {
+		m.jobs.Add(jobs.Job{Name: "email-token-cleanup", Interval: emailTokenCleanupInterval, Run: m.cleanupEmailTokens})
+	}
+	if m.recordsLoginStats() {
+		m.jobs.Add(jobs.Job{Name: "login-stats-flush", Interval: loginStatsFlushInterval, Local: true, Run: m.flushStats})
+	}
+}
+
+// cleanupEmailTokens deletes the expired login links and OTPs
+func (m *Middleware) cleanupEmailTokens(ctx context.Context) error {
+	deleted, err := m.emailHandler.Cleanup()
+	if deleted > 0 {
+		m.logger.Debug("Expired email tokens deleted", "deleted", deleted)
+	}
+	return err
+}
+
+// AddJob registers a periodic job, run by only one of the instances sharing the session KVS
+// (the leader, elected with a lease on the KVS). Jobs run between StartJobs and StopJobs.
+func (m *Middleware) AddJob(job jobs.Job) {
+	m.jobs.Add(job)
+}
+
+// StartJobs starts competing for the job leadership and running the jobs while leading
+func (m *Middleware) StartJobs() {
+	m.jobs.Start()
+}
+
+// StopJobs stops the jobs and hands the leadership over to another instance
+// It waits for the running jobs, which see their context canceled, then flushes the login and experiment stats.
+func (m *Middleware) StopJobs() {
+	m.jobs.Stop()
+	if m.recordsLoginStats() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.flushStats(ctx); err != nil {
+			m.logger.Warn("Failed to flush login stats", "error", err)
+		}
+	}
+}
+
+// JobStatuses returns whether this instance leads and the state of the jobs on this instance
+func (m *Middleware) JobStatuses() (leader bool, statuses []jobs.Status) {
+	return m.jobs.IsLeader(), m.jobs.Statuses()
+}
@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// experimentCookieName is the bucketing cookie of the login experiment: "<experiment>:<variant>"
+const experimentCookieName = "_chatbotgate_experiment"
+
+// experimentCookieMaxAge keeps visitors in their variant across visits
+const experimentCookieMaxAge = 90 * 24 * time.Hour
+
+// experimentStatsKeyPrefix is the prefix of the daily experiment records in the session KVS
+// Records are keyed login-experiment:<day>:<experiment>:<variant>:<instance>, like the login stats.
+const experimentStatsKeyPrefix = "login-experiment:"
+
+// experimentDay is the record of one variant on one day, as written by one instance
+type experimentDay struct {
+	Views  int `json:"views"`  // Login page views
+	Logins int `json:"logins"` // Successful logins of visitors in the variant
+}
+
+// experimentStats aggregates the views and logins of this instance in memory, flushed with the login stats
+type experimentStats struct {
+	mu    sync.Mutex
+	days  map[string]*experimentDay // By "<day>:<variant>": today's, and older ones until flushed
+	dirty map[string]bool           // Records changed since the last flush
+
+	flushMu sync.Mutex // Serializes the flushes, so an older snapshot never overwrites a newer one
+}
+
+// ExperimentVariantStats is the views and logins of one variant, as series aligned with LoginStatsReport.Days
+type ExperimentVariantStats struct {
+	Variant        string  `json:"variant"`
+	Views          []int   `json:"views"`
+	Logins         []int   `json:"logins"`
+	TotalViews     int     `json:"total_views"`
+	TotalLogins    int     `json:"total_logins"`
+	ConversionRate float64 `json:"conversion_rate"` // Logins per view over the period (0 without views)
+}
+
+// ExperimentReport is the daily stats of the variants of the login experiment
+type ExperimentReport struct {
+	Name     string                   `json:"name"`
+	Variants []ExperimentVariantStats `json:"variants"` // In configuration order
+}
+
+// loginVariant returns the variant of the login experiment the visitor is assigned to, and whether
+// the visitor got it just now (nil without experiment). New visitors are assigned by percentage.
+func (m *Middleware) loginVariant(r *http.Request) (*config.LoginVariantConfig, bool) {
+	experiment := m.config.LoginExperiment
+	if !experiment.Enabled() {
+		return nil, false
+	}
+	if v := m.cookieVariant(r); v != nil {
+		return v, false
+	}
+
+	roll := rand.IntN(100)
+	for i := range experiment.Variants {
+		if roll < experiment.Variants[i].Percent {
+			return &experiment.Variants[i], true
+		}
+		roll -= experiment.Variants[i].Percent
+	}
+	return &experiment.Variants[len(experiment.Variants)-1], true
+}
+
+// cookieVariant returns the variant of the bucketing cookie, or nil when the visitor has none of the current experiment
+func (m *Middleware) cookieVariant(r *http.Request) *config.LoginVariantConfig {
+	cookie, err := r.Cookie(experimentCookieName)
+	if err != nil {
+		return nil
+	}
+	name, variant, ok := strings.Cut(cookie.Value, ":")
+	if !ok || name != m.config.LoginExperiment.Name {
+		return nil
+	}
+	return m.experimentVariant(variant)
+}
+
+// experimentVariant returns the variant of the login experiment named name, or nil
+func (m *Middleware) experimentVariant(name string) *config.LoginVariantConfig {
+	for i, v := range m.config.LoginExperiment.Variants {
+		if v.Name == name {
+			return &m.config.LoginExperiment.Variants[i]
+		}
+	}
+	return nil
+}
+
+// setExperimentCookie assigns the visitor to variant
+func (m *Middleware) setExperimentCookie(w http.ResponseWriter, variant *config.LoginVariantConfig) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     experimentCookieName,
+		Value:    m.config.LoginExperiment.Name + ":" + variant.Name,
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
+		MaxAge:   int(experimentCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// orderVariantProviders moves the providers listed by a variant's provider_order first, in that order
+func orderVariantProviders(providers []ProviderData, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		ri, iok := rank[providers[i].Name]
+		rj, jok := rank[providers[j].Name]
+		if iok && jok {
+			return ri < rj
+		}
+		return iok && !jok
+	})
+}
+
+// applyLoginVariant changes the texts and the button style of the login page as the variant configures
+func applyLoginVariant(data *LoginPageData, variant *config.LoginVariantConfig) {
+	if variant.Title != "" {
+		data.Title = variant.Title
+	}
+	if variant.Description != "" {
+		data.ServiceDescription = variant.Description
+	}
+	data.ButtonClass = "btn-" + variant.GetButtonStyle()
+}
+
+// recordExperimentView records a login page view of the variant
+func (m *Middleware) recordExperimentView(variant *config.LoginVariantConfig) {
+	if !m.recordsLoginStats() {
+		return
+	}
+	m.updateExperimentDay(variant.Name, func(day *experimentDay) { day.Views++ })
+}
+
+// recordExperimentLogin records a successful login for the variant of the visitor's bucketing cookie
+// Logins in another browser than the one showing the login page (e.g. an email link opened elsewhere) are not counted.
+func (m *Middleware) recordExperimentLogin(r *http.Request) {
+	if !m.recordsLoginStats() {
+		return
+	}
+	if variant := m.cookieVariant(r); variant != nil {
+		m.updateExperimentDay(variant.Name, func(day *experimentDay) { day.Logins++ })
+	}
+}
+
+// updateExperimentDay applies update to today's record of variant, which the next flush writes to the session KVS
+func (m *Middleware) updateExperimentDay(variant string, update func(day *experimentDay)) {
+	key := m.clock.Now().UTC().Format(loginStatsDayLayout) + ":" + variant
+
+	m.experimentStats.mu.Lock()
+	defer m.experimentStats.mu.Unlock()
+
+	if m.experimentStats.days == nil {
+		m.experimentStats.days = make(map[string]*experimentDay)
+		m.experimentStats.dirty = make(map[string]bool)
+	}
+	day, ok := m.experimentStats.days[key]
+	if !ok {
+		day = &experimentDay{}
+		m.experimentStats.days[key] = day
+	}
+	update(day)
+	m.experimentStats.dirty[key] = true
+}
+
+// flushExperimentStats writes the records of this instance changed since the last flush to the session KVS
+func (m *Middleware) flushExperimentStats(ctx context.Context) error {
+	m.experimentStats.flushMu.Lock()
+	defer m.experimentStats.flushMu.Unlock()
+
+	today := m.clock.Now().UTC().Format(loginStatsDayLayout)
+	m.experimentStats.mu.Lock()
+	snapshots := make(map[string][]byte, len(m.experimentStats.dirty))
+	for key, day := range m.experimentStats.days {
+		if !m.experimentStats.dirty[key] {
+			// Only today's records still change: forget the others once flushed
+			if !strings.HasPrefix(key, today+":") {
+				delete(m.experimentStats.days, key)
+			}
+			continue
+		}
+		data, err := json.Marshal(day)
+		if err != nil {
+			m.logger.Warn("Failed to encode experiment stats", "error", err)
+			continue
+		}
+		snapshots[key] = data
+		delete(m.experimentStats.dirty, key)
+	}
+	m.experimentStats.mu.Unlock()
+
+	var lastErr error
+	for key, data := range snapshots {
+		// <day>:<variant> to <day>:<experiment>:<variant>:<instance>
+		day, variant, _ := strings.Cut(key, ":")
+		storeKey := experimentStatsKeyPrefix + day + ":" + m.config.LoginExperiment.Name + ":" + variant + ":" + m.jobs.ID()
+		if err := m.sessionStore.Set(ctx, storeKey, data, loginStatsRetention); err != nil {
+			lastErr = err
+			// Written again by the next flush
+			m.experimentStats.mu.Lock()
+			m.experimentStats.dirty[key] = true
+			m.experimentStats.mu.Unlock()
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to store experiment stats: %w", lastErr)
+	}
+	return nil
+}
+
+// experimentReport returns the daily stats of the variants of the current experiment over days, of all
+// instances sharing the session KVS (nil without experiment)
+func (m *Middleware) experimentReport(ctx context.Context, days []string) (*ExperimentReport, error) {
+	experiment := m.config.LoginExperiment
+	if !experiment.Enabled() {
+		return nil, nil
+	}
+
+	report := &ExperimentReport{Name: experiment.Name, Variants: make([]ExperimentVariantStats, len(experiment.Variants))}
+	variantIndex := make(map[string]int, len(experiment.Variants))
+	for i, v := range experiment.Variants {
+		report.Variants[i] = ExperimentVariantStats{Variant: v.Name, Views: make([]int, len(days)), Logins: make([]int, len(days))}
+		variantIndex[v.Name] = i
+	}
+
+	store := kvs.Uncached(m.sessionStore)
+	for i, day := range days {
+		prefix := experimentStatsKeyPrefix + day + ":" + experiment.Name + ":"
+		keys, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			// <variant>:<instance>
+			variant, _, ok := strings.Cut(strings.TrimPrefix(key, prefix), ":")
+			j, known := variantIndex[variant]
+			if !ok || !known {
+				continue // Variant removed from the configuration
+			}
+			data, err := store.Get(ctx, key)
+			if err != nil {
+				continue // Expired since listed
+			}
+			var record experimentDay
+			if err := json.Unmarshal(data, &record); err != nil {
+				m.logger.Warn("Ignoring invalid experiment stats record", "key", key, "error", err)
+				continue
+			}
+			stats := &report.Variants[j]
+			stats.Views[i] += record.Views
+			stats.Logins[i] += record.Logins
+			stats.TotalViews += record.Views
+			stats.TotalLogins += record.Logins
+		}
+	}
+
+	for i := range report.Variants {
+		if stats := &report.Variants[i]; stats.TotalViews > 0 {
+			stats.ConversionRate = float64(stats.TotalLogins) / float64(stats.TotalViews)
+		}
+	}
+	return report, nil
+}
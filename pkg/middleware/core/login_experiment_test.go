@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// newExperimentTestMiddleware creates a middleware with the admin API and a login experiment of two variants
+func newExperimentTestMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	mw := newAdminTestMiddleware(t)
+	mw.config.LoginExperiment = config.LoginExperimentConfig{
+		Name: "signin-copy",
+		Variants: []config.LoginVariantConfig{
+			{Name: "control", Percent: 50},
+			{Name: "github-first", Percent: 50, Title: "Welcome back", ProviderOrder: []string{"github"}, ButtonStyle: config.ButtonStylePrimary},
+		},
+	}
+	return mw
+}
+
+func experimentLoginRequest(cookie string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: experimentCookieName, Value: cookie})
+	}
+	return req
+}
+
+func TestLoginExperiment_Assignment(t *testing.T) {
+	mw := newExperimentTestMiddleware(t)
+
+	// New visitors are assigned to both variants
+	seen := make(map[string]bool)
+	for i := 0; i < 200 && len(seen) < 2; i++ {
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, experimentLoginRequest(""))
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == experimentCookieName {
+				seen[c.Value] = true
+			}
+		}
+	}
+	if !seen["signin-copy:control"] || !seen["signin-copy:github-first"] {
+		t.Fatalf("Assigned variants = %v, want both", seen)
+	}
+
+	// Visitors keep their variant, and see its page
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, experimentLoginRequest("signin-copy:github-first"))
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Cookies = %v, want none for an assigned visitor", cookies)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<title>Welcome back") {
+		t.Error("Variant page should have the variant title")
+	}
+	if !strings.Contains(body, "btn btn-primary provider-btn") {
+		t.Error("Variant page should have the variant button style")
+	}
+	if i, j := strings.Index(body, "/oauth2/start/github"), strings.Index(body, "/oauth2/start/google"); i < 0 || j < 0 || i > j {
+		t.Error("Variant page should list github first")
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, experimentLoginRequest("signin-copy:control"))
+	body = rec.Body.String()
+	if strings.Contains(body, "Welcome back") || !strings.Contains(body, "btn btn-secondary provider-btn") {
+		t.Error("Control page should be the regular page")
+	}
+	if i, j := strings.Index(body, "/oauth2/start/github"), strings.Index(body, "/oauth2/start/google"); i < j {
+		t.Error("Control page should list google first")
+	}
+
+	// Cookies of another experiment are reassigned
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, experimentLoginRequest("old-test:control"))
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != experimentCookieName {
+		t.Errorf("Cookies = %v, want a new assignment", cookies)
+	}
+}
+
+func TestLoginExperiment_Stats(t *testing.T) {
+	mw := newExperimentTestMiddleware(t)
+
+	for i := 0; i < 4; i++ {
+		mw.ServeHTTP(httptest.NewRecorder(), experimentLoginRequest("signin-copy:github-first"))
+	}
+	mw.ServeHTTP(httptest.NewRecorder(), experimentLoginRequest("signin-copy:control"))
+	mw.recordExperimentLogin(experimentLoginRequest("signin-copy:github-first"))
+	mw.recordExperimentLogin(experimentLoginRequest("")) // Not in the experiment
+
+	// Views are aggregated in memory until flushed, which LoginStats does first
+	if keys, _ := mw.sessionStore.List(context.Background(), experimentStatsKeyPrefix); len(keys) != 0 {
+		t.Errorf("keys = %v, want no record before the flush", keys)
+	}
+
+	report, err := mw.LoginStats(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("LoginStats() error = %v", err)
+	}
+	if report.Experiment == nil || report.Experiment.Name != "signin-copy" || len(report.Experiment.Variants) != 2 {
+		t.Fatalf("Experiment = %+v, want both variants of signin-copy", report.Experiment)
+	}
+	control, variant := report.Experiment.Variants[0], report.Experiment.Variants[1]
+	if control.TotalViews != 1 || control.TotalLogins != 0 || control.ConversionRate != 0 {
+		t.Errorf("control = %+v, want 1 view without login", control)
+	}
+	if variant.TotalViews != 4 || variant.TotalLogins != 1 || variant.ConversionRate != 0.25 || variant.Views[6] != 4 {
+		t.Errorf("github-first = %+v, want 4 views and 1 login today", variant)
+	}
+
+	// The records are not sessions
+	if isSessionKey(experimentStatsKeyPrefix + "2026-03-10:signin-copy:control:instance") {
+		t.Error("Experiment records should not be session keys")
+	}
+}
@@ -0,0 +1,340 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// loginStatsKeyPrefix is the prefix of the daily login stats records in the session KVS
+// Records are keyed login-stats:<day>:<provider>:<instance>, so that each instance only
+// writes its own records and no update is lost between instances.
+const loginStatsKeyPrefix = "login-stats:"
+
+// loginStatsRetention is how long the daily login stats are kept
+const loginStatsRetention = 90 * 24 * time.Hour
+
+// loginStatsFlushInterval is the time between two writes of the login and experiment stats of an instance
+// to the session KVS
+const loginStatsFlushInterval = 10 * time.Second
+
+// Days of login stats returned by the admin API by default and at most
+const (
+	defaultLoginStatsDays = 30
+	maxLoginStatsDays     = 90 // loginStatsRetention
+)
+
+// loginStatsDayLayout formats the days of the login stats (UTC)
+const loginStatsDayLayout = "2006-01-02"
+
+// Failure reasons of the login stats
+const (
+	loginFailureStateMismatch   = "state_mismatch"    // OAuth2 state did not match the cookie
+	loginFailureMissingCode     = "missing_code"      // OAuth2 callback without authorization code
+	loginFailureExchange        = "exchange_failed"   // OAuth2 token exchange failed
+	loginFailureMembership      = "membership"        // Required organization or team missing
+	loginFailureEmailFetch      = "email_unavailable" // Email required but not provided by the provider
+	loginFailureEmailUnverified = "email_unverified"  // Email not verified by the provider
+	loginFailureNotAuthorized   = "not_authorized"    // Email not in the allowlist
+	loginFailureRateLimited     = "rate_limited"      // Too many login emails
+	loginFailureSendFailed      = "send_failed"       // Login email could not be sent
+	loginFailureInvalidToken    = "invalid_token"     // Login link invalid or expired
+	loginFailureInvalidOTP      = "invalid_otp"       // OTP invalid or expired
+	loginFailureInvalidPassword = "invalid_password"  // Wrong password
+	loginFailureInvalidRequest  = "invalid_request"   // Malformed login request
+	loginFailureSession         = "session_error"     // Session could not be created
+)
+
+// loginDay is the login stats record of one provider on one day, as written by one instance
+type loginDay struct {
+	Logins        int            `json:"logins"`
+	Failures      map[string]int `json:"failures,omitempty"`    // By failure reason
+	UserSketch    userSketch     `json:"user_sketch,omitempty"` // Distinct users who logged in
+	Users         []string       `json:"users,omitempty"`       // Hashed emails of the users, in records of older versions
+	LatencyMicros int64          `json:"latency_us"`            // Sum of the latencies of the logins
+}
+
+// loginStats aggregates the logins of this instance in memory, flushed to the session KVS by a local job
+type loginStats struct {
+	mu    sync.Mutex
+	days  map[string]*loginDay // By "<day>:<provider>": today's, and older ones until flushed
+	dirty map[string]bool      // Records changed since the last flush
+
+	flushMu sync.Mutex // Serializes the flushes, so an older snapshot never overwrites a newer one
+}
+
+// LoginStatsSeries is the login stats of one provider, as series aligned with LoginStatsReport.Days
+type LoginStatsSeries struct {
+	Provider       string           `json:"provider"`
+	Logins         []int            `json:"logins"`
+	UniqueUsers    []int            `json:"unique_users"` // Estimated within about 2%
+	Failures       []int            `json:"failures"`
+	FailureReasons map[string][]int `json:"failure_reasons"`
+	AvgLatencyMS   []float64        `json:"avg_latency_ms"` // 0 on days without logins
+	Total          LoginStatsTotal  `json:"total"`
+}
+
+// LoginStatsTotal is the login stats of one provider over the whole period
+type LoginStatsTotal struct {
+	Logins         int            `json:"logins"`
+	UniqueUsers    int            `json:"unique_users"` // Distinct over the period, not the sum of the days (estimated)
+	Failures       int            `json:"failures"`
+	FailureReasons map[string]int `json:"failure_reasons"`
+	AvgLatencyMS   float64        `json:"avg_latency_ms"`
+}
+
+// LoginStatsReport is the daily login stats of all providers, for charts
+type LoginStatsReport struct {
+	Days       []string           `json:"days"` // Oldest first, UTC
+	Providers  []LoginStatsSeries `json:"providers"`
+	Experiment *ExperimentReport  `json:"experiment,omitempty"` // Views and logins of the login experiment variants (see login_experiment.go)
+}
+
+// recordsLoginStats reports whether login stats are kept: they are only read via the admin API
+func (m *Middleware) recordsLoginStats() bool {
+	return m.config.Server.AdminToken != ""
+}
+
+// recordLogin records a successful login of email with provider, which took the time since started
+// With privacy.minimize, users are counted by the salted hash of their email.
+func (m *Middleware) recordLogin(provider, email string, started time.Time) {
+	if !m.recordsLoginStats() {
+		return
+	}
+	latency := time.Since(started)
+	m.updateLoginDay(provider, func(day *loginDay) {
+		day.Logins++
+		day.LatencyMicros += latency.Microseconds()
+		if email != "" {
+			if day.UserSketch == nil {
+				day.UserSketch = newUserSketch()
+			}
+			day.UserSketch.add(loginUserID(m.sessionEmail(email)))
+		}
+	})
+}
+
+// recordLoginFailure records a failed login with provider for reason
+func (m *Middleware) recordLoginFailure(provider, reason string) {
+	if !m.recordsLoginStats() || provider == "" {
+		return
+	}
+	m.updateLoginDay(provider, func(day *loginDay) {
+		if day.Failures == nil {
+			day.Failures = make(map[string]int)
+		}
+		day.Failures[reason]++
+	})
+}
+
+// updateLoginDay applies update to today's record of provider, which the next flush writes to the session KVS
+func (m *Middleware) updateLoginDay(provider string, update func(day *loginDay)) {
+	key := m.clock.Now().UTC().Format(loginStatsDayLayout) + ":" + provider
+
+	m.loginStats.mu.Lock()
+	defer m.loginStats.mu.Unlock()
+
+	if m.loginStats.days == nil {
+		m.loginStats.days = make(map[string]*loginDay)
+		m.loginStats.dirty = make(map[string]bool)
+	}
+	day, ok := m.loginStats.days[key]
+	if !ok {
+		day = &loginDay{}
+		m.loginStats.days[key] = day
+	}
+	update(day)
+	m.loginStats.dirty[key] = true
+}
+
+// flushLoginStats writes the records of this instance changed since the last flush to the session KVS
+// Records are keyed by instance, so each instance overwrites its own records only.
+func (m *Middleware) flushLoginStats(ctx context.Context) error {
+	m.loginStats.flushMu.Lock()
+	defer m.loginStats.flushMu.Unlock()
+
+	today := m.clock.Now().UTC().Format(loginStatsDayLayout)
+	m.loginStats.mu.Lock()
+	snapshots := make(map[string][]byte, len(m.loginStats.dirty))
+	for key, day := range m.loginStats.days {
+		if !m.loginStats.dirty[key] {
+			// Only today's records still change: forget the others once flushed
+			if !strings.HasPrefix(key, today+":") {
+				delete(m.loginStats.days, key)
+			}
+			continue
+		}
+		data, err := json.Marshal(day)
+		if err != nil {
+			m.logger.Warn("Failed to encode login stats", "error", err)
+			continue
+		}
+		snapshots[key] = data
+		delete(m.loginStats.dirty, key)
+	}
+	m.loginStats.mu.Unlock()
+
+	var lastErr error
+	for key, data := range snapshots {
+		if err := m.sessionStore.Set(ctx, loginStatsKeyPrefix+key+":"+m.jobs.ID(), data, loginStatsRetention); err != nil {
+			lastErr = err
+			// Written again by the next flush
+			m.loginStats.mu.Lock()
+			m.loginStats.dirty[key] = true
+			m.loginStats.mu.Unlock()
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to store login stats: %w", lastErr)
+	}
+	return nil
+}
+
+// flushStats writes the login and experiment stats of this instance to the session KVS
+func (m *Middleware) flushStats(ctx context.Context) error {
+	loginErr := m.flushLoginStats(ctx)
+	experimentErr := m.flushExperimentStats(ctx)
+	return errors.Join(loginErr, experimentErr)
+}
+
+// loginUserID returns the ID of a user added to the sketches of the login stats
+func loginUserID(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoginStats returns the daily login stats of the last days (today included) of all instances
+// sharing the session KVS
+func (m *Middleware) LoginStats(ctx context.Context, days int) (*LoginStatsReport, error) {
+	today := m.clock.Now().UTC()
+	report := &LoginStatsReport{Days: make([]string, days), Providers: []LoginStatsSeries{}}
+	dayIndex := make(map[string]int, days)
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, i-days+1).Format(loginStatsDayLayout)
+		report.Days[i] = day
+		dayIndex[day] = i
+	}
+
+	// This instance's latest logins and views are not flushed yet
+	if err := m.flushStats(ctx); err != nil {
+		m.logger.Warn("Login stats of this instance may be outdated", "error", err)
+	}
+
+	// Read past the cache, which does not know the records of the other instances
+	store := kvs.Uncached(m.sessionStore)
+	keys, err := store.List(ctx, loginStatsKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	type providerStats struct {
+		series       *LoginStatsSeries
+		dayUsers     []userSketch
+		users        userSketch
+		latency      []int64
+		latencyTotal int64
+	}
+	byProvider := make(map[string]*providerStats)
+
+	for _, key := range keys {
+		// <day>:<provider>:<instance>; provider IDs may contain ":"
+		rest := strings.TrimPrefix(key, loginStatsKeyPrefix)
+		day, rest, ok := strings.Cut(rest, ":")
+		last := strings.LastIndex(rest, ":")
+		if !ok || last <= 0 {
+			continue
+		}
+		i, ok := dayIndex[day]
+		if !ok {
+			continue
+		}
+		provider := rest[:last]
+
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			continue // Expired since listed
+		}
+		var record loginDay
+		if err := json.Unmarshal(data, &record); err != nil {
+			m.logger.Warn("Ignoring invalid login stats record", "key", key, "error", err)
+			continue
+		}
+
+		stats, ok := byProvider[provider]
+		if !ok {
+			stats = &providerStats{
+				series: &LoginStatsSeries{
+					Provider:       provider,
+					Logins:         make([]int, days),
+					UniqueUsers:    make([]int, days),
+					Failures:       make([]int, days),
+					FailureReasons: make(map[string][]int),
+					AvgLatencyMS:   make([]float64, days),
+					Total:          LoginStatsTotal{FailureReasons: make(map[string]int)},
+				},
+				dayUsers: make([]userSketch, days),
+				users:    newUserSketch(),
+				latency:  make([]int64, days),
+			}
+			byProvider[provider] = stats
+		}
+
+		series := stats.series
+		series.Logins[i] += record.Logins
+		series.Total.Logins += record.Logins
+		stats.latency[i] += record.LatencyMicros
+		stats.latencyTotal += record.LatencyMicros
+		for reason, count := range record.Failures {
+			if series.FailureReasons[reason] == nil {
+				series.FailureReasons[reason] = make([]int, days)
+			}
+			series.FailureReasons[reason][i] += count
+			series.Failures[i] += count
+			series.Total.FailureReasons[reason] += count
+			series.Total.Failures += count
+		}
+		if stats.dayUsers[i] == nil {
+			stats.dayUsers[i] = newUserSketch()
+		}
+		stats.dayUsers[i].merge(record.UserSketch)
+		for _, user := range record.Users {
+			stats.dayUsers[i].add(user)
+		}
+	}
+
+	for _, stats := range byProvider {
+		series := stats.series
+		for i := range report.Days {
+			series.UniqueUsers[i] = stats.dayUsers[i].count()
+			stats.users.merge(stats.dayUsers[i])
+			if series.Logins[i] > 0 {
+				series.AvgLatencyMS[i] = averageMillis(stats.latency[i], series.Logins[i])
+			}
+		}
+		series.Total.UniqueUsers = stats.users.count()
+		if series.Total.Logins > 0 {
+			series.Total.AvgLatencyMS = averageMillis(stats.latencyTotal, series.Total.Logins)
+		}
+		report.Providers = append(report.Providers, *series)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool { return report.Providers[i].Provider < report.Providers[j].Provider })
+
+	if report.Experiment, err = m.experimentReport(ctx, report.Days); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// averageMillis returns the average of a sum of microseconds over count, in milliseconds
+func averageMillis(sumMicros int64, count int) float64 {
+	return float64(sumMicros/int64(count)) / 1000
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// userSketchPrecision is the number of hash bits selecting a register of a userSketch
+// 2^12 registers estimate within about 2% and take 4 KiB per record.
+const userSketchPrecision = 12
+
+// userSketchRegisters is the size of a userSketch
+const userSketchRegisters = 1 << userSketchPrecision
+
+// userSketch estimates the number of distinct users of the login stats (HyperLogLog)
+// It keeps no user ID, and the sketches of several days or instances merge into the sketch of their union.
+type userSketch []byte
+
+// newUserSketch returns an empty sketch
+func newUserSketch() userSketch {
+	return make(userSketch, userSketchRegisters)
+}
+
+// add adds a user to the sketch
+func (s userSketch) add(user string) {
+	sum := sha256.Sum256([]byte(user))
+	hash := binary.BigEndian.Uint64(sum[:8])
+	register := hash >> (64 - userSketchPrecision)
+	// Position of the first 1 bit of the rest of the hash, bounded when the rest is all zeros
+	rank := byte(bits.LeadingZeros64(hash<<userSketchPrecision|1<<(userSketchPrecision-1))) + 1
+	if rank > s[register] {
+		s[register] = rank
+	}
+}
+
+// merge adds the users of other to the sketch; sketches of another size are ignored
+func (s userSketch) merge(other userSketch) {
+	if len(other) != len(s) {
+		return
+	}
+	for i, rank := range other {
+		if rank > s[i] {
+			s[i] = rank
+		}
+	}
+}
+
+// count returns the estimated number of distinct users; 0 on nil
+func (s userSketch) count() int {
+	if len(s) == 0 {
+		return 0
+	}
+	m := float64(len(s))
+	sum, zeros := 0.0, 0
+	for _, rank := range s {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Linear counting is more accurate for few users
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
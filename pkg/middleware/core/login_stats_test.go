@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+func TestLoginStats(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	fake := clock.NewFake(time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC))
+	mw.SetClock(fake)
+
+	started := time.Now().Add(-40 * time.Millisecond)
+	mw.recordLogin("google", "alice@example.com", started)
+	mw.recordLoginFailure("google", loginFailureNotAuthorized)
+
+	// The next day in UTC
+	fake.Advance(2 * time.Hour)
+	mw.recordLogin("google", "alice@example.com", started)
+	mw.recordLogin("google", "Bob@Example.com", started)
+	mw.recordLogin("google", "bob@example.com", started)
+	mw.recordLoginFailure("github", loginFailureExchange)
+
+	// Records of another instance sharing the session KVS add up, including those of older versions listing users
+	record, _ := json.Marshal(loginDay{Logins: 1, Users: []string{loginUserID("carol@example.com")}, LatencyMicros: 10000})
+	if err := mw.sessionStore.Set(context.Background(), loginStatsKeyPrefix+"2026-03-11:google:other", record, time.Hour); err != nil {
+		t.Fatalf("Failed to store record: %v", err)
+	}
+
+	report, err := mw.LoginStats(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("LoginStats() error = %v", err)
+	}
+	wantDays := []string{"2026-03-09", "2026-03-10", "2026-03-11"}
+	if len(report.Days) != 3 || report.Days[0] != wantDays[0] || report.Days[2] != wantDays[2] {
+		t.Fatalf("Days = %v, want %v", report.Days, wantDays)
+	}
+	if len(report.Providers) != 2 || report.Providers[0].Provider != "github" || report.Providers[1].Provider != "google" {
+		t.Fatalf("Providers = %+v, want github and google", report.Providers)
+	}
+
+	github := report.Providers[0]
+	if github.Failures[2] != 1 || github.FailureReasons[loginFailureExchange][2] != 1 || github.Total.Logins != 0 {
+		t.Errorf("github = %+v, want one exchange failure on the last day", github)
+	}
+
+	google := report.Providers[1]
+	if got, want := google.Logins, []int{0, 1, 4}; !slices.Equal(got, want) {
+		t.Errorf("google logins = %v, want %v", got, want)
+	}
+	if got, want := google.UniqueUsers, []int{0, 1, 3}; !slices.Equal(got, want) {
+		t.Errorf("google unique users = %v, want %v", got, want)
+	}
+	if google.FailureReasons[loginFailureNotAuthorized][1] != 1 || google.Failures[1] != 1 {
+		t.Errorf("google failures = %v %v, want one not_authorized failure on the second day", google.Failures, google.FailureReasons)
+	}
+	if google.AvgLatencyMS[0] != 0 || google.AvgLatencyMS[1] < 40 {
+		t.Errorf("google latency = %v, want 0 without logins and at least 40ms otherwise", google.AvgLatencyMS)
+	}
+	if google.Total.Logins != 5 || google.Total.UniqueUsers != 3 || google.Total.Failures != 1 {
+		t.Errorf("google total = %+v, want 5 logins by 3 users and 1 failure", google.Total)
+	}
+}
+
+func TestLoginStats_Flush(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	mw.recordLogin("google", "alice@example.com", time.Now())
+	mw.recordLoginFailure("google", loginFailureExchange)
+
+	// Logins are aggregated in memory until flushed
+	ctx := context.Background()
+	keys, err := mw.sessionStore.List(ctx, loginStatsKeyPrefix)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("List() = %v, %v, want no record before the flush", keys, err)
+	}
+	if err := mw.flushLoginStats(ctx); err != nil {
+		t.Fatalf("flushLoginStats() error = %v", err)
+	}
+	keys, _ = mw.sessionStore.List(ctx, loginStatsKeyPrefix)
+	if len(keys) != 1 {
+		t.Fatalf("keys = %v, want today's record of google", keys)
+	}
+
+	// The record keeps no user ID
+	data, _ := mw.sessionStore.Get(ctx, keys[0])
+	var record loginDay
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("Invalid record: %v", err)
+	}
+	if record.Logins != 1 || record.Failures[loginFailureExchange] != 1 || record.Users != nil || record.UserSketch.count() != 1 {
+		t.Errorf("record = %+v, want one login and failure with a sketch of one user", record)
+	}
+}
+
+func TestUserSketch(t *testing.T) {
+	odd, even := newUserSketch(), newUserSketch()
+	for i := 0; i < 10000; i++ {
+		user := loginUserID(fmt.Sprintf("user%d@example.com", i))
+		if i%2 == 0 {
+			even.add(user)
+		} else {
+			odd.add(user)
+		}
+		even.add(loginUserID("alice@example.com"))
+	}
+
+	all := newUserSketch()
+	all.merge(odd)
+	all.merge(even)
+	for _, tt := range []struct {
+		sketch userSketch
+		want   int
+	}{{odd, 5000}, {even, 5001}, {all, 10001}} {
+		if got := tt.sketch.count(); math.Abs(float64(got-tt.want)) > 0.05*float64(tt.want) {
+			t.Errorf("count() = %d, want about %d", got, tt.want)
+		}
+	}
+	if got := userSketch(nil).count(); got != 0 {
+		t.Errorf("count() of nil = %d, want 0", got)
+	}
+}
+
+func TestLoginStats_DisabledWithoutAdminAPI(t *testing.T) {
+	mw, store := newTestMiddleware(t, newTestConfig())
+	mw.recordLogin("google", "alice@example.com", time.Now())
+	mw.recordLoginFailure("google", loginFailureStateMismatch)
+
+	keys, err := store.List(context.Background(), loginStatsKeyPrefix)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Login stats recorded without the admin API: %v", keys)
+	}
+}
+
+func TestLoginStats_OAuth2Callback(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?state=wrong&code=code", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "state"})
+	req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+	req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+	mw.ServeHTTP(httptest.NewRecorder(), req)
+
+	report, err := mw.LoginStats(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("LoginStats() error = %v", err)
+	}
+	if len(report.Providers) != 1 || report.Providers[0].Total.FailureReasons[loginFailureStateMismatch] != 1 {
+		t.Errorf("Report = %+v, want one state_mismatch failure of google", report.Providers)
+	}
+}
+
+func TestAdmin_LoginStats(t *testing.T) {
+	mw := newAdminTestMiddleware(t)
+	mw.recordLogin("google", "alice@example.com", time.Now())
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, adminRequest(http.MethodGet, "/_auth/admin/login-stats?days=7", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var report LoginStatsReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(report.Days) != 7 || len(report.Providers) != 1 || report.Providers[0].Logins[6] != 1 {
+		t.Errorf("Report = %+v, want 7 days with today's login of google", report)
+	}
+
+	for _, path := range []string{"/_auth/admin/login-stats?days=0", "/_auth/admin/login-stats?days=91", "/_auth/admin/login-stats?days=x"} {
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, adminRequest(http.MethodGet, path, testAdminToken))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want %d", path, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// maxMetadataKeyLength is the maximum length of a metadata key
+const maxMetadataKeyLength = 64
+
+// metadataEntry is the JSON representation of a single metadata key
+type metadataEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// handleMetadata handles the session metadata API (/_auth/api/metadata[/{key}])
+// Authenticated by the session cookie, so upstream apps call it from the browser or forward the cookie.
+// Values are stored in the session and expire with it. Users can write them too,
+// so they are preferences, not a source of truth for authorization.
+//
+// Endpoints:
+//   - GET    /_auth/api/metadata        All metadata as a JSON object
+//   - GET    /_auth/api/metadata/{key}  A single entry ({"key": ..., "value": ...})
+//   - PUT    /_auth/api/metadata/{key}  Set an entry from a JSON body ({"value": ...})
+//   - DELETE /_auth/api/metadata/{key}  Remove an entry
+func (m *Middleware) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	m.setCORSHeaders(w, r)
+
+	// Responses depend on the session cookie and must never be cached
+	w.Header().Set("Cache-Control", "no-store")
+
+	metadataCfg := m.config.Session.Metadata
+	if !metadataCfg.Enabled {
+		writeAPIError(w, http.StatusNotFound, "Not Found", "Metadata API is not enabled")
+		return
+	}
+
+	prefix := m.config.Server.GetAuthPathPrefix()
+	key := extractPathParam(r.URL.Path, joinAuthPath(prefix, "/api/metadata/"))
+
+	allow := "GET, OPTIONS"
+	if key != "" {
+		allow = "GET, PUT, DELETE, OPTIONS"
+	}
+	if r.Method == http.MethodOptions {
+		// CORS preflight
+		w.Header().Set("Access-Control-Allow-Methods", allow)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if key != "" && !validMetadataKey(key) {
+		writeAPIError(w, http.StatusBadRequest, "Bad Request", "Keys must be 1-64 letters, digits, '.', '-' or '_'")
+		return
+	}
+
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, "Unauthorized", "Authentication required")
+		return
+	}
+
+	// Serialize so concurrent writes to the same session do not drop each other's keys
+	m.sessionWriteMu.Lock()
+	defer m.sessionWriteMu.Unlock()
+
+	sess, ok := m.lookupSession(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "Unauthorized", "Authentication required")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		metadata := sess.Metadata
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		writeAPIJSON(w, http.StatusOK, metadata)
+
+	case r.Method == http.MethodGet:
+		value, ok := sess.Metadata[key]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Not Found", "Unknown metadata key: "+key)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, metadataEntry{Key: key, Value: value})
+
+	case r.Method == http.MethodPut && key != "":
+		// Requiring JSON forces a CORS preflight, so other sites cannot write with a simple form post
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			writeAPIError(w, http.StatusUnsupportedMediaType, "Unsupported Media Type", "Content-Type must be application/json")
+			return
+		}
+
+		var body struct {
+			Value *string `json:"value"`
+		}
+		maxBody := int64(metadataCfg.GetMaxValueSize()) * 2 // Room for JSON escaping
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil || int64(len(data)) > maxBody {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "Payload Too Large", "Value is too large")
+			return
+		}
+		if err := json.Unmarshal(data, &body); err != nil || body.Value == nil {
+			writeAPIError(w, http.StatusBadRequest, "Bad Request", `Body must be a JSON object with a string "value"`)
+			return
+		}
+		if len(*body.Value) > metadataCfg.GetMaxValueSize() {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "Payload Too Large", "Value is too large")
+			return
+		}
+		if _, exists := sess.Metadata[key]; !exists && len(sess.Metadata) >= metadataCfg.GetMaxKeys() {
+			writeAPIError(w, http.StatusConflict, "Conflict", "Too many metadata keys")
+			return
+		}
+
+		if sess.Metadata == nil {
+			sess.Metadata = make(map[string]string)
+		}
+		sess.Metadata[key] = *body.Value
+		if err := m.saveMetadata(cookie.Value, sess); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to save metadata")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, metadataEntry{Key: key, Value: *body.Value})
+
+	case r.Method == http.MethodDelete && key != "":
+		if _, exists := sess.Metadata[key]; exists {
+			delete(sess.Metadata, key)
+			if err := m.saveMetadata(cookie.Value, sess); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to save metadata")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", allow)
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only "+allow+" are accepted")
+	}
+}
+
+// saveMetadata stores a session whose metadata changed, keeping its expiration
+func (m *Middleware) saveMetadata(sessionID string, sess *session.Session) error {
+	if err := session.SetAt(m.sessionStore, sessionID, sess, m.clock.Now()); err != nil {
+		m.logger.Error("Failed to save session metadata", "error", err)
+		return err
+	}
+	return nil
+}
+
+// validMetadataKey reports whether key is a non-empty token of letters, digits, '.', '-' and '_'
+func validMetadataKey(key string) bool {
+	if len(key) == 0 || len(key) > maxMetadataKeyLength {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
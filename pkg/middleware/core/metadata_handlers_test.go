@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+func TestHandleMetadata(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Session.Metadata = config.MetadataConfig{Enabled: true, MaxKeys: 2, MaxValueSize: 16}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	do := func(method, path, body string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if authenticated {
+			req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		}
+		rec := httptest.NewRecorder()
+		mw.handleMetadata(rec, req)
+		return rec
+	}
+
+	t.Run("empty list", func(t *testing.T) {
+		rec := do(http.MethodGet, "/_auth/api/metadata", "", true)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != "{}" {
+			t.Errorf("body = %s, want {}", got)
+		}
+		if rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", rec.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("put and get", func(t *testing.T) {
+		rec := do(http.MethodPut, "/_auth/api/metadata/assistant", `{"value":"support-bot"}`, true)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		rec = do(http.MethodGet, "/_auth/api/metadata/assistant", "", true)
+		var entry metadataEntry
+		if err := json.Unmarshal(rec.Body.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if entry.Key != "assistant" || entry.Value != "support-bot" {
+			t.Errorf("entry = %+v, want assistant=support-bot", entry)
+		}
+
+		// Stored in the session in KVS
+		sess, err := session.Get(store, sessionID)
+		if err != nil {
+			t.Fatalf("session.Get() error = %v", err)
+		}
+		if sess.Metadata["assistant"] != "support-bot" {
+			t.Errorf("session metadata = %v, want assistant=support-bot", sess.Metadata)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		rec := do(http.MethodGet, "/_auth/api/metadata/missing", "", true)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		rec := do(http.MethodPut, "/_auth/api/metadata/plan", `{"value":"this value is too long"}`, true)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("too large status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+		}
+
+		if rec := do(http.MethodPut, "/_auth/api/metadata/plan", `{"value":"pro"}`, true); rec.Code != http.StatusOK {
+			t.Fatalf("PUT status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		rec = do(http.MethodPut, "/_auth/api/metadata/theme", `{"value":"dark"}`, true)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("too many keys status = %d, want %d", rec.Code, http.StatusConflict)
+		}
+
+		// Overwriting an existing key is allowed at the limit
+		if rec := do(http.MethodPut, "/_auth/api/metadata/plan", `{"value":"team"}`, true); rec.Code != http.StatusOK {
+			t.Errorf("overwrite status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rec := do(http.MethodDelete, "/_auth/api/metadata/plan", "", true)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusNoContent)
+		}
+		rec = do(http.MethodGet, "/_auth/api/metadata", "", true)
+		if got := strings.TrimSpace(rec.Body.String()); got != `{"assistant":"support-bot"}` {
+			t.Errorf("body = %s, want only assistant", got)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			body   string
+			want   int
+		}{
+			{"invalid key", http.MethodPut, "/_auth/api/metadata/a$b", `{"value":"x"}`, http.StatusBadRequest},
+			{"non-string value", http.MethodPut, "/_auth/api/metadata/plan", `{"value":1}`, http.StatusBadRequest},
+			{"missing value", http.MethodPut, "/_auth/api/metadata/plan", `{}`, http.StatusBadRequest},
+			{"put on collection", http.MethodPut, "/_auth/api/metadata", `{"value":"x"}`, http.StatusMethodNotAllowed},
+			{"post", http.MethodPost, "/_auth/api/metadata/plan", `{"value":"x"}`, http.StatusMethodNotAllowed},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if rec := do(tt.method, tt.path, tt.body, true); rec.Code != tt.want {
+					t.Errorf("Status = %d, want %d", rec.Code, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("form posts are rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/_auth/api/metadata/plan", strings.NewReader(`{"value":"x"}`))
+		req.Header.Set("Content-Type", "text/plain")
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		mw.handleMetadata(rec, req)
+
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		rec := do(http.MethodGet, "/_auth/api/metadata", "", false)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestHandleMetadata_Disabled(t *testing.T) {
+	mw, store := newTestMiddleware(t, newTestConfig())
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/api/metadata", nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
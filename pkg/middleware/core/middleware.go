@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -10,10 +14,16 @@ import (
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/password"
 	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/dify"
 	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+	"github.com/ideamans/chatbotgate/pkg/middleware/ratelimit"
 	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
 	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/jobs"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 	"github.com/ideamans/chatbotgate/pkg/shared/logging"
 )
@@ -41,16 +51,93 @@ type Middleware struct {
 	authzChecker    authz.Checker
 	forwarder       forwarding.Forwarder // Interface type
 	rulesEvaluator  *rules.Evaluator     // Rules-based access control
+	difyInjector    *dify.Injector       // Dify integration, nil when disabled
+	idp             *idp.Provider        // OpenID Connect provider of the IdP mode, nil when disabled
 	translator      *i18n.Translator
 	logger          logging.Logger
 	templates       *Templates   // HTML templates
+	favicon         *favicon     // Favicon file of service.favicon, nil when not configured
 	next            http.Handler // The next handler to call after auth succeeds
+	clock           clock.Clock  // Time of session creation and expiry checks
 
 	// Health check state management
-	healthStatus  atomic.Value // stores HealthStatus
-	healthLive    atomic.Bool  // true when process started
-	healthReady   atomic.Bool  // true when fully ready
-	healthStarted time.Time    // when the middleware was created
+	healthStatus   atomic.Value           // stores HealthStatus
+	healthLive     atomic.Bool            // true when process started
+	healthReady    atomic.Bool            // true when fully ready
+	healthStarted  time.Time              // when the middleware was created
+	healthChecks   map[string]HealthCheck // Dependency probes by name, run when enabled in health.checks
+	healthChecksMu sync.RWMutex
+	healthResults  healthResults // Results of the last probe round, shared by readiness requests
+
+	// Authentication methods disabled at runtime via the admin API (reset on config reload)
+	disabledAuthMethods   map[string]bool
+	disabledAuthMethodsMu sync.RWMutex
+
+	// Announcement banner replaced at runtime via the admin API (nil: the configuration, reset on config reload)
+	announcement   *config.AnnouncementConfig
+	announcementMu sync.RWMutex
+
+	// Configuration-only page fragments and rendered login pages
+	fragmentsOnce sync.Once
+	fragments     *pageFragments
+	loginPages    loginPageCache
+
+	// Results of the last OAuth2 provider self-test (startup or admin API)
+	providerChecks   []oauth2.ProviderCheck
+	providerChecksMu sync.RWMutex
+
+	// Serializes read-modify-write of stored sessions (metadata, guest quota)
+	sessionWriteMu sync.Mutex
+
+	// Serializes the provider token refreshes of each session (see refreshProviderToken)
+	providerTokenLocks   map[string]*refreshLock // By session ID, while refreshes are waiting or running
+	providerTokenLocksMu sync.Mutex
+
+	// Event bus propagating admin actions to the instances sharing the session KVS (nil without Redis)
+	events       kvs.Broadcaster
+	eventsOrigin string       // ID of this instance in the events it publishes
+	stopEvents   func() error // Unsubscribes from the event bus, nil when not subscribed
+	stopEventsMu sync.Mutex
+
+	// Sessions revoked via the admin API: sessions of the email created until the time are rejected
+	revokedSessions   map[string]time.Time
+	revokedSessionsMu sync.RWMutex
+
+	// Periodic jobs, run by one of the instances sharing the session KVS (see jobs.go)
+	jobs *jobs.Runner
+
+	// Runs of the session garbage collection job on this instance
+	sessionGC   SessionGCStats
+	sessionGCMu sync.Mutex
+
+	// Audit log of the identity forwarded with each request (forwarding.audit), or nil
+	forwardingAudit io.Writer
+
+	// Headers set by the middleware on upstream requests, which the proxy's request header filter keeps:
+	// identityHeaders for signed-in users and service callers, anonymousHeaders for the other requests
+	identityHeaders  *proxy.IdentityHeaders
+	anonymousHeaders *proxy.IdentityHeaders
+
+	// Responses cut by stream_limits on this instance (see stream_limits.go)
+	streamLimits streamLimitCounters
+
+	// Today's login stats of this instance, read via the admin API (see login_stats.go)
+	loginStats      loginStats
+	experimentStats experimentStats
+
+	// Hooks of library users around the upstream request (see proxy_hooks.go)
+	proxyRequestHooks  []ProxyRequestHook
+	proxyResponseHooks []ProxyResponseHook
+	proxyHooksMu       sync.RWMutex
+
+	// External process plugins (config plugins), started on first use
+	plugins []*pluginFilter
+
+	// Compiled paths and methods of the service tokens, by name
+	serviceScopes map[string]*config.ServiceTokenScope
+
+	// Guest sessions started per client IP (guest.start_limit_per_minute)
+	guestStarts *ratelimit.Limiter
 }
 
 // New creates a new authentication middleware
@@ -72,6 +159,11 @@ func New(
 		return nil, err
 	}
 
+	icon, err := loadFavicon(cfg.Service)
+	if err != nil {
+		return nil, err
+	}
+
 	m := &Middleware{
 		config:          cfg,
 		sessionStore:    sessionStore,
@@ -81,23 +173,69 @@ func New(
 		authzChecker:    authzChecker,
 		forwarder:       forwarder,
 		rulesEvaluator:  rulesEvaluator,
+		difyInjector:    dify.NewInjector(cfg.Dify),
 		translator:      translator,
 		logger:          logger,
 		templates:       templates,
+		favicon:         icon,
 		healthStarted:   time.Now().UTC(),
+		clock:           clock.Real,
+
+		disabledAuthMethods: make(map[string]bool),
+		jobs:                jobs.NewRunner(sessionStore, logger),
+		plugins:             newPluginFilters(cfg.Plugins),
+		serviceScopes:       newServiceScopes(cfg.ServiceTokens),
+		guestStarts:         ratelimit.NewLimiter(cfg.Guest.GetStartLimitPerMinute(), time.Minute, sessionStore),
+	}
+
+	m.identityHeaders = proxy.NewIdentityHeaders(m.identityHeaderNames()...)
+	if cfg.Server.GetMountPath() != "" {
+		m.identityHeaders = m.identityHeaders.With("X-Forwarded-Prefix")
+		m.anonymousHeaders = proxy.NewIdentityHeaders("X-Forwarded-Prefix")
+	}
+
+	if hasher, ok := authzChecker.(emailHasher); ok && cfg.Privacy.Minimize {
+		hasher.SetEmailHasher(cfg.Privacy.HashEmail)
+	}
+	if cfg.Forwarding.Audit.Enabled {
+		m.forwardingAudit = forwardingAuditLog(cfg.Forwarding.Audit.File)
 	}
 
 	// Initialize health state
 	m.healthLive.Store(true)
 	m.healthStatus.Store(HealthStatusStarting)
 	m.healthReady.Store(false)
+	m.registerBuiltinHealthChecks()
+	m.startEventBus()
+	m.registerBuiltinJobs()
 
 	return m, nil
 }
 
+// SetClock replaces the system clock of session, token and OTP expiry, of rate limiting and of the session cache,
+// so tests can move time forward with a clock.Fake instead of sleeping
+func (m *Middleware) SetClock(c clock.Clock) {
+	m.clock = clock.OrReal(c)
+	m.guestStarts.SetClock(c)
+	if m.emailHandler != nil {
+		m.emailHandler.SetClock(c)
+	}
+	if m.passwordHandler != nil {
+		m.passwordHandler.SetClock(c)
+	}
+	if m.idp != nil {
+		m.idp.SetClock(c)
+	}
+	if cached, ok := m.sessionStore.(*kvs.CachedStore); ok {
+		cached.SetClock(c)
+	}
+}
+
 // SetReady marks the middleware as ready to accept traffic
 // This should be called after all initialization is complete
+// Login pages are rendered beforehand, so the first visitors are served from the cache
 func (m *Middleware) SetReady() {
+	m.prerenderLoginPages()
 	m.healthStatus.Store(HealthStatusReady)
 	m.healthReady.Store(true)
 	m.logger.Info("Middleware ready to accept traffic")
@@ -136,8 +274,16 @@ func (m *Middleware) Wrap(next http.Handler) http.Handler {
 // ServeHTTP implements http.Handler
 // This is where all requests pass through
 func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = m.stripMountPath(r)
 	prefix := m.config.Server.GetAuthPathPrefix()
 
+	// Remember an explicit ?lang= on auth pages so that follow-up pages and redirects keep the language
+	if rest, ok := strings.CutPrefix(r.URL.Path, normalizeAuthPrefix(prefix)); ok && strings.HasPrefix(rest, "/") {
+		if lang, ok := explicitLanguage(r); ok {
+			setLanguageCookie(w, lang)
+		}
+	}
+
 	// Handle authentication endpoints
 	switch {
 	case matchPath(r.URL.Path, prefix, "/login"):
@@ -149,9 +295,24 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case matchPath(r.URL.Path, prefix, "/oauth2/start/"):
 		m.handleOAuth2Start(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/oauth2/upgrade/"):
+		m.handleOAuth2Upgrade(w, r)
+		return
 	case matchPath(r.URL.Path, prefix, "/oauth2/callback"):
 		m.handleOAuth2Callback(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/oauth2/backchannel-logout"):
+		m.handleBackchannelLogout(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/oauth2/frontchannel-logout"):
+		m.handleFrontchannelLogout(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/plugins/"):
+		m.handlePluginCallback(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/idp/"):
+		m.handleIDP(w, r)
+		return
 	case matchPath(r.URL.Path, prefix, "/email/send"):
 		m.handleEmailSend(w, r)
 		return
@@ -164,6 +325,21 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case matchPath(r.URL.Path, prefix, "/email/verify-otp"):
 		m.handleEmailVerifyOTP(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/session/check"):
+		m.handleSessionCheck(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/session/refresh"):
+		m.handleSessionRefresh(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/introspect"):
+		m.handleIntrospect(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/provider-token"):
+		m.handleProviderToken(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/guest/start"):
+		m.handleGuestStart(w, r)
+		return
 	case matchPath(r.URL.Path, prefix, "/password/login"):
 		m.handlePasswordLogin(w, r)
 		return
@@ -173,9 +349,27 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case matchPath(r.URL.Path, prefix, "/assets/dify.css"):
 		m.handleDifyCSS(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/assets/otp.js"):
+		m.handleOTPJS(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/assets/fragment.js"):
+		m.handleFragmentJS(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/assets/announcement.js"):
+		m.handleAnnouncementJS(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/dify/embed.js"):
+		m.handleDifyEmbedJS(w, r)
+		return
 	case matchPath(r.URL.Path, prefix, "/assets/icons/"):
 		m.handleIcon(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/assets/"):
+		m.handleAsset(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/manifest.webmanifest"):
+		m.handleWebManifest(w, r)
+		return
 	case matchPath(r.URL.Path, prefix, "/404"):
 		m.handle404(w, r)
 		return
@@ -185,17 +379,32 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case matchPath(r.URL.Path, prefix, "/health"):
 		m.handleHealth(w, r)
 		return
+	case matchPath(r.URL.Path, prefix, "/admin/"):
+		m.handleAdmin(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/api/metadata"), matchPath(r.URL.Path, prefix, "/api/metadata/"):
+		m.handleMetadata(w, r)
+		return
+	case matchPath(r.URL.Path, prefix, "/") && !m.config.Errors.NotFound.PassesThrough():
+		// Unknown auth endpoint
+		m.handle404(w, r)
+		return
+	}
+
+	// Internal callers with a service token skip the session check on their paths
+	if m.serveServiceCaller(w, r) {
+		return
 	}
 
 	// Evaluate access rules for the path
 	if m.rulesEvaluator != nil {
-		action := m.rulesEvaluator.Evaluate(r.URL.Path)
+		action, stepUp := m.rulesEvaluator.MatchRequest(r)
 		switch action {
 		case rules.ActionAllow:
 			// Allow access without authentication
 			m.logger.Debug("Rules: allowing without authentication", "path", r.URL.Path, "action", action)
 			if m.next != nil {
-				m.next.ServeHTTP(w, r)
+				m.serveNext(w, r, nil, false)
 			} else {
 				w.WriteHeader(http.StatusOK)
 				_, _ = w.Write([]byte("Allowed"))
@@ -205,14 +414,26 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case rules.ActionDeny:
 			// Deny access (403)
 			m.logger.Debug("Rules: denying access", "path", r.URL.Path, "action", action)
-			http.Error(w, "Access Denied", http.StatusForbidden)
+			if !m.serveConfiguredError(w, r, http.StatusForbidden) {
+				http.Error(w, "Access Denied", http.StatusForbidden)
+			}
 			return
 
 		case rules.ActionAuth:
 			// Require authentication (default behavior)
 			m.logger.Debug("Rules: requiring authentication", "path", r.URL.Path, "action", action)
+			if stepUp != nil {
+				m.requireStepUp(w, r, stepUp)
+				return
+			}
 			m.requireAuth(w, r)
 			return
+
+		case rules.ActionOptional:
+			// Allow access, identifying the user when logged in
+			m.logger.Debug("Rules: optional authentication", "path", r.URL.Path, "action", action)
+			m.optionalAuth(w, r)
+			return
 		}
 	}
 
@@ -224,35 +445,90 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // If yes, calls the next handler
 // If no, redirects to login
 func (m *Middleware) requireAuth(w http.ResponseWriter, r *http.Request) {
-	// Get session cookie
-	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
-	if err != nil {
-		// No session cookie, redirect to login
+	sess, ok := m.lookupSession(r)
+	if !ok {
+		// No valid session, redirect to login
 		m.redirectToLogin(w, r)
 		return
 	}
 
-	// Get session from store
-	sess, err := session.Get(m.sessionStore, cookie.Value)
-	if err != nil || sess == nil {
-		// Session not found, redirect to login
-		m.redirectToLogin(w, r)
+	m.serveAuthenticated(w, r, sess)
+}
+
+// optionalAuth proxies the request with or without a session
+// With a valid session the request gets the same identity as authenticated paths;
+// without one, client-supplied identity headers are removed so they cannot be spoofed
+func (m *Middleware) optionalAuth(w http.ResponseWriter, r *http.Request) {
+	if sess, ok := m.lookupSession(r); ok {
+		m.serveAuthenticated(w, r, sess)
 		return
 	}
 
-	// Check if session is valid
-	if !sess.IsValid() {
-		// Session expired or invalid, delete and redirect
-		_ = session.Delete(m.sessionStore, cookie.Value)
-		m.redirectToLogin(w, r)
+	m.stripAuthHeaders(r)
+	if m.next != nil {
+		m.serveNext(w, r, nil, false)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Allowed"))
+	}
+}
+
+// serveAuthenticated attaches the session's identity to the request and calls the next handler
+func (m *Middleware) serveAuthenticated(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	// Guests have a request quota, after which they are asked to sign in
+	if sess.Provider == guestProvider && !m.consumeGuestQuota(w, r, sess) {
 		return
 	}
 
 	// Session is valid, add auth headers and call next handler
 	m.addAuthHeaders(r, sess)
+	if m.config.Session.Refresh.ExpiresHeader {
+		w.Header().Set(sessionExpiresHeader, sess.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	// Add body fields (e.g., the backend profile's user field) to JSON API requests
+	if bodyForwarder, ok := m.forwarder.(forwarding.BodyForwarder); ok {
+		if err := bodyForwarder.AddToBody(r, forwardingUserInfo(sess)); err != nil {
+			m.logger.Warn("Failed to add user info to request body", "path", r.URL.Path, "error", err)
+			status := http.StatusBadRequest
+			if errors.Is(err, forwarding.ErrBodyTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	// Dify API requests get the server-side API key and the session user
+	var difyUser string
+	if m.difyInjector != nil && m.difyInjector.Matches(r.URL.Path) {
+		user := m.difyInjector.User(sess.Email, sess.Name)
+		if user == "" {
+			// Guests have no email; their anonymous ID keeps conversations apart
+			user, _ = sess.Extra[guestIDKey].(string)
+		}
+		if err := m.difyInjector.Apply(r, user); err != nil {
+			m.logger.Warn("Failed to prepare Dify API request", "path", r.URL.Path, "error", err)
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, dify.ErrBodyTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			case errors.Is(err, dify.ErrUnsupportedBody):
+				status = http.StatusUnsupportedMediaType
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		// Stops the body rewriting goroutine if the next handler did not read the whole body
+		if r.Body != nil {
+			defer func() { _ = r.Body.Close() }()
+		}
+		difyUser = user
+	}
+	m.auditForwarding(r, sess, difyUser)
 
 	if m.next != nil {
-		m.next.ServeHTTP(w, r)
+		m.serveNext(w, r, sess, true)
 	} else {
 		// If no next handler, return 200 OK (useful for testing)
 		w.WriteHeader(http.StatusOK)
@@ -260,10 +536,129 @@ func (m *Middleware) requireAuth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveNext calls the next handler with upstream failures routed to the branded 502/504 pages
+// sess is the session the request is served with, nil without one; it is passed to the proxy hooks.
+// identified reports whether the middleware set the identity headers (signed-in users and service callers).
+func (m *Middleware) serveNext(w http.ResponseWriter, r *http.Request, sess *session.Session, identified bool) {
+	if mount := m.config.Server.GetMountPath(); mount != "" {
+		r.Header.Set("X-Forwarded-Prefix", mount)
+	}
+	pluginHeaders, ok := m.runRequestPlugins(w, r, sess)
+	if !ok {
+		return
+	}
+	r, hookHeaders := m.runProxyHooks(r, sess)
+	if sess != nil {
+		w = m.watchWebSocketSession(w, r)
+	}
+	w, r, done := m.limitStream(w, r, sess)
+	defer done()
+	ctx := proxy.WithErrorHandler(r.Context(), m.handleUpstreamError)
+	ctx = proxy.WithIdentityHeaders(ctx, m.upstreamHeaders(r, sess, identified, append(pluginHeaders, hookHeaders...)))
+	m.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// upstreamHeaders returns the headers the middleware set on the upstream request, which the proxy's
+// request header filter keeps: identity headers when identified, X-Forwarded-Prefix with a mount path,
+// plus the Dify API key and the headers of plugins and proxy request hooks
+// Client headers of the same names on other requests stay subject to the filter.
+func (m *Middleware) upstreamHeaders(r *http.Request, sess *session.Session, identified bool, extraHeaders []string) *proxy.IdentityHeaders {
+	keep := m.anonymousHeaders
+	if identified {
+		keep = m.identityHeaders
+	}
+	if sess != nil && m.difyInjector != nil && m.difyInjector.Matches(r.URL.Path) {
+		extraHeaders = append(extraHeaders, "Authorization")
+	}
+	if len(extraHeaders) == 0 {
+		return keep
+	}
+	return keep.With(extraHeaders...)
+}
+
+// stripMountPath removes server.mount_path from the request path
+// Routing, rules and redirect targets work with application paths, whether or not the outer proxy
+// already stripped the mount path. Requests outside the mount path are returned as they are.
+func (m *Middleware) stripMountPath(r *http.Request) *http.Request {
+	mount := m.config.Server.GetMountPath()
+	if mount == "" {
+		return r
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, mount)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return r
+	}
+	if rest == "" {
+		rest = "/"
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = rest
+	if rawRest, ok := strings.CutPrefix(r.URL.RawPath, mount); ok && strings.HasPrefix(rawRest, "/") {
+		r2.URL.RawPath = rawRest
+	} else {
+		r2.URL.RawPath = ""
+	}
+	return r2
+}
+
+// lookupSession returns the valid session referenced by the request's session cookie
+// Expired or invalid sessions are deleted from the store and reported as missing
+func (m *Middleware) lookupSession(r *http.Request) (*session.Session, bool) {
+	// Get session cookie
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	if err != nil {
+		return nil, false
+	}
+	return m.activeSession(cookie.Value)
+}
+
+// activeSession returns the session with the ID if it is valid, deleting expired and revoked sessions
+func (m *Middleware) activeSession(sessionID string) (*session.Session, bool) {
+	// Get session from store
+	now := m.clock.Now()
+	sess, err := session.GetAt(m.sessionStore, sessionID, now)
+	if err != nil || sess == nil {
+		return nil, false
+	}
+
+	// Check if session is valid and has not been revoked via the admin API
+	if !sess.IsValidAt(now) || m.isSessionRevoked(sess) {
+		_ = session.Delete(m.sessionStore, sessionID)
+		return nil, false
+	}
+
+	return sess, true
+}
+
 // redirectToLogin redirects to the login page with the original URL
 func (m *Middleware) redirectToLogin(w http.ResponseWriter, r *http.Request) {
-	prefix := m.config.Server.GetAuthPathPrefix()
+	if m.redirectRootIcon(w, r) {
+		return
+	}
+
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
 	loginPath := joinAuthPath(prefix, "/login")
+	central := m.config.Server.CentralAuthURL != "" && !m.isCentralAuthHost(r)
+
+	// Scripts cannot follow a redirect to an HTML page: tell them to send the user to the login page
+	if isScriptRequest(r) {
+		loginURL := withLanguageQuery(loginPath, r)
+		if central {
+			loginURL = strings.TrimSuffix(m.config.Server.CentralAuthURL, "/") + loginURL
+		}
+		writeAPIJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":     "unauthenticated",
+			"login_url": loginURL,
+		})
+		return
+	}
+
+	// Central auth mode: delegate login to the central auth host and come back here afterwards
+	if central {
+		m.redirectToCentralLogin(w, r, withLanguageQuery(loginPath, r))
+		return
+	}
 
 	// Store original URL in cookie for redirect after authentication
 	// Don't save static resource paths
@@ -276,7 +671,7 @@ func (m *Middleware) redirectToLogin(w http.ResponseWriter, r *http.Request) {
 				http.SetCookie(w, &http.Cookie{
 					Name:     redirectCookieName,
 					Value:    originalURL,
-					Path:     "/",
+					Path:     m.config.Server.GetCookiePath(),
 					MaxAge:   600, // 10 minutes - enough time to complete authentication
 					HttpOnly: true,
 					Secure:   m.config.Session.Cookie.Secure,
@@ -286,7 +681,31 @@ func (m *Middleware) redirectToLogin(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	http.Redirect(w, r, loginPath, http.StatusFound)
+	http.Redirect(w, r, withLanguageQuery(loginPath, r), http.StatusFound)
+}
+
+// redirectToCentralLogin redirects to the login page on the central auth host
+// The absolute original URL is stored in a parent-domain cookie so the central host can
+// send the user back to this subdomain once the shared session has been created
+func (m *Middleware) redirectToCentralLogin(w http.ResponseWriter, r *http.Request, loginPath string) {
+	if !isStaticResource(r.URL.Path) {
+		originalURL := requestOrigin(r) + m.publicPath(r.URL.RequestURI())
+		if m.isAllowedRedirectURL(originalURL) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     redirectCookieName,
+				Value:    originalURL,
+				Path:     m.config.Server.GetCookiePath(),
+				Domain:   m.config.Session.Cookie.Domain,
+				MaxAge:   600, // 10 minutes - enough time to complete authentication
+				HttpOnly: true,
+				Secure:   m.config.Session.Cookie.Secure,
+				SameSite: m.config.Session.Cookie.GetSameSite(),
+			})
+		}
+	}
+
+	centralURL := strings.TrimSuffix(m.config.Server.CentralAuthURL, "/")
+	http.Redirect(w, r, centralURL+loginPath, http.StatusFound)
 }
 
 // addAuthHeaders adds authentication headers to the request
@@ -294,48 +713,73 @@ func (m *Middleware) addAuthHeaders(r *http.Request, sess *session.Session) {
 	// Add authentication status headers
 	r.Header.Set("X-Authenticated", "true")
 	r.Header.Set("X-Auth-Provider", sess.Provider)
+	r.Header.Del("X-Auth-Service") // Only set for service callers
 
 	// Add forwarding headers (X-Forwarded-*) only if configured
 	if m.forwarder != nil {
-		userInfo := &forwarding.UserInfo{
-			Username: sess.Name, // For email auth, this will be empty
-			Email:    sess.Email,
-			Extra:    sess.Extra,    // Additional OAuth2 data for custom forwarding
-			Provider: sess.Provider, // Provider name for provider-specific forwarding
-		}
-
 		// Add headers using forwarder (handles X-ChatbotGate-User, X-ChatbotGate-Email, and custom fields)
 		// Can be plain text or encrypted depending on configuration
-		r.Header = m.forwarder.AddToHeaders(r.Header, userInfo)
+		r.Header = m.forwarder.AddToHeaders(r.Header, forwardingUserInfo(sess))
+	}
+}
+
+// stripAuthHeaders removes the identity headers that addAuthHeaders would set
+func (m *Middleware) stripAuthHeaders(r *http.Request) {
+	for _, name := range m.identityHeaderNames() {
+		r.Header.Del(name)
+	}
+}
+
+// identityHeaderNames returns the names of the identity headers set by addAuthHeaders and service tokens
+func (m *Middleware) identityHeaderNames() []string {
+	names := []string{"X-Authenticated", "X-Auth-Provider", "X-Auth-Service"}
+	for _, field := range m.config.Forwarding.EffectiveFields() {
+		if field.Header != "" {
+			names = append(names, field.Header)
+		}
+	}
+	return names
+}
+
+// forwardingUserInfo converts a session to the user info passed to the forwarder
+func forwardingUserInfo(sess *session.Session) *forwarding.UserInfo {
+	return &forwarding.UserInfo{
+		Username: sess.Name, // For email auth, this will be empty
+		Email:    sess.Email,
+		Extra:    sess.Extra,    // Additional OAuth2 data for custom forwarding
+		Provider: sess.Provider, // Provider name for provider-specific forwarding
 	}
 }
 
 // matchPath checks if the request path matches the auth endpoint
+// It compares in place rather than joining the paths, as ServeHTTP calls it for every auth endpoint
 func matchPath(requestPath, prefix, endpoint string) bool {
-	fullPath := joinAuthPath(prefix, endpoint)
-	if endpoint[len(endpoint)-1] == '/' {
+	rest, ok := strings.CutPrefix(requestPath, strings.TrimRight(normalizeAuthPrefix(prefix), "/"))
+	if !ok {
+		return false
+	}
+	if !strings.HasPrefix(endpoint, "/") {
+		if rest, ok = strings.CutPrefix(rest, "/"); !ok {
+			return false
+		}
+	}
+	if strings.HasSuffix(endpoint, "/") {
 		// Prefix match for endpoints like "/oauth2/start/"
-		return len(requestPath) >= len(fullPath) && requestPath[:len(fullPath)] == fullPath
+		return strings.HasPrefix(rest, endpoint)
 	}
 	// Exact match
-	return requestPath == fullPath
+	return rest == endpoint
 }
 
 // joinAuthPath joins auth prefix and endpoint path
+// Trailing slashes of the prefix are dropped, so a prefix of "/" or "/_auth//" does not
+// produce a double slash at the join.
 func joinAuthPath(prefix, endpoint string) string {
 	// Normalize prefix
-	if prefix == "" {
-		prefix = "/_auth"
-	}
-	if prefix[len(prefix)-1] == '/' {
-		prefix = prefix[:len(prefix)-1]
-	}
-	if prefix[0] != '/' {
-		prefix = "/" + prefix
-	}
+	prefix = strings.TrimRight(normalizeAuthPrefix(prefix), "/")
 
 	// Normalize endpoint
-	if endpoint[0] != '/' {
+	if !strings.HasPrefix(endpoint, "/") {
 		endpoint = "/" + endpoint
 	}
 
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	stdoauth2 "golang.org/x/oauth2"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/email"
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
 	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
@@ -489,3 +491,497 @@ func TestHandleLogin_DividerDisplay(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddleware_CentralAuthRedirect(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Server.CentralAuthURL = "https://auth.example.com"
+	cfg.Session.Cookie.Domain = ".example.com"
+	mw, store := newTestMiddleware(t, cfg)
+
+	t.Run("app host redirects to central login", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chat?room=1", nil)
+		req.Host = "app1.example.com"
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+		if loc := rec.Header().Get("Location"); loc != "https://auth.example.com/_auth/login" {
+			t.Errorf("Location = %q, want central login URL", loc)
+		}
+
+		var redirectCookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == redirectCookieName {
+				redirectCookie = c
+			}
+		}
+		if redirectCookie == nil {
+			t.Fatal("Expected redirect cookie to be set")
+		}
+		if redirectCookie.Value != "https://app1.example.com/chat?room=1" {
+			t.Errorf("Redirect cookie = %q, want absolute original URL", redirectCookie.Value)
+		}
+		if redirectCookie.Domain != "example.com" {
+			t.Errorf("Redirect cookie domain = %q, want example.com", redirectCookie.Domain)
+		}
+	})
+
+	t.Run("central host uses local login", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chat", nil)
+		req.Host = "auth.example.com"
+		rec := httptest.NewRecorder()
+
+		mw.ServeHTTP(rec, req)
+
+		if loc := rec.Header().Get("Location"); loc != "/_auth/login" {
+			t.Errorf("Location = %q, want /_auth/login", loc)
+		}
+	})
+
+	t.Run("shared session is accepted on any subdomain", func(t *testing.T) {
+		sessionID := storeTestSession(t, store, "user@example.com")
+
+		req := httptest.NewRequest("GET", "/chat", nil)
+		req.Host = "app2.example.com"
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+
+		mw.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestHandleLogin_ProviderOrderingAndSections(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{
+		{ID: "github", Type: "github", Section: "Social", Order: 2},
+		{ID: "google", Type: "google", Section: "Social", Order: 2},
+		{ID: "microsoft", Type: "microsoft", Section: "Company SSO", Order: 1},
+		{ID: "legacy", Type: "custom", MoreOptions: true},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+	for _, name := range []string{"google", "github", "microsoft", "legacy"} {
+		mw.oauthManager.AddProvider(&mockProvider{name: name})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+
+	// Providers and headings must appear in configured order
+	ordered := []string{
+		"Company SSO",
+		"/_auth/oauth2/start/microsoft",
+		"Social",
+		"/_auth/oauth2/start/github",
+		"/_auth/oauth2/start/google",
+		`<details class="provider-more"`,
+		"Other options",
+		"/_auth/oauth2/start/legacy",
+	}
+	last := -1
+	for _, s := range ordered {
+		idx := strings.Index(body, s)
+		if idx == -1 {
+			t.Fatalf("Login page does not contain %q", s)
+		}
+		if idx < last {
+			t.Errorf("%q appears out of order", s)
+		}
+		last = idx
+	}
+}
+
+func TestHandleLogin_ProviderIconsAndDisplayNames(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{
+		{ID: "okta", Type: "custom", DisplayName: "Okta", Icon: `<svg xmlns="http://www.w3.org/2000/svg"></svg>`},
+		{ID: "keycloak", Type: "custom", DisplayName: "Keycloak", Icon: "data:image/png;base64,iVBORw0KGgo="},
+		{ID: "google-work", Type: "google"},
+		{ID: "partner", Type: "custom", IconURL: "https://cdn.example.com/partner.svg"},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+	for _, p := range cfg.OAuth2.Providers {
+		mw.oauthManager.AddProvider(&mockProvider{name: p.ID})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"Continue with Okta",
+		"Continue with Keycloak",
+		"Continue with google-work",
+		`src="data:image/svg&#43;xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciPjwvc3ZnPg=="`,
+		`src="data:image/png;base64,iVBORw0KGgo="`,
+		`src="/_auth/assets/` + assets.FingerprintedName("icons/google.svg") + `"`,
+		`src="https://cdn.example.com/partner.svg"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Login page does not contain %q", want)
+		}
+	}
+}
+
+func TestGroupProviderData(t *testing.T) {
+	providers := []ProviderData{
+		{Name: "a"},
+		{Name: "b", Section: "Social"},
+		{Name: "c", MoreOptions: true},
+		{Name: "d"},
+	}
+
+	sections, more := groupProviderData(providers)
+
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d", len(sections))
+	}
+	if sections[0].Heading != "" || len(sections[0].Providers) != 2 || sections[0].Providers[1].Name != "d" {
+		t.Errorf("Unexpected default section: %+v", sections[0])
+	}
+	if sections[1].Heading != "Social" || len(sections[1].Providers) != 1 {
+		t.Errorf("Unexpected Social section: %+v", sections[1])
+	}
+	if len(more) != 1 || more[0].Name != "c" {
+		t.Errorf("Unexpected more options: %+v", more)
+	}
+}
+
+func TestAuthPages_CustomHeadAndFooterHTML(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.CustomHeadHTML = `<script src="https://analytics.example.com/a.js"></script>`
+	cfg.Service.CustomFooterHTML = `<footer class="legal">Terms</footer>`
+	cfg.Service.CustomPages = map[string]config.CustomPageHTML{
+		config.PageLogout: {FooterHTML: `<a href="/support">Support</a>`},
+	}
+	cfg.Service.CustomScriptSrc = []string{"https://analytics.example.com"}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantHead   string
+		wantFooter string
+		dontWant   string
+	}{
+		{"login uses service-wide snippets", "/_auth/login", cfg.Service.CustomHeadHTML, cfg.Service.CustomFooterHTML, ""},
+		{"logout overrides footer", "/_auth/logout", cfg.Service.CustomHeadHTML, `<a href="/support">Support</a>`, "Terms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			headIdx := strings.Index(body, tt.wantHead)
+			if headIdx == -1 || headIdx > strings.Index(body, "</head>") {
+				t.Errorf("custom head HTML should be rendered inside <head>")
+			}
+			footerIdx := strings.Index(body, tt.wantFooter)
+			if footerIdx == -1 || footerIdx > strings.Index(body, "</body>") || footerIdx < strings.Index(body, "<body>") {
+				t.Errorf("custom footer HTML should be rendered inside <body>")
+			}
+			if tt.dontWant != "" && strings.Contains(body, tt.dontWant) {
+				t.Errorf("page should not contain %q", tt.dontWant)
+			}
+
+			csp := rec.Header().Get("Content-Security-Policy")
+			if !strings.Contains(csp, "script-src 'self' https://analytics.example.com;") {
+				t.Errorf("CSP should allow custom script sources, got %q", csp)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ExplicitLanguage(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	t.Run("redirect to login keeps lang", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/app?lang=ja", nil)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Location"); got != "/_auth/login?lang=ja" {
+			t.Errorf("Location = %q, want %q", got, "/_auth/login?lang=ja")
+		}
+	})
+
+	t.Run("auth page persists lang", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/login?lang=ja", nil)
+		req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Body.String(), `<html lang="ja"`) {
+			t.Error("login page should be rendered in Japanese")
+		}
+		found := false
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "lang" && c.Value == "ja" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("explicit lang should be stored in the lang cookie")
+		}
+	})
+
+	t.Run("unsupported lang is ignored", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/app?lang=xx", nil)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Location"); got != "/_auth/login" {
+			t.Errorf("Location = %q, want %q", got, "/_auth/login")
+		}
+	})
+}
+
+func TestAuthPages_RightToLeft(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	tests := []struct {
+		lang    string
+		wantDir string
+		want    string
+	}{
+		{"ar", "rtl", "تسجيل الدخول"},
+		{"he", "rtl", "התחברות"},
+		{"en", "ltr", "Login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/_auth/login?lang="+tt.lang, nil)
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			if !strings.Contains(body, `<html lang="`+tt.lang+`" dir="`+tt.wantDir+`"`) {
+				t.Errorf("login page should have lang=%q dir=%q", tt.lang, tt.wantDir)
+			}
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("login page should contain %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthPages_Accessibility(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	for _, path := range []string{"/_auth/login", "/_auth/logout", "/_auth/email/sent"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			for _, want := range []string{
+				`<a href="#main-content" class="skip-link">Skip to main content</a>`,
+				`<main id="main-content" class="auth-container" tabindex="-1">`,
+				`</main>`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("page should contain %q", want)
+				}
+			}
+		})
+	}
+
+	t.Run("login selects are labelled", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		for _, want := range []string{
+			`<label for="theme-select" class="sr-only">Theme</label>`,
+			`<label for="lang-select" class="sr-only">Language</label>`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("login page should contain %q", want)
+			}
+		}
+	})
+
+	t.Run("otp input is labelled", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/_auth/email/sent", nil)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		if !strings.Contains(body, `<label for="otp-input"`) || !strings.Contains(body, `autocomplete="one-time-code"`) {
+			t.Error("OTP input should have a label and one-time-code autocomplete")
+		}
+	})
+}
+
+// TestMiddleware_DifyInjection tests that Dify API requests of authenticated users get the server-side key and user
+func TestMiddleware_DifyInjection(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Dify = config.DifyConfig{Enabled: true, APIKey: "app-secret"}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	var gotAuth, gotBody, gotQueryUser string
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotQueryUser = r.URL.Query().Get("user")
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("authenticated chat message", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat-messages", strings.NewReader(`{"query":"hi","user":"someone-else"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if gotAuth != "Bearer app-secret" {
+			t.Errorf("Authorization = %q, want the configured key", gotAuth)
+		}
+		if !strings.Contains(gotBody, `"user":"user@example.com"`) || strings.Contains(gotBody, "someone-else") {
+			t.Errorf("body = %s, want the session user", gotBody)
+		}
+	})
+
+	t.Run("authenticated conversation list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/conversations", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if gotQueryUser != "user@example.com" {
+			t.Errorf("user query = %q, want user@example.com", gotQueryUser)
+		}
+	})
+
+	t.Run("non-API paths are untouched", func(t *testing.T) {
+		gotAuth = ""
+		req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if gotAuth != "" {
+			t.Errorf("Authorization = %q, want none", gotAuth)
+		}
+	})
+
+	t.Run("invalid JSON body is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat-messages", strings.NewReader(`not json`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("unauthenticated requests never see the key", func(t *testing.T) {
+		gotAuth = ""
+		req := httptest.NewRequest(http.MethodGet, "/v1/conversations", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+		if gotAuth != "" {
+			t.Errorf("Authorization = %q, want none", gotAuth)
+		}
+	})
+}
+
+func TestMiddleware_BackendBodyForwarding(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Forwarding = config.ForwardingConfig{Backend: config.BackendFlowise}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.forwarder = newTestForwarder(t, &cfg.Forwarding)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	var gotBody string
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("prediction request gets the session user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/prediction/flow-1", strings.NewReader(`{"question":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if !strings.Contains(gotBody, `"overrideConfig":{"vars":{"user":"user@example.com"}}`) {
+			t.Errorf("body = %s, want overrideConfig.vars.user", gotBody)
+		}
+	})
+
+	t.Run("invalid JSON body is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/prediction/flow-1", strings.NewReader(`not json`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+// TestServeHTTP_SessionStoreOutage tests that a failing session KVS sends users to the login page
+// instead of failing the request, and that their sessions work again when the KVS recovers
+func TestServeHTTP_SessionStoreOutage(t *testing.T) {
+	mw, store := newTestMiddleware(t, newTestConfig())
+	chaos := kvs.NewChaosStore(store, kvs.ChaosConfig{})
+	mw.sessionStore = chaos
+	sessionID := storeTestSession(t, store, "alice@example.com")
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+		req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	chaos.SetDown(true)
+	if rec := serve(); rec.Code != http.StatusFound || !strings.Contains(rec.Header().Get("Location"), "/login") {
+		t.Errorf("During the outage: status = %d, Location = %q, want a redirect to the login page", rec.Code, rec.Header().Get("Location"))
+	}
+
+	chaos.SetDown(false)
+	if rec := serve(); rec.Code != http.StatusOK {
+		t.Errorf("After the outage: status = %d, want %d with the kept session", rec.Code, http.StatusOK)
+	}
+}
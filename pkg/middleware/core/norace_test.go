@@ -0,0 +1,6 @@
+//go:build !race
+
+package middleware
+
+// raceEnabled reports whether the tests run with the race detector, which allocates on its own
+const raceEnabled = false
@@ -27,6 +27,7 @@ type mockOAuth2Provider struct {
 	nameToReturn  string
 	extraData     map[string]interface{}
 	emailError    error
+	emailVerified bool
 	tokenServer   *httptest.Server // Mock OAuth2 token endpoint
 }
 
@@ -93,9 +94,10 @@ func (p *mockOAuth2Provider) GetUserInfo(ctx context.Context, token *stdoauth2.T
 	extra["_avatar_url"] = "https://example.com/avatar.jpg"
 
 	return &oauth2.UserInfo{
-		Email: p.emailToReturn,
-		Name:  p.nameToReturn,
-		Extra: extra,
+		Email:         p.emailToReturn,
+		EmailVerified: p.emailVerified,
+		Name:          p.nameToReturn,
+		Extra:         extra,
 	}, nil
 }
 
@@ -448,6 +450,21 @@ func TestHandleOAuth2Callback(t *testing.T) {
 			expectedStatus:      http.StatusForbidden,
 			expectSessionCookie: false,
 		},
+		{
+			name: "OAuth2 callback with membership requirement not met",
+			setupCookies: func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+				r.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+				r.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+			},
+			queryParams: map[string]string{
+				"state": "test-state",
+				"code":  "test-auth-code",
+			},
+			providerError:       oauth2.ErrAccessDenied,
+			expectedStatus:      http.StatusForbidden,
+			expectSessionCookie: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -568,6 +585,115 @@ func TestHandleOAuth2Callback(t *testing.T) {
 	}
 }
 
+// TestHandleOAuth2Callback_RequireVerifiedEmail tests that unverified emails are rejected when required
+func TestHandleOAuth2Callback_RequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		require        bool
+		verified       bool
+		expectedStatus int
+	}{
+		{name: "Verified email is accepted", require: true, verified: true, expectedStatus: http.StatusFound},
+		{name: "Unverified email is rejected", require: true, verified: false, expectedStatus: http.StatusForbidden},
+		{name: "Unverified email is accepted without the option", require: false, verified: false, expectedStatus: http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.OAuth2.Providers = []config.OAuth2Provider{
+				{ID: "google", Type: "google", RequireVerifiedEmail: tt.require},
+			}
+			mw, _ := newTestMiddleware(t, cfg)
+			mw.authzChecker = authz.NewEmailChecker(cfg.AccessControl)
+
+			mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+			mockProvider.emailVerified = tt.verified
+			defer mockProvider.Close()
+			mw.oauthManager.AddProvider(mockProvider)
+
+			req := httptest.NewRequest("GET", "/_auth/oauth2/callback?state=test-state&code=test-auth-code", nil)
+			req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+			req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+			req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+			rec := httptest.NewRecorder()
+
+			mw.handleOAuth2Callback(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.expectedStatus)
+				t.Logf("Response body: %s", rec.Body.String())
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "_test_session" && c.Value != "" && tt.expectedStatus != http.StatusFound {
+					t.Error("Did not expect session cookie for an unverified email")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleOAuth2Callback_ClaimsAndPruning(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "google", Type: "google"}}
+	cfg.Session.Extra = config.ExtraConfig{
+		Allow: []string{"_email", "_username", "department"},
+		Deny:  []string{"department"},
+	}
+	cfg.ClaimsMapping = []config.ClaimMapping{
+		{Claim: "team", From: []string{"department"}},
+		{Claim: "username", From: []string{"profile.title"}},
+	}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.authzChecker = authz.NewEmailChecker(cfg.AccessControl)
+
+	mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+	mockProvider.extraData = map[string]interface{}{
+		"department": "sales",
+		"profile":    map[string]interface{}{"title": "Sales Rep", "photos": []string{"a", "b"}},
+		groupsKey:    "staff",
+	}
+	defer mockProvider.Close()
+	mw.oauthManager.AddProvider(mockProvider)
+
+	req := httptest.NewRequest("GET", "/_auth/oauth2/callback?state=test-state&code=test-auth-code", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+	req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+	req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+	rec := httptest.NewRecorder()
+
+	mw.handleOAuth2Callback(rec, req)
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	var sessionID string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_test_session" {
+			sessionID = c.Value
+		}
+	}
+	sess, err := session.Get(store, sessionID)
+	if err != nil {
+		t.Fatalf("session.Get() error = %v", err)
+	}
+
+	// Mapped claims and reserved keys survive the allowlist; denied and unlisted keys are dropped
+	if sess.Extra["_team"] != "sales" || sess.Name != "Sales Rep" {
+		t.Errorf("Extra[_team] = %v, Name = %s, want the mapped claims", sess.Extra["_team"], sess.Name)
+	}
+	for _, key := range []string{"_email", "_username", groupsKey} {
+		if _, ok := sess.Extra[key]; !ok {
+			t.Errorf("Extra[%q] missing, want kept", key)
+		}
+	}
+	for _, key := range []string{"department", "profile", "_avatar_url"} {
+		if _, ok := sess.Extra[key]; ok {
+			t.Errorf("Extra[%q] present, want pruned", key)
+		}
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || indexOf(s, substr) >= 0))
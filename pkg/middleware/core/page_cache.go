@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+)
+
+// pageFragments are the parts of every auth page that only depend on the configuration
+type pageFragments struct {
+	header     template.HTML
+	styleLinks template.HTML
+	creditIcon string
+	mainCSS    assets.Asset // Served at /assets/main.css
+	manifest   assets.Asset // Served at /manifest.webmanifest
+}
+
+// loginPageKey identifies a variant of the rendered login page
+type loginPageKey struct {
+	lang         i18n.Language
+	theme        i18n.Theme
+	reauth       bool   // Step-up notice shown (?reauth=1)
+	guest        bool   // Guest upgrade notice shown
+	variant      string // Login experiment variant (empty without experiment)
+	announcement string // ID of the announcement banner shown (empty: none, or dismissed)
+}
+
+// loginPageCache holds rendered login pages, which only change with the configuration
+// and with authentication methods enabled or disabled at runtime (see reset).
+// Language and theme are normalized, so there are a few dozen variants at most.
+type loginPageCache struct {
+	mu         sync.RWMutex
+	pages      map[loginPageKey][]byte
+	generation uint64 // Incremented on every reset, so pages rendered before one are not cached
+}
+
+// get returns the rendered page of key, if cached, and the generation to put a newly rendered page with
+func (c *loginPageCache) get(key loginPageKey) ([]byte, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	body, ok := c.pages[key]
+	return body, c.generation, ok
+}
+
+// put caches the rendered page of key, unless the cache was reset since generation
+func (c *loginPageCache) put(key loginPageKey, generation uint64, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	if c.pages == nil {
+		c.pages = make(map[loginPageKey][]byte)
+	}
+	c.pages[key] = body
+}
+
+// reset drops all rendered pages
+func (c *loginPageCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages = nil
+	c.generation++
+}
+
+// staticFragments returns the configuration-only page fragments, built on first use
+func (m *Middleware) staticFragments() *pageFragments {
+	m.fragmentsOnce.Do(func() {
+		prefix := m.config.Server.GetPublicAuthPathPrefix()
+		m.fragments = &pageFragments{
+			header:     template.HTML(m.buildAuthHeaderHTML(prefix)),
+			styleLinks: template.HTML(m.buildStyleLinksHTML() + "\n" + m.buildIconLinksHTML()),
+			creditIcon: assetURL(normalizeAuthPrefix(prefix), "icons/chatbotgate.svg"),
+			mainCSS:    buildMainCSS(m.config.Service.Theme),
+			manifest:   m.buildWebManifest(),
+		}
+	})
+	return m.fragments
+}
+
+// prerenderLoginPages renders the default login page of every language and theme,
+// so the first visitors after startup are served from the cache
+func (m *Middleware) prerenderLoginPages() {
+	if m.oauthManager == nil || m.templates == nil {
+		return
+	}
+	for _, lang := range i18n.Languages() {
+		for _, theme := range i18n.Themes() {
+			if _, err := m.loginPage(loginPageKey{lang: lang, theme: theme}); err != nil {
+				m.logger.Warn("Failed to prerender login page", "lang", lang, "theme", theme, "error", err)
+				return
+			}
+		}
+	}
+}
+
+// writeHTML writes a rendered page with the security headers
+func (m *Middleware) writeHTML(w http.ResponseWriter, statusCode int, body []byte) error {
+	m.setSecurityHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_, err := w.Write(body)
+	return err
+}
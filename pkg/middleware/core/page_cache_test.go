@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+)
+
+func TestLoginPageCache_Prerender(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	mw.SetReady()
+
+	want := len(i18n.Languages()) * len(i18n.Themes())
+	if got := len(mw.loginPages.pages); got != want {
+		t.Fatalf("prerendered %d login pages, want %d", got, want)
+	}
+
+	// Cached variants keep their language, theme and notices
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"japanese", "/_auth/login?lang=ja", `lang="ja"`},
+		{"dark theme", "/_auth/login?theme=dark", `class="dark"`},
+		{"reauth notice", "/_auth/login?reauth=1", mw.translator.T(i18n.English, "login.reauth.notice")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				rec := httptest.NewRecorder()
+				mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+				}
+				if !strings.Contains(rec.Body.String(), tt.want) {
+					t.Errorf("render %d of %s does not contain %q", i+1, tt.target, tt.want)
+				}
+				if rec.Header().Get("Content-Security-Policy") == "" {
+					t.Errorf("render %d of %s has no security headers", i+1, tt.target)
+				}
+			}
+		})
+	}
+
+	// The default page does not carry the reauth notice of another variant
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_auth/login", nil))
+	if strings.Contains(rec.Body.String(), mw.translator.T(i18n.English, "login.reauth.notice")) {
+		t.Error("default login page should not show the reauth notice")
+	}
+}
+
+func TestLoginPageCache_StalePutAfterReset(t *testing.T) {
+	var c loginPageCache
+	key := loginPageKey{lang: i18n.English, theme: i18n.ThemeAuto}
+
+	_, generation, ok := c.get(key)
+	if ok {
+		t.Fatal("empty cache should miss")
+	}
+	c.reset() // An auth method is toggled while the page renders
+	c.put(key, generation, []byte("stale"))
+
+	if _, _, ok := c.get(key); ok {
+		t.Error("page rendered before a reset should not be cached")
+	}
+}
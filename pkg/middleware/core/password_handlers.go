@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"time"
 )
 
 // handlePasswordLogin handles password authentication
@@ -11,5 +12,46 @@ func (m *Middleware) handlePasswordLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	m.passwordHandler.HandleLogin(w, r)
+	// Reject when password authentication is disabled at runtime via the admin API
+	if !m.isAuthMethodEnabled(authMethodPassword) {
+		http.Error(w, "Password authentication is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	started := time.Now()
+	sw := &passwordStatusWriter{ResponseWriter: w}
+	m.passwordHandler.HandleLogin(sw, r)
+
+	// The handler only reports the outcome through the response
+	switch sw.status {
+	case http.StatusOK:
+		m.recordLogin(authMethodPassword, "password@localhost", started)
+		m.recordExperimentLogin(r)
+	case http.StatusUnauthorized:
+		m.recordLoginFailure(authMethodPassword, loginFailureInvalidPassword)
+	case http.StatusBadRequest:
+		m.recordLoginFailure(authMethodPassword, loginFailureInvalidRequest)
+	case http.StatusInternalServerError:
+		m.recordLoginFailure(authMethodPassword, loginFailureSession)
+	}
+}
+
+// passwordStatusWriter captures the status of the password login response for the login stats
+type passwordStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *passwordStatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *passwordStatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
 }
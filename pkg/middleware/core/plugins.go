@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/plugins"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// pluginProviderPrefix is the prefix of the session provider of users signed in by a plugin callback
+// e.g. "plugin:sso-bridge", so plugins cannot pass for a built-in provider
+const pluginProviderPrefix = "plugin:"
+
+// pluginFilter is a configured plugin and its process
+type pluginFilter struct {
+	config  config.PluginConfig
+	process *plugins.Process
+}
+
+// newPluginFilters returns the plugins of the configuration; their processes start on first use
+func newPluginFilters(cfgs []config.PluginConfig) []*pluginFilter {
+	var filters []*pluginFilter
+	for _, cfg := range cfgs {
+		filters = append(filters, &pluginFilter{config: cfg, process: plugins.NewProcess(cfg)})
+	}
+	return filters
+}
+
+// ClosePlugins stops the plugin processes
+// The server calls it when a reload replaces the middleware; later calls fail like a crashed plugin.
+func (m *Middleware) ClosePlugins() {
+	for _, p := range m.plugins {
+		p.process.Close()
+	}
+}
+
+// runRequestPlugins passes the request through the plugins with the request hook, in configuration order
+// A plugin may deny the request or set headers of the upstream request, e.g. to change the forwarded identity.
+// Returns the names of the headers set by the plugins, and false when the request was answered: denied,
+// or failed with a plugin that does not fail open.
+func (m *Middleware) runRequestPlugins(w http.ResponseWriter, r *http.Request, sess *session.Session) ([]string, bool) {
+	var headers []string
+	for _, p := range m.plugins {
+		if !p.config.HasHook(config.PluginHookRequest) || !p.config.MatchesPath(r.URL.Path) {
+			continue
+		}
+
+		req := pluginRequest(r, config.PluginHookRequest)
+		if sess != nil {
+			req.User = &plugins.User{Email: sess.Email, Name: sess.Name, Provider: sess.Provider}
+		}
+		reply, err := p.process.Call(r.Context(), req)
+		if err != nil {
+			if p.config.FailOpen {
+				m.logger.Warn("Plugin failed, passing the request on", "plugin", p.config.Name, "path", r.URL.Path, "error", err)
+				continue
+			}
+			m.logger.Error("Plugin failed", "plugin", p.config.Name, "path", r.URL.Path, "error", err)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return nil, false
+		}
+
+		if reply.Action == plugins.ActionDeny {
+			m.logger.Info("Plugin denied the request", "plugin", p.config.Name, "path", r.URL.Path)
+			writePluginDenial(w, reply)
+			return nil, false
+		}
+		for name, value := range reply.Headers {
+			if value == "" {
+				r.Header.Del(name)
+			} else {
+				r.Header.Set(name, value)
+				headers = append(headers, name)
+			}
+		}
+	}
+	return headers, true
+}
+
+// handlePluginCallback serves the custom auth callback of a plugin ({prefix}/plugins/{name}/callback)
+// The plugin gets the request and answers with "login" and the user to sign in, or "deny".
+// The user must pass the authorization (access_control) like users of the built-in providers.
+func (m *Middleware) handlePluginCallback(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	rest := extractPathParam(r.URL.Path, joinAuthPath(m.config.Server.GetAuthPathPrefix(), "/plugins/"))
+	name, ok := strings.CutSuffix(rest, "/callback")
+	var plugin *pluginFilter
+	for _, p := range m.plugins {
+		if ok && p.config.Name == name && p.config.HasHook(config.PluginHookCallback) {
+			plugin = p
+		}
+	}
+	if plugin == nil {
+		http.NotFound(w, r)
+		return
+	}
+	provider := pluginProviderPrefix + name
+
+	reply, err := plugin.process.Call(r.Context(), pluginRequest(r, config.PluginHookCallback))
+	if err != nil {
+		m.logger.Error("Plugin callback failed", "plugin", name, "error", err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if reply.Action != plugins.ActionLogin || reply.User == nil || reply.User.Email == "" {
+		m.logger.Info("Plugin callback denied the login", "plugin", name)
+		writePluginDenial(w, reply)
+		return
+	}
+
+	email := reply.User.Email
+	if m.authzChecker != nil && m.authzChecker.RequiresEmail() && !m.authzChecker.IsAllowed(email) {
+		m.logger.Info("Plugin login denied: user not authorized", "plugin", name, "email", m.logEmail(email))
+		m.recordLoginFailure(provider, loginFailureNotAuthorized)
+		m.handleForbidden(w, r)
+		return
+	}
+
+	// Delete any existing session to prevent session fixation attacks
+	if oldCookie, err := r.Cookie(m.config.Session.Cookie.Name); err == nil {
+		_ = session.Delete(m.sessionStore, oldCookie.Value)
+	}
+
+	sessionID, err := generateSessionID()
+	if err != nil {
+		m.logger.Error("Failed to generate session ID", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	duration, err := m.config.Session.Cookie.GetExpireDuration()
+	if err != nil {
+		duration = 168 * time.Hour // Default 7 days
+	}
+
+	userName := reply.User.Name
+	if userName == "" {
+		userName = extractUserpart(email)
+	}
+	now := m.clock.Now()
+	sess := &session.Session{
+		ID:       sessionID,
+		Email:    email,
+		Name:     userName,
+		Provider: provider,
+		Extra: map[string]interface{}{
+			"_email":      email,
+			"_username":   userName,
+			"_avatar_url": "",
+		},
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(duration),
+		Authenticated: true,
+	}
+	m.minimizeSession(sess)
+	if err := session.SetAt(m.sessionStore, sessionID, sess, now); err != nil {
+		m.logger.Error("Plugin login failed: could not store session", "plugin", name, "error", err)
+		m.recordLoginFailure(provider, loginFailureSession)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.config.Session.Cookie.Name,
+		Value:    sessionID,
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
+		MaxAge:   int(duration.Seconds()),
+		HttpOnly: m.config.Session.Cookie.HTTPOnly,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: m.config.Session.Cookie.GetSameSite(),
+	})
+
+	m.logger.Info("Plugin authentication successful", "plugin", name, "email", m.logEmail(email))
+	m.recordLogin(provider, email, started)
+	m.recordExperimentLogin(r)
+
+	// The plugin's landing path still has to pass the redirect rules
+	redirectURL := m.getRedirectURL(w, r)
+	if reply.Redirect != "" {
+		redirectURL = reply.Redirect
+		if !m.allowsRedirectTarget(redirectURL) {
+			redirectURL = m.redirectFallback()
+		}
+	}
+	http.Redirect(w, r, m.publicPath(redirectURL), http.StatusFound)
+}
+
+// pluginRequest returns the plugin call describing r
+// Cookies are left out: they carry the session of the gate.
+func pluginRequest(r *http.Request, hook string) *plugins.Request {
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if name != "Cookie" && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+	return &plugins.Request{
+		Hook:       hook,
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    headers,
+	}
+}
+
+// writePluginDenial answers with the status and message of a plugin's denial (default: 403)
+func writePluginDenial(w http.ResponseWriter, reply *plugins.Reply) {
+	status := reply.Status
+	if status < 400 || status > 599 {
+		status = http.StatusForbidden
+	}
+	message := reply.Message
+	if message == "" {
+		message = "Access Denied"
+	}
+	http.Error(w, message, status)
+}
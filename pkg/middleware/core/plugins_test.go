@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// testPluginScript denies /admin, hangs on /slow, signs in bob on callbacks and else allows with a header
+const testPluginScript = `#!/bin/sh
+while read -r line; do
+  case "$line" in
+    *'"path":"/admin"'*) echo '{"action":"deny","status":403,"message":"admins only"}' ;;
+    *'"path":"/slow"'*) exec sleep 5 ;;
+    *'"hook":"callback"'*) echo '{"action":"login","user":{"email":"bob@example.com"},"redirect":"/welcome"}' ;;
+    *'"email":"alice@example.com"'*) echo '{"action":"allow","headers":{"X-Plugin-Tenant":"alice-tenant","X-Remove":""}}' ;;
+    *) echo '{"action":"allow"}' ;;
+  esac
+done
+`
+
+// newTestPlugin writes the test plugin script and returns its configuration
+func newTestPlugin(t *testing.T, hooks ...string) config.PluginConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(path, []byte(testPluginScript), 0o755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return config.PluginConfig{Name: "policy", Command: []string{path}, Hooks: hooks, Timeout: "500ms"}
+}
+
+func TestRequestPlugins(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Plugins = []config.PluginConfig{newTestPlugin(t, config.PluginHookRequest)}
+	mw, store := newTestMiddleware(t, cfg)
+	defer mw.ClosePlugins()
+
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Tenant", r.Header.Get("X-Plugin-Tenant"))
+		w.Header().Set("X-Upstream-Remove", r.Header.Get("X-Remove"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	cookie := &http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")}
+
+	req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	req.Header.Set("X-Remove", "client value")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Upstream-Tenant") != "alice-tenant" || rec.Header().Get("X-Upstream-Remove") != "" {
+		t.Errorf("GET /chat = %d %v, want 200 with the headers set by the plugin", rec.Code, rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "admins only") {
+		t.Errorf("GET /admin = %d %q, want the denial of the plugin", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /slow = %d, want %d when the plugin times out", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRequestPlugins_FailOpen(t *testing.T) {
+	plugin := newTestPlugin(t, config.PluginHookRequest)
+	plugin.FailOpen = true
+	plugin.Paths = []string{"/slow"}
+	cfg := newTestConfig()
+	cfg.Plugins = []config.PluginConfig{plugin}
+	mw, store := newTestMiddleware(t, cfg)
+	defer mw.ClosePlugins()
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	cookie := &http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")}
+
+	// /admin is not in the plugin's paths, and the failing plugin lets /slow through
+	for _, path := range []string{"/admin", "/slow"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+}
+
+func TestPluginCallback(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Plugins = []config.PluginConfig{newTestPlugin(t, config.PluginHookCallback)}
+	mw, store := newTestMiddleware(t, cfg)
+	defer mw.ClosePlugins()
+	prefix := cfg.Server.GetAuthPathPrefix()
+
+	rec := httptest.NewRecorder()
+	mw.Wrap(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, prefix+"/plugins/policy/callback?ticket=abc", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/welcome" {
+		t.Fatalf("Callback = %d %q, want a redirect to the plugin's landing path", rec.Code, rec.Header().Get("Location"))
+	}
+
+	var sessionID string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_test_session" {
+			sessionID = c.Value
+		}
+	}
+	sess, err := session.Get(store, sessionID)
+	if err != nil {
+		t.Fatalf("session.Get() error = %v", err)
+	}
+	if sess.Email != "bob@example.com" || sess.Provider != "plugin:policy" || !sess.Authenticated {
+		t.Errorf("Session = %+v, want bob signed in by the plugin", sess)
+	}
+
+	for _, path := range []string{prefix + "/plugins/other/callback", prefix + "/plugins/policy"} {
+		rec = httptest.NewRecorder()
+		mw.Wrap(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// emailHasher is implemented by authorization checkers accepting hashed allowlist entries (privacy.minimize)
+type emailHasher interface {
+	SetEmailHasher(hash func(email string) string)
+}
+
+// sessionEmail returns the email as stored in sessions: its salted hash with privacy.minimize
+func (m *Middleware) sessionEmail(email string) string {
+	if !m.config.Privacy.Minimize || email == "" {
+		return email
+	}
+	return m.config.Privacy.HashEmail(email)
+}
+
+// logEmail returns the email as logged: its salted hash with privacy.minimize, masked otherwise
+func (m *Middleware) logEmail(email string) string {
+	if m.config.Privacy.Minimize && email != "" {
+		return m.config.Privacy.HashEmail(email)
+	}
+	return logging.MaskEmail(email)
+}
+
+// minimizeSession replaces the email of a new session with its salted hash and drops its display name
+// (privacy.minimize). Copies of them in the provider data are hashed or dropped too, as are names
+// derived from the email.
+func (m *Middleware) minimizeSession(sess *session.Session) {
+	if !m.config.Privacy.Minimize {
+		return
+	}
+	drop := []string{sess.Name}
+	sess.Name = ""
+	email, hash := sess.Email, ""
+	if email != "" {
+		hash = m.config.Privacy.HashEmail(email)
+		drop = append(drop, extractUserpart(email))
+		sess.Email = hash
+	}
+	for k, v := range sess.Extra {
+		sess.Extra[k] = minimizeValue(v, email, hash, drop)
+	}
+}
+
+// minimizeValue returns v with the strings equal to email replaced by hash, and the ones equal to one of drop emptied
+func minimizeValue(v interface{}, email, hash string, drop []string) interface{} {
+	switch value := v.(type) {
+	case string:
+		if email != "" && strings.EqualFold(value, email) {
+			return hash
+		}
+		for _, dropped := range drop {
+			if dropped != "" && strings.EqualFold(value, dropped) {
+				return ""
+			}
+		}
+	case map[string]interface{}:
+		for k, nested := range value {
+			value[k] = minimizeValue(nested, email, hash, drop)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = minimizeValue(nested, email, hash, drop)
+		}
+	}
+	return v
+}
+
+// isAllowlistHash reports whether an allowlist entry is an email hash accepted in the configuration
+func (m *Middleware) isAllowlistHash(entry string) bool {
+	return m.config.Privacy.Minimize && config.IsEmailHash(entry)
+}
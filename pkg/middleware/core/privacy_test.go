@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// newPrivacyTestConfig returns a test configuration with PII minimization
+func newPrivacyTestConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.Privacy = config.PrivacyConfig{Minimize: true, Salt: "test-salt-0123456789"}
+	return cfg
+}
+
+func TestMinimizeSession(t *testing.T) {
+	cfg := newPrivacyTestConfig()
+	mw, _ := newTestMiddleware(t, cfg)
+	hash := cfg.Privacy.HashEmail("alice@example.com")
+
+	sess := &session.Session{
+		Email: "alice@example.com",
+		Name:  "Alice Liddell",
+		Extra: map[string]interface{}{
+			"_email":    "Alice@Example.com",
+			"_username": "alice",
+			"name":      "Alice Liddell",
+			"userinfo":  map[string]interface{}{"email": "alice@example.com", "emails": []interface{}{"alice@example.com"}},
+			"locale":    "en",
+		},
+	}
+	mw.minimizeSession(sess)
+
+	if sess.Email != hash || sess.Name != "" {
+		t.Errorf("Email, Name = %q, %q; want the hash and no name", sess.Email, sess.Name)
+	}
+	userinfo := sess.Extra["userinfo"].(map[string]interface{})
+	if sess.Extra["_email"] != hash || userinfo["email"] != hash || userinfo["emails"].([]interface{})[0] != hash {
+		t.Errorf("Extra = %v, want the email hashed everywhere", sess.Extra)
+	}
+	if sess.Extra["_username"] != "" || sess.Extra["name"] != "" || sess.Extra["locale"] != "en" {
+		t.Errorf("Extra = %v, want the userpart and name dropped and other data kept", sess.Extra)
+	}
+
+	if got := mw.logEmail("alice@example.com"); got != hash {
+		t.Errorf("logEmail() = %q, want the hash", got)
+	}
+	if strings.Contains(mw.logEmail("alice@example.com"), "alice") {
+		t.Error("logEmail() should not reveal the email")
+	}
+
+	// Without minimization, sessions are unchanged and logs masked
+	plain, _ := newTestMiddleware(t, newTestConfig())
+	sess = &session.Session{Email: "alice@example.com", Name: "alice"}
+	plain.minimizeSession(sess)
+	if sess.Email != "alice@example.com" || sess.Name != "alice" || plain.logEmail("alice@example.com") != "a***@example.com" {
+		t.Errorf("Session without minimization = %+v", sess)
+	}
+}
+
+func TestPrivacy_LoginStats(t *testing.T) {
+	cfg := newPrivacyTestConfig()
+	cfg.Server.AdminToken = testAdminToken
+	mw, _ := newTestMiddleware(t, cfg)
+
+	// Users are counted by the hash, the same for a plain email and its hash
+	mw.recordLogin("google", "alice@example.com", time.Now())
+	mw.recordLogin("plugin:sso", cfg.Privacy.HashEmail("alice@example.com"), time.Now())
+	mw.loginStats.mu.Lock()
+	defer mw.loginStats.mu.Unlock()
+	google, plugin := newUserSketch(), newUserSketch()
+	for key, day := range mw.loginStats.days {
+		if strings.HasSuffix(key, ":google") {
+			google = day.UserSketch
+		} else {
+			plugin = day.UserSketch
+		}
+	}
+	if !slices.Equal(google, plugin) || google.count() != 1 {
+		t.Error("A plain email and its hash should count as the same user")
+	}
+}
+
+func TestPrivacy_RevokeSessions(t *testing.T) {
+	cfg := newPrivacyTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	hash := cfg.Privacy.HashEmail("alice@example.com")
+	sessionID := storeTestSession(t, store, hash)
+	storeTestSession(t, store, cfg.Privacy.HashEmail("bob@example.com"))
+
+	deleted, err := mw.RevokeSessions(context.Background(), "Alice@example.com")
+	if err != nil || deleted != 1 {
+		t.Fatalf("RevokeSessions() = %d, %v; want the session with the hash deleted", deleted, err)
+	}
+	if _, err := session.Get(store, sessionID); err == nil {
+		t.Error("The session of the revoked email should be deleted")
+	}
+	if !mw.isSessionRevoked(&session.Session{Email: hash, CreatedAt: time.Now().Add(-time.Minute)}) {
+		t.Error("Sessions with the hash created before the revocation should be rejected")
+	}
+}
+
+func TestPrivacy_HashedAllowlist(t *testing.T) {
+	cfg := newPrivacyTestConfig()
+	hash := cfg.Privacy.HashEmail("alice@example.com")
+	cfg.AccessControl.Emails = []string{hash}
+
+	store, err := kvs.NewMemoryStore("test", kvs.MemoryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	checker := authz.NewEmailChecker(cfg.AccessControl)
+	mw, err := New(cfg, store, nil, nil, nil, checker, nil, nil, i18n.NewTranslator(), logging.NewTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New gives the checker the hash function of the configuration
+	if !checker.IsAllowed("alice@example.com") || checker.IsAllowed("bob@example.com") {
+		t.Error("The hashed allowlist entry should allow alice@example.com only")
+	}
+
+	if err := mw.SetAllowlist([]string{cfg.Privacy.HashEmail("bob@example.com"), "@example.org"}); err != nil {
+		t.Fatalf("SetAllowlist() with a hash error = %v", err)
+	}
+	if !checker.IsAllowed("bob@example.com") {
+		t.Error("The hash set via SetAllowlist should allow bob@example.com")
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+)
+
+// providerCheckTimeout bounds the self-test of a single OAuth2 provider
+const providerCheckTimeout = 10 * time.Second
+
+// baseURLHint is reported when callback URLs follow the request host because server.base_url is not set
+const baseURLHint = "server.base_url is not set; the redirect URL follows the request host, so register the URL of every host users reach"
+
+// CheckProviders runs the connectivity self-test of every OAuth2 provider concurrently
+// Results are logged, kept for the admin API, and returned in configuration order
+func (m *Middleware) CheckProviders(ctx context.Context) []oauth2.ProviderCheck {
+	var providers []oauth2.Provider
+	if m.oauthManager != nil {
+		for _, p := range m.config.OAuth2.Providers {
+			if provider, err := m.oauthManager.GetProvider(p.ID); err == nil {
+				providers = append(providers, provider)
+			}
+		}
+	}
+
+	checks := make([]oauth2.ProviderCheck, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider oauth2.Provider) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, providerCheckTimeout)
+			defer cancel()
+			checks[i] = oauth2.CheckProvider(m.oauthManager.HTTPContext(checkCtx), provider)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	for i := range checks {
+		if m.config.Server.BaseURL == "" {
+			checks[i].Hints = append(checks[i].Hints, baseURLHint)
+		}
+		m.logProviderCheck(checks[i])
+	}
+
+	m.providerChecksMu.Lock()
+	m.providerChecks = checks
+	m.providerChecksMu.Unlock()
+
+	return checks
+}
+
+// ProviderChecks returns the results of the last provider self-test, or nil if none has run
+func (m *Middleware) ProviderChecks() []oauth2.ProviderCheck {
+	m.providerChecksMu.RLock()
+	defer m.providerChecksMu.RUnlock()
+	return m.providerChecks
+}
+
+// logProviderCheck logs a self-test result: Info when the provider is healthy, Warn otherwise
+func (m *Middleware) logProviderCheck(check oauth2.ProviderCheck) {
+	if check.OK() {
+		m.logger.Info("OAuth2 provider check passed",
+			"provider", check.Provider,
+			"token_endpoint", check.TokenEndpoint,
+			"redirect_url", check.RedirectURL,
+			"clock_skew_seconds", check.ClockSkewSeconds)
+		return
+	}
+
+	m.logger.Warn("OAuth2 provider check found problems",
+		"provider", check.Provider,
+		"reachable", check.Reachable,
+		"token_endpoint", check.TokenEndpoint,
+		"redirect_url", check.RedirectURL,
+		"error", check.Error)
+	for _, hint := range check.Hints {
+		m.logger.Warn("OAuth2 provider hint", "provider", check.Provider, "hint", hint)
+	}
+}
@@ -0,0 +1,356 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	stdoauth2 "golang.org/x/oauth2"
+)
+
+// sessionRefKey is the session Extra key holding the session reference of the provider token endpoint
+// Forward it with the "extra.session_ref" path; upstreams exchange it for the provider's access token.
+const sessionRefKey = "session_ref"
+
+// providerTokenResponse is the body of the provider token endpoint
+type providerTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	Provider    string `json:"provider"`
+}
+
+// providerTokenEncryptor returns the encryptor of the provider tokens kept in sessions
+func (m *Middleware) providerTokenEncryptor() *forwarding.Encryptor {
+	return forwarding.NewEncryptor("provider-token:" + m.config.Session.Cookie.Secret)
+}
+
+// sessionRefEncryptor returns the encryptor of session references
+func (m *Middleware) sessionRefEncryptor() *forwarding.Encryptor {
+	return forwarding.NewEncryptor("session-ref:" + m.config.Session.Cookie.Secret)
+}
+
+// sessionRef returns the session reference of a session ID: the ID encrypted, so that upstreams
+// receiving it cannot use it as a session cookie
+func (m *Middleware) sessionRef(sessionID string) (string, error) {
+	sealed, err := m.sessionRefEncryptor().Seal([]byte(sessionID))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// sessionOfRef returns the session ID of a session reference
+func (m *Middleware) sessionOfRef(ref string) (string, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(ref)
+	if err != nil {
+		return "", false
+	}
+	sessionID, err := m.sessionRefEncryptor().Open(data)
+	if err != nil {
+		return "", false
+	}
+	return string(sessionID), true
+}
+
+// keepProviderToken stores the provider token in a new OAuth2 session, with its session reference in Extra
+// Does nothing unless provider_tokens.enabled.
+func (m *Middleware) keepProviderToken(sess *session.Session, token *stdoauth2.Token) error {
+	if !m.config.ProviderTokens.Enabled {
+		return nil
+	}
+	if err := m.sealProviderToken(sess, token); err != nil {
+		return err
+	}
+	ref, err := m.sessionRef(sess.ID)
+	if err != nil {
+		return err
+	}
+	if sess.Extra == nil {
+		sess.Extra = make(map[string]interface{})
+	}
+	sess.Extra[sessionRefKey] = ref
+	return nil
+}
+
+// sealProviderToken stores the provider token in the session, encrypted
+func (m *Middleware) sealProviderToken(sess *session.Session, token *stdoauth2.Token) error {
+	data, err := json.Marshal(&stdoauth2.Token{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	})
+	if err != nil {
+		return err
+	}
+	sealed, err := m.providerTokenEncryptor().Seal(data)
+	if err != nil {
+		return err
+	}
+	sess.ProviderToken = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// openProviderToken returns the provider token of the session, or nil when it has none
+func (m *Middleware) openProviderToken(sess *session.Session) *stdoauth2.Token {
+	if sess.ProviderToken == "" {
+		return nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(sess.ProviderToken)
+	if err != nil {
+		return nil
+	}
+	data, err := m.providerTokenEncryptor().Open(sealed)
+	if err != nil {
+		return nil
+	}
+	var token stdoauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil || token.AccessToken == "" {
+		return nil
+	}
+	return &token
+}
+
+// handleProviderToken returns the OAuth2 provider's current access token of a session to upstream services
+// (POST /_auth/provider-token)
+// Upstreams authenticate with provider_tokens.secret (Authorization: Bearer) and send the session
+// reference forwarded as "extra.session_ref" as the "session_ref" form parameter. Tokens expiring within
+// provider_tokens.refresh_before are refreshed with the provider first, so upstreams never hold stale ones.
+// Returns 404 unless provider_tokens.enabled.
+func (m *Middleware) handleProviderToken(w http.ResponseWriter, r *http.Request) {
+	cfg := m.config.ProviderTokens
+	if !cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIJSON(w, http.StatusMethodNotAllowed, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "only POST is accepted"})
+		return
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.Secret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="provider-token"`)
+		writeAPIJSON(w, http.StatusUnauthorized, &idp.Error{Code: idp.ErrorInvalidClient, Description: "a valid provider token secret is required"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("session_ref") == "" {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidRequest, Description: "the session_ref parameter is required"})
+		return
+	}
+
+	sessionID, ok := m.sessionOfRef(r.PostForm.Get("session_ref"))
+	if !ok {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidGrant, Description: "the session reference is invalid"})
+		return
+	}
+	sess, ok := m.activeSession(sessionID)
+	if !ok {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidGrant, Description: "the session has ended"})
+		return
+	}
+	token := m.openProviderToken(sess)
+	if token == nil {
+		writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidGrant, Description: "the session has no provider token"})
+		return
+	}
+
+	if expiresWithin(token, cfg.GetRefreshBefore(), m.clock.Now()) {
+		refreshed, err := m.refreshProviderToken(r, sessionID, sess.Provider)
+		var retrieveErr *stdoauth2.RetrieveError
+		switch {
+		case errors.Is(err, oauth2.ErrNoRefreshToken) || errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == idp.ErrorInvalidGrant:
+			m.logger.Info("Provider token could not be refreshed", "provider", sess.Provider, "error", err)
+			writeAPIJSON(w, http.StatusBadRequest, &idp.Error{Code: idp.ErrorInvalidGrant, Description: "the provider token has expired; the user must sign in again"})
+			return
+		case err != nil:
+			m.logger.Error("Failed to refresh provider token", "provider", sess.Provider, "error", err)
+			writeAPIJSON(w, http.StatusBadGateway, &idp.Error{Code: idp.ErrorServerError, Description: "the provider could not refresh the token"})
+			return
+		}
+		token = refreshed
+	}
+
+	resp := providerTokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   token.Type(),
+		Provider:    sess.Provider,
+	}
+	if !token.Expiry.IsZero() {
+		resp.ExpiresIn = int64(token.Expiry.Sub(m.clock.Now()).Seconds())
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// expiresWithin reports whether the token expires within d (never for tokens without expiry)
+func expiresWithin(token *stdoauth2.Token, d time.Duration, now time.Time) bool {
+	return !token.Expiry.IsZero() && !now.Add(d).Before(token.Expiry)
+}
+
+// refreshLock serializes the provider token refreshes of one session
+type refreshLock struct {
+	held chan struct{} // Holds a value while a refresh runs
+	refs int           // Refreshes waiting or running, guarded by providerTokenLocksMu
+}
+
+// Lease of the provider token refresh of a session, for the instances sharing the session KVS
+const (
+	providerTokenLeasePrefix = "provider-token-refresh:"
+	providerTokenLeaseTTL    = 30 * time.Second
+	providerTokenLeasePoll   = 100 * time.Millisecond // Time between two checks of a refresh by another instance
+)
+
+// lockProviderRefresh waits until no other refresh of the session runs on this instance, or ctx is done
+// It returns the function releasing the lock.
+func (m *Middleware) lockProviderRefresh(ctx context.Context, sessionID string) (func(), error) {
+	m.providerTokenLocksMu.Lock()
+	if m.providerTokenLocks == nil {
+		m.providerTokenLocks = make(map[string]*refreshLock)
+	}
+	lock, ok := m.providerTokenLocks[sessionID]
+	if !ok {
+		lock = &refreshLock{held: make(chan struct{}, 1)}
+		m.providerTokenLocks[sessionID] = lock
+	}
+	lock.refs++
+	m.providerTokenLocksMu.Unlock()
+
+	done := func() {
+		m.providerTokenLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(m.providerTokenLocks, sessionID)
+		}
+		m.providerTokenLocksMu.Unlock()
+	}
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			done()
+		}, nil
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
+
+// leaseProviderRefresh acquires the lease of the refresh of the session, so that a single instance
+// refreshes it. While another instance holds the lease, it waits for that refresh and returns its
+// token, or nil when the lease ends without a refresh. Stores without leases have no lease to acquire.
+func (m *Middleware) leaseProviderRefresh(ctx context.Context, sessionID string) (release func(), token *stdoauth2.Token, err error) {
+	leaser, ok := kvs.Uncached(m.sessionStore).(kvs.Leaser)
+	if !ok {
+		return func() {}, nil, nil
+	}
+	holder := make([]byte, 8)
+	if _, err := rand.Read(holder); err != nil {
+		return nil, nil, err
+	}
+	key, id := providerTokenLeasePrefix+sessionID, hex.EncodeToString(holder)
+
+	for {
+		acquired, err := leaser.AcquireLease(ctx, key, id, providerTokenLeaseTTL)
+		if errors.Is(err, kvs.ErrNotSupported) {
+			return func() {}, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if acquired {
+			return func() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := leaser.ReleaseLease(releaseCtx, key, id); err != nil {
+					m.logger.Warn("Failed to release provider token refresh lease", "error", err)
+				}
+			}, nil, nil
+		}
+
+		select {
+		case <-time.After(providerTokenLeasePoll):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		sess, ok := m.activeSession(sessionID)
+		if !ok {
+			return nil, nil, oauth2.ErrNoRefreshToken
+		}
+		if token := m.openProviderToken(sess); token != nil && !expiresWithin(token, m.config.ProviderTokens.GetRefreshBefore(), m.clock.Now()) {
+			return nil, token, nil
+		}
+	}
+}
+
+// refreshProviderToken refreshes the provider token of a session and stores the new one
+// Refreshes of a session are serialized, on this instance and across the instances sharing a session KVS
+// with leases: providers rotating refresh tokens accept each one once, so a request waiting for another's
+// refresh uses its result instead of refreshing again. Refreshes of other sessions do not wait.
+func (m *Middleware) refreshProviderToken(r *http.Request, sessionID, providerName string) (*stdoauth2.Token, error) {
+	unlock, err := m.lockProviderRefresh(r.Context(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	release, refreshedElsewhere, err := m.leaseProviderRefresh(r.Context(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if refreshedElsewhere != nil {
+		return refreshedElsewhere, nil
+	}
+	defer release()
+
+	// The refresh another request waited for may have stored a fresh token already
+	sess, ok := m.activeSession(sessionID)
+	if !ok {
+		return nil, oauth2.ErrNoRefreshToken
+	}
+	token := m.openProviderToken(sess)
+	if token == nil {
+		return nil, oauth2.ErrNoRefreshToken
+	}
+	if !expiresWithin(token, m.config.ProviderTokens.GetRefreshBefore(), m.clock.Now()) {
+		return token, nil
+	}
+
+	refreshed, err := m.oauthManager.RefreshToken(r.Context(), providerName, token)
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	// Serialize with the other writes of the session (metadata)
+	m.sessionWriteMu.Lock()
+	defer m.sessionWriteMu.Unlock()
+	if sess, ok = m.activeSession(sessionID); !ok {
+		return refreshed, nil
+	}
+	if err := m.sealProviderToken(sess, refreshed); err != nil {
+		return nil, err
+	}
+	if err := session.SetAt(m.sessionStore, sessionID, sess, m.clock.Now()); err != nil {
+		return nil, err
+	}
+	m.logger.Debug("Provider token refreshed", "provider", providerName)
+	return refreshed, nil
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	stdoauth2 "golang.org/x/oauth2"
+)
+
+const testProviderTokenSecret = "provider-token-secret-with-32-characters"
+
+// newProviderTokenTestMiddleware returns a middleware keeping provider tokens, with a session signed in
+// with the mock google provider, its session reference and the provider's token requests
+func newProviderTokenTestMiddleware(t *testing.T) (*Middleware, string, string, *[]url.Values) {
+	t.Helper()
+
+	cfg := newTestConfig()
+	cfg.Session.Cookie.Expire = "24h" // Outlives the provider token
+	cfg.ProviderTokens = config.ProviderTokensConfig{Enabled: true, Secret: testProviderTokenSecret}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.authzChecker = authz.NewEmailChecker(cfg.AccessControl)
+	mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+	t.Cleanup(mockProvider.Close)
+	mw.oauthManager.AddProvider(mockProvider)
+
+	var requests []url.Values
+	mockProvider.tokenServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		requests = append(requests, r.PostForm)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("refresh_token") {
+		case "":
+			_, _ = w.Write([]byte(`{"access_token":"first","token_type":"Bearer","refresh_token":"refresh-1","expires_in":3600}`))
+		case "refresh-1":
+			_, _ = w.Write([]byte(`{"access_token":"second","token_type":"Bearer","refresh_token":"refresh-2","expires_in":3600}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?state=test-state&code=test-auth-code", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+	req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+	req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+	rec := httptest.NewRecorder()
+	mw.handleOAuth2Callback(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Callback status = %d, want %d", rec.Code, http.StatusFound)
+	}
+
+	var sessionID string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_test_session" {
+			sessionID = c.Value
+		}
+	}
+	sess, err := session.Get(store, sessionID)
+	if err != nil {
+		t.Fatalf("session.Get() error = %v", err)
+	}
+	ref, _ := sess.Extra[sessionRefKey].(string)
+	if ref == "" || strings.Contains(ref, sessionID) {
+		t.Fatalf("Extra[%q] = %q, want an encrypted session reference", sessionRefKey, ref)
+	}
+	if sess.ProviderToken == "" || strings.Contains(sess.ProviderToken, "refresh-1") {
+		t.Fatalf("ProviderToken = %q, want the encrypted provider token", sess.ProviderToken)
+	}
+	requests = requests[:0]
+	return mw, sessionID, ref, &requests
+}
+
+// postProviderToken calls the provider token endpoint
+func postProviderToken(mw *Middleware, secret, ref string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/_auth/provider-token", strings.NewReader(url.Values{"session_ref": {ref}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProviderToken(t *testing.T) {
+	mw, _, ref, requests := newProviderTokenTestMiddleware(t)
+
+	rec := postProviderToken(mw, testProviderTokenSecret, ref)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp providerTokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken != "first" || resp.TokenType != "Bearer" || resp.Provider != "google" || resp.ExpiresIn <= 3500 {
+		t.Errorf("Response = %+v, want the token of the sign-in", resp)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Token requests = %v, want none for a fresh token", *requests)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+
+	tests := []struct {
+		name       string
+		secret     string
+		ref        string
+		wantStatus int
+		wantError  string
+	}{
+		{"no secret", "", ref, http.StatusUnauthorized, "invalid_client"},
+		{"wrong secret", strings.Repeat("x", 40), ref, http.StatusUnauthorized, "invalid_client"},
+		{"no reference", testProviderTokenSecret, "", http.StatusBadRequest, "invalid_request"},
+		{"forged reference", testProviderTokenSecret, "dGVzdC1zZXNzaW9u", http.StatusBadRequest, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postProviderToken(mw, tt.secret, tt.ref)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantError) {
+				t.Errorf("Status = %d, body = %s, want %d %s", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestProviderToken_Refresh(t *testing.T) {
+	mw, sessionID, ref, requests := newProviderTokenTestMiddleware(t)
+
+	// Two minutes before the expiry the token is still served; within refresh_before it is refreshed
+	mw.config.ProviderTokens.RefreshBefore = "2m"
+	mw.clock = clock.NewFake(time.Now().Add(59 * time.Minute))
+
+	rec := postProviderToken(mw, testProviderTokenSecret, ref)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"access_token":"second"`) {
+		t.Fatalf("Status = %d, body = %s, want the refreshed token", rec.Code, rec.Body.String())
+	}
+	if len(*requests) != 1 || (*requests)[0].Get("grant_type") != "refresh_token" {
+		t.Fatalf("Token requests = %v, want one refresh", *requests)
+	}
+
+	// The refreshed token is stored, with the rotated refresh token
+	sess, err := session.Get(mw.sessionStore, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := mw.openProviderToken(sess); token == nil || token.AccessToken != "second" || token.RefreshToken != "refresh-2" {
+		t.Errorf("Stored token = %+v, want the refreshed one", token)
+	}
+
+	// A refresh token the provider rejects ends the exchange
+	mw.clock = clock.NewFake(time.Now().Add(2 * time.Hour))
+	rec = postProviderToken(mw, testProviderTokenSecret, ref)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "sign in again") {
+		t.Errorf("Status = %d, body = %s, want invalid_grant", rec.Code, rec.Body.String())
+	}
+	if last := (*requests)[len(*requests)-1]; last.Get("refresh_token") != "refresh-2" {
+		t.Errorf("Refresh request = %v, want the rotated refresh token", last)
+	}
+}
+
+func TestProviderToken_RefreshLocks(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	unlock, err := mw.lockProviderRefresh(context.Background(), "session-a")
+	if err != nil {
+		t.Fatalf("lockProviderRefresh() error = %v", err)
+	}
+	// Refreshes of other sessions do not wait
+	unlockB, err := mw.lockProviderRefresh(context.Background(), "session-b")
+	if err != nil {
+		t.Fatalf("lockProviderRefresh() of another session error = %v", err)
+	}
+	unlockB()
+
+	// A refresh of the same session waits, until its request is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := mw.lockProviderRefresh(ctx, "session-a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lockProviderRefresh() of a locked session error = %v, want the deadline", err)
+	}
+	unlock()
+	if len(mw.providerTokenLocks) != 0 {
+		t.Errorf("locks = %v, want none once released", mw.providerTokenLocks)
+	}
+}
+
+func TestProviderToken_RefreshByAnotherInstance(t *testing.T) {
+	mw, sessionID, ref, requests := newProviderTokenTestMiddleware(t)
+	mw.clock = clock.NewFake(time.Now().Add(59 * time.Minute))
+
+	// Another instance holds the lease and stores its refreshed token meanwhile
+	leaser := kvs.Uncached(mw.sessionStore).(kvs.Leaser)
+	ctx := context.Background()
+	if ok, err := leaser.AcquireLease(ctx, providerTokenLeasePrefix+sessionID, "other-instance", time.Minute); !ok || err != nil {
+		t.Fatalf("AcquireLease() = %v, %v", ok, err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sess, err := session.Get(mw.sessionStore, sessionID)
+		if err != nil {
+			return
+		}
+		_ = mw.sealProviderToken(sess, &stdoauth2.Token{AccessToken: "elsewhere", RefreshToken: "refresh-2", Expiry: time.Now().Add(3 * time.Hour)})
+		_ = session.Set(mw.sessionStore, sessionID, sess)
+	}()
+
+	rec := postProviderToken(mw, testProviderTokenSecret, ref)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"access_token":"elsewhere"`) {
+		t.Fatalf("Status = %d, body = %s, want the token refreshed by the other instance", rec.Code, rec.Body.String())
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Token requests = %v, want none while another instance refreshes", *requests)
+	}
+}
+
+func TestProviderToken_EndedSession(t *testing.T) {
+	mw, sessionID, ref, _ := newProviderTokenTestMiddleware(t)
+
+	if err := session.Delete(mw.sessionStore, sessionID); err != nil {
+		t.Fatal(err)
+	}
+	rec := postProviderToken(mw, testProviderTokenSecret, ref)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_grant") {
+		t.Errorf("Status = %d, body = %s, want invalid_grant", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProviderToken_Disabled(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	rec := postProviderToken(mw, testProviderTokenSecret, "ref")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+)
+
+// ProxyRequestHook modifies a request before it is sent to the upstream, after the identity headers are set
+// The headers it sets are kept by the request header filter of the upstream, like the identity headers.
+// sess is the user's session, or nil for requests without one (rules allow or optional, service tokens).
+// Hooks must not modify the session.
+type ProxyRequestHook func(r *http.Request, sess *session.Session)
+
+// ProxyResponseHook modifies the upstream's response before it is sent to the client
+// sess is the same as for ProxyRequestHook. Returning an error discards the response and the client
+// gets the 502 page. Response hooks only run when the next handler is the proxy of pkg/proxy/core.
+type ProxyResponseHook func(resp *http.Response, sess *session.Session) error
+
+// OnProxyRequest registers a hook called for every request passed to the upstream
+// Hooks run in the order they were registered.
+func (m *Middleware) OnProxyRequest(hook ProxyRequestHook) {
+	m.proxyHooksMu.Lock()
+	defer m.proxyHooksMu.Unlock()
+	m.proxyRequestHooks = append(m.proxyRequestHooks, hook)
+}
+
+// OnProxyResponse registers a hook called for every response of the upstream
+// Hooks run in the order they were registered; the first error stops the others.
+func (m *Middleware) OnProxyResponse(hook ProxyResponseHook) {
+	m.proxyHooksMu.Lock()
+	defer m.proxyHooksMu.Unlock()
+	m.proxyResponseHooks = append(m.proxyResponseHooks, hook)
+}
+
+// runProxyHooks runs the request hooks and returns r with the response hooks attached for the proxy
+// Also returns the names of the headers the request hooks set, which the request header filter keeps.
+func (m *Middleware) runProxyHooks(r *http.Request, sess *session.Session) (*http.Request, []string) {
+	m.proxyHooksMu.RLock()
+	requestHooks, responseHooks := m.proxyRequestHooks, m.proxyResponseHooks
+	m.proxyHooksMu.RUnlock()
+
+	var headers []string
+	if len(requestHooks) > 0 {
+		before := r.Header.Clone()
+		for _, hook := range requestHooks {
+			hook(r, sess)
+		}
+		for name, values := range r.Header {
+			if !slices.Equal(before[name], values) {
+				headers = append(headers, name)
+			}
+		}
+	}
+	if len(responseHooks) == 0 {
+		return r, headers
+	}
+	return r.WithContext(proxy.WithResponseHook(r.Context(), func(resp *http.Response) error {
+		for _, hook := range responseHooks {
+			if err := hook(resp, sess); err != nil {
+				return err
+			}
+		}
+		return nil
+	})), headers
+}
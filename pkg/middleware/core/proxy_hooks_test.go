@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+)
+
+func TestProxyHooks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Tenant", r.Header.Get("X-Tenant"))
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	proxyHandler, err := proxy.NewHandler(upstream.URL)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+
+	mw, store := newTestMiddleware(t, newTestConfig())
+	handler := mw.Wrap(proxyHandler)
+
+	var order []string
+	mw.OnProxyRequest(func(r *http.Request, sess *session.Session) {
+		order = append(order, "request")
+		if sess != nil {
+			r.Header.Set("X-Tenant", "tenant-of-"+sess.Email)
+		}
+	})
+	failResponse := false
+	mw.OnProxyResponse(func(resp *http.Response, sess *session.Session) error {
+		order = append(order, "response")
+		if failResponse {
+			return errors.New("rejected by hook")
+		}
+		resp.Header.Del("X-Internal")
+		resp.Header.Set("X-Session-Email", sess.Email)
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || len(order) != 2 || order[0] != "request" || order[1] != "response" {
+		t.Fatalf("Status = %d, hooks = %v, want 200 with the request and response hooks", rec.Code, order)
+	}
+	if got := rec.Header().Get("X-Upstream-Tenant"); got != "tenant-of-alice@example.com" {
+		t.Errorf("Upstream X-Tenant = %q, want the value set by the request hook", got)
+	}
+	if rec.Header().Get("X-Internal") != "" || rec.Header().Get("X-Session-Email") != "alice@example.com" {
+		t.Errorf("Response headers = %v, want the changes of the response hook", rec.Header())
+	}
+
+	failResponse = true
+	req = httptest.NewRequest(http.MethodGet, "/chat", nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Status with a failing response hook = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestProxy_HeaderFilterKeepsIdentityHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+	proxyHandler, err := proxy.NewHandlerWithConfig(proxy.UpstreamConfig{
+		URL:                upstream.URL,
+		HeaderFilterConfig: proxy.HeaderFilterConfig{AllowedRequestHeaders: []string{"X-Client-Version"}},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	mw, store := newTestMiddleware(t, newTestConfig())
+	handler := mw.Wrap(proxyHandler)
+	mw.OnProxyRequest(func(r *http.Request, sess *session.Session) {
+		r.Header.Set("X-Tenant", "acme")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")})
+	req.Header.Set("X-Client-Version", "1.2")
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Tenant", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The allowlist applies to the client's headers, not to the identity headers set by the middleware
+	if got.Get("X-Authenticated") != "true" || got.Get("X-Auth-Provider") != "google" {
+		t.Errorf("upstream identity headers = %v, want the ones set by the middleware", got)
+	}
+	if got.Get("X-Tenant") != "acme" {
+		t.Errorf("upstream X-Tenant = %q, want the value set by the request hook", got.Get("X-Tenant"))
+	}
+	if got.Get("X-Client-Version") != "1.2" || got.Get("X-Debug") != "" {
+		t.Errorf("upstream client headers = %v, want only the allowed ones", got)
+	}
+}
+
+func TestProxy_HeaderFilterSpoofedIdentityHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+	proxyHandler, err := proxy.NewHandlerWithConfig(proxy.UpstreamConfig{
+		URL: upstream.URL,
+		HeaderFilterConfig: proxy.HeaderFilterConfig{
+			AllowedRequestHeaders: []string{"X-Client-Version"},
+			BlockedRequestHeaders: []string{"X-Forwarded-Prefix"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	rulesConfig := rules.Config{{Prefix: "/public/", Action: rules.ActionAllow}, {Prefix: "/", Action: rules.ActionAuth}}
+	rulesEvaluator, err := rules.NewEvaluator(&rulesConfig)
+	if err != nil {
+		t.Fatalf("Failed to create rules evaluator: %v", err)
+	}
+	cfg := newTestConfig()
+	cfg.Forwarding = config.ForwardingConfig{
+		Fields: []config.ForwardingField{{Path: "email", Header: "X-ChatbotGate-Email"}},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+	mw.forwarder = newTestForwarder(t, &cfg.Forwarding)
+	mw.rulesEvaluator = rulesEvaluator
+	handler := mw.Wrap(proxyHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/public/docs", nil)
+	req.Header.Set("X-Client-Version", "1.2")
+	req.Header.Set("X-ChatbotGate-Email", "admin@example.com")
+	req.Header.Set("X-Authenticated", "true")
+	req.Header.Set("X-Forwarded-Prefix", "/admin")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", rec.Code)
+	}
+	// Without a session the gate sets no identity headers: the client's ones are filtered like any other
+	for _, name := range []string{"X-ChatbotGate-Email", "X-Authenticated", "X-Forwarded-Prefix"} {
+		if value := got.Get(name); value != "" {
+			t.Errorf("upstream %s = %q, want the spoofed header removed by the filter", name, value)
+		}
+	}
+	if got.Get("X-Client-Version") != "1.2" {
+		t.Errorf("upstream X-Client-Version = %q, want the allowed client header", got.Get("X-Client-Version"))
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -466,3 +467,138 @@ func TestRequireAuth_WithNextHandler(t *testing.T) {
 		t.Errorf("Body = %q, want %q", body, "Next handler called")
 	}
 }
+
+// TestServeHTTP_OptionalAuth tests rules with request conditions and the optional action
+func TestServeHTTP_OptionalAuth(t *testing.T) {
+	rulesConfig := rules.Config{
+		{Prefix: "/widget/", Auth: rules.AuthOptional},
+		{Prefix: "/api/", Methods: []string{"GET"}, Headers: map[string]string{"Sec-Fetch-Dest": "script"}, Action: rules.ActionAllow},
+		{Prefix: "/", Action: rules.ActionAuth},
+	}
+	rulesEvaluator, err := rules.NewEvaluator(&rulesConfig)
+	if err != nil {
+		t.Fatalf("Failed to create rules evaluator: %v", err)
+	}
+
+	cfg := newTestConfig()
+	cfg.Forwarding = config.ForwardingConfig{
+		Fields: []config.ForwardingField{{Path: "email", Header: "X-Auth-Email"}},
+	}
+	mw, store := newTestMiddleware(t, cfg)
+	mw.rulesEvaluator = rulesEvaluator
+	mw.forwarder = newTestForwarder(t, &cfg.Forwarding)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	var gotAuthenticated, gotEmail string
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthenticated = r.Header.Get("X-Authenticated")
+		gotEmail = r.Header.Get("X-Auth-Email")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("optional path with session gets identity", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/widget/chat", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if gotAuthenticated != "true" || gotEmail != "user@example.com" {
+			t.Errorf("X-Authenticated = %q, X-Auth-Email = %q, want identity headers", gotAuthenticated, gotEmail)
+		}
+	})
+
+	t.Run("optional path without session strips spoofed identity", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/widget/chat", nil)
+		req.Header.Set("X-Authenticated", "true")
+		req.Header.Set("X-Auth-Email", "admin@example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if gotAuthenticated != "" || gotEmail != "" {
+			t.Errorf("X-Authenticated = %q, X-Auth-Email = %q, want none", gotAuthenticated, gotEmail)
+		}
+	})
+
+	t.Run("optional path with unknown session never redirects", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/widget/chat", nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: "expired-session"})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("script requests pass without session", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/loader.js", nil)
+		req.Header.Set("Sec-Fetch-Dest", "script")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("other requests still require login", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/loader.js", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusFound {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusFound)
+		}
+	})
+}
+
+func TestServeHTTP_MountPath(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Server.MountPath = "/bot"
+	mw, store := newTestMiddleware(t, cfg)
+
+	var upstream *http.Request
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Paths are the same whether or not the outer proxy strips the mount path
+	for _, path := range []string{"/bot/chat?q=1", "/chat?q=1"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/bot/_auth/login" {
+			t.Fatalf("GET %s = %d %q, want a redirect to /bot/_auth/login", path, rec.Code, rec.Header().Get("Location"))
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value != "/chat?q=1" || cookies[0].Path != "/bot" {
+			t.Errorf("GET %s cookies = %v, want the redirect cookie /chat?q=1 on /bot", path, cookies)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bot/_auth/login", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="/bot/_auth/assets/`) {
+		t.Errorf("Login page = %d, want links under /bot/_auth", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/bot/chat", nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: storeTestSession(t, store, "alice@example.com")})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if upstream == nil || upstream.URL.Path != "/chat" || upstream.Header.Get("X-Forwarded-Prefix") != "/bot" {
+		t.Fatalf("Upstream request = %v, want /chat with X-Forwarded-Prefix /bot", upstream)
+	}
+
+	if got := mw.publicPath("/chat"); got != "/bot/chat" {
+		t.Errorf("publicPath(/chat) = %q, want /bot/chat", got)
+	}
+	if got := mw.publicPath("https://app.example.com/chat"); got != "https://app.example.com/chat" {
+		t.Errorf("publicPath(absolute URL) = %q, want it unchanged", got)
+	}
+}
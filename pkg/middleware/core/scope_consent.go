@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+)
+
+// scopeConsentCookiePrefix prefixes the cookie remembering the optional scopes the visitor approved
+// and declined, one per provider: "approved=<scope>&declined=<scope>"
+const scopeConsentCookiePrefix = "_chatbotgate_scopes_"
+
+// scopeConsentCookieMaxAge keeps the choice across sign-ins
+const scopeConsentCookieMaxAge = 365 * 24 * time.Hour
+
+// scopeConsentQuery is the OAuth2 start URL query parameter showing the consent step again ("?consent=1")
+const scopeConsentQuery = "consent"
+
+// grantedScopesKey is the session Extra key holding the optional scopes the user approved (comma-separated)
+// Forward it with the "extra.granted_scopes" path to tell the upstream which APIs it may call
+const grantedScopesKey = "granted_scopes"
+
+// optionalScopes returns the optional scopes of the OAuth2 provider
+func (m *Middleware) optionalScopes(providerName string) []config.OptionalScope {
+	for _, p := range m.config.OAuth2.Providers {
+		if p.ID == providerName {
+			return p.OptionalScopes
+		}
+	}
+	return nil
+}
+
+// consentScopes returns the optional scopes the visitor approved for the provider, from the consent
+// form (POST) or the choice of a previous sign-in. When the visitor has not decided on every optional
+// scope yet, or asked with ?consent=1, it shows the consent step instead and reports false.
+func (m *Middleware) consentScopes(w http.ResponseWriter, r *http.Request, providerName string) ([]string, bool) {
+	optional := m.optionalScopes(providerName)
+	if len(optional) == 0 {
+		return nil, true
+	}
+
+	if r.Method == http.MethodPost {
+		_ = r.ParseForm()
+		chosen := make(map[string]bool)
+		if r.PostForm.Get("skip") == "" {
+			for _, scope := range r.PostForm["scope"] {
+				chosen[scope] = true
+			}
+		}
+		choice := url.Values{}
+		for _, scope := range optional {
+			if chosen[scope.Scope] {
+				choice.Add("approved", scope.Scope)
+			} else {
+				choice.Add("declined", scope.Scope)
+			}
+		}
+		m.setScopeConsentCookie(w, providerName, choice)
+		return choice["approved"], true
+	}
+
+	choice := m.scopeConsentChoice(r, providerName)
+	if r.URL.Query().Get(scopeConsentQuery) == "" && decidedAll(choice, optional) {
+		return approvedScopes(choice, optional), true
+	}
+	m.handleScopeConsent(w, r, providerName, optional, choice)
+	return nil, false
+}
+
+// scopeConsentChoice returns the choice of the provider's consent cookie (empty without cookie)
+func (m *Middleware) scopeConsentChoice(r *http.Request, providerName string) url.Values {
+	cookie, err := r.Cookie(scopeConsentCookiePrefix + providerName)
+	if err != nil {
+		return url.Values{}
+	}
+	choice, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		return url.Values{}
+	}
+	return choice
+}
+
+// setScopeConsentCookie remembers the choice of the consent step
+func (m *Middleware) setScopeConsentCookie(w http.ResponseWriter, providerName string, choice url.Values) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     scopeConsentCookiePrefix + providerName,
+		Value:    choice.Encode(),
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
+		MaxAge:   int(scopeConsentCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// decidedAll reports whether the choice approves or declines every optional scope
+// Scopes added to the configuration since the choice bring the consent step back.
+func decidedAll(choice url.Values, optional []config.OptionalScope) bool {
+	decided := make(map[string]bool)
+	for _, key := range []string{"approved", "declined"} {
+		for _, scope := range choice[key] {
+			decided[scope] = true
+		}
+	}
+	for _, scope := range optional {
+		if !decided[scope.Scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// approvedScopes returns the optional scopes the choice approves, in configuration order
+// Scopes removed from the configuration since the choice are never requested.
+func approvedScopes(choice url.Values, optional []config.OptionalScope) []string {
+	approved := make(map[string]bool)
+	for _, scope := range choice["approved"] {
+		approved[scope] = true
+	}
+	var scopes []string
+	for _, scope := range optional {
+		if approved[scope.Scope] {
+			scopes = append(scopes, scope.Scope)
+		}
+	}
+	return scopes
+}
+
+// grantedScopes returns the optional scopes the user approved for this sign-in, without those
+// the provider did not grant when its token response lists the granted scopes (the "scope" parameter)
+func (m *Middleware) grantedScopes(r *http.Request, providerName, granted string) []string {
+	optional := m.optionalScopes(providerName)
+	if len(optional) == 0 {
+		return nil
+	}
+	return keepGranted(approvedScopes(m.scopeConsentChoice(r, providerName), optional), granted)
+}
+
+// keepGranted returns the scopes listed in granted, the space-separated scopes of a token response
+// (all of them when the provider does not list the granted scopes)
+func keepGranted(scopes []string, granted string) []string {
+	if granted == "" {
+		return scopes
+	}
+	grantedSet := make(map[string]bool)
+	for _, scope := range strings.Fields(granted) {
+		grantedSet[scope] = true
+	}
+	var kept []string
+	for _, scope := range scopes {
+		if grantedSet[scope] {
+			kept = append(kept, scope)
+		}
+	}
+	return kept
+}
+
+// handleScopeConsent displays the consent step of the provider's optional scopes
+func (m *Middleware) handleScopeConsent(w http.ResponseWriter, r *http.Request, providerName string, optional []config.OptionalScope, choice url.Values) {
+	lang := i18n.DetectLanguage(r)
+	theme := i18n.DetectTheme(r)
+	t := func(key string) string { return m.translator.T(lang, key) }
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+
+	label := providerName
+	for _, p := range m.config.OAuth2.Providers {
+		if p.ID == providerName && p.DisplayName != "" {
+			label = p.DisplayName
+		}
+	}
+
+	approved := make(map[string]bool)
+	for _, scope := range choice["approved"] {
+		approved[scope] = true
+	}
+	scopes := make([]ConsentScopeData, len(optional))
+	for i, scope := range optional {
+		scopes[i] = ConsentScopeData{Scope: scope.Scope, Description: scope.GetDescription(), Approved: approved[scope.Scope]}
+	}
+
+	// Build page data
+	pageData := m.buildPageData(lang, theme, config.PageScopeConsent, "consent.title")
+	pageData.Subtitle = t("consent.heading")
+
+	data := ScopeConsentPageData{
+		PageData:      pageData,
+		Message:       t("consent.message"),
+		FormPath:      withLanguageQuery(joinAuthPath(prefix, "/oauth2/start/"+providerName), r),
+		Scopes:        scopes,
+		ContinueLabel: fmt.Sprintf(t("login.oauth2.continue"), label),
+		SkipLabel:     t("consent.skip"),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Render template
+	if err := renderTemplate(w, m.templates.scopeConsent, data, m); err != nil {
+		m.logger.Error("Failed to render scope consent template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// newScopeConsentTestMiddleware returns a middleware whose google provider has two optional scopes
+func newScopeConsentTestMiddleware(t *testing.T) (*Middleware, *mockOAuth2Provider) {
+	t.Helper()
+
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{
+		ID:          "google",
+		Type:        "google",
+		DisplayName: "Google",
+		OptionalScopes: []config.OptionalScope{
+			{Scope: "calendar", Description: "Read your calendar"},
+			{Scope: "drive"},
+		},
+	}}
+	mw, _ := newTestMiddleware(t, cfg)
+	mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+	t.Cleanup(mockProvider.Close)
+	mw.oauthManager.AddProvider(mockProvider)
+	return mw, mockProvider
+}
+
+// requestedScopes returns the scopes of the authorization URL the response redirects to
+func requestedScopes(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Status = %d, want a redirect to the provider", rec.Code)
+	}
+	u, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("scope")
+}
+
+// consentCookie returns the choice cookie set by the response
+func consentCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == scopeConsentCookiePrefix+"google" {
+			return c
+		}
+	}
+	t.Fatal("Choice cookie not set")
+	return nil
+}
+
+func TestScopeConsent_Step(t *testing.T) {
+	mw, _ := newScopeConsentTestMiddleware(t)
+
+	// Without a choice, the consent step is shown instead of the redirect
+	rec := httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want the consent step", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`action="/_auth/oauth2/start/google"`, `value="calendar"`, "Read your calendar", `value="drive"`, "Continue with Google"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Consent step should contain %q", want)
+		}
+	}
+	if strings.Contains(body, "checked") {
+		t.Error("No scope should be approved in advance")
+	}
+
+	// Approving calendar requests it, and remembers the choice
+	form := url.Values{"scope": {"calendar", "unknown"}}
+	req := httptest.NewRequest(http.MethodPost, "/_auth/oauth2/start/google", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, req)
+	if got := requestedScopes(t, rec); got != "openid email profile calendar" {
+		t.Errorf("scope = %q, want the approved scope only", got)
+	}
+	choice := consentCookie(t, rec)
+
+	// Later sign-ins skip the step
+	req = httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil)
+	req.AddCookie(choice)
+	rec = httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, req)
+	if got := requestedScopes(t, rec); got != "openid email profile calendar" {
+		t.Errorf("scope = %q, want the remembered choice", got)
+	}
+
+	// ?consent=1 shows the step again with the choice
+	req = httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google?consent=1", nil)
+	req.AddCookie(choice)
+	rec = httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="calendar" checked`) {
+		t.Errorf("Status = %d, want the consent step with calendar approved", rec.Code)
+	}
+
+	// Skipping requests the provider's scopes only
+	form = url.Values{"scope": {"calendar"}, "skip": {"1"}}
+	req = httptest.NewRequest(http.MethodPost, "/_auth/oauth2/start/google", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, req)
+	if got := requestedScopes(t, rec); got != "openid email profile" {
+		t.Errorf("scope = %q, want no optional scope", got)
+	}
+
+	// A scope added to the configuration brings the step back
+	mw.config.OAuth2.Providers[0].OptionalScopes = append(mw.config.OAuth2.Providers[0].OptionalScopes, config.OptionalScope{Scope: "contacts"})
+	req = httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil)
+	req.AddCookie(choice)
+	rec = httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status = %d, want the consent step for the new scope", rec.Code)
+	}
+}
+
+func TestScopeConsent_WithoutOptionalScopes(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "google", Type: "google"}}
+	mw, _ := newTestMiddleware(t, cfg)
+	mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+	defer mockProvider.Close()
+	mw.oauthManager.AddProvider(mockProvider)
+
+	rec := httptest.NewRecorder()
+	mw.handleOAuth2Start(rec, httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil))
+	if got := requestedScopes(t, rec); got != "openid email profile" {
+		t.Errorf("scope = %q, want the provider's scopes", got)
+	}
+}
+
+func TestScopeConsent_GrantedScopesInSession(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokenResponse string
+		want          string
+	}{
+		{"granted scopes not listed", `{"access_token":"mock-access-token","token_type":"Bearer"}`, "calendar,drive"},
+		{"drive not granted", `{"access_token":"mock-access-token","token_type":"Bearer","scope":"openid email calendar"}`, "calendar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, mockProvider := newScopeConsentTestMiddleware(t)
+			mw.authzChecker = authz.NewEmailChecker(mw.config.AccessControl)
+			mockProvider.tokenServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.tokenResponse))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?state=test-state&code=test-auth-code", nil)
+			req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+			req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+			req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+			req.AddCookie(&http.Cookie{Name: scopeConsentCookiePrefix + "google", Value: "approved=calendar&approved=drive"})
+			rec := httptest.NewRecorder()
+			mw.handleOAuth2Callback(rec, req)
+
+			if rec.Code != http.StatusFound {
+				t.Fatalf("Status = %d, want %d", rec.Code, http.StatusFound)
+			}
+			var sessionID string
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "_test_session" {
+					sessionID = c.Value
+				}
+			}
+			sess, err := session.Get(mw.sessionStore, sessionID)
+			if err != nil {
+				t.Fatalf("session.Get() error = %v", err)
+			}
+			if got := sess.Extra[grantedScopesKey]; got != tt.want {
+				t.Errorf("Extra[%q] = %v, want %q", grantedScopesKey, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	stdoauth2 "golang.org/x/oauth2"
+)
+
+// scopeUpgradeCookieName marks an authorization code flow as a scope upgrade of the signed-in session,
+// holding the requested scopes ("scope=<scope>&scope=<scope>")
+const scopeUpgradeCookieName = "oauth_upgrade"
+
+// handleOAuth2Upgrade requests optional scopes of the provider the user signed in with, without signing out
+// (GET /_auth/oauth2/upgrade/{provider}?scopes=<scope>,<scope>&rd=<path>)
+// The provider flow is run again with the scopes granted so far and the requested ones; the callback
+// merges the result into the existing session and redirects to rd.
+func (m *Middleware) handleOAuth2Upgrade(w http.ResponseWriter, r *http.Request) {
+	prefix := m.config.Server.GetAuthPathPrefix()
+	providerName := extractPathParam(r.URL.Path, joinAuthPath(prefix, "/oauth2/upgrade/"))
+
+	if !m.isAuthMethodEnabled(providerName) {
+		m.logger.Warn("Scope upgrade attempted with disabled provider", "provider", providerName)
+		http.Error(w, "Provider is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	sess, ok := m.lookupSession(r)
+	if !ok {
+		// Coming back here after signing in
+		m.redirectToLogin(w, r)
+		return
+	}
+	if sess.Provider != providerName {
+		http.Error(w, "Scopes can only be added for the provider you signed in with", http.StatusBadRequest)
+		return
+	}
+
+	optional := m.optionalScopes(providerName)
+	requested := strings.FieldsFunc(r.URL.Query().Get("scopes"), func(c rune) bool { return c == ',' || c == ' ' })
+	if len(requested) == 0 {
+		http.Error(w, "No scopes requested", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range requested {
+		if !isOptionalScope(optional, scope) {
+			http.Error(w, "Scope is not an optional scope of the provider: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if rd := r.URL.Query().Get("rd"); rd != "" && m.allowsRedirectTarget(rd) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     redirectCookieName,
+			Value:    rd,
+			Path:     m.config.Server.GetCookiePath(),
+			MaxAge:   600, // 10 minutes - enough time to complete authentication
+			HttpOnly: true,
+			Secure:   m.config.Session.Cookie.Secure,
+			SameSite: m.config.Session.Cookie.GetSameSite(),
+		})
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     scopeUpgradeCookieName,
+		Value:    url.Values{"scope": requested}.Encode(),
+		Path:     m.config.Server.GetCookiePath(),
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: m.config.Session.Cookie.GetSameSite(),
+	})
+
+	// A new token carries only the scopes of its request: ask again for those granted so far
+	scopes := approvedScopes(url.Values{"approved": append(sessionList(sess, grantedScopesKey), requested...)}, optional)
+	m.logger.Debug("Starting scope upgrade", "provider", providerName, "scopes", scopes)
+	m.redirectToProvider(w, r, providerName, scopes)
+}
+
+// isOptionalScope reports whether scope is one of the optional scopes
+func isOptionalScope(optional []config.OptionalScope, scope string) bool {
+	for _, s := range optional {
+		if s.Scope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// completeScopeUpgrade merges the token of a scope upgrade into the signed-in session (the callback of
+// handleOAuth2Upgrade): the granted optional scopes and the provider session are updated, the rest of
+// the session is kept. The provider must have authenticated the same user.
+func (m *Middleware) completeScopeUpgrade(w http.ResponseWriter, r *http.Request, providerName, upgrade string, token *stdoauth2.Token, userInfo *oauth2.UserInfo) {
+	m.clearOAuthCookies(w)
+
+	// The session ended meanwhile: sign in again
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	var sess *session.Session
+	ok := err == nil
+	if ok {
+		sess, ok = m.activeSession(cookie.Value)
+	}
+	if !ok || sess.Provider != providerName {
+		http.Redirect(w, r, joinAuthPath(m.config.Server.GetPublicAuthPathPrefix(), "/login"), http.StatusFound)
+		return
+	}
+
+	subject, providerSID := oauth2.SessionClaims(token)
+	var email string
+	if userInfo != nil {
+		email = userInfo.Email
+		if subject == "" {
+			subject, _ = userInfo.Extra["sub"].(string)
+		}
+	}
+	if !sameUser(sess, subject, m.sessionEmail(email)) {
+		m.logger.Warn("Scope upgrade denied: provider authenticated another user", "provider", providerName, "email", m.logEmail(email))
+		m.handleForbidden(w, r)
+		return
+	}
+
+	// The new token defines the granted scopes: drop those the user declined at the provider this time
+	requested, _ := url.ParseQuery(upgrade)
+	optional := m.optionalScopes(providerName)
+	granted, _ := token.Extra("scope").(string)
+	scopes := keepGranted(approvedScopes(url.Values{"approved": append(sessionList(sess, grantedScopesKey), requested["scope"]...)}, optional), granted)
+
+	if sess.Extra == nil {
+		sess.Extra = make(map[string]interface{})
+	}
+	if len(scopes) > 0 {
+		sess.Extra[grantedScopesKey] = strings.Join(scopes, ",")
+	} else {
+		delete(sess.Extra, grantedScopesKey)
+	}
+	if providerSID != "" {
+		sess.ProviderSID = providerSID
+	}
+	if sess.Subject == "" {
+		sess.Subject = subject
+	}
+	if sess.ProviderToken != "" {
+		// The new access token carries the added scopes
+		if token.RefreshToken == "" {
+			if kept := m.openProviderToken(sess); kept != nil {
+				token.RefreshToken = kept.RefreshToken
+			}
+		}
+		if err := m.sealProviderToken(sess, token); err != nil {
+			m.logger.Error("Failed to keep provider token", "provider", providerName, "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := session.SetAt(m.sessionStore, cookie.Value, sess, m.clock.Now()); err != nil {
+		m.logger.Error("Failed to store upgraded session", "provider", providerName, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Later sign-ins request the scopes too
+	approved := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		approved[scope] = true
+	}
+	choice := url.Values{}
+	for _, scope := range optional {
+		if approved[scope.Scope] {
+			choice.Add("approved", scope.Scope)
+		} else {
+			choice.Add("declined", scope.Scope)
+		}
+	}
+	m.setScopeConsentCookie(w, providerName, choice)
+
+	m.logger.Info("OAuth2 scopes upgraded", "email", m.logEmail(sess.Email), "provider", providerName, "scopes", scopes)
+	http.Redirect(w, r, m.publicPath(m.getRedirectURL(w, r)), http.StatusFound)
+}
+
+// sameUser reports whether the provider authenticated the user of the session: by subject when
+// both have one, by email otherwise
+func sameUser(sess *session.Session, subject, email string) bool {
+	if sess.Subject != "" && subject != "" {
+		return sess.Subject == subject
+	}
+	return email != "" && strings.EqualFold(sess.Email, email)
+}
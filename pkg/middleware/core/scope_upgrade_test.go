@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/authz"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// storeUpgradeTestSession stores a google session that was granted calendar
+func storeUpgradeTestSession(t *testing.T, mw *Middleware, email string) string {
+	t.Helper()
+
+	sessionID := storeTestSession(t, mw.sessionStore, email)
+	sess, err := session.Get(mw.sessionStore, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Extra = map[string]interface{}{grantedScopesKey: "calendar", "locale": "en"}
+	if err := session.Set(mw.sessionStore, sessionID, sess); err != nil {
+		t.Fatal(err)
+	}
+	return sessionID
+}
+
+func TestScopeUpgrade_Start(t *testing.T) {
+	mw, _ := newScopeConsentTestMiddleware(t)
+	sessionID := storeUpgradeTestSession(t, mw, "user@example.com")
+
+	serve := func(target string, withSession bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if withSession {
+			req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+		}
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The flow requests the scopes granted so far and the new ones
+	rec := serve("/_auth/oauth2/upgrade/google?scopes=drive&rd=/chat", true)
+	if got := requestedScopes(t, rec); got != "openid email profile calendar drive" {
+		t.Errorf("scope = %q, want the granted and requested scopes", got)
+	}
+	cookies := map[string]string{}
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c.Value
+	}
+	if cookies[scopeUpgradeCookieName] != "scope=drive" || cookies[redirectCookieName] != "/chat" {
+		t.Errorf("Cookies = %v, want the upgrade and the return target", cookies)
+	}
+
+	// Only optional scopes of the session's provider can be requested
+	for _, target := range []string{"/_auth/oauth2/upgrade/google?scopes=admin", "/_auth/oauth2/upgrade/google"} {
+		if rec := serve(target, true); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: Status = %d, want 400", target, rec.Code)
+		}
+	}
+
+	// Visitors without session sign in first
+	if rec := serve("/_auth/oauth2/upgrade/google?scopes=drive", false); rec.Code != http.StatusFound || rec.Header().Get("Location") == "" {
+		t.Errorf("Status = %d, want a redirect to the login page", rec.Code)
+	}
+}
+
+func TestScopeUpgrade_Callback(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         string
+		tokenResponse string
+		wantStatus    int
+		wantScopes    interface{}
+	}{
+		{"scopes merged", "user@example.com", `{"access_token":"t","token_type":"Bearer"}`, http.StatusFound, "calendar,drive"},
+		{"declined at the provider", "user@example.com", `{"access_token":"t","token_type":"Bearer","scope":"openid drive"}`, http.StatusFound, "drive"},
+		{"another user", "other@example.com", `{"access_token":"t","token_type":"Bearer"}`, http.StatusForbidden, "calendar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, mockProvider := newScopeConsentTestMiddleware(t)
+			mw.authzChecker = authz.NewEmailChecker(mw.config.AccessControl)
+			mockProvider.emailToReturn = tt.email
+			mockProvider.tokenServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.tokenResponse))
+			})
+			sessionID := storeUpgradeTestSession(t, mw, "user@example.com")
+
+			req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/callback?state=test-state&code=test-auth-code", nil)
+			req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "test-state"})
+			req.AddCookie(&http.Cookie{Name: "oauth_provider", Value: "google"})
+			req.AddCookie(&http.Cookie{Name: "oauth_redirect_url", Value: "https://example.com/_auth/oauth2/callback"})
+			req.AddCookie(&http.Cookie{Name: scopeUpgradeCookieName, Value: "scope=drive"})
+			req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: "/chat"})
+			req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+			rec := httptest.NewRecorder()
+			mw.handleOAuth2Callback(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "_test_session" {
+					t.Error("The session should be kept, not replaced")
+				}
+			}
+
+			sess, err := session.Get(mw.sessionStore, sessionID)
+			if err != nil {
+				t.Fatalf("The session should still exist: %v", err)
+			}
+			if sess.Extra[grantedScopesKey] != tt.wantScopes || sess.Extra["locale"] != "en" {
+				t.Errorf("Extra = %v, want granted_scopes %v and the other data kept", sess.Extra, tt.wantScopes)
+			}
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+			if location := rec.Header().Get("Location"); location != "/chat" {
+				t.Errorf("Location = %q, want the return target", location)
+			}
+			var choice string
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == scopeConsentCookiePrefix+"google" {
+					choice = c.Value
+				}
+			}
+			if values, _ := url.ParseQuery(choice); len(values["approved"]) == 0 {
+				t.Errorf("Choice cookie = %q, want the granted scopes approved", choice)
+			}
+		})
+	}
+}
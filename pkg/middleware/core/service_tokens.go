@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// serviceProvider is the X-Auth-Provider of requests of internal callers with a service token
+const serviceProvider = "service"
+
+// serveServiceCaller passes requests of internal callers with a service token through to the upstream
+// Returns false when the request carries no service credential, so that the session is checked as usual.
+// Every request of a service caller is logged, including the ones rejected outside its paths.
+func (m *Middleware) serveServiceCaller(w http.ResponseWriter, r *http.Request) bool {
+	caller, credential := m.serviceCaller(r)
+	if caller == nil {
+		return false
+	}
+
+	if scope := m.serviceScopes[caller.Name]; scope == nil || !scope.Allows(r.Method, r.URL) {
+		m.logger.Warn("Service token request denied", "service", caller.Name, "auth_method", credential,
+			"method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		http.Error(w, "Access Denied", http.StatusForbidden)
+		return true
+	}
+	m.logger.Info("Service token request", "service", caller.Name, "auth_method", credential,
+		"method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+
+	// The upstream sees the caller instead of the gate's credential or spoofed identity headers
+	m.stripAuthHeaders(r)
+	if credential == "token" {
+		r.Header.Del("Authorization")
+	}
+	r.Header.Set("X-Authenticated", "true")
+	r.Header.Set("X-Auth-Provider", serviceProvider)
+	r.Header.Set("X-Auth-Service", caller.Name)
+
+	if m.next != nil {
+		m.serveNext(w, r, nil, true)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Authenticated"))
+	}
+	return true
+}
+
+// newServiceScopes compiles the scopes of the service tokens, by name
+// Tokens whose paths fail to compile (rejected by config validation) have no scope and are always denied.
+func newServiceScopes(tokens []config.ServiceTokenConfig) map[string]*config.ServiceTokenScope {
+	scopes := make(map[string]*config.ServiceTokenScope, len(tokens))
+	for _, t := range tokens {
+		if scope, err := t.Scope(); err == nil {
+			scopes[t.Name] = scope
+		}
+	}
+	return scopes
+}
+
+// serviceCaller returns the service token the request authenticates with, and its kind ("token" or "client_cert")
+// Bearer tokens are compared in constant time with every configured token. Client certificates
+// only count when the TLS server verified them against its client CAs.
+func (m *Middleware) serviceCaller(r *http.Request) (*config.ServiceTokenConfig, string) {
+	tokens := m.config.ServiceTokens
+	if len(tokens) == 0 {
+		return nil, ""
+	}
+
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && bearer != "" {
+		var match *config.ServiceTokenConfig
+		for i := range tokens {
+			if tokens[i].Token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(tokens[i].Token)) == 1 {
+				match = &tokens[i]
+			}
+		}
+		if match != nil {
+			return match, "token"
+		}
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		for i := range tokens {
+			subject := tokens[i].ClientCertSubject
+			if subject == "" {
+				continue
+			}
+			if cert.Subject.CommonName == subject {
+				return &tokens[i], "client_cert"
+			}
+			for _, name := range cert.DNSNames {
+				if strings.EqualFold(name, subject) {
+					return &tokens[i], "client_cert"
+				}
+			}
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+const testServiceToken = "service-token-with-at-least-32-characters"
+
+func TestServiceTokens(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ServiceTokens = []config.ServiceTokenConfig{
+		{Name: "monitor", Token: testServiceToken, Paths: []string{"/api/health"}, Methods: []string{"GET"}},
+		{Name: "cron", ClientCertSubject: "cron.internal", Paths: []string{"/api/reports/**"}},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	var upstream http.Header
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	clientCert := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}}
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		tls         *tls.ConnectionState
+		wantStatus  int
+		wantService string
+	}{
+		{"token on its path", http.MethodGet, "/api/health", testServiceToken, nil, http.StatusOK, "monitor"},
+		{"token with another method", http.MethodPost, "/api/health", testServiceToken, nil, http.StatusForbidden, ""},
+		{"token outside its paths", http.MethodGet, "/chat", testServiceToken, nil, http.StatusForbidden, ""},
+		{"dot segments out of its paths", http.MethodGet, "/api/reports/../admin", "", clientCert("cron.internal"), http.StatusForbidden, ""},
+		{"unknown token", http.MethodGet, "/api/health", "unknown-token", nil, http.StatusFound, ""},
+		{"client certificate", http.MethodPost, "/api/reports/daily", "", clientCert("cron.internal"), http.StatusOK, "cron"},
+		{"unverified client certificate", http.MethodPost, "/api/reports/daily", "", &tls.ConnectionState{}, http.StatusFound, ""},
+		{"other client certificate", http.MethodPost, "/api/reports/daily", "", clientCert("other.internal"), http.StatusFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream = nil
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.TLS = tt.tls
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req.Header.Set("X-Auth-Service", "spoofed")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantService == "" {
+				return
+			}
+			if upstream.Get("X-Auth-Service") != tt.wantService || upstream.Get("X-Auth-Provider") != serviceProvider {
+				t.Errorf("Upstream headers = %v, want service %q", upstream, tt.wantService)
+			}
+			if upstream.Get("Authorization") != "" {
+				t.Error("The service token must not reach the upstream")
+			}
+		})
+	}
+}
+
+func TestServiceTokens_AuditLogScrubbed(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ServiceTokens = []config.ServiceTokenConfig{
+		{Name: "monitor", Token: testServiceToken, Paths: []string{"/api/health"}},
+		{Name: "cron", ClientCertSubject: "cron.internal", Paths: []string{"/api/reports/**"}},
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+	var buf bytes.Buffer
+	mw.logger = logging.NewScrubbingLogger(logging.NewSimpleLoggerWithWriter("middleware", logging.LevelDebug, false, &buf), logging.Scrubber{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Authorization", "Bearer "+testServiceToken)
+	mw.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/api/reports/daily", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "cron.internal"}}}}}
+	mw.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The audit trail tells bearer token callers from client certificate callers
+	output := buf.String()
+	for _, want := range []string{"auth_method=token", "auth_method=client_cert"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Audit log lacks %q: %s", want, output)
+		}
+	}
+	if strings.Contains(output, testServiceToken) {
+		t.Errorf("Audit log contains the service token: %s", output)
+	}
+}
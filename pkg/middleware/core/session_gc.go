@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/password"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// sessionGCJob is the name of the session garbage collection job
+const sessionGCJob = "session-gc"
+
+// SessionGCStats reports the session garbage collection runs of this instance
+// Only the job leader runs it: the other instances report no runs.
+type SessionGCStats struct {
+	Runs           int       `json:"runs"`
+	LastRun        time.Time `json:"last_run,omitempty"`
+	LastScanned    int       `json:"last_scanned"`   // Session records read by the last run
+	LastReclaimed  int       `json:"last_reclaimed"` // Expired session records deleted by the last run
+	TotalReclaimed int       `json:"total_reclaimed"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// SessionGCStats returns the session garbage collection stats of this instance
+func (m *Middleware) SessionGCStats() SessionGCStats {
+	m.sessionGCMu.Lock()
+	defer m.sessionGCMu.Unlock()
+	return m.sessionGC
+}
+
+// collectSessions deletes the expired session records of the session KVS (session.gc)
+// Records are read in batches of session.gc.batch_size, stopping between batches when ctx is done.
+// Keys that are not session records (see isSessionKey) are left alone.
+func (m *Middleware) collectSessions(ctx context.Context) error {
+	started := m.clock.Now()
+	scanned, reclaimed, err := m.sweepSessions(ctx, started)
+
+	m.sessionGCMu.Lock()
+	m.sessionGC.Runs++
+	m.sessionGC.LastRun = started
+	m.sessionGC.LastScanned = scanned
+	m.sessionGC.LastReclaimed = reclaimed
+	m.sessionGC.TotalReclaimed += reclaimed
+	m.sessionGC.LastError = ""
+	if err != nil {
+		m.sessionGC.LastError = err.Error()
+	}
+	m.sessionGCMu.Unlock()
+
+	m.logger.Info("Session GC finished", "scanned", scanned, "reclaimed", reclaimed, "duration", time.Since(started))
+	return err
+}
+
+// sweepSessions deletes the session records expired at now and returns the numbers of read and deleted records
+func (m *Middleware) sweepSessions(ctx context.Context, now time.Time) (scanned, reclaimed int, err error) {
+	// Read past the cache, so the scan does not evict the sessions in use
+	store := kvs.Uncached(m.sessionStore)
+	keys, err := store.List(ctx, "")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	batchSize := m.config.Session.GC.GetBatchSize()
+	for i, key := range keys {
+		if i > 0 && i%batchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return scanned, reclaimed, err
+			}
+		}
+		if !isSessionKey(key) {
+			continue
+		}
+
+		data, err := store.Get(ctx, key)
+		if errors.Is(err, kvs.ErrNotFound) {
+			continue // Expired and removed by the store itself
+		} else if err != nil {
+			return scanned, reclaimed, err
+		}
+		scanned++
+
+		var sess session.Session
+		if err := json.Unmarshal(data, &sess); err != nil || sess.IsValidAt(now) {
+			continue
+		}
+		// Through the cache, so that it forgets the session too
+		if err := session.Delete(m.sessionStore, key); err != nil {
+			return scanned, reclaimed, err
+		}
+		reclaimed++
+	}
+	return scanned, reclaimed, nil
+}
+
+// sessionIDLength is the length of the IDs of generateSessionID (base64 of 32 bytes)
+const sessionIDLength = 44
+
+// isSessionKey reports whether a key of the session KVS is a session ID, so that the keys of
+// job leases, stats, tokens and IdP records kept in the same store, including future ones, are left alone
+// Session IDs are those of generateSessionID and of password sessions ("pwd_" and a timestamp).
+func isSessionKey(key string) bool {
+	if digits, ok := strings.CutPrefix(key, password.SessionIDPrefix); ok {
+		_, err := strconv.ParseUint(digits, 10, 64)
+		return err == nil
+	}
+	if len(key) != sessionIDLength {
+		return false
+	}
+	id, err := base64.URLEncoding.DecodeString(key)
+	return err == nil && len(id) == 32
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+func TestSessionGC(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Session.GC.Enabled = true
+	cfg.Session.GC.BatchSize = 1
+	mw, store := newTestMiddleware(t, cfg)
+	mw.SetReady()
+
+	now := time.Now()
+	fake := clock.NewFake(now)
+	mw.SetClock(fake)
+
+	ids := map[string]string{}
+	for name, expiresIn := range map[string]time.Duration{"short": time.Minute, "long": 24 * time.Hour} {
+		id, _ := generateSessionID()
+		ids[name] = id
+		if err := session.Set(store, id, &session.Session{
+			ID:            id,
+			Email:         name + "@example.com",
+			CreatedAt:     now,
+			ExpiresAt:     now.Add(expiresIn),
+			Authenticated: true,
+		}); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	ctx := context.Background()
+	if err := store.Set(ctx, "jobs:leader", []byte("instance"), time.Hour); err != nil {
+		t.Fatalf("Failed to set job key: %v", err)
+	}
+	if err := store.Set(ctx, loginStatsKeyPrefix+"2026-01-01:google:instance", []byte(`{"logins":1}`), time.Hour); err != nil {
+		t.Fatalf("Failed to set login stats key: %v", err)
+	}
+	if err := store.Set(ctx, "not-a-session", []byte("{"), time.Hour); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	invalidID, _ := generateSessionID()
+	if err := store.Set(ctx, invalidID, []byte("{"), time.Hour); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	// The short session expired by the middleware's clock, but is still in the store
+	fake.Advance(time.Hour)
+	if err := mw.collectSessions(ctx); err != nil {
+		t.Fatalf("collectSessions() error = %v", err)
+	}
+
+	for key, want := range map[string]bool{ids["short"]: false, ids["long"]: true, invalidID: true, "jobs:leader": true, loginStatsKeyPrefix + "2026-01-01:google:instance": true, "not-a-session": true} {
+		if exists, _ := store.Exists(ctx, key); exists != want {
+			t.Errorf("%s exists = %v, want %v", key, exists, want)
+		}
+	}
+
+	stats := mw.SessionGCStats()
+	if stats.Runs != 1 || stats.LastScanned != 3 || stats.LastReclaimed != 1 || stats.TotalReclaimed != 1 {
+		t.Errorf("SessionGCStats() = %+v, want 1 run scanning 3 and reclaiming 1 record", stats)
+	}
+
+	code, response := readiness(t, mw)
+	if code != http.StatusOK || response.SessionGC == nil || response.SessionGC.TotalReclaimed != 1 {
+		t.Errorf("readiness = %d %+v, want the session GC stats", code, response.SessionGC)
+	}
+
+	if _, statuses := mw.JobStatuses(); len(statuses) != 1 || statuses[0].Name != sessionGCJob || statuses[0].Interval != "1h0m0s" {
+		t.Errorf("JobStatuses() = %+v, want the session GC job", statuses)
+	}
+}
+
+func TestSessionGC_Canceled(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Session.GC.Enabled = true
+	cfg.Session.GC.BatchSize = 1
+	mw, store := newTestMiddleware(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		id, _ := generateSessionID()
+		if err := store.Set(context.Background(), id, []byte("{}"), time.Hour); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mw.collectSessions(ctx); err == nil {
+		t.Error("collectSessions() should stop between batches when the context is canceled")
+	}
+	if stats := mw.SessionGCStats(); stats.LastError == "" || stats.LastScanned != 1 {
+		t.Errorf("SessionGCStats() = %+v, want the error after the first batch", stats)
+	}
+}
+
+func TestIsSessionKey(t *testing.T) {
+	id, _ := generateSessionID()
+	for key, want := range map[string]bool{
+		id:                            true,
+		"pwd_1767225600000000000":     true,
+		"pwd_":                        false,
+		"jobs:leader":                 false,
+		providerTokenLeasePrefix + id: false,
+		"future-prefix:" + id:         false,
+		strings.Repeat("!", len(id)):  false,
+	} {
+		if got := isSessionKey(key); got != want {
+			t.Errorf("isSessionKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
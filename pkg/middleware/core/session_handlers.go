@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// handleSessionCheck reports whether the request carries a valid session (/_auth/session/check)
+// Returns 204 No Content when authenticated and 401 Unauthorized otherwise, never redirecting.
+// Embedded chat widgets call this cross-origin (with credentials) to decide whether to show
+// a sign-in prompt before opening the chat iframe, so CORS headers are set for allowed origins.
+func (m *Middleware) handleSessionCheck(w http.ResponseWriter, r *http.Request) {
+	m.setCORSHeaders(w, r)
+
+	// The response depends on the session cookie and must never be cached
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		// Handled below
+	case http.MethodOptions:
+		// CORS preflight
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := m.lookupSession(r); !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setCORSHeaders adds credentialed CORS headers when the request Origin is allowed by configuration
+// The Origin is echoed back (never "*") because browsers reject wildcards for credentialed requests
+func (m *Middleware) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	// Responses differ per Origin, so shared caches must key on it
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if !m.config.Server.IsOriginAllowed(origin) {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+}
+
+// sessionExpiresHeader carries the expiry of the session on proxied responses (session.refresh.expires_header)
+const sessionExpiresHeader = "X-ChatbotGate-Session-Expires"
+
+// sessionRefreshResponse is the body of the session refresh endpoint
+type sessionRefreshResponse struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int       `json:"expires_in"` // Seconds until the session expires
+	Refreshed bool      `json:"refreshed"`  // Whether this call extended the session
+}
+
+// handleSessionRefresh reports the expiry of the session, and extends sliding sessions (/_auth/session/refresh)
+// GET only reports the expiry; POST also extends the session when session.refresh.sliding is enabled,
+// never beyond session.refresh.max_lifetime since login. Long-running chat apps call it to keep
+// the session alive while the user is active, or to warn them before it expires.
+func (m *Middleware) handleSessionRefresh(w http.ResponseWriter, r *http.Request) {
+	m.setCORSHeaders(w, r)
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+		// Handled below
+	case http.MethodOptions:
+		// CORS preflight
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	if err != nil {
+		writeAPIJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthenticated"})
+		return
+	}
+	sess, ok := m.activeSession(cookie.Value)
+	if !ok {
+		writeAPIJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthenticated"})
+		return
+	}
+
+	now := m.clock.Now()
+	refreshed := false
+	if r.Method == http.MethodPost && m.config.Session.Refresh.Sliding {
+		if expiresAt := m.slidingExpiry(sess, now); expiresAt.After(sess.ExpiresAt) {
+			sess.ExpiresAt = expiresAt
+			if err := session.SetAt(m.sessionStore, cookie.Value, sess, now); err != nil {
+				m.logger.Error("Failed to refresh session", "error", err)
+				writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to refresh session")
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     m.config.Session.Cookie.Name,
+				Value:    cookie.Value,
+				Path:     m.config.Server.GetCookiePath(),
+				Domain:   m.config.Session.Cookie.Domain,
+				MaxAge:   int(expiresAt.Sub(now).Seconds()),
+				HttpOnly: m.config.Session.Cookie.HTTPOnly,
+				Secure:   m.config.Session.Cookie.Secure,
+				SameSite: m.config.Session.Cookie.GetSameSite(),
+			})
+			refreshed = true
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, sessionRefreshResponse{
+		ExpiresAt: sess.ExpiresAt.UTC(),
+		ExpiresIn: int(sess.ExpiresAt.Sub(now).Seconds()),
+		Refreshed: refreshed,
+	})
+}
+
+// slidingExpiry returns the expiry of sess extended from now, capped by the maximum lifetime since login
+func (m *Middleware) slidingExpiry(sess *session.Session, now time.Time) time.Time {
+	duration, err := m.config.Session.Cookie.GetExpireDuration()
+	if err != nil {
+		duration = 168 * time.Hour // Default 7 days
+	}
+	expiresAt := now.Add(duration)
+	if limit := sess.CreatedAt.Add(m.config.Session.Refresh.GetMaxLifetime()); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	return expiresAt
+}
+
+// sessionLifetime returns the longest time a session lasts since login
+func (m *Middleware) sessionLifetime() time.Duration {
+	lifetime, err := m.config.Session.Cookie.GetExpireDuration()
+	if err != nil || lifetime <= 0 {
+		lifetime = 7 * 24 * time.Hour
+	}
+	if m.config.Session.Refresh.Sliding {
+		lifetime = max(lifetime, m.config.Session.Refresh.GetMaxLifetime())
+	}
+	return lifetime
+}
@@ -0,0 +1,354 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// newTestMiddleware creates a middleware with an in-memory session store and no auth handlers
+func newTestMiddleware(t testing.TB, cfg *config.Config) (*Middleware, kvs.Store) {
+	t.Helper()
+
+	sessionStore, err := kvs.NewMemoryStore("test", kvs.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	t.Cleanup(func() { _ = sessionStore.Close() })
+
+	mw, err := New(
+		cfg,
+		sessionStore,
+		oauth2.NewManager(),
+		nil, // email handler
+		nil, // password handler
+		nil, // authz checker
+		nil, // forwarder
+		nil, // rules evaluator
+		i18n.NewTranslator(),
+		logging.NewTestLogger(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+
+	return mw, sessionStore
+}
+
+// newTestForwarder creates the forwarder of cfg, failing the test on an error
+func newTestForwarder(t testing.TB, cfg *config.ForwardingConfig) *forwarding.DefaultForwarder {
+	t.Helper()
+	forwarder, err := forwarding.NewForwarder(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewForwarder() error = %v", err)
+	}
+	return forwarder
+}
+
+// newTestConfig returns a minimal middleware configuration for handler tests
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Service: config.ServiceConfig{
+			Name: "Test Service",
+		},
+		Server: config.ServerConfig{
+			AuthPathPrefix: "/_auth",
+		},
+		Session: config.SessionConfig{
+			Cookie: config.CookieConfig{
+				Name:   "_test_session",
+				Secret: "test-secret-key-with-32-characters",
+				Expire: "1h",
+			},
+		},
+	}
+}
+
+// storeTestSession stores an authenticated session and returns its ID
+func storeTestSession(t testing.TB, store kvs.Store, email string) string {
+	t.Helper()
+
+	sessionID, err := generateSessionID()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID: %v", err)
+	}
+	sess := &session.Session{
+		ID:            sessionID,
+		Email:         email,
+		Name:          "Test User",
+		Provider:      "google",
+		Extra:         map[string]interface{}{},
+		CreatedAt:     time.Now(),
+		ExpiresAt:     time.Now().Add(time.Hour),
+		Authenticated: true,
+	}
+	if err := session.Set(store, sessionID, sess); err != nil {
+		t.Fatalf("Failed to store session: %v", err)
+	}
+	return sessionID
+}
+
+func TestSessionCheck_Status(t *testing.T) {
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	tests := []struct {
+		name       string
+		cookie     string
+		wantStatus int
+	}{
+		{name: "no cookie", cookie: "", wantStatus: http.StatusUnauthorized},
+		{name: "unknown session", cookie: "nonexistent", wantStatus: http.StatusUnauthorized},
+		{name: "valid session", cookie: sessionID, wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/_auth/session/check", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+
+			mw.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if loc := rec.Header().Get("Location"); loc != "" {
+				t.Errorf("Session check must not redirect, got Location %q", loc)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSessionCheck_ExpiredSession(t *testing.T) {
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+
+	// Store a session that is marked unauthenticated (treated as invalid)
+	sess := &session.Session{
+		ID:            "invalid-session",
+		Email:         "user@example.com",
+		CreatedAt:     time.Now(),
+		ExpiresAt:     time.Now().Add(time.Hour),
+		Authenticated: false,
+	}
+	if err := session.Set(store, sess.ID, sess); err != nil {
+		t.Fatalf("Failed to store session: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/session/check", nil)
+	req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sess.ID})
+	rec := httptest.NewRecorder()
+
+	mw.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSessionCheck_CORS(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Server.AllowedOrigins = []string{"https://widget.example.com"}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		wantOrigin string
+		wantStatus int
+	}{
+		{
+			name:       "allowed origin",
+			method:     http.MethodGet,
+			origin:     "https://widget.example.com",
+			wantOrigin: "https://widget.example.com",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "disallowed origin",
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantOrigin: "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "preflight from allowed origin",
+			method:     http.MethodOptions,
+			origin:     "https://widget.example.com",
+			wantOrigin: "https://widget.example.com",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodPost,
+			origin:     "https://widget.example.com",
+			wantOrigin: "https://widget.example.com",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/_auth/session/check", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+
+			mw.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			wantCredentials := ""
+			if tt.wantOrigin != "" {
+				wantCredentials = "true"
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, wantCredentials)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
+
+func sessionRefreshRequest(t *testing.T, mw *Middleware, method, sessionID string) (*httptest.ResponseRecorder, sessionRefreshResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/_auth/session/refresh", nil)
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+	}
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+
+	var resp sessionRefreshResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, resp
+}
+
+func TestSessionRefresh(t *testing.T) {
+	login := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(login)
+
+	cfg := newTestConfig()
+	cfg.Session.Refresh.MaxLifetime = "2h"
+	mw, store := newTestMiddleware(t, cfg)
+	mw.clock = fake
+
+	sess := &session.Session{ID: "refresh", Email: "user@example.com", Provider: "google", CreatedAt: login, ExpiresAt: login.Add(time.Hour), Authenticated: true}
+	if err := session.SetAt(store, "refresh", sess, login); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(30 * time.Minute)
+
+	// Without sliding sessions, the endpoint only reports the expiry
+	rec, resp := sessionRefreshRequest(t, mw, http.MethodPost, "refresh")
+	if rec.Code != http.StatusOK || resp.Refreshed || !resp.ExpiresAt.Equal(login.Add(time.Hour)) || resp.ExpiresIn != 1800 {
+		t.Fatalf("Without sliding: status = %d, response = %+v", rec.Code, resp)
+	}
+
+	cfg.Session.Refresh.Sliding = true
+
+	// GET never extends
+	if _, resp := sessionRefreshRequest(t, mw, http.MethodGet, "refresh"); resp.Refreshed {
+		t.Error("GET should not extend the session")
+	}
+
+	// POST extends to cookie.expire from now, and renews the cookie
+	rec, resp = sessionRefreshRequest(t, mw, http.MethodPost, "refresh")
+	if !resp.Refreshed || !resp.ExpiresAt.Equal(fake.Now().Add(time.Hour)) {
+		t.Errorf("POST response = %+v, want expiry one hour from now", resp)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "_test_session" {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != "refresh" || cookie.MaxAge != 3600 {
+		t.Errorf("Session cookie = %v, want the same session for one hour", cookie)
+	}
+	stored, err := session.GetAt(store, "refresh", fake.Now())
+	if err != nil || !stored.ExpiresAt.Equal(resp.ExpiresAt) {
+		t.Errorf("Stored session expiry = %v, want %v", stored, resp.ExpiresAt)
+	}
+
+	// Never beyond max_lifetime since login
+	fake.Advance(50 * time.Minute)
+	if _, resp := sessionRefreshRequest(t, mw, http.MethodPost, "refresh"); !resp.ExpiresAt.Equal(login.Add(2 * time.Hour)) {
+		t.Errorf("Capped expiry = %v, want %v", resp.ExpiresAt, login.Add(2*time.Hour))
+	}
+	fake.Advance(5 * time.Minute)
+	if _, resp := sessionRefreshRequest(t, mw, http.MethodPost, "refresh"); resp.Refreshed {
+		t.Error("Session at its maximum lifetime should not be extended")
+	}
+
+	fake.Set(login.Add(2 * time.Hour))
+	if rec, _ := sessionRefreshRequest(t, mw, http.MethodPost, "refresh"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expired session: status = %d, want 401", rec.Code)
+	}
+	if rec, _ := sessionRefreshRequest(t, mw, http.MethodGet, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("No session: status = %d, want 401", rec.Code)
+	}
+	if rec, _ := sessionRefreshRequest(t, mw, http.MethodDelete, "refresh"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: status = %d, want 405", rec.Code)
+	}
+}
+
+func TestSessionExpiresHeader(t *testing.T) {
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+		req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if got := request().Header().Get(sessionExpiresHeader); got != "" {
+		t.Errorf("Header = %q, want none by default", got)
+	}
+
+	cfg.Session.Refresh.ExpiresHeader = true
+	got := request().Header().Get(sessionExpiresHeader)
+	expiresAt, err := time.Parse(time.RFC3339, got)
+	if err != nil || time.Until(expiresAt) <= 0 || time.Until(expiresAt) > time.Hour {
+		t.Errorf("Header = %q, want the session expiry in RFC 3339", got)
+	}
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// sessionArchiveVersion is the format version of session archives
+const sessionArchiveVersion = 1
+
+// maxSessionArchiveBytes limits the archive uploaded to the session import endpoint
+const maxSessionArchiveBytes = 256 << 20
+
+// ErrInvalidSessionArchive is returned when a session archive cannot be decrypted or decoded,
+// e.g. because the environment that exported it has a different session.cookie.secret
+var ErrInvalidSessionArchive = errors.New("invalid session archive")
+
+// sessionArchive is the plaintext of an exported session archive
+type sessionArchive struct {
+	Version  int               `json:"version"`
+	Sessions []archivedSession `json:"sessions"`
+}
+
+// archivedSession is a session and its ID (the session cookie value)
+type archivedSession struct {
+	ID      string           `json:"id"`
+	Session *session.Session `json:"session"`
+}
+
+// SessionImport reports the result of ImportSessions
+type SessionImport struct {
+	Imported int `json:"imported"` // Sessions stored
+	Skipped  int `json:"skipped"`  // Sessions expired since the export, or whose ID already exists
+}
+
+// sessionArchiveEncryptor returns the encryptor of session archives
+// The key is the cookie secret: environments sharing session cookies must share it anyway.
+func (m *Middleware) sessionArchiveEncryptor() *forwarding.Encryptor {
+	return forwarding.NewEncryptor("session-archive:" + m.config.Session.Cookie.Secret)
+}
+
+// ExportSessions returns the live sessions of the session KVS as an AES-256-GCM encrypted archive,
+// for ImportSessions of an environment with the same session.cookie.secret (blue-green cutovers
+// without a shared KVS). Returns the archive and the number of sessions in it.
+func (m *Middleware) ExportSessions(ctx context.Context) ([]byte, int, error) {
+	store := kvs.Uncached(m.sessionStore)
+	keys, err := store.List(ctx, "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := m.clock.Now()
+	archive := sessionArchive{Version: sessionArchiveVersion, Sessions: []archivedSession{}}
+	for _, key := range keys {
+		if !isSessionKey(key) {
+			continue
+		}
+		sess, err := session.GetAt(store, key, now)
+		if err != nil || m.isSessionRevoked(sess) {
+			// Skip expired and revoked sessions
+			continue
+		}
+		archive.Sessions = append(archive.Sessions, archivedSession{ID: key, Session: sess})
+	}
+
+	plaintext, err := json.Marshal(archive)
+	if err != nil {
+		return nil, 0, err
+	}
+	sealed, err := m.sessionArchiveEncryptor().Seal(plaintext)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sealed, len(archive.Sessions), nil
+}
+
+// ImportSessions stores the sessions of an archive made by ExportSessions, with their remaining lifetime
+// Sessions expired since the export and IDs already in use are skipped, so importing twice is harmless.
+func (m *Middleware) ImportSessions(ctx context.Context, data []byte) (SessionImport, error) {
+	var result SessionImport
+
+	plaintext, err := m.sessionArchiveEncryptor().Open(data)
+	if err != nil {
+		return result, fmt.Errorf("%w: cannot decrypt (session.cookie.secret must match the exporting environment)", ErrInvalidSessionArchive)
+	}
+	var archive sessionArchive
+	if err := json.Unmarshal(plaintext, &archive); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidSessionArchive, err)
+	}
+	if archive.Version != sessionArchiveVersion {
+		return result, fmt.Errorf("%w: unsupported version %d", ErrInvalidSessionArchive, archive.Version)
+	}
+
+	now := m.clock.Now()
+	for _, entry := range archive.Sessions {
+		if entry.ID == "" || entry.Session == nil || !entry.Session.IsValidAt(now) {
+			result.Skipped++
+			continue
+		}
+		exists, err := m.sessionStore.Exists(ctx, entry.ID)
+		if err != nil {
+			return result, fmt.Errorf("failed to check session: %w", err)
+		}
+		if exists {
+			result.Skipped++
+			continue
+		}
+		if err := session.SetAt(m.sessionStore, entry.ID, entry.Session, now); err != nil {
+			return result, err
+		}
+		result.Imported++
+	}
+	return result, nil
+}
+
+// handleAdminSessionExport serves GET /_auth/admin/sessions/export
+func (m *Middleware) handleAdminSessionExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is accepted")
+		return
+	}
+	archive, count, err := m.ExportSessions(r.Context())
+	if err != nil {
+		m.logger.Error("Failed to export sessions", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", "Failed to export sessions")
+		return
+	}
+	m.logger.Info("Sessions exported via admin API", "sessions", count)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sessions-%s.bin"`, m.clock.Now().UTC().Format("20060102-150405")))
+	w.Header().Set("X-Session-Count", strconv.Itoa(count))
+	_, _ = w.Write(archive)
+}
+
+// handleAdminSessionImport serves POST /_auth/admin/sessions/import with an archive of the export endpoint as the body
+func (m *Middleware) handleAdminSessionImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is accepted")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSessionArchiveBytes))
+	if err != nil {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "Session archive is too large")
+		return
+	}
+	result, err := m.ImportSessions(r.Context(), data)
+	if errors.Is(err, ErrInvalidSessionArchive) {
+		writeAPIError(w, http.StatusBadRequest, "Bad Request", err.Error())
+		return
+	}
+	if err != nil {
+		m.logger.Error("Failed to import sessions", "imported", result.Imported, "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "Internal Server Error", fmt.Sprintf("Failed to import sessions after %d; importing again skips them", result.Imported))
+		return
+	}
+	m.logger.Info("Sessions imported via admin API", "imported", result.Imported, "skipped", result.Skipped)
+	writeAPIJSON(w, http.StatusOK, result)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
@@ -170,3 +171,221 @@ func TestHandleIcon(t *testing.T) {
 		})
 	}
 }
+
+// TestHandleOTPJS tests the OTP input script handler
+func TestHandleOTPJS(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	req := httptest.NewRequest("GET", "/_auth/assets/otp.js", nil)
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Errorf("Content-Type = %q, want javascript", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age") {
+		t.Errorf("Cache-Control = %q, want max-age", cc)
+	}
+	if !strings.Contains(w.Body.String(), "data-otp-form") {
+		t.Error("Expected the OTP script body")
+	}
+}
+
+// TestHandleFragmentJS tests the URL fragment capture script handler
+func TestHandleFragmentJS(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	req := httptest.NewRequest("GET", "/_auth/assets/fragment.js", nil)
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Errorf("Content-Type = %q, want javascript", ct)
+	}
+	if !strings.Contains(w.Body.String(), redirectFragmentCookieName) {
+		t.Errorf("Expected the script to set the %s cookie", redirectFragmentCookieName)
+	}
+}
+
+// TestHandleMainCSS_Theme tests that theming tokens are appended as CSS overrides
+func TestHandleMainCSS_Theme(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.Theme = config.ThemeConfig{
+		PrimaryColor:    "#0ea5e9",
+		BorderRadius:    "12px",
+		FontFamily:      "'Inter', sans-serif",
+		BackgroundImage: "https://example.com/bg.png",
+		CardStyle:       config.CardStyleFlat,
+	}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	req := httptest.NewRequest("GET", "/_auth/assets/main.css", nil)
+	w := httptest.NewRecorder()
+	mw.handleMainCSS(w, req)
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"--color-primary: #0ea5e9;",
+		"--color-primary-hover: #0ea5e9;",
+		"--radius-lg: 12px;",
+		"font-family: 'Inter', sans-serif;",
+		`background-image: url("https://example.com/bg.png");`,
+		"box-shadow: none;",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("CSS should contain %q", want)
+		}
+	}
+
+	// Overrides must come after the embedded stylesheet to take precedence
+	if strings.Index(body, "--color-primary: #0ea5e9;") < strings.Index(body, "--color-primary: #2563eb;") {
+		t.Error("theme overrides should be appended after the embedded CSS")
+	}
+
+	// The stylesheet link is fingerprinted so cached CSS is refreshed when the theme changes
+	links := mw.buildStyleLinksHTML()
+	if !strings.Contains(links, "/_auth/assets/main."+buildMainCSS(cfg.Service.Theme).Hash+".css") {
+		t.Errorf("style link should carry the themed stylesheet hash, got %q", links)
+	}
+}
+
+// TestBuildThemeCSS tests theme CSS generation edge cases
+func TestBuildThemeCSS(t *testing.T) {
+	if css := buildThemeCSS(config.ThemeConfig{}); css != "" {
+		t.Errorf("empty theme should produce no CSS, got %q", css)
+	}
+
+	css := buildThemeCSS(config.ThemeConfig{
+		PrimaryColor:      "red; } body { display: none",
+		PrimaryHoverColor: "#111111",
+	})
+	if strings.Contains(css, "display: none") {
+		t.Error("unsafe values must not be embedded")
+	}
+	if !strings.Contains(css, "--color-primary-hover: #111111;") {
+		t.Error("safe values should still be embedded")
+	}
+
+	if buildMainCSS(config.ThemeConfig{PrimaryColor: "#000"}).Hash == buildMainCSS(config.ThemeConfig{PrimaryColor: "#fff"}).Hash {
+		t.Error("different themes should produce different versions")
+	}
+}
+
+// TestAssets_ConditionalRequests tests ETag validation of the embedded assets
+func TestAssets_ConditionalRequests(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.Theme = config.ThemeConfig{PrimaryColor: "#0ea5e9"}
+	mw, _ := newTestMiddleware(t, cfg)
+
+	for _, path := range []string{
+		"/_auth/assets/main.css",
+		"/_auth/assets/dify.css",
+		"/_auth/assets/otp.js",
+		"/_auth/assets/fragment.js",
+		"/_auth/assets/icons/google.svg",
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			etag := rec.Header().Get("ETag")
+			if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+				t.Fatalf("ETag = %q, want a strong validator", etag)
+			}
+			if rec.Header().Get("Cache-Control") != "public, max-age=31536000" {
+				t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+			}
+
+			// A cached copy is revalidated without a body
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("revalidation status = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body of %d bytes", rec.Body.Len())
+			}
+
+			// A stale copy gets the current content
+			req = httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("If-None-Match", `"stale"`)
+			rec = httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+				t.Errorf("stale revalidation status = %d with %d bytes, want 200 with the content", rec.Code, rec.Body.Len())
+			}
+		})
+	}
+}
+
+// TestAssetURL tests that asset URLs are fingerprinted with the content hash of the asset
+func TestAssetURL(t *testing.T) {
+	otp, _ := assets.Lookup("otp.js")
+	if got, want := assetURL("/_auth", "otp.js"), "/_auth/assets/otp."+otp.Hash+".js"; got != want {
+		t.Errorf("assetURL() = %q, want %q", got, want)
+	}
+	if got := assetURL("/_auth", "missing.js"); got != "/_auth/assets/missing.js" {
+		t.Errorf("assetURL() of an unknown asset = %q, want it unchanged", got)
+	}
+
+	// The main stylesheet link follows the theme
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	want := "/_auth/assets/main." + mw.staticFragments().mainCSS.Hash + ".css"
+	if links := mw.buildStyleLinksHTML(); !strings.Contains(links, want) {
+		t.Errorf("style links = %q, want %q", links, want)
+	}
+}
+
+// TestAssets_Fingerprinted tests serving the fingerprinted asset names
+func TestAssets_Fingerprinted(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Service.Theme = config.ThemeConfig{PrimaryColor: "#0ea5e9"}
+	mw, _ := newTestMiddleware(t, cfg)
+	mainCSS := mw.staticFragments().mainCSS
+	google, _ := assets.Lookup("icons/google.svg")
+
+	tests := []struct {
+		name             string
+		path             string
+		wantStatus       int
+		wantCacheControl string
+		wantContentType  string
+	}{
+		{"themed stylesheet", "/_auth/assets/main." + mainCSS.Hash + ".css", http.StatusOK, "public, max-age=31536000, immutable", "text/css; charset=utf-8"},
+		{"script", assetURL("/_auth", "fragment.js"), http.StatusOK, "public, max-age=31536000, immutable", "text/javascript; charset=utf-8"},
+		{"icon", "/_auth/assets/icons/google." + google.Hash + ".svg", http.StatusOK, "public, max-age=31536000, immutable", "image/svg+xml"},
+		{"hash of another release", "/_auth/assets/otp.0123456789abcdef.js", http.StatusOK, "no-cache", "text/javascript; charset=utf-8"},
+		{"unthemed hash of the stylesheet", assetURL("/_auth", "main.css"), http.StatusOK, "no-cache", "text/css; charset=utf-8"},
+		{"unknown asset", "/_auth/assets/missing.0123456789abcdef.js", http.StatusNotFound, "", ""},
+		{"no hash", "/_auth/assets/missing.js", http.StatusNotFound, "", ""},
+		{"path traversal", "/_auth/assets/../main.0123456789abcdef.css", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status of %s = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
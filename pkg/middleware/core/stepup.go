@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// reauthQuery is the login page query parameter showing the step-up notice
+const reauthQuery = "reauth"
+
+// stepUpCookieName marks the next authorization code flow as a step-up sign-in, holding the
+// authorization request parameters asking the provider to authenticate again ("prompt=login&max_age=<seconds>")
+const stepUpCookieName = "oauth_reauth"
+
+// Session Extra keys holding the user's groups and roles reported by the provider (comma-separated)
+const (
+	groupsKey = "groups"
+	rolesKey  = "roles"
+)
+
+// amrKey is the session Extra key holding the authentication methods ("amr" claim) reported by the provider
+const amrKey = "amr"
+
+// reservedExtraKeys are the session Extra keys used by access control, never pruned by session.extra
+var reservedExtraKeys = []string{groupsKey, rolesKey, amrKey}
+
+// mfaMethods are the "amr" claim values (RFC 8176) that count as multi-factor authentication
+var mfaMethods = map[string]bool{
+	"mfa": true,
+	"otp": true,
+	"hwk": true,
+	"swk": true,
+	"sms": true,
+}
+
+// requireStepUp is like requireAuth for routes with step-up requirements
+// Signed-in users whose session is too old or too weak sign in again and come back to this URL
+func (m *Middleware) requireStepUp(w http.ResponseWriter, r *http.Request, stepUp *rules.StepUp) {
+	sess, ok := m.lookupSession(r)
+	if !ok {
+		m.redirectToLogin(w, r)
+		return
+	}
+
+	if !meetsStepUp(sess, stepUp, m.clock.Now()) {
+		m.logger.Debug("Step-up authentication required", "path", r.URL.Path, "provider", sess.Provider)
+		m.redirectToStepUp(w, r, stepUp.MaxAuthAge)
+		return
+	}
+
+	if !stepUp.AcceptsGroups(sessionList(sess, groupsKey)) || !stepUp.AcceptsRoles(sessionList(sess, rolesKey)) {
+		m.logger.Debug("Access denied: required groups or roles not assigned", "path", r.URL.Path, "provider", sess.Provider)
+		m.handleForbidden(w, r)
+		return
+	}
+
+	vars := expr.NewUserVars(sess.Name, sess.Email, sess.Provider, sess.Extra).WithRequest(r)
+	if !stepUp.AcceptsUser(vars) {
+		m.logger.Debug("Access denied: requirement not met", "path", r.URL.Path, "provider", sess.Provider, "require", stepUp.Require.String())
+		m.handleForbidden(w, r)
+		return
+	}
+
+	if ok, reason := stepUp.AcceptsScript(r.Context(), vars); !ok {
+		m.logger.Debug("Access denied by policy script", "path", r.URL.Path, "provider", sess.Provider, "script", stepUp.Script.String(), "reason", reason)
+		m.handleForbidden(w, r)
+		return
+	}
+
+	m.serveAuthenticated(w, r, sess)
+}
+
+// meetsStepUp reports whether a session satisfies the step-up requirements
+// Guests never do, since they have not signed in
+func meetsStepUp(sess *session.Session, stepUp *rules.StepUp, now time.Time) bool {
+	if sess.Provider == guestProvider {
+		return false
+	}
+	if !stepUp.AcceptsProvider(sess.Provider, isOAuth2Provider(sess.Provider)) {
+		return false
+	}
+	if !stepUp.AcceptsAuthTime(sess.CreatedAt, now) {
+		return false
+	}
+	return !stepUp.RequireMFA || sessionHasMFA(sess)
+}
+
+// isOAuth2Provider reports whether sessions of the provider signed in through an OAuth2 provider
+// The built-in methods, service tokens and plugin logins are not OAuth2 providers.
+func isOAuth2Provider(provider string) bool {
+	switch provider {
+	case "email", authMethodPassword, guestProvider, serviceProvider:
+		return false
+	}
+	return !strings.HasPrefix(provider, pluginProviderPrefix)
+}
+
+// sessionHasMFA reports whether the provider reported multi-factor authentication
+// in the "amr" (authentication methods references) claim of its user info
+func sessionHasMFA(sess *session.Session) bool {
+	switch amr := sess.Extra[amrKey].(type) {
+	case []interface{}:
+		for _, method := range amr {
+			if s, ok := method.(string); ok && mfaMethods[s] {
+				return true
+			}
+		}
+	case []string:
+		for _, method := range amr {
+			if mfaMethods[method] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sessionList returns a list the provider reported for the user (e.g., groups or roles)
+// Lists are stored comma-separated in Extra so that they can be forwarded as is,
+// but arrays (e.g., of sessions stored by plugins or decoded from JSON) are read too
+func sessionList(sess *session.Session, key string) []string {
+	switch list := sess.Extra[key].(type) {
+	case string:
+		if list == "" {
+			return nil
+		}
+		return strings.Split(list, ",")
+	case []interface{}:
+		var values []string
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return list
+	}
+	return nil
+}
+
+// redirectToStepUp sends a signed-in user to the login page to authenticate again
+// Unlike redirectToLogin, the original URL replaces any redirect target saved earlier, and the
+// provider is asked to authenticate the user again, within maxAge when not 0, instead of reusing its own session
+func (m *Middleware) redirectToStepUp(w http.ResponseWriter, r *http.Request, maxAge time.Duration) {
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+	loginPath := withLanguageQuery(joinAuthPath(prefix, "/login")+"?"+reauthQuery+"=1", r)
+
+	params := url.Values{"prompt": {"login"}}
+	if maxAge > 0 {
+		params.Set("max_age", strconv.FormatInt(int64(maxAge/time.Second), 10))
+	}
+	// The login page may be served by the central auth host
+	http.SetCookie(w, &http.Cookie{
+		Name:     stepUpCookieName,
+		Value:    params.Encode(),
+		Path:     m.config.Server.GetCookiePath(),
+		Domain:   m.config.Session.Cookie.Domain,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   m.config.Session.Cookie.Secure,
+		SameSite: m.config.Session.Cookie.GetSameSite(),
+	})
+
+	if m.config.Server.CentralAuthURL != "" && !m.isCentralAuthHost(r) {
+		m.redirectToCentralLogin(w, r, loginPath)
+		return
+	}
+
+	if originalURL := r.URL.RequestURI(); isValidRedirectURL(originalURL) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     redirectCookieName,
+			Value:    originalURL,
+			Path:     m.config.Server.GetCookiePath(),
+			MaxAge:   600, // 10 minutes - enough time to complete authentication
+			HttpOnly: true,
+			Secure:   m.config.Session.Cookie.Secure,
+			SameSite: m.config.Session.Cookie.GetSameSite(),
+		})
+	}
+
+	http.Redirect(w, r, loginPath, http.StatusFound)
+}
+
+// withStepUpParams adds the step-up parameters of the stepUpCookieName cookie value to the
+// authorization URL of a provider; only prompt=login and a numeric max_age are taken from the cookie
+func withStepUpParams(authURL, value string) string {
+	params, err := url.ParseQuery(value)
+	if err != nil || params.Get("prompt") != "login" {
+		return authURL
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return authURL
+	}
+	query := u.Query()
+	query.Set("prompt", "login")
+	if maxAge, err := strconv.Atoi(params.Get("max_age")); err == nil && maxAge >= 0 {
+		query.Set("max_age", strconv.Itoa(maxAge))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+func TestServeHTTP_StepUp(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "projects.lua")
+	if err := os.WriteFile(policy, []byte(`return user.groups_set["admins"] == true, "admins only"`), 0o600); err != nil {
+		t.Fatalf("Failed to write policy script: %v", err)
+	}
+	rulesConfig := rules.Config{
+		{Minimatch: "/admin/**", Action: rules.ActionAuth, MaxAuthAge: "10m", Providers: []string{rules.ProviderOAuth2}},
+		{Minimatch: "/billing/**", Action: rules.ActionAuth, RequireMFA: true},
+		{Minimatch: "/finance/**", Action: rules.ActionAuth, Groups: []string{"finance@example.com"}},
+		{Minimatch: "/console/**", Action: rules.ActionAuth, Roles: []string{"Admin"}},
+		{Minimatch: "/ops/**", Action: rules.ActionAuth, Require: `email.endsWith("@example.com") && "admins" in groups && method == "GET"`},
+		{Minimatch: "/projects/**", Action: rules.ActionAuth, Script: policy},
+		{Prefix: "/", Action: rules.ActionAuth},
+	}
+	rulesEvaluator, err := rules.NewEvaluator(&rulesConfig)
+	if err != nil {
+		t.Fatalf("Failed to create rules evaluator: %v", err)
+	}
+
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	mw.rulesEvaluator = rulesEvaluator
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	storeSession := func(id, provider string, signedIn time.Time, extra map[string]interface{}) {
+		t.Helper()
+		sess := &session.Session{
+			ID:            id,
+			Email:         "user@example.com",
+			Provider:      provider,
+			Extra:         extra,
+			CreatedAt:     signedIn,
+			ExpiresAt:     time.Now().Add(time.Hour),
+			Authenticated: true,
+		}
+		if err := session.Set(store, id, sess); err != nil {
+			t.Fatalf("Failed to store session: %v", err)
+		}
+	}
+	storeSession("fresh-google", "google", time.Now(), nil)
+	storeSession("old-google", "google", time.Now().Add(-time.Hour), nil)
+	storeSession("fresh-email", "email", time.Now(), nil)
+	storeSession("mfa-oidc", "okta", time.Now().Add(-time.Hour), map[string]interface{}{"amr": []interface{}{"pwd", "mfa"}})
+	storeSession("finance-member", "google", time.Now(), map[string]interface{}{"groups": "staff@example.com,Finance@example.com"})
+	storeSession("entra-admin", "microsoft", time.Now(), map[string]interface{}{"roles": "Reader,Admin"})
+	storeSession("ops-admin", "google", time.Now(), map[string]interface{}{"groups": "staff,admins"})
+
+	tests := []struct {
+		name       string
+		path       string
+		sessionID  string
+		wantStatus int
+	}{
+		{"fresh OAuth2 session", "/admin/users", "fresh-google", http.StatusOK},
+		{"old session", "/admin/users", "old-google", http.StatusFound},
+		{"weaker method", "/admin/users", "fresh-email", http.StatusFound},
+		{"old session on a route without step-up", "/chat", "old-google", http.StatusOK},
+		{"MFA reported by the provider", "/billing/invoices", "mfa-oidc", http.StatusOK},
+		{"no MFA", "/billing/invoices", "fresh-google", http.StatusFound},
+		{"member of the required group", "/finance/reports", "finance-member", http.StatusOK},
+		{"not a member of the required group", "/finance/reports", "fresh-google", http.StatusForbidden},
+		{"has the required role", "/console/users", "entra-admin", http.StatusOK},
+		{"lacks the required role", "/console/users", "finance-member", http.StatusForbidden},
+		{"meets the required expression", "/ops/status", "ops-admin", http.StatusOK},
+		{"does not meet the required expression", "/ops/status", "finance-member", http.StatusForbidden},
+		{"allowed by the policy script", "/projects/alpha", "ops-admin", http.StatusOK},
+		{"denied by the policy script", "/projects/alpha", "finance-member", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?tab=1", nil)
+			req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: tt.sessionID})
+			// A stale target saved earlier must not win over the step-up route
+			req.AddCookie(&http.Cookie{Name: redirectCookieName, Value: "/somewhere-else"})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+
+			if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "/_auth/login?reauth=1") {
+				t.Errorf("Location = %q, want the login page with the step-up notice", loc)
+			}
+			var saved, stepUpParams string
+			for _, c := range rec.Result().Cookies() {
+				switch c.Name {
+				case redirectCookieName:
+					saved = c.Value
+				case stepUpCookieName:
+					stepUpParams = c.Value
+				}
+			}
+			if saved != tt.path+"?tab=1" {
+				t.Errorf("Saved redirect URL = %q, want %q", saved, tt.path+"?tab=1")
+			}
+			wantParams := "prompt=login"
+			if strings.HasPrefix(tt.path, "/admin/") {
+				wantParams = "max_age=600&prompt=login"
+			}
+			if stepUpParams != wantParams {
+				t.Errorf("Step-up parameters = %q, want %q", stepUpParams, wantParams)
+			}
+		})
+	}
+
+	t.Run("plugin logins are not OAuth2 providers", func(t *testing.T) {
+		sess := &session.Session{Provider: pluginProviderPrefix + "sso-bridge", CreatedAt: time.Now()}
+		if meetsStepUp(sess, &rules.StepUp{Providers: []string{rules.ProviderOAuth2}}, time.Now()) {
+			t.Error("Plugin session should not satisfy an OAuth2 provider requirement")
+		}
+		sess.Provider = "google"
+		if !meetsStepUp(sess, &rules.StepUp{Providers: []string{rules.ProviderOAuth2}}, time.Now()) {
+			t.Error("OAuth2 session should satisfy an OAuth2 provider requirement")
+		}
+	})
+
+	t.Run("guest sessions never satisfy step-up", func(t *testing.T) {
+		guest := &session.Session{Provider: guestProvider, CreatedAt: time.Now()}
+		if meetsStepUp(guest, &rules.StepUp{MaxAuthAge: time.Hour}, time.Now()) {
+			t.Error("Guest session should not satisfy step-up requirements")
+		}
+	})
+}
+
+func TestHandleLogin_ReauthNotice(t *testing.T) {
+	mw, _ := newTestMiddleware(t, newTestConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "/_auth/login?reauth=1", nil)
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), "sign in again") {
+		t.Error("Expected the step-up notice on the login page")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_auth/login", nil)
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), "sign in again") {
+		t.Error("Step-up notice should only be shown with reauth=1")
+	}
+}
+
+func TestOAuth2Start_StepUp(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "google", Type: "google", DisplayName: "Google"}}
+	mw, _ := newTestMiddleware(t, cfg)
+	mockProvider := newMockOAuth2Provider("google", "user@example.com", "Test User")
+	t.Cleanup(mockProvider.Close)
+	mw.oauthManager.AddProvider(mockProvider)
+
+	start := func(stepUpParams string) (url.Values, bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/_auth/oauth2/start/google", nil)
+		if stepUpParams != "" {
+			req.AddCookie(&http.Cookie{Name: stepUpCookieName, Value: stepUpParams})
+		}
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		if rec.Code != http.StatusFound {
+			t.Fatalf("Status = %d, want a redirect to the provider", rec.Code)
+		}
+		u, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleared := false
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == stepUpCookieName && c.MaxAge < 0 {
+				cleared = true
+			}
+		}
+		return u.Query(), cleared
+	}
+
+	query, cleared := start("max_age=600&prompt=login")
+	if query.Get("prompt") != "login" || query.Get("max_age") != "600" {
+		t.Errorf("Authorization request = %v, want prompt=login and max_age=600", query)
+	}
+	if !cleared {
+		t.Error("Step-up cookie should be deleted once used")
+	}
+
+	if query, _ := start("prompt=login"); query.Get("prompt") != "login" || query.Has("max_age") {
+		t.Errorf("Authorization request = %v, want prompt=login without max_age", query)
+	}
+
+	// Only the step-up parameters are taken from the cookie
+	query, _ = start("prompt=login&max_age=ten&redirect_uri=https://evil.example.com")
+	if query.Has("max_age") || strings.Contains(query.Get("redirect_uri"), "evil") {
+		t.Errorf("Authorization request = %v, want the cookie's other parameters ignored", query)
+	}
+
+	if query, _ := start(""); query.Has("prompt") || query.Has("max_age") {
+		t.Errorf("Authorization request = %v, want no step-up parameters without step-up", query)
+	}
+}
+
+func TestServeHTTP_FakeClock(t *testing.T) {
+	rulesConfig := rules.Config{
+		{Minimatch: "/admin/**", Action: rules.ActionAuth, MaxAuthAge: "10m"},
+		{Prefix: "/", Action: rules.ActionAuth},
+	}
+	rulesEvaluator, err := rules.NewEvaluator(&rulesConfig)
+	if err != nil {
+		t.Fatalf("Failed to create rules evaluator: %v", err)
+	}
+
+	cfg := newTestConfig()
+	mw, store := newTestMiddleware(t, cfg)
+	mw.rulesEvaluator = rulesEvaluator
+	fake := clock.NewFake(time.Now())
+	mw.SetClock(fake)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	sess := &session.Session{
+		ID:            "clock-session",
+		Email:         "user@example.com",
+		Provider:      "google",
+		CreatedAt:     fake.Now(),
+		ExpiresAt:     fake.Now().Add(time.Hour),
+		Authenticated: true,
+	}
+	if err := session.SetAt(store, sess.ID, sess, fake.Now()); err != nil {
+		t.Fatalf("Failed to store session: %v", err)
+	}
+
+	status := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: cfg.Session.Cookie.Name, Value: sess.ID})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := status("/admin/users"); got != http.StatusOK {
+		t.Fatalf("Fresh session: status = %d, want %d", got, http.StatusOK)
+	}
+
+	fake.Advance(11 * time.Minute)
+	if got := status("/admin/users"); got != http.StatusFound {
+		t.Errorf("After max_auth_age: status = %d, want %d (step-up)", got, http.StatusFound)
+	}
+	if got := status("/chat"); got != http.StatusOK {
+		t.Errorf("After max_auth_age on a route without step-up: status = %d, want %d", got, http.StatusOK)
+	}
+
+	fake.Advance(time.Hour)
+	if got := status("/chat"); got != http.StatusFound {
+		t.Errorf("After expiry: status = %d, want %d (sign-in)", got, http.StatusFound)
+	}
+}
+
+func TestSessionList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{"comma-separated", "finance,admins", []string{"finance", "admins"}},
+		{"empty string", "", nil},
+		{"decoded array", []interface{}{"finance", 1, "admins"}, []string{"finance", "admins"}},
+		{"string array", []string{"finance", "admins"}, []string{"finance", "admins"}},
+		{"missing", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := &session.Session{Extra: map[string]interface{}{}}
+			if tt.value != nil {
+				sess.Extra[groupsKey] = tt.value
+			}
+			if got := sessionList(sess, groupsKey); !slices.Equal(got, tt.want) {
+				t.Errorf("sessionList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetClock_SessionCache(t *testing.T) {
+	memory, err := kvs.NewMemoryStore("test", kvs.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	cache := kvs.NewCachedStore(memory, kvs.CacheConfig{Enabled: true, TTL: "1m"})
+	t.Cleanup(func() { _ = cache.Close() })
+
+	mw, _ := newTestMiddleware(t, newTestConfig())
+	mw.sessionStore = cache
+	fake := clock.NewFake(time.Now())
+	mw.SetClock(fake)
+
+	ctx := context.Background()
+	if err := cache.Set(ctx, "key", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Set(ctx, "key", []byte("v2"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached value expires on the middleware's clock
+	fake.Advance(time.Minute)
+	if value, _ := cache.Get(ctx, "key"); string(value) != "v2" {
+		t.Errorf("Get() after the TTL = %q, want v2", value)
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+)
+
+// errStreamBytesExceeded is returned to the upstream copy once a response reached max_response_bytes
+// httputil.ReverseProxy aborts the connection on a write error, so the client sees an incomplete response.
+var errStreamBytesExceeded = errors.New("stream limit: max_response_bytes exceeded")
+
+// errStreamDurationExceeded is the cause of the request context cancellation at max_duration
+// It wraps context.DeadlineExceeded, so a request still waiting for the upstream gets a gateway timeout.
+var errStreamDurationExceeded = fmt.Errorf("stream limit: max_duration exceeded: %w", context.DeadlineExceeded)
+
+// StreamLimitStats counts the responses cut by stream_limits on this instance
+type StreamLimitStats struct {
+	BytesExceeded    int64 `json:"bytes_exceeded"`    // Responses cut at max_response_bytes
+	DurationExceeded int64 `json:"duration_exceeded"` // Responses cut at max_duration
+}
+
+// streamLimitCounters holds the StreamLimitStats of this instance
+type streamLimitCounters struct {
+	bytesExceeded    atomic.Int64
+	durationExceeded atomic.Int64
+}
+
+// StreamLimitStats returns the numbers of responses cut by stream_limits on this instance
+func (m *Middleware) StreamLimitStats() StreamLimitStats {
+	return StreamLimitStats{
+		BytesExceeded:    m.streamLimits.bytesExceeded.Load(),
+		DurationExceeded: m.streamLimits.durationExceeded.Load(),
+	}
+}
+
+// limitStream applies the stream limit of the request path to the upstream response
+// Returns the writer and the request to proxy with, and a function to call once the response is done
+// (also when the proxy panics to abort the connection). WebSocket connections are not limited.
+func (m *Middleware) limitStream(w http.ResponseWriter, r *http.Request, sess *session.Session) (http.ResponseWriter, *http.Request, func()) {
+	limit := m.config.StreamLimitFor(r.URL.Path)
+	if limit == nil || isWebSocketUpgrade(r) {
+		return w, r, func() {}
+	}
+
+	started := time.Now()
+	ctx, cancel := context.WithCancel(r.Context())
+	if d := limit.GetMaxDuration(); d > 0 {
+		ctx, cancel = context.WithTimeoutCause(r.Context(), d, errStreamDurationExceeded)
+	}
+	lw := &streamLimitWriter{ResponseWriter: w, max: limit.MaxResponseBytes}
+
+	done := func() {
+		var reason string
+		switch {
+		case lw.exceeded:
+			reason = "max_response_bytes"
+			m.streamLimits.bytesExceeded.Add(1)
+		case errors.Is(context.Cause(ctx), errStreamDurationExceeded):
+			reason = "max_duration"
+			m.streamLimits.durationExceeded.Add(1)
+		}
+		cancel()
+		if reason == "" {
+			return
+		}
+
+		attrs := []any{"path", r.URL.Path, "limit", reason, "bytes", lw.written, "duration", time.Since(started).Round(time.Millisecond)}
+		if sess != nil {
+			attrs = append(attrs, "email", m.logEmail(sess.Email), "provider", sess.Provider)
+		}
+		m.logger.Warn("Response cut by stream limit", attrs...)
+	}
+	return lw, r.WithContext(ctx), done
+}
+
+// streamLimitWriter counts the response body bytes, and fails the write reaching max_response_bytes
+type streamLimitWriter struct {
+	http.ResponseWriter
+	max      int64 // 0: no limit
+	written  int64
+	exceeded bool
+}
+
+func (w *streamLimitWriter) Write(p []byte) (int, error) {
+	if w.exceeded {
+		return 0, errStreamBytesExceeded
+	}
+	if w.max > 0 && w.written+int64(len(p)) > w.max {
+		// Send up to the limit, then stop the copy
+		n, err := w.ResponseWriter.Write(p[:w.max-w.written])
+		w.written += int64(n)
+		w.exceeded = true
+		if err != nil {
+			return n, err
+		}
+		return n, errStreamBytesExceeded
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *streamLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	proxy "github.com/ideamans/chatbotgate/pkg/proxy/core"
+)
+
+// newStreamTestServer serves an upstream streaming an SSE event every 10ms until the client goes away,
+// after waiting for the "delay" query parameter, behind the middleware
+func newStreamTestServer(t *testing.T, mw *Middleware) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delay, err := time.ParseDuration(r.URL.Query().Get("delay")); err == nil {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: token %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	proxyHandler, err := proxy.NewHandler(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(mw.Wrap(proxyHandler))
+	t.Cleanup(front.Close)
+	return front
+}
+
+// getStream requests path with the session cookie and reads the whole body
+func getStream(t *testing.T, server *httptest.Server, path, sessionID string) (*http.Response, []byte, error) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+func TestStreamLimit_MaxResponseBytes(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.StreamLimits = []config.StreamLimitConfig{{Paths: []string{"/v1/**"}, MaxResponseBytes: 100}}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+	server := newStreamTestServer(t, mw)
+
+	resp, body, err := getStream(t, server, "/v1/chat-messages", sessionID)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", resp.StatusCode)
+	}
+	if err == nil {
+		t.Error("The response should be aborted")
+	}
+	if len(body) != 100 {
+		t.Errorf("Received %d bytes, want 100", len(body))
+	}
+	if stats := mw.StreamLimitStats(); stats.BytesExceeded != 1 || stats.DurationExceeded != 0 {
+		t.Errorf("StreamLimitStats() = %+v", stats)
+	}
+}
+
+func TestStreamLimit_MaxDuration(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.StreamLimits = []config.StreamLimitConfig{{Paths: []string{"/v1/**"}, MaxDuration: "100ms"}}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+	server := newStreamTestServer(t, mw)
+
+	started := time.Now()
+	resp, body, err := getStream(t, server, "/v1/chat-messages", sessionID)
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Fatalf("Status = %d with %d bytes, want a streamed 200", resp.StatusCode, len(body))
+	}
+	if err == nil {
+		t.Error("The response should be aborted")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Stream lasted %v, want about 100ms", elapsed)
+	}
+
+	// Without response yet, the client gets a gateway timeout
+	resp, _, _ = getStream(t, server, "/v1/chat-messages?delay=1s", sessionID)
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Status before the response = %d, want 504", resp.StatusCode)
+	}
+	if stats := mw.StreamLimitStats(); stats.DurationExceeded != 2 || stats.BytesExceeded != 0 {
+		t.Errorf("StreamLimitStats() = %+v", stats)
+	}
+}
+
+func TestStreamLimit_OtherPaths(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.StreamLimits = []config.StreamLimitConfig{{Paths: []string{"/v1/**"}, MaxResponseBytes: 100}}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 1000))
+	})
+	server := httptest.NewServer(mw.Wrap(next))
+	t.Cleanup(server.Close)
+
+	_, body, err := getStream(t, server, "/app", sessionID)
+	if err != nil || len(body) != 1000 {
+		t.Errorf("Received %d bytes (error %v), want the whole response", len(body), err)
+	}
+	if stats := mw.StreamLimitStats(); stats != (StreamLimitStats{}) {
+		t.Errorf("StreamLimitStats() = %+v, want none", stats)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+// scopeConsentTemplate is the HTML template for the consent step of a provider's optional scopes
+const scopeConsentTemplate = `<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.Title}} - {{.ServiceName}}</title>
+{{.StyleLinks}}
+{{.CustomHead}}
+</head>
+<body>
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+<main id="main-content" class="auth-container" tabindex="-1">
+	<div style="width: 100%; max-width: 28rem;">
+		<div class="card auth-card">
+			{{.Header}}
+			{{if .Subtitle}}
+			<h2 class="auth-subtitle">{{.Subtitle}}</h2>
+			{{end}}
+			<p id="consent-message" style="text-align: start; color: var(--color-text-secondary); margin-bottom: var(--spacing-md);">{{.Message}}</p>
+			<form method="POST" action="{{.FormPath}}">
+				<fieldset aria-describedby="consent-message" style="border: 0; padding: 0; margin: 0 0 var(--spacing-md);">
+					{{range .Scopes}}
+					<label style="display: flex; align-items: flex-start; gap: 0.5rem; cursor: pointer; text-align: start; margin-bottom: var(--spacing-sm);">
+						<input type="checkbox" name="scope" value="{{.Scope}}"{{if .Approved}} checked{{end}} style="cursor: pointer; margin-top: 0.25rem;">
+						<span>{{.Description}}</span>
+					</label>
+					{{end}}
+				</fieldset>
+				<button type="submit" class="btn btn-primary" style="width: 100%;">{{.ContinueLabel}}</button>
+				<button type="submit" name="skip" value="1" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-sm);">{{.SkipLabel}}</button>
+			</form>
+		</div>
+		<a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
+			<img src="{{.CreditIcon}}" alt="">
+			Protected by ChatbotGate
+		</a>
+	</div>
+</main>
+{{.CustomFooter}}
+</body>
+</html>`
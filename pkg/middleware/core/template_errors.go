@@ -2,119 +2,241 @@ package middleware
 
 // forbiddenTemplate is the HTML template for 403 Forbidden error page
 const forbiddenTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
 <title>{{.Title}} - {{.ServiceName}}</title>
 {{.StyleLinks}}
+{{.CustomHead}}
 </head>
 <body>
-<div class="auth-container">
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
   <div style="width: 100%; max-width: 28rem;">
     <div class="card auth-card">
       {{.Header}}
       {{if .Subtitle}}
       <h2 class="auth-subtitle">{{.Subtitle}}</h2>
       {{end}}
-      <div class="alert alert-error" style="text-align: left; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
       <a href="{{.ActionURL}}" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
     </div>
     <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-      <img src="{{.CreditIcon}}" alt="ChatbotGate Logo">
+      <img src="{{.CreditIcon}}" alt="">
       Protected by ChatbotGate
     </a>
   </div>
-</div>
+</main>
+{{.CustomFooter}}
 </body>
 </html>`
 
 // emailRequiredTemplate is the HTML template for email required error page
 const emailRequiredTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
 <title>{{.Title}} - {{.ServiceName}}</title>
 {{.StyleLinks}}
+{{.CustomHead}}
 </head>
 <body>
-<div class="auth-container">
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
   <div style="width: 100%; max-width: 28rem;">
     <div class="card auth-card">
       {{.Header}}
       {{if .Subtitle}}
       <h2 class="auth-subtitle">{{.Subtitle}}</h2>
       {{end}}
-      <div class="alert alert-error" style="text-align: left; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
       <a href="{{.ActionURL}}" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
     </div>
     <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-      <img src="{{.CreditIcon}}" alt="ChatbotGate Logo">
+      <img src="{{.CreditIcon}}" alt="">
       Protected by ChatbotGate
     </a>
   </div>
-</div>
+</main>
+{{.CustomFooter}}
+</body>
+</html>`
+
+// emailUnverifiedTemplate is the HTML template for the unverified email error page
+const emailUnverifiedTemplate = `<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.Title}} - {{.ServiceName}}</title>
+{{.StyleLinks}}
+{{.CustomHead}}
+</head>
+<body>
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
+  <div style="width: 100%; max-width: 28rem;">
+    <div class="card auth-card">
+      {{.Header}}
+      {{if .Subtitle}}
+      <h2 class="auth-subtitle">{{.Subtitle}}</h2>
+      {{end}}
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <a href="{{.ActionURL}}" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
+    </div>
+    <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
+      <img src="{{.CreditIcon}}" alt="">
+      Protected by ChatbotGate
+    </a>
+  </div>
+</main>
+{{.CustomFooter}}
 </body>
 </html>`
 
 // notFoundTemplate is the HTML template for 404 Not Found error page
 const notFoundTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
 <title>{{.Title}} - {{.ServiceName}}</title>
 {{.StyleLinks}}
+{{.CustomHead}}
 </head>
 <body>
-<div class="auth-container">
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
   <div style="width: 100%; max-width: 28rem;">
     <div class="card auth-card">
       {{.Header}}
       {{if .Subtitle}}
       <h2 class="auth-subtitle">{{.Subtitle}}</h2>
       {{end}}
-      <div class="alert alert-error" style="text-align: left; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
       <a href="{{.ActionURL}}" class="btn btn-primary" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
     </div>
     <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-      <img src="{{.CreditIcon}}" alt="ChatbotGate Logo">
+      <img src="{{.CreditIcon}}" alt="">
       Protected by ChatbotGate
     </a>
   </div>
-</div>
+</main>
+{{.CustomFooter}}
 </body>
 </html>`
 
 // serverErrorTemplate is the HTML template for 500 Internal Server Error page
 const serverErrorTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
 <title>{{.Title}} - {{.ServiceName}}</title>
 {{.StyleLinks}}
+{{.CustomHead}}
 </head>
 <body>
-<div class="auth-container">
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
   <div style="width: 100%; max-width: 28rem;">
     <div class="card auth-card">
       {{.Header}}
       {{if .Subtitle}}
       <h2 class="auth-subtitle">{{.Subtitle}}</h2>
       {{end}}
-      <div class="alert alert-error" style="text-align: left; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
       {{if .ErrorDetails}}
       {{.ErrorDetails}}
       {{end}}
       <a href="{{.ActionURL}}" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
     </div>
     <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-      <img src="{{.CreditIcon}}" alt="ChatbotGate Logo">
+      <img src="{{.CreditIcon}}" alt="">
+      Protected by ChatbotGate
+    </a>
+  </div>
+</main>
+{{.CustomFooter}}
+</body>
+</html>`
+
+// upstreamErrorTemplate is the HTML template for 502 Bad Gateway and 504 Gateway Timeout pages
+// shown when the upstream cannot be reached, as opposed to failures of the gate itself
+const upstreamErrorTemplate = `<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.Title}} - {{.ServiceName}}</title>
+{{.StyleLinks}}
+{{.CustomHead}}
+</head>
+<body>
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
+  <div style="width: 100%; max-width: 28rem;">
+    <div class="card auth-card">
+      {{.Header}}
+      {{if .Subtitle}}
+      <h2 class="auth-subtitle">{{.Subtitle}}</h2>
+      {{end}}
+      <div class="alert alert-error" role="alert" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      {{if .RetryURL}}
+      <a href="{{.RetryURL}}" class="btn btn-primary" style="width: 100%; margin-top: var(--spacing-md);">{{.RetryLabel}}</a>
+      {{end}}
+      <a href="{{.ActionURL}}" class="btn btn-ghost" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
+      {{if .RequestID}}
+      <p style="margin-top: var(--spacing-md); font-size: 0.75rem; color: var(--color-text-muted); text-align: center;">{{.RequestIDLabel}}: <code dir="ltr">{{.RequestID}}</code></p>
+      {{end}}
+    </div>
+    <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
+      <img src="{{.CreditIcon}}" alt="">
+      Protected by ChatbotGate
+    </a>
+  </div>
+</main>
+{{.CustomFooter}}
+</body>
+</html>`
+
+// guestLimitTemplate is the HTML template for the sign-in prompt shown when a guest's quota is used up
+const guestLimitTemplate = `<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.Title}} - {{.ServiceName}}</title>
+{{.StyleLinks}}
+{{.CustomHead}}
+</head>
+<body>
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
+<main id="main-content" class="auth-container" tabindex="-1">
+  <div style="width: 100%; max-width: 28rem;">
+    <div class="card auth-card">
+      {{.Header}}
+      {{if .Subtitle}}
+      <h2 class="auth-subtitle">{{.Subtitle}}</h2>
+      {{end}}
+      <div class="alert alert-warning" role="status" style="text-align: start; margin-bottom: var(--spacing-md);">{{.Message}}</div>
+      <a href="{{.ActionURL}}" class="btn btn-primary" style="width: 100%; margin-top: var(--spacing-md);">{{.ActionLabel}}</a>
+    </div>
+    <a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
+      <img src="{{.CreditIcon}}" alt="">
       Protected by ChatbotGate
     </a>
   </div>
-</div>
+</main>
+{{.CustomFooter}}
 </body>
 </html>`
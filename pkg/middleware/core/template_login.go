@@ -2,7 +2,7 @@ package middleware
 
 // loginTemplate is the HTML template for the login page
 const loginTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
+<html lang="{{.Lang}}" dir="{{.Dir}}"{{if eq .Theme "dark"}} class="dark"{{else if eq .Theme "light"}} class="light"{{end}}>
 <head>
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
@@ -12,7 +12,7 @@ const loginTemplate = `<!DOCTYPE html>
 .settings-toggle {
 	position: fixed;
 	top: var(--spacing-md);
-	right: var(--spacing-md);
+	inset-inline-end: var(--spacing-md);
 	display: flex;
 	flex-direction: row;
 	gap: var(--spacing-md);
@@ -38,36 +38,64 @@ const loginTemplate = `<!DOCTYPE html>
 	color: var(--color-text-primary);
 }
 .settings-toggle select:focus {
-	outline: none;
 	color: var(--color-text-primary);
 }
 </style>
+{{.CustomHead}}
 </head>
 <body>
+<a href="#main-content" class="skip-link">{{.SkipToContent}}</a>
+{{.Announcement}}
 <div class="settings-toggle">
+	<label for="theme-select" class="sr-only">{{.Translations.ThemeLabel}}</label>
 	<select id="theme-select" onchange="changeTheme(this.value)">
 		<option value="auto"{{if eq .Theme "auto"}} selected{{end}}>{{.Translations.ThemeAuto}}</option>
 		<option value="light"{{if eq .Theme "light"}} selected{{end}}>{{.Translations.ThemeLight}}</option>
 		<option value="dark"{{if eq .Theme "dark"}} selected{{end}}>{{.Translations.ThemeDark}}</option>
 	</select>
+	<label for="lang-select" class="sr-only">{{.Translations.LanguageLabel}}</label>
 	<select id="lang-select" onchange="changeLanguage(this.value)">
 		<option value="en"{{if eq .Lang "en"}} selected{{end}}>{{.Translations.LanguageEn}}</option>
 		<option value="ja"{{if eq .Lang "ja"}} selected{{end}}>{{.Translations.LanguageJa}}</option>
+		<option value="ar"{{if eq .Lang "ar"}} selected{{end}}>{{.Translations.LanguageAr}}</option>
+		<option value="he"{{if eq .Lang "he"}} selected{{end}}>{{.Translations.LanguageHe}}</option>
 	</select>
 </div>
 
-<div class="auth-container">
+<main id="main-content" class="auth-container" tabindex="-1">
 	<div style="width: 100%; max-width: 28rem;">
 		<div class="card auth-card">
 			{{.Header}}
 			<p class="auth-description">{{.ServiceDescription}}</p>
+			{{if .IsGuest}}
+			<div class="alert alert-warning" role="status" style="text-align: start; margin-bottom: var(--spacing-lg);">{{.GuestNotice}}</div>
+			{{end}}
+			{{if .ReauthNotice}}
+			<div class="alert alert-warning" role="status" style="text-align: start; margin-bottom: var(--spacing-lg);">{{.ReauthNotice}}</div>
+			{{end}}
 			{{if .Providers}}
 			<div style="margin-bottom: var(--spacing-lg);">
-				{{range .Providers}}
-				<a href="{{.URL}}" class="btn btn-secondary provider-btn">
-					<img src="{{.IconPath}}" alt="{{.Name}}">
-					{{.Label}}
-				</a>
+				{{range .ProviderSections}}
+				<div class="provider-section">
+					{{if .Heading}}<h2 class="provider-section-heading">{{.Heading}}</h2>{{end}}
+					{{range .Providers}}
+					<a href="{{.URL}}" class="btn {{$.ButtonClass}} provider-btn">
+						<img src="{{.IconPath}}" alt="">
+						{{.Label}}
+					</a>
+					{{end}}
+				</div>
+				{{end}}
+				{{if .MoreProviders}}
+				<details class="provider-more"{{if not .ProviderSections}} open{{end}}>
+					<summary>{{.Translations.MoreOptions}}</summary>
+					{{range .MoreProviders}}
+					<a href="{{.URL}}" class="btn {{$.ButtonClass}} provider-btn">
+						<img src="{{.IconPath}}" alt="">
+						{{.Label}}
+					</a>
+					{{end}}
+				</details>
 				{{end}}
 			</div>
 			{{end}}
@@ -84,10 +112,10 @@ const loginTemplate = `<!DOCTYPE html>
 							<span>{{.Translations.EmailSave}}</span>
 						</label>
 					</div>
-					<input type="email" id="email" name="email" class="input" placeholder="you@example.com" required>
+					<input type="email" id="email" name="email" class="input" placeholder="you@example.com" autocomplete="email" required aria-required="true">
 				</div>
 				<button type="submit" class="btn btn-primary provider-btn">
-					<img src="{{.EmailIconPath}}" alt="Email">
+					<img src="{{.EmailIconPath}}" alt="">
 					{{.Translations.EmailSubmit}}
 				</button>
 			</form>
@@ -137,13 +165,22 @@ const loginTemplate = `<!DOCTYPE html>
 			{{end}}
 			{{.PasswordFormHTML}}
 			{{end}}
+			{{if and .GuestEnabled (not .IsGuest)}}
+			{{if or .Providers .EmailEnabled .PasswordEnabled}}
+			<div class="auth-divider"><span>{{.Translations.Or}}</span></div>
+			{{end}}
+			<form method="POST" action="{{.GuestStartPath}}">
+				<button type="submit" class="btn btn-ghost provider-btn">{{.Translations.GuestContinue}}</button>
+			</form>
+			{{end}}
 		</div>
 		<a href="https://github.com/ideamans/chatbotgate" class="auth-credit">
-			<img src="{{.CreditIcon}}" alt="ChatbotGate Logo">
+			<img src="{{.CreditIcon}}" alt="">
 			Protected by ChatbotGate
 		</a>
 	</div>
-</div>
+</main>
+<script src="{{.FragmentScript}}"></script>
 <script>
 function setCookie(name, value, days) {
 	var expires = "";
@@ -210,5 +247,6 @@ function getCookie(name) {
 	return null;
 }
 </script>
+{{.CustomFooter}}
 </body>
 </html>`
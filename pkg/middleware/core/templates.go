@@ -5,53 +5,82 @@ import (
 	"html/template"
 	"net/http"
 
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
 )
 
 // PageData contains common data for all pages
 type PageData struct {
 	Lang               i18n.Language
+	Dir                string // Text direction of Lang ("ltr" or "rtl")
 	Theme              i18n.Theme
 	ServiceName        string
 	ServiceDescription string
 	Title              string
 	Subtitle           string
 	Header             template.HTML // Pre-rendered header HTML
-	StyleLinks         template.HTML // Pre-rendered style links
+	StyleLinks         template.HTML // Pre-rendered stylesheet, icon and manifest links
 	CreditIcon         string
+	SkipToContent      string        // Label of the skip link to the main content
+	CustomHead         template.HTML // Custom HTML from service.custom_head_html (trusted config)
+	CustomFooter       template.HTML // Custom HTML from service.custom_footer_html (trusted config)
+	Announcement       template.HTML // Pre-rendered announcement banner (login and error pages)
 }
 
 // LoginPageData contains data for the login page
 type LoginPageData struct {
 	PageData
-	Providers        []ProviderData
+	Providers        []ProviderData    // All visible providers (including those under "Other options")
+	ProviderSections []ProviderSection // Providers grouped by section heading
+	MoreProviders    []ProviderData    // Providers shown behind the "Other options" expander
 	EmailEnabled     bool
 	PasswordEnabled  bool
 	EmailSendPath    string
 	EmailIconPath    string
 	PasswordFormHTML template.HTML
+	GuestEnabled     bool   // Show "Continue as guest"
+	GuestStartPath   string // Form action starting a guest session
+	IsGuest          bool   // The visitor already has a guest session
+	GuestNotice      string // Sign-in prompt shown to guests
+	ReauthNotice     string // Shown when a route with step-up requirements sent the user back to sign in
+	FragmentScript   string // Script saving the URL fragment for the post-login redirect
+	ButtonClass      string // Class of the provider buttons ("btn-secondary", or the login experiment variant's style)
 	Translations     LoginTranslations
 }
 
 // ProviderData contains OAuth2 provider display data
 type ProviderData struct {
-	Name     string
-	IconPath string
-	URL      string
-	Label    string
+	Name        string
+	IconPath    template.URL // Embedded icon path, icon_url or a data URI from the configuration
+	URL         string
+	Label       string
+	Section     string // Section heading (empty for the default, unheaded section)
+	MoreOptions bool   // Shown behind the "Other options" expander
+}
+
+// ProviderSection groups OAuth2 providers under a heading on the login page
+type ProviderSection struct {
+	Heading   string
+	Providers []ProviderData
 }
 
 // LoginTranslations contains translated strings for login page
 type LoginTranslations struct {
-	Or          string
-	EmailLabel  string
-	EmailSave   string
-	EmailSubmit string
-	ThemeAuto   string
-	ThemeLight  string
-	ThemeDark   string
-	LanguageEn  string
-	LanguageJa  string
+	Or            string
+	EmailLabel    string
+	EmailSave     string
+	EmailSubmit   string
+	ThemeAuto     string
+	ThemeLight    string
+	ThemeDark     string
+	LanguageEn    string
+	LanguageJa    string
+	LanguageAr    string
+	LanguageHe    string
+	ThemeLabel    string // Accessible label of the theme select
+	LanguageLabel string // Accessible label of the language select
+	MoreOptions   string
+	GuestContinue string
 }
 
 // LogoutPageData contains data for the logout page
@@ -69,12 +98,32 @@ type EmailSentPageData struct {
 	Detail         string
 	OTPLabel       string
 	OTPPlaceholder string
+	OTPSegment     string // Accessible label of each OTP segment ("{n}" and "{total}" are replaced by the script)
+	OTPError       string // Shown after an invalid or expired code was submitted
+	OTPScriptPath  string
 	VerifyButton   string
 	BackLabel      string
 	LoginURL       string
 	VerifyOTPPath  string
 }
 
+// ScopeConsentPageData contains data for the consent step of optional scopes
+type ScopeConsentPageData struct {
+	PageData
+	Message       string
+	FormPath      string // OAuth2 start URL of the provider, receiving the choice
+	Scopes        []ConsentScopeData
+	ContinueLabel string
+	SkipLabel     string
+}
+
+// ConsentScopeData contains an optional scope on the consent step
+type ConsentScopeData struct {
+	Scope       string
+	Description string
+	Approved    bool // Approved at the previous sign-in
+}
+
 // ErrorPageData contains data for error pages
 type ErrorPageData struct {
 	PageData
@@ -83,17 +132,27 @@ type ErrorPageData struct {
 	ErrorDetails template.HTML // For 500 error accordion
 	ActionURL    string
 	ActionLabel  string
+
+	// Upstream (502/504) error page
+	RetryURL       string // Empty when the request cannot be retried with a plain link
+	RetryLabel     string
+	RequestID      string
+	RequestIDLabel string
 }
 
 // Templates holds all parsed templates
 type Templates struct {
-	login     *template.Template
-	logout    *template.Template
-	emailSent *template.Template
-	forbidden *template.Template
-	emailReq  *template.Template
-	notFound  *template.Template
-	server    *template.Template
+	login           *template.Template
+	logout          *template.Template
+	emailSent       *template.Template
+	forbidden       *template.Template
+	emailReq        *template.Template
+	emailUnverified *template.Template
+	notFound        *template.Template
+	server          *template.Template
+	upstream        *template.Template
+	guestLimit      *template.Template
+	scopeConsent    *template.Template
 }
 
 // newTemplates creates and parses all templates
@@ -132,6 +191,12 @@ func newTemplates() (*Templates, error) {
 		return nil, err
 	}
 
+	// Parse email unverified template
+	t.emailUnverified, err = template.New("emailUnverified").Parse(emailUnverifiedTemplate)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse 404 template
 	t.notFound, err = template.New("notFound").Parse(notFoundTemplate)
 	if err != nil {
@@ -144,6 +209,24 @@ func newTemplates() (*Templates, error) {
 		return nil, err
 	}
 
+	// Parse upstream 502/504 template
+	t.upstream, err = template.New("upstream").Parse(upstreamErrorTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse guest limit template
+	t.guestLimit, err = template.New("guestLimit").Parse(guestLimitTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse scope consent template
+	t.scopeConsent, err = template.New("scopeConsent").Parse(scopeConsentTemplate)
+	if err != nil {
+		return nil, err
+	}
+
 	return t, nil
 }
 
@@ -154,11 +237,7 @@ func renderTemplate(w http.ResponseWriter, tmpl *template.Template, data interfa
 		return err
 	}
 
-	m.setSecurityHeaders(w)
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write(buf.Bytes())
-	return err
+	return m.writeHTML(w, http.StatusOK, buf.Bytes())
 }
 
 // renderErrorTemplate renders an error template with a specific status code
@@ -168,27 +247,30 @@ func renderErrorTemplate(w http.ResponseWriter, tmpl *template.Template, data in
 		return err
 	}
 
-	m.setSecurityHeaders(w)
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(statusCode)
-	_, err := w.Write(buf.Bytes())
-	return err
+	return m.writeHTML(w, statusCode, buf.Bytes())
 }
 
 // buildPageData builds common page data
-func (m *Middleware) buildPageData(lang i18n.Language, theme i18n.Theme, titleKey string) PageData {
+// The header, style links and credit icon are built once (see staticFragments)
+// page is one of the config.Page* names and selects the custom head/footer HTML
+func (m *Middleware) buildPageData(lang i18n.Language, theme i18n.Theme, page, titleKey string) PageData {
 	t := func(key string) string { return m.translator.T(lang, key) }
-	prefix := m.config.Server.GetAuthPathPrefix()
+	fragments := m.staticFragments()
+	customHead, customFooter := m.config.Service.CustomHTMLFor(page)
 
 	return PageData{
 		Lang:               lang,
+		Dir:                i18n.Direction(lang),
 		Theme:              theme,
 		ServiceName:        m.config.Service.Name,
 		ServiceDescription: m.config.Service.Description,
 		Title:              t(titleKey),
-		Header:             template.HTML(m.buildAuthHeaderHTML(prefix)),
-		StyleLinks:         template.HTML(m.buildStyleLinksHTML()),
-		CreditIcon:         joinAuthPath(normalizeAuthPrefix(prefix), "/assets/icons/chatbotgate.svg"),
+		Header:             fragments.header,
+		StyleLinks:         fragments.styleLinks,
+		CreditIcon:         fragments.creditIcon,
+		SkipToContent:      t("ui.skip_to_content"),
+		CustomHead:         template.HTML(customHead),
+		CustomFooter:       template.HTML(customFooter),
 	}
 }
 
@@ -221,14 +303,16 @@ func (m *Middleware) buildAuthHeaderHTML(prefix string) string {
 }
 
 // buildStyleLinksHTML generates stylesheet link tags
+// The links are fingerprinted with the content hash of the stylesheets, so they are cached
+// forever and still change with the theme and on upgrades
 func (m *Middleware) buildStyleLinksHTML() string {
-	prefix := m.config.Server.GetAuthPathPrefix()
-	cssPath := joinAuthPath(prefix, "/assets/main.css")
+	prefix := m.config.Server.GetPublicAuthPathPrefix()
+	cssPath := joinAuthPath(prefix, "/assets/"+assets.Fingerprint("main.css", buildMainCSS(m.config.Service.Theme).Hash))
 	links := `<link rel="stylesheet" href="` + template.HTMLEscapeString(cssPath) + `">`
 
 	// Add dify.css if optimization is enabled
 	if m.config.Assets.Optimization.Dify {
-		difyCSSPath := joinAuthPath(prefix, "/assets/dify.css")
+		difyCSSPath := assetURL(prefix, "dify.css")
 		links += `
 <link rel="stylesheet" href="` + template.HTMLEscapeString(difyCSSPath) + `">`
 	}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/assets"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// buildThemeCSS generates CSS overrides for the configured theming tokens
+// The result is appended to the embedded stylesheet, so later rules win
+// Values that are not safe to embed are skipped (they are also rejected by config validation)
+func buildThemeCSS(theme config.ThemeConfig) string {
+	if theme.IsEmpty() {
+		return ""
+	}
+
+	var vars []string
+	addVar := func(name, value string) {
+		if value != "" && config.IsSafeCSSValue(value) {
+			vars = append(vars, "  "+name+": "+value+";")
+		}
+	}
+
+	hover := theme.PrimaryHoverColor
+	if hover == "" {
+		hover = theme.PrimaryColor
+	}
+	addVar("--color-primary", theme.PrimaryColor)
+	addVar("--color-primary-hover", hover)
+	addVar("--radius-md", theme.BorderRadius)
+	addVar("--radius-lg", theme.BorderRadius)
+	addVar("--radius-xl", theme.BorderRadius)
+
+	var b strings.Builder
+	b.WriteString("\n/* Theme overrides (service.theme) */\n")
+	if len(vars) > 0 {
+		b.WriteString(":root {\n" + strings.Join(vars, "\n") + "\n}\n")
+	}
+
+	var body []string
+	if theme.FontFamily != "" && config.IsSafeCSSValue(theme.FontFamily) {
+		body = append(body, "  font-family: "+theme.FontFamily+";")
+	}
+	if theme.BackgroundImage != "" && config.IsSafeCSSValue(theme.BackgroundImage) && !strings.ContainsAny(theme.BackgroundImage, `"'\() `) {
+		body = append(body,
+			`  background-image: url("`+theme.BackgroundImage+`");`,
+			"  background-size: cover;",
+			"  background-position: center;",
+			"  background-attachment: fixed;",
+		)
+	}
+	if len(body) > 0 {
+		b.WriteString("body {\n" + strings.Join(body, "\n") + "\n}\n")
+	}
+
+	switch theme.CardStyle {
+	case config.CardStyleFlat:
+		b.WriteString(".card {\n  border-color: transparent;\n  box-shadow: none;\n}\n")
+	case config.CardStyleBordered:
+		b.WriteString(".card {\n  box-shadow: none;\n}\n")
+	}
+
+	return b.String()
+}
+
+// buildMainCSS returns the embedded CSS followed by the theme overrides, with its content hash
+func buildMainCSS(theme config.ThemeConfig) assets.Asset {
+	return assets.NewAsset([]byte(assets.GetEmbeddedCSS() + buildThemeCSS(theme)))
+}
@@ -144,15 +144,15 @@ func ValidateConfig(cfg *config.Config) ValidationErrors {
 					Message: fmt.Sprintf("client ID is required for provider '%s'", provider.Type),
 				})
 			}
-			if provider.ClientSecret == "" {
+			if provider.ClientSecret == "" && provider.GetClientAuthMethod() == config.ClientAuthSecret {
 				errs = append(errs, ValidationError{
 					Field:   fmt.Sprintf("oauth2.providers[%d].client_secret", i),
 					Message: fmt.Sprintf("client secret is required for provider '%s'", provider.Type),
 				})
 			}
 
-			// Validate custom provider
-			if provider.Type == "custom" {
+			// Validate custom provider (endpoints come from the discovery document with issuer_url)
+			if provider.Type == "custom" && provider.IssuerURL == "" {
 				if provider.AuthURL == "" {
 					errs = append(errs, ValidationError{
 						Field:   fmt.Sprintf("oauth2.providers[%d].auth_url", i),
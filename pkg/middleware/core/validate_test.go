@@ -493,3 +493,21 @@ func TestValidateConfig_MultipleErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateConfig_CustomOAuth2ProviderWithIssuer(t *testing.T) {
+	cfg := validConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{
+		{
+			ID:           "custom",
+			Type:         "custom",
+			ClientID:     "test-client-id",
+			ClientSecret: "test-client-secret",
+			IssuerURL:    "https://idp.example.com",
+			// Endpoints come from the discovery document
+		},
+	}
+
+	if errs := ValidateConfig(cfg); errs != nil {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+}
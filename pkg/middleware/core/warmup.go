@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+)
+
+// warmUpDiscoveryTimeout bounds the OIDC discovery of a single custom provider during warm-up
+const warmUpDiscoveryTimeout = 10 * time.Second
+
+// WarmUp prepares the middleware for traffic while the readiness check reports "warming"
+// It opens the KVS connection, fetches the OIDC discovery documents of custom providers and
+// builds the page fragments, so the first requests do not pay for them. Templates and rules are
+// compiled when the middleware is created; SetReady renders the login pages afterwards.
+// Failures are logged and never block readiness: discovery is retried at sign-in.
+// Only a starting middleware reports "warming", so warming up again never takes a ready one out.
+func (m *Middleware) WarmUp(ctx context.Context) {
+	m.healthStatus.CompareAndSwap(HealthStatusStarting, HealthStatusWarming)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	if m.sessionStore != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The first round trip establishes the connection (Redis pool, LevelDB files)
+			if _, err := m.sessionStore.Exists(ctx, "warm-up"); err != nil {
+				m.logger.Warn("KVS warm-up failed", "error", err)
+			}
+		}()
+	}
+	if m.oauthManager != nil {
+		for _, p := range m.config.OAuth2.Providers {
+			provider, err := m.oauthManager.GetProvider(p.ID)
+			if err != nil {
+				continue
+			}
+			custom, ok := provider.(*oauth2.CustomProvider)
+			if !ok || custom.DiscoveryURL() == "" {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				discoveryCtx, cancel := context.WithTimeout(ctx, warmUpDiscoveryTimeout)
+				defer cancel()
+				if err := custom.Discover(m.oauthManager.HTTPContext(discoveryCtx)); err != nil {
+					// Keep the provider: discovery is retried when users sign in
+					m.logger.Warn("OIDC discovery failed, retrying at sign-in", "id", p.ID, "issuer_url", p.IssuerURL, "error", err)
+					return
+				}
+				m.logger.Debug("OIDC discovery succeeded", "id", p.ID, "token_url", custom.Config().Endpoint.TokenURL)
+			}()
+		}
+	}
+	m.staticFragments()
+	wg.Wait()
+
+	m.logger.Debug("Middleware warmed up", "duration", time.Since(start))
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+func TestWarmUp(t *testing.T) {
+	// The issuer answers discovery only once the test has seen the warming state
+	release := make(chan struct{})
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q}`,
+			issuer.URL, issuer.URL+"/authorize", issuer.URL+"/token")
+	}))
+	defer issuer.Close()
+
+	cfg := newTestConfig()
+	cfg.OAuth2.Providers = []config.OAuth2Provider{{ID: "oidc", Type: "custom", IssuerURL: issuer.URL}}
+	mw, _ := newTestMiddleware(t, cfg)
+	provider := oauth2.NewCustomProvider("oidc", "client", "secret", "http://localhost/_auth/oauth2/callback", "", "", "", nil, false)
+	provider.SetIssuer(issuer.URL, 0)
+	mw.oauthManager.AddProvider(provider)
+
+	done := make(chan struct{})
+	go func() {
+		mw.WarmUp(context.Background())
+		close(done)
+	}()
+
+	for mw.GetHealthStatus() != HealthStatusWarming {
+		select {
+		case <-done:
+			t.Fatal("WarmUp() finished before the issuer answered")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if code, response := readiness(t, mw); code != http.StatusServiceUnavailable || response.Status != "warming" {
+		t.Errorf("during warm-up: status = %d, health = %q, want 503 warming", code, response.Status)
+	}
+
+	close(release)
+	<-done
+	if got := provider.Config().Endpoint.TokenURL; got != issuer.URL+"/token" {
+		t.Errorf("token URL = %q, want the discovered endpoint", got)
+	}
+
+	mw.SetReady()
+	if code, response := readiness(t, mw); code != http.StatusOK || response.Status != "ready" {
+		t.Errorf("after SetReady: status = %d, health = %q, want 200 ready", code, response.Status)
+	}
+
+	// Warming up again keeps a ready middleware ready
+	mw.WarmUp(context.Background())
+	if mw.GetHealthStatus() != HealthStatusReady {
+		t.Errorf("status = %q after a second warm-up, want ready", mw.GetHealthStatus())
+	}
+}
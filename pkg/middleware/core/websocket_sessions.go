@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webSocketCloseTimeout is how long a connection whose session ended may take to reach the end of
+// the frame being copied, before it is closed without close frame
+const webSocketCloseTimeout = 5 * time.Second
+
+// webSocketCloseReason is the reason of the close frame of connections whose session ended
+const webSocketCloseReason = "session ended"
+
+// isWebSocketUpgrade reports whether the request opens a WebSocket connection
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// watchWebSocketSession returns w with the connection hijacked by the proxy watched: once the session
+// of the request cookie has expired or been revoked, the connection is closed with session.websocket.close_code
+func (m *Middleware) watchWebSocketSession(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if m.config.Session.WebSocket.Disabled || !isWebSocketUpgrade(r) {
+		return w
+	}
+	cookie, err := r.Cookie(m.config.Session.Cookie.Name)
+	if err != nil {
+		return w
+	}
+	return &sessionTunnelWriter{ResponseWriter: w, m: m, sessionID: cookie.Value, path: r.URL.Path}
+}
+
+// sessionTunnelWriter is the response writer of a WebSocket upgrade, watching the connection once hijacked
+type sessionTunnelWriter struct {
+	http.ResponseWriter
+	m         *Middleware
+	sessionID string
+	path      string
+}
+
+func (w *sessionTunnelWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The handshake is written through brw to conn directly; frames copied from the upstream go through tunnel
+	tunnel := &sessionTunnel{Conn: conn, done: make(chan struct{})}
+	go w.m.watchTunnel(tunnel, w.sessionID, w.path)
+	return tunnel, brw, nil
+}
+
+func (w *sessionTunnelWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// watchTunnel checks the session of tunnel periodically and when it is due to expire, until the tunnel is closed
+func (m *Middleware) watchTunnel(tunnel *sessionTunnel, sessionID, path string) {
+	cfg := m.config.Session.WebSocket
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-tunnel.done:
+			return
+		case <-timer.C:
+		}
+
+		sess, ok := m.activeSession(sessionID)
+		if !ok {
+			break
+		}
+		wait := cfg.GetInterval()
+		if untilExpiry := sess.ExpiresAt.Sub(m.clock.Now()); untilExpiry < wait {
+			// Check again right after the expiry (a sliding refresh may have extended it meanwhile)
+			wait = untilExpiry + time.Millisecond
+		}
+		timer.Reset(wait)
+	}
+
+	if grace := cfg.GetGrace(); grace > 0 {
+		timer.Reset(grace)
+		select {
+		case <-tunnel.done:
+			return
+		case <-timer.C:
+		}
+	}
+
+	m.logger.Info("Closing WebSocket connection: session ended", "path", path)
+	if !tunnel.closeWith(cfg.GetCloseCode(), webSocketCloseReason) {
+		// A frame is being copied: closeWith closes after it, or the timeout does
+		timer.Reset(webSocketCloseTimeout)
+		select {
+		case <-tunnel.done:
+		case <-timer.C:
+			_ = tunnel.Close()
+		}
+	}
+}
+
+// sessionTunnel is the client side of a proxied WebSocket connection
+// Writes are the frames the proxy copies from the upstream; they are tracked so that the close frame
+// of an ended session is written between two frames.
+type sessionTunnel struct {
+	net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+
+	closeFrame atomic.Pointer[[]byte] // Close frame waiting for the end of the frame being written
+
+	mu     sync.Mutex // Held while writing
+	frames frameTracker
+	closed bool
+}
+
+func (t *sessionTunnel) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		if t.closed {
+			return written, net.ErrClosed
+		}
+		end := written + t.frames.advance(p[written:])
+		n, err := t.Conn.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if frame := t.closeFrame.Load(); frame != nil && t.frames.boundary() {
+			t.writeCloseFrame(*frame)
+		}
+	}
+	return written, nil
+}
+
+// closeWith sends a close frame with code and reason and closes the connection, or reports false when
+// a frame is being written: the close frame follows it then
+// It never waits for a write, which blocks as long as the browser does not read.
+func (t *sessionTunnel) closeWith(code int, reason string) bool {
+	frame := make([]byte, 4, 4+len(reason))
+	frame[0] = 0x88 // FIN, close
+	frame[1] = byte(2 + len(reason))
+	binary.BigEndian.PutUint16(frame[2:], uint16(code))
+	frame = append(frame, reason...)
+	t.closeFrame.Store(&frame)
+
+	if !t.mu.TryLock() {
+		return false
+	}
+	defer t.mu.Unlock()
+	if t.closed {
+		return true
+	}
+	if !t.frames.boundary() {
+		return false
+	}
+	t.writeCloseFrame(frame)
+	return true
+}
+
+// writeCloseFrame writes a close frame and closes the connection (t.mu held)
+func (t *sessionTunnel) writeCloseFrame(frame []byte) {
+	_ = t.Conn.SetWriteDeadline(time.Now().Add(webSocketCloseTimeout))
+	_, _ = t.Conn.Write(frame)
+	t.closed = true
+	_ = t.Close()
+}
+
+func (t *sessionTunnel) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		err = t.Conn.Close()
+	})
+	return err
+}
+
+// frameTracker follows the WebSocket frames of a byte stream, to find the boundaries between frames
+type frameTracker struct {
+	header    []byte // Bytes of the current frame header seen so far
+	remaining uint64 // Payload bytes left in the current frame
+}
+
+// boundary reports whether the stream seen so far ends between two frames
+func (f *frameTracker) boundary() bool {
+	return len(f.header) == 0 && f.remaining == 0
+}
+
+// advance consumes p up to the end of the current frame, and returns the number of bytes consumed (len(p) when it does not end in p)
+func (f *frameTracker) advance(p []byte) int {
+	n := 0
+	for n < len(p) {
+		if f.remaining > 0 {
+			k := min(uint64(len(p)-n), f.remaining)
+			n += int(k)
+			f.remaining -= k
+			if f.remaining == 0 {
+				return n
+			}
+			continue
+		}
+
+		f.header = append(f.header, p[n])
+		n++
+		if size := frameHeaderSize(f.header); size > 0 && len(f.header) == size {
+			f.remaining = framePayloadLength(f.header)
+			f.header = f.header[:0]
+			if f.remaining == 0 {
+				return n
+			}
+		}
+	}
+	return n
+}
+
+// frameHeaderSize returns the size of a frame header from its first bytes, or 0 when they are not enough
+func frameHeaderSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4 // Masking key
+	}
+	return size
+}
+
+// framePayloadLength returns the payload length of a complete frame header
+func framePayloadLength(header []byte) uint64 {
+	switch length := header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(header[2:10])
+	default:
+		return uint64(length)
+	}
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/session"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// wsFrame encodes an unmasked server frame
+func wsFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	return append(frame, payload...)
+}
+
+func TestFrameTracker(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		wsFrame(0x1, []byte("hello")),
+		wsFrame(0x2, bytes.Repeat([]byte("x"), 300)),
+		wsFrame(0x9, nil),
+		wsFrame(0x2, bytes.Repeat([]byte("y"), 70000)),
+	}, nil)
+	boundaries := map[int]bool{7: true, 7 + 304: true, 7 + 304 + 2: true, len(stream): true}
+
+	// Whatever the chunks, advance stops exactly at the frame boundaries
+	for _, chunk := range []int{1, 3, 100, len(stream)} {
+		var f frameTracker
+		pos := 0
+		for pos < len(stream) {
+			end := min(pos+chunk, len(stream))
+			for pos < end {
+				pos += f.advance(stream[pos:end])
+				if f.boundary() != boundaries[pos] {
+					t.Fatalf("chunk %d: boundary() = %v at %d", chunk, f.boundary(), pos)
+				}
+			}
+		}
+	}
+
+	// Masked frames (sent by clients) have a masking key
+	var f frameTracker
+	masked := []byte{0x81, 0x82, 1, 2, 3, 4, 'h', 'i'}
+	if n := f.advance(masked); n != len(masked) || !f.boundary() {
+		t.Errorf("Masked frame: advance() = %d, boundary() = %v", n, f.boundary())
+	}
+}
+
+// newWebSocketTestServer serves a WebSocket upstream that sends a text frame, behind the middleware
+func newWebSocketTestServer(t *testing.T, mw *Middleware) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_, _ = brw.Write(wsFrame(0x1, []byte("hello")))
+		_ = brw.Flush()
+		_, _ = io.Copy(io.Discard, conn) // Until the proxy closes the connection
+	}))
+	t.Cleanup(upstream.Close)
+
+	target, _ := url.Parse(upstream.URL)
+	front := httptest.NewServer(mw.Wrap(httputil.NewSingleHostReverseProxy(target)))
+	t.Cleanup(front.Close)
+	return front
+}
+
+// dialWebSocket opens a WebSocket connection with the session cookie and reads the first frame
+func dialWebSocket(t *testing.T, server *httptest.Server, sessionID string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.AddCookie(&http.Cookie{Name: "_test_session", Value: sessionID})
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Handshake status = %d, want 101", resp.StatusCode)
+	}
+	if opcode, payload := readWSFrame(t, conn, reader); opcode != 0x1 || string(payload) != "hello" {
+		t.Fatalf("First frame = %x %q, want the upstream's text frame", opcode, payload)
+	}
+	return conn, reader
+}
+
+func readWSFrame(t *testing.T, conn net.Conn, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read frame payload: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestWebSocketSession_ClosedOnRevocation(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Session.WebSocket.Interval = "20ms"
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+	server := newWebSocketTestServer(t, mw)
+
+	conn, reader := dialWebSocket(t, server, sessionID)
+	if err := session.Delete(store, sessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	opcode, payload := readWSFrame(t, conn, reader)
+	if opcode != 0x8 || len(payload) < 2 {
+		t.Fatalf("Frame = %x %q, want a close frame", opcode, payload)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != 4401 {
+		t.Errorf("Close code = %d, want 4401", code)
+	}
+	if string(payload[2:]) != webSocketCloseReason {
+		t.Errorf("Close reason = %q", payload[2:])
+	}
+	if _, err := reader.ReadByte(); err == nil {
+		t.Error("Connection should be closed after the close frame")
+	}
+}
+
+func TestWebSocketSession_ExpiryWithGrace(t *testing.T) {
+	now := time.Now()
+	fake := clock.NewFake(now)
+
+	cfg := newTestConfig()
+	cfg.Session.WebSocket.Interval = "20ms"
+	cfg.Session.WebSocket.Grace = "200ms"
+	cfg.Session.WebSocket.CloseCode = 4000
+	mw, store := newTestMiddleware(t, cfg)
+	mw.clock = fake
+	sessionID := storeTestSession(t, store, "user@example.com")
+	server := newWebSocketTestServer(t, mw)
+
+	conn, reader := dialWebSocket(t, server, sessionID)
+	fake.Advance(2 * time.Hour)
+	expired := time.Now()
+
+	opcode, payload := readWSFrame(t, conn, reader)
+	if opcode != 0x8 || binary.BigEndian.Uint16(payload) != 4000 {
+		t.Fatalf("Frame = %x %q, want a close frame with code 4000", opcode, payload)
+	}
+	if elapsed := time.Since(expired); elapsed < 200*time.Millisecond {
+		t.Errorf("Closed %v after the expiry, want the 200ms grace first", elapsed)
+	}
+}
+
+func TestWebSocketSession_Disabled(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Session.WebSocket = config.WebSocketSessionConfig{Disabled: true, Interval: "20ms"}
+	mw, store := newTestMiddleware(t, cfg)
+	sessionID := storeTestSession(t, store, "user@example.com")
+	server := newWebSocketTestServer(t, mw)
+
+	conn, reader := dialWebSocket(t, server, sessionID)
+	if err := session.Delete(store, sessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	if _, err := reader.ReadByte(); err == nil {
+		t.Error("Connection should stay open without session checks")
+	} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("Read error = %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package dify implements the Dify integration mode.
+// Requests of authenticated users to the Dify API get the server-side app API key
+// and the user's identity in Dify's "user" field, so the key is never exposed to browsers.
+package dify
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+)
+
+var (
+	// ErrBodyTooLarge is returned when a JSON request body exceeds forwarding.MaxJSONBodyBytes
+	ErrBodyTooLarge = forwarding.ErrBodyTooLarge
+
+	// ErrInvalidBody is returned when a JSON request body is not a JSON object
+	ErrInvalidBody = forwarding.ErrInvalidBody
+
+	// ErrUnsupportedBody is returned for a request body that is neither JSON nor multipart form data,
+	// since its user field could not be overwritten
+	ErrUnsupportedBody = errors.New("dify request body must be JSON or multipart form data")
+)
+
+// userField is the name of Dify's end-user identifier in queries, JSON bodies and form data
+const userField = "user"
+
+// Injector adds the Dify API key and the user identifier to Dify API requests
+type Injector struct {
+	apiKey    string
+	apiPath   string
+	userField string
+}
+
+// NewInjector creates a new Injector
+// Returns nil when the integration is disabled
+func NewInjector(cfg config.DifyConfig) *Injector {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Injector{
+		apiKey:    cfg.APIKey,
+		apiPath:   cfg.GetAPIPath(),
+		userField: cfg.GetUserField(),
+	}
+}
+
+// Matches reports whether the request path belongs to the Dify API
+func (i *Injector) Matches(path string) bool {
+	return path == i.apiPath || strings.HasPrefix(path, i.apiPath+"/")
+}
+
+// User returns the Dify user identifier for an authenticated user
+func (i *Injector) User(email, name string) string {
+	return UserID(i.userField, email, name)
+}
+
+// UserID returns the Dify user identifier selected by userField (one of the config.DifyUser* values)
+func UserID(userField, email, name string) string {
+	switch userField {
+	case config.DifyUserUsername:
+		if name != "" {
+			return name
+		}
+	case config.DifyUserUserpart:
+		if at := strings.Index(email, "@"); at > 0 {
+			return email[:at]
+		}
+	}
+	return email
+}
+
+// Apply sets the Authorization header and overwrites the user field of the request
+// The user is set in the query string for requests without a body (e.g., GET /v1/messages),
+// and in JSON or multipart bodies (e.g., POST /v1/chat-messages, POST /v1/files/upload)
+// Other bodies return ErrUnsupportedBody, so that no client-supplied user reaches Dify.
+func (i *Injector) Apply(r *http.Request, user string) error {
+	// Replace any client-supplied credentials
+	r.Header.Set("Authorization", "Bearer "+i.apiKey)
+
+	q := r.URL.Query()
+	if r.Body == nil || r.Body == http.NoBody || q.Has(userField) {
+		q.Set(userField, user)
+		r.URL.RawQuery = q.Encode()
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ErrUnsupportedBody
+	}
+	switch {
+	case mediaType == "application/json":
+		return forwarding.SetJSONBodyFields(r, map[string]string{userField: user})
+	case mediaType == "multipart/form-data" && params["boundary"] != "":
+		rewriteMultipart(r, params["boundary"], user)
+		return nil
+	}
+	return ErrUnsupportedBody
+}
+
+// rewriteMultipart replaces the user form field of a multipart body
+// The body is streamed so that file uploads are not buffered in memory
+// The caller must close r.Body when done so the copying goroutine exits
+func rewriteMultipart(r *http.Request, boundary, user string) {
+	src := r.Body
+	pr, pw := io.Pipe()
+
+	go func() {
+		err := copyMultipart(multipart.NewReader(src, boundary), multipart.NewWriter(pw), boundary, user)
+		_ = src.Close()
+		_ = pw.CloseWithError(err)
+	}()
+
+	// The length changes, so the body is sent chunked
+	r.Body = pr
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+	r.GetBody = nil
+}
+
+// copyMultipart copies every part except the user field, then appends the user field
+func copyMultipart(mr *multipart.Reader, mw *multipart.Writer, boundary, user string) error {
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if part.FormName() == userField {
+			continue
+		}
+
+		w, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, part); err != nil {
+			return err
+		}
+	}
+
+	if err := mw.WriteField(userField, user); err != nil {
+		return err
+	}
+	return mw.Close()
+}
@@ -0,0 +1,192 @@
+package dify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+)
+
+func newTestInjector(userField string) *Injector {
+	return NewInjector(config.DifyConfig{Enabled: true, APIKey: "app-secret", UserField: userField})
+}
+
+func TestNewInjector_Disabled(t *testing.T) {
+	if i := NewInjector(config.DifyConfig{APIKey: "app-secret"}); i != nil {
+		t.Error("NewInjector() should return nil when disabled")
+	}
+}
+
+func TestInjector_Matches(t *testing.T) {
+	i := newTestInjector("")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/v1", true},
+		{"/v1/chat-messages", true},
+		{"/v10/chat-messages", false},
+		{"/chat", false},
+	}
+	for _, tt := range tests {
+		if got := i.Matches(tt.path); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestInjector_User(t *testing.T) {
+	tests := []struct {
+		field string
+		name  string
+		want  string
+	}{
+		{config.DifyUserEmail, "Alice", "alice@example.com"},
+		{config.DifyUserUsername, "Alice", "Alice"},
+		{config.DifyUserUsername, "", "alice@example.com"},
+		{config.DifyUserUserpart, "Alice", "alice"},
+	}
+	for _, tt := range tests {
+		if got := newTestInjector(tt.field).User("alice@example.com", tt.name); got != tt.want {
+			t.Errorf("User() with %s = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestInjector_Apply_Query(t *testing.T) {
+	i := newTestInjector("")
+	req := httptest.NewRequest("GET", "/v1/messages?conversation_id=c1&user=attacker", nil)
+	req.Header.Set("Authorization", "Bearer client-key")
+
+	if err := i.Apply(req, "alice@example.com"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if got := req.Header.Get("Authorization"); got != "Bearer app-secret" {
+		t.Errorf("Authorization = %q, want the server-side key", got)
+	}
+	q := req.URL.Query()
+	if got := q.Get("user"); got != "alice@example.com" {
+		t.Errorf("user = %q, want alice@example.com", got)
+	}
+	if got := q.Get("conversation_id"); got != "c1" {
+		t.Errorf("conversation_id = %q, want c1", got)
+	}
+}
+
+func TestInjector_Apply_JSON(t *testing.T) {
+	i := newTestInjector("")
+
+	t.Run("user is overwritten and other fields are kept", func(t *testing.T) {
+		body := `{"query":"hello","inputs":{"n":12345678901234567890},"user":"attacker"}`
+		req := httptest.NewRequest("POST", "/v1/chat-messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+		if err := i.Apply(req, "alice@example.com"); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+
+		data, _ := io.ReadAll(req.Body)
+		if req.ContentLength != int64(len(data)) {
+			t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(data))
+		}
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Invalid JSON body: %v", err)
+		}
+		if string(got["user"]) != `"alice@example.com"` {
+			t.Errorf("user = %s, want alice@example.com", got["user"])
+		}
+		if string(got["inputs"]) != `{"n":12345678901234567890}` {
+			t.Errorf("inputs = %s, want the original value", got["inputs"])
+		}
+		if req.URL.Query().Has("user") {
+			t.Error("Did not expect user in the query string of a JSON request")
+		}
+	})
+
+	t.Run("non-object body", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat-messages", strings.NewReader(`["x"]`))
+		req.Header.Set("Content-Type", "application/json")
+
+		if err := i.Apply(req, "alice@example.com"); !errors.Is(err, ErrInvalidBody) {
+			t.Errorf("Apply() error = %v, want %v", err, ErrInvalidBody)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		body := `{"query":"` + strings.Repeat("a", forwarding.MaxJSONBodyBytes) + `"}`
+		req := httptest.NewRequest("POST", "/v1/chat-messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		if err := i.Apply(req, "alice@example.com"); !errors.Is(err, ErrBodyTooLarge) {
+			t.Errorf("Apply() error = %v, want %v", err, ErrBodyTooLarge)
+		}
+	})
+}
+
+func TestInjector_Apply_Multipart(t *testing.T) {
+	i := newTestInjector("")
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField("user", "attacker")
+	fw, _ := w.CreateFormFile("file", "note.txt")
+	_, _ = fw.Write([]byte("file contents"))
+	_ = w.Close()
+
+	req := httptest.NewRequest("POST", "/v1/files/upload", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	if err := i.Apply(req, "alice@example.com"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	defer func() { _ = req.Body.Close() }()
+
+	if req.ContentLength != -1 {
+		t.Errorf("ContentLength = %d, want -1 (chunked)", req.ContentLength)
+	}
+
+	_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	form, err := multipart.NewReader(req.Body, params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("Invalid multipart body: %v", err)
+	}
+	if got := form.Value["user"]; len(got) != 1 || got[0] != "alice@example.com" {
+		t.Errorf("user = %v, want [alice@example.com]", got)
+	}
+	files := form.File["file"]
+	if len(files) != 1 {
+		t.Fatalf("file parts = %d, want 1", len(files))
+	}
+	f, _ := files[0].Open()
+	contents, _ := io.ReadAll(f)
+	if string(contents) != "file contents" {
+		t.Errorf("file contents = %q", contents)
+	}
+}
+
+func TestInjector_Apply_UnsupportedBody(t *testing.T) {
+	i := newTestInjector("")
+
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", "multipart/form-data", ""} {
+		t.Run(contentType, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat-messages", strings.NewReader("user=attacker"))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if err := i.Apply(req, "alice@example.com"); !errors.Is(err, ErrUnsupportedBody) {
+				t.Errorf("Apply() error = %v, want %v", err, ErrUnsupportedBody)
+			}
+		})
+	}
+}
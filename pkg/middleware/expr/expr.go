@@ -0,0 +1,280 @@
+// Package expr evaluates CEL (Common Expression Language) expressions against the signed-in user.
+//
+// Expressions are used in forwarding field values and rule requirements, e.g.
+// `email.endsWith("@example.com") && "admins" in groups`. They see the user's email, username,
+// provider, groups, roles and provider data (extra), and the request's method, path, host and
+// headers (lower-case names). The CEL string extensions (lowerAscii, split, ...) are available, and
+// shard(key, count) returns the consistent-hash shard of a key (e.g., `shard(email, 16)`).
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrExpressionInvalid is returned when an expression does not compile
+var ErrExpressionInvalid = errors.New("invalid expression")
+
+// Vars are the variables of an expression
+type Vars struct {
+	Email    string
+	Username string
+	Provider string
+	Groups   []string
+	Roles    []string
+	Extra    map[string]interface{} // Provider data
+
+	Method  string
+	Path    string
+	Host    string
+	Headers map[string]string // Lower-case header names, first value
+}
+
+// NewUserVars returns the variables of a signed-in user
+// Groups and roles are read from the "groups" and "roles" keys of extra (comma-separated or lists).
+func NewUserVars(username, email, provider string, extra map[string]interface{}) Vars {
+	return Vars{
+		Email:    email,
+		Username: username,
+		Provider: provider,
+		Groups:   listOf(extra["groups"]),
+		Roles:    listOf(extra["roles"]),
+		Extra:    extra,
+	}
+}
+
+// WithRequest returns vars with the request variables of r
+func (v Vars) WithRequest(r *http.Request) Vars {
+	v.Method = r.Method
+	v.Path = r.URL.Path
+	v.Host = r.Host
+	v.Headers = make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			v.Headers[strings.ToLower(name)] = values[0]
+		}
+	}
+	return v
+}
+
+// activation returns the variables in the form passed to CEL programs
+func (v Vars) activation() map[string]interface{} {
+	groups, roles, extra, headers := v.Groups, v.Roles, v.Extra, v.Headers
+	if groups == nil {
+		groups = []string{}
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return map[string]interface{}{
+		"email":    v.Email,
+		"username": v.Username,
+		"provider": v.Provider,
+		"groups":   groups,
+		"roles":    roles,
+		"extra":    extra,
+		"method":   v.Method,
+		"path":     v.Path,
+		"host":     v.Host,
+		"headers":  headers,
+	}
+}
+
+var (
+	envOnce sync.Once
+	env     *cel.Env
+	envErr  error
+)
+
+// environment returns the CEL environment declaring the variables of Vars
+func environment() (*cel.Env, error) {
+	envOnce.Do(func() {
+		env, envErr = cel.NewEnv(
+			cel.Variable("email", cel.StringType),
+			cel.Variable("username", cel.StringType),
+			cel.Variable("provider", cel.StringType),
+			cel.Variable("groups", cel.ListType(cel.StringType)),
+			cel.Variable("roles", cel.ListType(cel.StringType)),
+			cel.Variable("extra", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("method", cel.StringType),
+			cel.Variable("path", cel.StringType),
+			cel.Variable("host", cel.StringType),
+			cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+			ext.Strings(),
+			shardFunction,
+		)
+	})
+	return env, envErr
+}
+
+// compile parses and type-checks an expression
+func compile(source string) (*cel.Ast, error) {
+	e, err := environment()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := e.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExpressionInvalid, issues.Err())
+	}
+	return ast, nil
+}
+
+// program creates the evaluable program of a checked expression
+func program(ast *cel.Ast) (cel.Program, error) {
+	e, err := environment()
+	if err != nil {
+		return nil, err
+	}
+	prg, err := e.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExpressionInvalid, err)
+	}
+	return prg, nil
+}
+
+// Condition is a compiled boolean expression
+type Condition struct {
+	source  string
+	program cel.Program
+}
+
+// CompileCondition compiles an expression that must evaluate to a bool
+func CompileCondition(source string) (*Condition, error) {
+	ast, err := compile(source)
+	if err != nil {
+		return nil, err
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("%w: condition must evaluate to bool, not %s", ErrExpressionInvalid, ast.OutputType())
+	}
+	prg, err := program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &Condition{source: source, program: prg}, nil
+}
+
+// String returns the source of the condition
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Eval evaluates the condition
+// Evaluation errors (e.g., a missing extra key) return false with the error.
+func (c *Condition) Eval(vars Vars) (bool, error) {
+	out, _, err := c.program.Eval(vars.activation())
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %s, not bool", out.Type().TypeName())
+	}
+	return result, nil
+}
+
+// Value is a compiled expression producing a string value
+type Value struct {
+	source  string
+	program cel.Program
+}
+
+// CompileValue compiles an expression whose result is converted to a string
+func CompileValue(source string) (*Value, error) {
+	ast, err := compile(source)
+	if err != nil {
+		return nil, err
+	}
+	prg, err := program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{source: source, program: prg}, nil
+}
+
+// String returns the source of the expression
+func (v *Value) String() string {
+	return v.source
+}
+
+// Eval evaluates the expression and converts the result to a string
+// Lists are joined with commas, maps are encoded as JSON and null becomes an empty string.
+func (v *Value) Eval(vars Vars) (string, error) {
+	out, _, err := v.program.Eval(vars.activation())
+	if err != nil {
+		return "", err
+	}
+	return stringOf(out)
+}
+
+// jsonValueType is the native type CEL lists and maps are converted to
+var jsonValueType = reflect.TypeOf(&structpb.Value{})
+
+// stringOf converts a CEL value to a string
+func stringOf(val ref.Val) (string, error) {
+	switch val.Type() {
+	case types.NullType:
+		return "", nil
+	case types.StringType:
+		return val.Value().(string), nil
+	case types.ListType, types.MapType:
+		native, err := val.ConvertToNative(jsonValueType)
+		if err != nil {
+			return "", err
+		}
+		value := native.(*structpb.Value).AsInterface()
+		if list, ok := value.([]interface{}); ok {
+			parts := make([]string, 0, len(list))
+			for _, item := range list {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			return strings.Join(parts, ","), nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(val.Value()), nil
+}
+
+// listOf returns a list stored in extra as comma-separated string or list
+func listOf(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package expr
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func testVars() Vars {
+	return NewUserVars("Alice", "alice@example.com", "google", map[string]interface{}{
+		"groups": "admins,staff",
+		"roles":  []interface{}{"editor"},
+		"locale": "ja",
+		"org":    map[string]interface{}{"department": "Sales", "teams": []interface{}{"a", "b"}},
+	})
+}
+
+func TestCondition_Eval(t *testing.T) {
+	req := httptest.NewRequest("POST", "https://chat.example.com/api/chat", nil)
+	req.Header.Set("X-Client", "web")
+	vars := testVars().WithRequest(req)
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`email.endsWith("@example.com") && "admins" in groups`, true},
+		{`"owners" in groups || "editor" in roles`, true},
+		{`provider == "microsoft"`, false},
+		{`extra.org.department == "Sales"`, true},
+		{`has(extra.missing)`, false},
+		{`method == "POST" && path.startsWith("/api/") && headers["x-client"] == "web"`, true},
+		{`email.lowerAscii().split("@")[1] == "example.com"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			cond, err := CompileCondition(tt.source)
+			if err != nil {
+				t.Fatalf("CompileCondition() error = %v", err)
+			}
+			got, err := cond.Eval(vars)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCondition_EvalError(t *testing.T) {
+	cond, err := CompileCondition(`extra.missing == "x"`)
+	if err != nil {
+		t.Fatalf("CompileCondition() error = %v", err)
+	}
+	if got, err := cond.Eval(testVars()); err == nil || got {
+		t.Errorf("Eval() = %v, %v, want false with an error", got, err)
+	}
+}
+
+func TestCompileCondition_Invalid(t *testing.T) {
+	for _, source := range []string{`email ==`, `unknown == "x"`, `email`, `size(groups)`} {
+		t.Run(source, func(t *testing.T) {
+			if _, err := CompileCondition(source); !errors.Is(err, ErrExpressionInvalid) {
+				t.Errorf("CompileCondition() error = %v, want ErrExpressionInvalid", err)
+			}
+		})
+	}
+}
+
+func TestValue_Eval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`email.split("@")[0]`, "alice"},
+		{`"team-" + extra.org.department`, "team-Sales"},
+		{`groups`, "admins,staff"},
+		{`extra.org.teams`, "a,b"},
+		{`size(groups)`, "2"},
+		{`"admins" in groups`, "true"},
+		{`{"name": username}`, `{"name":"Alice"}`},
+		{`has(extra.locale) ? extra.locale : "en"`, "ja"},
+		{`null`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			value, err := CompileValue(tt.source)
+			if err != nil {
+				t.Fatalf("CompileValue() error = %v", err)
+			}
+			got, err := value.Eval(testVars())
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
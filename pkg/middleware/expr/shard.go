@@ -0,0 +1,42 @@
+package expr
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// shardFunction declares shard(key, count), the shard of a key among count shards (0 to count-1)
+// Upstreams scaled horizontally route on it to keep a user on the same replica, e.g. with the forwarding
+// field `expr: 'shard(email, 16)'`. The shard is the jump consistent hash (Lamping and Veach) of the
+// 64-bit FNV-1a hash of the key: it only depends on the key and count, and changing the count from n to m
+// moves at most |n-m|/max(n,m) of the keys.
+var shardFunction = cel.Function("shard",
+	cel.Overload("shard_string_int", []*cel.Type{cel.StringType, cel.IntType}, cel.IntType,
+		cel.BinaryBinding(func(key, count ref.Val) ref.Val {
+			n, ok := count.Value().(int64)
+			if !ok || n < 1 || n > math.MaxInt32 {
+				return types.NewErr("shard count must be between 1 and %d", math.MaxInt32)
+			}
+			return types.Int(shard(key.Value().(string), n))
+		}),
+	),
+)
+
+// shard returns the jump consistent hash of key among count shards
+func shard(key string, count int64) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	k := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < count {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return b
+}
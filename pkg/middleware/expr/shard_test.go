@@ -0,0 +1,62 @@
+package expr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	const keys = 10000
+	counts := make([]int, 10)
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user%d@example.com", i)
+		s := shard(key, 10)
+		if s < 0 || s >= 10 {
+			t.Fatalf("shard(%q, 10) = %d, want 0 to 9", key, s)
+		}
+		counts[s]++
+
+		// Adding a shard only moves keys to the new shard
+		if grown := shard(key, 11); grown != s {
+			if grown != 10 {
+				t.Fatalf("shard(%q): %d with 10 shards, %d with 11, want unchanged or 10", key, s, grown)
+			}
+			moved++
+		}
+		if shard(key, 1) != 0 {
+			t.Fatalf("shard(%q, 1) != 0", key)
+		}
+	}
+	for s, n := range counts {
+		if n < keys/10*8/10 || n > keys/10*12/10 {
+			t.Errorf("shard %d has %d of %d keys, want about %d", s, n, keys, keys/10)
+		}
+	}
+	if moved < keys/11*8/10 || moved > keys/11*12/10 {
+		t.Errorf("%d of %d keys moved to the new shard, want about %d", moved, keys, keys/11)
+	}
+}
+
+func TestValue_EvalShard(t *testing.T) {
+	value, err := CompileValue(`shard(email, 16)`)
+	if err != nil {
+		t.Fatalf("CompileValue() error = %v", err)
+	}
+	got, err := value.Eval(testVars())
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	// The shard of a key never changes: upstreams and other gates rely on it
+	if got != "11" {
+		t.Errorf("Eval() = %q, want %q", got, "11")
+	}
+
+	value, err = CompileValue(`shard(email, 0)`)
+	if err != nil {
+		t.Fatalf("CompileValue() error = %v", err)
+	}
+	if _, err := value.Eval(testVars()); err == nil {
+		t.Error("Eval() should fail with no shards")
+	}
+}
@@ -1,8 +1,10 @@
 package factory
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/email"
 	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
@@ -11,6 +13,8 @@ import (
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 	"github.com/ideamans/chatbotgate/pkg/middleware/core"
 	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+	"github.com/ideamans/chatbotgate/pkg/middleware/idp"
+	"github.com/ideamans/chatbotgate/pkg/middleware/outbound"
 	"github.com/ideamans/chatbotgate/pkg/middleware/rules"
 	"github.com/ideamans/chatbotgate/pkg/middleware/session"
 	"github.com/ideamans/chatbotgate/pkg/shared/i18n"
@@ -24,6 +28,7 @@ type DefaultFactory struct {
 	host   string
 	port   int
 	logger logging.Logger
+	chaos  *kvs.ChaosConfig // Fault injection into the KVS stores, nil when off
 }
 
 // NewDefaultFactory creates a new DefaultFactory
@@ -35,6 +40,12 @@ func NewDefaultFactory(host string, port int, logger logging.Logger) *DefaultFac
 	}
 }
 
+// SetChaos injects the faults of chaos into the KVS stores created afterwards (nil: none)
+// It is meant for development (the --chaos flag): stores are wrapped below the session cache.
+func (f *DefaultFactory) SetChaos(chaos *kvs.ChaosConfig) {
+	f.chaos = chaos
+}
+
 // CreateMiddleware creates a complete Middleware instance with all components
 // tokenKVS and emailQuotaKVS should be created via CreateKVSStores() and passed in.
 func (f *DefaultFactory) CreateMiddleware(
@@ -48,14 +59,23 @@ func (f *DefaultFactory) CreateMiddleware(
 	// Create all components using factory methods
 	translator := f.CreateTranslator()
 	authzChecker := f.CreateAuthzChecker(cfg.AccessControl)
-	forwarder := f.CreateForwarder(cfg.Forwarding, cfg.OAuth2.Providers)
+	forwarder, err := f.CreateForwarder(cfg.Forwarding, cfg.OAuth2.Providers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forwarder: %w", err)
+	}
 	rulesEvaluator, err := f.CreateRulesEvaluator(&cfg.AccessControl.Rules)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create rules evaluator: %w", err)
 	}
 
+	// Create the HTTP client of outbound calls (egress proxy, CA bundle)
+	httpClient, err := f.CreateHTTPClient(cfg.Outbound)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbound HTTP client: %w", err)
+	}
+
 	// Create OAuth2 manager with factory's host/port
-	oauthManager := f.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, f.host, f.port)
+	oauthManager := f.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, f.host, f.port, httpClient)
 
 	// Create email handler if enabled
 	var emailHandler *email.Handler
@@ -72,6 +92,7 @@ func (f *DefaultFactory) CreateMiddleware(
 			translator,
 			tokenKVS,
 			emailQuotaKVS,
+			httpClient,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create email handler: %w", err)
@@ -84,10 +105,20 @@ func (f *DefaultFactory) CreateMiddleware(
 		passwordHandler = f.CreatePasswordHandler(
 			cfg.PasswordAuth,
 			cfg.Session.Cookie,
-			cfg.Server.GetAuthPathPrefix(),
+			cfg.Server.GetPublicAuthPathPrefix(),
 			sessionStore,
 			translator,
 		)
+		passwordHandler.SetMountPath(cfg.Server.GetMountPath())
+	}
+
+	// Create the OpenID Connect provider if the IdP mode is enabled
+	var identityProvider *idp.Provider
+	if cfg.IDP.Enabled {
+		identityProvider, err = f.CreateIdentityProvider(cfg.IDP, cfg.Server, sessionStore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OpenID Connect provider: %w", err)
+		}
 	}
 
 	// Create middleware
@@ -106,6 +137,9 @@ func (f *DefaultFactory) CreateMiddleware(
 	if err != nil {
 		return nil, fmt.Errorf("failed to create middleware: %w", err)
 	}
+	if identityProvider != nil {
+		mw.SetIdentityProvider(identityProvider)
+	}
 
 	// Wrap with proxy handler if available
 	if proxyHandler != nil {
@@ -115,9 +149,27 @@ func (f *DefaultFactory) CreateMiddleware(
 	return mw, nil
 }
 
+// CreateHTTPClient creates the HTTP client of outbound calls (OAuth2 providers, SendGrid)
+func (f *DefaultFactory) CreateHTTPClient(outboundCfg config.OutboundConfig) (*http.Client, error) {
+	client, err := outbound.NewClient(outboundCfg)
+	if err != nil {
+		return nil, err
+	}
+	if outboundCfg.ProxyURL != "" {
+		f.logger.Debug("Outbound proxy configured", "no_proxy", outboundCfg.NoProxy)
+	}
+	return client, nil
+}
+
 // CreateOAuth2Manager creates an OAuth2 manager with configured providers
-func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serverCfg config.ServerConfig, host string, port int) *oauth2.Manager {
+func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serverCfg config.ServerConfig, host string, port int, httpClient *http.Client) *oauth2.Manager {
 	manager := oauth2.NewManager()
+	// Context of provider requests made while building (discovery, service account tokens)
+	clientCtx := context.Background()
+	if httpClient != nil {
+		manager.SetHTTPClient(httpClient)
+		clientCtx = manager.HTTPContext(clientCtx)
+	}
 
 	// Setup OAuth2 providers
 	for _, providerCfg := range oauth2Cfg.Providers {
@@ -138,7 +190,7 @@ func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serv
 		// Type determines which implementation to use (can have multiple providers of same type)
 		switch providerCfg.Type {
 		case "google":
-			provider = oauth2.NewGoogleProvider(
+			googleProvider := oauth2.NewGoogleProvider(
 				providerCfg.ID,
 				providerCfg.ClientID,
 				providerCfg.ClientSecret,
@@ -146,8 +198,23 @@ func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serv
 				providerCfg.Scopes,
 				providerCfg.ResetScopes,
 			)
+			googleProvider.SetHostedDomains(providerCfg.HostedDomains)
+			if providerCfg.DirectoryCredentialsFile != "" {
+				credentials, err := os.ReadFile(providerCfg.DirectoryCredentialsFile)
+				if err != nil {
+					f.logger.Error("Skipping Google OAuth2 provider: failed to read directory credentials", "id", providerCfg.ID, "error", err)
+					continue
+				}
+				tokens, err := oauth2.NewGoogleDirectoryTokenSource(clientCtx, credentials, providerCfg.DirectoryAdminEmail)
+				if err != nil {
+					f.logger.Error("Skipping Google OAuth2 provider: invalid directory credentials", "id", providerCfg.ID, "error", err)
+					continue
+				}
+				googleProvider.SetDirectory(tokens, providerCfg.AllowedGroups)
+			}
+			provider = googleProvider
 		case "github":
-			provider = oauth2.NewGitHubProvider(
+			githubProvider := oauth2.NewGitHubProvider(
 				providerCfg.ID,
 				providerCfg.ClientID,
 				providerCfg.ClientSecret,
@@ -155,8 +222,10 @@ func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serv
 				providerCfg.Scopes,
 				providerCfg.ResetScopes,
 			)
+			githubProvider.SetMembership(providerCfg.AllowedOrgs, providerCfg.AllowedTeams)
+			provider = githubProvider
 		case "microsoft":
-			provider = oauth2.NewMicrosoftProvider(
+			microsoftProvider := oauth2.NewMicrosoftProvider(
 				providerCfg.ID,
 				providerCfg.ClientID,
 				providerCfg.ClientSecret,
@@ -164,13 +233,15 @@ func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serv
 				providerCfg.Scopes,
 				providerCfg.ResetScopes,
 			)
+			microsoftProvider.SetAllowedTenants(providerCfg.AllowedTenants)
+			provider = microsoftProvider
 		case "custom":
-			if providerCfg.AuthURL == "" || providerCfg.TokenURL == "" || providerCfg.UserInfoURL == "" {
+			if providerCfg.IssuerURL == "" && (providerCfg.AuthURL == "" || providerCfg.TokenURL == "" || providerCfg.UserInfoURL == "") {
 				f.logger.Warn("Skipping custom OAuth2 provider: missing required URLs", "id", providerCfg.ID, "type", providerCfg.Type)
 				continue
 			}
 			// Use provider ID as the unique identifier for custom providers
-			provider = oauth2.NewCustomProvider(
+			customProvider := oauth2.NewCustomProvider(
 				providerCfg.ID,
 				providerCfg.ClientID,
 				providerCfg.ClientSecret,
@@ -181,11 +252,29 @@ func (f *DefaultFactory) CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serv
 				providerCfg.Scopes,
 				providerCfg.InsecureSkipVerify,
 			)
+			customProvider.SetHTTPClient(httpClient)
+			if providerCfg.IssuerURL != "" {
+				// The discovery document is fetched by Middleware.WarmUp, or at the first sign-in
+				customProvider.SetIssuer(providerCfg.IssuerURL, providerCfg.GetDiscoveryRefresh())
+			}
+			if providerCfg.JWKSURL != "" {
+				customProvider.SetJWKSURL(providerCfg.JWKSURL)
+			}
+			provider = customProvider
 		default:
 			f.logger.Warn("Skipping OAuth2 provider: unknown provider type", "id", providerCfg.ID, "type", providerCfg.Type)
 			continue
 		}
 
+		if providerCfg.GetClientAuthMethod() != config.ClientAuthSecret {
+			clientAuth, err := newClientAuth(providerCfg)
+			if err != nil {
+				f.logger.Error("Skipping OAuth2 provider: invalid client authentication", "id", providerCfg.ID, "method", providerCfg.ClientAuthMethod, "error", err)
+				continue
+			}
+			provider.(interface{ SetClientAuth(*oauth2.ClientAuth) }).SetClientAuth(clientAuth)
+		}
+
 		manager.AddProvider(provider)
 		f.logger.Debug("OAuth2 provider registered", "type", providerCfg.Type)
 	}
@@ -205,8 +294,9 @@ func (f *DefaultFactory) CreateEmailHandler(
 	translator *i18n.Translator,
 	tokenKVS kvs.Store,
 	emailQuotaKVS kvs.Store,
+	httpClient *http.Client,
 ) (*email.Handler, error) {
-	authPrefix := serverCfg.GetAuthPathPrefix()
+	authPrefix := serverCfg.GetPublicAuthPathPrefix()
 
 	var emailBaseURL string
 	if serverCfg.BaseURL != "" {
@@ -237,6 +327,9 @@ func (f *DefaultFactory) CreateEmailHandler(
 	if err != nil {
 		return nil, fmt.Errorf("failed to create email handler: %w", err)
 	}
+	if httpClient != nil {
+		handler.SetHTTPClient(httpClient)
+	}
 
 	f.logger.Debug("Email authentication handler initialized", "sender", emailAuthCfg.SenderType)
 	return handler, nil
@@ -255,6 +348,21 @@ func (f *DefaultFactory) CreatePasswordHandler(
 	return handler
 }
 
+// CreateIdentityProvider creates the OpenID Connect provider of the IdP mode
+// Its authorization codes and access tokens are kept in the session KVS.
+func (f *DefaultFactory) CreateIdentityProvider(idpCfg config.IDPConfig, serverCfg config.ServerConfig, sessionStore kvs.Store) (*idp.Provider, error) {
+	keyPEM, err := readPEM(idpCfg.SigningKey, idpCfg.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("idp.signing_key_file: %w", err)
+	}
+	provider, err := idp.New(idpCfg, idpCfg.GetIssuer(serverCfg), keyPEM, sessionStore)
+	if err != nil {
+		return nil, err
+	}
+	f.logger.Debug("OpenID Connect provider initialized", "issuer", provider.Issuer(), "clients", len(idpCfg.Clients))
+	return provider, nil
+}
+
 // CreateAuthzChecker creates an authorization checker based on config
 func (f *DefaultFactory) CreateAuthzChecker(accessControlCfg config.AccessControlConfig) authz.Checker {
 	checker := authz.NewEmailChecker(accessControlCfg)
@@ -267,17 +375,22 @@ func (f *DefaultFactory) CreateAuthzChecker(accessControlCfg config.AccessContro
 }
 
 // CreateForwarder creates a forwarder for user info forwarding (may return nil)
-func (f *DefaultFactory) CreateForwarder(forwardingCfg config.ForwardingConfig, providers []config.OAuth2Provider) forwarding.Forwarder {
-	if len(forwardingCfg.Fields) == 0 {
-		return nil
+func (f *DefaultFactory) CreateForwarder(forwardingCfg config.ForwardingConfig, providers []config.OAuth2Provider) (forwarding.Forwarder, error) {
+	fields := forwardingCfg.EffectiveFields()
+	if len(fields) == 0 {
+		return nil, nil
 	}
 
-	forwarder := forwarding.NewForwarder(&forwardingCfg, providers)
+	forwarder, err := forwarding.NewForwarder(&forwardingCfg, providers)
+	if err != nil {
+		return nil, err
+	}
 	f.logger.Debug("User info forwarder initialized",
-		"fields", len(forwardingCfg.Fields),
+		"fields", len(fields),
+		"backend", forwardingCfg.Backend,
 		"encryption_enabled", forwardingCfg.Encryption != nil)
 
-	return forwarder
+	return forwarder, nil
 }
 
 // CreateRulesEvaluator creates a rules evaluator from configuration
@@ -312,7 +425,7 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 
 	// Initialize session KVS (override or default with namespace)
 	if cfg.KVS.Session != nil {
-		session, err = kvs.New(*cfg.KVS.Session)
+		session, err = f.newKVS(*cfg.KVS.Session)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to create session KVS: %w", err)
 		}
@@ -320,16 +433,20 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 	} else {
 		sessionCfg := cfg.KVS.Default
 		sessionCfg.Namespace = cfg.KVS.Namespaces.Session
-		session, err = kvs.New(sessionCfg)
+		session, err = f.newKVS(sessionCfg)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to create session KVS: %w", err)
 		}
 		f.logger.Debug("Session KVS initialized (default)", "type", sessionCfg.Type, "namespace", sessionCfg.Namespace)
 	}
+	if cfg.KVS.SessionCache.Enabled {
+		session = kvs.NewCachedStore(session, cfg.KVS.SessionCache)
+		f.logger.Debug("Session cache enabled", "size", cfg.KVS.SessionCache.Size, "ttl", cfg.KVS.SessionCache.GetTTL())
+	}
 
 	// Initialize token KVS (override or default with namespace)
 	if cfg.KVS.Token != nil {
-		token, err = kvs.New(*cfg.KVS.Token)
+		token, err = f.newKVS(*cfg.KVS.Token)
 		if err != nil {
 			_ = session.Close() // Cleanup
 			return nil, nil, nil, fmt.Errorf("failed to create token KVS: %w", err)
@@ -338,7 +455,7 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 	} else {
 		tokenCfg := cfg.KVS.Default
 		tokenCfg.Namespace = cfg.KVS.Namespaces.Token
-		token, err = kvs.New(tokenCfg)
+		token, err = f.newKVS(tokenCfg)
 		if err != nil {
 			_ = session.Close() // Cleanup
 			return nil, nil, nil, fmt.Errorf("failed to create token KVS: %w", err)
@@ -348,7 +465,7 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 
 	// Initialize email quota KVS (override or default with namespace)
 	if cfg.KVS.EmailQuota != nil {
-		emailQuota, err = kvs.New(*cfg.KVS.EmailQuota)
+		emailQuota, err = f.newKVS(*cfg.KVS.EmailQuota)
 		if err != nil {
 			_ = session.Close() // Cleanup
 			_ = token.Close()
@@ -358,7 +475,7 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 	} else {
 		emailQuotaCfg := cfg.KVS.Default
 		emailQuotaCfg.Namespace = cfg.KVS.Namespaces.EmailQuota
-		emailQuota, err = kvs.New(emailQuotaCfg)
+		emailQuota, err = f.newKVS(emailQuotaCfg)
 		if err != nil {
 			_ = session.Close() // Cleanup
 			_ = token.Close()
@@ -370,6 +487,43 @@ func (f *DefaultFactory) CreateKVSStores(cfg *config.Config) (session kvs.Store,
 	return session, token, emailQuota, nil
 }
 
+// newKVS creates a KVS store, with the faults of f.chaos injected
+func (f *DefaultFactory) newKVS(cfg kvs.Config) (kvs.Store, error) {
+	store, err := kvs.New(cfg)
+	if err != nil || f.chaos == nil {
+		return store, err
+	}
+	return kvs.NewChaosStore(store, *f.chaos), nil
+}
+
+// newClientAuth creates the private_key_jwt or mutual TLS client authentication of a provider
+func newClientAuth(providerCfg config.OAuth2Provider) (*oauth2.ClientAuth, error) {
+	keyPEM, err := readPEM(providerCfg.ClientKey, providerCfg.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := readPEM(providerCfg.ClientCert, providerCfg.ClientCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if providerCfg.GetClientAuthMethod() == config.ClientAuthTLS {
+		return oauth2.NewTLSClientAuth(certPEM, keyPEM)
+	}
+	return oauth2.NewPrivateKeyJWTAuth(keyPEM, certPEM, providerCfg.ClientKeyID)
+}
+
+// readPEM returns inline PEM key material, or reads it from file (empty when neither is set)
+func readPEM(inline, file string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(file)
+}
+
 // CreateSessionStore creates a session store using the provided KVS
 // Since session.Store is now an alias for kvs.Store, this just returns the input
 func (f *DefaultFactory) CreateSessionStore(kvsStore kvs.Store) session.Store {
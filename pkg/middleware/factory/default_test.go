@@ -100,7 +100,10 @@ func TestDefaultFactory_CreateForwarder(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := tt.configFunc()
-			forwarder := factory.CreateForwarder(cfg.Forwarding, cfg.OAuth2.Providers)
+			forwarder, err := factory.CreateForwarder(cfg.Forwarding, cfg.OAuth2.Providers)
+			if err != nil {
+				t.Fatalf("CreateForwarder() error = %v", err)
+			}
 
 			if tt.expectNil {
 				if forwarder != nil {
@@ -329,6 +332,29 @@ func TestDefaultFactory_CreateKVSStores(t *testing.T) {
 	}
 }
 
+func TestDefaultFactory_CreateKVSStores_SessionCache(t *testing.T) {
+	logger := logging.NewSimpleLogger("test", logging.LevelInfo, false)
+	factory := NewDefaultFactory("localhost", 4180, logger)
+
+	cfg := CreateTestConfig()
+	cfg.KVS.SessionCache = kvs.CacheConfig{Enabled: true}
+
+	sessionKVS, tokenKVS, emailQuotaKVS, err := factory.CreateKVSStores(cfg)
+	if err != nil {
+		t.Fatalf("CreateKVSStores failed: %v", err)
+	}
+	defer func() { _ = sessionKVS.Close() }()
+	defer func() { _ = tokenKVS.Close() }()
+	defer func() { _ = emailQuotaKVS.Close() }()
+
+	if _, ok := sessionKVS.(*kvs.CachedStore); !ok {
+		t.Errorf("session KVS = %T, want *kvs.CachedStore", sessionKVS)
+	}
+	if _, ok := tokenKVS.(*kvs.CachedStore); ok {
+		t.Error("token KVS should not be cached")
+	}
+}
+
 func TestDefaultFactory_CreateSessionStore(t *testing.T) {
 	logger := logging.NewSimpleLogger("test", logging.LevelInfo, false)
 	factory := NewDefaultFactory("localhost", 4180, logger)
@@ -352,7 +378,7 @@ func TestDefaultFactory_CreateOAuth2Manager(t *testing.T) {
 
 	cfg := CreateTestConfigWithOAuth2()
 
-	manager := factory.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, "localhost", 4180)
+	manager := factory.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, "localhost", 4180, nil)
 	if manager == nil {
 		t.Fatal("CreateOAuth2Manager returned nil")
 	}
@@ -482,6 +508,7 @@ func TestDefaultFactory_CreateEmailHandler(t *testing.T) {
 				translator,
 				tokenKVS,
 				rateLimitKVS,
+				nil,
 			)
 
 			if tt.expectError {
@@ -33,10 +33,15 @@ type Factory interface {
 
 	// Component factory methods (used internally by CreateMiddleware)
 
+	// CreateHTTPClient creates the HTTP client of outbound calls (OAuth2 providers, SendGrid)
+	CreateHTTPClient(outboundCfg config.OutboundConfig) (*http.Client, error)
+
 	// CreateOAuth2Manager creates an OAuth2 manager with configured providers
-	CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serverCfg config.ServerConfig, host string, port int) *oauth2.Manager
+	// httpClient is used to reach the providers (nil: default client)
+	CreateOAuth2Manager(oauth2Cfg config.OAuth2Config, serverCfg config.ServerConfig, host string, port int, httpClient *http.Client) *oauth2.Manager
 
 	// CreateEmailHandler creates an email authentication handler if enabled
+	// httpClient is used by API-based senders such as SendGrid (nil: default client)
 	CreateEmailHandler(
 		emailAuthCfg config.EmailAuthConfig,
 		serviceCfg config.ServiceConfig,
@@ -48,13 +53,14 @@ type Factory interface {
 		translator *i18n.Translator,
 		tokenKVS kvs.Store,
 		emailQuotaKVS kvs.Store,
+		httpClient *http.Client,
 	) (*email.Handler, error)
 
 	// CreateAuthzChecker creates an authorization checker based on config
 	CreateAuthzChecker(accessControlCfg config.AccessControlConfig) authz.Checker
 
 	// CreateForwarder creates a forwarder for user info forwarding (may return nil)
-	CreateForwarder(forwardingCfg config.ForwardingConfig, providers []config.OAuth2Provider) forwarding.Forwarder
+	CreateForwarder(forwardingCfg config.ForwardingConfig, providers []config.OAuth2Provider) (forwarding.Forwarder, error)
 
 	// CreateRulesEvaluator creates a rules evaluator from configuration
 	CreateRulesEvaluator(rulesCfg *rules.Config) (*rules.Evaluator, error)
@@ -103,7 +103,7 @@ func TestTestingFactory_Integration(t *testing.T) {
 	}
 
 	// Create OAuth2 manager
-	oauth2Manager := factory.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, "localhost", 4180)
+	oauth2Manager := factory.CreateOAuth2Manager(cfg.OAuth2, cfg.Server, "localhost", 4180, nil)
 	if oauth2Manager == nil {
 		t.Fatal("CreateOAuth2Manager returned nil")
 	}
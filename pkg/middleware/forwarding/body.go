@@ -0,0 +1,186 @@
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MaxJSONBodyBytes is the largest JSON request body that is rewritten
+const MaxJSONBodyBytes = 10 << 20
+
+var (
+	// ErrBodyTooLarge is returned when a JSON request body exceeds MaxJSONBodyBytes
+	ErrBodyTooLarge = errors.New("request body too large")
+
+	// ErrInvalidBody is returned when a JSON request body (or an object on a field path) is not a JSON object
+	ErrInvalidBody = errors.New("request body must be a JSON object")
+
+	// ErrInvalidFieldPath is returned for a field path with an empty key (e.g., "a..b" or ".a")
+	ErrInvalidFieldPath = errors.New("field path must not have empty keys")
+)
+
+// IsJSONRequest reports whether the request has a JSON body
+func IsJSONRequest(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// SetJSONBodyFields sets string values in the JSON object body of r
+// Keys of values are dot-separated paths (e.g., "overrideConfig.vars.user"); missing objects are created.
+// Other fields are kept as sent by the client, and Content-Length is updated.
+func SetJSONBodyFields(r *http.Request, values map[string]string) error {
+	return rewriteJSONBody(r, values, nil)
+}
+
+// rewriteJSONBody deletes the fields at the remove paths from the JSON object body of r, then sets the values
+func rewriteJSONBody(r *http.Request, values map[string]string, remove []string) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxJSONBodyBytes+1))
+	_ = r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(data) > MaxJSONBodyBytes {
+		return ErrBodyTooLarge
+	}
+
+	// RawMessage keeps the other fields (and number precision) as sent by the client
+	fields := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+			return ErrInvalidBody
+		}
+	}
+
+	for _, path := range remove {
+		keys := strings.Split(path, ".")
+		if slices.Contains(keys, "") {
+			return fmt.Errorf("%w: %q", ErrInvalidFieldPath, path)
+		}
+		if err := deleteJSONField(fields, keys); err != nil {
+			return err
+		}
+	}
+	for path, value := range values {
+		keys := strings.Split(path, ".")
+		if slices.Contains(keys, "") {
+			return fmt.Errorf("%w: %q", ErrInvalidFieldPath, path)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", path, err)
+		}
+		if err := setJSONField(fields, keys, encoded); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode request body: %w", err)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", fmt.Sprint(len(body)))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
+
+// setJSONField sets value at the key path in obj, creating nested objects as needed
+func setJSONField(obj map[string]json.RawMessage, keys []string, value json.RawMessage) error {
+	if len(keys) == 1 {
+		obj[keys[0]] = value
+		return nil
+	}
+
+	nested := make(map[string]json.RawMessage)
+	if raw, ok := obj[keys[0]]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			return ErrInvalidBody
+		}
+	}
+	if err := setJSONField(nested, keys[1:], value); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(nested)
+	if err != nil {
+		return err
+	}
+	obj[keys[0]] = encoded
+	return nil
+}
+
+// deleteJSONField deletes the field at the key path in obj
+// Paths through a missing object, or a value that is not an object, hold no field to delete.
+func deleteJSONField(obj map[string]json.RawMessage, keys []string) error {
+	if len(keys) == 1 {
+		delete(obj, keys[0])
+		return nil
+	}
+
+	raw, ok := obj[keys[0]]
+	if !ok {
+		return nil
+	}
+	nested := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &nested); err != nil || nested == nil {
+		return nil
+	}
+	if err := deleteJSONField(nested, keys[1:]); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(nested)
+	if err != nil {
+		return err
+	}
+	obj[keys[0]] = encoded
+	return nil
+}
+
+// JSONBodyFields returns the string values at the dot-separated paths of a body set by SetJSONBodyFields
+// Paths without a string value are left out; requests whose body was not rewritten have none.
+func JSONBodyFields(r *http.Request, paths []string) map[string]string {
+	values := make(map[string]string)
+	if r.GetBody == nil || len(paths) == 0 {
+		return values
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return values
+	}
+	defer func() { _ = body.Close() }()
+
+	var fields map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return values
+	}
+	for _, path := range paths {
+		var value interface{} = fields
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = obj[key]
+		}
+		if s, ok := value.(string); ok {
+			values[path] = s
+		}
+	}
+	return values
+}
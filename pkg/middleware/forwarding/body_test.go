@@ -0,0 +1,159 @@
+package forwarding
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetJSONBodyFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		values  map[string]string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "top-level field",
+			body:   `{"model":"gpt-4o","user":"spoofed"}`,
+			values: map[string]string{"user": "john@example.com"},
+			want:   `{"model":"gpt-4o","user":"john@example.com"}`,
+		},
+		{
+			name:   "nested field creates objects",
+			body:   `{"question":"hi"}`,
+			values: map[string]string{"overrideConfig.vars.user": "john@example.com"},
+			want:   `{"overrideConfig":{"vars":{"user":"john@example.com"}},"question":"hi"}`,
+		},
+		{
+			name:   "nested field keeps siblings",
+			body:   `{"overrideConfig":{"temperature":0.7,"vars":{"lang":"en"}}}`,
+			values: map[string]string{"overrideConfig.vars.user": "john@example.com"},
+			want:   `{"overrideConfig":{"temperature":0.7,"vars":{"lang":"en","user":"john@example.com"}}}`,
+		},
+		{
+			name:   "empty body",
+			body:   ``,
+			values: map[string]string{"user": "john@example.com"},
+			want:   `{"user":"john@example.com"}`,
+		},
+		{
+			name:    "array body",
+			body:    `[1,2]`,
+			values:  map[string]string{"user": "john@example.com"},
+			wantErr: ErrInvalidBody,
+		},
+		{
+			name:    "non-object on path",
+			body:    `{"overrideConfig":"x"}`,
+			values:  map[string]string{"overrideConfig.vars.user": "john@example.com"},
+			wantErr: ErrInvalidBody,
+		},
+		{
+			name:    "empty key in path",
+			body:    `{"overrideConfig":{}}`,
+			values:  map[string]string{"overrideConfig..user": "john@example.com"},
+			wantErr: ErrInvalidFieldPath,
+		},
+		{
+			name:    "too large",
+			body:    `{"q":"` + strings.Repeat("a", MaxJSONBodyBytes) + `"}`,
+			values:  map[string]string{"user": "john@example.com"},
+			wantErr: ErrBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			err := SetJSONBodyFields(req, tt.values)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SetJSONBodyFields() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetJSONBodyFields() error = %v", err)
+			}
+
+			body, _ := io.ReadAll(req.Body)
+			assertJSONEqual(t, string(body), tt.want)
+			if req.ContentLength != int64(len(body)) {
+				t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+			}
+		})
+	}
+}
+
+func TestIsJSONRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        bool
+	}{
+		{"json", `{}`, "application/json", true},
+		{"json with charset", `{}`, "application/json; charset=utf-8", true},
+		{"form", `a=b`, "application/x-www-form-urlencoded", false},
+		{"no body", ``, "application/json", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = http.NoBody
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.Header.Set("Content-Type", tt.contentType)
+			if got := IsJSONRequest(req); got != tt.want {
+				t.Errorf("IsJSONRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONBodyFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"question":"hi","n":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if got := JSONBodyFields(req, []string{"question"}); len(got) != 0 {
+		t.Errorf("JSONBodyFields() before rewriting = %v, want none", got)
+	}
+
+	if err := SetJSONBodyFields(req, map[string]string{"user": "john@example.com", "overrideConfig.vars.user": "john"}); err != nil {
+		t.Fatal(err)
+	}
+	got := JSONBodyFields(req, []string{"user", "overrideConfig.vars.user", "n", "missing.key"})
+	if len(got) != 2 || got["user"] != "john@example.com" || got["overrideConfig.vars.user"] != "john" {
+		t.Errorf("JSONBodyFields() = %v", got)
+	}
+
+	// The body itself is still unread
+	data, _ := io.ReadAll(req.Body)
+	assertJSONEqual(t, string(data), `{"question":"hi","n":1,"user":"john@example.com","overrideConfig":{"vars":{"user":"john"}}}`)
+}
+
+// assertJSONEqual compares two JSON documents ignoring formatting and key order
+func assertJSONEqual(t *testing.T, got, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON %q: %v", want, err)
+	}
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	if string(gb) != string(wb) {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package forwarding
+
+import (
+	"net/http"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// DryRunResult shows what forwarding would produce for a user, without a request
+type DryRunResult struct {
+	Headers  map[string]string `json:"headers"`             // Headers added to every authenticated request
+	Query    map[string]string `json:"query"`               // Query parameters added to the login redirect
+	Body     map[string]string `json:"body"`                // JSON body fields set on API requests under body_path
+	BodyPath string            `json:"body_path,omitempty"` // Path prefix of requests that get the body fields
+	Fields   []FieldTrace      `json:"fields"`              // How each field was resolved, in order
+}
+
+// FieldTrace shows how a single forwarding field was resolved
+type FieldTrace struct {
+	Source   string   `json:"source"`             // Path or expression of the field
+	Filters  []string `json:"filters,omitempty"`  // Filters applied to the value
+	Value    string   `json:"value,omitempty"`    // Value before filters
+	Output   string   `json:"output,omitempty"`   // Value after filters (and header sanitizing)
+	Set      []string `json:"set,omitempty"`      // Destinations set by this field (e.g., "header:X-Email")
+	Shadowed []string `json:"shadowed,omitempty"` // Destinations already set by an earlier field
+	Error    string   `json:"error,omitempty"`    // Why the field yields no value
+}
+
+// DryRun resolves all forwarding fields for a user like AddToHeaders, AddToQueryString and AddToBody
+// Each field's trace tells which destinations it set, or why it was skipped, to debug path fallbacks.
+func (f *DefaultForwarder) DryRun(userInfo *UserInfo) *DryRunResult {
+	result := &DryRunResult{
+		Headers:  make(map[string]string),
+		Query:    make(map[string]string),
+		Body:     make(map[string]string),
+		BodyPath: f.config.GetBodyPath(),
+		Fields:   make([]FieldTrace, 0, len(f.fields)),
+	}
+
+	for i, field := range f.fields {
+		trace := FieldTrace{Source: field.Source(), Filters: field.Filters}
+
+		// Destinations still open for this field; earlier fields win
+		var targets []dryRunTarget
+		for _, t := range fieldTargets(field, result) {
+			if _, set := t.values[t.name]; set {
+				trace.Shadowed = append(trace.Shadowed, t.label)
+				continue
+			}
+			targets = append(targets, t)
+		}
+		if len(targets) == 0 {
+			result.Fields = append(result.Fields, trace)
+			continue
+		}
+
+		value, err := f.fieldValue(i, userInfo)
+		if err != nil {
+			trace.Error = err.Error()
+			result.Fields = append(result.Fields, trace)
+			continue
+		}
+		trace.Value = value
+
+		processed, err := f.applyFilters(i, value)
+		if err != nil {
+			trace.Error = err.Error()
+			result.Fields = append(result.Fields, trace)
+			continue
+		}
+
+		for _, t := range targets {
+			output := processed
+			if t.header {
+				output = sanitizeHeaderValue(processed)
+			}
+			t.values[t.name] = output
+			trace.Output = output
+			trace.Set = append(trace.Set, t.label)
+		}
+		result.Fields = append(result.Fields, trace)
+	}
+
+	return result
+}
+
+// dryRunTarget is a destination of a forwarding field in a dry run
+type dryRunTarget struct {
+	label  string            // Destination kind and name (e.g., "header:X-Email")
+	name   string            // Header, query parameter or body field name
+	values map[string]string // Result map of the destination kind
+	header bool              // Header values are sanitized
+}
+
+// fieldTargets returns the configured destinations of a field
+func fieldTargets(field config.ForwardingField, result *DryRunResult) []dryRunTarget {
+	var targets []dryRunTarget
+	if field.Header != "" {
+		name := http.CanonicalHeaderKey(field.Header)
+		targets = append(targets, dryRunTarget{label: "header:" + name, name: name, values: result.Headers, header: true})
+	}
+	if field.Query != "" {
+		targets = append(targets, dryRunTarget{label: "query:" + field.Query, name: field.Query, values: result.Query})
+	}
+	if field.Body != "" {
+		targets = append(targets, dryRunTarget{label: "body:" + field.Body, name: field.Body, values: result.Body})
+	}
+	return targets
+}
@@ -0,0 +1,50 @@
+package forwarding
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+func TestForwarder_DryRun(t *testing.T) {
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: "this-is-a-32-character-key-123456"},
+		Fields: []config.ForwardingField{
+			{Path: "extra.preferred_username", Header: "x-user"},
+			{Path: "username", Header: "X-User", Query: "user"},
+			{Path: "email", Header: "X-User", Body: "metadata.email"},
+			{Path: "email", Query: "secret", Filters: []string{"encrypt"}},
+		},
+	}
+	forwarder := newTestForwarder(t, cfg)
+
+	result := forwarder.DryRun(&UserInfo{Username: "Alice\r\nX-Evil: 1", Email: "alice@example.com"})
+
+	if result.Headers["X-User"] != "AliceX-Evil: 1" {
+		t.Errorf("X-User = %q, want the sanitized username", result.Headers["X-User"])
+	}
+	if result.Query["user"] != "Alice\r\nX-Evil: 1" || result.Query["secret"] == "" || result.Query["secret"] == "alice@example.com" {
+		t.Errorf("Query = %v, want the username and the encrypted email", result.Query)
+	}
+	if result.Body["metadata.email"] != "alice@example.com" || result.BodyPath != "/" {
+		t.Errorf("Body = %v (%s), want the email", result.Body, result.BodyPath)
+	}
+
+	traces := result.Fields
+	if len(traces) != 4 {
+		t.Fatalf("Fields = %d, want 4", len(traces))
+	}
+	if traces[0].Error == "" || traces[0].Set != nil {
+		t.Errorf("Missing path trace = %+v, want an error", traces[0])
+	}
+	if !reflect.DeepEqual(traces[1].Set, []string{"header:X-User", "query:user"}) {
+		t.Errorf("Username trace = %+v", traces[1])
+	}
+	if !reflect.DeepEqual(traces[2].Shadowed, []string{"header:X-User"}) || !reflect.DeepEqual(traces[2].Set, []string{"body:metadata.email"}) {
+		t.Errorf("Email trace = %+v, want the header shadowed and the body set", traces[2])
+	}
+	if traces[3].Value != "alice@example.com" || traces[3].Output == traces[3].Value {
+		t.Errorf("Encrypted trace = %+v, want the filtered output", traces[3])
+	}
+}
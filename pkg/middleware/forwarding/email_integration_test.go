@@ -130,7 +130,7 @@ func TestEmailAuthIntegration(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create forwarder
-			forwarder := NewForwarder(tt.config, []config.OAuth2Provider{})
+			forwarder := newTestForwarder(t, tt.config)
 
 			if tt.testQuery {
 				// Test query string forwarding
@@ -247,7 +247,7 @@ func TestEmailAuthWithEncryption(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, []config.OAuth2Provider{})
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string forwarding
 			baseURL := "http://example.com/path"
@@ -387,7 +387,7 @@ func TestEmailAuthWithDifferentEmails(t *testing.T) {
 				},
 			}
 
-			forwarder := NewForwarder(cfg, []config.OAuth2Provider{})
+			forwarder := newTestForwarder(t, cfg)
 
 			// Test query string forwarding
 			baseURL := "http://example.com/path"
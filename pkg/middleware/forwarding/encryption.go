@@ -1,14 +1,24 @@
 package forwarding
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/forwarded"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 )
 
 var (
@@ -17,86 +27,245 @@ var (
 
 	// ErrDecryptionFailed is returned when decryption fails
 	ErrDecryptionFailed = errors.New("decryption failed")
+
+	// ErrUnsupportedAlgorithm is returned for unknown encryption algorithms
+	ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+
+	// ErrInvalidPublicKey is returned when the public key is not a PEM RSA public key of 2048 bits or more
+	ErrInvalidPublicKey = errors.New("invalid RSA public key")
 )
 
+// minRSAKeyBits is the minimum RSA public key size of rsa-oaep encryption
+const minRSAKeyBits = 2048
+
 // Encryptor handles encryption and decryption of user data
 type Encryptor struct {
-	key []byte
+	key       []byte         // SHA-256 hash of the shared key
+	algorithm string         // AEAD algorithm (forwarded.Algorithm*)
+	publicKey *rsa.PublicKey // Upstream's public key (rsa-oaep only)
+	stamp     bool           // Prefix the encrypt filter's plaintext with a timestamp and nonce
+
+	// legacyEncoding makes the encrypt filter output base64 text, which the filter chain
+	// base64-encodes again (the format before single encoding)
+	legacyEncoding bool
 }
 
-// NewEncryptor creates a new Encryptor with the given key
+// NewEncryptor creates a new AES-256-GCM Encryptor with the given key
 // The key is hashed with SHA-256 to ensure it's exactly 32 bytes for AES-256
 func NewEncryptor(key string) *Encryptor {
 	hash := sha256.Sum256([]byte(key))
 	return &Encryptor{
-		key: hash[:],
+		key:       hash[:],
+		algorithm: forwarded.AlgorithmAES256GCM,
 	}
 }
 
-// Encrypt encrypts the plaintext using AES-256-GCM and returns a base64-encoded string
-// The encrypted data format is: [nonce (12 bytes)][ciphertext]
-func (e *Encryptor) Encrypt(plaintext string) (string, error) {
-	// Create AES cipher
-	block, err := aes.NewCipher(e.key)
+// NewPublicKeyEncryptor creates an rsa-oaep Encryptor for the upstream's PEM public key
+// (PKIX "PUBLIC KEY" or PKCS #1 "RSA PUBLIC KEY"). Each value gets a random AES-256-GCM key
+// wrapped with RSA-OAEP (SHA-256), so the gate holds no secret that decrypts forwarded values.
+func NewPublicKeyEncryptor(publicKeyPEM []byte) (*Encryptor, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidPublicKey, block.Type)
+	}
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrInvalidPublicKey)
+	}
+	if rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("%w: %d bits (minimum %d)", ErrInvalidPublicKey, rsaKey.N.BitLen(), minRSAKeyBits)
+	}
+	return &Encryptor{algorithm: forwarded.AlgorithmRSAOAEP, publicKey: rsaKey}, nil
+}
+
+// LoadPublicKeyEncryptor creates the rsa-oaep Encryptor of encryption.public_key or public_key_file
+// It returns nil without a public key.
+func LoadPublicKeyEncryptor(cfg config.EncryptionConfig) (*Encryptor, error) {
+	publicKeyPEM := []byte(cfg.PublicKey)
+	if cfg.PublicKey == "" {
+		if cfg.PublicKeyFile == "" {
+			return nil, nil
+		}
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKeyPEM = data
+	}
+	return NewPublicKeyEncryptor(publicKeyPEM)
+}
+
+// WithAlgorithm returns a copy of the Encryptor using another algorithm with the same key
+// Supported: "aes-256-gcm", "aes-128-gcm" (first 16 bytes of the key hash) and "chacha20-poly1305"
+// (rsa-oaep needs a public key: NewPublicKeyEncryptor)
+func (e *Encryptor) WithAlgorithm(algorithm string) (*Encryptor, error) {
+	if _, ok := forwarded.Envelope(algorithm); !ok || algorithm == forwarded.AlgorithmRSAOAEP {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+	copied := *e
+	copied.algorithm = algorithm
+	return &copied, nil
+}
+
+// WithStamp returns a copy of the Encryptor whose encrypt filter stamps values
+// The stamp (timestamp and nonce) is encrypted with the value, so upstreams can reject replays.
+func (e *Encryptor) WithStamp() *Encryptor {
+	copied := *e
+	copied.stamp = true
+	return &copied
+}
+
+// Algorithm returns the encryption algorithm
+func (e *Encryptor) Algorithm() string {
+	return e.algorithm
+}
+
+// SetLegacyEncoding enables the double base64 encoding of encrypted forwarded values
+// Only for upstreams that still decode twice (forwarding.encryption.legacy_encoding)
+func (e *Encryptor) SetLegacyEncoding(enabled bool) {
+	e.legacyEncoding = enabled
+}
+
+// envelope returns the envelope identifier of encrypted forwarded values
+// Legacy encoding predates envelopes and has none
+func (e *Encryptor) envelope() string {
+	if e.legacyEncoding {
+		return ""
+	}
+	id, _ := forwarded.Envelope(e.algorithm)
+	if e.stamp {
+		id += forwarded.StampSuffix
 	}
+	return id
+}
 
-	// Create GCM mode
-	aesGCM, err := cipher.NewGCM(block)
+// stampPlaintext prefixes data with the current time and a random nonce (forwarded.StampSize bytes)
+func stampPlaintext(data []byte) ([]byte, error) {
+	stamped := make([]byte, forwarded.StampSize, forwarded.StampSize+len(data))
+	binary.BigEndian.PutUint64(stamped, uint64(time.Now().Unix()))
+	if _, err := io.ReadFull(rand.Reader, stamped[8:]); err != nil {
+		return nil, err
+	}
+	return append(stamped, data...), nil
+}
+
+// Seal encrypts the plaintext using the algorithm
+// The encrypted data format is: [nonce (12 bytes)][ciphertext][tag (16 bytes)]
+// With rsa-oaep, it is preceded by the RSA-OAEP wrapped content key (the size of the modulus).
+func (e *Encryptor) Seal(plaintext []byte) ([]byte, error) {
+	if e.publicKey != nil {
+		return e.sealRSAOAEP(plaintext)
+	}
+
+	aead, err := e.aead()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return sealWithNonce(aead, nil, plaintext)
+}
+
+// sealRSAOAEP encrypts the plaintext under a random AES-256-GCM key wrapped with the public key
+func (e *Encryptor) sealRSAOAEP(plaintext []byte) ([]byte, error) {
+	contentKey := make([]byte, forwarded.ContentKeySize)
+	if _, err := io.ReadFull(rand.Reader, contentKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, e.publicKey, contentKey, nil)
+	if err != nil {
+		return nil, err
 	}
+	aead, err := forwarded.NewAEAD(forwarded.AlgorithmAES256GCM, contentKey)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithNonce(aead, wrapped, plaintext)
+}
 
+// sealWithNonce appends a random nonce and the sealed plaintext to prefix
+func sealWithNonce(aead cipher.AEAD, prefix, plaintext []byte) ([]byte, error) {
 	// Generate random nonce
-	nonce := make([]byte, aesGCM.NonceSize())
+	nonce := make([]byte, aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Encrypt and authenticate
-	ciphertext := aesGCM.Seal(nonce, nonce, []byte(plaintext), nil)
-
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return aead.Seal(append(prefix, nonce...), nonce, plaintext, nil), nil
 }
 
-// Decrypt decrypts the base64-encoded ciphertext using AES-256-GCM
-func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
-	// Decode from base64
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+// Open decrypts data produced by Seal
+// rsa-oaep Encryptors cannot decrypt: only the upstream holds the private key.
+func (e *Encryptor) Open(data []byte) ([]byte, error) {
+	if e.publicKey != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	aead, err := e.aead()
 	if err != nil {
-		return "", ErrInvalidCiphertext
+		return nil, err
+	}
+
+	// Check minimum length (nonce + at least some data)
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrInvalidCiphertext
 	}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(e.key)
+	// Extract nonce and encrypted data, then decrypt and verify
+	plaintext, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
 	if err != nil {
-		return "", err
+		return nil, ErrDecryptionFailed
 	}
+	return plaintext, nil
+}
+
+// aead returns the cipher of the algorithm and key
+func (e *Encryptor) aead() (cipher.AEAD, error) {
+	return forwarded.NewAEAD(e.algorithm, e.key)
+}
 
-	// Create GCM mode
-	aesGCM, err := cipher.NewGCM(block)
+// Encrypt encrypts the plaintext using the algorithm and returns a base64-encoded string
+// The encrypted data format is: [nonce (12 bytes)][ciphertext][tag (16 bytes)]
+func (e *Encryptor) Encrypt(plaintext string) (string, error) {
+	sealed, err := e.Seal([]byte(plaintext))
 	if err != nil {
 		return "", err
 	}
 
-	// Check minimum length (nonce + at least some data)
-	nonceSize := aesGCM.NonceSize()
-	if len(data) < nonceSize {
-		return "", ErrInvalidCiphertext
-	}
+	// Encode to base64
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
 
-	// Extract nonce and encrypted data
-	nonce := data[:nonceSize]
-	encryptedData := data[nonceSize:]
+// Decrypt decrypts the base64-encoded ciphertext using the algorithm
+// The algorithm's envelope prefix (forwarded values, e.g. "v1:") is accepted
+func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
+	if id, ok := forwarded.Envelope(e.algorithm); ok {
+		ciphertext = strings.TrimPrefix(ciphertext, id+":")
+	}
 
-	// Decrypt and verify
-	plaintext, err := aesGCM.Open(nil, nonce, encryptedData, nil)
+	// Decode from base64
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
-		return "", ErrDecryptionFailed
+		return "", ErrInvalidCiphertext
 	}
 
+	plaintext, err := e.Open(data)
+	if err != nil {
+		return "", err
+	}
 	return string(plaintext), nil
 }
 
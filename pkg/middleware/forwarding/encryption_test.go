@@ -1,8 +1,16 @@
 package forwarding
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 )
 
 func TestEncryptor_EncryptDecrypt(t *testing.T) {
@@ -163,6 +171,101 @@ func TestEncryptor_DifferentKeys(t *testing.T) {
 	}
 }
 
+func TestEncryptor_WithAlgorithm(t *testing.T) {
+	key := "this-is-a-32-character-encryption-key"
+	plaintext := "secret message"
+
+	for _, algorithm := range []string{"aes-256-gcm", "aes-128-gcm", "chacha20-poly1305"} {
+		t.Run(algorithm, func(t *testing.T) {
+			encryptor, err := NewEncryptor(key).WithAlgorithm(algorithm)
+			if err != nil {
+				t.Fatalf("WithAlgorithm() error = %v", err)
+			}
+			if encryptor.Algorithm() != algorithm {
+				t.Errorf("Algorithm() = %q, want %q", encryptor.Algorithm(), algorithm)
+			}
+
+			ciphertext, err := encryptor.Encrypt(plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			decrypted, err := encryptor.Decrypt(ciphertext)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if decrypted != plaintext {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, plaintext)
+			}
+		})
+	}
+
+	// Values of one algorithm do not decrypt with another
+	chacha, _ := NewEncryptor(key).WithAlgorithm("chacha20-poly1305")
+	ciphertext, err := NewEncryptor(key).Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err := chacha.Decrypt(ciphertext); err != ErrDecryptionFailed {
+		t.Errorf("Decrypt() with another algorithm should fail, got error = %v", err)
+	}
+
+	for _, algorithm := range []string{"aes-192-gcm", "rsa-oaep"} {
+		if _, err := NewEncryptor(key).WithAlgorithm(algorithm); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("WithAlgorithm(%s) error = %v, want ErrUnsupportedAlgorithm", algorithm, err)
+		}
+	}
+}
+
+func TestNewPublicKeyEncryptor(t *testing.T) {
+	publicKeyPEM, err := os.ReadFile("../../forwarded/testdata/rsa-public.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	encryptor, err := NewPublicKeyEncryptor(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("NewPublicKeyEncryptor() error = %v", err)
+	}
+	if encryptor.Algorithm() != "rsa-oaep" {
+		t.Errorf("Algorithm() = %q, want rsa-oaep", encryptor.Algorithm())
+	}
+
+	// The gate cannot decrypt its own output
+	sealed, err := encryptor.Seal([]byte("secret message"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if _, err := encryptor.Open(sealed); err != ErrDecryptionFailed {
+		t.Errorf("Open() error = %v, want ErrDecryptionFailed", err)
+	}
+
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	smallPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&smallKey.PublicKey)})
+	privatePEM, _ := os.ReadFile("../../forwarded/testdata/rsa-private.pem")
+
+	for name, data := range map[string][]byte{"not PEM": []byte("key"), "1024 bits": smallPEM, "private key": privatePEM} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewPublicKeyEncryptor(data); !errors.Is(err, ErrInvalidPublicKey) {
+				t.Errorf("NewPublicKeyEncryptor() error = %v, want ErrInvalidPublicKey", err)
+			}
+		})
+	}
+}
+
+func TestLoadPublicKeyEncryptor(t *testing.T) {
+	if encryptor, err := LoadPublicKeyEncryptor(config.EncryptionConfig{Key: "this-is-a-32-character-encryption-key"}); encryptor != nil || err != nil {
+		t.Errorf("LoadPublicKeyEncryptor() without public key = %v, %v, want nil", encryptor, err)
+	}
+	if _, err := LoadPublicKeyEncryptor(config.EncryptionConfig{PublicKeyFile: "../../forwarded/testdata/rsa-public.pem"}); err != nil {
+		t.Errorf("LoadPublicKeyEncryptor() from file error = %v", err)
+	}
+	if _, err := LoadPublicKeyEncryptor(config.EncryptionConfig{PublicKeyFile: "testdata/missing.pem"}); err == nil {
+		t.Error("LoadPublicKeyEncryptor() with a missing file should fail")
+	}
+}
+
 func TestEncryptor_EncryptDecryptMap(t *testing.T) {
 	key := "this-is-a-32-character-encryption-key"
 	encryptor := NewEncryptor(key)
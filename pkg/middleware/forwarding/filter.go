@@ -34,7 +34,7 @@ type Filter interface {
 	Apply(input *FilterOutput) (*FilterOutput, error)
 }
 
-// EncryptFilter applies AES-256-GCM encryption
+// EncryptFilter applies AEAD encryption (AES-256-GCM by default)
 type EncryptFilter struct {
 	encryptor *Encryptor
 }
@@ -48,7 +48,10 @@ func (f *EncryptFilter) Name() string {
 }
 
 func (f *EncryptFilter) InputTypes() []DataType {
-	return []DataType{DataTypeString}
+	if f.encryptor.legacyEncoding {
+		return []DataType{DataTypeString}
+	}
+	return []DataType{DataTypeString, DataTypeBinary}
 }
 
 func (f *EncryptFilter) OutputType() DataType {
@@ -56,15 +59,34 @@ func (f *EncryptFilter) OutputType() DataType {
 }
 
 func (f *EncryptFilter) Apply(input *FilterOutput) (*FilterOutput, error) {
-	// Encrypt returns base64 string, but we treat it as binary for the pipeline
-	encrypted, err := f.encryptor.Encrypt(string(input.Data))
+	if f.encryptor.legacyEncoding {
+		// Legacy: Encrypt returns base64 text, which is treated as binary and encoded again
+		encrypted, err := f.encryptor.Encrypt(string(input.Data))
+		if err != nil {
+			return nil, fmt.Errorf("encrypt filter: %w", err)
+		}
+		return &FilterOutput{
+			Data: []byte(encrypted),
+			Type: DataTypeBinary,
+		}, nil
+	}
+
+	plaintext := input.Data
+	if f.encryptor.stamp {
+		stamped, err := stampPlaintext(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt filter: %w", err)
+		}
+		plaintext = stamped
+	}
+
+	// Raw nonce, ciphertext and tag; the chain base64-encodes the final output once
+	sealed, err := f.encryptor.Seal(plaintext)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt filter: %w", err)
 	}
-
-	// Store encrypted base64 string as bytes (binary type)
 	return &FilterOutput{
-		Data: []byte(encrypted),
+		Data: sealed,
 		Type: DataTypeBinary,
 	}, nil
 }
@@ -135,7 +157,8 @@ func (f *Base64Filter) Apply(input *FilterOutput) (*FilterOutput, error) {
 
 // FilterChain represents a chain of filters
 type FilterChain struct {
-	filters []Filter
+	filters  []Filter
+	envelope string // Envelope identifier prefixed to encrypted output ("" for none)
 }
 
 // NewFilterChain creates a new filter chain
@@ -145,6 +168,7 @@ func NewFilterChain(filterNames []string, encryptor *Encryptor) (*FilterChain, e
 	}
 
 	filters := make([]Filter, 0, len(filterNames))
+	envelope := ""
 	for _, name := range filterNames {
 		var filter Filter
 		switch name {
@@ -153,6 +177,7 @@ func NewFilterChain(filterNames []string, encryptor *Encryptor) (*FilterChain, e
 				return nil, errors.New("encrypt filter requires encryption config")
 			}
 			filter = NewEncryptFilter(encryptor)
+			envelope = encryptor.envelope()
 		case "zip":
 			filter = NewZipFilter()
 		case "base64":
@@ -163,7 +188,7 @@ func NewFilterChain(filterNames []string, encryptor *Encryptor) (*FilterChain, e
 		filters = append(filters, filter)
 	}
 
-	return &FilterChain{filters: filters}, nil
+	return &FilterChain{filters: filters, envelope: envelope}, nil
 }
 
 // Apply applies all filters in the chain
@@ -210,5 +235,9 @@ func (fc *FilterChain) Apply(input string) (string, error) {
 		output = result
 	}
 
+	// Encrypted output is an envelope naming its format (e.g., "v1:<base64>")
+	if fc.envelope != "" {
+		return fc.envelope + ":" + string(output.Data), nil
+	}
 	return string(output.Data), nil
 }
@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"errors"
 	"io"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/forwarded"
 )
 
 func TestEncryptFilter(t *testing.T) {
@@ -26,14 +31,14 @@ func TestEncryptFilter(t *testing.T) {
 		t.Errorf("OutputType = %v, want %v", output.Type, DataTypeBinary)
 	}
 
-	// Verify we can decrypt
-	decrypted, err := encryptor.Decrypt(string(output.Data))
+	// Verify we can decrypt the raw output
+	decrypted, err := encryptor.Open(output.Data)
 	if err != nil {
-		t.Fatalf("Decrypt() error = %v", err)
+		t.Fatalf("Open() error = %v", err)
 	}
 
-	if decrypted != "hello world" {
-		t.Errorf("Decrypted = %v, want %v", decrypted, "hello world")
+	if string(decrypted) != "hello world" {
+		t.Errorf("Decrypted = %v, want %v", string(decrypted), "hello world")
 	}
 }
 
@@ -106,13 +111,35 @@ func TestFilterChain_EncryptOnly(t *testing.T) {
 		t.Fatalf("Apply() error = %v", err)
 	}
 
-	// Result should be base64-encoded encrypted data (auto base64)
+	// Result should be base64-encoded exactly once (auto base64)
+	decrypted, err := encryptor.Decrypt(result)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+
+	if decrypted != "hello world" {
+		t.Errorf("Decrypted = %v, want %v", decrypted, "hello world")
+	}
+}
+
+func TestFilterChain_EncryptLegacyEncoding(t *testing.T) {
+	encryptor := NewEncryptor("this-is-a-32-character-encryption-key-12345")
+	encryptor.SetLegacyEncoding(true)
+	chain, err := NewFilterChain([]string{"encrypt"}, encryptor)
+	if err != nil {
+		t.Fatalf("NewFilterChain() error = %v", err)
+	}
+
+	result, err := chain.Apply("hello world")
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Legacy result is base64-encoded twice
 	decoded, err := base64.StdEncoding.DecodeString(result)
 	if err != nil {
 		t.Fatalf("base64 decode error = %v", err)
 	}
-
-	// Decrypt
 	decrypted, err := encryptor.Decrypt(string(decoded))
 	if err != nil {
 		t.Fatalf("Decrypt() error = %v", err)
@@ -135,9 +162,13 @@ func TestFilterChain_EncryptThenZip(t *testing.T) {
 		t.Fatalf("Apply() error = %v", err)
 	}
 
-	// Result should be base64-encoded (auto)
-	// Step 1: Decode base64
-	compressed, err := base64.StdEncoding.DecodeString(result)
+	// Result should be a v1 envelope of base64 (auto)
+	// Step 1: Strip the envelope and decode base64
+	payload, ok := strings.CutPrefix(result, "v1:")
+	if !ok {
+		t.Fatalf("Result = %q, want a v1 envelope", result)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(payload)
 	if err != nil {
 		t.Fatalf("base64 decode error = %v", err)
 	}
@@ -154,14 +185,50 @@ func TestFilterChain_EncryptThenZip(t *testing.T) {
 		t.Fatalf("ReadAll() error = %v", err)
 	}
 
-	// Step 3: Decrypt (decompressed is encrypted base64 string)
-	decrypted, err := encryptor.Decrypt(string(decompressed))
+	// Step 3: Decrypt (decompressed is the raw nonce, ciphertext and tag)
+	decrypted, err := encryptor.Open(decompressed)
 	if err != nil {
-		t.Fatalf("Decrypt() error = %v", err)
+		t.Fatalf("Open() error = %v", err)
 	}
 
-	if decrypted != "hello world" {
-		t.Errorf("Decrypted = %v, want %v", decrypted, "hello world")
+	if string(decrypted) != "hello world" {
+		t.Errorf("Decrypted = %v, want %v", string(decrypted), "hello world")
+	}
+}
+
+func TestFilterChain_ZipThenEncrypt(t *testing.T) {
+	encryptor := NewEncryptor("this-is-a-32-character-encryption-key-12345")
+	chain, err := NewFilterChain([]string{"zip", "encrypt"}, encryptor)
+	if err != nil {
+		t.Fatalf("NewFilterChain() error = %v", err)
+	}
+
+	result, err := chain.Apply("hello world")
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Strip the envelope, decode base64 once, decrypt, then decompress
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(result, "v1:"))
+	if err != nil {
+		t.Fatalf("base64 decode error = %v", err)
+	}
+	compressed, err := encryptor.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(decompressed) != "hello world" {
+		t.Errorf("Decrypted = %v, want %v", string(decompressed), "hello world")
 	}
 }
 
@@ -228,3 +295,128 @@ func TestFilterChain_UnknownFilter(t *testing.T) {
 		t.Error("NewFilterChain() expected error for unknown filter, got nil")
 	}
 }
+
+func TestFilterChain_DecryptableByForwarded(t *testing.T) {
+	const key = "this-is-a-32-character-encryption-key-12345"
+	decryptor := forwarded.NewDecryptor(key)
+
+	algorithms := []string{forwarded.AlgorithmAES256GCM, forwarded.AlgorithmAES128GCM, forwarded.AlgorithmChaCha20Poly1305}
+	for _, algorithm := range algorithms {
+		encryptor, err := NewEncryptor(key).WithAlgorithm(algorithm)
+		if err != nil {
+			t.Fatalf("WithAlgorithm() error = %v", err)
+		}
+		envelope, _ := forwarded.Envelope(algorithm)
+
+		for _, filters := range [][]string{{"encrypt"}, {"encrypt", "zip"}, {"zip", "encrypt"}} {
+			t.Run(algorithm+"/"+strings.Join(filters, ","), func(t *testing.T) {
+				chain, err := NewFilterChain(filters, encryptor)
+				if err != nil {
+					t.Fatalf("NewFilterChain() error = %v", err)
+				}
+				result, err := chain.Apply("alice@example.com")
+				if err != nil {
+					t.Fatalf("Apply() error = %v", err)
+				}
+				if !strings.HasPrefix(result, envelope+":") {
+					t.Errorf("Result = %q, want a %s envelope", result, envelope)
+				}
+
+				decrypted, err := decryptor.Decrypt(result)
+				if err != nil {
+					t.Fatalf("forwarded Decrypt() error = %v", err)
+				}
+				if decrypted != "alice@example.com" {
+					t.Errorf("Decrypted = %q, want alice@example.com", decrypted)
+				}
+			})
+		}
+	}
+
+	// rsa-oaep values decrypt with the upstream's private key only
+	publicKeyPEM, err := os.ReadFile("../../forwarded/testdata/rsa-public.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	privateKeyPEM, err := os.ReadFile("../../forwarded/testdata/rsa-private.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	encryptor, err := NewPublicKeyEncryptor(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("NewPublicKeyEncryptor() error = %v", err)
+	}
+	privateDecryptor, err := forwarded.NewPrivateKeyDecryptor(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("NewPrivateKeyDecryptor() error = %v", err)
+	}
+	for _, filters := range [][]string{{"encrypt"}, {"encrypt", "zip"}, {"zip", "encrypt"}} {
+		t.Run("rsa-oaep/"+strings.Join(filters, ","), func(t *testing.T) {
+			chain, err := NewFilterChain(filters, encryptor)
+			if err != nil {
+				t.Fatalf("NewFilterChain() error = %v", err)
+			}
+			result, err := chain.Apply("alice@example.com")
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !strings.HasPrefix(result, forwarded.EnvelopeV1RSAOAEP+":") {
+				t.Errorf("Result = %q, want a %s envelope", result, forwarded.EnvelopeV1RSAOAEP)
+			}
+
+			decrypted, err := privateDecryptor.Decrypt(result)
+			if err != nil {
+				t.Fatalf("forwarded Decrypt() error = %v", err)
+			}
+			if decrypted != "alice@example.com" {
+				t.Errorf("Decrypted = %q, want alice@example.com", decrypted)
+			}
+			if _, err := decryptor.Decrypt(result); !errors.Is(err, forwarded.ErrKeyRequired) {
+				t.Errorf("Shared key Decrypt() error = %v, want ErrKeyRequired", err)
+			}
+		})
+	}
+}
+
+func TestFilterChain_Stamp(t *testing.T) {
+	const key = "this-is-a-32-character-encryption-key-12345"
+	decryptor := forwarded.NewDecryptor(key)
+	verifier := forwarded.NewVerifier(0)
+
+	for _, filters := range [][]string{{"encrypt"}, {"zip", "encrypt"}} {
+		t.Run(strings.Join(filters, ","), func(t *testing.T) {
+			chain, err := NewFilterChain(filters, NewEncryptor(key).WithStamp())
+			if err != nil {
+				t.Fatalf("NewFilterChain() error = %v", err)
+			}
+			result, err := chain.Apply("alice@example.com")
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !strings.HasPrefix(result, forwarded.EnvelopeV1+forwarded.StampSuffix+":") {
+				t.Errorf("Result = %q, want a stamped v1 envelope", result)
+			}
+
+			decrypted, err := decryptor.DecryptVerified(result, verifier)
+			if err != nil {
+				t.Fatalf("DecryptVerified() error = %v", err)
+			}
+			if decrypted != "alice@example.com" {
+				t.Errorf("Decrypted = %q, want alice@example.com", decrypted)
+			}
+			if _, err := decryptor.DecryptVerified(result, verifier); !errors.Is(err, forwarded.ErrReplayed) {
+				t.Errorf("Replayed DecryptVerified() error = %v, want ErrReplayed", err)
+			}
+		})
+	}
+
+	// Each value gets its own nonce
+	chain, _ := NewFilterChain([]string{"encrypt"}, NewEncryptor(key).WithStamp())
+	first, _ := chain.Apply("alice@example.com")
+	second, _ := chain.Apply("alice@example.com")
+	_, stamp1, _ := decryptor.OpenStamped(first)
+	_, stamp2, _ := decryptor.OpenStamped(second)
+	if stamp1 == nil || stamp2 == nil || stamp1.Nonce == stamp2.Nonce {
+		t.Errorf("Stamps = %+v, %+v, want distinct nonces", stamp1, stamp2)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 
+	"github.com/ideamans/chatbotgate/pkg/forwarded"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
 )
 
 var (
@@ -38,10 +41,10 @@ func sanitizeHeaderValue(value string) string {
 
 // UserInfo contains user information to be forwarded
 type UserInfo struct {
-	Username string
-	Email    string
-	Extra    map[string]interface{} // Additional data from OAuth2 provider
-	Provider string                 // OAuth2 provider name
+	Username string                 `json:"username"`
+	Email    string                 `json:"email"`
+	Extra    map[string]interface{} `json:"extra"`    // Additional data from OAuth2 provider
+	Provider string                 `json:"provider"` // OAuth2 provider name
 }
 
 // Forwarder is the interface for forwarding user information
@@ -55,24 +58,82 @@ type Forwarder interface {
 	AddToQueryString(targetURL string, userInfo *UserInfo) (string, error)
 }
 
-// DefaultForwarder is the default implementation of Forwarder
+// BodyForwarder is implemented by forwarders that also forward user info in request bodies
+type BodyForwarder interface {
+	// AddToBody sets user info fields in the JSON body of API requests
+	// Requests outside the body path or without a JSON body are left unchanged
+	AddToBody(r *http.Request, userInfo *UserInfo) error
+}
+
+// DryRunner is implemented by forwarders that can show what they would forward
+type DryRunner interface {
+	// DryRun shows the headers, query parameters and body fields that would be produced for a user
+	DryRun(userInfo *UserInfo) *DryRunResult
+}
+
+// DefaultForwarder is the default implementation of Forwarder, BodyForwarder and DryRunner
 type DefaultForwarder struct {
-	config    *config.ForwardingConfig
-	encryptor *Encryptor
+	config     *config.ForwardingConfig
+	fields     []config.ForwardingField // Configured fields plus the backend profile's fields
+	headers    []string                 // Canonical header keys of fields, by index ("" without a header)
+	exprs      []*expr.Value            // Compiled expressions of fields, by index (nil for path fields)
+	encryptors []*Encryptor             // Encryptors of fields with their algorithm, by index (nil without encryption)
 }
 
 // NewForwarder creates a new DefaultForwarder
-func NewForwarder(cfg *config.ForwardingConfig, providers []config.OAuth2Provider) *DefaultForwarder {
+// It fails when a field expression does not compile or the public key of rsa-oaep cannot be loaded.
+func NewForwarder(cfg *config.ForwardingConfig, providers []config.OAuth2Provider) (*DefaultForwarder, error) {
 	f := &DefaultForwarder{
 		config: cfg,
+		fields: cfg.EffectiveFields(),
 	}
 
-	// Initialize encryptor if encryption config is provided
-	if cfg.Encryption != nil && cfg.Encryption.Key != "" {
-		f.encryptor = NewEncryptor(cfg.Encryption.Key)
+	// Compile field expressions (validated with the configuration as well)
+	// Header keys are canonicalized once instead of by Header.Set on every request
+	f.exprs = make([]*expr.Value, len(f.fields))
+	f.headers = make([]string, len(f.fields))
+	for i, field := range f.fields {
+		if field.Expr != "" {
+			compiled, err := expr.CompileValue(field.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Source(), err)
+			}
+			f.exprs[i] = compiled
+		}
+		if field.Header != "" {
+			f.headers[i] = http.CanonicalHeaderKey(field.Header)
+		}
 	}
 
-	return f
+	// Initialize encryptors if encryption config is provided
+	// Fields of unsupported algorithms (rejected with the configuration) are left unencrypted, so they are skipped
+	f.encryptors = make([]*Encryptor, len(f.fields))
+	if cfg.Encryption != nil {
+		var base *Encryptor
+		if cfg.Encryption.Key != "" {
+			base = NewEncryptor(cfg.Encryption.Key)
+			base.SetLegacyEncoding(cfg.Encryption.LegacyEncoding)
+		}
+		public, err := LoadPublicKeyEncryptor(*cfg.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("forwarding.encryption: %w", err)
+		}
+
+		for i, field := range f.fields {
+			algorithm := field.EncryptionAlgorithm(*cfg.Encryption)
+			switch {
+			case algorithm == forwarded.AlgorithmRSAOAEP:
+				f.encryptors[i] = public
+			case base != nil:
+				f.encryptors[i], _ = base.WithAlgorithm(algorithm)
+			}
+			if field.Stamp && f.encryptors[i] != nil {
+				f.encryptors[i] = f.encryptors[i].WithStamp()
+			}
+		}
+	}
+
+	return f, nil
 }
 
 // AddToQueryString adds user info to a URL's query string
@@ -91,7 +152,7 @@ func (f *DefaultForwarder) AddToQueryString(targetURL string, userInfo *UserInfo
 	setParams := make(map[string]bool)
 
 	// Process each field
-	for _, field := range f.config.Fields {
+	for i, field := range f.fields {
 		// Skip if query is not specified for this field
 		if field.Query == "" {
 			continue
@@ -103,16 +164,16 @@ func (f *DefaultForwarder) AddToQueryString(targetURL string, userInfo *UserInfo
 		}
 
 		// Get the value for this field
-		value, err := f.getFieldValue(userInfo, field.Path)
+		value, err := f.fieldValue(i, userInfo)
 		if err != nil {
 			// Skip fields that cannot be retrieved
 			continue
 		}
 
 		// Apply filters
-		processed, err := f.applyFilters(value, field.Filters)
+		processed, err := f.applyFilters(i, value)
 		if err != nil {
-			return "", fmt.Errorf("field %s: %w", field.Path, err)
+			return "", fmt.Errorf("field %s: %w", field.Source(), err)
 		}
 
 		// Add to query string and mark as set
@@ -129,35 +190,36 @@ func (f *DefaultForwarder) AddToQueryString(targetURL string, userInfo *UserInfo
 // Processes each configured field and adds it as an HTTP header
 func (f *DefaultForwarder) AddToHeaders(headers http.Header, userInfo *UserInfo) http.Header {
 	// Clone headers
-	result := make(http.Header)
+	result := make(http.Header, len(headers)+len(f.fields))
 	for key, values := range headers {
 		result[key] = values
 	}
 
 	// Track which headers have been set (for priority: first successful path wins)
-	setHeaders := make(map[string]bool)
+	setHeaders := make(map[string]bool, len(f.fields))
 
 	// Process each field
-	for _, field := range f.config.Fields {
+	for i := range f.fields {
 		// Skip if header is not specified for this field
-		if field.Header == "" {
+		header := f.headers[i]
+		if header == "" {
 			continue
 		}
 
 		// Skip if this header was already set by a previous field
-		if setHeaders[field.Header] {
+		if setHeaders[header] {
 			continue
 		}
 
 		// Get the value for this field
-		value, err := f.getFieldValue(userInfo, field.Path)
+		value, err := f.fieldValue(i, userInfo)
 		if err != nil {
 			// Skip fields that cannot be retrieved
 			continue
 		}
 
 		// Apply filters
-		processed, err := f.applyFilters(value, field.Filters)
+		processed, err := f.applyFilters(i, value)
 		if err != nil {
 			// Log error but don't fail the request
 			continue
@@ -167,13 +229,72 @@ func (f *DefaultForwarder) AddToHeaders(headers http.Header, userInfo *UserInfo)
 		sanitized := sanitizeHeaderValue(processed)
 
 		// Add to headers and mark as set
-		result.Set(field.Header, sanitized)
-		setHeaders[field.Header] = true
+		result[header] = []string{sanitized}
+		setHeaders[header] = true
 	}
 
 	return result
 }
 
+// AddToBody sets user info fields in the JSON body of requests under the body path
+// Like headers, the first field that yields a value wins for each body field.
+// Body fields without a value are deleted, so that a value sent by the client never reaches the upstream.
+func (f *DefaultForwarder) AddToBody(r *http.Request, userInfo *UserInfo) error {
+	bodyPath := strings.TrimSuffix(f.config.GetBodyPath(), "/")
+	if bodyPath != "" && r.URL.Path != bodyPath && !strings.HasPrefix(r.URL.Path, bodyPath+"/") {
+		return nil
+	}
+	if !IsJSONRequest(r) {
+		return nil
+	}
+
+	values := make(map[string]string)
+	var paths []string
+	for i, field := range f.fields {
+		if field.Body == "" {
+			continue
+		}
+		if !slices.Contains(paths, field.Body) {
+			paths = append(paths, field.Body)
+		}
+		if _, set := values[field.Body]; set {
+			continue
+		}
+
+		value, err := f.fieldValue(i, userInfo)
+		if err != nil {
+			continue
+		}
+		processed, err := f.applyFilters(i, value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Source(), err)
+		}
+		values[field.Body] = processed
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+	return rewriteJSONBody(r, values, paths)
+}
+
+// fieldValue retrieves the value of the i-th field from its expression or path
+// Expressions yielding an empty string have no value, so that a later field can provide it
+func (f *DefaultForwarder) fieldValue(i int, userInfo *UserInfo) (string, error) {
+	field := f.fields[i]
+	if field.Expr == "" {
+		return f.getFieldValue(userInfo, field.Path)
+	}
+	value, err := f.exprs[i].Eval(expr.NewUserVars(userInfo.Username, userInfo.Email, userInfo.Provider, userInfo.Extra))
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("expression is empty: %s", field.Expr)
+	}
+	return value, nil
+}
+
 // getFieldValue retrieves the value for a given path from UserInfo
 // Supports dot-separated paths (e.g., "email", "extra.secrets.access_token")
 // Special path "." returns the entire UserInfo object as JSON
@@ -239,14 +360,15 @@ func (f *DefaultForwarder) getValueFromExtra(extra map[string]interface{}, path
 	return value, nil
 }
 
-// applyFilters applies the filter chain to the value
-func (f *DefaultForwarder) applyFilters(value string, filters config.FilterList) (string, error) {
+// applyFilters applies the filter chain of field i to the value
+func (f *DefaultForwarder) applyFilters(i int, value string) (string, error) {
+	filters := f.fields[i].Filters
 	if len(filters) == 0 {
 		return value, nil
 	}
 
 	// Create filter chain
-	chain, err := NewFilterChain(filters, f.encryptor)
+	chain, err := NewFilterChain(filters, f.encryptors[i])
 	if err != nil {
 		return "", err
 	}
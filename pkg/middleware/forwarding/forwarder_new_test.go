@@ -1,13 +1,53 @@
 package forwarding
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/ideamans/chatbotgate/pkg/forwarded"
 	"github.com/ideamans/chatbotgate/pkg/middleware/config"
 )
 
+// newTestForwarder creates the forwarder of cfg, failing the test on an error
+func newTestForwarder(t *testing.T, cfg *config.ForwardingConfig) *DefaultForwarder {
+	t.Helper()
+	forwarder, err := NewForwarder(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewForwarder() error = %v", err)
+	}
+	return forwarder
+}
+
+func TestNewForwarder_InvalidPublicKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upstream.pub.pem")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Algorithm: forwarded.AlgorithmRSAOAEP, PublicKeyFile: path},
+		Fields:     []config.ForwardingField{{Path: "email", Header: "X-Email", Filters: []string{"encrypt"}}},
+	}
+	if _, err := NewForwarder(cfg, nil); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("NewForwarder() error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
+
+func TestNewForwarder_InvalidExpression(t *testing.T) {
+	cfg := &config.ForwardingConfig{
+		Fields: []config.ForwardingField{{Expr: "email +", Header: "X-Email"}},
+	}
+	if _, err := NewForwarder(cfg, nil); err == nil {
+		t.Error("NewForwarder() should fail on an expression that does not compile")
+	}
+}
+
 func TestForwarder_AddToQueryString_PlainText(t *testing.T) {
 	cfg := &config.ForwardingConfig{
 		Fields: []config.ForwardingField{
@@ -16,7 +56,7 @@ func TestForwarder_AddToQueryString_PlainText(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 	userInfo := &UserInfo{Username: "john", Email: "john@example.com"}
 
 	result, err := forwarder.AddToQueryString("http://example.com/path", userInfo)
@@ -41,7 +81,7 @@ func TestForwarder_AddToHeaders_PlainText(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 	userInfo := &UserInfo{Username: "john", Email: "john@example.com"}
 
 	headers := make(http.Header)
@@ -65,7 +105,7 @@ func TestForwarder_AddToQueryString_WithEncrypt(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 	userInfo := &UserInfo{Email: "john@example.com"}
 
 	result, err := forwarder.AddToQueryString("http://example.com/path", userInfo)
@@ -135,7 +175,7 @@ func TestForwarder_PathResolution(t *testing.T) {
 	}
 
 	cfg := &config.ForwardingConfig{Fields: []config.ForwardingField{}}
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -158,7 +198,7 @@ func TestForwarder_EntireObject(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 	userInfo := &UserInfo{
 		Username: "john",
 		Email:    "john@example.com",
@@ -193,7 +233,7 @@ func TestForwarder_NonExistentPathsNotAdded(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 	userInfo := &UserInfo{
 		Username: "john",
 		Email:    "john@example.com",
@@ -236,6 +276,143 @@ func TestForwarder_NonExistentPathsNotAdded(t *testing.T) {
 	}
 }
 
+func TestForwarder_Expressions(t *testing.T) {
+	cfg := &config.ForwardingConfig{
+		Fields: []config.ForwardingField{
+			{Expr: `email.split("@")[0]`, Header: "X-User-Id", Query: "uid"},
+			{Expr: `"admins" in groups ? "admin" : "member"`, Header: "X-User-Level"},
+			{Expr: `has(extra.locale) ? extra.locale : ""`, Header: "X-User-Locale"}, // Empty: falls back
+			{Path: "extra.lang", Header: "X-User-Locale"},
+			{Expr: `extra.missing`, Header: "X-Missing"}, // Evaluation error: skipped
+		},
+	}
+
+	forwarder := newTestForwarder(t, cfg)
+	userInfo := &UserInfo{
+		Email: "john@example.com",
+		Extra: map[string]interface{}{"groups": "staff,admins", "lang": "ja"},
+	}
+
+	headers := forwarder.AddToHeaders(make(http.Header), userInfo)
+	want := map[string]string{"X-User-Id": "john", "X-User-Level": "admin", "X-User-Locale": "ja", "X-Missing": ""}
+	for name, value := range want {
+		if got := headers.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	result, err := forwarder.AddToQueryString("http://example.com/", userInfo)
+	if err != nil {
+		t.Fatalf("AddToQueryString() error = %v", err)
+	}
+	if u, _ := url.Parse(result); u.Query().Get("uid") != "john" {
+		t.Errorf("uid = %q, want john", u.Query().Get("uid"))
+	}
+}
+
+func TestForwarder_FieldAlgorithm(t *testing.T) {
+	const key = "this-is-a-32-character-encryption-key-12345"
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: key, Algorithm: "aes-128-gcm"},
+		Fields: []config.ForwardingField{
+			{Path: "email", Header: "X-Email", Filters: config.FilterList{"encrypt"}},
+			{Path: "username", Header: "X-User", Filters: config.FilterList{"encrypt"}, Algorithm: "chacha20-poly1305"},
+		},
+	}
+
+	headers := newTestForwarder(t, cfg).AddToHeaders(make(http.Header), &UserInfo{Email: "john@example.com", Username: "john"})
+	decryptor := forwarded.NewDecryptor(key)
+	tests := []struct {
+		header   string
+		envelope string
+		want     string
+	}{
+		{"X-Email", forwarded.EnvelopeV1AES128GCM, "john@example.com"},
+		{"X-User", forwarded.EnvelopeV1ChaCha20Poly1305, "john"},
+	}
+	for _, tt := range tests {
+		value := headers.Get(tt.header)
+		if !strings.HasPrefix(value, tt.envelope+":") {
+			t.Errorf("%s = %q, want a %s envelope", tt.header, value, tt.envelope)
+		}
+		if got, err := decryptor.Decrypt(value); err != nil || got != tt.want {
+			t.Errorf("%s decrypted = %q, %v, want %q", tt.header, got, err, tt.want)
+		}
+	}
+}
+
+func TestForwarder_PublicKeyEncryption(t *testing.T) {
+	// Only the public key: the gate holds no secret of these fields
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{
+			Algorithm:     "rsa-oaep",
+			PublicKeyFile: "../../forwarded/testdata/rsa-public.pem",
+		},
+		Fields: []config.ForwardingField{
+			{Path: "email", Header: "X-Email", Query: "email", Filters: config.FilterList{"encrypt"}},
+		},
+	}
+	forwarder := newTestForwarder(t, cfg)
+	userInfo := &UserInfo{Email: "john@example.com"}
+
+	privateKeyPEM, err := os.ReadFile("../../forwarded/testdata/rsa-private.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	decryptor, err := forwarded.NewPrivateKeyDecryptor(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("NewPrivateKeyDecryptor() error = %v", err)
+	}
+
+	headers := forwarder.AddToHeaders(make(http.Header), userInfo)
+	if got, err := decryptor.Decrypt(headers.Get("X-Email")); err != nil || got != "john@example.com" {
+		t.Errorf("X-Email decrypted = %q, %v, want john@example.com", got, err)
+	}
+	result, err := forwarder.AddToQueryString("http://example.com/", userInfo)
+	if err != nil {
+		t.Fatalf("AddToQueryString() error = %v", err)
+	}
+	u, _ := url.Parse(result)
+	if got, err := decryptor.Decrypt(u.Query().Get("email")); err != nil || got != "john@example.com" {
+		t.Errorf("email decrypted = %q, %v, want john@example.com", got, err)
+	}
+
+	// A missing public key file fails instead of leaving the fields out
+	cfg.Encryption.PublicKeyFile = "testdata/missing.pem"
+	if _, err := NewForwarder(cfg, nil); err == nil {
+		t.Error("NewForwarder() should fail without the public key file")
+	}
+}
+
+func TestForwarder_Stamp(t *testing.T) {
+	const key = "this-is-a-32-character-encryption-key-12345"
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: key},
+		Fields: []config.ForwardingField{
+			{Path: "email", Query: "email", Filters: config.FilterList{"encrypt"}, Stamp: true},
+			{Path: "email", Header: "X-Email", Filters: config.FilterList{"encrypt"}},
+		},
+	}
+	forwarder := newTestForwarder(t, cfg)
+	userInfo := &UserInfo{Email: "john@example.com"}
+	decryptor := forwarded.NewDecryptor(key)
+
+	result, err := forwarder.AddToQueryString("http://example.com/", userInfo)
+	if err != nil {
+		t.Fatalf("AddToQueryString() error = %v", err)
+	}
+	u, _ := url.Parse(result)
+	if got, err := decryptor.DecryptVerified(u.Query().Get("email"), forwarded.NewVerifier(0)); err != nil || got != "john@example.com" {
+		t.Errorf("email verified = %q, %v, want john@example.com", got, err)
+	}
+
+	// Fields without stamp are unchanged
+	header := forwarder.AddToHeaders(make(http.Header), userInfo).Get("X-Email")
+	if !strings.HasPrefix(header, forwarded.EnvelopeV1+":") {
+		t.Errorf("X-Email = %q, want an unstamped v1 envelope", header)
+	}
+}
+
 func TestForwarder_MultiplePathsSameDestination(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -297,7 +474,7 @@ func TestForwarder_MultiplePathsSameDestination(t *testing.T) {
 				Fields: tt.fields,
 			}
 
-			forwarder := NewForwarder(cfg, nil)
+			forwarder := newTestForwarder(t, cfg)
 
 			// Test query string
 			if len(tt.expectQuery) > 0 || len(tt.notPresentQuery) > 0 {
@@ -341,3 +518,105 @@ func TestForwarder_MultiplePathsSameDestination(t *testing.T) {
 		})
 	}
 }
+
+func TestForwarder_AddToBody_BackendProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.ForwardingConfig
+		path     string
+		body     string
+		userInfo *UserInfo
+		want     string
+	}{
+		{
+			name:     "openai sets user",
+			cfg:      &config.ForwardingConfig{Backend: config.BackendOpenAI},
+			path:     "/v1/chat/completions",
+			body:     `{"model":"gpt-4o","user":"spoofed"}`,
+			userInfo: &UserInfo{Email: "john@example.com"},
+			want:     `{"model":"gpt-4o","user":"john@example.com"}`,
+		},
+		{
+			name:     "openai outside body path is untouched",
+			cfg:      &config.ForwardingConfig{Backend: config.BackendOpenAI},
+			path:     "/api/settings",
+			body:     `{"user":"spoofed"}`,
+			userInfo: &UserInfo{Email: "john@example.com"},
+			want:     `{"user":"spoofed"}`,
+		},
+		{
+			name:     "flowise sets overrideConfig vars",
+			cfg:      &config.ForwardingConfig{Backend: config.BackendFlowise},
+			path:     "/api/v1/prediction/abc-123",
+			body:     `{"question":"hi"}`,
+			userInfo: &UserInfo{Email: "john@example.com"},
+			want:     `{"question":"hi","overrideConfig":{"vars":{"user":"john@example.com"}}}`,
+		},
+		{
+			name: "explicit field overrides profile",
+			cfg: &config.ForwardingConfig{
+				Backend: config.BackendOpenAI,
+				Fields:  []config.ForwardingField{{Path: "username", Body: "user"}},
+			},
+			path:     "/v1/chat/completions",
+			body:     `{}`,
+			userInfo: &UserInfo{Username: "john", Email: "john@example.com"},
+			want:     `{"user":"john"}`,
+		},
+		{
+			name: "custom body path",
+			cfg: &config.ForwardingConfig{
+				BodyPath: "/chat",
+				Fields:   []config.ForwardingField{{Path: "email", Body: "metadata.email"}},
+			},
+			path:     "/chat",
+			body:     `{}`,
+			userInfo: &UserInfo{Email: "john@example.com"},
+			want:     `{"metadata":{"email":"john@example.com"}}`,
+		},
+		{
+			name: "client value is deleted without a session value",
+			cfg: &config.ForwardingConfig{
+				BodyPath: "/chat",
+				Fields:   []config.ForwardingField{{Path: "extra.tenant", Body: "metadata.tenant"}},
+			},
+			path:     "/chat",
+			body:     `{"query":"hi","metadata":{"tenant":"spoofed","lang":"en"}}`,
+			userInfo: &UserInfo{Email: "john@example.com"},
+			want:     `{"query":"hi","metadata":{"lang":"en"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarder := newTestForwarder(t, tt.cfg)
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			if err := forwarder.AddToBody(req, tt.userInfo); err != nil {
+				t.Fatalf("AddToBody() error = %v", err)
+			}
+
+			body, _ := io.ReadAll(req.Body)
+			assertJSONEqual(t, string(body), tt.want)
+		})
+	}
+}
+
+func TestForwarder_AddToHeaders_LibreChat(t *testing.T) {
+	forwarder := newTestForwarder(t, &config.ForwardingConfig{Backend: config.BackendLibreChat})
+
+	// Email auth has no username, so X-Forwarded-User falls back to the email address
+	headers := forwarder.AddToHeaders(make(http.Header), &UserInfo{Email: "john@example.com"})
+	if got := headers.Get("X-Forwarded-Email"); got != "john@example.com" {
+		t.Errorf("X-Forwarded-Email = %v, want %v", got, "john@example.com")
+	}
+	if got := headers.Get("X-Forwarded-User"); got != "john@example.com" {
+		t.Errorf("X-Forwarded-User = %v, want %v", got, "john@example.com")
+	}
+
+	headers = forwarder.AddToHeaders(make(http.Header), &UserInfo{Username: "john", Email: "john@example.com"})
+	if got := headers.Get("X-Forwarded-User"); got != "john" {
+		t.Errorf("X-Forwarded-User = %v, want %v", got, "john")
+	}
+}
@@ -0,0 +1,190 @@
+// Package forwardingtest provides an upstream that echoes the user info ChatbotGate forwards,
+// decrypting encrypted values, for integration tests and for debugging forwarding setups.
+//
+//	decoder, _ := forwardingtest.NewDecoder(key, nil)
+//	upstream := httptest.NewServer(forwardingtest.NewEchoHandler(decoder, nil, os.Stderr))
+//
+// The echo handler responds with a JSON Report of the identity headers and query parameters
+// of each request; `chatbotgate debug echo-server` serves it from the command line.
+package forwardingtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/forwarded"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+)
+
+// EnvelopeLegacy is the Envelope of values encoded with legacy_encoding (double base64, no envelope)
+const EnvelopeLegacy = "legacy"
+
+// Value is a received value and what it decrypts to
+type Value struct {
+	Raw       string     `json:"raw"`                  // Value as received
+	Value     string     `json:"value"`                // Decrypted value, or the raw value if not encrypted
+	Encrypted bool       `json:"encrypted"`            // Whether the value was decrypted
+	Envelope  string     `json:"envelope,omitempty"`   // Envelope identifier of encrypted values (e.g., "v1+stamp")
+	StampedAt *time.Time `json:"stamped_at,omitempty"` // Stamp time of stamped values
+	Error     string     `json:"error,omitempty"`      // Why a value with a known envelope did not decrypt
+}
+
+// Decoder decrypts received values with the keys of the gate's forwarding.encryption
+type Decoder struct {
+	decryptor *forwarded.Decryptor  // nil without keys
+	legacy    *forwarding.Encryptor // Legacy encoding fallback (nil without a shared key)
+}
+
+// NewDecoder creates a Decoder for the shared key and/or the upstream's PEM private key (rsa-oaep)
+// Without either, values are reported as received.
+func NewDecoder(key string, privateKeyPEM []byte) (*Decoder, error) {
+	d := &Decoder{}
+	if key != "" {
+		d.decryptor = forwarded.NewDecryptor(key)
+		d.legacy = forwarding.NewEncryptor(key)
+	}
+	if len(privateKeyPEM) > 0 {
+		if d.decryptor == nil {
+			decryptor, err := forwarded.NewPrivateKeyDecryptor(privateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			d.decryptor = decryptor
+		} else if err := d.decryptor.SetPrivateKey(privateKeyPEM); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Decode decrypts a received value
+// Values that are not encrypted (or not for these keys) are returned as plain text; values with
+// a known envelope that fail to decrypt also report the error, which points to a key mismatch.
+func (d *Decoder) Decode(raw string) Value {
+	v := Value{Raw: raw, Value: raw}
+	if d.decryptor == nil || raw == "" {
+		return v
+	}
+
+	plaintext, stamp, err := d.decryptor.OpenStamped(raw)
+	if err == nil {
+		v.Value, v.Encrypted = string(plaintext), true
+		v.Envelope = forwarded.EnvelopeV1
+		if id, _, found := strings.Cut(raw, ":"); found {
+			v.Envelope = id
+		}
+		if stamp != nil {
+			stampedAt := stamp.Time
+			v.StampedAt = &stampedAt
+		}
+		return v
+	}
+
+	// Legacy encoding base64-encodes twice
+	if d.legacy != nil {
+		if outer, decodeErr := base64.StdEncoding.DecodeString(raw); decodeErr == nil {
+			if decrypted, decryptErr := d.legacy.Decrypt(string(outer)); decryptErr == nil {
+				v.Value, v.Encrypted, v.Envelope = decrypted, true, EnvelopeLegacy
+				return v
+			}
+		}
+	}
+
+	if strings.Contains(raw, ":") && !errors.Is(err, forwarded.ErrUnsupportedEnvelope) {
+		v.Error = err.Error()
+	}
+	return v
+}
+
+// Report is the echo of a request: its identity headers and query parameters, decoded
+type Report struct {
+	Method  string           `json:"method"`
+	Path    string           `json:"path"`
+	Headers map[string]Value `json:"headers"` // Canonical header names
+	Query   map[string]Value `json:"query"`
+}
+
+// Inspect decodes the headers and query parameters of a request
+// Only the named headers are reported; without names, all "X-" headers are.
+func (d *Decoder) Inspect(r *http.Request, headers []string) *Report {
+	report := &Report{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: make(map[string]Value),
+		Query:   make(map[string]Value),
+	}
+
+	if len(headers) == 0 {
+		for name := range r.Header {
+			if strings.HasPrefix(name, "X-") {
+				headers = append(headers, name)
+			}
+		}
+	}
+	for _, name := range headers {
+		name = http.CanonicalHeaderKey(name)
+		if value := r.Header.Get(name); value != "" {
+			report.Headers[name] = d.Decode(value)
+		}
+	}
+
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			report.Query[name] = d.Decode(values[0])
+		}
+	}
+	return report
+}
+
+// NewEchoHandler returns a handler responding to every request with its Report as JSON
+// Reports are also written to log in a readable form, if log is not nil.
+func NewEchoHandler(decoder *Decoder, headers []string, log io.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := decoder.Inspect(r, headers)
+		if log != nil {
+			writeReport(log, report)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	})
+}
+
+// writeReport writes a report as one line per request and one line per value
+func writeReport(w io.Writer, report *Report) {
+	_, _ = fmt.Fprintf(w, "%s %s\n", report.Method, report.Path)
+	writeValues(w, "header", report.Headers)
+	writeValues(w, "query", report.Query)
+}
+
+// writeValues writes values in name order
+func writeValues(w io.Writer, kind string, values map[string]Value) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := values[name]
+		switch {
+		case v.Encrypted && v.StampedAt != nil:
+			_, _ = fmt.Fprintf(w, "  %s %s = %q (%s, stamped %s)\n", kind, name, v.Value, v.Envelope, v.StampedAt.UTC().Format(time.RFC3339))
+		case v.Encrypted:
+			_, _ = fmt.Fprintf(w, "  %s %s = %q (%s)\n", kind, name, v.Value, v.Envelope)
+		case v.Error != "":
+			_, _ = fmt.Fprintf(w, "  %s %s = %q (not decrypted: %s)\n", kind, name, v.Raw, v.Error)
+		default:
+			_, _ = fmt.Fprintf(w, "  %s %s = %q\n", kind, name, v.Value)
+		}
+	}
+}
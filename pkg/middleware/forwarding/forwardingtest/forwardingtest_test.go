@@ -0,0 +1,155 @@
+package forwardingtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/middleware/forwarding"
+)
+
+const testKey = "this-is-a-32-character-encryption-key-12345"
+
+// forwardedRequest returns a request to upstream carrying what the forwarder adds for the user
+func forwardedRequest(t *testing.T, cfg *config.ForwardingConfig, upstream string) *http.Request {
+	t.Helper()
+	forwarder, err := forwarding.NewForwarder(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewForwarder() error = %v", err)
+	}
+	userInfo := &forwarding.UserInfo{Username: "Alice", Email: "alice@example.com", Provider: "google"}
+
+	target, err := forwarder.AddToQueryString(upstream+"/chat", userInfo)
+	if err != nil {
+		t.Fatalf("AddToQueryString() error = %v", err)
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header = forwarder.AddToHeaders(req.Header, userInfo)
+	return req
+}
+
+func TestEchoHandler_RoundTrip(t *testing.T) {
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: testKey},
+		Fields: []config.ForwardingField{
+			{Path: "email", Header: "X-Auth-Email", Filters: config.FilterList{"encrypt"}},
+			{Path: "username", Header: "X-Auth-User", Filters: config.FilterList{"zip", "encrypt"}, Algorithm: "chacha20-poly1305"},
+			{Path: "provider", Header: "X-Auth-Provider"},
+			{Path: "email", Query: "email", Filters: config.FilterList{"encrypt"}, Stamp: true},
+		},
+	}
+
+	decoder, err := NewDecoder(testKey, nil)
+	if err != nil {
+		t.Fatalf("NewDecoder() error = %v", err)
+	}
+	var log bytes.Buffer
+	upstream := httptest.NewServer(NewEchoHandler(decoder, nil, &log))
+	defer upstream.Close()
+
+	resp, err := http.DefaultClient.Do(forwardedRequest(t, cfg, upstream.URL))
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var report Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		got       Value
+		want      string
+		envelope  string
+		encrypted bool
+	}{
+		{"X-Auth-Email", report.Headers["X-Auth-Email"], "alice@example.com", "v1", true},
+		{"X-Auth-User", report.Headers["X-Auth-User"], "Alice", "v1.chacha20-poly1305", true},
+		{"X-Auth-Provider", report.Headers["X-Auth-Provider"], "google", "", false},
+		{"query email", report.Query["email"], "alice@example.com", "v1+stamp", true},
+	}
+	for _, tt := range tests {
+		if tt.got.Value != tt.want || tt.got.Envelope != tt.envelope || tt.got.Encrypted != tt.encrypted {
+			t.Errorf("%s = %+v, want %q (%q, encrypted %v)", tt.name, tt.got, tt.want, tt.envelope, tt.encrypted)
+		}
+	}
+	if report.Query["email"].StampedAt == nil {
+		t.Error("Stamped query value should report its stamp time")
+	}
+	if report.Method != "GET" || report.Path != "/chat" {
+		t.Errorf("Request = %s %s, want GET /chat", report.Method, report.Path)
+	}
+
+	for _, line := range []string{"GET /chat", `header X-Auth-Email = "alice@example.com" (v1)`, `header X-Auth-Provider = "google"`} {
+		if !strings.Contains(log.String(), line) {
+			t.Errorf("Log = %q, want a line with %q", log.String(), line)
+		}
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	legacyCfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: testKey, LegacyEncoding: true},
+		Fields:     []config.ForwardingField{{Path: "email", Header: "X-Email", Filters: config.FilterList{"encrypt"}}},
+	}
+	legacy := forwardedRequest(t, legacyCfg, "http://upstream").Header.Get("X-Email")
+
+	plainCfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Key: testKey},
+		Fields:     []config.ForwardingField{{Path: "email", Header: "X-Email", Filters: config.FilterList{"encrypt"}}},
+	}
+	encrypted := forwardedRequest(t, plainCfg, "http://upstream").Header.Get("X-Email")
+
+	decoder, _ := NewDecoder(testKey, nil)
+	if v := decoder.Decode(legacy); v.Value != "alice@example.com" || v.Envelope != EnvelopeLegacy {
+		t.Errorf("Decode(legacy) = %+v, want alice@example.com (legacy)", v)
+	}
+	if v := decoder.Decode("https://example.com/a"); v.Encrypted || v.Error != "" || v.Value != "https://example.com/a" {
+		t.Errorf("Decode(URL) = %+v, want plain text", v)
+	}
+
+	// A wrong key reports why a value with a known envelope stays encrypted
+	wrongKey, _ := NewDecoder("another-key-with-at-least-32-characters", nil)
+	if v := wrongKey.Decode(encrypted); v.Encrypted || v.Error == "" {
+		t.Errorf("Decode() with a wrong key = %+v, want an error", v)
+	}
+
+	// Without keys, values are reported as received
+	noKeys, _ := NewDecoder("", nil)
+	if v := noKeys.Decode(encrypted); v.Encrypted || v.Value != encrypted {
+		t.Errorf("Decode() without keys = %+v, want the raw value", v)
+	}
+}
+
+func TestDecoder_PrivateKey(t *testing.T) {
+	cfg := &config.ForwardingConfig{
+		Encryption: &config.EncryptionConfig{Algorithm: "rsa-oaep", PublicKeyFile: "../../../forwarded/testdata/rsa-public.pem"},
+		Fields:     []config.ForwardingField{{Path: "email", Header: "X-Email", Filters: config.FilterList{"encrypt"}}},
+	}
+	value := forwardedRequest(t, cfg, "http://upstream").Header.Get("X-Email")
+
+	privateKeyPEM, err := os.ReadFile("../../../forwarded/testdata/rsa-private.pem")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	decoder, err := NewDecoder("", privateKeyPEM)
+	if err != nil {
+		t.Fatalf("NewDecoder() error = %v", err)
+	}
+	if v := decoder.Decode(value); v.Value != "alice@example.com" || v.Envelope != "v1.rsa-oaep" {
+		t.Errorf("Decode() = %+v, want alice@example.com (v1.rsa-oaep)", v)
+	}
+
+	if _, err := NewDecoder(testKey, []byte("not a key")); err == nil {
+		t.Error("NewDecoder() with an invalid private key should fail")
+	}
+}
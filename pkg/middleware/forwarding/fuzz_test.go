@@ -0,0 +1,88 @@
+package forwarding
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzGetValueByPath(f *testing.F) {
+	seeds := [][2]string{
+		{`{"email":"user@example.com"}`, "email"},
+		{`{"secrets":{"access_token":"t"}}`, "secrets.access_token"},
+		{`{"":{"":"x"}}`, "."},
+		{`{"a":{"":{"b":"x"}}}`, "a..b"},
+		{`{"a":"x"}`, ".a"},
+		{`{"a":"x"}`, "a."},
+		{`{"%2e%2e":"x"}`, "%2e%2e"},
+		{`{"a":[1,2]}`, "a.0"},
+		{`{"a":{"b":{"c":{"d":{"e":"deep"}}}}}`, strings.Repeat("a.", 64) + "a"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, data, path string) {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &obj); err != nil {
+			return
+		}
+		value := GetValueByPath(obj, path)
+		if value != "" && strings.Contains("."+path+".", "..") {
+			t.Fatalf("GetValueByPath(%s, %q) = %q for a path with an empty key", data, path, value)
+		}
+	})
+}
+
+func FuzzSetJSONBodyFields(f *testing.F) {
+	seeds := [][3]string{
+		{`{"query":"hi"}`, "user", "user@example.com"},
+		{`{"overrideConfig":{"vars":{"keep":1}}}`, "overrideConfig.vars.user", "u"},
+		{``, "a.b.c", "v"},
+		{`{"a":"scalar"}`, "a.b", "v"},
+		{`{"a":null}`, "a.b", "v"},
+		{`[1]`, "user", "v"},
+		{`{}`, "a..b", "v"},
+		{`{}`, ".a", "v"},
+		{`{}`, "a.", "v"},
+		{`{}`, "%2e%2e.user", "v"},
+		{`{"big":1e400}`, "user", "v"},
+		{`{}`, strings.Repeat("a.", 128) + "a", "deep"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1], seed[2])
+	}
+
+	f.Fuzz(func(t *testing.T, body, path, value string) {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		err := SetJSONBodyFields(r, map[string]string{path: value})
+		if strings.Contains("."+path+".", "..") {
+			if err == nil {
+				t.Fatalf("SetJSONBodyFields(%q) succeeded for a path with an empty key", path)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r.Body)
+		// Numbers are kept as sent (e.g., 1e400), so they are not decoded as float64
+		decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		decoder.UseNumber()
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			t.Fatalf("SetJSONBodyFields(%q, %q) made an invalid JSON body %q: %v", body, path, buf.String(), err)
+		}
+		if got := GetValueByPath(obj, path); utf8.ValidString(path+value) && got != value {
+			t.Fatalf("SetJSONBodyFields(%q, %q, %q) set %q", body, path, value, got)
+		}
+		if r.ContentLength != int64(buf.Len()) {
+			t.Fatalf("Content-Length = %d, want %d", r.ContentLength, buf.Len())
+		}
+	})
+}
@@ -134,7 +134,7 @@ func TestOAuth2GoogleIntegration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, nil)
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string
 			if tt.testQuery {
@@ -268,7 +268,7 @@ func TestOAuth2GitHubIntegration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, nil)
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string
 			if tt.testQuery {
@@ -406,7 +406,7 @@ func TestOAuth2MicrosoftIntegration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, nil)
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string
 			if tt.testQuery {
@@ -523,7 +523,7 @@ func TestOAuth2WithEncryption(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, nil)
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string
 			if tt.testQuery {
@@ -697,7 +697,7 @@ func TestNonExistentPaths(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			forwarder := NewForwarder(tt.config, nil)
+			forwarder := newTestForwarder(t, tt.config)
 
 			// Test query string
 			if tt.testQuery {
@@ -817,7 +817,7 @@ func TestNonExistentPathsAllProviders(t *testing.T) {
 
 	for _, provider := range providers {
 		t.Run(provider.name, func(t *testing.T) {
-			forwarder := NewForwarder(cfg, nil)
+			forwarder := newTestForwarder(t, cfg)
 
 			// Test query string
 			resultURL, err := forwarder.AddToQueryString("http://example.com/path", provider.userInfo)
@@ -913,7 +913,7 @@ func TestExtremelyDeepPaths(t *testing.T) {
 				},
 			}
 
-			forwarder := NewForwarder(cfg, nil)
+			forwarder := newTestForwarder(t, cfg)
 
 			// Test query
 			resultURL, err := forwarder.AddToQueryString("http://example.com/path", userInfo)
@@ -1123,7 +1123,7 @@ func TestMultiplePathsSameDestination(t *testing.T) {
 				Fields: tt.fields,
 			}
 
-			forwarder := NewForwarder(cfg, nil)
+			forwarder := newTestForwarder(t, cfg)
 
 			// Test query string
 			resultURL, err := forwarder.AddToQueryString("http://example.com/path", tt.userInfo)
@@ -1212,7 +1212,7 @@ func TestGitHubWithLoginFallback(t *testing.T) {
 		},
 	}
 
-	forwarder := NewForwarder(cfg, nil)
+	forwarder := newTestForwarder(t, cfg)
 
 	// Test query
 	resultURL, err := forwarder.AddToQueryString("http://example.com/path", githubUserNoName)
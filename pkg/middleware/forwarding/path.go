@@ -7,7 +7,7 @@ import (
 
 // GetValueByPath retrieves a value from a nested map using a dot-separated path
 // For example, "secrets.access_token" will retrieve data["secrets"]["access_token"]
-// Returns the value as a string if found, empty string otherwise
+// Returns the value as a string if found, empty string otherwise (also for paths with an empty key like "a..b")
 func GetValueByPath(data map[string]interface{}, path string) string {
 	if path == "" {
 		return ""
@@ -18,6 +18,9 @@ func GetValueByPath(data map[string]interface{}, path string) string {
 
 	// Navigate through the nested structure
 	for i, part := range parts {
+		if part == "" {
+			return ""
+		}
 		value, exists := current[part]
 		if !exists {
 			return ""
@@ -0,0 +1,426 @@
+package idp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// OAuth 2.0 error codes (RFC 6749 sections 4.1.2.1 and 5.2, OpenID Connect Core 1.0 section 3.1.2.6)
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorInvalidToken            = "invalid_token"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorAccessDenied            = "access_denied"
+	ErrorLoginRequired           = "login_required"
+	ErrorServerError             = "server_error"
+)
+
+// Error is an OAuth 2.0 error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// errorf creates an Error with a formatted description
+func errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// AsError returns err as an Error, wrapping other errors as server_error
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: ErrorServerError}
+}
+
+// User is the signed-in user codes and tokens are issued for
+type User struct {
+	Email         string
+	EmailVerified bool // Whether the sign-in method verified the address ("email_verified")
+	Name          string
+	AuthTime      time.Time // When the user signed in to ChatbotGate ("auth_time")
+}
+
+// AuthorizeRequest is a validated authorization request (OpenID Connect Core 1.0 section 3.1.2.1)
+type AuthorizeRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	State         string
+	Nonce         string
+	CodeChallenge string // PKCE S256 challenge (RFC 7636), empty without PKCE
+	Prompt        string // Space-separated prompt values ("none", "login", ...)
+	MaxAge        int    // Maximum age in seconds of the sign-in, -1 without max_age
+}
+
+// reauthMaxAge bounds the new sign-in of a prompt=login request without max_age (see ReauthenticatedQuery)
+const reauthMaxAge = 10 * 60 // The lifetime of the redirect cookie of the login
+
+// grant is a stored authorization code or access token
+type grant struct {
+	ClientID      string
+	RedirectURI   string `json:",omitempty"`
+	Scope         string
+	Nonce         string `json:",omitempty"`
+	CodeChallenge string `json:",omitempty"`
+	Email         string
+	EmailVerified bool   `json:",omitempty"`
+	Name          string `json:",omitempty"`
+	AuthTime      time.Time
+	ExpiresAt     time.Time `json:",omitempty"` // Expiry of access tokens
+}
+
+// TokenResponse is the response of the token endpoint (OpenID Connect Core 1.0 section 3.1.3.3)
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// ParseAuthorize validates the parameters of an authorization request
+// When the client or the redirect URI is unknown, the request is nil: the error must be shown
+// to the user rather than sent to the redirect URI. Otherwise errors go to req.ErrorURL.
+func (p *Provider) ParseAuthorize(params url.Values) (*AuthorizeRequest, error) {
+	client, ok := p.clients[params.Get("client_id")]
+	if !ok {
+		return nil, errorf(ErrorInvalidClient, "unknown client_id")
+	}
+	redirectURI := params.Get("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, errorf(ErrorInvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	req := &AuthorizeRequest{
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		Scope:         params.Get("scope"),
+		State:         params.Get("state"),
+		Nonce:         params.Get("nonce"),
+		CodeChallenge: params.Get("code_challenge"),
+		Prompt:        params.Get("prompt"),
+		MaxAge:        -1,
+	}
+	if params.Get("response_type") != "code" {
+		return req, errorf(ErrorUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !hasScope(req.Scope, ScopeOpenID) {
+		return req, errorf(ErrorInvalidScope, "the openid scope is required")
+	}
+	if req.CodeChallenge != "" && params.Get("code_challenge_method") != "S256" {
+		return req, errorf(ErrorInvalidRequest, "code_challenge_method must be S256")
+	}
+	if maxAge := params.Get("max_age"); maxAge != "" {
+		n, err := strconv.Atoi(maxAge)
+		if err != nil || n < 0 {
+			return req, errorf(ErrorInvalidRequest, "max_age must be a number of seconds")
+		}
+		req.MaxAge = n
+	}
+	if req.HasPrompt("none") && req.HasPrompt("login") {
+		return req, errorf(ErrorInvalidRequest, "prompt=none cannot be combined with other values")
+	}
+	return req, nil
+}
+
+// HasPrompt reports whether the request has the prompt value (e.g., "login")
+func (r *AuthorizeRequest) HasPrompt(value string) bool {
+	return slices.Contains(strings.Fields(r.Prompt), value)
+}
+
+// RequiresLogin reports whether the user must sign in again: with prompt=login, or when the sign-in at
+// authTime is older than max_age (OpenID Connect Core 1.0 section 3.1.2.1)
+func (r *AuthorizeRequest) RequiresLogin(authTime, now time.Time) bool {
+	if r.HasPrompt("login") {
+		return true
+	}
+	return r.MaxAge >= 0 && now.Sub(authTime) > time.Duration(r.MaxAge)*time.Second
+}
+
+// ReauthenticatedQuery returns the query of an authorization request to come back to after signing in
+// again: prompt=login is dropped, so that the new sign-in satisfies it, and max_age bounds the new
+// sign-in instead (10 minutes without max_age)
+func ReauthenticatedQuery(params url.Values) url.Values {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = slices.Clone(values)
+	}
+	var prompt []string
+	for _, value := range strings.Fields(params.Get("prompt")) {
+		if value != "login" {
+			prompt = append(prompt, value)
+		}
+	}
+	if len(prompt) > 0 {
+		query.Set("prompt", strings.Join(prompt, " "))
+	} else {
+		query.Del("prompt")
+	}
+	if query.Get("max_age") == "" {
+		query.Set("max_age", strconv.Itoa(reauthMaxAge))
+	}
+	return query
+}
+
+// RedirectURL returns the redirect URI with the authorization code
+func (r *AuthorizeRequest) RedirectURL(code string) string {
+	return r.redirectWith(url.Values{"code": {code}})
+}
+
+// ErrorURL returns the redirect URI with an error response
+func (r *AuthorizeRequest) ErrorURL(err error) string {
+	e := AsError(err)
+	params := url.Values{"error": {e.Code}}
+	if e.Description != "" {
+		params.Set("error_description", e.Description)
+	}
+	return r.redirectWith(params)
+}
+
+func (r *AuthorizeRequest) redirectWith(params url.Values) string {
+	if r.State != "" {
+		params.Set("state", r.State)
+	}
+	u, _ := url.Parse(r.RedirectURI) // Validated against the registered URIs
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// IssueCode issues an authorization code of the request for the user
+func (p *Provider) IssueCode(ctx context.Context, req *AuthorizeRequest, user User) (string, error) {
+	code, err := randomValue()
+	if err != nil {
+		return "", err
+	}
+	g := grant{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		AuthTime:      user.AuthTime,
+	}
+	if err := p.storeGrant(ctx, storeKey("code", code), g, codeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange redeems an authorization code at the token endpoint (OpenID Connect Core 1.0 section 3.1.3)
+// The client authenticates with HTTP Basic (clientID, clientSecret) or with the form's client_id and client_secret.
+func (p *Provider) Exchange(ctx context.Context, form url.Values, clientID, clientSecret string) (*TokenResponse, error) {
+	if clientID == "" {
+		clientID, clientSecret = form.Get("client_id"), form.Get("client_secret")
+	}
+	client, ok := p.clients[clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) != 1 {
+		return nil, errorf(ErrorInvalidClient, "client authentication failed")
+	}
+	if form.Get("grant_type") != "authorization_code" {
+		return nil, errorf(ErrorUnsupportedGrantType, "only the authorization_code grant type is supported")
+	}
+
+	// Codes are single use: taken by the first redemption and deleted before they are checked
+	key := storeKey("code", form.Get("code"))
+	g, err := p.loadGrant(ctx, key)
+	if err != nil {
+		return nil, err
+	} else if g == nil {
+		return nil, errorf(ErrorInvalidGrant, "unknown or expired code")
+	}
+	if taken, err := p.takeCode(ctx, key); err != nil {
+		return nil, err
+	} else if !taken {
+		return nil, errorf(ErrorInvalidGrant, "code was already redeemed")
+	}
+	if err := p.store.Delete(ctx, key); err != nil {
+		return nil, err
+	}
+	if g.ClientID != client.ClientID || g.RedirectURI != form.Get("redirect_uri") {
+		return nil, errorf(ErrorInvalidGrant, "code was issued to another client or redirect_uri")
+	}
+	if g.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != g.CodeChallenge {
+			return nil, errorf(ErrorInvalidGrant, "code_verifier does not match the code_challenge")
+		}
+	}
+
+	now := p.clock.Now()
+	claims := p.userClaims(g)
+	claims["iss"] = p.issuer
+	claims["aud"] = g.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.tokenTTL).Unix()
+	claims["auth_time"] = g.AuthTime.Unix()
+	if g.Nonce != "" {
+		claims["nonce"] = g.Nonce
+	}
+	idToken, err := p.signer.Sign(claims, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ID token: %w", err)
+	}
+
+	accessToken, err := randomValue()
+	if err != nil {
+		return nil, err
+	}
+	g.RedirectURI, g.Nonce, g.CodeChallenge = "", "", ""
+	g.ExpiresAt = now.Add(p.tokenTTL)
+	if err := p.storeGrant(ctx, storeKey("token", accessToken), *g, p.tokenTTL); err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.tokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       g.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims of the user an access token was issued for (OpenID Connect Core 1.0 section 5.3)
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	g, err := p.loadGrant(ctx, storeKey("token", accessToken))
+	if err != nil {
+		return nil, err
+	} else if g == nil {
+		return nil, errorf(ErrorInvalidToken, "unknown or expired access token")
+	}
+	return p.userClaims(g), nil
+}
+
+// Introspect returns the claims of an active ID token or access token issued by the provider
+// (RFC 7662 section 2.2), adding "client_id", "token_type" and "exp". The claims are nil when the
+// token is unknown, expired or not signed with the key.
+func (p *Provider) Introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	if strings.Count(token, ".") == 2 {
+		claims, err := p.signer.Verify(token)
+		if err != nil {
+			return nil, nil
+		}
+		exp, _ := claims["exp"].(float64)
+		if claims["iss"] != p.issuer || !p.clock.Now().Before(time.Unix(int64(exp), 0)) {
+			return nil, nil
+		}
+		claims["client_id"] = claims["aud"]
+		claims["token_type"] = "id_token"
+		return claims, nil
+	}
+
+	g, err := p.loadGrant(ctx, storeKey("token", token))
+	if err != nil || g == nil {
+		return nil, err
+	}
+	if !g.ExpiresAt.IsZero() && !p.clock.Now().Before(g.ExpiresAt) {
+		return nil, nil
+	}
+	claims := p.userClaims(g)
+	claims["iss"] = p.issuer
+	claims["client_id"] = g.ClientID
+	claims["scope"] = g.Scope
+	claims["token_type"] = "access_token"
+	if !g.ExpiresAt.IsZero() {
+		claims["exp"] = g.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
+
+// userClaims returns the claims about the user selected by the granted scopes
+func (p *Provider) userClaims(g *grant) map[string]interface{} {
+	claims := map[string]interface{}{"sub": Subject(g.Email)}
+	if hasScope(g.Scope, ScopeEmail) {
+		claims["email"] = g.Email
+		claims["email_verified"] = g.EmailVerified
+	}
+	if hasScope(g.Scope, ScopeProfile) && g.Name != "" {
+		claims["name"] = g.Name
+	}
+	return claims
+}
+
+func (p *Provider) storeGrant(ctx context.Context, key string, g grant, ttl time.Duration) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if err := p.store.Set(ctx, key, data, ttl); err != nil {
+		return fmt.Errorf("failed to store grant: %w", err)
+	}
+	return nil
+}
+
+// takeCode reports whether this redemption of the code is the first one
+// The code is taken with a lease, atomic across the instances sharing the KVS. Stores without leases
+// take it under a lock of this process.
+func (p *Provider) takeCode(ctx context.Context, key string) (bool, error) {
+	holder, err := randomValue()
+	if err != nil {
+		return false, err
+	}
+	if leaser, ok := kvs.Uncached(p.store).(kvs.Leaser); ok {
+		taken, err := leaser.AcquireLease(ctx, key+":redeemed", holder, codeTTL)
+		if err != nil {
+			return false, fmt.Errorf("failed to redeem code: %w", err)
+		}
+		return taken, nil
+	}
+
+	p.redeemMu.Lock()
+	defer p.redeemMu.Unlock()
+	exists, err := kvs.Uncached(p.store).Exists(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem code: %w", err)
+	}
+	if exists {
+		err = p.store.Delete(ctx, key)
+	}
+	return exists && err == nil, err
+}
+
+// loadGrant returns a stored grant, or nil when it does not exist or has expired
+func (p *Provider) loadGrant(ctx context.Context, key string) (*grant, error) {
+	data, err := kvs.Uncached(p.store).Get(ctx, key)
+	if errors.Is(err, kvs.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load grant: %w", err)
+	}
+	var g grant
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, nil
+	}
+	return &g, nil
+}
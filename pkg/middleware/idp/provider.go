@@ -0,0 +1,148 @@
+// Package idp implements the OpenID Connect provider mode ("IdP mode").
+// Users signed in to ChatbotGate sign in to registered downstream apps with the authorization
+// code flow: the apps get an ID token signed with the configured key, and an access token for
+// the userinfo endpoint. Authorization codes and access tokens are kept in the session KVS.
+package idp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+// KeyPrefix is the prefix of the authorization codes and access tokens in the session KVS
+const KeyPrefix = "idp:"
+
+// Endpoint paths under the issuer
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	JWKSPath      = "/jwks"
+	AuthorizePath = "/authorize"
+	TokenPath     = "/token"
+	UserInfoPath  = "/userinfo"
+)
+
+// Scopes selecting the claims of ID tokens and userinfo responses
+const (
+	ScopeOpenID  = "openid"  // Required: "sub"
+	ScopeEmail   = "email"   // "email" and "email_verified"
+	ScopeProfile = "profile" // "name"
+)
+
+// codeTTL is how long an authorization code can be exchanged
+const codeTTL = time.Minute
+
+// Provider issues ID tokens for the users signed in to ChatbotGate
+type Provider struct {
+	issuer   string
+	signer   *oauth2.JWTSigner
+	tokenTTL time.Duration
+	clients  map[string]config.IDPClient
+	store    kvs.Store
+	clock    clock.Clock
+	redeemMu sync.Mutex // Takes codes in stores without leases (see takeCode)
+}
+
+// New creates the OpenID Connect provider of the IdP mode
+// keyPEM is the PEM private key signing ID tokens; codes and access tokens are stored in store.
+func New(cfg config.IDPConfig, issuer string, keyPEM []byte, store kvs.Store) (*Provider, error) {
+	signer, err := oauth2.NewJWTSigner(keyPEM, cfg.SigningKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("idp.signing_key: %w", err)
+	}
+	if cfg.SigningKeyID == "" {
+		// Derive a stable key ID, so that relying parties pick the key from the JWKS after rotations
+		if signer, err = oauth2.NewJWTSigner(keyPEM, signer.Thumbprint()); err != nil {
+			return nil, fmt.Errorf("idp.signing_key: %w", err)
+		}
+	}
+
+	clients := make(map[string]config.IDPClient, len(cfg.Clients))
+	for _, client := range cfg.Clients {
+		clients[client.ClientID] = client
+	}
+	return &Provider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		signer:   signer,
+		tokenTTL: cfg.GetTokenTTL(),
+		clients:  clients,
+		store:    store,
+		clock:    clock.Real,
+	}, nil
+}
+
+// SetClock replaces the system clock of token issuance and expiry, e.g. with a clock.Fake in tests
+func (p *Provider) SetClock(c clock.Clock) {
+	p.clock = clock.OrReal(c)
+}
+
+// Issuer returns the issuer URL ("iss" of the ID tokens)
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Discovery returns the OpenID Connect discovery document (OpenID Connect Discovery 1.0 section 3)
+func (p *Provider) Discovery() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + AuthorizePath,
+		"token_endpoint":                        p.issuer + TokenPath,
+		"userinfo_endpoint":                     p.issuer + UserInfoPath,
+		"jwks_uri":                              p.issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{p.signer.Algorithm()},
+		"scopes_supported":                      []string{ScopeOpenID, ScopeEmail, ScopeProfile},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name"},
+	}
+}
+
+// JWKS returns the JSON Web Key Set with the public key verifying ID tokens
+func (p *Provider) JWKS() map[string]interface{} {
+	return map[string]interface{}{"keys": []map[string]string{p.signer.PublicJWK()}}
+}
+
+// Subject returns the "sub" of a user: the hex SHA-256 of the lowercased email address,
+// the same for all clients and sign-in methods of the user
+func Subject(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomValue returns a random URL-safe value for codes and access tokens
+func randomValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// storeKey returns the KVS key of a code or access token; only its hash is stored
+func storeKey(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return KeyPrefix + kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// hasScope reports whether a space-separated scope list contains scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
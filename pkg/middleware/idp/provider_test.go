@@ -0,0 +1,288 @@
+package idp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/auth/oauth2"
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+)
+
+const testRedirectURI = "https://wiki.example.com/callback"
+
+// newTestProvider creates a provider with an ES256 key and the client "wiki"
+func newTestProvider(t *testing.T) (*Provider, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	store, err := kvs.NewMemoryStore("test", kvs.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("NewMemoryStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	cfg := config.IDPConfig{
+		Enabled: true,
+		Clients: []config.IDPClient{{ClientID: "wiki", ClientSecret: "wiki-secret", RedirectURIs: []string{testRedirectURI}}},
+	}
+	p, err := New(cfg, "https://auth.example.com/_auth/idp/", keyPEM, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return p, key
+}
+
+// authorize issues a code for alice through an authorization request with the parameters
+func authorize(t *testing.T, p *Provider, params url.Values) string {
+	t.Helper()
+	req, err := p.ParseAuthorize(params)
+	if err != nil {
+		t.Fatalf("ParseAuthorize() error = %v", err)
+	}
+	code, err := p.IssueCode(context.Background(), req, User{Email: "alice@example.com", EmailVerified: true, Name: "Alice", AuthTime: time.Now()})
+	if err != nil {
+		t.Fatalf("IssueCode() error = %v", err)
+	}
+	return code
+}
+
+func validAuthorizeParams() url.Values {
+	return url.Values{
+		"response_type": {"code"},
+		"client_id":     {"wiki"},
+		"redirect_uri":  {testRedirectURI},
+		"scope":         {"openid email profile"},
+		"state":         {"state-1"},
+		"nonce":         {"nonce-1"},
+	}
+}
+
+func TestProvider_Discovery(t *testing.T) {
+	p, _ := newTestProvider(t)
+
+	doc := p.Discovery()
+	if doc["issuer"] != "https://auth.example.com/_auth/idp" || doc["token_endpoint"] != "https://auth.example.com/_auth/idp/token" {
+		t.Errorf("Discovery() = %v, want endpoints under the issuer", doc)
+	}
+	keys := p.JWKS()["keys"].([]map[string]string)
+	if len(keys) != 1 || keys[0]["kty"] != "EC" || keys[0]["kid"] == "" {
+		t.Errorf("JWKS() = %v, want the EC key with a derived key ID", keys)
+	}
+}
+
+func TestProvider_ParseAuthorize(t *testing.T) {
+	p, _ := newTestProvider(t)
+
+	tests := []struct {
+		name         string
+		modify       func(url.Values)
+		wantCode     string
+		wantRedirect bool
+	}{
+		{"unknown client", func(v url.Values) { v.Set("client_id", "other") }, ErrorInvalidClient, false},
+		{"unregistered redirect uri", func(v url.Values) { v.Set("redirect_uri", "https://evil.example.com/callback") }, ErrorInvalidRequest, false},
+		{"implicit flow", func(v url.Values) { v.Set("response_type", "id_token") }, ErrorUnsupportedResponseType, true},
+		{"no openid scope", func(v url.Values) { v.Set("scope", "email") }, ErrorInvalidScope, true},
+		{"plain PKCE", func(v url.Values) { v.Set("code_challenge", "abc"); v.Set("code_challenge_method", "plain") }, ErrorInvalidRequest, true},
+		{"invalid max_age", func(v url.Values) { v.Set("max_age", "-1") }, ErrorInvalidRequest, true},
+		{"prompt=none with login", func(v url.Values) { v.Set("prompt", "none login") }, ErrorInvalidRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := validAuthorizeParams()
+			tt.modify(params)
+			req, err := p.ParseAuthorize(params)
+			if AsError(err).Code != tt.wantCode {
+				t.Errorf("ParseAuthorize() error = %v, want %s", err, tt.wantCode)
+			}
+			if (req != nil) != tt.wantRedirect {
+				t.Errorf("ParseAuthorize() request = %v, want redirect %v", req, tt.wantRedirect)
+			}
+			if req != nil && !strings.HasPrefix(req.ErrorURL(err), testRedirectURI+"?error="+tt.wantCode) {
+				t.Errorf("ErrorURL() = %q, want the error at the redirect URI", req.ErrorURL(err))
+			}
+		})
+	}
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	p, key := newTestProvider(t)
+	ctx := context.Background()
+	code := authorize(t, p, validAuthorizeParams())
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}}
+
+	if _, err := p.Exchange(ctx, form, "wiki", "wrong"); AsError(err).Code != ErrorInvalidClient {
+		t.Fatalf("Exchange(wrong secret) error = %v, want invalid_client", err)
+	}
+	resp, err := p.Exchange(ctx, form, "wiki", "wiki-secret")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// The ID token is signed with the key and carries the claims of the scopes
+	parts := strings.Split(resp.IDToken, ".")
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if len(signature) != 64 || !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Fatal("ID token signature does not verify")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	_ = json.Unmarshal(payload, &claims)
+	if claims["iss"] != p.Issuer() || claims["aud"] != "wiki" || claims["sub"] != Subject("alice@example.com") ||
+		claims["nonce"] != "nonce-1" || claims["email"] != "alice@example.com" || claims["name"] != "Alice" {
+		t.Errorf("ID token claims = %v", claims)
+	}
+
+	// The access token reads the userinfo; the code cannot be used twice
+	info, err := p.UserInfo(ctx, resp.AccessToken)
+	if err != nil || info["email"] != "alice@example.com" || info["email_verified"] != true {
+		t.Errorf("UserInfo() = %v, %v, want alice's claims", info, err)
+	}
+	if _, err := p.Exchange(ctx, form, "wiki", "wiki-secret"); AsError(err).Code != ErrorInvalidGrant {
+		t.Errorf("Exchange(used code) error = %v, want invalid_grant", err)
+	}
+	if _, err := p.UserInfo(ctx, "unknown"); AsError(err).Code != ErrorInvalidToken {
+		t.Errorf("UserInfo(unknown) error = %v, want invalid_token", err)
+	}
+}
+
+func TestProvider_ExchangeConcurrent(t *testing.T) {
+	p, _ := newTestProvider(t)
+	code := authorize(t, p, validAuthorizeParams())
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {testRedirectURI}}
+
+	// Redemptions racing for the same code: only one gets tokens
+	const redemptions = 10
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < redemptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Exchange(context.Background(), form, "wiki", "wiki-secret"); err == nil {
+				succeeded.Add(1)
+			} else if AsError(err).Code != ErrorInvalidGrant {
+				t.Errorf("Exchange() error = %v, want invalid_grant", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := succeeded.Load(); got != 1 {
+		t.Errorf("%d of %d redemptions succeeded, want 1", got, redemptions)
+	}
+}
+
+func TestAuthorizeRequest_RequiresLogin(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		req      AuthorizeRequest
+		authTime time.Time
+		want     bool
+	}{
+		{"no requirement", AuthorizeRequest{MaxAge: -1}, now.Add(-24 * time.Hour), false},
+		{"prompt=login", AuthorizeRequest{Prompt: "consent login", MaxAge: -1}, now, true},
+		{"recent sign-in", AuthorizeRequest{MaxAge: 300}, now.Add(-time.Minute), false},
+		{"old sign-in", AuthorizeRequest{MaxAge: 300}, now.Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.RequiresLogin(tt.authTime, now); got != tt.want {
+				t.Errorf("RequiresLogin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_ExchangePKCE(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	params := validAuthorizeParams()
+	params.Set("scope", "openid")
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	params.Set("code_challenge_method", "S256")
+
+	// Client credentials in the form (client_secret_post)
+	form := url.Values{"grant_type": {"authorization_code"}, "redirect_uri": {testRedirectURI}, "client_id": {"wiki"}, "client_secret": {"wiki-secret"}}
+	form.Set("code", authorize(t, p, params))
+	form.Set("code_verifier", "wrong-verifier")
+	if _, err := p.Exchange(ctx, form, "", ""); AsError(err).Code != ErrorInvalidGrant {
+		t.Errorf("Exchange(wrong verifier) error = %v, want invalid_grant", err)
+	}
+
+	form.Set("code", authorize(t, p, params))
+	form.Set("code_verifier", verifier)
+	resp, err := p.Exchange(ctx, form, "", "")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	info, _ := p.UserInfo(ctx, resp.AccessToken)
+	if _, ok := info["email"]; ok || info["sub"] == nil {
+		t.Errorf("UserInfo() = %v, want only sub without the email scope", info)
+	}
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	if _, err := New(config.IDPConfig{}, "https://auth.example.com/_auth/idp", []byte("not a key"), nil); !errors.Is(err, oauth2.ErrSigningKeyInvalid) {
+		t.Errorf("New() error = %v, want ErrSigningKeyInvalid", err)
+	}
+}
+
+func TestProvider_Introspect(t *testing.T) {
+	p, _ := newTestProvider(t)
+	ctx := context.Background()
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {authorize(t, p, validAuthorizeParams())}, "redirect_uri": {testRedirectURI}}
+	resp, err := p.Exchange(ctx, form, "wiki", "wiki-secret")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	for token, wantType := range map[string]string{resp.IDToken: "id_token", resp.AccessToken: "access_token"} {
+		claims, err := p.Introspect(ctx, token)
+		if err != nil || claims["token_type"] != wantType || claims["client_id"] != "wiki" || claims["email"] != "alice@example.com" || claims["exp"] == nil {
+			t.Errorf("Introspect(%s) = %v, %v, want active claims", wantType, claims, err)
+		}
+	}
+
+	// Tampered, unknown and expired tokens are inactive
+	parts := strings.Split(resp.IDToken, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+p.Issuer()+`","exp":9999999999}`)) + "." + parts[2]
+	fake := clock.NewFake(time.Now().Add(2 * time.Hour))
+	for name, token := range map[string]string{"tampered": tampered, "unknown": "unknown"} {
+		if claims, err := p.Introspect(ctx, token); claims != nil || err != nil {
+			t.Errorf("Introspect(%s) = %v, %v, want inactive", name, claims, err)
+		}
+	}
+	p.SetClock(fake)
+	for _, token := range []string{resp.IDToken, resp.AccessToken} {
+		if claims, _ := p.Introspect(ctx, token); claims != nil {
+			t.Errorf("Introspect(expired) = %v, want inactive", claims)
+		}
+	}
+}
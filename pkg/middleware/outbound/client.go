@@ -0,0 +1,107 @@
+// Package outbound builds the HTTP client used for calls made by the gate itself.
+//
+// OAuth2 token exchanges, userinfo and provider API requests, OIDC discovery and the SendGrid API
+// all go through this client, so an egress proxy and a corporate CA bundle only need to be
+// configured once. Proxied upstream requests do not use it.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// ErrCABundleInvalid is returned when outbound.ca_file contains no PEM certificates
+var ErrCABundleInvalid = errors.New("CA bundle contains no PEM certificates")
+
+// NewClient creates an HTTP client from the outbound settings
+// Without proxy_url the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are honored.
+func NewClient(cfg config.OutboundConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := proxyFunc(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	if cfg.CAFile != "" {
+		pool, err := loadCABundle(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.GetTimeout(),
+	}, nil
+}
+
+// proxyFunc returns the proxy selection of the transport
+func proxyFunc(cfg config.OutboundConfig) (func(*http.Request) (*url.URL, error), error) {
+	if cfg.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(cfg.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbound proxy URL: %w", err)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), cfg.NoProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// bypassProxy reports whether host matches a no_proxy entry
+// Entries are exact host names, ".domain" suffixes (also matching "domain" itself), CIDR ranges or "*"
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+		case host == entry:
+			return true
+		}
+	}
+	return false
+}
+
+// loadCABundle returns the system roots extended with the certificates of a PEM file
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrCABundleInvalid, path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,126 @@
+package outbound
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+func TestNewClient_ProxyURL(t *testing.T) {
+	// The proxy answers plain http requests itself, as forward proxies receive absolute URLs
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(config.OutboundConfig{ProxyURL: proxy.URL, NoProxy: []string{".internal"}, Timeout: "5s"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if client.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", client.Timeout)
+	}
+
+	resp, err := client.Get("http://idp.example.com/token")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if len(proxied) != 1 || proxied[0] != "http://idp.example.com/token" {
+		t.Errorf("Proxied = %v, want the request through the proxy", proxied)
+	}
+
+	proxyFor := client.Transport.(*http.Transport).Proxy
+	req, _ := http.NewRequest(http.MethodGet, "https://login.corp.internal/token", nil)
+	if u, _ := proxyFor(req); u != nil {
+		t.Errorf("Proxy() = %v for a no_proxy host, want nil", u)
+	}
+}
+
+func TestNewClient_Environment(t *testing.T) {
+	client, err := NewClient(config.OutboundConfig{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if client.Timeout != config.DefaultOutboundTimeout {
+		t.Errorf("Timeout = %v, want %v", client.Timeout, config.DefaultOutboundTimeout)
+	}
+	if client.Transport.(*http.Transport).Proxy == nil {
+		t.Error("Proxy is nil, want the environment proxy")
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"idp.internal", ".corp.example.com", "10.0.0.0/8"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"idp.internal", true},
+		{"IDP.internal", true},
+		{"other.internal", false},
+		{"login.corp.example.com", true},
+		{"corp.example.com", true},
+		{"evilcorp.example.com", false},
+		{"10.1.2.3", true},
+		{"192.168.0.1", false},
+		{"accounts.google.com", false},
+	}
+	for _, tt := range tests {
+		if got := bypassProxy(tt.host, noProxy); got != tt.want {
+			t.Errorf("bypassProxy(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if !bypassProxy("accounts.google.com", []string{"*"}) {
+		t.Error("bypassProxy() with * = false, want true")
+	}
+}
+
+func TestNewClient_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server must not be reached through an environment proxy
+	host, _ := url.Parse(server.URL)
+	client, err := NewClient(config.OutboundConfig{ProxyURL: "http://127.0.0.1:1", NoProxy: []string{host.Hostname()}, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v, want the bundle to trust the server", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestNewClient_InvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewClient(config.OutboundConfig{CAFile: caFile}); !errors.Is(err, ErrCABundleInvalid) {
+		t.Errorf("NewClient() error = %v, want ErrCABundleInvalid", err)
+	}
+	if _, err := NewClient(config.OutboundConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewClient() with a missing CA file succeeded")
+	}
+}
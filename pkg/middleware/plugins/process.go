@@ -0,0 +1,203 @@
+// Package plugins runs external filter processes for logic too bespoke for the rules engine.
+// A plugin is a long-running process started on first use. Each call writes one JSON Request line
+// to its stdin and reads one JSON Reply line from its stdout; calls are serialized, and a call
+// waiting for its turn gives up when its context is done. A plugin that fails, answers late or
+// exits is killed and started again on the next call. Plugins should exit when their stdin is
+// closed.
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// ErrClosed is returned by calls to a plugin after Close
+var ErrClosed = errors.New("plugin is closed")
+
+// maxReplyBytes limits the size of a reply line
+const maxReplyBytes = 1 << 20
+
+// Reply actions
+const (
+	ActionAllow = "allow" // Request hook: pass the request on (the default for an empty action)
+	ActionDeny  = "deny"  // Either hook: answer with status and message instead
+	ActionLogin = "login" // Callback hook: sign the user in
+)
+
+// User is the identity of a Request (the session's user) or of a login Reply
+type User struct {
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// Request is a call to a plugin, written as one JSON line
+type Request struct {
+	Hook       string            `json:"hook"` // config.PluginHookRequest or config.PluginHookCallback
+	Method     string            `json:"method"`
+	Host       string            `json:"host"`
+	Path       string            `json:"path"`
+	Query      string            `json:"query,omitempty"`
+	RemoteAddr string            `json:"remote_addr"`
+	Headers    map[string]string `json:"headers"`        // First value of each request header, without Cookie
+	User       *User             `json:"user,omitempty"` // Request hook: the session's user, nil without a session
+}
+
+// Reply is the answer of a plugin, read as one JSON line
+type Reply struct {
+	Action   string            `json:"action"`             // "allow" (default), "deny" or, for callbacks, "login"
+	Status   int               `json:"status,omitempty"`   // Status of a denial (default: 403)
+	Message  string            `json:"message,omitempty"`  // Body of a denial
+	Headers  map[string]string `json:"headers,omitempty"`  // Request hook: headers set on the upstream request ("" deletes)
+	User     *User             `json:"user,omitempty"`     // Login: the signed-in user (email required)
+	Redirect string            `json:"redirect,omitempty"` // Login: local path to land on (default: the original URL)
+}
+
+// Process is a running (or not yet started) plugin
+type Process struct {
+	name    string
+	command []string
+	timeout time.Duration
+
+	turn   chan struct{} // Holds a value while a call or Close uses the process
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	closed bool
+}
+
+// NewProcess returns the plugin of the configuration, started on the first call
+func NewProcess(cfg config.PluginConfig) *Process {
+	return &Process{
+		name:    cfg.Name,
+		command: cfg.Command,
+		timeout: cfg.GetTimeout(),
+		turn:    make(chan struct{}, 1),
+	}
+}
+
+// Name returns the plugin name
+func (p *Process) Name() string {
+	return p.name
+}
+
+// Call sends the request to the plugin and returns its reply
+// The process is killed when it fails or does not answer within the timeout, and started again on the next call.
+func (p *Process) Call(ctx context.Context, req *Request) (*Reply, error) {
+	select {
+	case p.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("plugin %s: %w", p.name, ctx.Err())
+	}
+	defer func() { <-p.turn }()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	var reply Reply
+	stdin, stdout := p.stdin, p.stdout
+	go func() {
+		if _, err := stdin.Write(append(line, '\n')); err != nil {
+			done <- err
+			return
+		}
+		data, err := readLine(stdout)
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- json.Unmarshal(data, &reply)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		p.stop()
+		<-done // The pipes are closed, so the call returns
+		return nil, fmt.Errorf("plugin %s: %w", p.name, ctx.Err())
+	}
+	if err != nil {
+		p.stop()
+		return nil, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	return &reply, nil
+}
+
+// Close stops the process; later calls return ErrClosed
+// It waits for the running call, which ends within the timeout.
+func (p *Process) Close() {
+	p.turn <- struct{}{}
+	defer func() { <-p.turn }()
+	p.closed = true
+	if p.cmd != nil {
+		p.stop()
+	}
+}
+
+// start starts the process with pipes on stdin and stdout; its stderr is the gate's stderr
+func (p *Process) start() error {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// stop kills the process and waits for it, so that the next call starts a new one
+func (p *Process) stop() {
+	_ = p.stdin.Close()
+	_ = p.cmd.Process.Kill()
+	_ = p.cmd.Wait()
+	p.cmd, p.stdin, p.stdout = nil, nil, nil
+}
+
+// readLine reads a line of at most maxReplyBytes
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxReplyBytes {
+			return nil, errors.New("reply line too long")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
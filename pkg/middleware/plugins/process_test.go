@@ -0,0 +1,138 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/config"
+)
+
+// TestMain runs the test binary as a plugin when PLUGINS_TEST_HELPER is set
+func TestMain(m *testing.M) {
+	if os.Getenv("PLUGINS_TEST_HELPER") == "1" {
+		runHelperPlugin()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runHelperPlugin denies /admin, hangs on /slow, exits on /crash and else allows with a header
+func runHelperPlugin() {
+	scanner := bufio.NewScanner(os.Stdin)
+	calls := 0
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		calls++
+		switch req.Path {
+		case "/admin":
+			fmt.Println(`{"action":"deny","status":403,"message":"admins only"}`)
+		case "/slow":
+			select {}
+		case "/crash":
+			os.Exit(1)
+		default:
+			fmt.Printf(`{"action":"allow","headers":{"X-Calls":"%d"}}`+"\n", calls)
+		}
+	}
+}
+
+func newTestProcess(t *testing.T) *Process {
+	t.Helper()
+	t.Setenv("PLUGINS_TEST_HELPER", "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() error = %v", err)
+	}
+	p := NewProcess(config.PluginConfig{Name: "policy", Command: []string{exe}, Timeout: "500ms"})
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestProcess_Call(t *testing.T) {
+	p := newTestProcess(t)
+	ctx := context.Background()
+
+	reply, err := p.Call(ctx, &Request{Hook: config.PluginHookRequest, Path: "/chat"})
+	if err != nil || reply.Action != ActionAllow || reply.Headers["X-Calls"] != "1" {
+		t.Fatalf("Call(/chat) = %+v, %v, want allow from the first call", reply, err)
+	}
+	reply, err = p.Call(ctx, &Request{Hook: config.PluginHookRequest, Path: "/admin"})
+	if err != nil || reply.Action != ActionDeny || reply.Message != "admins only" {
+		t.Fatalf("Call(/admin) = %+v, %v, want deny", reply, err)
+	}
+
+	// The process keeps running between calls
+	reply, err = p.Call(ctx, &Request{Hook: config.PluginHookRequest, Path: "/chat"})
+	if err != nil || reply.Headers["X-Calls"] != "3" {
+		t.Fatalf("Call(/chat) = %+v, %v, want the third call of the same process", reply, err)
+	}
+}
+
+func TestProcess_Restart(t *testing.T) {
+	p := newTestProcess(t)
+	ctx := context.Background()
+
+	if _, err := p.Call(ctx, &Request{Path: "/slow"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call(/slow) error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if reply, err := p.Call(ctx, &Request{Path: "/chat"}); err != nil || reply.Headers["X-Calls"] != "1" {
+		t.Errorf("Call after a timeout = %+v, %v, want a new process", reply, err)
+	}
+
+	if _, err := p.Call(ctx, &Request{Path: "/crash"}); err == nil {
+		t.Error("Call(/crash) should fail when the plugin exits")
+	}
+	if reply, err := p.Call(ctx, &Request{Path: "/chat"}); err != nil || reply.Headers["X-Calls"] != "1" {
+		t.Errorf("Call after a crash = %+v, %v, want a new process", reply, err)
+	}
+
+	p.Close()
+	if _, err := p.Call(ctx, &Request{Path: "/chat"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Call after Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestProcess_WaitingCallCanceled(t *testing.T) {
+	p := newTestProcess(t)
+
+	// A call hangs until the timeout while holding the process
+	slow := make(chan error, 1)
+	go func() {
+		_, err := p.Call(context.Background(), &Request{Path: "/slow"})
+		slow <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Call(ctx, &Request{Path: "/chat"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting Call error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("waiting Call returned after %v, want it to give up with its context", elapsed)
+	}
+
+	if err := <-slow; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call(/slow) error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if reply, err := p.Call(context.Background(), &Request{Path: "/chat"}); err != nil || reply.Action != ActionAllow {
+		t.Errorf("Call after the slow call = %+v, %v, want allow", reply, err)
+	}
+}
+
+func TestProcess_StartFailure(t *testing.T) {
+	p := NewProcess(config.PluginConfig{Name: "missing", Command: []string{"/nonexistent/plugin"}})
+	if _, err := p.Call(context.Background(), &Request{Path: "/chat"}); err == nil {
+		t.Error("Call should fail when the command cannot be started")
+	}
+}
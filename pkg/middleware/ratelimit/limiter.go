@@ -1,8 +1,8 @@
-// Package ratelimit provides rate limiting functionality for email authentication.
+// Package ratelimit provides rate limiting functionality for email authentication and guest sessions.
 //
 // This package implements a token bucket algorithm to prevent abuse of magic link emails
-// by limiting how many times a user can request login links within a time window.
-// Currently used exclusively for email authentication send rate limiting.
+// by limiting how many times a user can request login links within a time window, and of
+// guest sessions by limiting how many a client IP can start.
 package ratelimit
 
 import (
@@ -10,15 +10,17 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
 // Limiter implements a simple token bucket rate limiter backed by KVS
-// Currently used to rate limit email authentication magic link sends.
+// Used to rate limit email authentication magic link sends and guest session starts.
 type Limiter struct {
 	kvs      kvs.Store
 	rate     int // tokens per interval
 	interval time.Duration
+	clock    clock.Clock // Time of bucket refills
 }
 
 // bucket represents a token bucket for a specific key
@@ -30,14 +32,21 @@ type bucket struct {
 // NewLimiter creates a new rate limiter backed by KVS
 // rate: number of allowed requests
 // interval: time window for the rate
+// Buckets expire from the KVS after the interval, when they would be full again.
 func NewLimiter(rate int, interval time.Duration, kvsStore kvs.Store) *Limiter {
 	return &Limiter{
 		kvs:      kvsStore,
 		rate:     rate,
 		interval: interval,
+		clock:    clock.Real,
 	}
 }
 
+// SetClock replaces the system clock, e.g. with a clock.Fake to refill buckets in tests
+func (l *Limiter) SetClock(c clock.Clock) {
+	l.clock = clock.OrReal(c)
+}
+
 // Allow checks if a request is allowed for the given key
 func (l *Limiter) Allow(key string) bool {
 	// Use context with timeout to prevent hanging on slow KVS operations
@@ -57,12 +66,12 @@ func (l *Limiter) Allow(key string) bool {
 		// First request for this key
 		b = bucket{
 			Tokens:     l.rate - 1,
-			LastRefill: time.Now(),
+			LastRefill: l.clock.Now(),
 		}
 		// Store the new bucket
 		if jsonData, err := json.Marshal(b); err == nil {
 			//nolint:staticcheck // SA9003: Empty branch is intentional for fail-safe behavior
-			if setErr := l.kvs.Set(ctx, key, jsonData, 0); setErr != nil {
+			if setErr := l.kvs.Set(ctx, key, jsonData, l.interval); setErr != nil {
 				// KVS write failed, but we still allow the request
 				// The bucket won't persist, so next request will be treated as first request
 				// This is fail-safe: we prefer to allow traffic over blocking it on KVS errors
@@ -76,11 +85,11 @@ func (l *Limiter) Allow(key string) bool {
 		// Corrupted data, treat as new bucket
 		b = bucket{
 			Tokens:     l.rate - 1,
-			LastRefill: time.Now(),
+			LastRefill: l.clock.Now(),
 		}
 		if jsonData, err := json.Marshal(b); err == nil {
 			//nolint:staticcheck // SA9003: Empty branch is intentional for fail-safe behavior
-			if setErr := l.kvs.Set(ctx, key, jsonData, 0); setErr != nil {
+			if setErr := l.kvs.Set(ctx, key, jsonData, l.interval); setErr != nil {
 				// Same fail-safe behavior as above
 			}
 		}
@@ -88,7 +97,7 @@ func (l *Limiter) Allow(key string) bool {
 	}
 
 	// Refill tokens based on time elapsed
-	now := time.Now()
+	now := l.clock.Now()
 	elapsed := now.Sub(b.LastRefill)
 
 	if elapsed >= l.interval {
@@ -104,7 +113,7 @@ func (l *Limiter) Allow(key string) bool {
 		// Update bucket
 		if jsonData, err := json.Marshal(b); err == nil {
 			//nolint:staticcheck // SA9003: Empty branch is intentional for fail-safe behavior
-			if setErr := l.kvs.Set(ctx, key, jsonData, 0); setErr != nil {
+			if setErr := l.kvs.Set(ctx, key, jsonData, l.interval); setErr != nil {
 				// Write failed. The token was already consumed in memory,
 				// so we return true to allow the request.
 				// Consequence: if this persists, rate limit may not work properly,
@@ -136,7 +145,7 @@ func (l *Limiter) Cleanup(maxAge time.Duration) {
 		return
 	}
 
-	now := time.Now()
+	now := l.clock.Now()
 	for _, key := range keys {
 		// Check if context is cancelled (timeout or shutdown)
 		select {
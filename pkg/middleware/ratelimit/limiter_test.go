@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
 	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
 )
 
@@ -38,6 +39,8 @@ func TestLimiter_Allow(t *testing.T) {
 func TestLimiter_Refill(t *testing.T) {
 	// Allow 2 requests per 100ms
 	limiter := createTestLimiter(2, 100*time.Millisecond)
+	fake := clock.NewFake(time.Now())
+	limiter.SetClock(fake)
 
 	key := "test-key"
 
@@ -50,8 +53,8 @@ func TestLimiter_Refill(t *testing.T) {
 		t.Error("3rd request should be blocked immediately")
 	}
 
-	// Wait for refill
-	time.Sleep(150 * time.Millisecond)
+	// Move past the refill interval
+	fake.Advance(150 * time.Millisecond)
 
 	// Should be allowed again
 	if !limiter.Allow(key) {
@@ -3,8 +3,12 @@ package rules
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+	"github.com/ideamans/chatbotgate/pkg/middleware/script"
 )
 
 // Action represents the action to take when a rule matches
@@ -14,6 +18,10 @@ const (
 	ActionAllow Action = "allow" // Allow access without authentication
 	ActionAuth  Action = "auth"  // Require authentication
 	ActionDeny  Action = "deny"  // Deny access (403)
+
+	// ActionOptional allows access without authentication, but attaches the user's
+	// identity (auth and forwarding headers) when a valid session exists
+	ActionOptional Action = "optional"
 )
 
 // RuleConfig represents a single rule in the configuration
@@ -25,13 +33,61 @@ type RuleConfig struct {
 	Minimatch string `yaml:"minimatch,omitempty"` // Glob/minimatch pattern
 	All       *bool  `yaml:"all,omitempty"`       // Match all paths (must be true if specified)
 
+	// Request conditions (optional, all must match in addition to the path matcher)
+	Methods []string          `yaml:"methods,omitempty"` // HTTP methods (e.g., [GET, HEAD]); empty matches any method
+	Headers map[string]string `yaml:"headers,omitempty"` // Header name to a regex for the whole value (case-insensitive); empty value requires presence only
+
 	// Action to take when matched
 	Action Action `yaml:"action"`
 
+	// Shorthand for the action by authentication requirement (instead of action):
+	// "required" (auth), "optional" or "none" (allow)
+	Auth string `yaml:"auth,omitempty"`
+
+	// Step-up authentication (optional, action auth only): signed-in users whose session is
+	// older or weaker than required are sent through the login page again
+	MaxAuthAge string   `yaml:"max_auth_age,omitempty"` // Maximum time since sign-in (e.g., "10m")
+	Providers  []string `yaml:"providers,omitempty"`    // Accepted providers: OAuth2 provider IDs, "oauth2" (any), "email", "password"
+	RequireMFA bool     `yaml:"require_mfa,omitempty"`  // Require multi-factor authentication reported by the provider
+
+	// Group and role membership (optional, action auth only): signed-in users outside all of the
+	// groups (or roles) are denied (403). They come from the provider, e.g., Google group emails
+	// from the Directory API, or Microsoft Entra group object IDs and app roles
+	Groups []string `yaml:"groups,omitempty"`
+	Roles  []string `yaml:"roles,omitempty"`
+
+	// CEL expression signed-in users must satisfy (optional, action auth only), denied (403) otherwise,
+	// e.g., 'email.endsWith("@example.com") && "admins" in groups'
+	Require string `yaml:"require,omitempty"`
+
+	// Lua policy script signed-in users must pass (optional, action auth only), denied (403) otherwise:
+	// the path of a file returning true to allow the request (see pkg/middleware/script)
+	Script string `yaml:"script,omitempty"`
+
 	// Optional description for documentation
 	Description string `yaml:"description,omitempty"`
 }
 
+// Values of RuleConfig.Auth
+const (
+	AuthRequired = "required" // Same as action: auth
+	AuthOptional = "optional" // Same as action: optional
+	AuthNone     = "none"     // Same as action: allow
+)
+
+// GetAction returns the action of the rule, resolving the auth shorthand
+func (r *RuleConfig) GetAction() Action {
+	switch r.Auth {
+	case AuthRequired:
+		return ActionAuth
+	case AuthOptional:
+		return ActionOptional
+	case AuthNone:
+		return ActionAllow
+	}
+	return r.Action
+}
+
 // Config represents the rules configuration (a list of rules)
 type Config []RuleConfig
 
@@ -84,12 +140,94 @@ func (r *RuleConfig) Validate() error {
 		return fmt.Errorf("multiple matchers specified (only one of exact, prefix, regex, minimatch, all is allowed)")
 	}
 
+	// Validate auth shorthand
+	if r.Auth != "" {
+		if r.Action != "" {
+			return fmt.Errorf("both action and auth specified (use only one)")
+		}
+		switch r.Auth {
+		case AuthRequired, AuthOptional, AuthNone:
+			// Valid shorthand
+		default:
+			return fmt.Errorf("invalid auth %q (must be one of: required, optional, none)", r.Auth)
+		}
+	}
+
 	// Validate action
-	switch r.Action {
-	case ActionAllow, ActionAuth, ActionDeny:
+	switch r.GetAction() {
+	case ActionAllow, ActionAuth, ActionDeny, ActionOptional:
 		// Valid action
 	default:
-		return fmt.Errorf("invalid action %q (must be one of: allow, auth, deny)", r.Action)
+		return fmt.Errorf("invalid action %q (must be one of: allow, auth, deny, optional)", r.Action)
+	}
+
+	// Validate request conditions
+	for _, method := range r.Methods {
+		if method == "" || strings.ContainsAny(method, " \t") {
+			return fmt.Errorf("invalid method %q", method)
+		}
+	}
+	for name, pattern := range r.Headers {
+		if name == "" || strings.ContainsAny(name, " \t:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if _, err := compileHeaderPattern(pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern %q for header %s: %w", pattern, name, err)
+		}
+	}
+
+	// Validate step-up requirements
+	if r.MaxAuthAge != "" || len(r.Providers) > 0 || r.RequireMFA {
+		if r.GetAction() != ActionAuth {
+			return fmt.Errorf("max_auth_age, providers and require_mfa require action auth")
+		}
+		if r.MaxAuthAge != "" {
+			if age, err := time.ParseDuration(r.MaxAuthAge); err != nil || age <= 0 {
+				return fmt.Errorf("invalid max_auth_age %q (must be a positive duration, e.g., 10m)", r.MaxAuthAge)
+			}
+		}
+		for _, provider := range r.Providers {
+			if provider == "" {
+				return fmt.Errorf("empty provider in providers")
+			}
+		}
+	}
+
+	// Validate group and role membership requirements
+	if len(r.Groups) > 0 || len(r.Roles) > 0 {
+		if r.GetAction() != ActionAuth {
+			return fmt.Errorf("groups and roles require action auth")
+		}
+		for _, group := range r.Groups {
+			if group == "" {
+				return fmt.Errorf("empty group in groups")
+			}
+		}
+		for _, role := range r.Roles {
+			if role == "" {
+				return fmt.Errorf("empty role in roles")
+			}
+		}
+	}
+
+	// Validate the requirement expression
+	if r.Require != "" {
+		if r.GetAction() != ActionAuth {
+			return fmt.Errorf("require requires action auth")
+		}
+		if _, err := expr.CompileCondition(r.Require); err != nil {
+			return fmt.Errorf("invalid require: %w", err)
+		}
+	}
+
+	// Validate the policy script
+	if r.Script != "" {
+		if r.GetAction() != ActionAuth {
+			return fmt.Errorf("script requires action auth")
+		}
+		if _, err := script.Load(r.Script); err != nil {
+			return fmt.Errorf("invalid script: %w", err)
+		}
 	}
 
 	// Validate regex syntax if specified
@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"net/http"
 	"regexp"
 	"strings"
 
@@ -83,3 +84,77 @@ func NewAllMatcher() *AllMatcher {
 func (m *AllMatcher) Match(path string) bool {
 	return true
 }
+
+// RequestConditions matches the HTTP method and headers of a request
+// A zero value matches every request
+type RequestConditions struct {
+	methods map[string]bool
+	headers []headerCondition
+}
+
+// headerCondition requires a header to be present, optionally with a value matching pattern
+type headerCondition struct {
+	name    string
+	pattern *regexp.Regexp // nil: presence only
+}
+
+// NewRequestConditions compiles method and header conditions
+// Header values are regular expressions matched against the whole value, case-insensitively
+func NewRequestConditions(methods []string, headers map[string]string) (*RequestConditions, error) {
+	c := &RequestConditions{}
+	if len(methods) > 0 {
+		c.methods = make(map[string]bool, len(methods))
+		for _, method := range methods {
+			c.methods[strings.ToUpper(method)] = true
+		}
+	}
+	for name, value := range headers {
+		pattern, err := compileHeaderPattern(value)
+		if err != nil {
+			return nil, err
+		}
+		c.headers = append(c.headers, headerCondition{name: http.CanonicalHeaderKey(name), pattern: pattern})
+	}
+	return c, nil
+}
+
+// IsEmpty returns true if the conditions match every request
+func (c *RequestConditions) IsEmpty() bool {
+	return len(c.methods) == 0 && len(c.headers) == 0
+}
+
+// Match returns true if the request satisfies all conditions
+func (c *RequestConditions) Match(r *http.Request) bool {
+	if len(c.methods) > 0 && !c.methods[r.Method] {
+		return false
+	}
+	for _, h := range c.headers {
+		values, ok := r.Header[h.name]
+		if !ok {
+			return false
+		}
+		if h.pattern != nil && !matchAny(h.pattern, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns true if any value matches the pattern
+func matchAny(pattern *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if pattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileHeaderPattern compiles a header value pattern anchored to the whole value
+// Returns nil for an empty pattern (presence only)
+func compileHeaderPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)^(?:" + pattern + ")$")
+}
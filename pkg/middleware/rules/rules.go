@@ -1,11 +1,16 @@
 package rules
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 // Rule represents a compiled rule with a matcher and action
 type Rule struct {
 	matcher     Matcher
+	conditions  *RequestConditions
 	action      Action
+	stepUp      *StepUp // nil when the rule has no step-up requirements
 	description string
 }
 
@@ -40,6 +45,50 @@ func NewEvaluator(config *Config) (*Evaluator, error) {
 	return &Evaluator{rules: rules}, nil
 }
 
+// RuleCheck is the compilation result of a rule, for diagnostics
+type RuleCheck struct {
+	Index       int    `json:"index"`
+	Matcher     string `json:"matcher"`           // "exact", "prefix", "regex", "minimatch" or "all"
+	Pattern     string `json:"pattern,omitempty"` // Path, prefix or pattern of the matcher
+	Action      Action `json:"action"`
+	Description string `json:"description,omitempty"`
+	Default     bool   `json:"default,omitempty"` // The default rule, used when no rules are configured
+	Error       string `json:"error,omitempty"`   // Validation or compilation error
+}
+
+// Check validates and compiles each rule of the configuration, and reports the results in order
+// Without rules, the result is that of the default configuration.
+func Check(config Config) []RuleCheck {
+	isDefault := len(config) == 0
+	if isDefault {
+		config = GetDefaultConfig()
+	}
+
+	checks := make([]RuleCheck, len(config))
+	for i, ruleConfig := range config {
+		check := RuleCheck{Index: i, Action: ruleConfig.GetAction(), Description: ruleConfig.Description, Default: isDefault}
+		switch {
+		case ruleConfig.Exact != "":
+			check.Matcher, check.Pattern = "exact", ruleConfig.Exact
+		case ruleConfig.Prefix != "":
+			check.Matcher, check.Pattern = "prefix", ruleConfig.Prefix
+		case ruleConfig.Regex != "":
+			check.Matcher, check.Pattern = "regex", ruleConfig.Regex
+		case ruleConfig.Minimatch != "":
+			check.Matcher, check.Pattern = "minimatch", ruleConfig.Minimatch
+		case ruleConfig.All != nil:
+			check.Matcher = "all"
+		}
+		if err := ruleConfig.Validate(); err != nil {
+			check.Error = err.Error()
+		} else if _, err := compileRule(&ruleConfig); err != nil {
+			check.Error = err.Error()
+		}
+		checks[i] = check
+	}
+	return checks
+}
+
 // compileRule compiles a rule configuration into an executable rule
 func compileRule(config *RuleConfig) (*Rule, error) {
 	var matcher Matcher
@@ -68,24 +117,70 @@ func compileRule(config *RuleConfig) (*Rule, error) {
 		return nil, fmt.Errorf("no matcher specified")
 	}
 
+	conditions, err := NewRequestConditions(config.Methods, config.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile header pattern: %w", err)
+	}
+
+	stepUp, err := newStepUp(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile step-up requirements: %w", err)
+	}
+
 	return &Rule{
 		matcher:     matcher,
-		action:      config.Action,
+		conditions:  conditions,
+		action:      config.GetAction(),
+		stepUp:      stepUp,
 		description: config.Description,
 	}, nil
 }
 
 // Evaluate evaluates a path against all rules and returns the action
 // Rules are evaluated in order, and the first matching rule determines the action
+// Rules with method or header conditions are skipped because there is no request to check
 func (e *Evaluator) Evaluate(path string) Action {
+	return e.evaluate(path, nil)
+}
+
+// EvaluateRequest evaluates a request (path, method and headers) against all rules and returns the action
+// Rules are evaluated in order, and the first matching rule determines the action
+func (e *Evaluator) EvaluateRequest(r *http.Request) Action {
+	return e.evaluate(r.URL.Path, r)
+}
+
+// MatchRequest is like EvaluateRequest, and also returns the step-up authentication
+// requirements of the matching rule (nil when it has none)
+func (e *Evaluator) MatchRequest(r *http.Request) (Action, *StepUp) {
+	rule := e.match(r.URL.Path, r)
+	if rule == nil {
+		return ActionAuth, nil
+	}
+	return rule.action, rule.stepUp
+}
+
+// evaluate returns the action of the first rule matching the path and, if given, the request
+func (e *Evaluator) evaluate(path string, r *http.Request) Action {
+	rule := e.match(path, r)
+	if rule == nil {
+		// If no rules match, default to requiring authentication
+		return ActionAuth
+	}
+	return rule.action
+}
+
+// match returns the first rule matching the path and, if given, the request (nil when none matches)
+func (e *Evaluator) match(path string, r *http.Request) *Rule {
 	for _, rule := range e.rules {
-		if rule.matcher.Match(path) {
-			return rule.action
+		if !rule.matcher.Match(path) {
+			continue
+		}
+		if !rule.conditions.IsEmpty() && (r == nil || !rule.conditions.Match(r)) {
+			continue
 		}
+		return rule
 	}
-
-	// If no rules match, default to requiring authentication
-	return ActionAuth
+	return nil
 }
 
 // ShouldAllow returns true if the path should be allowed without authentication
@@ -1,7 +1,12 @@
 package rules
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
 )
 
 // boolPtr returns a pointer to a bool value
@@ -171,6 +176,146 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "optional action with conditions",
+			config: Config{
+				{Prefix: "/api/", Methods: []string{"GET"}, Headers: map[string]string{"Sec-Fetch-Dest": "script"}, Action: ActionOptional},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid method",
+			config: Config{
+				{Prefix: "/api/", Methods: []string{""}, Action: ActionAllow},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid header name",
+			config: Config{
+				{Prefix: "/api/", Headers: map[string]string{"X Bad": ""}, Action: ActionAllow},
+			},
+			expectError: true,
+		},
+		{
+			name: "auth shorthand",
+			config: Config{
+				{Prefix: "/share/", Auth: AuthOptional},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid auth shorthand",
+			config: Config{
+				{Prefix: "/share/", Auth: "maybe"},
+			},
+			expectError: true,
+		},
+		{
+			name: "both action and auth",
+			config: Config{
+				{Prefix: "/share/", Action: ActionAllow, Auth: AuthOptional},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid header regex",
+			config: Config{
+				{Prefix: "/api/", Headers: map[string]string{"Accept": "[invalid("}, Action: ActionAllow},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid step-up",
+			config: Config{
+				{Minimatch: "/admin/**", Auth: AuthRequired, MaxAuthAge: "10m", Providers: []string{ProviderOAuth2}, RequireMFA: true},
+			},
+			expectError: false,
+		},
+		{
+			name: "step-up on allow rule",
+			config: Config{
+				{Prefix: "/public/", Action: ActionAllow, MaxAuthAge: "10m"},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid max_auth_age",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAuth, MaxAuthAge: "soon"},
+			},
+			expectError: true,
+		},
+		{
+			name: "empty provider",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAuth, Providers: []string{""}},
+			},
+			expectError: true,
+		},
+		{
+			name: "groups on auth rule",
+			config: Config{
+				{Prefix: "/finance/", Action: ActionAuth, Groups: []string{"finance@example.com"}},
+			},
+			expectError: false,
+		},
+		{
+			name: "groups on optional rule",
+			config: Config{
+				{Prefix: "/finance/", Auth: AuthOptional, Groups: []string{"finance@example.com"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "empty group",
+			config: Config{
+				{Prefix: "/finance/", Action: ActionAuth, Groups: []string{""}},
+			},
+			expectError: true,
+		},
+		{
+			name: "roles on allow rule",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAllow, Roles: []string{"Admin"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "require on auth rule",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAuth, Require: `email.endsWith("@example.com") && "admins" in groups`},
+			},
+			expectError: false,
+		},
+		{
+			name: "require on deny rule",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionDeny, Require: `"admins" in groups`},
+			},
+			expectError: true,
+		},
+		{
+			name: "require not a condition",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAuth, Require: `email`},
+			},
+			expectError: true,
+		},
+		{
+			name: "script on allow rule",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAllow, Script: "testdata/missing.lua"},
+			},
+			expectError: true,
+		},
+		{
+			name: "missing script",
+			config: Config{
+				{Prefix: "/admin/", Action: ActionAuth, Script: "testdata/missing.lua"},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -221,3 +366,211 @@ func TestEvaluator_HelperMethods(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluator_RequestConditions(t *testing.T) {
+	config := Config{
+		{Prefix: "/api/", Methods: []string{"get", "HEAD"}, Headers: map[string]string{"Sec-Fetch-Dest": "script"}, Action: ActionAllow},
+		{Prefix: "/api/", Headers: map[string]string{"Authorization": ""}, Action: ActionAuth},
+		{Regex: "^/widget/", Headers: map[string]string{"Accept": "text/html.*|application/xhtml\\+xml"}, Action: ActionOptional},
+		{Prefix: "/api/", Methods: []string{"OPTIONS"}, Action: ActionAllow},
+		{All: boolPtr(true), Action: ActionDeny},
+	}
+
+	evaluator, err := NewEvaluator(&config)
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    Action
+	}{
+		{"method and header match", http.MethodGet, "/api/embed.js", map[string]string{"Sec-Fetch-Dest": "script"}, ActionAllow},
+		{"header value is case-insensitive", http.MethodHead, "/api/embed.js", map[string]string{"sec-fetch-dest": "SCRIPT"}, ActionAllow},
+		{"method mismatch", http.MethodPost, "/api/embed.js", map[string]string{"Sec-Fetch-Dest": "script"}, ActionDeny},
+		{"header value must match whole value", http.MethodGet, "/api/embed.js", map[string]string{"Sec-Fetch-Dest": "scripts"}, ActionDeny},
+		{"header presence", http.MethodPost, "/api/chat", map[string]string{"Authorization": "Bearer x"}, ActionAuth},
+		{"header missing", http.MethodPost, "/api/chat", nil, ActionDeny},
+		{"header regex", http.MethodGet, "/widget/chat", map[string]string{"Accept": "text/html,application/xhtml+xml"}, ActionOptional},
+		{"header regex alternative", http.MethodGet, "/widget/chat", map[string]string{"Accept": "application/xhtml+xml"}, ActionOptional},
+		{"header regex mismatch", http.MethodGet, "/widget/chat", map[string]string{"Accept": "application/json"}, ActionDeny},
+		{"method only", http.MethodOptions, "/api/chat", nil, ActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := evaluator.EvaluateRequest(req); got != tt.want {
+				t.Errorf("EvaluateRequest(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// Without a request, conditional rules never match
+	if got := evaluator.Evaluate("/api/embed.js"); got != ActionDeny {
+		t.Errorf("Evaluate(/api/embed.js) = %v, want %v", got, ActionDeny)
+	}
+}
+
+func TestEvaluator_AuthShorthand(t *testing.T) {
+	config := Config{
+		{Prefix: "/share/", Auth: AuthOptional},
+		{Prefix: "/public/", Auth: AuthNone},
+		{All: boolPtr(true), Auth: AuthRequired},
+	}
+
+	evaluator, err := NewEvaluator(&config)
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want Action
+	}{
+		{"/share/abc", ActionOptional},
+		{"/public/logo.png", ActionAllow},
+		{"/chat", ActionAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := evaluator.Evaluate(tt.path); got != tt.want {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluator_MatchRequest_StepUp(t *testing.T) {
+	config := Config{
+		{Minimatch: "/admin/**", Action: ActionAuth, MaxAuthAge: "10m", Providers: []string{ProviderOAuth2, "email"}},
+		{Prefix: "/public/", Action: ActionAllow},
+		{All: boolPtr(true), Action: ActionAuth},
+	}
+
+	evaluator, err := NewEvaluator(&config)
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	action, stepUp := evaluator.MatchRequest(httptest.NewRequest("GET", "/admin/users", nil))
+	if action != ActionAuth || stepUp == nil {
+		t.Fatalf("MatchRequest(/admin/users) = %v, %v, want auth with step-up", action, stepUp)
+	}
+	if stepUp.MaxAuthAge != 10*time.Minute {
+		t.Errorf("MaxAuthAge = %v, want 10m", stepUp.MaxAuthAge)
+	}
+
+	if action, stepUp := evaluator.MatchRequest(httptest.NewRequest("GET", "/chat", nil)); action != ActionAuth || stepUp != nil {
+		t.Errorf("MatchRequest(/chat) = %v, %v, want auth without step-up", action, stepUp)
+	}
+	if action, _ := evaluator.MatchRequest(httptest.NewRequest("GET", "/public/logo.png", nil)); action != ActionAllow {
+		t.Errorf("MatchRequest(/public/logo.png) = %v, want allow", action)
+	}
+
+	// Provider requirement
+	if !stepUp.AcceptsProvider("google", true) {
+		t.Error("Any OAuth2 provider should be accepted with \"oauth2\"")
+	}
+	if !stepUp.AcceptsProvider("email", false) {
+		t.Error("email should be accepted")
+	}
+	if stepUp.AcceptsProvider("password", false) {
+		t.Error("password should not be accepted")
+	}
+
+	// Authentication age
+	now := time.Now()
+	if !stepUp.AcceptsAuthTime(now.Add(-5*time.Minute), now) {
+		t.Error("A sign-in 5 minutes ago should be accepted")
+	}
+	if stepUp.AcceptsAuthTime(now.Add(-time.Hour), now) {
+		t.Error("A sign-in an hour ago should not be accepted")
+	}
+}
+
+func TestStepUp_AcceptsGroups(t *testing.T) {
+	stepUp := &StepUp{Groups: []string{"finance@example.com", "admins@example.com"}}
+
+	if !stepUp.AcceptsGroups([]string{"staff@example.com", "Finance@Example.com"}) {
+		t.Error("A member of one of the groups should be accepted (case-insensitive)")
+	}
+	if stepUp.AcceptsGroups([]string{"staff@example.com"}) {
+		t.Error("A user outside the groups should not be accepted")
+	}
+	if stepUp.AcceptsGroups(nil) {
+		t.Error("A user without groups should not be accepted")
+	}
+	if !(&StepUp{}).AcceptsGroups(nil) {
+		t.Error("Any user should be accepted without a group requirement")
+	}
+}
+
+func TestStepUp_AcceptsRoles(t *testing.T) {
+	stepUp := &StepUp{Roles: []string{"Admin"}}
+
+	if !stepUp.AcceptsRoles([]string{"Reader", "admin"}) {
+		t.Error("A user with the role should be accepted (case-insensitive)")
+	}
+	if stepUp.AcceptsRoles([]string{"Reader"}) {
+		t.Error("A user without the role should not be accepted")
+	}
+	if !(&StepUp{}).AcceptsRoles(nil) {
+		t.Error("Any user should be accepted without a role requirement")
+	}
+}
+
+func TestStepUp_AcceptsUser(t *testing.T) {
+	config := &RuleConfig{Prefix: "/admin/", Action: ActionAuth, Require: `email.endsWith("@example.com") && "admins" in groups`}
+	stepUp, err := newStepUp(config)
+	if err != nil {
+		t.Fatalf("newStepUp() error = %v", err)
+	}
+
+	if !stepUp.AcceptsUser(expr.NewUserVars("", "alice@example.com", "google", map[string]interface{}{"groups": "staff,admins"})) {
+		t.Error("A user meeting the expression should be accepted")
+	}
+	if stepUp.AcceptsUser(expr.NewUserVars("", "alice@other.com", "google", map[string]interface{}{"groups": "admins"})) {
+		t.Error("A user not meeting the expression should not be accepted")
+	}
+	if !(&StepUp{}).AcceptsUser(expr.Vars{}) {
+		t.Error("Any user should be accepted without an expression")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	checks := Check(Config{
+		{Prefix: "/static/", Action: ActionAllow, Description: "Assets"},
+		{Regex: "^/admin/(", Action: ActionDeny},
+		{Exact: "/api", Auth: AuthOptional},
+		{All: boolPtr(true), Action: ActionAuth, Headers: map[string]string{"X-Tenant": "["}},
+	})
+
+	if len(checks) != 4 {
+		t.Fatalf("Check() returned %d results, want 4", len(checks))
+	}
+	if c := checks[0]; c.Matcher != "prefix" || c.Pattern != "/static/" || c.Action != ActionAllow || c.Description != "Assets" || c.Error != "" {
+		t.Errorf("checks[0] = %+v", c)
+	}
+	if c := checks[1]; c.Matcher != "regex" || c.Error == "" {
+		t.Errorf("checks[1] = %+v, want a regex compilation error", c)
+	}
+	if c := checks[2]; c.Action != ActionOptional || c.Error != "" {
+		t.Errorf("checks[2] = %+v, want the auth shorthand resolved", c)
+	}
+	if c := checks[3]; c.Matcher != "all" || c.Error == "" {
+		t.Errorf("checks[3] = %+v, want a header pattern error", c)
+	}
+
+	defaults := Check(nil)
+	if len(defaults) == 0 || !defaults[0].Default {
+		t.Errorf("Check(nil) = %+v, want the default rules", defaults)
+	}
+}
@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+	"github.com/ideamans/chatbotgate/pkg/middleware/script"
+)
+
+// ProviderOAuth2 is the value of RuleConfig.Providers accepting any OAuth2 provider
+const ProviderOAuth2 = "oauth2"
+
+// StepUp holds the step-up authentication requirements of a rule
+// Signed-in users whose session does not meet them are sent through the login page again,
+// except for the group and role requirements: users outside them are denied
+type StepUp struct {
+	MaxAuthAge time.Duration   // Maximum time since the user signed in (0: any)
+	Providers  []string        // Accepted session providers, "oauth2" for any OAuth2 provider (empty: any)
+	RequireMFA bool            // The provider must report multi-factor authentication ("amr" claim)
+	Groups     []string        // Groups the user must belong to, any of (empty: any)
+	Roles      []string        // Roles the user must have, any of (empty: any)
+	Require    *expr.Condition // Expression the user must satisfy (nil: none)
+	Script     *script.Policy  // Policy script the user must pass (nil: none)
+}
+
+// newStepUp returns the step-up requirements of a rule, or nil when it has none
+func newStepUp(config *RuleConfig) (*StepUp, error) {
+	if config.MaxAuthAge == "" && len(config.Providers) == 0 && !config.RequireMFA &&
+		len(config.Groups) == 0 && len(config.Roles) == 0 && config.Require == "" && config.Script == "" {
+		return nil, nil
+	}
+
+	s := &StepUp{
+		Providers:  config.Providers,
+		RequireMFA: config.RequireMFA,
+		Groups:     config.Groups,
+		Roles:      config.Roles,
+	}
+	if config.MaxAuthAge != "" {
+		age, err := time.ParseDuration(config.MaxAuthAge)
+		if err != nil {
+			return nil, err
+		}
+		s.MaxAuthAge = age
+	}
+	if config.Require != "" {
+		require, err := expr.CompileCondition(config.Require)
+		if err != nil {
+			return nil, err
+		}
+		s.Require = require
+	}
+	if config.Script != "" {
+		policy, err := script.Load(config.Script)
+		if err != nil {
+			return nil, err
+		}
+		s.Script = policy
+	}
+	return s, nil
+}
+
+// AcceptsProvider reports whether a session of the provider meets the provider requirement
+// isOAuth2 tells whether the provider is an OAuth2 provider (not "email", "password" or a plugin)
+func (s *StepUp) AcceptsProvider(provider string, isOAuth2 bool) bool {
+	if len(s.Providers) == 0 {
+		return true
+	}
+	for _, p := range s.Providers {
+		if p == provider || (p == ProviderOAuth2 && isOAuth2) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsAuthTime reports whether a sign-in at authTime is recent enough
+func (s *StepUp) AcceptsAuthTime(authTime, now time.Time) bool {
+	return s.MaxAuthAge == 0 || now.Sub(authTime) <= s.MaxAuthAge
+}
+
+// AcceptsGroups reports whether a member of groups meets the group requirement (case-insensitive)
+func (s *StepUp) AcceptsGroups(groups []string) bool {
+	return len(s.Groups) == 0 || containsAnyFold(s.Groups, groups)
+}
+
+// AcceptsRoles reports whether a user with roles meets the role requirement (case-insensitive)
+func (s *StepUp) AcceptsRoles(roles []string) bool {
+	return len(s.Roles) == 0 || containsAnyFold(s.Roles, roles)
+}
+
+// AcceptsUser reports whether the user meets the expression requirement
+// Expressions failing to evaluate (e.g., on a missing extra key) are not met
+func (s *StepUp) AcceptsUser(vars expr.Vars) bool {
+	if s.Require == nil {
+		return true
+	}
+	ok, err := s.Require.Eval(vars)
+	return err == nil && ok
+}
+
+// AcceptsScript reports whether the policy script allows the request, with the reason it returned
+// Scripts failing to run (e.g., on a timeout) do not allow it, and return the error as the reason
+func (s *StepUp) AcceptsScript(ctx context.Context, vars expr.Vars) (bool, string) {
+	if s.Script == nil {
+		return true, ""
+	}
+	ok, reason, err := s.Script.Eval(ctx, vars)
+	if err != nil {
+		return false, err.Error()
+	}
+	return ok, reason
+}
+
+// containsAnyFold reports whether any of values is in required, ignoring case
+func containsAnyFold(required, values []string) bool {
+	for _, r := range required {
+		for _, v := range values {
+			if strings.EqualFold(r, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
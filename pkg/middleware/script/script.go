@@ -0,0 +1,199 @@
+// Package script evaluates Lua access policies against the signed-in user and the request.
+//
+// A policy is a Lua chunk run for every request of its rule. It sees the globals user (email,
+// username, provider, groups, roles and the provider data extra) and request (method, path, host
+// and headers with lower-case names), the same variables as expressions, and returns true to allow
+// the request. Returning false or nothing denies it; a second return value is logged as the reason:
+//
+//	if request.method ~= "GET" and not user.roles_set["editor"] then
+//	  return false, "read-only user"
+//	end
+//	return true
+//
+// Scripts run in a sandbox: only the base (without file loading and printing), string, table and math
+// libraries are available, every run starts from fresh globals, and runs are stopped after a timeout.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// ErrScriptInvalid is returned when a script cannot be read or does not compile
+var ErrScriptInvalid = errors.New("invalid script")
+
+// evalTimeout is the time a policy has to return
+const evalTimeout = 100 * time.Millisecond
+
+// unsafeBaseFunctions are the base library functions removed from the sandbox:
+// they load code or files, print to stdout or reach outside the run's globals
+var unsafeBaseFunctions = []string{
+	"collectgarbage", "dofile", "getfenv", "setfenv", "load", "loadfile", "loadstring",
+	"module", "newproxy", "print", "require", "_printregs",
+}
+
+// Policy is a compiled policy script
+type Policy struct {
+	name  string
+	proto *lua.FunctionProto
+}
+
+// Load reads and compiles the policy script at path
+func Load(path string) (*Policy, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptInvalid, err)
+	}
+	return Compile(path, string(source))
+}
+
+// Compile compiles a policy script; name identifies it in errors and logs
+func Compile(name, source string) (*Policy, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptInvalid, err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptInvalid, err)
+	}
+	return &Policy{name: name, proto: proto}, nil
+}
+
+// String returns the name of the policy (its path for loaded scripts)
+func (p *Policy) String() string {
+	return p.name
+}
+
+// Eval runs the policy and reports whether it allows the request, with the reason it returned
+// Runs failing, raising an error or exceeding the timeout return false with the error.
+func (p *Policy) Eval(ctx context.Context, vars expr.Vars) (bool, string, error) {
+	L := newSandbox()
+	defer L.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, evalTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+
+	L.SetGlobal("user", userTable(L, vars))
+	L.SetGlobal("request", requestTable(L, vars))
+
+	L.Push(L.NewFunctionFromProto(p.proto))
+	if err := L.PCall(0, 2, nil); err != nil {
+		return false, "", fmt.Errorf("script %s: %w", p.name, err)
+	}
+	allowed, reason := L.Get(-2), L.Get(-1)
+	if reason.Type() == lua.LTNil {
+		return lua.LVAsBool(allowed), "", nil
+	}
+	return lua.LVAsBool(allowed), reason.String(), nil
+}
+
+// newSandbox returns a Lua state with the safe libraries only
+func newSandbox() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 64, RegistrySize: 1024, RegistryMaxSize: 64 * 1024})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeBaseFunctions {
+		L.SetGlobal(name, lua.LNil)
+	}
+	return L
+}
+
+// userTable returns the user global
+// Groups and roles are lists, with groups_set and roles_set mapping each of them to true for lookups.
+func userTable(L *lua.LState, vars expr.Vars) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("email", lua.LString(vars.Email))
+	t.RawSetString("username", lua.LString(vars.Username))
+	t.RawSetString("provider", lua.LString(vars.Provider))
+	t.RawSetString("groups", listTable(L, vars.Groups))
+	t.RawSetString("groups_set", setTable(L, vars.Groups))
+	t.RawSetString("roles", listTable(L, vars.Roles))
+	t.RawSetString("roles_set", setTable(L, vars.Roles))
+	t.RawSetString("extra", toLua(L, vars.Extra))
+	return t
+}
+
+// requestTable returns the request global
+func requestTable(L *lua.LState, vars expr.Vars) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("method", lua.LString(vars.Method))
+	t.RawSetString("path", lua.LString(vars.Path))
+	t.RawSetString("host", lua.LString(vars.Host))
+	headers := L.NewTable()
+	for name, value := range vars.Headers {
+		headers.RawSetString(name, lua.LString(value))
+	}
+	t.RawSetString("headers", headers)
+	return t
+}
+
+func listTable(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+func setTable(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(0, len(values))
+	for _, v := range values {
+		t.RawSetString(v, lua.LTrue)
+	}
+	return t
+}
+
+// toLua converts provider data (decoded JSON) to Lua values; other types become their string form
+func toLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	case []string:
+		return listTable(L, v)
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for key, item := range v {
+			t.RawSetString(key, toLua(L, item))
+		}
+		return t
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,113 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/middleware/expr"
+)
+
+func testVars() expr.Vars {
+	req := httptest.NewRequest("POST", "https://chat.example.com/projects/alpha", nil)
+	req.Header.Set("X-Client", "web")
+	return expr.NewUserVars("Alice", "alice@example.com", "google", map[string]interface{}{
+		"groups": "admins,project-alpha",
+		"roles":  []interface{}{"editor"},
+		"org":    map[string]interface{}{"department": "Sales"},
+	}).WithRequest(req)
+}
+
+func TestPolicy_Eval(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		want       bool
+		wantReason string
+	}{
+		{"user fields", `return user.email == "alice@example.com" and user.provider == "google"`, true, ""},
+		{"request fields", `return request.method == "POST" and request.host == "chat.example.com" and request.headers["x-client"] == "web"`, true, ""},
+		{"group lookup", `return user.groups_set["admins"] == true and user.roles[1] == "editor"`, true, ""},
+		{"provider data", `return user.extra.org.department == "Sales"`, true, ""},
+		{"loop over groups", `
+local project = request.path:match("^/projects/([^/]+)")
+for _, group in ipairs(user.groups) do
+  if group == "project-" .. project then return true end
+end
+return false, "not a member"`, true, ""},
+		{"denial with a reason", `return false, "read-only user"`, false, "read-only user"},
+		{"no return value", `local x = 1`, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Compile(tt.name, tt.source)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, reason, err := policy.Eval(context.Background(), testVars())
+			if err != nil || got != tt.want || reason != tt.wantReason {
+				t.Errorf("Eval() = %v, %q, %v, want %v, %q", got, reason, err, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPolicy_Sandbox(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"no os library", `return os.getenv("HOME") ~= nil`},
+		{"no io library", `return io.open("/etc/passwd") ~= nil`},
+		{"no file loading", `dofile("/etc/passwd") return true`},
+		{"no code loading", `return loadstring("return true")()`},
+		{"runtime error", `error("boom")`},
+		{"endless loop", `while true do end`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Compile(tt.name, tt.source)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if got, _, err := policy.Eval(context.Background(), testVars()); got || err == nil {
+				t.Errorf("Eval() = %v, %v, want false with an error", got, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_FreshGlobals(t *testing.T) {
+	policy, err := Compile("counter", `counter = (counter or 0) + 1 return counter == 1`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if got, _, err := policy.Eval(context.Background(), testVars()); !got || err != nil {
+			t.Errorf("Eval() run %d = %v, %v, want globals of a previous run to be gone", i+1, got, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.lua")
+	if err := os.WriteFile(path, []byte(`return true`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := Load(path)
+	if err != nil || policy.String() != path {
+		t.Fatalf("Load() = %v, %v, want the policy named by its path", policy, err)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.lua")); !errors.Is(err, ErrScriptInvalid) {
+		t.Errorf("Load(missing) error = %v, want %v", err, ErrScriptInvalid)
+	}
+	if _, err := Compile("broken", `return (`); !errors.Is(err, ErrScriptInvalid) {
+		t.Errorf("Compile(broken) error = %v, want %v", err, ErrScriptInvalid)
+	}
+}
@@ -13,6 +13,11 @@ import (
 // Get retrieves a session from KVS by ID.
 // Returns ErrSessionNotFound if the session doesn't exist or has expired.
 func Get(store kvs.Store, id string) (*Session, error) {
+	return GetAt(store, id, time.Now())
+}
+
+// GetAt is like Get, checking expiry at the given time instead of the system clock.
+func GetAt(store kvs.Store, id string, now time.Time) (*Session, error) {
 	ctx := context.Background()
 
 	data, err := store.Get(ctx, id)
@@ -29,7 +34,7 @@ func Get(store kvs.Store, id string) (*Session, error) {
 	}
 
 	// Check if session is valid
-	if !session.IsValid() {
+	if !session.IsValidAt(now) {
 		// Delete expired session asynchronously
 		go func() { _ = Delete(store, id) }()
 		return nil, ErrSessionNotFound
@@ -41,10 +46,15 @@ func Get(store kvs.Store, id string) (*Session, error) {
 // Set stores a session in KVS with the given ID.
 // The session's ExpiresAt field is used to calculate the TTL.
 func Set(store kvs.Store, id string, session *Session) error {
+	return SetAt(store, id, session, time.Now())
+}
+
+// SetAt is like Set, calculating the TTL from the given time instead of the system clock.
+func SetAt(store kvs.Store, id string, session *Session, now time.Time) error {
 	ctx := context.Background()
 
 	// Calculate TTL until expiration
-	ttl := time.Until(session.ExpiresAt)
+	ttl := session.ExpiresAt.Sub(now)
 	if ttl <= 0 {
 		return errors.New("session: session already expired")
 	}
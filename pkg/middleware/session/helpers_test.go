@@ -132,6 +132,37 @@ func TestHelpers_GetExpiredSession(t *testing.T) {
 	}
 }
 
+func TestHelpers_GetAt(t *testing.T) {
+	store, err := kvs.NewMemoryStore("test-get-at", kvs.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create memory store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Now()
+	session := &Session{
+		ID:            "clock-session",
+		Email:         "user@example.com",
+		Provider:      "google",
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Hour),
+		Authenticated: true,
+	}
+	if err := SetAt(store, session.ID, session, now); err != nil {
+		t.Fatalf("SetAt() error = %v", err)
+	}
+
+	if _, err := GetAt(store, session.ID, now.Add(59*time.Minute)); err != nil {
+		t.Errorf("GetAt() before expiry error = %v", err)
+	}
+	if _, err := GetAt(store, session.ID, now.Add(61*time.Minute)); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetAt() after expiry error = %v, want ErrSessionNotFound", err)
+	}
+	if err := SetAt(store, session.ID, session, now.Add(2*time.Hour)); err == nil {
+		t.Error("SetAt() after expiry should fail")
+	}
+}
+
 func TestHelpers_Delete(t *testing.T) {
 	store, err := kvs.NewMemoryStore("test-delete", kvs.MemoryConfig{})
 	if err != nil {
@@ -19,6 +19,11 @@ type Session struct {
 	Name          string                 // User's display name from OAuth2 provider
 	Provider      string                 // OAuth2 provider name or "email" for email auth
 	Extra         map[string]interface{} // Additional user data from OAuth2 provider (for custom forwarding)
+	Subject       string                 `json:",omitempty"` // "sub" of the OIDC provider, matched by back-channel logout
+	ProviderSID   string                 `json:",omitempty"` // "sid" of the OIDC provider session, matched by back-channel logout
+	Metadata      map[string]string      `json:",omitempty"` // Key-value data written by upstream apps via the metadata API
+	Requests      int                    `json:",omitempty"` // Requests counted against the guest quota (guest sessions only)
+	ProviderToken string                 `json:",omitempty"` // Encrypted OAuth2 provider token, for the provider token endpoint (provider_tokens.enabled)
 	CreatedAt     time.Time
 	ExpiresAt     time.Time
 	Authenticated bool
@@ -26,10 +31,15 @@ type Session struct {
 
 // IsValid checks if the session is still valid
 func (s *Session) IsValid() bool {
+	return s.IsValidAt(time.Now())
+}
+
+// IsValidAt checks if the session is valid at the given time (for callers with a clock.Clock)
+func (s *Session) IsValidAt(now time.Time) bool {
 	if !s.Authenticated {
 		return false
 	}
-	return time.Now().Before(s.ExpiresAt)
+	return now.Before(s.ExpiresAt)
 }
 
 // Store is an alias for kvs.Store for backward compatibility
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+)
+
+// Canary errors
+var (
+	// ErrCanaryURLRequired is returned when a canary has no upstream URL
+	ErrCanaryURLRequired = errors.New("canary.url is required")
+
+	// ErrCanaryWeightInvalid is returned when the canary weight is not in [0, 100]
+	ErrCanaryWeightInvalid = errors.New("canary.weight must be between 0 and 100")
+
+	// ErrCanaryCookieNameInvalid is returned when the canary cookie name contains characters not allowed in cookie names
+	ErrCanaryCookieNameInvalid = errors.New("canary.cookie_name must only contain characters allowed in cookie names")
+)
+
+// DefaultCanaryCookieName is the cookie storing the routing bucket of a browser (see CanaryConfig)
+const DefaultCanaryCookieName = "_chatbotgate_canary"
+
+// canaryBuckets is the number of routing buckets; a bucket below the weight is routed to the canary
+const canaryBuckets = 100
+
+// CanaryConfig represents the routing of a share of the sessions to a canary upstream, e.g. a new version
+// of the chatbot backend. Each browser is assigned a random bucket (0-99), kept in a cookie, and is routed
+// to the canary while its bucket is below the weight: the assignment is sticky, raising the weight keeps
+// the sessions already on the canary there, and a weight of 0 routes every session back to the upstream.
+// The canary receives the same headers as the upstream (secret, identity headers, host and cookie settings).
+type CanaryConfig struct {
+	URL        string     `yaml:"url" json:"url"`                 // Canary upstream URL (required)
+	Weight     int        `yaml:"weight" json:"weight"`           // Percentage of sessions routed to the canary, 0 to 100 (e.g., 10 for a 90/10 split)
+	CookieName string     `yaml:"cookie_name" json:"cookie_name"` // Cookie storing the bucket of a browser (default: "_chatbotgate_canary")
+	TLS        *TLSConfig `yaml:"tls" json:"tls"`                 // TLS settings of an https canary (optional, defaults to the upstream's)
+}
+
+// Validate checks the canary settings
+func (c CanaryConfig) Validate() error {
+	if c.URL == "" {
+		return ErrCanaryURLRequired
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return err
+	}
+	if c.Weight < 0 || c.Weight > canaryBuckets {
+		return ErrCanaryWeightInvalid
+	}
+	if !validTokenChars(c.CookieName) {
+		return ErrCanaryCookieNameInvalid
+	}
+	return nil
+}
+
+// CanaryCookieConfig holds the attributes of the bucket cookie of a canary, which the server takes from
+// the session cookie settings, so the bucket follows the sessions it routes
+type CanaryCookieConfig struct {
+	Path   string // Cookie path (default: "/")
+	Domain string // Cookie domain (default: host-only)
+	Secure bool   // Secure attribute
+}
+
+// canary routes a share of the sessions to the canary upstream
+type canary struct {
+	upstream   *url.URL
+	proxy      *httputil.ReverseProxy
+	weight     int
+	cookieName string
+	cookie     CanaryCookieConfig
+	bucket     func() int // Returns the bucket of a new browser, in [0, canaryBuckets)
+}
+
+// newCanary creates the canary of an upstream, with its settings (upstreamConfig) except the URL and TLS
+func newCanary(cfg CanaryConfig, upstreamConfig UpstreamConfig, cookies CookieConfig, filter *headerFilter) (*canary, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	upstream, _ := url.Parse(cfg.URL)
+
+	tlsConfig := upstreamConfig.TLS
+	if cfg.TLS != nil {
+		tlsConfig = cfg.TLS
+	}
+	transport, err := newTransport(tlsConfig, upstreamConfig.Transport)
+	if err != nil {
+		return nil, err
+	}
+	proxy := createReverseProxy(upstream, upstreamConfig.Secret, upstreamConfig.HostConfig, cookies, filter)
+	proxy.Transport = transport
+
+	cookieName := cfg.CookieName
+	if cookieName == "" {
+		cookieName = DefaultCanaryCookieName
+	}
+	return &canary{
+		upstream:   upstream,
+		proxy:      proxy,
+		weight:     cfg.Weight,
+		cookieName: cookieName,
+		cookie:     CanaryCookieConfig{Path: "/"},
+		bucket:     func() int { return rand.IntN(canaryBuckets) },
+	}, nil
+}
+
+// route returns whether the request goes to the canary, assigning a bucket to browsers without one
+func (c *canary) route(w http.ResponseWriter, r *http.Request) bool {
+	if cookie, err := r.Cookie(c.cookieName); err == nil {
+		if bucket, err := strconv.Atoi(cookie.Value); err == nil && bucket >= 0 && bucket < canaryBuckets {
+			return bucket < c.weight
+		}
+	}
+
+	bucket := c.bucket()
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cookieName,
+		Value:    strconv.Itoa(bucket),
+		Path:     c.cookie.Path,
+		Domain:   c.cookie.Domain,
+		HttpOnly: true,
+		Secure:   c.cookie.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return bucket < c.weight
+}
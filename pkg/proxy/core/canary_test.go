@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newNamedUpstream returns an upstream answering with its name and the secret header it received
+func newNamedUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name + ":" + r.Header.Get("X-Secret")))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestHandler_Canary(t *testing.T) {
+	stable := newNamedUpstream(t, "stable")
+	next := newNamedUpstream(t, "canary")
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    stable.URL,
+		Secret: SecretConfig{Header: "X-Secret", Value: "s3cret"},
+		Canary: &CanaryConfig{URL: next.URL, Weight: 30},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	handler.canary.bucket = func() int { return 29 }
+
+	tests := []struct {
+		name       string
+		cookie     string
+		want       string
+		wantCookie string
+	}{
+		{"new browser in the canary share", "", "canary:s3cret", "_chatbotgate_canary=29"},
+		{"assigned to the upstream", "50", "stable:s3cret", ""},
+		{"assigned to the canary", "0", "canary:s3cret", ""},
+		{"first bucket of the upstream", "30", "stable:s3cret", ""},
+		{"invalid bucket", "100", "canary:s3cret", "_chatbotgate_canary=29"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultCanaryCookieName, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+			var gotCookie string
+			if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+				gotCookie = cookies[0].Name + "=" + cookies[0].Value
+			}
+			if gotCookie != tt.wantCookie {
+				t.Errorf("Set-Cookie = %q, want %q", gotCookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestHandler_CanaryRollback(t *testing.T) {
+	stable := newNamedUpstream(t, "stable")
+	next := newNamedUpstream(t, "canary")
+
+	// A weight of 0 routes browsers assigned to the canary back to the upstream
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    stable.URL,
+		Canary: &CanaryConfig{URL: next.URL, Weight: 0, CookieName: "bucket"},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "bucket", Value: "0"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "stable:" {
+		t.Errorf("response = %q, want the upstream", got)
+	}
+
+	// The readiness check ignores the canary, so its outage does not fail the whole gate
+	next.Close()
+	if err := handler.CheckUpstream(context.Background()); err != nil {
+		t.Errorf("CheckUpstream() error = %v, want nil while the canary is down", err)
+	}
+	stable.Close()
+	if err := handler.CheckUpstream(context.Background()); err == nil {
+		t.Error("CheckUpstream() should fail when the upstream is down")
+	}
+}
+
+func TestHandler_CanaryCookie(t *testing.T) {
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    newNamedUpstream(t, "stable").URL,
+		Canary: &CanaryConfig{URL: newNamedUpstream(t, "canary").URL, Weight: 50},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	// The client's X-Forwarded-Proto does not decide the Secure attribute
+	serve := func() *http.Cookie {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Result().Cookies()[0]
+	}
+	if cookie := serve(); cookie.Path != "/" || cookie.Domain != "" || cookie.Secure {
+		t.Errorf("default cookie = %+v, want path / without domain nor Secure", cookie)
+	}
+
+	handler.SetCanaryCookie(CanaryCookieConfig{Path: "/bot", Domain: "example.com", Secure: true})
+	if cookie := serve(); cookie.Path != "/bot" || cookie.Domain != "example.com" || !cookie.Secure {
+		t.Errorf("cookie = %+v, want the configured attributes", cookie)
+	}
+}
+
+func TestCanaryConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CanaryConfig
+		wantErr error
+	}{
+		{"valid", CanaryConfig{URL: "http://next:8080", Weight: 10}, nil},
+		{"rolled back", CanaryConfig{URL: "http://next:8080"}, nil},
+		{"all sessions", CanaryConfig{URL: "http://next:8080", Weight: 100, CookieName: "canary"}, nil},
+		{"no url", CanaryConfig{Weight: 10}, ErrCanaryURLRequired},
+		{"negative weight", CanaryConfig{URL: "http://next:8080", Weight: -1}, ErrCanaryWeightInvalid},
+		{"weight over 100", CanaryConfig{URL: "http://next:8080", Weight: 101}, ErrCanaryWeightInvalid},
+		{"invalid cookie name", CanaryConfig{URL: "http://next:8080", Weight: 10, CookieName: "my canary"}, ErrCanaryCookieNameInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,8 +2,19 @@ package proxy
 
 // UpstreamConfig represents upstream server configuration with optional secret header
 type UpstreamConfig struct {
-	URL    string       `yaml:"url" json:"url"`       // Upstream URL (required)
-	Secret SecretConfig `yaml:"secret" json:"secret"` // Secret header configuration (optional)
+	URL       string           `yaml:"url" json:"url"`             // Upstream URL (required)
+	Secret    SecretConfig     `yaml:"secret" json:"secret"`       // Secret header configuration (optional)
+	TLS       *TLSConfig       `yaml:"tls" json:"tls"`             // TLS settings of https upstreams (optional, replaces proxy.tls for this upstream)
+	Transport *TransportConfig `yaml:"transport" json:"transport"` // Connection pool settings (optional, replaces proxy.transport for this upstream)
+	Cookies   *CookieConfig    `yaml:"cookies" json:"cookies"`     // Cookie isolation (optional, replaces proxy.cookies for this upstream)
+	Mirror    *MirrorConfig    `yaml:"mirror" json:"mirror"`       // Copies of a share of the requests sent to a shadow upstream (optional)
+	Canary    *CanaryConfig    `yaml:"canary" json:"canary"`       // Share of the sessions routed to a canary upstream (optional)
+
+	// Host header and response rewriting (optional, replaces the settings of the proxy section for this upstream)
+	HostConfig `yaml:",inline"`
+
+	// Request header filtering (optional, replaces the settings of the proxy section for this upstream)
+	HeaderFilterConfig `yaml:",inline"`
 }
 
 // SecretConfig represents secret header configuration for upstream authentication
@@ -11,3 +22,30 @@ type SecretConfig struct {
 	Header string `yaml:"header" json:"header"` // HTTP header name (e.g., "X-Chatbotgate-Secret")
 	Value  string `yaml:"value" json:"value"`   // Secret value to send
 }
+
+// TLSConfig represents TLS settings for connections to https upstreams
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file" json:"ca_file"`                           // PEM CA bundle trusted in addition to the system roots (private PKI)
+	CertFile           string `yaml:"cert_file" json:"cert_file"`                       // Client certificate for mutual TLS (requires key_file)
+	KeyFile            string `yaml:"key_file" json:"key_file"`                         // Private key of the client certificate
+	MinVersion         string `yaml:"min_version" json:"min_version"`                   // Minimum TLS version: "1.2" (default) or "1.3"
+	ServerName         string `yaml:"server_name" json:"server_name"`                   // Expected server name when it differs from the upstream host
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"` // Skip certificate verification (development only)
+}
+
+// TransportConfig represents the connection pool and timeout settings of upstream connections
+// Empty values use the defaults noted on the fields, which keep more idle connections to the upstream than
+// http.DefaultTransport (2 per host) so that concurrent chat streams reuse connections.
+// Durations are strings like "90s"; "0" disables the timeout.
+type TransportConfig struct {
+	MaxIdleConns          int    `yaml:"max_idle_conns" json:"max_idle_conns"`                   // Idle connections kept across upstream hosts (default: 256)
+	MaxIdleConnsPerHost   int    `yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"` // Idle connections kept per upstream host (default: 128)
+	MaxConnsPerHost       int    `yaml:"max_conns_per_host" json:"max_conns_per_host"`           // Connections per upstream host, including active ones (default: 0, no limit)
+	IdleConnTimeout       string `yaml:"idle_conn_timeout" json:"idle_conn_timeout"`             // How long an idle connection is kept (default: "90s")
+	DialTimeout           string `yaml:"dial_timeout" json:"dial_timeout"`                       // Timeout of establishing a TCP connection (default: "30s")
+	KeepAlive             string `yaml:"keep_alive" json:"keep_alive"`                           // TCP keep-alive probe interval (default: "30s")
+	TLSHandshakeTimeout   string `yaml:"tls_handshake_timeout" json:"tls_handshake_timeout"`     // Timeout of the TLS handshake (default: "10s")
+	ResponseHeaderTimeout string `yaml:"response_header_timeout" json:"response_header_timeout"` // Timeout until the upstream sends response headers (default: none; streams are not affected once started)
+	DisableKeepAlives     bool   `yaml:"disable_keep_alives" json:"disable_keep_alives"`         // Use a new connection for every request
+	DisableCompression    bool   `yaml:"disable_compression" json:"disable_compression"`         // Do not request gzip from the upstream (pass the client's Accept-Encoding through)
+}
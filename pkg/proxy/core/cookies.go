@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrCookiePrefixInvalid is returned when the cookie prefix contains characters not allowed in cookie names
+var ErrCookiePrefixInvalid = errors.New("cookies.prefix must only contain characters allowed in cookie names")
+
+// CookieConfig represents the isolation of the cookies set by an upstream
+// With a prefix, the upstream's cookies are stored in the browser under prefixed names, so they cannot
+// collide with the session cookie of ChatbotGate or with the cookies of other upstreams on the same domain.
+type CookieConfig struct {
+	Prefix string `yaml:"prefix" json:"prefix"` // Prefix added to the names of upstream cookies (e.g., "app_"); only cookies with it are sent to the upstream, without it
+}
+
+// Validate checks the cookie settings
+func (c CookieConfig) Validate() error {
+	if !validTokenChars(c.Prefix) {
+		return ErrCookiePrefixInvalid
+	}
+	return nil
+}
+
+// validTokenChars reports whether s only contains characters allowed in HTTP tokens (cookie and header names)
+func validTokenChars(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, r)
+	})
+}
+
+// cookieNamePrefixes are the name prefixes browsers give a special meaning; they stay in front of the prefix
+var cookieNamePrefixes = []string{"__Host-", "__Secure-"}
+
+// prefixCookieName returns the name the browser stores an upstream cookie under
+func (c CookieConfig) prefixCookieName(name string) string {
+	for _, special := range cookieNamePrefixes {
+		if rest, ok := strings.CutPrefix(name, special); ok {
+			return special + c.Prefix + rest
+		}
+	}
+	return c.Prefix + name
+}
+
+// unprefixCookieName returns the name the upstream set a browser cookie under, or false for other cookies
+func (c CookieConfig) unprefixCookieName(name string) (string, bool) {
+	for _, special := range cookieNamePrefixes {
+		if rest, ok := strings.CutPrefix(name, special); ok {
+			rest, ok = strings.CutPrefix(rest, c.Prefix)
+			return special + rest, ok
+		}
+	}
+	return strings.CutPrefix(name, c.Prefix)
+}
+
+// rewriteRequest keeps only the upstream's cookies in the Cookie header, under the names the upstream set
+// The session cookie of ChatbotGate and the cookies of other upstreams are not sent.
+func (c CookieConfig) rewriteRequest(req *http.Request) {
+	if c.Prefix == "" || len(req.Header["Cookie"]) == 0 {
+		return
+	}
+	var kept []string
+	for _, line := range req.Header["Cookie"] {
+		for _, pair := range strings.Split(line, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if name, ok := c.unprefixCookieName(name); ok && name != "" {
+				kept = append(kept, name+"="+value)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		req.Header.Del("Cookie")
+		return
+	}
+	req.Header.Set("Cookie", strings.Join(kept, "; "))
+}
+
+// rewriteResponse prefixes the names of the cookies set by the upstream
+func (c CookieConfig) rewriteResponse(resp *http.Response) {
+	if c.Prefix == "" {
+		return
+	}
+	cookies := resp.Header["Set-Cookie"]
+	for i, cookie := range cookies {
+		pair, attrs, _ := strings.Cut(cookie, ";")
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		cookies[i] = c.prefixCookieName(name) + "=" + value
+		if attrs != "" {
+			cookies[i] += ";" + attrs
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandler_CookiePrefix tests the isolation of upstream cookies with cookies.prefix
+func TestHandler_CookiePrefix(t *testing.T) {
+	var gotCookie string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotCookie = r.Header.Get("Cookie")
+		w.Header().Add("Set-Cookie", "sid=abc; Path=/; HttpOnly")
+		w.Header().Add("Set-Cookie", "__Host-csrf=xyz; Path=/; Secure")
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, Cookies: &CookieConfig{Prefix: "app_"}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", "_oauth2_proxy=session; app_sid=abc; other_lang=ja; __Host-app_csrf=xyz")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if gotCookie != "sid=abc; __Host-csrf=xyz" {
+		t.Errorf("Upstream Cookie = %q, want only the upstream's cookies without the prefix", gotCookie)
+	}
+	cookies := rec.Header().Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "app_sid=abc; Path=/; HttpOnly" || cookies[1] != "__Host-app_csrf=xyz; Path=/; Secure" {
+		t.Errorf("Set-Cookie = %q, want prefixed names", cookies)
+	}
+
+	// Without cookies of the upstream, no Cookie header is sent
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", "_oauth2_proxy=session")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotCookie != "" {
+		t.Errorf("Upstream Cookie = %q, want none", gotCookie)
+	}
+}
+
+// TestCookieConfig_Validate tests the allowed prefix characters
+func TestCookieConfig_Validate(t *testing.T) {
+	for prefix, wantErr := range map[string]bool{
+		"":      false,
+		"app_":  false,
+		"wiki-": false,
+		"app;":  true,
+		"a b":   true,
+		"app=":  true,
+		"アプリ_":  true,
+	} {
+		if err := (CookieConfig{Prefix: prefix}).Validate(); (err != nil) != wantErr {
+			t.Errorf("Validate(%q) error = %v, want error %v", prefix, err, wantErr)
+		}
+	}
+}
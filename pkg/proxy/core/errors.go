@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+)
+
+// ErrorHandlerFunc writes the response for a request that could not be proxied to the upstream
+// status is http.StatusGatewayTimeout for timeouts and http.StatusBadGateway otherwise
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// errorHandlerKey is the context key for the per-request ErrorHandlerFunc
+type errorHandlerKey struct{}
+
+// WithErrorHandler returns a copy of ctx that makes the proxy report upstream failures to fn
+// The middleware sets this before calling the proxy so failures are rendered as branded pages
+func WithErrorHandler(ctx context.Context, fn ErrorHandlerFunc) context.Context {
+	return context.WithValue(ctx, errorHandlerKey{}, fn)
+}
+
+// errorHandlerFromContext returns the ErrorHandlerFunc stored by WithErrorHandler, if any
+func errorHandlerFromContext(ctx context.Context) (ErrorHandlerFunc, bool) {
+	fn, ok := ctx.Value(errorHandlerKey{}).(ErrorHandlerFunc)
+	return fn, ok && fn != nil
+}
+
+// UpstreamErrorStatus maps an upstream failure to the status code returned to the client
+func UpstreamErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// handleProxyError is the httputil.ReverseProxy ErrorHandler
+func handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	// The client went away; nobody will see a page
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	status := UpstreamErrorStatus(err)
+	if fn, ok := errorHandlerFromContext(r.Context()); ok {
+		fn(w, r, status, err)
+		return
+	}
+
+	// Same behavior as the httputil.ReverseProxy default
+	log.Printf("http: proxy error: %v", err)
+	w.WriteHeader(status)
+}
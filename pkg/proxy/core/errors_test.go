@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// timeoutError is a net.Error that reports a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestUpstreamErrorStatus tests mapping upstream failures to 502/504
+func TestUpstreamErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Connection refused", errors.New("dial tcp: connection refused"), http.StatusBadGateway},
+		{"Deadline exceeded", fmt.Errorf("round trip: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"Network timeout", &net.OpError{Op: "read", Err: timeoutError{}}, http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UpstreamErrorStatus(tt.err); got != tt.want {
+				t.Errorf("UpstreamErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandler_ErrorHandler tests that upstream failures are reported to the context's ErrorHandlerFunc
+func TestHandler_ErrorHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	upstreamURL := "http://" + ln.Addr().String()
+	_ = ln.Close()
+
+	h, err := NewHandler(upstreamURL)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	t.Run("without error handler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadGateway)
+		}
+	})
+
+	t.Run("with error handler", func(t *testing.T) {
+		var gotStatus int
+		var gotErr error
+		fn := func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			gotStatus, gotErr = status, err
+			w.WriteHeader(http.StatusTeapot)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req = req.WithContext(WithErrorHandler(req.Context(), fn))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if gotStatus != http.StatusBadGateway || gotErr == nil {
+			t.Errorf("ErrorHandlerFunc got status %d, err %v", gotStatus, gotErr)
+		}
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("Status = %d, want the ErrorHandlerFunc's %d", rec.Code, http.StatusTeapot)
+		}
+	})
+}
@@ -1,12 +1,12 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +16,8 @@ type Handler struct {
 	upstream *url.URL
 	proxy    *httputil.ReverseProxy
 	secret   SecretConfig
+	mirror   *mirror // Shadow upstream receiving copies of the requests (nil without mirror)
+	canary   *canary // Upstream serving a share of the sessions (nil without canary)
 }
 
 // NewHandler creates a new proxy handler with a default upstream
@@ -35,17 +37,54 @@ func NewHandlerWithConfig(upstreamConfig UpstreamConfig) (*Handler, error) {
 		return nil, fmt.Errorf("invalid upstream URL: %w", err)
 	}
 
-	proxy := createReverseProxy(upstream, upstreamConfig.Secret)
+	transport, err := newTransport(upstreamConfig.TLS, upstreamConfig.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream TLS or transport settings: %w", err)
+	}
+
+	if err := upstreamConfig.HostConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid upstream host settings: %w", err)
+	}
+	if err := upstreamConfig.HeaderFilterConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid upstream header settings: %w", err)
+	}
+	filter := newHeaderFilter(upstreamConfig.HeaderFilterConfig)
+	var cookies CookieConfig
+	if upstreamConfig.Cookies != nil {
+		if err := upstreamConfig.Cookies.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid upstream cookie settings: %w", err)
+		}
+		cookies = *upstreamConfig.Cookies
+	}
+
+	var shadow *mirror
+	if upstreamConfig.Mirror != nil {
+		if shadow, err = newMirror(*upstreamConfig.Mirror); err != nil {
+			return nil, fmt.Errorf("invalid upstream mirror settings: %w", err)
+		}
+	}
+
+	var next *canary
+	if upstreamConfig.Canary != nil {
+		if next, err = newCanary(*upstreamConfig.Canary, upstreamConfig, cookies, filter); err != nil {
+			return nil, fmt.Errorf("invalid upstream canary settings: %w", err)
+		}
+	}
+
+	proxy := createReverseProxy(upstream, upstreamConfig.Secret, upstreamConfig.HostConfig, cookies, filter)
+	proxy.Transport = transport
 
 	return &Handler{
 		upstream: upstream,
 		proxy:    proxy,
 		secret:   upstreamConfig.Secret,
+		mirror:   shadow,
+		canary:   next,
 	}, nil
 }
 
 // createReverseProxy creates a reverse proxy with WebSocket, SSE, and streaming support
-func createReverseProxy(target *url.URL, secret SecretConfig) *httputil.ReverseProxy {
+func createReverseProxy(target *url.URL, secret SecretConfig, host HostConfig, cookies CookieConfig, filter *headerFilter) *httputil.ReverseProxy {
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
 	// Preserve the original Director
@@ -55,23 +94,24 @@ func createReverseProxy(target *url.URL, secret SecretConfig) *httputil.ReverseP
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 
+		// Remove the hop-by-hop headers of the client's connection, and the client's headers the upstream
+		// must not receive (allowed_request_headers, blocked_request_headers)
+		identity := identityHeadersFromContext(req.Context())
+		upgrade := upgradeType(req.Header)
+		removeHopHeaders(req.Header, identity)
+		filter.apply(req.Header, identity)
+
 		// Add secret header if configured
 		if secret.Header != "" && secret.Value != "" {
 			req.Header.Set(secret.Header, secret.Value)
 		}
 
 		// Add X-Forwarded-* headers for backend to know original request details
+		// X-Real-IP: Original client IP (X-Forwarded-For, the chain of proxies, is appended by the reverse proxy)
 		if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-			// X-Real-IP: Original client IP
 			if prior := req.Header.Get("X-Real-IP"); prior == "" {
 				req.Header.Set("X-Real-IP", clientIP)
 			}
-
-			// X-Forwarded-For: Chain of proxies
-			if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
-				clientIP = prior + ", " + clientIP
-			}
-			req.Header.Set("X-Forwarded-For", clientIP)
 		}
 
 		// X-Forwarded-Proto: Original protocol (http/https)
@@ -88,10 +128,21 @@ func createReverseProxy(target *url.URL, secret SecretConfig) *httputil.ReverseP
 			req.Header.Set("X-Forwarded-Host", req.Host)
 		}
 
-		// Preserve WebSocket upgrade headers
-		if strings.ToLower(req.Header.Get("Upgrade")) == "websocket" {
+		// Host: the client's host unless the upstream needs its own (preserve_host, override_host)
+		req.Host = host.upstreamHost(target, req.Host)
+
+		// Cookie: only the upstream's own cookies (cookies.prefix)
+		cookies.rewriteRequest(req)
+
+		// Preserve the upgrade headers of protocol upgrades (WebSocket)
+		if upgrade != "" {
 			req.Header.Set("Connection", "Upgrade")
-			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Upgrade", upgrade)
+		}
+
+		// Send the copy for the shadow upstream with the same headers (mirror)
+		if m, shadow, ok := mirrorFromContext(req.Context()); ok {
+			m.send(shadow, req.Header)
 		}
 	}
 
@@ -105,6 +156,20 @@ func createReverseProxy(target *url.URL, secret SecretConfig) *httputil.ReverseP
 	// by reusing byte slices between requests
 	proxy.BufferPool = newBufferPool()
 
+	// Map absolute URLs and cookie domains of the upstream host back to the public host (rewrite_location,
+	// rewrite_cookie_domain), prefix the upstream's cookies (cookies.prefix), then run the request's hook
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		host.rewriteResponse(target, resp)
+		cookies.rewriteResponse(resp)
+		if fn, ok := responseHookFromContext(resp.Request.Context()); ok {
+			return fn(resp)
+		}
+		return nil
+	}
+
+	// Report connection failures and timeouts through the request's ErrorHandlerFunc
+	proxy.ErrorHandler = handleProxyError
+
 	return proxy
 }
 
@@ -145,9 +210,61 @@ func (bp *bufferPool) Put(b []byte) {
 
 // ServeHTTP handles the proxy request
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.mirror != nil {
+		if shadow := h.mirror.capture(r); shadow != nil {
+			r = r.WithContext(withMirror(r.Context(), h.mirror, shadow))
+		}
+	}
+	if h.canary != nil && h.canary.route(w, r) {
+		h.canary.proxy.ServeHTTP(w, r)
+		return
+	}
 	h.proxy.ServeHTTP(w, r)
 }
 
+// SetCanaryCookie sets the attributes of the bucket cookie of the canary; it does nothing without canary
+// It must be called before the handler serves requests.
+func (h *Handler) SetCanaryCookie(cookie CanaryCookieConfig) {
+	if h.canary == nil {
+		return
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	h.canary.cookie = cookie
+}
+
+// CheckUpstream sends a HEAD request to the upstream for the readiness check
+// Returns an error when the upstream cannot be reached or answers as unavailable (502, 503, 504);
+// any other status, including 404 and 405, means the upstream is up. The canary is not probed: its
+// outage must not take the whole gate out of rotation, and is remedied by rolling it back (weight 0).
+func (h *Handler) CheckUpstream(ctx context.Context) error {
+	return h.checkTarget(ctx, h.upstream, h.proxy.Transport)
+}
+
+// checkTarget sends the HEAD request of CheckUpstream to one target
+func (h *Handler) checkTarget(ctx context.Context, target *url.URL, transport http.RoundTripper) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	if h.secret.Header != "" && h.secret.Value != "" {
+		req.Header.Set(h.secret.Header, h.secret.Value)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("upstream responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // AddAuthHeaders adds authentication headers to the request
 // Deprecated: Use the Forwarder from pkg/forwarding for more flexible header management
 func AddAuthHeaders(r *http.Request, email, provider string) {
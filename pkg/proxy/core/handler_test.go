@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandler_CheckUpstream tests the HEAD probe of the readiness check
+func TestHandler_CheckUpstream(t *testing.T) {
+	var status int
+	var gotMethod, gotSecret string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotSecret = r.Method, r.Header.Get("X-Secret")
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, Secret: SecretConfig{Header: "X-Secret", Value: "s3cret"}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		status  int
+		wantErr bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNotFound, false},
+		{http.StatusMethodNotAllowed, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+	} {
+		status = tt.status
+		if err := handler.CheckUpstream(context.Background()); (err != nil) != tt.wantErr {
+			t.Errorf("status %d: CheckUpstream() error = %v, want error %v", tt.status, err, tt.wantErr)
+		}
+	}
+	if gotMethod != http.MethodHead || gotSecret != "s3cret" {
+		t.Errorf("probe method = %q, secret = %q, want HEAD with the secret header", gotMethod, gotSecret)
+	}
+
+	upstream.Close()
+	if err := handler.CheckUpstream(context.Background()); err == nil {
+		t.Error("CheckUpstream() should fail when the upstream is down")
+	}
+}
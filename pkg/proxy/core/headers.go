@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrHeaderNameInvalid is returned when a header filter entry is not a header name or a "Prefix-*" pattern
+var ErrHeaderNameInvalid = errors.New("allowed_request_headers and blocked_request_headers must be header names, optionally ending with *")
+
+// defaultBlockedRequestHeaders are removed from every upstream request unless named in allowed_request_headers
+// They make frameworks route or authorize the request differently from what the gate checked: path and
+// method overrides, and the subrequest marker that bypasses Next.js middleware.
+var defaultBlockedRequestHeaders = []string{
+	"X-Original-URL",
+	"X-Rewrite-URL",
+	"X-HTTP-Method-Override",
+	"X-HTTP-Method",
+	"X-Method-Override",
+	"X-Middleware-Subrequest",
+}
+
+// defaultAllowedRequestHeaders are the headers of ordinary browser and API requests, which are sent to the
+// upstream in addition to allowed_request_headers when the allowlist is set
+var defaultAllowedRequestHeaders = []string{
+	"Accept*",
+	"Cache-Control",
+	"Content-*",
+	"Cookie",
+	"If-*",
+	"Origin",
+	"Pragma",
+	"Range",
+	"Referer",
+	"User-Agent",
+	"Connection", // WebSocket upgrades (other hop-by-hop headers are removed by the reverse proxy)
+	"Upgrade",
+	"Sec-WebSocket-*",
+	"X-Forwarded-*",
+	"X-Real-IP",
+	"X-Request-Id",
+	"Traceparent",
+	"Tracestate",
+}
+
+// HeaderFilterConfig represents the filtering of the client's request headers before they are sent to the
+// upstream, reducing the headers an attacker can smuggle to it. Headers set by the gate (identity headers,
+// secret, X-Forwarded-*) are always sent.
+// Entries are header names (case-insensitive) or prefixes ending with "*" (e.g., "X-Custom-*").
+type HeaderFilterConfig struct {
+	AllowedRequestHeaders []string `yaml:"allowed_request_headers" json:"allowed_request_headers"` // When set, only these headers and the usual ones (Accept*, Content-*, Cookie, ...) are sent
+	BlockedRequestHeaders []string `yaml:"blocked_request_headers" json:"blocked_request_headers"` // Headers never sent, in addition to the path and method overrides blocked by default
+}
+
+// IsZero reports whether no header filter setting is configured
+func (c HeaderFilterConfig) IsZero() bool {
+	return len(c.AllowedRequestHeaders) == 0 && len(c.BlockedRequestHeaders) == 0
+}
+
+// Validate checks the header filter settings
+func (c HeaderFilterConfig) Validate() error {
+	for _, entry := range append(append([]string{}, c.AllowedRequestHeaders...), c.BlockedRequestHeaders...) {
+		name := strings.TrimSuffix(entry, "*")
+		if name == "" || strings.Contains(name, "*") || !validTokenChars(name) {
+			return ErrHeaderNameInvalid
+		}
+	}
+	return nil
+}
+
+// headerPatterns matches header names against a list of names and "Prefix-*" patterns
+type headerPatterns struct {
+	names    map[string]bool // Canonical header keys
+	prefixes []string        // Lower-case prefixes
+}
+
+// newHeaderPatterns compiles the entries of a header list
+func newHeaderPatterns(entries ...[]string) headerPatterns {
+	p := headerPatterns{names: make(map[string]bool)}
+	for _, list := range entries {
+		for _, entry := range list {
+			if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+				p.prefixes = append(p.prefixes, strings.ToLower(prefix))
+			} else {
+				p.names[http.CanonicalHeaderKey(entry)] = true
+			}
+		}
+	}
+	return p
+}
+
+// match reports whether the canonical header key is in the list
+func (p headerPatterns) match(key string) bool {
+	if p.names[key] {
+		return true
+	}
+	for _, prefix := range p.prefixes {
+		if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerFilter removes the client's request headers that must not reach the upstream
+type headerFilter struct {
+	allowlist bool           // Whether allowed_request_headers is set
+	allowed   headerPatterns // Defaults and allowed_request_headers (only used with the allowlist)
+	explicit  headerPatterns // allowed_request_headers, which lifts the default blocks
+	blocked   headerPatterns // blocked_request_headers
+	defaults  headerPatterns // Headers blocked by default
+}
+
+// newHeaderFilter compiles the header filter settings
+func newHeaderFilter(c HeaderFilterConfig) *headerFilter {
+	return &headerFilter{
+		allowlist: len(c.AllowedRequestHeaders) > 0,
+		allowed:   newHeaderPatterns(defaultAllowedRequestHeaders, c.AllowedRequestHeaders),
+		explicit:  newHeaderPatterns(c.AllowedRequestHeaders),
+		blocked:   newHeaderPatterns(c.BlockedRequestHeaders),
+		defaults:  newHeaderPatterns(defaultBlockedRequestHeaders),
+	}
+}
+
+// apply removes the filtered headers of an upstream request, except the ones in keep (set by the gate)
+func (f *headerFilter) apply(header http.Header, keep *IdentityHeaders) {
+	for key := range header {
+		switch {
+		case keep.has(key):
+		case f.blocked.match(key),
+			f.defaults.match(key) && !f.explicit.match(key),
+			f.allowlist && !f.allowed.match(key):
+			delete(header, key)
+		}
+	}
+}
+
+// IdentityHeaders is a set of headers set by the middleware, which the request header filter keeps
+// The middleware creates it once per configuration, as it is passed with every proxied request.
+type IdentityHeaders struct {
+	keys map[string]bool // Canonical header keys
+}
+
+// NewIdentityHeaders creates the set of the named headers
+func NewIdentityHeaders(names ...string) *IdentityHeaders {
+	return (*IdentityHeaders)(nil).With(names...)
+}
+
+// With returns a copy of the set with the named headers added (h may be nil)
+func (h *IdentityHeaders) With(names ...string) *IdentityHeaders {
+	keys := make(map[string]bool)
+	if h != nil {
+		for key := range h.keys {
+			keys[key] = true
+		}
+	}
+	for _, name := range names {
+		keys[http.CanonicalHeaderKey(name)] = true
+	}
+	return &IdentityHeaders{keys: keys}
+}
+
+// has reports whether the canonical header key is in the set (h may be nil)
+func (h *IdentityHeaders) has(key string) bool {
+	return h != nil && h.keys[key]
+}
+
+// hopHeaders are the hop-by-hop headers, which only concern the connection they are sent on
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// removeHopHeaders removes the hop-by-hop headers, and those listed in Connection except the ones in keep
+// The reverse proxy also removes them, but after the director: a client could otherwise list the headers
+// the director sets (the secret, X-Forwarded-*) in Connection to have them removed.
+func removeHopHeaders(header http.Header, keep *IdentityHeaders) {
+	for _, line := range header["Connection"] {
+		for _, name := range strings.Split(line, ",") {
+			if key := http.CanonicalHeaderKey(strings.TrimSpace(name)); !keep.has(key) {
+				delete(header, key)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		delete(header, name)
+	}
+}
+
+// upgradeType returns the protocol a request upgrades to ("websocket"), or "" when it does not
+// Like the reverse proxy, a request only upgrades with "Upgrade" listed in its Connection header. Only
+// WebSocket upgrades are proxied: others, like h2c, would open a tunnel to the upstream whose requests
+// are never checked by the gate (h2c smuggling), so they are sent as plain requests.
+func upgradeType(header http.Header) string {
+	if upgrade := header.Get("Upgrade"); strings.EqualFold(upgrade, "websocket") {
+		for _, line := range header["Connection"] {
+			for _, token := range strings.Split(line, ",") {
+				if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+					return upgrade
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// appendForwardedFor appends the client address to X-Forwarded-For, as the reverse proxy does
+func appendForwardedFor(header http.Header, remoteAddr string) {
+	clientIP, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return
+	}
+	if prior := header.Values("X-Forwarded-For"); len(prior) > 0 {
+		clientIP = strings.Join(prior, ", ") + ", " + clientIP
+	}
+	header.Set("X-Forwarded-For", clientIP)
+}
+
+// identityHeadersKey is the context key for the IdentityHeaders of a request
+type identityHeadersKey struct{}
+
+// WithIdentityHeaders returns a copy of ctx that makes the header filter keep the headers of h
+// The middleware lists the headers it sets (identity headers, plugin headers, credentials), so that
+// allowed_request_headers and blocked_request_headers only apply to the headers of the client.
+func WithIdentityHeaders(ctx context.Context, h *IdentityHeaders) context.Context {
+	return context.WithValue(ctx, identityHeadersKey{}, h)
+}
+
+// identityHeadersFromContext returns the IdentityHeaders stored by WithIdentityHeaders, or nil
+func identityHeadersFromContext(ctx context.Context) *IdentityHeaders {
+	h, _ := ctx.Value(identityHeadersKey{}).(*IdentityHeaders)
+	return h
+}
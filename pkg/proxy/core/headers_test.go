@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_HeaderFilter(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+
+	clientHeaders := map[string]string{
+		"Accept":                  "text/html",
+		"Cookie":                  "sid=1",
+		"X-Custom-Tenant":         "a",
+		"X-Debug":                 "1",
+		"X-Email":                 "mallory@example.com",
+		"X-Original-URL":          "/admin",
+		"X-HTTP-Method-Override":  "DELETE",
+		"X-Middleware-Subrequest": "middleware",
+	}
+	tests := []struct {
+		name   string
+		filter HeaderFilterConfig
+		keep   *IdentityHeaders
+		want   []string // Client headers received by the upstream
+	}{
+		{
+			name: "defaults",
+			want: []string{"Accept", "Cookie", "X-Custom-Tenant", "X-Debug", "X-Email"},
+		},
+		{
+			name:   "allowlist",
+			filter: HeaderFilterConfig{AllowedRequestHeaders: []string{"x-custom-*"}},
+			want:   []string{"Accept", "Cookie", "X-Custom-Tenant"},
+		},
+		{
+			name:   "allowlist lifting a default block",
+			filter: HeaderFilterConfig{AllowedRequestHeaders: []string{"X-HTTP-Method-Override"}},
+			want:   []string{"Accept", "Cookie", "X-HTTP-Method-Override"},
+		},
+		{
+			name:   "blocklist",
+			filter: HeaderFilterConfig{BlockedRequestHeaders: []string{"X-Debug", "Cookie"}},
+			want:   []string{"Accept", "X-Custom-Tenant", "X-Email"},
+		},
+		{
+			name:   "blocked and allowed",
+			filter: HeaderFilterConfig{AllowedRequestHeaders: []string{"X-Custom-*"}, BlockedRequestHeaders: []string{"X-Custom-Tenant"}},
+			want:   []string{"Accept", "Cookie"},
+		},
+		{
+			name:   "headers set by the middleware",
+			filter: HeaderFilterConfig{AllowedRequestHeaders: []string{"X-Custom-*"}, BlockedRequestHeaders: []string{"X-Email"}},
+			keep:   NewIdentityHeaders("x-email"),
+			want:   []string{"Accept", "Cookie", "X-Custom-Tenant", "X-Email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := NewHandlerWithConfig(UpstreamConfig{
+				URL:                upstream.URL,
+				Secret:             SecretConfig{Header: "X-Secret", Value: "s3cret"},
+				HeaderFilterConfig: tt.filter,
+			})
+			if err != nil {
+				t.Fatalf("NewHandlerWithConfig() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range clientHeaders {
+				req.Header.Set(name, value)
+			}
+			if tt.keep != nil {
+				req = req.WithContext(WithIdentityHeaders(context.Background(), tt.keep))
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			want := make(map[string]bool)
+			for _, name := range tt.want {
+				want[name] = true
+			}
+			for name := range clientHeaders {
+				if (got.Get(name) != "") != want[name] {
+					t.Errorf("%s received = %v, want %v", name, got.Get(name) != "", want[name])
+				}
+			}
+			// Headers of the gate are never filtered
+			if got.Get("X-Secret") != "s3cret" || got.Get("X-Forwarded-For") == "" {
+				t.Errorf("upstream headers = %v, want the secret and X-Forwarded-For", got)
+			}
+		})
+	}
+}
+
+func TestHeaderFilterConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HeaderFilterConfig
+		wantErr error
+	}{
+		{"empty", HeaderFilterConfig{}, nil},
+		{"names and prefixes", HeaderFilterConfig{AllowedRequestHeaders: []string{"X-Client-Version", "X-Custom-*"}, BlockedRequestHeaders: []string{"X-Debug"}}, nil},
+		{"everything", HeaderFilterConfig{AllowedRequestHeaders: []string{"*"}}, ErrHeaderNameInvalid},
+		{"inner wildcard", HeaderFilterConfig{BlockedRequestHeaders: []string{"X-*-Debug"}}, ErrHeaderNameInvalid},
+		{"separator", HeaderFilterConfig{BlockedRequestHeaders: []string{"X-Debug: 1"}}, ErrHeaderNameInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
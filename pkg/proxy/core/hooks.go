@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+)
+
+// ResponseHookFunc modifies the upstream's response before it is sent to the client
+// Returning an error discards the response; the failure is reported like an unreachable upstream (502).
+type ResponseHookFunc func(resp *http.Response) error
+
+// responseHookKey is the context key for the per-request ResponseHookFunc
+type responseHookKey struct{}
+
+// WithResponseHook returns a copy of ctx that makes the proxy pass the upstream's response to fn
+// The middleware sets this before calling the proxy so that embedders' hooks see the user's session
+func WithResponseHook(ctx context.Context, fn ResponseHookFunc) context.Context {
+	return context.WithValue(ctx, responseHookKey{}, fn)
+}
+
+// responseHookFromContext returns the ResponseHookFunc stored by WithResponseHook, if any
+func responseHookFromContext(ctx context.Context) (ResponseHookFunc, bool) {
+	fn, ok := ctx.Value(responseHookKey{}).(ResponseHookFunc)
+	return fn, ok && fn != nil
+}
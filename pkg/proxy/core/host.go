@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrOverrideHostInvalid is returned when override_host is not a plain host[:port]
+var ErrOverrideHostInvalid = errors.New("override_host must be a host name with an optional port")
+
+// HostConfig represents the Host header sent to the upstream and the rewriting of upstream URLs in its responses
+// Upstreams behind a virtual host (Dify cloud, vhost-routed apps) need their own Host, and then often emit
+// absolute URLs and cookie domains of that host, which the rewrite options map back to the public host.
+type HostConfig struct {
+	PreserveHost        *bool  `yaml:"preserve_host" json:"preserve_host"`                 // Send the client's Host header (default: true); false sends the host of the upstream URL
+	OverrideHost        string `yaml:"override_host" json:"override_host"`                 // Host header sent to the upstream (takes precedence over preserve_host)
+	RewriteLocation     bool   `yaml:"rewrite_location" json:"rewrite_location"`           // Rewrite Location headers pointing at the upstream host to the public host
+	RewriteCookieDomain bool   `yaml:"rewrite_cookie_domain" json:"rewrite_cookie_domain"` // Drop the Domain of upstream cookies set for the upstream host, so they apply to the public host
+}
+
+// IsZero reports whether no host setting is configured
+func (c HostConfig) IsZero() bool {
+	return c.PreserveHost == nil && c.OverrideHost == "" && !c.RewriteLocation && !c.RewriteCookieDomain
+}
+
+// Validate checks the host settings
+func (c HostConfig) Validate() error {
+	if c.OverrideHost == "" {
+		return nil
+	}
+	if u, err := url.Parse("//" + c.OverrideHost); err != nil || u.Host != c.OverrideHost || u.Hostname() == "" {
+		return ErrOverrideHostInvalid
+	}
+	return nil
+}
+
+// upstreamHost returns the Host header sent to the upstream for a request to the public host
+func (c HostConfig) upstreamHost(target *url.URL, publicHost string) string {
+	switch {
+	case c.OverrideHost != "":
+		return c.OverrideHost
+	case c.PreserveHost != nil && !*c.PreserveHost:
+		return target.Host
+	default:
+		return publicHost
+	}
+}
+
+// rewriteResponse maps the URLs and cookie domains of the upstream's response back to the public host
+// Only URLs and cookies of the upstream URL's host and override_host are rewritten.
+// The public host and scheme are read from the X-Forwarded-Host and X-Forwarded-Proto headers of the
+// upstream request, and the path prefix from X-Forwarded-Prefix (set by the middleware for server.mount_path).
+func (c HostConfig) rewriteResponse(target *url.URL, resp *http.Response) {
+	if (!c.RewriteLocation && !c.RewriteCookieDomain) || resp.Request == nil {
+		return
+	}
+	internal := []string{target.Host, c.OverrideHost}
+	if c.RewriteLocation {
+		if location := resp.Header.Get("Location"); location != "" {
+			resp.Header.Set("Location", rewriteLocation(location, internal, resp.Request.Header))
+		}
+	}
+	if c.RewriteCookieDomain {
+		cookies := resp.Header["Set-Cookie"]
+		for i, cookie := range cookies {
+			cookies[i] = dropCookieDomain(cookie, internal)
+		}
+	}
+}
+
+// rewriteLocation maps an absolute URL on one of the internal hosts to the public scheme, host and path prefix
+func rewriteLocation(location string, internal []string, header http.Header) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" || !matchesHost(u.Host, internal) {
+		return location
+	}
+	publicHost := header.Get("X-Forwarded-Host")
+	if publicHost == "" {
+		return location
+	}
+	u.Host = publicHost
+	if proto := header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		u.Scheme = proto
+	}
+	if prefix := header.Get("X-Forwarded-Prefix"); prefix != "" && u.Path != prefix && !strings.HasPrefix(u.Path, prefix+"/") {
+		u.Path = prefix + u.Path
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// dropCookieDomain removes the Domain attribute of a Set-Cookie value when it names one of the internal hosts
+// The other attributes are kept as sent by the upstream.
+func dropCookieDomain(setCookie string, internal []string) string {
+	parts := strings.Split(setCookie, ";")
+	kept := []string{parts[0]}
+	for _, attr := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		if strings.EqualFold(name, "Domain") && matchesHost(strings.TrimPrefix(value, "."), internal) {
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	return strings.Join(kept, ";")
+}
+
+// matchesHost reports whether host equals one of the hosts, ignoring case and ports
+func matchesHost(host string, hosts []string) bool {
+	name := hostname(host)
+	for _, h := range hosts {
+		if h != "" && strings.EqualFold(name, hostname(h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostname returns the host without its port
+func hostname(host string) string {
+	return (&url.URL{Host: host}).Hostname()
+}
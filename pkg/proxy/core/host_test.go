@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandler_UpstreamHost tests the Host header sent to the upstream
+func TestHandler_UpstreamHost(t *testing.T) {
+	var gotHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+	}))
+	defer upstream.Close()
+	upstreamHost := upstream.Listener.Addr().String()
+
+	preserve := false
+	for _, tt := range []struct {
+		name string
+		host HostConfig
+		want string
+	}{
+		{"default preserves the client host", HostConfig{}, "chat.example.com"},
+		{"preserve_host false", HostConfig{PreserveHost: &preserve}, upstreamHost},
+		{"override_host", HostConfig{PreserveHost: &preserve, OverrideHost: "app.dify.ai"}, "app.dify.ai"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, HostConfig: tt.host})
+			if err != nil {
+				t.Fatalf("NewHandlerWithConfig() error = %v", err)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://chat.example.com/", nil))
+			if gotHost != tt.want {
+				t.Errorf("Upstream Host = %q, want %q", gotHost, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandler_ResponseRewriting tests rewriting Location headers and cookie domains of the upstream host
+func TestHandler_ResponseRewriting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "http://app.internal:8080/chat?id=1")
+		w.Header().Add("Set-Cookie", "sid=1; Path=/; Domain=app.internal; HttpOnly")
+		w.Header().Add("Set-Cookie", "lang=ja; Domain=.example.com")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, HostConfig: HostConfig{
+		OverrideHost:        "app.internal:8080",
+		RewriteLocation:     true,
+		RewriteCookieDomain: true,
+	}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://chat.example.com/chat", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Prefix", "/bot")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Location"); got != "https://chat.example.com/bot/chat?id=1" {
+		t.Errorf("Location = %q, want the public URL", got)
+	}
+	cookies := rec.Header().Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "sid=1; Path=/; HttpOnly" || cookies[1] != "lang=ja; Domain=.example.com" {
+		t.Errorf("Set-Cookie = %q, want the upstream domain dropped and others kept", cookies)
+	}
+}
+
+// TestRewriteLocation tests which Location headers are rewritten
+func TestRewriteLocation(t *testing.T) {
+	header := http.Header{"X-Forwarded-Host": {"chat.example.com"}, "X-Forwarded-Proto": {"https"}}
+	internal := []string{"app.internal:8080"}
+
+	for location, want := range map[string]string{
+		"http://app.internal:8080/login": "https://chat.example.com/login",
+		"http://APP.internal/login":      "https://chat.example.com/login",
+		"https://accounts.example.org/":  "https://accounts.example.org/",
+		"/login":                         "/login",
+	} {
+		if got := rewriteLocation(location, internal, header); got != want {
+			t.Errorf("rewriteLocation(%q) = %q, want %q", location, got, want)
+		}
+	}
+	if got := rewriteLocation("http://app.internal:8080/login", internal, http.Header{}); got != "http://app.internal:8080/login" {
+		t.Errorf("rewriteLocation() without X-Forwarded-Host = %q, want it unchanged", got)
+	}
+}
+
+// TestHostConfig_Validate tests the override_host format
+func TestHostConfig_Validate(t *testing.T) {
+	for host, wantErr := range map[string]bool{
+		"":                    false,
+		"app.dify.ai":         false,
+		"app.internal:8080":   false,
+		"https://app.dify.ai": true,
+		"app.dify.ai/":        true,
+		":8080":               true,
+		"app.dify.ai?x=1":     true,
+		"user@app.internal":   true,
+	} {
+		if err := (HostConfig{OverrideHost: host}).Validate(); (err != nil) != wantErr {
+			t.Errorf("Validate(%q) error = %v, want error %v", host, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Mirror errors
+var (
+	// ErrMirrorURLRequired is returned when a mirror has no shadow upstream URL
+	ErrMirrorURLRequired = errors.New("mirror.url is required")
+
+	// ErrMirrorPercentInvalid is returned when the mirrored share is not in (0, 100]
+	ErrMirrorPercentInvalid = errors.New("mirror.percent must be greater than 0 and at most 100")
+
+	// ErrMirrorNegative is returned when a size or count of MirrorConfig is negative
+	ErrMirrorNegative = errors.New("mirror.max_body_size and mirror.max_in_flight must not be negative")
+)
+
+// Mirror defaults (see MirrorConfig)
+const (
+	defaultMirrorMaxBodySize = 1 << 20 // 1 MiB
+	defaultMirrorMaxInFlight = 100
+	defaultMirrorTimeout     = 30 * time.Second
+)
+
+// MirrorHeader marks the requests sent to the shadow upstream, so that it can tell them from real traffic
+const MirrorHeader = "X-ChatbotGate-Mirror"
+
+// MirrorConfig represents the duplication of proxied requests to a shadow upstream, e.g. to load-test a
+// new chatbot backend with real traffic patterns. Copies are sent asynchronously with the headers of the
+// upstream request (identity headers and secret included); the shadow's responses and errors are ignored,
+// and never delay or change the response to the client.
+type MirrorConfig struct {
+	URL         string     `yaml:"url" json:"url"`                     // Shadow upstream URL (required)
+	Percent     float64    `yaml:"percent" json:"percent"`             // Share of requests mirrored, greater than 0 and at most 100 (required)
+	MaxBodySize int64      `yaml:"max_body_size" json:"max_body_size"` // Requests with larger bodies are not mirrored (default: 1048576, 1 MiB)
+	MaxInFlight int        `yaml:"max_in_flight" json:"max_in_flight"` // Mirrored requests in progress; more are dropped rather than queued (default: 100)
+	Timeout     string     `yaml:"timeout" json:"timeout"`             // Timeout of each mirrored request, including its response body (default: "30s")
+	TLS         *TLSConfig `yaml:"tls" json:"tls"`                     // TLS settings of an https shadow upstream (optional)
+}
+
+// Validate checks the mirror settings
+func (c MirrorConfig) Validate() error {
+	if c.URL == "" {
+		return ErrMirrorURLRequired
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return err
+	}
+	if c.Percent <= 0 || c.Percent > 100 {
+		return ErrMirrorPercentInvalid
+	}
+	if c.MaxBodySize < 0 || c.MaxInFlight < 0 {
+		return ErrMirrorNegative
+	}
+	_, err := transportDuration("timeout", c.Timeout, defaultMirrorTimeout)
+	return err
+}
+
+// mirror sends copies of proxied requests to the shadow upstream
+type mirror struct {
+	target      *url.URL
+	percent     float64
+	maxBodySize int64
+	timeout     time.Duration
+	inFlight    chan struct{} // Semaphore of the mirrored requests in progress
+	transport   http.RoundTripper
+	sample      func() float64 // Returns a number in [0, 100) deciding whether a request is mirrored
+}
+
+// newMirror creates the mirror of an upstream
+func newMirror(cfg MirrorConfig) (*mirror, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	target, _ := url.Parse(cfg.URL)
+	timeout, _ := transportDuration("timeout", cfg.Timeout, defaultMirrorTimeout)
+	transport, err := newTransport(cfg.TLS, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = defaultMirrorMaxBodySize
+	}
+	return &mirror{
+		target:      target,
+		percent:     cfg.Percent,
+		maxBodySize: maxBodySize,
+		timeout:     timeout,
+		inFlight:    make(chan struct{}, positiveOr(cfg.MaxInFlight, defaultMirrorMaxInFlight)),
+		transport:   transport,
+		sample:      func() float64 { return rand.Float64() * 100 },
+	}, nil
+}
+
+// capture returns the copy of req for the shadow upstream, sent once the director has prepared the
+// upstream request, or nil when req is not mirrored. The body is read ahead up to max_body_size and
+// given back to req. WebSocket upgrades are never mirrored.
+func (m *mirror) capture(req *http.Request) *http.Request {
+	if m.sample() >= m.percent || strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return nil
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength > m.maxBodySize {
+			return nil
+		}
+		buf, err := io.ReadAll(io.LimitReader(req.Body, m.maxBodySize+1))
+		if err != nil || int64(len(buf)) > m.maxBodySize {
+			// Give the upstream the whole body: what was read, then the rest
+			req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+			return nil
+		}
+		req.Body = readCloser{bytes.NewReader(buf), req.Body}
+		body = buf
+	}
+
+	shadow := req.Clone(context.Background())
+	shadow.Body = nil
+	shadow.ContentLength = 0
+	if body != nil {
+		shadow.Body = io.NopCloser(bytes.NewReader(body))
+		shadow.ContentLength = int64(len(body))
+	}
+	return shadow
+}
+
+// send sends the copy of a request to the shadow upstream in the background, with the headers of the
+// upstream request (header), unless max_in_flight copies are in progress
+func (m *mirror) send(shadow *http.Request, header http.Header) {
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		return // The shadow upstream is too slow: drop the copy rather than hold memory
+	}
+
+	shadow.Header = header.Clone()
+	removeHopHeaders(shadow.Header, nil)
+	appendForwardedFor(shadow.Header, shadow.RemoteAddr)
+	shadow.Header.Set(MirrorHeader, "1")
+	shadow.URL.Path, shadow.URL.RawPath = joinURLPath(m.target, shadow.URL)
+	if m.target.RawQuery != "" && shadow.URL.RawQuery != "" {
+		shadow.URL.RawQuery = m.target.RawQuery + "&" + shadow.URL.RawQuery
+	} else {
+		shadow.URL.RawQuery = m.target.RawQuery + shadow.URL.RawQuery
+	}
+	shadow.URL.Scheme = m.target.Scheme
+	shadow.URL.Host = m.target.Host
+	shadow.Host = m.target.Host
+	shadow.RequestURI = ""
+
+	go func() {
+		defer func() { <-m.inFlight }()
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+
+		resp, err := m.transport.RoundTrip(shadow.WithContext(ctx))
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+}
+
+// mirrorKey is the context key of the request copy for the shadow upstream
+type mirrorKey struct{}
+
+// mirrorRequest is the request copy of a proxied request, with its mirror
+type mirrorRequest struct {
+	mirror *mirror
+	shadow *http.Request
+}
+
+// withMirror returns a copy of ctx that makes the director send shadow to the mirror
+func withMirror(ctx context.Context, m *mirror, shadow *http.Request) context.Context {
+	return context.WithValue(ctx, mirrorKey{}, mirrorRequest{mirror: m, shadow: shadow})
+}
+
+// mirrorFromContext returns the request copy stored by withMirror, if any
+func mirrorFromContext(ctx context.Context) (*mirror, *http.Request, bool) {
+	mr, ok := ctx.Value(mirrorKey{}).(mirrorRequest)
+	return mr.mirror, mr.shadow, ok
+}
+
+// joinURLPath joins the path of the shadow upstream with the request path, as httputil.NewSingleHostReverseProxy does
+func joinURLPath(target, req *url.URL) (path, rawPath string) {
+	if target.RawPath == "" && req.RawPath == "" {
+		return singleJoiningSlash(target.Path, req.Path), ""
+	}
+	targetPath, reqPath := target.EscapedPath(), req.EscapedPath()
+	joined := singleJoiningSlash(targetPath, reqPath)
+	return singleJoiningSlash(target.Path, req.Path), joined
+}
+
+// singleJoiningSlash joins two paths with exactly one slash between them
+func singleJoiningSlash(a, b string) string {
+	switch aSlash, bSlash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/"); {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// readCloser reads from one reader and closes another, for request bodies partly read ahead
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shadowRequest is a request received by the shadow upstream
+type shadowRequest struct {
+	path, query, body string
+	header            http.Header
+}
+
+// newShadowUpstream returns a shadow upstream reporting its requests, which answers after release is closed
+func newShadowUpstream(t *testing.T, release <-chan struct{}) (*httptest.Server, <-chan shadowRequest) {
+	t.Helper()
+	received := make(chan shadowRequest, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- shadowRequest{path: r.URL.Path, query: r.URL.RawQuery, body: string(body), header: r.Header}
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(shadow.Close)
+	return shadow, received
+}
+
+func TestHandler_Mirror(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		_, _ = w.Write([]byte("primary"))
+	}))
+	defer upstream.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	shadow, received := newShadowUpstream(t, release)
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    upstream.URL,
+		Secret: SecretConfig{Header: "X-Secret", Value: "s3cret"},
+		Mirror: &MirrorConfig{URL: shadow.URL + "/shadow", Percent: 100},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat?stream=1", strings.NewReader(`{"q":"hello"}`))
+	req.Header.Set("X-ChatbotGate-Email", "user@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// The client gets the primary response without waiting for the shadow upstream
+	if rec.Body.String() != "primary" || gotBody != `{"q":"hello"}` {
+		t.Errorf("response = %q, upstream body = %q, want the primary exchange unchanged", rec.Body.String(), gotBody)
+	}
+
+	select {
+	case got := <-received:
+		if got.path != "/shadow/v1/chat" || got.query != "stream=1" || got.body != `{"q":"hello"}` {
+			t.Errorf("shadow request = %s?%s %q, want the same request under the shadow path", got.path, got.query, got.body)
+		}
+		for header, want := range map[string]string{
+			"X-Chatbotgate-Email": "user@example.com", // Identity headers of the middleware
+			"X-Secret":            "s3cret",           // Headers set by the director
+			MirrorHeader:          "1",
+		} {
+			if got := got.header.Get(header); got != want {
+				t.Errorf("shadow %s = %q, want %q", header, got, want)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow upstream received no request")
+	}
+}
+
+func TestHandler_MirrorSkipped(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer upstream.Close()
+
+	release := make(chan struct{})
+	close(release)
+	shadow, received := newShadowUpstream(t, release)
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    upstream.URL,
+		Mirror: &MirrorConfig{URL: shadow.URL, Percent: 50, MaxBodySize: 8},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	sample := 10.0
+	handler.mirror.sample = func() float64 { return sample }
+
+	// Bodies larger than max_body_size reach the upstream whole, and are not mirrored
+	body := "0123456789abcdef"
+	req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(body))) // Unknown length
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotBody != body {
+		t.Errorf("upstream body = %q, want %q", gotBody, body)
+	}
+
+	// Requests outside the mirrored share are not mirrored
+	sample = 60
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Within the share, without body
+	sample = 49.9
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/mirrored", nil))
+
+	select {
+	case got := <-received:
+		if got.path != "/mirrored" {
+			t.Errorf("shadow received %s, want only /mirrored", got.path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow upstream received no request")
+	}
+}
+
+func TestHandler_MirrorInFlightLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	shadow, received := newShadowUpstream(t, release)
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    upstream.URL,
+		Mirror: &MirrorConfig{URL: shadow.URL, Percent: 100, MaxInFlight: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/first", nil))
+	<-received // The shadow holds the first copy
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/second", nil))
+
+	select {
+	case got := <-received:
+		t.Errorf("shadow received %s while max_in_flight copies were in progress", got.path)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMirrorConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MirrorConfig
+		wantErr error
+	}{
+		{"valid", MirrorConfig{URL: "http://shadow:8080", Percent: 10}, nil},
+		{"all requests", MirrorConfig{URL: "http://shadow:8080", Percent: 100, Timeout: "5s"}, nil},
+		{"no url", MirrorConfig{Percent: 10}, ErrMirrorURLRequired},
+		{"no percent", MirrorConfig{URL: "http://shadow:8080"}, ErrMirrorPercentInvalid},
+		{"percent over 100", MirrorConfig{URL: "http://shadow:8080", Percent: 150}, ErrMirrorPercentInvalid},
+		{"negative body size", MirrorConfig{URL: "http://shadow:8080", Percent: 10, MaxBodySize: -1}, ErrMirrorNegative},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (MirrorConfig{URL: "http://shadow:8080", Percent: 10, Timeout: "soon"}).Validate(); err == nil {
+		t.Error("Validate() should reject an invalid timeout")
+	}
+}
@@ -0,0 +1,320 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rawUpstream is an upstream keeping the bytes received on each connection, to check the framing of the
+// requests sent by the proxy rather than the requests as parsed by its own server
+type rawUpstream struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	conns []*bytes.Buffer
+}
+
+// newRawUpstream returns a raw upstream answering "ok" with the method, path and body of each request
+func newRawUpstream(t *testing.T) *rawUpstream {
+	t.Helper()
+	u := &rawUpstream{}
+	u.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	u.Listener = recordingListener{Listener: u.Listener, upstream: u}
+	u.Start()
+	t.Cleanup(u.Close)
+	return u
+}
+
+// requests parses the bytes received by the upstream, returning "METHOD /path body" for each request
+// A request the proxy framed differently than its headers say fails the test.
+func (u *rawUpstream) requests(t *testing.T) []string {
+	t.Helper()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var got []string
+	for _, conn := range u.conns {
+		reader := bufio.NewReader(bytes.NewReader(conn.Bytes()))
+		for {
+			req, err := http.ReadRequest(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("upstream received an invalid request: %v\n%s", err, conn.String())
+			}
+			if req.Header.Get("Content-Length") != "" && len(req.TransferEncoding) > 0 {
+				t.Errorf("upstream received both Content-Length and Transfer-Encoding:\n%s", conn.String())
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("upstream received an invalid body: %v\n%s", err, conn.String())
+			}
+			got = append(got, strings.TrimSpace(req.Method+" "+req.URL.Path+" "+string(body)))
+		}
+	}
+	return got
+}
+
+// recordingListener keeps the bytes read from its connections in the raw upstream
+type recordingListener struct {
+	net.Listener
+	upstream *rawUpstream
+}
+
+func (l recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	l.upstream.mu.Lock()
+	l.upstream.conns = append(l.upstream.conns, buf)
+	l.upstream.mu.Unlock()
+	return &recordingConn{Conn: conn, buf: buf, mu: &l.upstream.mu}, nil
+}
+
+// recordingConn copies the bytes read from a connection into buf
+type recordingConn struct {
+	net.Conn
+	buf *bytes.Buffer
+	mu  *sync.Mutex
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.buf.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// sendRaw writes raw bytes to the server and returns the status codes of the responses it sends back
+// until it closes the connection
+func sendRaw(t *testing.T, server *httptest.Server, raw string) []int {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, raw); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var statuses []int
+	reader := bufio.NewReader(conn)
+	for {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			return statuses
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+}
+
+func TestHandler_RequestSmuggling(t *testing.T) {
+	const next = "GET /next HTTP/1.1\r\nHost: gate\r\nConnection: close\r\n\r\n"
+	const hidden = "GET /admin HTTP/1.1\r\nHost: gate\r\n\r\n"
+
+	tests := []struct {
+		name         string
+		raw          string
+		wantStatuses []int
+		wantUpstream []string
+	}{
+		{
+			name:         "content length and chunked",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n" + next,
+			wantStatuses: []int{http.StatusOK, http.StatusOK},
+			wantUpstream: []string{"POST /chat hello", "GET /next"},
+		},
+		{
+			name:         "request hidden in a chunked body",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nTransfer-Encoding: chunked\r\n\r\n23\r\n" + hidden + "\r\n0\r\n\r\n" + next,
+			wantStatuses: []int{http.StatusOK, http.StatusOK},
+			wantUpstream: []string{"POST /chat " + strings.TrimSpace(hidden), "GET /next"},
+		},
+		{
+			name:         "conflicting content lengths",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nContent-Length: 4\r\nContent-Length: 40\r\n\r\nhello" + next,
+			wantStatuses: []int{http.StatusBadRequest},
+		},
+		{
+			name:         "invalid content length",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nContent-Length: +5\r\n\r\nhello" + next,
+			wantStatuses: []int{http.StatusBadRequest},
+		},
+		{
+			name:         "unsupported transfer encoding",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n" + next,
+			wantStatuses: []int{http.StatusNotImplemented},
+		},
+		{
+			name:         "obfuscated transfer encoding",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nTransfer-Encoding: xchunked\r\nContent-Length: 5\r\n\r\nhello" + next,
+			wantStatuses: []int{http.StatusNotImplemented},
+		},
+		{
+			name:         "space before the colon",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nTransfer-Encoding : chunked\r\nContent-Length: 5\r\n\r\nhello" + next,
+			wantStatuses: []int{http.StatusBadRequest},
+		},
+		{
+			name:         "transfer encoding folded into another header",
+			raw:          "POST /chat HTTP/1.1\r\nHost: gate\r\nX-Note: a\r\n Transfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\nhello" + next,
+			wantStatuses: []int{http.StatusOK, http.StatusOK},
+			wantUpstream: []string{"POST /chat hello", "GET /next"},
+		},
+		{
+			name:         "oversized header",
+			raw:          "GET /chat HTTP/1.1\r\nHost: gate\r\nX-Large: " + strings.Repeat("a", 2<<20) + "\r\n\r\n" + next,
+			wantStatuses: []int{http.StatusRequestHeaderFieldsTooLarge},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newRawUpstream(t)
+			handler, err := NewHandler(upstream.URL)
+			if err != nil {
+				t.Fatalf("NewHandler() error = %v", err)
+			}
+			gate := httptest.NewServer(handler)
+			defer gate.Close()
+
+			if got := sendRaw(t, gate, tt.raw); !slices.Equal(got, tt.wantStatuses) {
+				t.Errorf("statuses = %v, want %v", got, tt.wantStatuses)
+			}
+			if got := upstream.requests(t); !slices.Equal(got, tt.wantUpstream) {
+				t.Errorf("upstream requests = %q, want %q", got, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestHandler_HopByHopHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL:    upstream.URL,
+		Secret: SecretConfig{Header: "X-Secret", Value: "s3cret"},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	// Headers listed in Connection are hop-by-hop, but not the ones set by the gate
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithIdentityHeaders(req.Context(), NewIdentityHeaders("X-ChatbotGate-Email")))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Connection", "X-Secret, X-Real-IP, X-Forwarded-For, X-Forwarded-Proto")
+	req.Header.Add("Connection", "X-ChatbotGate-Email, X-Client-Hop")
+	req.Header.Set("X-ChatbotGate-Email", "user@example.com")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	req.Header.Set("X-Client-Hop", "1")
+	for _, header := range []string{"Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Te", "Trailer"} {
+		req.Header.Set(header, "1")
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for header, want := range map[string]string{
+		"X-Secret":            "s3cret",
+		"X-Real-Ip":           "192.0.2.1",
+		"X-Forwarded-For":     "192.0.2.1", // The client's chain is hop-by-hop, the client IP is still appended once
+		"X-Forwarded-Proto":   "http",
+		"X-Chatbotgate-Email": "user@example.com",
+		"X-Client-Hop":        "",
+		"Connection":          "",
+		"Keep-Alive":          "",
+		"Proxy-Connection":    "",
+		"Proxy-Authorization": "",
+		"Te":                  "",
+		"Trailer":             "",
+	} {
+		if value := strings.Join(got.Values(header), ", "); value != want {
+			t.Errorf("upstream %s = %q, want %q", header, value, want)
+		}
+	}
+
+	// Otherwise the client IP is appended to the client's chain, once
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if value := strings.Join(got.Values("X-Forwarded-For"), ", "); value != "198.51.100.7, 192.0.2.1" {
+		t.Errorf("upstream X-Forwarded-For = %q, want %q", value, "198.51.100.7, 192.0.2.1")
+	}
+}
+
+func TestHandler_UpgradeHeaders(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandler(upstream.URL)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		connection     string
+		upgrade        string
+		wantConnection string
+		wantUpgrade    string
+	}{
+		{"websocket", "Upgrade", "websocket", "Upgrade", "websocket"},
+		{"websocket with keep-alive", "keep-alive, Upgrade", "WebSocket", "Upgrade", "WebSocket"},
+		{"lone upgrade header", "", "websocket", "", ""},
+		{"upgrade not in connection", "keep-alive", "websocket", "", ""},
+		{"h2c", "Upgrade, HTTP2-Settings", "h2c", "", ""},
+		{"invalid protocol", "Upgrade", "websocket\x7f", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.connection != "" {
+				req.Header.Set("Connection", tt.connection)
+			}
+			req.Header.Set("Upgrade", tt.upgrade)
+			req.Header.Set("HTTP2-Settings", "AAMAAABkAAQAAP__")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want the upstream response", rec.Code)
+			}
+			if connection := got.Get("Connection"); connection != tt.wantConnection {
+				t.Errorf("upstream Connection = %q, want %q", connection, tt.wantConnection)
+			}
+			if upgrade := got.Get("Upgrade"); upgrade != tt.wantUpgrade {
+				t.Errorf("upstream Upgrade = %q, want %q", upgrade, tt.wantUpgrade)
+			}
+			if strings.Contains(tt.connection, "HTTP2-Settings") && got.Get("Http2-Settings") != "" {
+				t.Error("upstream received HTTP2-Settings listed in Connection")
+			}
+		})
+	}
+}
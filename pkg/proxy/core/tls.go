@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrTLSVersionInvalid is returned when min_version is not a supported TLS version
+	ErrTLSVersionInvalid = errors.New("min_version must be \"1.2\" or \"1.3\"")
+
+	// ErrTLSClientCertIncomplete is returned when only one of cert_file and key_file is set
+	ErrTLSClientCertIncomplete = errors.New("cert_file and key_file must be set together")
+
+	// ErrTLSCABundleInvalid is returned when ca_file contains no PEM certificates
+	ErrTLSCABundleInvalid = errors.New("ca_file contains no PEM certificates")
+)
+
+// tlsVersions maps min_version values to crypto/tls versions
+// Versions below TLS 1.2 are not offered; they are disabled by Go's defaults as well
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig builds the crypto/tls configuration of upstream connections
+// Files are read once; reload the configuration to pick up rotated certificates.
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, ErrTLSVersionInvalid
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, ErrTLSCABundleInvalid
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, ErrTLSClientCertIncomplete
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
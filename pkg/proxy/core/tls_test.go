@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chatbotgate"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newMutualTLSUpstream starts an https upstream that requires a client certificate
+// and writes its certificate to a CA file
+func newMutualTLSUpstream(t *testing.T, dir string) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return server, caFile
+}
+
+// TestHandler_UpstreamMutualTLS tests proxying to an upstream with a private CA and client certificate
+func TestHandler_UpstreamMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	upstream, caFile := newMutualTLSUpstream(t, dir)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{
+		URL: upstream.URL,
+		TLS: &TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "chatbotgate" {
+		t.Errorf("Response = %d %q, want 200 from the upstream", rec.Code, rec.Body.String())
+	}
+
+	// Without the CA bundle the upstream certificate is not trusted
+	handler, err = NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, TLS: &TLSConfig{CertFile: certFile, KeyFile: keyFile}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Status without CA bundle = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+// TestHandler_UpstreamInsecureSkipVerify tests skipping certificate verification per upstream
+func TestHandler_UpstreamInsecureSkipVerify(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, TLS: &TLSConfig{InsecureSkipVerify: true}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+// TestNewTLSConfig_Invalid tests rejected TLS settings
+func TestNewTLSConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeClientCert(t, dir)
+	notPEM := filepath.Join(dir, "not-pem.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr error
+	}{
+		{"TLS 1.1", TLSConfig{MinVersion: "1.1"}, ErrTLSVersionInvalid},
+		{"unknown version", TLSConfig{MinVersion: "TLS13"}, ErrTLSVersionInvalid},
+		{"certificate without key", TLSConfig{CertFile: certFile}, ErrTLSClientCertIncomplete},
+		{"CA file without certificates", TLSConfig{CAFile: notPEM}, ErrTLSCABundleInvalid},
+		{"missing CA file", TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTLSConfig(tt.cfg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewTLSConfig() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
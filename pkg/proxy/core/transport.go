@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrTransportNegative is returned when a connection count or duration of TransportConfig is negative
+var ErrTransportNegative = errors.New("transport settings must not be negative")
+
+// Transport defaults (see TransportConfig)
+const (
+	defaultMaxIdleConns        = 256
+	defaultMaxIdleConnsPerHost = 128
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// newTransport returns a transport for the upstream using the given TLS and connection pool settings
+// Each upstream gets its own transport, so that its idle connections are not shared with other clients.
+func newTransport(tlsCfg *TLSConfig, cfg *TransportConfig) (http.RoundTripper, error) {
+	if cfg == nil {
+		cfg = &TransportConfig{}
+	}
+	if cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 || cfg.MaxConnsPerHost < 0 {
+		return nil, ErrTransportNegative
+	}
+
+	idleConnTimeout, err := transportDuration("idle_conn_timeout", cfg.IdleConnTimeout, defaultIdleConnTimeout)
+	if err != nil {
+		return nil, err
+	}
+	dialTimeout, err := transportDuration("dial_timeout", cfg.DialTimeout, defaultDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	keepAlive, err := transportDuration("keep_alive", cfg.KeepAlive, defaultKeepAlive)
+	if err != nil {
+		return nil, err
+	}
+	if keepAlive == 0 {
+		keepAlive = -1 // net.Dialer uses its default for 0 and disables keep-alive probes for negative values
+	}
+	tlsHandshakeTimeout, err := transportDuration("tls_handshake_timeout", cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	responseHeaderTimeout, err := transportDuration("response_header_timeout", cfg.ResponseHeaderTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}).DialContext
+	transport.MaxIdleConns = positiveOr(cfg.MaxIdleConns, defaultMaxIdleConns)
+	transport.MaxIdleConnsPerHost = positiveOr(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	transport.DisableCompression = cfg.DisableCompression
+
+	if tlsCfg != nil {
+		tlsConfig, err := NewTLSConfig(*tlsCfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// Validate reports whether the transport settings are usable
+func (c TransportConfig) Validate() error {
+	_, err := newTransport(nil, &c)
+	return err
+}
+
+// transportDuration parses a duration setting, returning def when it is empty
+func transportDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, ErrTransportNegative)
+	}
+	return d, nil
+}
+
+// positiveOr returns n, or def when n is zero
+func positiveOr(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestNewTransport_Defaults tests the connection pool used without transport settings
+func TestNewTransport_Defaults(t *testing.T) {
+	rt, err := newTransport(nil, nil)
+	if err != nil {
+		t.Fatalf("newTransport() error = %v", err)
+	}
+	transport := rt.(*http.Transport)
+	if transport == http.DefaultTransport {
+		t.Error("Upstreams should not share http.DefaultTransport")
+	}
+	if transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	}
+	if transport.MaxIdleConns != defaultMaxIdleConns {
+		t.Errorf("MaxIdleConns = %d, want %d", transport.MaxIdleConns, defaultMaxIdleConns)
+	}
+	if transport.IdleConnTimeout != defaultIdleConnTimeout || transport.TLSHandshakeTimeout != defaultTLSHandshakeTimeout {
+		t.Errorf("Timeouts = %v/%v, want %v/%v", transport.IdleConnTimeout, transport.TLSHandshakeTimeout, defaultIdleConnTimeout, defaultTLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != 0 {
+		t.Errorf("ResponseHeaderTimeout = %v, want none", transport.ResponseHeaderTimeout)
+	}
+	if transport.Proxy == nil {
+		t.Error("HTTP_PROXY settings should be honored like http.DefaultTransport")
+	}
+}
+
+// TestNewTransport_Settings tests applying transport settings
+func TestNewTransport_Settings(t *testing.T) {
+	rt, err := newTransport(&TLSConfig{ServerName: "backend.internal"}, &TransportConfig{
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   5,
+		MaxConnsPerHost:       20,
+		IdleConnTimeout:       "30s",
+		TLSHandshakeTimeout:   "0",
+		ResponseHeaderTimeout: "2m",
+		DisableKeepAlives:     true,
+		DisableCompression:    true,
+	})
+	if err != nil {
+		t.Fatalf("newTransport() error = %v", err)
+	}
+	transport := rt.(*http.Transport)
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 5 || transport.MaxConnsPerHost != 20 {
+		t.Errorf("Connection limits = %d/%d/%d, want 10/5/20", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 30*time.Second || transport.TLSHandshakeTimeout != 0 || transport.ResponseHeaderTimeout != 2*time.Minute {
+		t.Errorf("Timeouts = %v/%v/%v, want 30s/0s/2m0s", transport.IdleConnTimeout, transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+	if !transport.DisableKeepAlives || !transport.DisableCompression {
+		t.Error("DisableKeepAlives and DisableCompression should be set")
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ServerName != "backend.internal" {
+		t.Error("TLS settings should be applied as well")
+	}
+}
+
+// TestTransportConfig_Validate tests rejected transport settings
+func TestTransportConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TransportConfig
+		wantErr string
+	}{
+		{"negative idle connections", TransportConfig{MaxIdleConns: -1}, "must not be negative"},
+		{"negative per-host idle connections", TransportConfig{MaxIdleConnsPerHost: -5}, "must not be negative"},
+		{"unparsable duration", TransportConfig{IdleConnTimeout: "90"}, "invalid idle_conn_timeout"},
+		{"negative duration", TransportConfig{ResponseHeaderTimeout: "-1s"}, "invalid response_header_timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if err := (TransportConfig{MaxIdleConns: -1}).Validate(); !errors.Is(err, ErrTransportNegative) {
+		t.Errorf("Validate() error = %v, want ErrTransportNegative", err)
+	}
+}
+
+// TestHandler_ResponseHeaderTimeout tests that a slow upstream is reported as a gateway timeout
+func TestHandler_ResponseHeaderTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL, Transport: &TransportConfig{ResponseHeaderTimeout: "50ms"}})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
+
+// TestHandler_ReusesUpstreamConnections tests that sequential requests share a kept-alive connection
+func TestHandler_ReusesUpstreamConnections(t *testing.T) {
+	var connections atomic.Int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	handler, err := NewHandlerWithConfig(UpstreamConfig{URL: upstream.URL})
+	if err != nil {
+		t.Fatalf("NewHandlerWithConfig() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if got := connections.Load(); got != 1 {
+		t.Errorf("Upstream connections = %d, want 1", got)
+	}
+}
@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewFake(start)
+
+	if !c.Now().Equal(start) {
+		t.Errorf("Now() = %v, want %v", c.Now(), start)
+	}
+	c.Advance(90 * time.Minute)
+	if want := start.Add(90 * time.Minute); !c.Now().Equal(want) {
+		t.Errorf("Now() after Advance = %v, want %v", c.Now(), want)
+	}
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("Now() after Set = %v, want %v", c.Now(), start)
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if OrReal(nil) != Real {
+		t.Error("OrReal(nil) should return Real")
+	}
+	fake := NewFake(time.Now())
+	if OrReal(fake) != fake {
+		t.Error("OrReal(fake) should return the fake clock")
+	}
+	if d := time.Since(Real.Now()); d < 0 || d > time.Minute {
+		t.Errorf("Real.Now() is %v away from time.Now()", d)
+	}
+}
@@ -13,11 +13,23 @@ const (
 	English Language = "en"
 	// Japanese is the Japanese language
 	Japanese Language = "ja"
+	// Arabic is the Arabic language (right-to-left)
+	Arabic Language = "ar"
+	// Hebrew is the Hebrew language (right-to-left)
+	Hebrew Language = "he"
 )
 
 // DefaultLanguage is the fallback language
 const DefaultLanguage = English
 
+// Languages returns all supported languages
+func Languages() []Language {
+	return []Language{English, Japanese, Arabic, Hebrew}
+}
+
+// LanguageCookieName is the cookie that stores the preferred language
+const LanguageCookieName = "lang"
+
 // Theme represents a UI theme
 type Theme string
 
@@ -33,6 +45,11 @@ const (
 // DefaultTheme is the fallback theme
 const DefaultTheme = ThemeAuto
 
+// Themes returns all supported themes
+func Themes() []Theme {
+	return []Theme{ThemeAuto, ThemeLight, ThemeDark}
+}
+
 // Translation represents a translation map
 type Translation map[string]string
 
@@ -79,7 +96,7 @@ func DetectLanguage(r *http.Request) Language {
 	}
 
 	// Check cookie
-	if cookie, err := r.Cookie("lang"); err == nil {
+	if cookie, err := r.Cookie(LanguageCookieName); err == nil {
 		return normalizeLanguage(cookie.Value)
 	}
 
@@ -98,6 +115,17 @@ func DetectLanguage(r *http.Request) Language {
 	return DefaultLanguage
 }
 
+// ParseLanguage parses a language code (e.g., "ja", "en-US")
+// Returns false if the language is not supported
+func ParseLanguage(lang string) (Language, bool) {
+	code := strings.ToLower(strings.TrimSpace(lang))
+	if len(code) > 2 {
+		code = code[:2]
+	}
+	normalized := normalizeLanguage(code)
+	return normalized, string(normalized) == code || (code == "iw" && normalized == Hebrew)
+}
+
 // normalizeLanguage normalizes a language code
 func normalizeLanguage(lang string) Language {
 	lang = strings.ToLower(strings.TrimSpace(lang))
@@ -112,11 +140,25 @@ func normalizeLanguage(lang string) Language {
 		return Japanese
 	case "en":
 		return English
+	case "ar":
+		return Arabic
+	case "he", "iw": // "iw" is the legacy code for Hebrew
+		return Hebrew
 	default:
 		return DefaultLanguage
 	}
 }
 
+// Direction returns the text direction of a language ("rtl" or "ltr")
+func Direction(lang Language) string {
+	switch lang {
+	case Arabic, Hebrew:
+		return "rtl"
+	default:
+		return "ltr"
+	}
+}
+
 // DetectTheme detects the preferred theme from HTTP request
 func DetectTheme(r *http.Request) Theme {
 	// Check query parameter
@@ -156,17 +198,25 @@ var defaultTranslations = Translations{
 		"service.description": "Authentication proxy for multiple OAuth2 providers",
 
 		// Login page
-		"login.title":           "Login",
-		"login.heading":         "Sign In",
-		"login.oauth2.heading":  "Login with OAuth2",
-		"login.oauth2.continue": "Continue with %s",
-		"login.or":              "or",
-		"login.email.link":      "Or login with Email",
-		"login.email.heading":   "Login with Email",
-		"login.email.label":     "Email Address",
-		"login.email.save":      "Save",
-		"login.email.submit":    "Send Login Link",
-		"login.back":            "Back to login options",
+		"login.title":               "Login",
+		"login.heading":             "Sign In",
+		"login.oauth2.heading":      "Login with OAuth2",
+		"login.oauth2.continue":     "Continue with %s",
+		"login.or":                  "or",
+		"login.email.link":          "Or login with Email",
+		"login.email.heading":       "Login with Email",
+		"login.email.label":         "Email Address",
+		"login.email.save":          "Save",
+		"login.email.submit":        "Send Login Link",
+		"login.back":                "Back to login options",
+		"login.more_options":        "Other options",
+		"login.guest.continue":      "Continue as guest",
+		"login.guest.notice":        "You're using guest access with limited requests. Sign in to keep chatting without limits.",
+		"login.reauth.notice":       "For your security, this page requires you to sign in again.",
+		"error.guest_limit.title":   "Sign in to continue",
+		"error.guest_limit.heading": "Guest limit reached",
+		"error.guest_limit.message": "You've used all requests available to guests. Sign in to continue the conversation.",
+		"error.guest_limit.signin":  "Sign in",
 
 		// Agreement auth
 		"password.label":  "Password",
@@ -179,6 +229,8 @@ var defaultTranslations = Translations{
 		"email.sent.detail":          "Please check your inbox and click the link to log in.",
 		"email.sent.otp_label":       "Or enter the code from your email:",
 		"email.sent.otp_placeholder": "XXXX XXXX XXXX",
+		"email.sent.otp_segment":     "Character {n} of {total}",
+		"email.sent.otp_invalid":     "The code is invalid or has expired. Please try again.",
 		"email.sent.verify_button":   "Verify Code",
 		"email.sent.back":            "Back to login",
 
@@ -193,37 +245,58 @@ var defaultTranslations = Translations{
 		"logout.message": "You have been successfully logged out.",
 		"logout.login":   "Login again",
 
+		// Scope consent
+		"consent.title":   "Optional Permissions",
+		"consent.heading": "Optional Permissions",
+		"consent.message": "You can also grant the following permissions. You can sign in without them.",
+		"consent.skip":    "Skip",
+
 		// Errors
-		"error.unauthorized":           "Unauthorized",
-		"error.forbidden":              "Access Denied",
-		"error.forbidden.title":        "Access Denied",
-		"error.forbidden.heading":      "Access Denied",
-		"error.forbidden.message":      "This service is only available to pre-authorized email addresses. Please contact the administrator.",
-		"error.email_required.title":   "Email Required",
-		"error.email_required.heading": "Email Address Required",
-		"error.email_required.message": "Your authentication provider did not provide an email address. Please use a different provider or contact the administrator.",
-		"error.internal":               "Internal Server Error",
-		"error.invalid_request":        "Invalid Request",
-		"error.invalid_email":          "Email is required",
-		"error.rate_limit":             "Too many requests. Please try again later.",
-		"error.notfound.title":         "404 - Not Found",
-		"error.notfound.heading":       "Not Found",
-		"error.notfound.message":       "The page you are looking for could not be found.",
-		"error.notfound.home":          "Go to Home",
-		"error.server.title":           "500 - Internal Server Error",
-		"error.server.heading":         "Internal Server Error",
-		"error.server.message":         "An unexpected error occurred. Please try again later.",
-		"error.server.home":            "Go to Home",
-		"error.details.title":          "Error Details",
+		"error.unauthorized":             "Unauthorized",
+		"error.forbidden":                "Access Denied",
+		"error.forbidden.title":          "Access Denied",
+		"error.forbidden.heading":        "Access Denied",
+		"error.forbidden.message":        "This service is only available to pre-authorized email addresses. Please contact the administrator.",
+		"error.email_required.title":     "Email Required",
+		"error.email_required.heading":   "Email Address Required",
+		"error.email_required.message":   "Your authentication provider did not provide an email address. Please use a different provider or contact the administrator.",
+		"error.email_unverified.title":   "Email Not Verified",
+		"error.email_unverified.heading": "Email Address Not Verified",
+		"error.email_unverified.message": "Your authentication provider has not verified your email address. Please verify it with the provider, or use a different sign-in method.",
+		"error.internal":                 "Internal Server Error",
+		"error.invalid_request":          "Invalid Request",
+		"error.invalid_email":            "Email is required",
+		"error.rate_limit":               "Too many requests. Please try again later.",
+		"error.notfound.title":           "404 - Not Found",
+		"error.notfound.heading":         "Not Found",
+		"error.notfound.message":         "The page you are looking for could not be found.",
+		"error.notfound.home":            "Go to Home",
+		"error.server.title":             "500 - Internal Server Error",
+		"error.server.heading":           "Internal Server Error",
+		"error.server.message":           "An unexpected error occurred. Please try again later.",
+		"error.server.home":              "Go to Home",
+		"error.upstream.title":           "502 - Bad Gateway",
+		"error.upstream.heading":         "Service Unavailable",
+		"error.upstream.message":         "The service is temporarily unreachable. Please try again in a moment.",
+		"error.timeout.title":            "504 - Gateway Timeout",
+		"error.timeout.heading":          "Service Timed Out",
+		"error.timeout.message":          "The service took too long to respond. Please try again in a moment.",
+		"error.upstream.retry":           "Try Again",
+		"error.request_id":               "Request ID",
+		"error.details.title":            "Error Details",
 
 		// Theme and Language
-		"ui.theme":       "Theme",
-		"ui.theme.auto":  "🌗 Auto",
-		"ui.theme.light": "☀️ Light",
-		"ui.theme.dark":  "🌙 Dark",
-		"ui.language":    "Language",
-		"ui.language.en": "English",
-		"ui.language.ja": "日本語",
+		"ui.theme":                "Theme",
+		"ui.theme.auto":           "🌗 Auto",
+		"ui.theme.light":          "☀️ Light",
+		"ui.theme.dark":           "🌙 Dark",
+		"ui.language":             "Language",
+		"ui.language.en":          "English",
+		"ui.language.ja":          "日本語",
+		"ui.language.ar":          "العربية",
+		"ui.language.he":          "עברית",
+		"ui.skip_to_content":      "Skip to main content",
+		"ui.announcement.dismiss": "Dismiss",
 
 		// Email
 		"email.login.subject":      "Login Link - %s",
@@ -243,17 +316,25 @@ var defaultTranslations = Translations{
 		"service.description": "複数のOAuth2プロバイダーに対応した認証プロキシ",
 
 		// Login page
-		"login.title":           "ログイン",
-		"login.heading":         "サインイン",
-		"login.oauth2.heading":  "OAuth2でログイン",
-		"login.oauth2.continue": "%s でサインイン",
-		"login.or":              "または",
-		"login.email.link":      "またはメールでログイン",
-		"login.email.heading":   "メールでログイン",
-		"login.email.label":     "メールアドレス",
-		"login.email.save":      "保存",
-		"login.email.submit":    "ログインリンクを送信",
-		"login.back":            "ログイン方法の選択に戻る",
+		"login.title":               "ログイン",
+		"login.heading":             "サインイン",
+		"login.oauth2.heading":      "OAuth2でログイン",
+		"login.oauth2.continue":     "%s でサインイン",
+		"login.or":                  "または",
+		"login.email.link":          "またはメールでログイン",
+		"login.email.heading":       "メールでログイン",
+		"login.email.label":         "メールアドレス",
+		"login.email.save":          "保存",
+		"login.email.submit":        "ログインリンクを送信",
+		"login.back":                "ログイン方法の選択に戻る",
+		"login.more_options":        "その他のログイン方法",
+		"login.guest.continue":      "ゲストとして続ける",
+		"login.guest.notice":        "ゲストとして利用中です（リクエスト数に上限があります）。制限なく使うにはログインしてください。",
+		"login.reauth.notice":       "セキュリティのため、このページを表示するには再度ログインしてください。",
+		"error.guest_limit.title":   "ログインして続ける",
+		"error.guest_limit.heading": "ゲスト利用の上限に達しました",
+		"error.guest_limit.message": "ゲストが利用できるリクエスト数の上限に達しました。会話を続けるにはログインしてください。",
+		"error.guest_limit.signin":  "ログイン",
 
 		// Agreement auth
 		"password.label":  "パスワード",
@@ -266,6 +347,8 @@ var defaultTranslations = Translations{
 		"email.sent.detail":          "受信箱を確認し、リンクをクリックしてログインしてください。",
 		"email.sent.otp_label":       "またはメールに記載されたコードを入力してください:",
 		"email.sent.otp_placeholder": "XXXX XXXX XXXX",
+		"email.sent.otp_segment":     "{total}文字中{n}文字目",
+		"email.sent.otp_invalid":     "コードが無効か期限切れです。もう一度お試しください。",
 		"email.sent.verify_button":   "コードを確認",
 		"email.sent.back":            "ログインに戻る",
 
@@ -280,37 +363,58 @@ var defaultTranslations = Translations{
 		"logout.message": "正常にログアウトしました。",
 		"logout.login":   "再度ログイン",
 
+		// Scope consent
+		"consent.title":   "追加の権限",
+		"consent.heading": "追加の権限",
+		"consent.message": "次の権限も許可できます。許可しなくてもログインできます。",
+		"consent.skip":    "スキップ",
+
 		// Errors
-		"error.unauthorized":           "未認証",
-		"error.forbidden":              "アクセス拒否",
-		"error.forbidden.title":        "アクセス拒否",
-		"error.forbidden.heading":      "アクセス拒否",
-		"error.forbidden.message":      "このサービスは事前に許可されたメールアドレスでのみご利用いただけます。運営者にお問い合わせください。",
-		"error.email_required.title":   "メールアドレスが必要です",
-		"error.email_required.heading": "メールアドレスが必要です",
-		"error.email_required.message": "認証プロバイダーからメールアドレスを取得できませんでした。別のプロバイダーをお試しいただくか、運営者にお問い合わせください。",
-		"error.internal":               "内部サーバーエラー",
-		"error.invalid_request":        "不正なリクエスト",
-		"error.invalid_email":          "メールアドレスが必要です",
-		"error.rate_limit":             "リクエストが多すぎます。しばらくしてから再度お試しください。",
-		"error.notfound.title":         "404 - Not Found",
-		"error.notfound.heading":       "Not Found",
-		"error.notfound.message":       "お探しのページは見つかりませんでした。",
-		"error.notfound.home":          "ホームに戻る",
-		"error.server.title":           "500 - Internal Server Error",
-		"error.server.heading":         "Internal Server Error",
-		"error.server.message":         "予期しないエラーが発生しました。しばらくしてから再度お試しください。",
-		"error.server.home":            "ホームに戻る",
-		"error.details.title":          "エラーの詳細",
+		"error.unauthorized":             "未認証",
+		"error.forbidden":                "アクセス拒否",
+		"error.forbidden.title":          "アクセス拒否",
+		"error.forbidden.heading":        "アクセス拒否",
+		"error.forbidden.message":        "このサービスは事前に許可されたメールアドレスでのみご利用いただけます。運営者にお問い合わせください。",
+		"error.email_required.title":     "メールアドレスが必要です",
+		"error.email_required.heading":   "メールアドレスが必要です",
+		"error.email_required.message":   "認証プロバイダーからメールアドレスを取得できませんでした。別のプロバイダーをお試しいただくか、運営者にお問い合わせください。",
+		"error.email_unverified.title":   "メールアドレスが未確認です",
+		"error.email_unverified.heading": "メールアドレスが確認されていません",
+		"error.email_unverified.message": "認証プロバイダーでメールアドレスの確認が完了していません。プロバイダーでメールアドレスを確認するか、別のログイン方法をご利用ください。",
+		"error.internal":                 "内部サーバーエラー",
+		"error.invalid_request":          "不正なリクエスト",
+		"error.invalid_email":            "メールアドレスが必要です",
+		"error.rate_limit":               "リクエストが多すぎます。しばらくしてから再度お試しください。",
+		"error.notfound.title":           "404 - Not Found",
+		"error.notfound.heading":         "Not Found",
+		"error.notfound.message":         "お探しのページは見つかりませんでした。",
+		"error.notfound.home":            "ホームに戻る",
+		"error.server.title":             "500 - Internal Server Error",
+		"error.server.heading":           "Internal Server Error",
+		"error.server.message":           "予期しないエラーが発生しました。しばらくしてから再度お試しください。",
+		"error.server.home":              "ホームに戻る",
+		"error.upstream.title":           "502 - Bad Gateway",
+		"error.upstream.heading":         "サービスに接続できません",
+		"error.upstream.message":         "サービスに一時的に接続できません。しばらくしてからもう一度お試しください。",
+		"error.timeout.title":            "504 - Gateway Timeout",
+		"error.timeout.heading":          "サービスが応答しません",
+		"error.timeout.message":          "サービスの応答に時間がかかりすぎています。しばらくしてからもう一度お試しください。",
+		"error.upstream.retry":           "再試行",
+		"error.request_id":               "リクエストID",
+		"error.details.title":            "エラーの詳細",
 
 		// Theme and Language
-		"ui.theme":       "テーマ",
-		"ui.theme.auto":  "🌗 Auto",
-		"ui.theme.light": "☀️ Light",
-		"ui.theme.dark":  "🌙 Dark",
-		"ui.language":    "言語",
-		"ui.language.en": "English",
-		"ui.language.ja": "日本語",
+		"ui.theme":                "テーマ",
+		"ui.theme.auto":           "🌗 Auto",
+		"ui.theme.light":          "☀️ Light",
+		"ui.theme.dark":           "🌙 Dark",
+		"ui.language":             "言語",
+		"ui.language.en":          "English",
+		"ui.language.ja":          "日本語",
+		"ui.language.ar":          "العربية",
+		"ui.language.he":          "עברית",
+		"ui.skip_to_content":      "メインコンテンツへスキップ",
+		"ui.announcement.dismiss": "閉じる",
 
 		// Email
 		"email.login.subject":      "ログインリンク - %s",
@@ -323,4 +427,238 @@ var defaultTranslations = Translations{
 		"email.login.outro":        "このメールに心当たりがない場合は、無視してください。",
 		"email.login.trouble":      "ボタン「%s」が機能しない場合は、以下のURLをコピーしてウェブブラウザに貼り付けてください。",
 	},
+	Arabic: Translation{
+		// Service
+		"service.name":        "ChatbotGate",
+		"service.description": "وكيل مصادقة يدعم عدة موفري OAuth2",
+
+		// Login page
+		"login.title":               "تسجيل الدخول",
+		"login.heading":             "تسجيل الدخول",
+		"login.oauth2.heading":      "تسجيل الدخول باستخدام OAuth2",
+		"login.oauth2.continue":     "المتابعة باستخدام %s",
+		"login.or":                  "أو",
+		"login.email.link":          "أو سجّل الدخول بالبريد الإلكتروني",
+		"login.email.heading":       "تسجيل الدخول بالبريد الإلكتروني",
+		"login.email.label":         "البريد الإلكتروني",
+		"login.email.save":          "حفظ",
+		"login.email.submit":        "إرسال رابط تسجيل الدخول",
+		"login.back":                "العودة إلى خيارات تسجيل الدخول",
+		"login.more_options":        "خيارات أخرى",
+		"login.guest.continue":      "المتابعة كضيف",
+		"login.guest.notice":        "أنت تستخدم وصول الضيف بعدد محدود من الطلبات. سجّل الدخول لمتابعة المحادثة دون حدود.",
+		"login.reauth.notice":       "لحمايتك، تتطلب هذه الصفحة تسجيل الدخول مرة أخرى.",
+		"error.guest_limit.title":   "سجّل الدخول للمتابعة",
+		"error.guest_limit.heading": "تم بلوغ حد الضيف",
+		"error.guest_limit.message": "لقد استخدمت كل الطلبات المتاحة للضيوف. سجّل الدخول لمتابعة المحادثة.",
+		"error.guest_limit.signin":  "تسجيل الدخول",
+
+		// Agreement auth
+		"password.label":  "كلمة المرور",
+		"password.button": "تسجيل الدخول",
+
+		// Email auth
+		"email.sent.title":           "تحقق من بريدك الإلكتروني",
+		"email.sent.heading":         "تحقق من بريدك الإلكتروني",
+		"email.sent.message":         "إذا كان بريدك الإلكتروني مصرحًا به، فستتلقى رابط تسجيل الدخول قريبًا.",
+		"email.sent.detail":          "تحقق من صندوق الوارد وانقر على الرابط لتسجيل الدخول.",
+		"email.sent.otp_label":       "أو أدخل الرمز الوارد في البريد الإلكتروني:",
+		"email.sent.otp_placeholder": "XXXX XXXX XXXX",
+		"email.sent.otp_segment":     "الحرف {n} من {total}",
+		"email.sent.otp_invalid":     "الرمز غير صالح أو منتهي الصلاحية. يرجى المحاولة مرة أخرى.",
+		"email.sent.verify_button":   "تحقق من الرمز",
+		"email.sent.back":            "العودة إلى تسجيل الدخول",
+
+		"email.invalid.title":   "رمز غير صالح",
+		"email.invalid.heading": "رمز غير صالح أو منتهي الصلاحية",
+		"email.invalid.message": "رابط تسجيل الدخول غير صالح أو تم استخدامه بالفعل.",
+		"email.invalid.retry":   "طلب رابط تسجيل دخول جديد",
+
+		// Logout
+		"logout.title":   "تم تسجيل الخروج",
+		"logout.heading": "تم تسجيل الخروج",
+		"logout.message": "تم تسجيل خروجك بنجاح.",
+		"logout.login":   "تسجيل الدخول مرة أخرى",
+
+		// Scope consent
+		"consent.title":   "أذونات اختيارية",
+		"consent.heading": "أذونات اختيارية",
+		"consent.message": "يمكنك أيضًا منح الأذونات التالية. يمكنك تسجيل الدخول بدونها.",
+		"consent.skip":    "تخطٍّ",
+
+		// Errors
+		"error.unauthorized":             "غير مصرح",
+		"error.forbidden":                "الوصول مرفوض",
+		"error.forbidden.title":          "الوصول مرفوض",
+		"error.forbidden.heading":        "الوصول مرفوض",
+		"error.forbidden.message":        "هذه الخدمة متاحة فقط لعناوين البريد الإلكتروني المصرح بها مسبقًا. يرجى التواصل مع مشغل الخدمة.",
+		"error.email_required.title":     "البريد الإلكتروني مطلوب",
+		"error.email_required.heading":   "البريد الإلكتروني مطلوب",
+		"error.email_required.message":   "تعذر الحصول على عنوان بريدك الإلكتروني من موفر المصادقة. يرجى تجربة موفر آخر أو التواصل مع مشغل الخدمة.",
+		"error.email_unverified.title":   "البريد الإلكتروني غير مؤكد",
+		"error.email_unverified.heading": "عنوان البريد الإلكتروني غير مؤكد",
+		"error.email_unverified.message": "لم يؤكد موفر المصادقة عنوان بريدك الإلكتروني. يرجى تأكيده لدى الموفر أو استخدام طريقة تسجيل دخول أخرى.",
+		"error.internal":                 "خطأ داخلي في الخادم",
+		"error.invalid_request":          "طلب غير صالح",
+		"error.invalid_email":            "البريد الإلكتروني مطلوب",
+		"error.rate_limit":               "طلبات كثيرة جدًا. يرجى المحاولة مرة أخرى لاحقًا.",
+		"error.notfound.title":           "404 - الصفحة غير موجودة",
+		"error.notfound.heading":         "الصفحة غير موجودة",
+		"error.notfound.message":         "تعذر العثور على الصفحة التي تبحث عنها.",
+		"error.notfound.home":            "العودة إلى الصفحة الرئيسية",
+		"error.server.title":             "500 - خطأ داخلي في الخادم",
+		"error.server.heading":           "خطأ داخلي في الخادم",
+		"error.server.message":           "حدث خطأ غير متوقع. يرجى المحاولة مرة أخرى لاحقًا.",
+		"error.server.home":              "العودة إلى الصفحة الرئيسية",
+		"error.upstream.title":           "502 - بوابة غير صالحة",
+		"error.upstream.heading":         "الخدمة غير متاحة",
+		"error.upstream.message":         "تعذر الوصول إلى الخدمة مؤقتًا. يرجى المحاولة مرة أخرى بعد قليل.",
+		"error.timeout.title":            "504 - انتهت مهلة البوابة",
+		"error.timeout.heading":          "انتهت مهلة الخدمة",
+		"error.timeout.message":          "استغرقت الخدمة وقتًا طويلاً للرد. يرجى المحاولة مرة أخرى بعد قليل.",
+		"error.upstream.retry":           "حاول مرة أخرى",
+		"error.request_id":               "معرّف الطلب",
+		"error.details.title":            "تفاصيل الخطأ",
+
+		// Theme and Language
+		"ui.theme":                "السمة",
+		"ui.theme.auto":           "🌗 تلقائي",
+		"ui.theme.light":          "☀️ فاتح",
+		"ui.theme.dark":           "🌙 داكن",
+		"ui.language":             "اللغة",
+		"ui.language.en":          "English",
+		"ui.language.ja":          "日本語",
+		"ui.language.ar":          "العربية",
+		"ui.language.he":          "עברית",
+		"ui.skip_to_content":      "انتقل إلى المحتوى الرئيسي",
+		"ui.announcement.dismiss": "إغلاق",
+
+		// Email
+		"email.login.subject":      "رابط تسجيل الدخول - %s",
+		"email.login.greeting":     "شكرًا لطلبك تسجيل الدخول.",
+		"email.login.intro1":       "انقر على الزر أدناه لتسجيل الدخول إلى %s.",
+		"email.login.intro2":       "هذا الرابط صالح لمدة %d دقيقة.",
+		"email.login.instructions": "انقر على الزر أدناه لإكمال تسجيل الدخول:",
+		"email.login.button":       "تسجيل الدخول",
+		"email.login.otp_label":    "أو أدخل هذا الرمز في صفحة تسجيل الدخول:",
+		"email.login.outro":        "إذا لم تطلب هذا البريد الإلكتروني، يمكنك تجاهله بأمان.",
+		"email.login.trouble":      "إذا كنت تواجه مشكلة في النقر على زر \"%s\"، فانسخ عنوان URL أدناه والصقه في متصفح الويب.",
+	},
+	Hebrew: Translation{
+		// Service
+		"service.name":        "ChatbotGate",
+		"service.description": "פרוקסי אימות התומך במספר ספקי OAuth2",
+
+		// Login page
+		"login.title":               "התחברות",
+		"login.heading":             "כניסה",
+		"login.oauth2.heading":      "התחברות באמצעות OAuth2",
+		"login.oauth2.continue":     "המשך עם %s",
+		"login.or":                  "או",
+		"login.email.link":          "או התחבר באמצעות אימייל",
+		"login.email.heading":       "התחברות באמצעות אימייל",
+		"login.email.label":         "כתובת אימייל",
+		"login.email.save":          "שמור",
+		"login.email.submit":        "שלח קישור התחברות",
+		"login.back":                "חזרה לאפשרויות ההתחברות",
+		"login.more_options":        "אפשרויות נוספות",
+		"login.guest.continue":      "המשך כאורח",
+		"login.guest.notice":        "אתה משתמש בגישת אורח עם מספר בקשות מוגבל. התחבר כדי להמשיך לשוחח ללא הגבלה.",
+		"login.reauth.notice":       "מטעמי אבטחה, דף זה דורש להתחבר שוב.",
+		"error.guest_limit.title":   "התחבר כדי להמשיך",
+		"error.guest_limit.heading": "הגעת למגבלת האורח",
+		"error.guest_limit.message": "ניצלת את כל הבקשות הזמינות לאורחים. התחבר כדי להמשיך בשיחה.",
+		"error.guest_limit.signin":  "התחברות",
+
+		// Agreement auth
+		"password.label":  "סיסמה",
+		"password.button": "כניסה",
+
+		// Email auth
+		"email.sent.title":           "בדוק את תיבת האימייל שלך",
+		"email.sent.heading":         "בדוק את תיבת האימייל שלך",
+		"email.sent.message":         "אם כתובת האימייל שלך מורשית, תקבל בקרוב קישור התחברות.",
+		"email.sent.detail":          "בדוק את תיבת הדואר הנכנס ולחץ על הקישור כדי להתחבר.",
+		"email.sent.otp_label":       "או הזן את הקוד מהאימייל:",
+		"email.sent.otp_placeholder": "XXXX XXXX XXXX",
+		"email.sent.otp_segment":     "תו {n} מתוך {total}",
+		"email.sent.otp_invalid":     "הקוד אינו תקף או שפג תוקפו. נסה שוב.",
+		"email.sent.verify_button":   "אמת קוד",
+		"email.sent.back":            "חזרה להתחברות",
+
+		"email.invalid.title":   "אסימון לא תקין",
+		"email.invalid.heading": "אסימון לא תקין או שפג תוקפו",
+		"email.invalid.message": "קישור ההתחברות אינו תקין או שכבר נעשה בו שימוש.",
+		"email.invalid.retry":   "בקש קישור התחברות חדש",
+
+		// Logout
+		"logout.title":   "התנתקת",
+		"logout.heading": "התנתקת",
+		"logout.message": "התנתקת בהצלחה.",
+		"logout.login":   "התחבר שוב",
+
+		// Scope consent
+		"consent.title":   "הרשאות אופציונליות",
+		"consent.heading": "הרשאות אופציונליות",
+		"consent.message": "ניתן גם להעניק את ההרשאות הבאות. אפשר להתחבר גם בלעדיהן.",
+		"consent.skip":    "דלג",
+
+		// Errors
+		"error.unauthorized":             "לא מורשה",
+		"error.forbidden":                "הגישה נדחתה",
+		"error.forbidden.title":          "הגישה נדחתה",
+		"error.forbidden.heading":        "הגישה נדחתה",
+		"error.forbidden.message":        "שירות זה זמין רק לכתובות אימייל שאושרו מראש. פנה למפעיל השירות.",
+		"error.email_required.title":     "נדרשת כתובת אימייל",
+		"error.email_required.heading":   "נדרשת כתובת אימייל",
+		"error.email_required.message":   "לא ניתן היה לקבל את כתובת האימייל שלך מספק האימות. נסה ספק אחר או פנה למפעיל השירות.",
+		"error.email_unverified.title":   "האימייל לא אומת",
+		"error.email_unverified.heading": "כתובת האימייל לא אומתה",
+		"error.email_unverified.message": "ספק האימות לא אימת את כתובת האימייל שלך. אמת אותה אצל הספק או השתמש בשיטת התחברות אחרת.",
+		"error.internal":                 "שגיאת שרת פנימית",
+		"error.invalid_request":          "בקשה לא תקינה",
+		"error.invalid_email":            "נדרשת כתובת אימייל",
+		"error.rate_limit":               "יותר מדי בקשות. נסה שוב מאוחר יותר.",
+		"error.notfound.title":           "404 - הדף לא נמצא",
+		"error.notfound.heading":         "הדף לא נמצא",
+		"error.notfound.message":         "הדף שחיפשת לא נמצא.",
+		"error.notfound.home":            "חזרה לדף הבית",
+		"error.server.title":             "500 - שגיאת שרת פנימית",
+		"error.server.heading":           "שגיאת שרת פנימית",
+		"error.server.message":           "אירעה שגיאה בלתי צפויה. נסה שוב מאוחר יותר.",
+		"error.server.home":              "חזרה לדף הבית",
+		"error.upstream.title":           "502 - שער שגוי",
+		"error.upstream.heading":         "השירות אינו זמין",
+		"error.upstream.message":         "לא ניתן להתחבר לשירות כרגע. נסה שוב בעוד רגע.",
+		"error.timeout.title":            "504 - תם הזמן הקצוב לשער",
+		"error.timeout.heading":          "השירות לא הגיב בזמן",
+		"error.timeout.message":          "השירות לקח יותר מדי זמן להגיב. נסה שוב בעוד רגע.",
+		"error.upstream.retry":           "נסה שוב",
+		"error.request_id":               "מזהה בקשה",
+		"error.details.title":            "פרטי השגיאה",
+
+		// Theme and Language
+		"ui.theme":                "ערכת נושא",
+		"ui.theme.auto":           "🌗 אוטומטי",
+		"ui.theme.light":          "☀️ בהיר",
+		"ui.theme.dark":           "🌙 כהה",
+		"ui.language":             "שפה",
+		"ui.language.en":          "English",
+		"ui.language.ja":          "日本語",
+		"ui.language.ar":          "العربية",
+		"ui.language.he":          "עברית",
+		"ui.skip_to_content":      "דלג לתוכן הראשי",
+		"ui.announcement.dismiss": "סגירה",
+
+		// Email
+		"email.login.subject":      "קישור התחברות - %s",
+		"email.login.greeting":     "תודה על בקשת ההתחברות.",
+		"email.login.intro1":       "לחץ על הכפתור למטה כדי להתחבר אל %s.",
+		"email.login.intro2":       "הקישור תקף למשך %d דקות.",
+		"email.login.instructions": "לחץ על הכפתור למטה כדי להשלים את ההתחברות:",
+		"email.login.button":       "התחברות",
+		"email.login.otp_label":    "או הזן את הקוד הזה בדף ההתחברות:",
+		"email.login.outro":        "אם לא ביקשת אימייל זה, ניתן להתעלם ממנו בבטחה.",
+		"email.login.trouble":      "אם הכפתור \"%s\" אינו עובד, העתק את כתובת ה-URL שלמטה והדבק אותה בדפדפן.",
+	},
 }
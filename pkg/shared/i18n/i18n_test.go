@@ -139,6 +139,10 @@ func TestNormalizeLanguage(t *testing.T) {
 		{"ja", Japanese},
 		{"JA", Japanese},
 		{"ja-JP", Japanese},
+		{"ar", Arabic},
+		{"ar-EG", Arabic},
+		{"he", Hebrew},
+		{"iw", Hebrew},  // Legacy Hebrew code
 		{"fr", English}, // Unknown defaults to English
 		{"de", English},
 		{"", English},
@@ -155,6 +159,31 @@ func TestNormalizeLanguage(t *testing.T) {
 	}
 }
 
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Language
+		ok       bool
+	}{
+		{"en", English, true},
+		{"ja-JP", Japanese, true},
+		{" JA ", Japanese, true},
+		{"he-IL", Hebrew, true},
+		{"iw", Hebrew, true},
+		{"fr", English, false},
+		{"", English, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, ok := ParseLanguage(tt.input)
+			if result != tt.expected || ok != tt.ok {
+				t.Errorf("ParseLanguage(%q) = (%s, %v), want (%s, %v)", tt.input, result, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
 func TestAllTranslationsExist(t *testing.T) {
 	translator := NewTranslator()
 
@@ -164,17 +193,56 @@ func TestAllTranslationsExist(t *testing.T) {
 		englishKeys[key] = true
 	}
 
-	// Check that all English keys have Japanese translations
-	for key := range englishKeys {
-		if _, ok := translator.translations[Japanese][key]; !ok {
-			t.Errorf("Missing Japanese translation for key: %s", key)
+	for _, lang := range []Language{Japanese, Arabic, Hebrew} {
+		// Check that all English keys have translations
+		for key := range englishKeys {
+			if _, ok := translator.translations[lang][key]; !ok {
+				t.Errorf("Missing %s translation for key: %s", lang, key)
+			}
+		}
+
+		// Check that all translated keys exist in English (to detect orphaned translations)
+		for key := range translator.translations[lang] {
+			if _, ok := englishKeys[key]; !ok {
+				t.Errorf("%s translation exists but English translation missing for key: %s", lang, key)
+			}
 		}
 	}
+}
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		lang Language
+		want string
+	}{
+		{English, "ltr"},
+		{Japanese, "ltr"},
+		{Arabic, "rtl"},
+		{Hebrew, "rtl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.lang), func(t *testing.T) {
+			if got := Direction(tt.lang); got != tt.want {
+				t.Errorf("Direction(%s) = %s, want %s", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
 
-	// Check that all Japanese keys exist in English (to detect orphaned translations)
-	for key := range translator.translations[Japanese] {
-		if _, ok := englishKeys[key]; !ok {
-			t.Errorf("Japanese translation exists but English translation missing for key: %s", key)
+func TestLanguagesAndThemes(t *testing.T) {
+	translator := NewTranslator()
+	for _, lang := range Languages() {
+		if normalizeLanguage(string(lang)) != lang {
+			t.Errorf("normalizeLanguage(%q) = %q, want the language itself", lang, normalizeLanguage(string(lang)))
+		}
+		if _, ok := translator.translations[lang]; !ok {
+			t.Errorf("No translations for language %q", lang)
+		}
+	}
+	for _, theme := range Themes() {
+		if normalizeTheme(string(theme)) != theme {
+			t.Errorf("normalizeTheme(%q) = %q, want the theme itself", theme, normalizeTheme(string(theme)))
 		}
 	}
 }
@@ -0,0 +1,332 @@
+// Package jobs runs periodic background jobs once across the instances sharing a KVS.
+//
+// The instances elect a leader with a lease on the KVS (kvs.Leaser): the leader renews it
+// while running, and only the leader runs the jobs. When the leader stops or dies, another
+// instance takes over within the lease TTL. The last run of each job is kept in the KVS,
+// so the new leader continues the schedule instead of running every job at once.
+//
+// Local jobs run on every instance instead, on their own schedule: they handle state of the
+// instance itself, such as flushing counters kept in memory.
+//
+//	runner := jobs.NewRunner(store, logger)
+//	runner.Add(jobs.Job{Name: "session-gc", Interval: time.Hour, Run: collectSessions})
+//	runner.Start()
+//	defer runner.Stop()
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+)
+
+// DefaultLeaseTTL is how long the leadership lasts without renewal
+const DefaultLeaseTTL = 30 * time.Second
+
+// KeyPrefix is the prefix of the keys the runner writes to the store, for scans to skip them
+const KeyPrefix = "jobs:"
+
+const (
+	leaseKey         = KeyPrefix + "leader"
+	lastRunKeyPrefix = KeyPrefix + "last:"
+)
+
+// Job is a periodic background job
+type Job struct {
+	Name     string        // Unique within the runner; also the KVS key of its last run
+	Interval time.Duration // Time between the starts of two runs
+	Run      func(ctx context.Context) error
+	Local    bool // Runs on every instance, leader or not, on the schedule of this instance
+}
+
+// Status is the state of a job as seen by this instance
+type Status struct {
+	Name         string    `json:"name"`
+	Interval     string    `json:"interval"`
+	Running      bool      `json:"running"`
+	Runs         int       `json:"runs"` // Runs on this instance
+	LastRun      time.Time `json:"last_run,omitempty"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// job is a registered job and its state on this instance
+type job struct {
+	Job
+	running      bool
+	runs         int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    error
+}
+
+// Runner runs the registered jobs while this instance is the leader, and the local jobs always
+type Runner struct {
+	store    kvs.Store
+	leaser   kvs.Leaser // nil when the store cannot hold leases: this instance is always the leader
+	id       string
+	leaseTTL time.Duration
+	logger   logging.Logger
+
+	mu     sync.Mutex
+	jobs   []*job
+	leader bool
+	cancel context.CancelFunc // Cancels the loop and the running jobs
+	done   chan struct{}
+	wg     sync.WaitGroup // Running jobs
+}
+
+// NewRunner creates a runner electing its leader on store
+// Instances compete for the same leadership when their stores share keys (same Redis namespace).
+func NewRunner(store kvs.Store, logger logging.Logger) *Runner {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	leaser, _ := kvs.Uncached(store).(kvs.Leaser)
+	return &Runner{
+		store:    store,
+		leaser:   leaser,
+		id:       hex.EncodeToString(id),
+		leaseTTL: DefaultLeaseTTL,
+		logger:   logger,
+	}
+}
+
+// ID returns the ID of this instance in the election
+func (r *Runner) ID() string {
+	return r.id
+}
+
+// Add registers a job; jobs added after Start run from the next tick
+func (r *Runner) Add(j Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, &job{Job: j})
+}
+
+// Start starts competing for the leadership and running the jobs; it does nothing when started already
+func (r *Runner) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.loop(ctx, r.done)
+}
+
+// Stop stops the jobs, waits for the running ones to return and hands the leadership over
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel = nil
+	r.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+	r.wg.Wait()
+
+	r.mu.Lock()
+	wasLeader := r.leader
+	r.leader = false
+	r.mu.Unlock()
+	if wasLeader && r.leaser != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.leaser.ReleaseLease(ctx, leaseKey, r.id); err != nil {
+			r.logger.Warn("Failed to release job leadership", "error", err)
+		}
+	}
+}
+
+// IsLeader reports whether this instance runs the jobs
+func (r *Runner) IsLeader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.leader
+}
+
+// Statuses returns the state of the jobs on this instance, in registration order
+func (r *Runner) Statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		status := Status{
+			Name:     j.Name,
+			Interval: j.Interval.String(),
+			Running:  j.running,
+			Runs:     j.runs,
+			LastRun:  j.lastRun,
+		}
+		if !j.lastRun.IsZero() {
+			status.LastDuration = j.lastDuration.String()
+		}
+		if j.lastError != nil {
+			status.LastError = j.lastError.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// loop renews the leadership and starts the due jobs every third of the lease TTL
+func (r *Runner) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.leaseTTL / 3)
+	defer ticker.Stop()
+
+	// The jobs started during a leadership are canceled when it is lost
+	var lead *leadership
+	defer func() { lead.end() }()
+
+	for {
+		leader := r.elect(ctx)
+		switch {
+		case leader && lead == nil:
+			lead = newLeadership(ctx)
+		case !leader && lead != nil:
+			lead.end()
+			lead = nil
+		}
+		if leader {
+			r.runDue(lead.ctx, false)
+		}
+		r.runDue(ctx, true)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leadership is the context of the jobs started while this instance leads
+type leadership struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newLeadership(parent context.Context) *leadership {
+	ctx, cancel := context.WithCancel(parent)
+	return &leadership{ctx: ctx, cancel: cancel}
+}
+
+// end cancels the jobs of the leadership; it does nothing on nil
+func (l *leadership) end() {
+	if l != nil {
+		l.cancel()
+	}
+}
+
+// elect acquires or renews the lease and reports whether this instance is the leader
+func (r *Runner) elect(ctx context.Context) bool {
+	leader := true
+	if r.leaser != nil {
+		var err error
+		leader, err = r.leaser.AcquireLease(ctx, leaseKey, r.id, r.leaseTTL)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Warn("Failed to renew job leadership", "error", err)
+			}
+			// Another instance may take over when the lease expires: stop before it does
+			leader = false
+		}
+	}
+
+	r.mu.Lock()
+	changed := leader != r.leader
+	r.leader = leader
+	r.mu.Unlock()
+	if changed && leader {
+		r.logger.Info("Became job leader", "instance", r.id)
+	} else if changed {
+		r.logger.Info("Lost job leadership", "instance", r.id)
+	}
+	return leader
+}
+
+// runDue starts the local or the leader's jobs whose interval has passed since their last run
+func (r *Runner) runDue(ctx context.Context, local bool) {
+	r.mu.Lock()
+	jobs := append([]*job(nil), r.jobs...)
+	r.mu.Unlock()
+
+	for _, j := range jobs {
+		if j.Local != local {
+			continue
+		}
+		r.mu.Lock()
+		running, lastRun := j.running, j.lastRun
+		r.mu.Unlock()
+		if running {
+			continue
+		}
+		if local && !lastRun.IsZero() && time.Since(lastRun) < j.Interval {
+			continue
+		}
+		if !local && !r.due(ctx, j) {
+			continue
+		}
+
+		r.mu.Lock()
+		j.running = true
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go r.run(ctx, j)
+	}
+}
+
+// due reports whether a job of the leader should start, and records its start in the KVS for the other instances
+func (r *Runner) due(ctx context.Context, j *job) bool {
+	key := lastRunKeyPrefix + j.Name
+	now := time.Now()
+	if raw, err := r.store.Get(ctx, key); err == nil {
+		if last, err := time.Parse(time.RFC3339Nano, string(raw)); err == nil && now.Sub(last) < j.Interval {
+			return false
+		}
+	}
+
+	// Kept one leadership longer than the interval, so a new leader knows the last run
+	if err := r.store.Set(ctx, key, []byte(now.Format(time.RFC3339Nano)), j.Interval+r.leaseTTL); err != nil {
+		r.logger.Warn("Failed to record job run", "job", j.Name, "error", err)
+	}
+	return true
+}
+
+// run runs a job and records the outcome
+func (r *Runner) run(ctx context.Context, j *job) {
+	defer r.wg.Done()
+
+	started := time.Now()
+	err := j.Run(ctx)
+	duration := time.Since(started)
+
+	r.mu.Lock()
+	j.running = false
+	j.runs++
+	j.lastRun = started
+	j.lastDuration = duration
+	j.lastError = err
+	r.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil {
+		r.logger.Warn("Job failed", "job", j.Name, "duration", duration, "error", err)
+	} else {
+		r.logger.Debug("Job finished", "job", j.Name, "duration", duration)
+	}
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/kvs"
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner creates a runner with a short lease, ticking every 10ms
+func newTestRunner(store kvs.Store) *Runner {
+	r := NewRunner(store, logging.NewTestLogger())
+	r.leaseTTL = 30 * time.Millisecond
+	return r
+}
+
+func TestRunner_RunsOnceAcrossInstances(t *testing.T) {
+	store, err := kvs.NewMemoryStore("jobs", kvs.MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	// Instances sharing one store compete for the same leadership
+	var runs atomic.Int32
+	first, second := newTestRunner(store), newTestRunner(store)
+	for _, r := range []*Runner{first, second} {
+		r.Add(Job{Name: "hourly", Interval: time.Hour, Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}})
+	}
+
+	first.Start()
+	require.Eventually(t, first.IsLeader, time.Second, 5*time.Millisecond)
+	second.Start()
+	defer second.Stop()
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, second.IsLeader(), "Only one instance should lead")
+
+	// The other instance takes over, and continues the schedule from the last run
+	first.Stop()
+	assert.False(t, first.IsLeader())
+	require.Eventually(t, second.IsLeader, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load(), "The new leader should not run the job again before its interval")
+
+	statuses := first.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, 1, statuses[0].Runs)
+	assert.Equal(t, "1h0m0s", statuses[0].Interval)
+	assert.Zero(t, second.Statuses()[0].Runs)
+}
+
+func TestRunner_LocalJobsRunOnEveryInstance(t *testing.T) {
+	store, err := kvs.NewMemoryStore("jobs", kvs.MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	var firstRuns, secondRuns atomic.Int32
+	first, second := newTestRunner(store), newTestRunner(store)
+	first.Add(Job{Name: "flush", Interval: time.Hour, Local: true, Run: func(ctx context.Context) error {
+		firstRuns.Add(1)
+		return nil
+	}})
+	second.Add(Job{Name: "flush", Interval: time.Hour, Local: true, Run: func(ctx context.Context) error {
+		secondRuns.Add(1)
+		return nil
+	}})
+
+	first.Start()
+	require.Eventually(t, first.IsLeader, time.Second, 5*time.Millisecond)
+	defer first.Stop()
+	second.Start()
+	defer second.Stop()
+
+	require.Eventually(t, func() bool { return firstRuns.Load() == 1 && secondRuns.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.False(t, second.IsLeader())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), secondRuns.Load(), "A local job should wait for its interval")
+}
+
+func TestRunner_IntervalAndErrors(t *testing.T) {
+	store, err := kvs.NewMemoryStore("jobs", kvs.MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	var runs atomic.Int32
+	r := newTestRunner(store)
+	r.Add(Job{Name: "frequent", Interval: 15 * time.Millisecond, Run: func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("boom")
+	}})
+	r.Start()
+	r.Start() // No second loop
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	r.Stop()
+	r.Stop()
+
+	status := r.Statuses()[0]
+	assert.Equal(t, "boom", status.LastError)
+	assert.False(t, status.Running)
+	assert.NotZero(t, status.LastRun)
+}
+
+func TestRunner_StopCancelsRunningJobs(t *testing.T) {
+	store, err := kvs.NewMemoryStore("jobs", kvs.MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	started := make(chan struct{})
+	r := newTestRunner(store)
+	r.Add(Job{Name: "long", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	r.Start()
+	<-started
+	r.Stop() // Returns once the job has seen the cancellation
+
+	assert.Equal(t, context.Canceled.Error(), r.Statuses()[0].LastError)
+}
@@ -0,0 +1,215 @@
+package kvs
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// CacheConfig configures the in-process read cache in front of a store (see NewCachedStore).
+type CacheConfig struct {
+	// Enabled turns the cache on
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Size is the maximum number of cached keys.
+	// Default: 10000
+	Size int `yaml:"size" json:"size"`
+
+	// TTL is how long a read value is served from memory without asking the store.
+	// Changes made by other processes are seen at most this late when the store
+	// cannot broadcast invalidations (Redis can), and keys expiring in the store may be
+	// served until then: only cache data that carries its own expiry, like sessions.
+	// Default: "5s"
+	TTL string `yaml:"ttl" json:"ttl"`
+}
+
+// DefaultCacheTTL is how long a read value is cached without CacheConfig.TTL
+const DefaultCacheTTL = 5 * time.Second
+
+// GetTTL returns how long a read value is served from memory
+// If not set or invalid, returns DefaultCacheTTL
+func (c CacheConfig) GetTTL() time.Duration {
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil || ttl <= 0 {
+		return DefaultCacheTTL
+	}
+	return ttl
+}
+
+// Invalidator is implemented by stores shared between processes that can tell
+// the other processes which keys were changed (RedisStore, with pub/sub).
+type Invalidator interface {
+	// PublishInvalidation announces that key was changed or deleted.
+	PublishInvalidation(ctx context.Context, key string) error
+
+	// SubscribeInvalidations calls fn with the keys announced by any process until the returned stop function is called.
+	SubscribeInvalidations(fn func(key string)) (stop func() error, err error)
+}
+
+// cacheEntry is a cached value of a key.
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// CachedStore is a Store that serves repeated reads of a key from memory for a short time.
+// Values are kept in an LRU of bounded size. Set and Delete invalidate the key locally and,
+// when the store is an Invalidator, in the other processes sharing it.
+type CachedStore struct {
+	Store
+	size        int
+	ttl         time.Duration
+	invalidator Invalidator
+	stop        func() error
+	clock       clock.Clock
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // Front is the most recently used
+	generation uint64     // Incremented on every invalidation, so reads racing with one are not cached
+}
+
+// NewCachedStore wraps store with an in-process read cache.
+// When store is an Invalidator, invalidations of other processes are subscribed to;
+// if the subscription fails, the cache falls back to expiring values after the TTL.
+func NewCachedStore(store Store, cfg CacheConfig) *CachedStore {
+	size := cfg.Size
+	if size <= 0 {
+		size = 10000
+	}
+	c := &CachedStore{
+		Store:   store,
+		size:    size,
+		ttl:     cfg.GetTTL(),
+		clock:   clock.Real,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	if invalidator, ok := store.(Invalidator); ok {
+		if stop, err := invalidator.SubscribeInvalidations(c.invalidate); err == nil {
+			c.invalidator = invalidator
+			c.stop = stop
+		}
+	}
+
+	return c
+}
+
+// SetClock sets the time source of the cache TTL (nil restores the system clock)
+func (c *CachedStore) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock.OrReal(clk)
+}
+
+// Uncached returns the store behind a CachedStore, or store itself.
+// Read-modify-write sequences use it to read the current value.
+func Uncached(store Store) Store {
+	if c, ok := store.(*CachedStore); ok {
+		return c.Store
+	}
+	return store
+}
+
+// Get retrieves a value by key, from memory when it was read recently.
+func (c *CachedStore) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	now := c.clock.Now()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if now.Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			return append([]byte(nil), entry.value...), nil
+		}
+		c.removeElement(elem)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.add(key, append([]byte(nil), value...), now.Add(c.ttl))
+	}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// Set stores a value and invalidates the cached one.
+func (c *CachedStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	err := c.Store.Set(ctx, key, value, ttl)
+	c.invalidateEverywhere(ctx, key)
+	return err
+}
+
+// Delete removes a key and invalidates the cached value.
+func (c *CachedStore) Delete(ctx context.Context, key string) error {
+	err := c.Store.Delete(ctx, key)
+	c.invalidateEverywhere(ctx, key)
+	return err
+}
+
+// Close stops the invalidation subscription and closes the store.
+func (c *CachedStore) Close() error {
+	if c.stop != nil {
+		_ = c.stop()
+	}
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+	return c.Store.Close()
+}
+
+// invalidateEverywhere drops key from this cache and announces the change to the other processes.
+// A failed announcement is not an error of the write: other caches expire the key after the TTL.
+func (c *CachedStore) invalidateEverywhere(ctx context.Context, key string) {
+	c.invalidate(key)
+	if c.invalidator != nil {
+		_ = c.invalidator.PublishInvalidation(ctx, key)
+	}
+}
+
+// invalidate drops key from the cache.
+func (c *CachedStore) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// add caches value for key, evicting the least recently used key when the cache is full.
+func (c *CachedStore) add(key string, value []byte, expiresAt time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	if c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement removes an entry from the LRU and the index.
+func (c *CachedStore) removeElement(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,174 @@
+package kvs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// countingStore counts the reads that reach the store
+type countingStore struct {
+	Store
+	gets int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.gets++
+	return s.Store.Get(ctx, key)
+}
+
+func newTestCachedStore(t *testing.T, cfg CacheConfig) (*CachedStore, *countingStore, *clock.Fake) {
+	t.Helper()
+
+	memory, err := NewMemoryStore("cache-test", MemoryConfig{})
+	require.NoError(t, err)
+	backend := &countingStore{Store: memory}
+
+	cache := NewCachedStore(backend, cfg)
+	t.Cleanup(func() { _ = cache.Close() })
+
+	fake := clock.NewFake(time.Now())
+	cache.SetClock(fake)
+	return cache, backend, fake
+}
+
+// TestCachedStoreContract runs contract tests for CachedStore over MemoryStore
+func TestCachedStoreContract(t *testing.T) {
+	memory, err := NewMemoryStore("", MemoryConfig{CleanupInterval: 100 * time.Millisecond})
+	require.NoError(t, err, "Should create MemoryStore")
+	store := NewCachedStore(memory, CacheConfig{Enabled: true})
+
+	suite := NewContractTestSuite(t, store, func() { _ = store.Close() })
+	suite.RunAll()
+}
+
+func TestCachedStore_ServesReadsFromMemory(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, fake := newTestCachedStore(t, CacheConfig{TTL: "1s"})
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("v1"), 0))
+	for i := 0; i < 3; i++ {
+		value, err := cache.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("v1"), value)
+	}
+	assert.Equal(t, 1, backend.gets, "Only the first read should reach the store")
+
+	// Changes made behind the cache are seen after the TTL
+	require.NoError(t, backend.Store.Set(ctx, "key", []byte("v2"), 0))
+	value, _ := cache.Get(ctx, "key")
+	assert.Equal(t, []byte("v1"), value)
+
+	fake.Advance(time.Second)
+	value, _ = cache.Get(ctx, "key")
+	assert.Equal(t, []byte("v2"), value)
+	assert.Equal(t, 2, backend.gets)
+}
+
+func TestCachedStore_ReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestCachedStore(t, CacheConfig{})
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), 0))
+	value, _ := cache.Get(ctx, "key")
+	value[0] = 'X'
+
+	value, _ = cache.Get(ctx, "key")
+	assert.Equal(t, []byte("value"), value, "Callers must not be able to modify the cached value")
+}
+
+func TestCachedStore_WritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestCachedStore(t, CacheConfig{TTL: "1h"})
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("v1"), 0))
+	_, _ = cache.Get(ctx, "key")
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("v2"), 0))
+	value, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), value, "Set should invalidate the cached value")
+
+	require.NoError(t, cache.Delete(ctx, "key"))
+	_, err = cache.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound, "Delete should invalidate the cached value")
+}
+
+func TestCachedStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, _ := newTestCachedStore(t, CacheConfig{Size: 2, TTL: "1h"})
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, cache.Set(ctx, key, []byte(key), 0))
+	}
+	_, _ = cache.Get(ctx, "a")
+	_, _ = cache.Get(ctx, "b")
+	_, _ = cache.Get(ctx, "a") // a is now more recently used than b
+	_, _ = cache.Get(ctx, "c") // Evicts b
+	assert.Equal(t, 3, backend.gets)
+
+	_, _ = cache.Get(ctx, "a")
+	_, _ = cache.Get(ctx, "c")
+	assert.Equal(t, 3, backend.gets, "a and c should still be cached")
+
+	_, _ = cache.Get(ctx, "b")
+	assert.Equal(t, 4, backend.gets, "b should have been evicted")
+}
+
+func TestUncached(t *testing.T) {
+	cache, backend, _ := newTestCachedStore(t, CacheConfig{})
+
+	assert.Same(t, Store(backend), Uncached(cache))
+	assert.Same(t, Store(backend), Uncached(backend))
+}
+
+func TestCachedStore_RedisInvalidation(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	newReplica := func() *CachedStore {
+		store, err := NewRedisStore("session", RedisConfig{Addr: server.Addr()})
+		require.NoError(t, err)
+		cache := NewCachedStore(store, CacheConfig{TTL: "1h"})
+		t.Cleanup(func() { _ = cache.Close() })
+		return cache
+	}
+	replica1, replica2 := newReplica(), newReplica()
+
+	require.NoError(t, replica1.Set(ctx, "sess-1", []byte("alive"), 0))
+	value, err := replica2.Get(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("alive"), value)
+
+	// A logout on one replica evicts the session from the other's cache
+	require.NoError(t, replica1.Delete(ctx, "sess-1"))
+	assert.Eventually(t, func() bool {
+		_, err := replica2.Get(ctx, "sess-1")
+		return err == ErrNotFound
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func BenchmarkCachedStore_Get(b *testing.B) {
+	ctx := context.Background()
+	memory, err := NewMemoryStore("bench", MemoryConfig{})
+	require.NoError(b, err)
+	cache := NewCachedStore(memory, CacheConfig{})
+	defer func() { _ = cache.Close() }()
+
+	for i := 0; i < 100; i++ {
+		_ = cache.Set(ctx, fmt.Sprintf("key-%d", i), []byte(`{"email":"user@example.com"}`), 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.Get(ctx, "key-42")
+	}
+}
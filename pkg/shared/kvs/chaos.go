@@ -0,0 +1,284 @@
+package kvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by a ChaosStore for the failures it injects.
+var ErrInjected = errors.New("kvs: injected failure")
+
+// ChaosConfig configures the faults a ChaosStore injects (see NewChaosStore).
+type ChaosConfig struct {
+	// Latency is added to every operation.
+	Latency time.Duration
+
+	// Jitter is a random extra latency of up to this duration.
+	Jitter time.Duration
+
+	// ErrorRate is the probability (0 to 1) that an operation fails with ErrInjected without reaching the store.
+	ErrorRate float64
+
+	// PartialRate is the probability (0 to 1) that a write (Set, Delete) reaches the store but fails with ErrInjected,
+	// like a Redis command whose reply is lost, and that List returns part of the keys only.
+	PartialRate float64
+}
+
+// ParseChaos parses a fault specification of comma-separated key=value pairs,
+// e.g. "latency=50ms,jitter=20ms,error_rate=0.05,partial_rate=0.01" (the --chaos flag).
+func ParseChaos(spec string) (ChaosConfig, error) {
+	var cfg ChaosConfig
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		var err error
+		switch key {
+		case "latency":
+			cfg.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			cfg.Jitter, err = time.ParseDuration(value)
+		case "error_rate":
+			cfg.ErrorRate, err = parseRate(value)
+		case "partial_rate":
+			cfg.PartialRate, err = parseRate(value)
+		default:
+			return ChaosConfig{}, fmt.Errorf("kvs: unknown chaos setting %q (latency, jitter, error_rate or partial_rate)", key)
+		}
+		if err != nil {
+			return ChaosConfig{}, fmt.Errorf("kvs: invalid chaos setting %q: %w", pair, err)
+		}
+	}
+	return cfg, nil
+}
+
+// parseRate parses a probability between 0 and 1.
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, errors.New("must be between 0 and 1")
+	}
+	return rate, nil
+}
+
+// ChaosStore is a Store that injects latency and failures into the operations of the store it wraps,
+// so tests (and the --chaos dev flag) can check that callers degrade gracefully when the KVS blips.
+// Leases, broadcasts and invalidations are passed to the wrapped store (behind a CachedStore) with the same faults.
+type ChaosStore struct {
+	Store
+	cfg ChaosConfig
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	down bool
+}
+
+// NewChaosStore wraps store with fault injection.
+func NewChaosStore(store Store, cfg ChaosConfig) *ChaosStore {
+	return &ChaosStore{
+		Store: store,
+		cfg:   cfg,
+		rand:  rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+// SetDown makes every operation fail with ErrInjected until it is called with false, like a store outage.
+func (c *ChaosStore) SetDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+// Seed makes the injected faults reproducible.
+func (c *ChaosStore) Seed(seed uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rand = rand.New(rand.NewPCG(seed, seed))
+}
+
+// chaosOutcome is the fault injected into an operation.
+type chaosOutcome int
+
+const (
+	chaosNone    chaosOutcome = iota // The operation reaches the store
+	chaosFail                        // The operation fails before reaching the store
+	chaosPartial                     // The operation reaches the store, but its result is damaged
+)
+
+// inject waits for the latency and decides the fault of an operation.
+func (c *ChaosStore) inject(ctx context.Context) (chaosOutcome, error) {
+	c.mu.Lock()
+	delay := c.cfg.Latency
+	if c.cfg.Jitter > 0 {
+		delay += time.Duration(c.rand.Int64N(int64(c.cfg.Jitter)))
+	}
+	roll := c.rand.Float64()
+	down := c.down
+	c.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return chaosFail, ctx.Err()
+		}
+	}
+
+	switch {
+	case down || roll < c.cfg.ErrorRate:
+		return chaosFail, ErrInjected
+	case roll < c.cfg.ErrorRate+c.cfg.PartialRate:
+		return chaosPartial, nil
+	default:
+		return chaosNone, nil
+	}
+}
+
+// Get retrieves a value by key, unless a failure is injected.
+func (c *ChaosStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return nil, err
+	}
+	return c.Store.Get(ctx, key)
+}
+
+// Set stores a value, unless a failure is injected; partial failures store it and report an error.
+func (c *ChaosStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	outcome, err := c.inject(ctx)
+	if outcome == chaosFail {
+		return err
+	}
+	if err := c.Store.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	if outcome == chaosPartial {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Delete removes a key, unless a failure is injected; partial failures remove it and report an error.
+func (c *ChaosStore) Delete(ctx context.Context, key string) error {
+	outcome, err := c.inject(ctx)
+	if outcome == chaosFail {
+		return err
+	}
+	if err := c.Store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if outcome == chaosPartial {
+		return ErrInjected
+	}
+	return nil
+}
+
+// Exists checks if a key exists, unless a failure is injected.
+func (c *ChaosStore) Exists(ctx context.Context, key string) (bool, error) {
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return false, err
+	}
+	return c.Store.Exists(ctx, key)
+}
+
+// List returns the keys matching a prefix, unless a failure is injected; partial failures return half of them.
+func (c *ChaosStore) List(ctx context.Context, prefix string) ([]string, error) {
+	outcome, err := c.inject(ctx)
+	if outcome == chaosFail {
+		return nil, err
+	}
+	keys, err := c.Store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if outcome == chaosPartial {
+		keys = keys[:len(keys)/2]
+	}
+	return keys, nil
+}
+
+// Count returns the number of keys matching a prefix, unless a failure is injected.
+func (c *ChaosStore) Count(ctx context.Context, prefix string) (int, error) {
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return 0, err
+	}
+	return c.Store.Count(ctx, prefix)
+}
+
+// AcquireLease acquires a lease on the wrapped store, unless a failure is injected.
+func (c *ChaosStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	leaser, ok := Uncached(c.Store).(Leaser)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return false, err
+	}
+	return leaser.AcquireLease(ctx, key, holder, ttl)
+}
+
+// ReleaseLease releases a lease on the wrapped store, unless a failure is injected.
+func (c *ChaosStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	leaser, ok := Uncached(c.Store).(Leaser)
+	if !ok {
+		return ErrNotSupported
+	}
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return err
+	}
+	return leaser.ReleaseLease(ctx, key, holder)
+}
+
+// Broadcast sends payload through the wrapped store, unless a failure is injected.
+func (c *ChaosStore) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	broadcaster, ok := Uncached(c.Store).(Broadcaster)
+	if !ok {
+		return ErrNotSupported
+	}
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return err
+	}
+	return broadcaster.Broadcast(ctx, topic, payload)
+}
+
+// SubscribeBroadcasts subscribes to topic on the wrapped store.
+func (c *ChaosStore) SubscribeBroadcasts(topic string, fn func(payload []byte)) (func() error, error) {
+	broadcaster, ok := Uncached(c.Store).(Broadcaster)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return broadcaster.SubscribeBroadcasts(topic, fn)
+}
+
+// PublishInvalidation announces a changed key through the wrapped store, unless a failure is injected.
+func (c *ChaosStore) PublishInvalidation(ctx context.Context, key string) error {
+	invalidator, ok := Uncached(c.Store).(Invalidator)
+	if !ok {
+		return ErrNotSupported
+	}
+	if outcome, err := c.inject(ctx); outcome == chaosFail {
+		return err
+	}
+	return invalidator.PublishInvalidation(ctx, key)
+}
+
+// SubscribeInvalidations subscribes to the invalidations of the wrapped store.
+func (c *ChaosStore) SubscribeInvalidations(fn func(key string)) (func() error, error) {
+	invalidator, ok := Uncached(c.Store).(Invalidator)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return invalidator.SubscribeInvalidations(fn)
+}
@@ -0,0 +1,115 @@
+package kvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChaosTestStore(t *testing.T, cfg ChaosConfig) (*ChaosStore, Store) {
+	t.Helper()
+	store, err := NewMemoryStore("chaos-test", MemoryConfig{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	chaos := NewChaosStore(store, cfg)
+	chaos.Seed(1)
+	return chaos, store
+}
+
+func TestParseChaos(t *testing.T) {
+	cfg, err := ParseChaos("latency=50ms, jitter=20ms,error_rate=0.05,partial_rate=0.01")
+	require.NoError(t, err)
+	assert.Equal(t, ChaosConfig{Latency: 50 * time.Millisecond, Jitter: 20 * time.Millisecond, ErrorRate: 0.05, PartialRate: 0.01}, cfg)
+
+	for _, spec := range []string{"latency=soon", "error_rate=2", "partial_rate=-0.1", "timeout=1s"} {
+		_, err := ParseChaos(spec)
+		assert.Error(t, err, "ParseChaos(%q) should fail", spec)
+	}
+}
+
+func TestChaosStore_ErrorRate(t *testing.T) {
+	chaos, _ := newChaosTestStore(t, ChaosConfig{ErrorRate: 0.5})
+	ctx := context.Background()
+
+	failures := 0
+	for i := 0; i < 200; i++ {
+		if err := chaos.Set(ctx, fmt.Sprintf("key-%d", i), []byte("v"), 0); err != nil {
+			require.ErrorIs(t, err, ErrInjected)
+			failures++
+		}
+	}
+	assert.InDelta(t, 100, failures, 30, "About half of the operations should fail")
+}
+
+func TestChaosStore_PartialFailure(t *testing.T) {
+	chaos, store := newChaosTestStore(t, ChaosConfig{PartialRate: 1})
+	ctx := context.Background()
+
+	// The write reaches the store, but the caller sees an error
+	require.ErrorIs(t, chaos.Set(ctx, "a", []byte("1"), 0), ErrInjected)
+	value, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), 0))
+	keys, err := chaos.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1, "List should return part of the keys")
+}
+
+func TestChaosStore_Down(t *testing.T) {
+	chaos, _ := newChaosTestStore(t, ChaosConfig{})
+	ctx := context.Background()
+	require.NoError(t, chaos.Set(ctx, "key", []byte("v"), 0))
+
+	chaos.SetDown(true)
+	_, err := chaos.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrInjected)
+	_, err = chaos.AcquireLease(ctx, "lease", "a", time.Second)
+	assert.ErrorIs(t, err, ErrInjected)
+
+	chaos.SetDown(false)
+	value, err := chaos.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
+
+func TestChaosStore_Latency(t *testing.T) {
+	chaos, _ := newChaosTestStore(t, ChaosConfig{Latency: 50 * time.Millisecond})
+
+	started := time.Now()
+	_, _ = chaos.Exists(context.Background(), "key")
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	// The latency honors the caller's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := chaos.Get(ctx, "key")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "Get error = %v, want the deadline", err)
+}
+
+func TestChaosStore_PubSub(t *testing.T) {
+	store, err := NewMemoryStore("chaos-pubsub", MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	// Without pub/sub in the wrapped store, the capability is reported as missing
+	_, err = NewChaosStore(store, ChaosConfig{}).SubscribeBroadcasts("topic", func([]byte) {})
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	chaos := NewChaosStore(NewMemoryPubSub().Connect(store), ChaosConfig{})
+	var received []string
+	stop, err := chaos.SubscribeBroadcasts("topic", func(payload []byte) { received = append(received, string(payload)) })
+	require.NoError(t, err)
+	defer func() { _ = stop() }()
+
+	require.NoError(t, chaos.Broadcast(context.Background(), "topic", []byte("hello")))
+	chaos.SetDown(true)
+	assert.ErrorIs(t, chaos.Broadcast(context.Background(), "topic", []byte("lost")), ErrInjected)
+	assert.Equal(t, []string{"hello"}, received)
+}
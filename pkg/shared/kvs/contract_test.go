@@ -43,6 +43,7 @@ func (s *ContractTestSuite) RunAll() {
 	s.t.Run("CountWithPrefix", func(t *testing.T) { s.TestCountWithPrefix() })
 	s.t.Run("TTLExpiration", func(t *testing.T) { s.TestTTLExpiration() })
 	s.t.Run("OverwriteKey", func(t *testing.T) { s.TestOverwriteKey() })
+	s.t.Run("Lease", func(t *testing.T) { s.TestLease() })
 	s.t.Run("Close", func(t *testing.T) { s.TestClose() })
 	s.t.Run("OperationsAfterClose", func(t *testing.T) { s.TestOperationsAfterClose() })
 
@@ -304,6 +305,44 @@ func (s *ContractTestSuite) TestOverwriteKey() {
 	_ = s.store.Delete(ctx, "overwrite-key")
 }
 
+// TestLease tests that a lease has one holder at a time, until released or expired
+func (s *ContractTestSuite) TestLease() {
+	// Wrappers such as CachedStore leave leases to the store they wrap
+	leaser, ok := Uncached(s.store).(Leaser)
+	require.True(s.t, ok, "Store should implement Leaser")
+	ctx := context.Background()
+
+	acquired, err := leaser.AcquireLease(ctx, "lease-key", "a", 200*time.Millisecond)
+	require.NoError(s.t, err)
+	assert.True(s.t, acquired, "Free lease should be acquired")
+
+	acquired, err = leaser.AcquireLease(ctx, "lease-key", "b", time.Second)
+	require.NoError(s.t, err)
+	assert.False(s.t, acquired, "Lease held by another holder should not be acquired")
+
+	acquired, err = leaser.AcquireLease(ctx, "lease-key", "a", 200*time.Millisecond)
+	require.NoError(s.t, err)
+	assert.True(s.t, acquired, "Holder should renew its lease")
+
+	// Releasing someone else's lease does nothing
+	require.NoError(s.t, leaser.ReleaseLease(ctx, "lease-key", "b"))
+	acquired, err = leaser.AcquireLease(ctx, "lease-key", "b", time.Second)
+	require.NoError(s.t, err)
+	assert.False(s.t, acquired, "Lease should still be held after a release by another holder")
+
+	require.NoError(s.t, leaser.ReleaseLease(ctx, "lease-key", "a"))
+	acquired, err = leaser.AcquireLease(ctx, "lease-key", "b", 200*time.Millisecond)
+	require.NoError(s.t, err)
+	assert.True(s.t, acquired, "Released lease should be acquired by another holder")
+
+	time.Sleep(300 * time.Millisecond)
+	acquired, err = leaser.AcquireLease(ctx, "lease-key", "a", time.Second)
+	require.NoError(s.t, err)
+	assert.True(s.t, acquired, "Expired lease should be acquired by another holder")
+
+	_ = s.store.Delete(ctx, "lease-key")
+}
+
 // TestClose tests that Close works without error
 func (s *ContractTestSuite) TestClose() {
 	// Note: We don't actually call Close here because it would break subsequent tests
@@ -534,3 +573,37 @@ func TestRedisStoreCloseOperations(t *testing.T) {
 	_, err = store.Count(ctx, "")
 	assert.Equal(t, ErrClosed, err, "Count after Close should return ErrClosed")
 }
+
+// TestChaosStoreContract runs contract tests for a ChaosStore injecting no failures
+// Fault injection must not change the behavior of the store it wraps.
+func TestChaosStoreContract(t *testing.T) {
+	store, err := NewMemoryStore("chaos", MemoryConfig{CleanupInterval: 100 * time.Millisecond})
+	require.NoError(t, err, "Should create MemoryStore")
+
+	chaos := NewChaosStore(store, ChaosConfig{Latency: time.Millisecond})
+	suite := NewContractTestSuite(t, chaos, func() { _ = chaos.Close() })
+	suite.RunAll()
+}
+
+// TestPubSubStoreContract runs contract tests for a store connected to a MemoryPubSub
+func TestPubSubStoreContract(t *testing.T) {
+	store, err := NewMemoryStore("pubsub", MemoryConfig{CleanupInterval: 100 * time.Millisecond})
+	require.NoError(t, err, "Should create MemoryStore")
+
+	connected := NewMemoryPubSub().Connect(store)
+	suite := NewContractTestSuite(t, connected, func() { _ = connected.Close() })
+	suite.RunAll()
+}
+
+// TestFallbackStoreContract runs contract tests for a FallbackStore with a healthy primary
+func TestFallbackStoreContract(t *testing.T) {
+	store, err := New(Config{
+		Type:     "memory",
+		Memory:   MemoryConfig{CleanupInterval: 100 * time.Millisecond},
+		Fallback: &Config{Type: "memory", Memory: MemoryConfig{CleanupInterval: 100 * time.Millisecond}},
+	})
+	require.NoError(t, err, "Should create FallbackStore")
+
+	suite := NewContractTestSuite(t, store, func() { _ = store.Close() })
+	suite.RunAll()
+}
@@ -0,0 +1,326 @@
+package kvs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// fallbackRetryInterval is how often a FallbackStore tries the primary again while it is down, by default.
+const fallbackRetryInterval = 5 * time.Second
+
+// fallbackReadTTL is how long a value read from the primary is kept in the secondary,
+// when this process did not write it (and so does not know its TTL).
+const fallbackReadTTL = time.Hour
+
+// pendingWrite is a write made to the secondary only while the primary was down.
+type pendingWrite struct {
+	deleted   bool
+	expiresAt time.Time // Zero: no expiry
+}
+
+// FallbackStore is a Store that uses a primary store (Redis) and falls back to a secondary store
+// (memory or LevelDB) while the primary fails, so a brief outage does not log everyone out.
+//
+// While the primary is up, writes go to both stores and values read from the primary are kept in
+// the secondary. When a primary operation fails, the store is degraded: operations use the secondary,
+// and the primary is tried again every retry interval. On recovery, the keys written during the
+// outage are copied to the primary (overwriting changes other processes made there meanwhile)
+// before it is used again. Leases, broadcasts and invalidations use the primary only.
+type FallbackStore struct {
+	primary       Store
+	secondary     Store
+	retryInterval time.Duration
+	clock         clock.Clock
+
+	mu        sync.Mutex
+	down      bool
+	lastTry   time.Time
+	pending   map[string]pendingWrite
+	reconcile sync.Mutex // Held while the pending writes are copied to the primary
+}
+
+// NewFallbackStore combines primary and secondary; retryInterval <= 0 uses 5 seconds.
+func NewFallbackStore(primary, secondary Store, retryInterval time.Duration) *FallbackStore {
+	if retryInterval <= 0 {
+		retryInterval = fallbackRetryInterval
+	}
+	return &FallbackStore{
+		primary:       primary,
+		secondary:     secondary,
+		retryInterval: retryInterval,
+		clock:         clock.Real,
+		pending:       make(map[string]pendingWrite),
+	}
+}
+
+// SetClock replaces the clock of the retry interval and of the expiry of pending writes.
+func (f *FallbackStore) SetClock(clk clock.Clock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clock = clock.OrReal(clk)
+}
+
+// Degraded reports whether the primary is down and the secondary is in use.
+func (f *FallbackStore) Degraded() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.down
+}
+
+// usePrimary reports whether an operation should try the primary: it is up, or due for a retry.
+// A retry that succeeds first copies the writes of the outage to the primary (see recover).
+func (f *FallbackStore) usePrimary(ctx context.Context) bool {
+	f.mu.Lock()
+	if !f.down {
+		f.mu.Unlock()
+		return true
+	}
+	now := f.clock.Now()
+	if now.Sub(f.lastTry) < f.retryInterval {
+		f.mu.Unlock()
+		return false
+	}
+	f.lastTry = now
+	f.mu.Unlock()
+
+	return f.recover(ctx)
+}
+
+// recover copies the pending writes to the primary and marks it up, or reports false when it still fails.
+func (f *FallbackStore) recover(ctx context.Context) bool {
+	f.reconcile.Lock()
+	defer f.reconcile.Unlock()
+
+	f.mu.Lock()
+	pending := f.pending
+	f.pending = make(map[string]pendingWrite)
+	now := f.clock.Now()
+	f.mu.Unlock()
+
+	for key, write := range pending {
+		if err := f.replay(ctx, key, write, now); err != nil {
+			// Keep the writes not replayed yet for the next retry, unless the key was written again meanwhile
+			f.mu.Lock()
+			for key, write := range pending {
+				if _, ok := f.pending[key]; !ok {
+					f.pending[key] = write
+				}
+			}
+			f.mu.Unlock()
+			return false
+		}
+		delete(pending, key)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) > 0 {
+		// Written to the secondary while replaying: replay them on the next operation
+		f.lastTry = time.Time{}
+		return false
+	}
+	f.down = false
+	return true
+}
+
+// replay copies a pending write from the secondary to the primary.
+func (f *FallbackStore) replay(ctx context.Context, key string, write pendingWrite, now time.Time) error {
+	if write.deleted {
+		return f.primary.Delete(ctx, key)
+	}
+	var ttl time.Duration
+	if !write.expiresAt.IsZero() {
+		if ttl = write.expiresAt.Sub(now); ttl <= 0 {
+			return f.primary.Delete(ctx, key)
+		}
+	}
+	value, err := f.secondary.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return f.primary.Delete(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+	return f.primary.Set(ctx, key, value, ttl)
+}
+
+// failed reports whether err of a primary operation means that the primary is unavailable, and marks it down then.
+// Missing keys, closed stores and requests canceled by the caller do not count.
+func (f *FallbackStore) failed(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrClosed) || ctx.Err() != nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.down {
+		f.down = true
+		f.lastTry = f.clock.Now()
+	}
+	return true
+}
+
+// addPending records a write made to the secondary only.
+func (f *FallbackStore) addPending(key string, write pendingWrite) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending[key] = write
+}
+
+// Get retrieves a value from the primary, or from the secondary while the primary is down.
+func (f *FallbackStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if f.usePrimary(ctx) {
+		value, err := f.primary.Get(ctx, key)
+		if !f.failed(ctx, err) {
+			switch {
+			case err == nil:
+				if exists, err := f.secondary.Exists(ctx, key); err == nil && !exists {
+					_ = f.secondary.Set(ctx, key, value, fallbackReadTTL)
+				}
+			case errors.Is(err, ErrNotFound):
+				// Deleted by another process: do not serve the copy during an outage
+				_ = f.secondary.Delete(ctx, key)
+			}
+			return value, err
+		}
+	}
+	return f.secondary.Get(ctx, key)
+}
+
+// Set stores a value in both stores, or in the secondary only while the primary is down.
+func (f *FallbackStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if f.usePrimary(ctx) {
+		err := f.primary.Set(ctx, key, value, ttl)
+		if !f.failed(ctx, err) {
+			if err == nil {
+				_ = f.secondary.Set(ctx, key, value, ttl)
+			}
+			return err
+		}
+	}
+
+	write := pendingWrite{}
+	if ttl > 0 {
+		write.expiresAt = f.clock.Now().Add(ttl)
+	}
+	if err := f.secondary.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	f.addPending(key, write)
+	return nil
+}
+
+// Delete removes a key from both stores; while the primary is down, it is removed from it on recovery.
+func (f *FallbackStore) Delete(ctx context.Context, key string) error {
+	if f.usePrimary(ctx) {
+		err := f.primary.Delete(ctx, key)
+		if !f.failed(ctx, err) {
+			if err == nil {
+				_ = f.secondary.Delete(ctx, key)
+			}
+			return err
+		}
+	}
+
+	if err := f.secondary.Delete(ctx, key); err != nil {
+		return err
+	}
+	f.addPending(key, pendingWrite{deleted: true})
+	return nil
+}
+
+// Exists checks the primary, or the secondary while the primary is down.
+func (f *FallbackStore) Exists(ctx context.Context, key string) (bool, error) {
+	if f.usePrimary(ctx) {
+		exists, err := f.primary.Exists(ctx, key)
+		if !f.failed(ctx, err) {
+			return exists, err
+		}
+	}
+	return f.secondary.Exists(ctx, key)
+}
+
+// List returns the keys of the primary, or of the secondary while the primary is down.
+// The secondary only has the keys this process wrote or read, so listings are partial while degraded.
+func (f *FallbackStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if f.usePrimary(ctx) {
+		keys, err := f.primary.List(ctx, prefix)
+		if !f.failed(ctx, err) {
+			return keys, err
+		}
+	}
+	return f.secondary.List(ctx, prefix)
+}
+
+// Count returns the number of keys of the primary, or of the secondary while the primary is down.
+func (f *FallbackStore) Count(ctx context.Context, prefix string) (int, error) {
+	if f.usePrimary(ctx) {
+		count, err := f.primary.Count(ctx, prefix)
+		if !f.failed(ctx, err) {
+			return count, err
+		}
+	}
+	return f.secondary.Count(ctx, prefix)
+}
+
+// Close closes both stores.
+func (f *FallbackStore) Close() error {
+	return errors.Join(f.primary.Close(), f.secondary.Close())
+}
+
+// AcquireLease acquires a lease on the primary.
+func (f *FallbackStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	leaser, ok := Uncached(f.primary).(Leaser)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return leaser.AcquireLease(ctx, key, holder, ttl)
+}
+
+// ReleaseLease releases a lease on the primary.
+func (f *FallbackStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	leaser, ok := Uncached(f.primary).(Leaser)
+	if !ok {
+		return ErrNotSupported
+	}
+	return leaser.ReleaseLease(ctx, key, holder)
+}
+
+// Broadcast sends payload through the primary.
+func (f *FallbackStore) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	broadcaster, ok := Uncached(f.primary).(Broadcaster)
+	if !ok {
+		return ErrNotSupported
+	}
+	return broadcaster.Broadcast(ctx, topic, payload)
+}
+
+// SubscribeBroadcasts subscribes to topic on the primary.
+func (f *FallbackStore) SubscribeBroadcasts(topic string, fn func(payload []byte)) (func() error, error) {
+	broadcaster, ok := Uncached(f.primary).(Broadcaster)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return broadcaster.SubscribeBroadcasts(topic, fn)
+}
+
+// PublishInvalidation announces a changed key through the primary.
+func (f *FallbackStore) PublishInvalidation(ctx context.Context, key string) error {
+	invalidator, ok := Uncached(f.primary).(Invalidator)
+	if !ok {
+		return ErrNotSupported
+	}
+	return invalidator.PublishInvalidation(ctx, key)
+}
+
+// SubscribeInvalidations subscribes to the invalidations of the primary.
+func (f *FallbackStore) SubscribeInvalidations(fn func(key string)) (func() error, error) {
+	invalidator, ok := Uncached(f.primary).(Invalidator)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return invalidator.SubscribeInvalidations(fn)
+}
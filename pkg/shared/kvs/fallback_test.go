@@ -0,0 +1,119 @@
+package kvs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFallbackStore returns a FallbackStore over a primary that can be taken down, and the stores behind it
+func newTestFallbackStore(t *testing.T) (*FallbackStore, *ChaosStore, Store, Store, *clock.Fake) {
+	t.Helper()
+	primary, err := NewMemoryStore("fallback-primary", MemoryConfig{})
+	require.NoError(t, err)
+	secondary, err := NewMemoryStore("fallback-secondary", MemoryConfig{})
+	require.NoError(t, err)
+
+	chaos := NewChaosStore(primary, ChaosConfig{})
+	fallback := NewFallbackStore(chaos, secondary, time.Second)
+	fake := clock.NewFake(time.Now())
+	fallback.SetClock(fake)
+	t.Cleanup(func() { _ = fallback.Close() })
+	return fallback, chaos, primary, secondary, fake
+}
+
+func TestFallbackStore_Outage(t *testing.T) {
+	fallback, chaos, primary, _, fake := newTestFallbackStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, fallback.Set(ctx, "session:a", []byte("alice"), time.Hour))
+	require.NoError(t, fallback.Set(ctx, "session:b", []byte("bob"), time.Hour))
+
+	// During the outage, existing keys are served from the secondary and writes go there
+	chaos.SetDown(true)
+	value, err := fallback.Get(ctx, "session:a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("alice"), value)
+	assert.True(t, fallback.Degraded())
+
+	require.NoError(t, fallback.Set(ctx, "session:c", []byte("carol"), time.Hour))
+	require.NoError(t, fallback.Delete(ctx, "session:b"))
+	_, err = fallback.Get(ctx, "session:b")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// The primary is not tried again before the retry interval
+	chaos.SetDown(false)
+	_, err = fallback.Get(ctx, "session:c")
+	require.NoError(t, err)
+	assert.True(t, fallback.Degraded())
+
+	// On recovery, the writes of the outage are copied to the primary
+	fake.Advance(2 * time.Second)
+	value, err = fallback.Get(ctx, "session:c")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("carol"), value)
+	assert.False(t, fallback.Degraded())
+
+	value, err = primary.Get(ctx, "session:c")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("carol"), value)
+	_, err = primary.Get(ctx, "session:b")
+	assert.ErrorIs(t, err, ErrNotFound, "Keys deleted during the outage should be deleted from the primary")
+}
+
+func TestFallbackStore_RetryFailure(t *testing.T) {
+	fallback, chaos, primary, _, fake := newTestFallbackStore(t)
+	ctx := context.Background()
+
+	chaos.SetDown(true)
+	require.NoError(t, fallback.Set(ctx, "key", []byte("v"), 0))
+
+	// A retry during the outage keeps the pending writes
+	fake.Advance(2 * time.Second)
+	_, err := fallback.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, fallback.Degraded())
+
+	chaos.SetDown(false)
+	fake.Advance(2 * time.Second)
+	require.NoError(t, fallback.Set(ctx, "other", []byte("w"), 0))
+	assert.False(t, fallback.Degraded())
+	value, err := primary.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
+
+func TestFallbackStore_ReadThrough(t *testing.T) {
+	fallback, chaos, primary, secondary, _ := newTestFallbackStore(t)
+	ctx := context.Background()
+
+	// Keys written by other processes are kept in the secondary when read
+	require.NoError(t, primary.Set(ctx, "session:x", []byte("xavier"), time.Hour))
+	_, err := fallback.Get(ctx, "session:x")
+	require.NoError(t, err)
+	exists, err := secondary.Exists(ctx, "session:x")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Keys deleted by other processes are dropped from the secondary when found missing
+	require.NoError(t, primary.Delete(ctx, "session:x"))
+	_, err = fallback.Get(ctx, "session:x")
+	assert.ErrorIs(t, err, ErrNotFound)
+	chaos.SetDown(true)
+	_, err = fallback.Get(ctx, "session:x")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNew_Fallback(t *testing.T) {
+	store, err := New(Config{Type: "memory", Namespace: "primary", Fallback: &Config{Type: "memory"}})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	assert.IsType(t, &FallbackStore{}, store)
+
+	_, err = New(Config{Type: "memory", Fallback: &Config{Type: "memory", Fallback: &Config{Type: "memory"}}})
+	assert.Error(t, err, "Fallback stores should not nest")
+}
@@ -5,6 +5,7 @@ package kvs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -41,6 +42,28 @@ type Store interface {
 	Close() error
 }
 
+// Broadcaster is implemented by stores shared between processes that can send messages
+// to all of them (RedisStore, with pub/sub). Messages are not stored: processes that are
+// not subscribed when a message is sent never receive it.
+type Broadcaster interface {
+	// Broadcast sends payload to the subscribers of topic, including the sending process.
+	Broadcast(ctx context.Context, topic string, payload []byte) error
+
+	// SubscribeBroadcasts calls fn with the payloads sent to topic by any process until the returned stop function is called.
+	SubscribeBroadcasts(topic string, fn func(payload []byte)) (stop func() error, err error)
+}
+
+// Leaser is implemented by stores that can grant a key to one holder at a time (leader election).
+// A lease is a key holding the holder's ID that expires after its TTL unless renewed.
+type Leaser interface {
+	// AcquireLease sets key to holder for ttl if the key is absent or already held by holder (renewal),
+	// atomically. It reports whether holder holds the lease.
+	AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error)
+
+	// ReleaseLease deletes key if it is held by holder, so another holder can acquire it at once.
+	ReleaseLease(ctx context.Context, key, holder string) error
+}
+
 // Common errors
 var (
 	// ErrNotFound is returned when a key is not found or has expired.
@@ -69,6 +92,14 @@ type Config struct {
 
 	// Redis-specific config
 	Redis RedisConfig `yaml:"redis"`
+
+	// Fallback is the store used while this one is unavailable (optional, see FallbackStore),
+	// typically memory or LevelDB behind Redis. Its namespace defaults to this store's.
+	Fallback *Config `yaml:"fallback"`
+
+	// FallbackRetry is how often the store is tried again while the fallback is in use.
+	// Default: 5 seconds
+	FallbackRetry time.Duration `yaml:"fallback_retry"`
 }
 
 // MemoryConfig configures the in-memory store.
@@ -98,7 +129,7 @@ type RedisConfig struct {
 	Addr string `yaml:"addr"`
 
 	// Password is the Redis password (optional)
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 
 	// DB is the Redis database number (0-15)
 	DB int `yaml:"db"`
@@ -112,7 +143,13 @@ type RedisConfig struct {
 // - Memory: separate store instance per namespace
 // - LevelDB: separate directory per namespace
 // - Redis: key prefix per namespace
+//
+// With a Fallback, the store is combined with the fallback store into a FallbackStore.
 func New(cfg Config) (Store, error) {
+	if cfg.Fallback != nil {
+		return newWithFallback(cfg)
+	}
+
 	switch cfg.Type {
 	case "memory", "":
 		return NewMemoryStore(cfg.Namespace, cfg.Memory)
@@ -124,3 +161,27 @@ func New(cfg Config) (Store, error) {
 		return nil, errors.New("kvs: unsupported store type: " + cfg.Type)
 	}
 }
+
+// newWithFallback creates the store of cfg and its fallback store, combined into a FallbackStore.
+func newWithFallback(cfg Config) (Store, error) {
+	secondaryCfg := *cfg.Fallback
+	if secondaryCfg.Fallback != nil {
+		return nil, errors.New("kvs: a fallback store cannot have a fallback")
+	}
+	if secondaryCfg.Namespace == "" {
+		secondaryCfg.Namespace = cfg.Namespace
+	}
+	primaryCfg := cfg
+	primaryCfg.Fallback = nil
+
+	primary, err := New(primaryCfg)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := New(secondaryCfg)
+	if err != nil {
+		_ = primary.Close()
+		return nil, fmt.Errorf("kvs: fallback store: %w", err)
+	}
+	return NewFallbackStore(primary, secondary, cfg.FallbackRetry), nil
+}
@@ -24,6 +24,7 @@ type LevelDBStore struct {
 	db              *leveldb.DB
 	closed          bool
 	mu              sync.RWMutex
+	leaseMu         sync.Mutex // Serializes lease updates; the database belongs to this process
 	cleanupInterval time.Duration
 	stopCleanup     chan struct{}
 	cleanupDone     chan struct{}
@@ -202,6 +203,39 @@ func (l *LevelDBStore) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// AcquireLease sets key to holder for ttl unless another holder has it.
+func (l *LevelDBStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	l.leaseMu.Lock()
+	defer l.leaseMu.Unlock()
+
+	current, err := l.Get(ctx, key)
+	if err == nil && string(current) != holder {
+		return false, nil
+	}
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+	if err := l.Set(ctx, key, []byte(holder), ttl); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease deletes key if holder has it.
+func (l *LevelDBStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	l.leaseMu.Lock()
+	defer l.leaseMu.Unlock()
+
+	current, err := l.Get(ctx, key)
+	if err == ErrNotFound || (err == nil && string(current) != holder) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return l.Delete(ctx, key)
+}
+
 // Exists checks if a key exists and has not expired.
 func (l *LevelDBStore) Exists(ctx context.Context, key string) (bool, error) {
 	l.mu.RLock()
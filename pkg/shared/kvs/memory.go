@@ -112,6 +112,38 @@ func (m *MemoryStore) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// AcquireLease sets key to holder for ttl unless another holder has it.
+func (m *MemoryStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	now := time.Now()
+	if item, exists := m.items[key]; exists && (item.expiresAt.IsZero() || now.Before(item.expiresAt)) && string(item.value) != holder {
+		return false, nil
+	}
+	m.items[key] = &memoryItem{value: []byte(holder), expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease deletes key if holder has it.
+func (m *MemoryStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	if item, exists := m.items[key]; exists && string(item.value) == holder {
+		delete(m.items, key)
+	}
+	return nil
+}
+
 // Exists checks if a key exists and has not expired.
 func (m *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
 	m.mu.RLock()
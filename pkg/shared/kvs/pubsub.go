@@ -0,0 +1,118 @@
+package kvs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported is returned by wrappers asked for a capability the store they wrap does not have.
+var ErrNotSupported = errors.New("kvs: operation not supported by the store")
+
+// invalidationTopic is the MemoryPubSub topic of key invalidations.
+const invalidationTopic = "\x00invalidate"
+
+// MemoryPubSub is an in-process stand-in for Redis pub/sub.
+// Stores connected to the same MemoryPubSub behave like processes sharing a Redis store:
+// broadcasts and invalidations reach the subscribers of every connected store. Messages are
+// delivered synchronously, before Broadcast returns, which keeps tests deterministic.
+type MemoryPubSub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[int]func(payload []byte)
+	nextID      int
+}
+
+// NewMemoryPubSub creates an in-process pub/sub.
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{subscribers: make(map[string]map[int]func(payload []byte))}
+}
+
+// Connect returns store with the pub/sub of p.
+// Connect the same store several times to simulate several processes sharing it.
+func (p *MemoryPubSub) Connect(store Store) *PubSubStore {
+	return &PubSubStore{Store: store, pubsub: p}
+}
+
+// publish calls the subscribers of topic with payload.
+// Subscribers are called outside the lock, so they may publish or subscribe themselves.
+func (p *MemoryPubSub) publish(topic string, payload []byte) {
+	p.mu.Lock()
+	fns := make([]func(payload []byte), 0, len(p.subscribers[topic]))
+	for _, fn := range p.subscribers[topic] {
+		fns = append(fns, fn)
+	}
+	p.mu.Unlock()
+
+	for _, fn := range fns {
+		fn(append([]byte(nil), payload...))
+	}
+}
+
+// subscribe adds a subscriber of topic until the returned stop function is called.
+func (p *MemoryPubSub) subscribe(topic string, fn func(payload []byte)) func() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID
+	p.nextID++
+	if p.subscribers[topic] == nil {
+		p.subscribers[topic] = make(map[int]func(payload []byte))
+	}
+	p.subscribers[topic][id] = fn
+
+	return func() error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subscribers[topic], id)
+		return nil
+	}
+}
+
+// PubSubStore is a Store connected to a MemoryPubSub.
+// It is a Broadcaster and an Invalidator, and leaves leases to the store it wraps.
+type PubSubStore struct {
+	Store
+	pubsub *MemoryPubSub
+}
+
+// Broadcast sends payload to the subscribers of topic of every connected store.
+func (s *PubSubStore) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	s.pubsub.publish(topic, payload)
+	return nil
+}
+
+// SubscribeBroadcasts calls fn with the payloads sent to topic through any connected store.
+func (s *PubSubStore) SubscribeBroadcasts(topic string, fn func(payload []byte)) (func() error, error) {
+	return s.pubsub.subscribe(topic, fn), nil
+}
+
+// PublishInvalidation announces a changed key to the subscribers of every connected store.
+func (s *PubSubStore) PublishInvalidation(ctx context.Context, key string) error {
+	s.pubsub.publish(invalidationTopic, []byte(key))
+	return nil
+}
+
+// SubscribeInvalidations calls fn with the keys announced through any connected store.
+func (s *PubSubStore) SubscribeInvalidations(fn func(key string)) (func() error, error) {
+	return s.pubsub.subscribe(invalidationTopic, func(payload []byte) {
+		fn(string(payload))
+	}), nil
+}
+
+// AcquireLease acquires a lease on the wrapped store.
+func (s *PubSubStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	leaser, ok := s.Store.(Leaser)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return leaser.AcquireLease(ctx, key, holder, ttl)
+}
+
+// ReleaseLease releases a lease on the wrapped store.
+func (s *PubSubStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	leaser, ok := s.Store.(Leaser)
+	if !ok {
+		return ErrNotSupported
+	}
+	return leaser.ReleaseLease(ctx, key, holder)
+}
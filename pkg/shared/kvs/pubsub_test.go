@@ -0,0 +1,56 @@
+package kvs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryPubSub_Broadcast(t *testing.T) {
+	store, err := NewMemoryStore("pubsub-test", MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	// Two "processes" sharing the store
+	pubsub := NewMemoryPubSub()
+	a, b := pubsub.Connect(store), pubsub.Connect(store)
+
+	var gotA, gotB []string
+	stopA, err := a.SubscribeBroadcasts("events", func(payload []byte) { gotA = append(gotA, string(payload)) })
+	require.NoError(t, err)
+	_, err = b.SubscribeBroadcasts("events", func(payload []byte) { gotB = append(gotB, string(payload)) })
+	require.NoError(t, err)
+	_, err = b.SubscribeBroadcasts("other", func(payload []byte) { t.Errorf("Unexpected payload %q on another topic", payload) })
+	require.NoError(t, err)
+
+	require.NoError(t, a.Broadcast(context.Background(), "events", []byte("one")))
+	require.NoError(t, stopA())
+	require.NoError(t, b.Broadcast(context.Background(), "events", []byte("two")))
+
+	assert.Equal(t, []string{"one"}, gotA, "The sender receives its broadcasts until it stops")
+	assert.Equal(t, []string{"one", "two"}, gotB)
+}
+
+func TestMemoryPubSub_CachedStores(t *testing.T) {
+	store, err := NewMemoryStore("pubsub-cache-test", MemoryConfig{})
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+
+	// The caches of two processes see each other's writes through invalidations
+	pubsub := NewMemoryPubSub()
+	a := NewCachedStore(pubsub.Connect(store), CacheConfig{Enabled: true, TTL: "1h"})
+	b := NewCachedStore(pubsub.Connect(store), CacheConfig{Enabled: true, TTL: "1h"})
+	ctx := context.Background()
+
+	require.NoError(t, a.Set(ctx, "key", []byte("v1"), 0))
+	value, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), value)
+
+	require.NoError(t, a.Set(ctx, "key", []byte("v2"), 0))
+	value, err = b.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), value, "The cached value should be invalidated by the other process")
+}
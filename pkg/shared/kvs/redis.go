@@ -18,6 +18,8 @@ type RedisStore struct {
 	client    *redis.Client
 	closed    bool
 	mu        sync.RWMutex
+
+	pubsubs map[*redis.PubSub]struct{} // Open subscriptions, closed with the store
 }
 
 // NewRedisStore creates a new Redis KVS store for the given namespace.
@@ -202,8 +204,13 @@ func (r *RedisStore) Close() error {
 		return ErrClosed
 	}
 	r.closed = true
+	pubsubs := r.pubsubs
+	r.pubsubs = nil
 	r.mu.Unlock()
 
+	for pubsub := range pubsubs {
+		_ = pubsub.Close()
+	}
 	err := r.client.Close()
 	if err != nil {
 		return fmt.Errorf("kvs/redis: close failed: %w", err)
@@ -211,3 +218,160 @@ func (r *RedisStore) Close() error {
 
 	return nil
 }
+
+// acquireLeaseScript sets KEYS[1] to ARGV[1] for ARGV[2] milliseconds unless another holder has it
+var acquireLeaseScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current == false or current == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript deletes KEYS[1] if ARGV[1] has it
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLease sets key to holder for ttl unless another holder has it, atomically across processes.
+func (r *RedisStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return false, ErrClosed
+	}
+	r.mu.RUnlock()
+
+	acquired, err := acquireLeaseScript.Run(ctx, r.client, []string{r.prefixedKey(key)}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("kvs/redis: acquire lease failed: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+// ReleaseLease deletes key if holder has it.
+func (r *RedisStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return ErrClosed
+	}
+	r.mu.RUnlock()
+
+	if err := releaseLeaseScript.Run(ctx, r.client, []string{r.prefixedKey(key)}, holder).Err(); err != nil {
+		return fmt.Errorf("kvs/redis: release lease failed: %w", err)
+	}
+	return nil
+}
+
+// invalidationChannel returns the pub/sub channel of key invalidations of the namespace.
+func (r *RedisStore) invalidationChannel() string {
+	return "kvs:invalidate:" + strings.TrimSuffix(r.namespace, ":")
+}
+
+// PublishInvalidation announces a changed key to the subscribers of the namespace.
+func (r *RedisStore) PublishInvalidation(ctx context.Context, key string) error {
+	if err := r.publish(ctx, r.invalidationChannel(), key); err != nil {
+		return fmt.Errorf("kvs/redis: publish invalidation failed: %w", err)
+	}
+	return nil
+}
+
+// SubscribeInvalidations calls fn with the keys announced in the namespace by any process.
+// The subscription reconnects by itself; stop ends it.
+func (r *RedisStore) SubscribeInvalidations(fn func(key string)) (func() error, error) {
+	return r.subscribe(r.invalidationChannel(), fn)
+}
+
+// broadcastChannel returns the pub/sub channel of a broadcast topic of the namespace.
+func (r *RedisStore) broadcastChannel(topic string) string {
+	return "kvs:broadcast:" + strings.TrimSuffix(r.namespace, ":") + ":" + topic
+}
+
+// Broadcast sends payload to the subscribers of topic in the namespace, in every process.
+func (r *RedisStore) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	if err := r.publish(ctx, r.broadcastChannel(topic), payload); err != nil {
+		return fmt.Errorf("kvs/redis: broadcast failed: %w", err)
+	}
+	return nil
+}
+
+// SubscribeBroadcasts calls fn with the payloads sent to topic in the namespace by any process.
+// The subscription reconnects by itself; stop ends it.
+func (r *RedisStore) SubscribeBroadcasts(topic string, fn func(payload []byte)) (func() error, error) {
+	return r.subscribe(r.broadcastChannel(topic), func(payload string) {
+		fn([]byte(payload))
+	})
+}
+
+// publish sends a message to a pub/sub channel.
+func (r *RedisStore) publish(ctx context.Context, channel string, message interface{}) error {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return ErrClosed
+	}
+	r.mu.RUnlock()
+
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// subscribe calls fn with the messages of a pub/sub channel until the returned stop function is called
+// or the store is closed.
+func (r *RedisStore) subscribe(channel string, fn func(payload string)) (func() error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r.mu.RLock()
+	closed := r.closed
+	r.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	pubsub := r.client.Subscribe(ctx, channel)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = pubsub.Close()
+		return nil, ErrClosed
+	}
+	if r.pubsubs == nil {
+		r.pubsubs = make(map[*redis.PubSub]struct{})
+	}
+	r.pubsubs[pubsub] = struct{}{}
+	r.mu.Unlock()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		r.untrack(pubsub)
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("kvs/redis: subscribe failed: %w", err)
+	}
+
+	done := make(chan struct{})
+	messages := pubsub.Channel()
+	go func() {
+		defer close(done)
+		for msg := range messages {
+			fn(msg.Payload)
+		}
+	}()
+
+	return func() error {
+		r.untrack(pubsub)
+		err := pubsub.Close()
+		<-done
+		return err
+	}, nil
+}
+
+// untrack forgets a subscription closed before the store.
+func (r *RedisStore) untrack(pubsub *redis.PubSub) {
+	r.mu.Lock()
+	delete(r.pubsubs, pubsub)
+	r.mu.Unlock()
+}
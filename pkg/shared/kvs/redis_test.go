@@ -0,0 +1,82 @@
+package kvs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore_Lease(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	newStore := func() *RedisStore {
+		store, err := NewRedisStore("jobs", RedisConfig{Addr: server.Addr()})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	first, second := newStore(), newStore()
+
+	acquired, err := first.AcquireLease(ctx, "leader", "first", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = second.AcquireLease(ctx, "leader", "second", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "Another process should not take a held lease")
+
+	server.FastForward(2 * time.Minute)
+	acquired, err = second.AcquireLease(ctx, "leader", "second", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "Expired lease should be taken over")
+
+	require.NoError(t, first.ReleaseLease(ctx, "leader", "first"))
+	value, err := second.Get(ctx, "leader")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(value), "A former holder should not release the lease")
+}
+
+func TestRedisStore_Broadcast(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	newStore := func(namespace string) *RedisStore {
+		store, err := NewRedisStore(namespace, RedisConfig{Addr: server.Addr()})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	sender, receiver, other := newStore("session"), newStore("session"), newStore("tenant-a:session")
+
+	received := make(chan string, 10)
+	for _, store := range []*RedisStore{receiver, other} {
+		stop, err := store.SubscribeBroadcasts("events", func(payload []byte) {
+			received <- store.namespace + " " + string(payload)
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = stop() })
+	}
+
+	require.NoError(t, sender.Broadcast(ctx, "events", []byte("hello")))
+	require.NoError(t, sender.Broadcast(ctx, "other-topic", []byte("ignored")))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "session: hello", msg, "Only subscribers of the same namespace and topic receive the message")
+	case <-time.After(2 * time.Second):
+		t.Fatal("broadcast was not received")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("unexpected message %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, sender.Close())
+	assert.ErrorIs(t, sender.Broadcast(ctx, "events", nil), ErrClosed)
+}
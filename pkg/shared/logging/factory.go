@@ -16,14 +16,9 @@ type FileRotationConfig struct {
 	Compress   bool   // Whether to compress rotated log files (default: false)
 }
 
-// NewLoggerWithFile creates a logger that writes to both console and file with rotation
-// When file logging is enabled, colors are always disabled for file output to avoid ANSI escape codes in log files
-func NewLoggerWithFile(module string, level Level, useColors bool, fileConfig *FileRotationConfig) (*SimpleLogger, error) {
-	// If no file config, return console-only logger
-	if fileConfig == nil || fileConfig.Path == "" {
-		return NewSimpleLogger(module, level, useColors), nil
-	}
-
+// NewRotatingFile returns a writer appending to the file of fileConfig, rotated and pruned as configured
+// The file is opened on the first write.
+func NewRotatingFile(fileConfig FileRotationConfig) io.WriteCloser {
 	// Set defaults for rotation settings
 	maxSizeMB := fileConfig.MaxSizeMB
 	if maxSizeMB == 0 {
@@ -41,13 +36,24 @@ func NewLoggerWithFile(module string, level Level, useColors bool, fileConfig *F
 	}
 
 	// Create lumberjack logger for file rotation
-	fileWriter := &lumberjack.Logger{
+	return &lumberjack.Logger{
 		Filename:   fileConfig.Path,
 		MaxSize:    maxSizeMB,
 		MaxBackups: maxBackups,
 		MaxAge:     maxAge,
 		Compress:   fileConfig.Compress,
 	}
+}
+
+// NewLoggerWithFile creates a logger that writes to both console and file with rotation
+// When file logging is enabled, colors are always disabled for file output to avoid ANSI escape codes in log files
+func NewLoggerWithFile(module string, level Level, useColors bool, fileConfig *FileRotationConfig) (*SimpleLogger, error) {
+	// If no file config, return console-only logger
+	if fileConfig == nil || fileConfig.Path == "" {
+		return NewSimpleLogger(module, level, useColors), nil
+	}
+
+	fileWriter := NewRotatingFile(*fileConfig)
 
 	// Create multi-writer for both console and file
 	// File output always has colors disabled to avoid ANSI escape codes
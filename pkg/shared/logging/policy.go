@@ -0,0 +1,236 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// Sampling limits the debug and info messages of a module on busy servers
+// Warnings and errors are never sampled out.
+type Sampling struct {
+	Every     int // Log 1 of every N messages with the same text (0 or 1: all)
+	PerSecond int // Log at most N messages per second (0: no cap)
+}
+
+// enabled reports whether sampling drops any message
+func (s Sampling) enabled() bool {
+	return s.Every > 1 || s.PerSecond > 0
+}
+
+// ModuleRule configures the messages of a module and its sub-modules
+type ModuleRule struct {
+	Level    string // Log level ("" inherits the level of the parent module)
+	Sampling Sampling
+}
+
+// Policy decides which messages of a logger hierarchy are written
+type Policy struct {
+	Level       Level                 // Level of the root module
+	ModuleLevel Level                 // Level of the sub-modules without a rule
+	Modules     map[string]ModuleRule // Rules keyed by module path (e.g., "main/proxy"), applying to sub-modules too
+	Clock       clock.Clock           // Time source of the per-second caps (default: clock.Real)
+}
+
+// MinLevel returns the lowest level any module of the policy logs at,
+// the level the wrapped logger must let through
+func (p Policy) MinLevel() Level {
+	min := p.Level
+	if p.ModuleLevel < min {
+		min = p.ModuleLevel
+	}
+	for _, rule := range p.Modules {
+		if rule.Level != "" && ParseLevel(rule.Level) < min {
+			min = ParseLevel(rule.Level)
+		}
+	}
+	return min
+}
+
+// PolicyLogger is a Logger that applies per-module levels and sampling before writing to another Logger
+type PolicyLogger struct {
+	next    Logger
+	module  string
+	level   Level
+	sampler *sampler // nil when the module is not sampled
+	state   *policyState
+}
+
+// policyState is shared by all loggers of a hierarchy
+type policyState struct {
+	policy Policy
+	clock  clock.Clock
+	root   string
+
+	mu       sync.Mutex
+	samplers map[string]*sampler // Keyed by rule path, so all sub-modules of a rule share its budget
+}
+
+// NewPolicyLogger wraps next, whose module is module, to apply policy
+// next must let through messages at policy.MinLevel().
+func NewPolicyLogger(next Logger, module string, policy Policy) *PolicyLogger {
+	state := &policyState{
+		policy:   policy,
+		clock:    clock.OrReal(policy.Clock),
+		root:     module,
+		samplers: make(map[string]*sampler),
+	}
+	return state.logger(next, module)
+}
+
+// logger creates the logger of module, resolving its level and sampler by the rules of its path and parents
+func (s *policyState) logger(next Logger, module string) *PolicyLogger {
+	l := &PolicyLogger{next: next, module: module, level: s.policy.Level, state: s}
+	if module != s.root {
+		l.level = s.policy.ModuleLevel
+	}
+
+	// Apply the rules from the shortest matching path to the longest
+	var samplingPath string
+	for _, path := range modulePaths(module) {
+		rule, ok := s.policy.Modules[path]
+		if !ok {
+			continue
+		}
+		if rule.Level != "" {
+			l.level = ParseLevel(rule.Level)
+		}
+		if rule.Sampling.enabled() {
+			samplingPath = path
+		}
+	}
+	if samplingPath != "" {
+		l.sampler = s.sampler(samplingPath)
+	}
+	return l
+}
+
+// sampler returns the shared sampler of the rule at path
+func (s *policyState) sampler(path string) *sampler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sm, ok := s.samplers[path]; ok {
+		return sm
+	}
+	sm := &sampler{config: s.policy.Modules[path].Sampling, clock: s.clock, counts: make(map[string]int)}
+	s.samplers[path] = sm
+	return sm
+}
+
+// modulePaths returns module and its parents, shortest first ("a/b" → "a", "a/b")
+func modulePaths(module string) []string {
+	var paths []string
+	for i, c := range module {
+		if c == '/' {
+			paths = append(paths, module[:i])
+		}
+	}
+	return append(paths, module)
+}
+
+// maxSampledTexts bounds the per-text counters of a sampler
+const maxSampledTexts = 1000
+
+// sampler drops debug and info messages beyond the budget of a rule
+type sampler struct {
+	config Sampling
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	window  time.Time      // Start of the current one-second window
+	inWin   int            // Messages logged in the current window
+	counts  map[string]int // Messages seen per text, for Every
+	dropped int            // Messages dropped since the last report
+}
+
+// allow reports whether a message with text msg is logged,
+// and the number of messages dropped before it to report (0 for none)
+func (s *sampler) allow(msg string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Every > 1 {
+		if len(s.counts) >= maxSampledTexts {
+			s.counts = make(map[string]int)
+		}
+		n := s.counts[msg]
+		s.counts[msg] = n + 1
+		if n%s.config.Every != 0 {
+			s.dropped++
+			return false, 0
+		}
+	}
+
+	if s.config.PerSecond > 0 {
+		now := s.clock.Now()
+		if now.Sub(s.window) >= time.Second || now.Before(s.window) {
+			s.window = now
+			s.inWin = 0
+		}
+		if s.inWin >= s.config.PerSecond {
+			s.dropped++
+			return false, 0
+		}
+		s.inWin++
+	}
+
+	dropped := s.dropped
+	s.dropped = 0
+	return true, dropped
+}
+
+// sampled reports whether a debug or info message passes the sampler of the module
+func (l *PolicyLogger) sampled(msg string) bool {
+	if l.sampler == nil {
+		return true
+	}
+	ok, dropped := l.sampler.allow(msg)
+	if ok && dropped > 0 {
+		l.next.Info("Log messages sampled out", "dropped", dropped)
+	}
+	return ok
+}
+
+// Debug logs a debug message
+func (l *PolicyLogger) Debug(msg string, args ...interface{}) {
+	if l.level <= LevelDebug && l.sampled(msg) {
+		l.next.Debug(msg, args...)
+	}
+}
+
+// Info logs an informational message
+func (l *PolicyLogger) Info(msg string, args ...interface{}) {
+	if l.level <= LevelInfo && l.sampled(msg) {
+		l.next.Info(msg, args...)
+	}
+}
+
+// Warn logs a warning message
+func (l *PolicyLogger) Warn(msg string, args ...interface{}) {
+	if l.level <= LevelWarn {
+		l.next.Warn(msg, args...)
+	}
+}
+
+// Error logs an error message
+func (l *PolicyLogger) Error(msg string, args ...interface{}) {
+	if l.level <= LevelError {
+		l.next.Error(msg, args...)
+	}
+}
+
+// Fatal logs a fatal error message and exits
+// Fatal messages are always written, since the wrapped logger exits the process.
+func (l *PolicyLogger) Fatal(msg string, args ...interface{}) {
+	l.next.Fatal(msg, args...)
+}
+
+// WithModule creates a new logger with a hierarchical component name, as SimpleLogger.WithModule does
+func (l *PolicyLogger) WithModule(module string) Logger {
+	newModule := module
+	if l.module != "" {
+		newModule = l.module + "/" + module
+	}
+	return l.state.logger(l.next.WithModule(module), newModule)
+}
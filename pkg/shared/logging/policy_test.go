@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/clock"
+)
+
+// newPolicyTestLogger returns a policy logger over a SimpleLogger writing to the returned buffer
+func newPolicyTestLogger(policy Policy) (*PolicyLogger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	next := NewSimpleLoggerWithWriter("main", policy.MinLevel(), false, &buf)
+	return NewPolicyLogger(next, "main", policy), &buf
+}
+
+func TestPolicyLogger_ModuleLevels(t *testing.T) {
+	logger, buf := newPolicyTestLogger(Policy{
+		Level:       LevelInfo,
+		ModuleLevel: LevelWarn,
+		Modules: map[string]ModuleRule{
+			"main/middleware":         {Level: "error"},
+			"main/middleware/session": {Level: "debug"},
+		},
+	})
+
+	logger.Debug("root debug")
+	logger.Info("root info")
+	logger.WithModule("proxy").Info("proxy info")
+	logger.WithModule("proxy").Warn("proxy warn")
+	middleware := logger.WithModule("middleware")
+	middleware.Warn("middleware warn")
+	middleware.WithModule("auth").Warn("auth warn")
+	middleware.WithModule("session").Debug("session debug")
+
+	output := buf.String()
+	for _, want := range []string{"root info", "proxy warn", "session debug"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got: %s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"root debug", "proxy info", "middleware warn", "auth warn"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("unexpected %q in output, got: %s", unwanted, output)
+		}
+	}
+	if !strings.Contains(output, "[main/middleware/session]") {
+		t.Errorf("expected module hierarchy in output, got: %s", output)
+	}
+}
+
+func TestPolicyLogger_SampleEvery(t *testing.T) {
+	logger, buf := newPolicyTestLogger(Policy{
+		Level:       LevelDebug,
+		ModuleLevel: LevelDebug,
+		Modules:     map[string]ModuleRule{"main/proxy": {Sampling: Sampling{Every: 10}}},
+	})
+	proxy := logger.WithModule("proxy")
+
+	for i := 0; i < 25; i++ {
+		proxy.Debug("Forwarding request")
+		proxy.Warn("Upstream slow")
+	}
+	proxy.Debug("Other message") // Counted separately, so it is logged
+
+	output := buf.String()
+	if got := strings.Count(output, "Forwarding request"); got != 3 {
+		t.Errorf("logged %d of 25 sampled messages, want 3", got)
+	}
+	if got := strings.Count(output, "Upstream slow"); got != 25 {
+		t.Errorf("logged %d of 25 warnings, want all", got)
+	}
+	if !strings.Contains(output, "Other message") {
+		t.Error("the first message with another text should be logged")
+	}
+	if !strings.Contains(output, "Log messages sampled out dropped=9") {
+		t.Errorf("expected a report of the dropped messages, got: %s", output)
+	}
+}
+
+func TestPolicyLogger_PerSecond(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	logger, buf := newPolicyTestLogger(Policy{
+		Level:       LevelInfo,
+		ModuleLevel: LevelInfo,
+		Modules:     map[string]ModuleRule{"main/middleware": {Sampling: Sampling{PerSecond: 2}}},
+		Clock:       fake,
+	})
+	// Sub-modules of a rule share its budget
+	session := logger.WithModule("middleware").WithModule("session")
+	auth := logger.WithModule("middleware").WithModule("auth")
+
+	session.Info("first")
+	auth.Info("second")
+	session.Info("third")
+	auth.Error("failure")
+	logger.Info("root")
+
+	output := buf.String()
+	for _, want := range []string{"first", "second", "failure", "root"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got: %s", want, output)
+		}
+	}
+	if strings.Contains(output, "third") {
+		t.Errorf("the third message of the second should be dropped, got: %s", output)
+	}
+
+	fake.Advance(time.Second)
+	session.Info("next second")
+	if output := buf.String(); !strings.Contains(output, "next second") || !strings.Contains(output, "dropped=1") {
+		t.Errorf("expected the message and a drop report in the next second, got: %s", output)
+	}
+}
+
+func TestPolicy_MinLevel(t *testing.T) {
+	policy := Policy{Level: LevelWarn, ModuleLevel: LevelInfo}
+	if got := policy.MinLevel(); got != LevelInfo {
+		t.Errorf("MinLevel() = %v, want %v", got, LevelInfo)
+	}
+	policy.Modules = map[string]ModuleRule{"main/proxy": {Level: "debug"}}
+	if got := policy.MinLevel(); got != LevelDebug {
+		t.Errorf("MinLevel() = %v, want %v", got, LevelDebug)
+	}
+}
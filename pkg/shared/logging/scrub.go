@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the sensitive values removed from log messages
+const Redacted = "[REDACTED]"
+
+// MaskEmail masks an email address for logging purposes
+// Example: "user@example.com" -> "u***@example.com"
+func MaskEmail(email string) string {
+	if email == "" {
+		return "[EMPTY]"
+	}
+
+	atIndex := strings.Index(email, "@")
+	if atIndex <= 0 {
+		return "[INVALID_EMAIL]"
+	}
+
+	localPart := email[:atIndex]
+	domain := email[atIndex:]
+
+	if len(localPart) == 1 {
+		return "*" + domain
+	}
+
+	return string(localPart[0]) + "***" + domain
+}
+
+// sensitiveKeyWords are the last words of field keys whose values are always redacted
+// ("access_token", "client_secret", "set-cookie"), while "token_url" or "status_code" are kept
+var sensitiveKeyWords = map[string]bool{
+	"token": true, "tokens": true, "secret": true, "password": true, "passwd": true,
+	"cookie": true, "cookies": true, "authorization": true, "otp": true,
+	"credential": true, "credentials": true, "apikey": true, "signature": true,
+}
+
+// sensitiveKeys are field keys redacted as a whole
+var sensitiveKeys = map[string]bool{
+	"code": true, "api_key": true, "private_key": true,
+}
+
+// isSensitiveKey reports whether the values of a log field key are redacted
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	if sensitiveKeys[key] {
+		return true
+	}
+	return sensitiveKeyWords[key[strings.LastIndexByte(key, '_')+1:]]
+}
+
+// Patterns of sensitive values inside free text (messages, URLs, errors)
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	authHeaderPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtPattern        = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	cookiePattern     = regexp.MustCompile(`(?i)\b((?:set-)?cookie:\s*)[^\r\n]+`)
+	queryPattern      = regexp.MustCompile(`(?i)([?&;](?:[a-z_]*token|code|otp|password|secret|api_key|sig|signature)=)[^&\s"#]+`)
+
+	// Strict mode only
+	anyQueryPattern = regexp.MustCompile(`([?&;][^=&\s"#]+=)[^&\s"#]+`)
+	opaquePattern   = regexp.MustCompile(`\b[A-Za-z0-9_\-]{32,}\b`)
+	digitsPattern   = regexp.MustCompile(`\b\d{6,8}\b`)
+)
+
+// Scrubber redacts tokens, cookie values, OTPs and emails from log messages and fields
+type Scrubber struct {
+	// Strict redacts more for compliance environments: emails entirely instead of masked,
+	// every query parameter, long opaque strings (session IDs, hashes) and 6-8 digit codes
+	Strict bool
+}
+
+// Text scrubs the sensitive values inside free text
+func (s Scrubber) Text(text string) string {
+	text = cookiePattern.ReplaceAllString(text, "${1}"+Redacted)
+	text = authHeaderPattern.ReplaceAllString(text, "${1} "+Redacted)
+	text = jwtPattern.ReplaceAllString(text, Redacted)
+	if s.Strict {
+		text = anyQueryPattern.ReplaceAllString(text, "${1}"+Redacted)
+		text = emailPattern.ReplaceAllString(text, "[EMAIL]")
+		text = opaquePattern.ReplaceAllString(text, Redacted)
+		return digitsPattern.ReplaceAllString(text, Redacted)
+	}
+	text = queryPattern.ReplaceAllString(text, "${1}"+Redacted)
+	return emailPattern.ReplaceAllStringFunc(text, MaskEmail)
+}
+
+// Value scrubs the value of a log field with key, reporting whether it changed
+// Strings, errors and fmt.Stringers are scrubbed as text; other values are returned as is.
+func (s Scrubber) Value(key string, value interface{}) (interface{}, bool) {
+	if isSensitiveKey(key) {
+		return Redacted, true
+	}
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case error:
+		text = v.Error()
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		return value, false
+	}
+	if scrubbed := s.Text(text); scrubbed != text {
+		return scrubbed, true
+	}
+	return value, false
+}
+
+// Args scrubs the key/value pairs of a log call, copying args only when a value changed
+func (s Scrubber) Args(args []interface{}) []interface{} {
+	scrubbed, copied := args, false
+	for i := 0; i < len(args); i += 2 {
+		key, valueIndex := "", i // A dangling value without a key is scrubbed as text
+		if i+1 < len(args) {
+			key, valueIndex = fmt.Sprintf("%v", args[i]), i+1
+		}
+		value, changed := s.Value(key, args[valueIndex])
+		if !changed {
+			continue
+		}
+		if !copied {
+			scrubbed, copied = append([]interface{}(nil), args...), true
+		}
+		scrubbed[valueIndex] = value
+	}
+	return scrubbed
+}
+
+// ScrubbingLogger is a Logger that scrubs messages and fields with a Scrubber before writing to another Logger
+type ScrubbingLogger struct {
+	next     Logger
+	scrubber Scrubber
+}
+
+// NewScrubbingLogger wraps next to scrub everything it logs
+func NewScrubbingLogger(next Logger, scrubber Scrubber) *ScrubbingLogger {
+	return &ScrubbingLogger{next: next, scrubber: scrubber}
+}
+
+// Debug logs a debug message
+func (l *ScrubbingLogger) Debug(msg string, args ...interface{}) {
+	l.next.Debug(l.scrubber.Text(msg), l.scrubber.Args(args)...)
+}
+
+// Info logs an informational message
+func (l *ScrubbingLogger) Info(msg string, args ...interface{}) {
+	l.next.Info(l.scrubber.Text(msg), l.scrubber.Args(args)...)
+}
+
+// Warn logs a warning message
+func (l *ScrubbingLogger) Warn(msg string, args ...interface{}) {
+	l.next.Warn(l.scrubber.Text(msg), l.scrubber.Args(args)...)
+}
+
+// Error logs an error message
+func (l *ScrubbingLogger) Error(msg string, args ...interface{}) {
+	l.next.Error(l.scrubber.Text(msg), l.scrubber.Args(args)...)
+}
+
+// Fatal logs a fatal error message and exits
+func (l *ScrubbingLogger) Fatal(msg string, args ...interface{}) {
+	l.next.Fatal(l.scrubber.Text(msg), l.scrubber.Args(args)...)
+}
+
+// WithModule creates a new logger with a hierarchical component name, scrubbing as l does
+func (l *ScrubbingLogger) WithModule(module string) Logger {
+	return &ScrubbingLogger{next: l.next.WithModule(module), scrubber: l.scrubber}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// SlogLevelFatal is the slog level of Fatal messages (above slog.LevelError)
+const SlogLevelFatal = slog.Level(12)
+
+// SlogLogger is a Logger that writes to a *slog.Logger, so ChatbotGate logs can join
+// an application's structured logging pipeline.
+// The module hierarchy is carried by the "module" attribute (e.g., "middleware/session").
+type SlogLogger struct {
+	base   *slog.Logger // Logger without the module attribute
+	logger *slog.Logger
+	module string
+}
+
+// NewSlogLogger creates a Logger writing to logger with the given module ("" for none)
+// Fatal messages are logged at SlogLevelFatal and exit the process, like SimpleLogger
+func NewSlogLogger(logger *slog.Logger, module string) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	l := &SlogLogger{base: logger, logger: logger, module: module}
+	if module != "" {
+		l.logger = logger.With("module", module)
+	}
+	return l
+}
+
+// log is the internal logging method
+func (l *SlogLogger) log(level slog.Level, msg string, args ...interface{}) {
+	l.logger.Log(context.Background(), level, msg, args...)
+}
+
+// Debug logs a debug message
+func (l *SlogLogger) Debug(msg string, args ...interface{}) {
+	l.log(slog.LevelDebug, msg, args...)
+}
+
+// Info logs an informational message
+func (l *SlogLogger) Info(msg string, args ...interface{}) {
+	l.log(slog.LevelInfo, msg, args...)
+}
+
+// Warn logs a warning message
+func (l *SlogLogger) Warn(msg string, args ...interface{}) {
+	l.log(slog.LevelWarn, msg, args...)
+}
+
+// Error logs an error message
+func (l *SlogLogger) Error(msg string, args ...interface{}) {
+	l.log(slog.LevelError, msg, args...)
+}
+
+// Fatal logs a fatal error message and exits
+func (l *SlogLogger) Fatal(msg string, args ...interface{}) {
+	l.log(SlogLevelFatal, msg, args...)
+	os.Exit(1)
+}
+
+// WithModule creates a new logger with a hierarchical component name, as SimpleLogger.WithModule does
+func (l *SlogLogger) WithModule(module string) Logger {
+	newModule := module
+	if l.module != "" {
+		newModule = l.module + "/" + module
+	}
+	return NewSlogLogger(l.base, newModule)
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	var logger Logger = NewSlogLogger(slog.New(handler), "chatbotgate")
+	logger.WithModule("middleware").WithModule("session").Info("Session created", "email", "u***@example.com", "ttl", 3600)
+	logger.Debug("Debug message")
+	logger.Warn("Warning message", "attempt", 2)
+	logger.Error("Error message")
+
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	first := records[0]
+	if first["msg"] != "Session created" || first["level"] != "INFO" || first["module"] != "chatbotgate/middleware/session" {
+		t.Errorf("first record = %v", first)
+	}
+	if first["email"] != "u***@example.com" || first["ttl"] != float64(3600) {
+		t.Errorf("first record fields = %v", first)
+	}
+
+	wantLevels := []string{"INFO", "DEBUG", "WARN", "ERROR"}
+	for i, record := range records {
+		if record["level"] != wantLevels[i] {
+			t.Errorf("record %d level = %v, want %s", i, record["level"], wantLevels[i])
+		}
+	}
+	if records[1]["module"] != "chatbotgate" {
+		t.Errorf("root logger module = %v, want chatbotgate", records[1]["module"])
+	}
+}
+
+func TestSlogLogger_NoModule(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)), "")
+	logger.Info("Started")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record["module"]; ok {
+		t.Errorf("record of a logger without module has one: %v", record)
+	}
+
+	// The first module starts the hierarchy
+	buf.Reset()
+	logger.WithModule("proxy").Info("Started")
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["module"] != "proxy" {
+		t.Errorf("module = %v, want proxy", record["module"])
+	}
+}
@@ -0,0 +1,70 @@
+// Package zaplogging adapts a *zap.Logger to logging.Logger, so ChatbotGate logs can join
+// an application's zap pipeline. Pass the adapter wherever ChatbotGate takes a logging.Logger:
+//
+//	logger := zaplogging.New(zapLogger, "chatbotgate")
+//	f := factory.NewDefaultFactory(host, port, logger)
+package zaplogging
+
+import (
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+	"go.uber.org/zap"
+)
+
+// Logger is a logging.Logger that writes to a *zap.Logger
+// The module hierarchy is carried by the "module" field (e.g., "middleware/session").
+type Logger struct {
+	base   *zap.SugaredLogger // Logger without the module field
+	logger *zap.SugaredLogger
+	module string
+}
+
+// New creates a logging.Logger writing to logger with the given module ("" for none)
+// Fatal messages are logged at zap's fatal level, which exits the process
+func New(logger *zap.Logger, module string) *Logger {
+	if logger == nil {
+		logger = zap.L()
+	}
+	return newLogger(logger.Sugar(), module)
+}
+
+func newLogger(base *zap.SugaredLogger, module string) *Logger {
+	l := &Logger{base: base, logger: base, module: module}
+	if module != "" {
+		l.logger = base.With("module", module)
+	}
+	return l
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.logger.Debugw(msg, args...)
+}
+
+// Info logs an informational message
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.logger.Infow(msg, args...)
+}
+
+// Warn logs a warning message
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.logger.Warnw(msg, args...)
+}
+
+// Error logs an error message
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.logger.Errorw(msg, args...)
+}
+
+// Fatal logs a fatal error message and exits
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.logger.Fatalw(msg, args...)
+}
+
+// WithModule creates a new logger with a hierarchical component name, as logging.SimpleLogger.WithModule does
+func (l *Logger) WithModule(module string) logging.Logger {
+	newModule := module
+	if l.module != "" {
+		newModule = l.module + "/" + module
+	}
+	return newLogger(l.base, newModule)
+}
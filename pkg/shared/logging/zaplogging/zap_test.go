@@ -0,0 +1,59 @@
+package zaplogging
+
+import (
+	"testing"
+
+	"github.com/ideamans/chatbotgate/pkg/shared/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	var logger logging.Logger = New(zap.New(core), "chatbotgate")
+	logger.WithModule("middleware").WithModule("session").Info("Session created", "email", "u***@example.com", "ttl", 3600)
+	logger.Debug("Debug message")
+	logger.Warn("Warning message", "attempt", 2)
+	logger.Error("Error message")
+
+	entries := logs.All()
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+
+	first := entries[0]
+	fields := first.ContextMap()
+	if first.Message != "Session created" || first.Level != zapcore.InfoLevel {
+		t.Errorf("first entry = %s %q", first.Level, first.Message)
+	}
+	if fields["module"] != "chatbotgate/middleware/session" || fields["email"] != "u***@example.com" || fields["ttl"] != int64(3600) {
+		t.Errorf("first entry fields = %v", fields)
+	}
+
+	wantLevels := []zapcore.Level{zapcore.InfoLevel, zapcore.DebugLevel, zapcore.WarnLevel, zapcore.ErrorLevel}
+	for i, entry := range entries {
+		if entry.Level != wantLevels[i] {
+			t.Errorf("entry %d level = %s, want %s", i, entry.Level, wantLevels[i])
+		}
+	}
+	if got := entries[1].ContextMap()["module"]; got != "chatbotgate" {
+		t.Errorf("root logger module = %v, want chatbotgate", got)
+	}
+}
+
+func TestLogger_NoModule(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := New(zap.New(core), "")
+	logger.Info("Started")
+	logger.WithModule("proxy").Info("Started")
+
+	entries := logs.All()
+	if _, ok := entries[0].ContextMap()["module"]; ok {
+		t.Errorf("entry of a logger without module has one: %v", entries[0].ContextMap())
+	}
+	if got := entries[1].ContextMap()["module"]; got != "proxy" {
+		t.Errorf("module = %v, want proxy", got)
+	}
+}
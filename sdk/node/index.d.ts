@@ -0,0 +1,48 @@
+/** Envelope identifier of AES-256-GCM values */
+export declare const ENVELOPE_V1: 'v1';
+/** Envelope identifier of AES-128-GCM values */
+export declare const ENVELOPE_V1_AES_128_GCM: 'v1.aes-128-gcm';
+/** Envelope identifier of ChaCha20-Poly1305 values */
+export declare const ENVELOPE_V1_CHACHA20_POLY1305: 'v1.chacha20-poly1305';
+/** Envelope identifier of RSA-OAEP values (decrypted with the upstream's private key) */
+export declare const ENVELOPE_V1_RSA_OAEP: 'v1.rsa-oaep';
+
+/** Timestamp and nonce of a stamped value */
+export interface Stamp {
+  time: Date;
+  nonce: string;
+}
+
+export interface Verifier {
+  /** Throws for stamps outside the validation window and replayed nonces */
+  verify(stamp: Stamp): void;
+}
+
+export interface VerifierOptions {
+  /** Validation window in milliseconds (default: 5 minutes) */
+  maxAgeMs?: number;
+  /** Clock in milliseconds (default: Date.now) */
+  now?: () => number;
+}
+
+export interface Decryptor {
+  /** Decrypts a forwarded value and returns the plaintext bytes (stamps are removed unverified) */
+  open(value: string): Buffer;
+  /** Decrypts a forwarded value and returns the plaintext bytes and its stamp (null if unstamped) */
+  openStamped(value: string): { plaintext: Buffer; stamp: Stamp | null };
+  /** Decrypts a forwarded value and returns the plaintext string */
+  decrypt(value: string): string;
+  /** Decrypts a stamped value after verifying its stamp */
+  decryptVerified(value: string, verifier: Verifier): string;
+}
+
+export interface DecryptorOptions {
+  /** Upstream's private key (PEM or KeyObject) of rsa-oaep values */
+  privateKey?: string | Buffer | import('crypto').KeyObject;
+}
+
+/** Creates a decryptor for the shared key (forwarding.encryption.key, null if none) */
+export declare function createDecryptor(secret: string | null, options?: DecryptorOptions): Decryptor;
+
+/** Creates a verifier of stamped values (forwarding field "stamp: true") */
+export declare function createVerifier(options?: VerifierOptions): Verifier;
@@ -0,0 +1,187 @@
+'use strict';
+
+// Decrypts user info values forwarded by ChatbotGate (forwarding fields with the encrypt filter).
+// Mirrors github.com/ideamans/chatbotgate/pkg/forwarded; depends on Node's standard library only.
+
+const crypto = require('crypto');
+const zlib = require('zlib');
+
+// Envelope identifiers of encrypted values
+const ENVELOPE_V1 = 'v1'; // AES-256-GCM, 12-byte nonce, key = SHA-256(shared key)
+const ENVELOPE_V1_AES_128_GCM = 'v1.aes-128-gcm'; // AES-128-GCM, 12-byte nonce, key = SHA-256(shared key)[:16]
+const ENVELOPE_V1_CHACHA20_POLY1305 = 'v1.chacha20-poly1305'; // ChaCha20-Poly1305, 12-byte nonce, key = SHA-256(shared key)
+const ENVELOPE_V1_RSA_OAEP = 'v1.rsa-oaep'; // RSA-OAEP (SHA-256) wrapped key || AES-256-GCM payload under it
+
+// Node cipher names and key sizes of envelopes (rsa-oaep payloads use AES-256-GCM after unwrapping)
+const CIPHERS = {
+  [ENVELOPE_V1]: { name: 'aes-256-gcm', keySize: 32 },
+  [ENVELOPE_V1_AES_128_GCM]: { name: 'aes-128-gcm', keySize: 16 },
+  [ENVELOPE_V1_CHACHA20_POLY1305]: { name: 'chacha20-poly1305', keySize: 32 },
+  [ENVELOPE_V1_RSA_OAEP]: { name: 'aes-256-gcm', keySize: 32 },
+};
+
+// Stamped values (forwarding field "stamp: true") carry the time and a nonce inside the payload
+const STAMP_SUFFIX = '+stamp';
+const STAMP_SIZE = 8 + 16; // Unix time in seconds (big-endian) || nonce
+const DEFAULT_MAX_AGE_MS = 5 * 60 * 1000;
+const MAX_CLOCK_SKEW_MS = 60 * 1000;
+
+const NONCE_SIZE = 12;
+const TAG_SIZE = 16;
+const CONTENT_KEY_SIZE = 32;
+
+// gunzipIfCompressed decompresses gzip data (zip filter output), returning other data unchanged
+function gunzipIfCompressed(data) {
+  if (data.length < 2 || data[0] !== 0x1f || data[1] !== 0x8b) {
+    return data;
+  }
+  try {
+    return zlib.gunzipSync(data);
+  } catch {
+    return data;
+  }
+}
+
+// createDecryptor returns a decryptor for the shared key (forwarding.encryption.key)
+// options.privateKey (PEM or KeyObject) decrypts rsa-oaep values; pass a null secret if there is no shared key
+function createDecryptor(secret, options = {}) {
+  const key = secret == null ? null : crypto.createHash('sha256').update(secret).digest();
+  const privateKey = options.privateKey ? crypto.createPrivateKey(options.privateKey) : null;
+
+  // unwrap returns the content key of an rsa-oaep payload and the rest of the payload
+  function unwrap(data) {
+    const size = privateKey.asymmetricKeyDetails.modulusLength / 8;
+    if (data.length < size) {
+      throw new Error('invalid encrypted value');
+    }
+    let contentKey;
+    try {
+      contentKey = crypto.privateDecrypt(
+        { key: privateKey, padding: crypto.constants.RSA_PKCS1_OAEP_PADDING, oaepHash: 'sha256' },
+        data.subarray(0, size),
+      );
+    } catch {
+      throw new Error('decryption failed');
+    }
+    if (contentKey.length !== CONTENT_KEY_SIZE) {
+      throw new Error('decryption failed');
+    }
+    return [contentKey, data.subarray(size)];
+  }
+
+  // openStamped decrypts a forwarded value and returns { plaintext, stamp } (stamp is null for unstamped values)
+  // Values without an envelope identifier are accepted as v1 payloads
+  function openStamped(value) {
+    let id = ENVELOPE_V1;
+    let payload = value;
+    const sep = value.indexOf(':');
+    if (sep >= 0) {
+      id = value.slice(0, sep);
+      payload = value.slice(sep + 1);
+    }
+    const stamped = id.endsWith(STAMP_SUFFIX);
+    if (stamped) {
+      id = id.slice(0, -STAMP_SUFFIX.length);
+    }
+    const cipher = Object.prototype.hasOwnProperty.call(CIPHERS, id) ? CIPHERS[id] : null;
+    if (!cipher) {
+      throw new Error(`unsupported envelope: ${JSON.stringify(id)}`);
+    }
+    if (id === ENVELOPE_V1_RSA_OAEP ? !privateKey : !key) {
+      throw new Error(`decryption key is not configured: ${id} needs the ${id === ENVELOPE_V1_RSA_OAEP ? 'private' : 'shared'} key`);
+    }
+    if (!/^[A-Za-z0-9+/]*={0,2}$/.test(payload)) {
+      throw new Error('invalid encrypted value');
+    }
+
+    let data = gunzipIfCompressed(Buffer.from(payload, 'base64')); // encrypt,zip
+    let cipherKey = key;
+    if (id === ENVELOPE_V1_RSA_OAEP) {
+      [cipherKey, data] = unwrap(data);
+    }
+    if (data.length < NONCE_SIZE + TAG_SIZE) {
+      throw new Error('invalid encrypted value');
+    }
+
+    const decipher = crypto.createDecipheriv(cipher.name, cipherKey.subarray(0, cipher.keySize), data.subarray(0, NONCE_SIZE), {
+      authTagLength: TAG_SIZE,
+    });
+    decipher.setAuthTag(data.subarray(data.length - TAG_SIZE));
+    let plaintext;
+    try {
+      plaintext = Buffer.concat([decipher.update(data.subarray(NONCE_SIZE, data.length - TAG_SIZE)), decipher.final()]);
+    } catch {
+      throw new Error('decryption failed');
+    }
+
+    let stamp = null;
+    if (stamped) {
+      if (plaintext.length < STAMP_SIZE) {
+        throw new Error('invalid encrypted value');
+      }
+      stamp = {
+        time: new Date(Number(plaintext.readBigUInt64BE(0)) * 1000),
+        nonce: plaintext.subarray(8, STAMP_SIZE).toString('hex'),
+      };
+      plaintext = plaintext.subarray(STAMP_SIZE);
+    }
+    return { plaintext: gunzipIfCompressed(plaintext), stamp }; // zip,encrypt
+  }
+
+  // open decrypts a forwarded value and returns the plaintext bytes (stamps are removed unverified)
+  function open(value) {
+    return openStamped(value).plaintext;
+  }
+
+  return {
+    open,
+    openStamped,
+    // decrypt decrypts a forwarded value and returns the plaintext string
+    decrypt(value) {
+      return open(value).toString('utf8');
+    },
+    // decryptVerified decrypts a stamped value and verifies its stamp with a verifier (createVerifier)
+    decryptVerified(value, verifier) {
+      const { plaintext, stamp } = openStamped(value);
+      if (!stamp) {
+        throw new Error('value is not stamped');
+      }
+      verifier.verify(stamp);
+      return plaintext.toString('utf8');
+    },
+  };
+}
+
+// createVerifier returns a verifier rejecting stamps older than maxAgeMs (default 5 minutes) and replayed nonces
+// Seen nonces are kept in memory until they expire.
+function createVerifier({ maxAgeMs = DEFAULT_MAX_AGE_MS, now = Date.now } = {}) {
+  const seen = new Map(); // nonce -> expiry (ms)
+
+  return {
+    verify(stamp) {
+      const current = now();
+      const time = stamp.time.getTime();
+      if (time < current - maxAgeMs || time > current + MAX_CLOCK_SKEW_MS) {
+        throw new Error(`stamp expired: stamped at ${stamp.time.toISOString()}`);
+      }
+      for (const [nonce, expiry] of seen) {
+        if (current > expiry) {
+          seen.delete(nonce);
+        }
+      }
+      if (seen.has(stamp.nonce)) {
+        throw new Error('value was replayed');
+      }
+      seen.set(stamp.nonce, time + maxAgeMs);
+    },
+  };
+}
+
+module.exports = {
+  createDecryptor,
+  createVerifier,
+  ENVELOPE_V1,
+  ENVELOPE_V1_AES_128_GCM,
+  ENVELOPE_V1_CHACHA20_POLY1305,
+  ENVELOPE_V1_RSA_OAEP,
+};
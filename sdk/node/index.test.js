@@ -0,0 +1,94 @@
+'use strict';
+
+const test = require('node:test');
+const assert = require('node:assert');
+const fs = require('node:fs');
+const path = require('node:path');
+const { createDecryptor, createVerifier } = require('./index');
+
+// Same key and vectors as pkg/forwarded/forwarded_test.go
+const testKey = 'this-is-a-32-character-encryption-key-12345';
+const testVectors = {
+  'encrypt': 'v1:4jSMKeFzKSYXx2eFksiANbheF37ZW+6c62W28nos+CKb89JQscEPnFP0bDZV',
+  'encrypt,zip': 'v1:H4sIAAAAAAAA/wAtANL/Ncx6s5NJrvKVdyid+KewW1kXad5alUU0XCob5XFDySS//2p14gUuAof1JmGwAwB+nu69LQAAAA==',
+  'zip,encrypt': 'v1:AdzfKibTfuxGtIIZqIH8T0tk+0HTx8qMUo2Ch4qBzDEm1pmkyHIVLcyCR1Mvf5b50TLd3zywH9oB4JelU899tU3hMrus1A==',
+  'no envelope': '4jSMKeFzKSYXx2eFksiANbheF37ZW+6c62W28nos+CKb89JQscEPnFP0bDZV',
+
+  'aes-128-gcm encrypt': 'v1.aes-128-gcm:U/gP1+HyXG5BPPOTDDyxKnXf58j0is/N9ZuaIg5H0R3EFMYyx3XDrkSofoEx',
+  'aes-128-gcm encrypt,zip': 'v1.aes-128-gcm:H4sIAAAAAAAA/wAtANL/BZPZn6ley8DHOXpYYYF5PA4rmRN/JDDROEBGjfr/eZsDm+ioTHw8mtoInCHvAwAbU4VRLQAAAA==',
+  'aes-128-gcm zip,encrypt': 'v1.aes-128-gcm:Fo2OrepUuoshkwkM46ZIEYFxvaCHMqE8ubkOu41ggGj44W3l4ghkm1OWwMMlHIHNzMv7x1+/NA1IcdQ1XUz9ourBg45Tyg==',
+  'chacha20-poly1305 encrypt': 'v1.chacha20-poly1305:XzcjVoq2JiSIoYNUMSr9XuEml3nUXDrhP8IHr7wkEo4GhjGB2kA0ni18tC8q',
+  'chacha20-poly1305 encrypt,zip': 'v1.chacha20-poly1305:H4sIAAAAAAAA/wAtANL/xViLs4J9E8h/3+e7z8Ne+JQhiU659DxnxDXeU2VZu6d1JJJvS66FZKTm0rrXAwDymRAJLQAAAA==',
+  'chacha20-poly1305 zip,encrypt': 'v1.chacha20-poly1305:8hBuEhYOeNIPqLoDcRROlV2axmPYWSQYzDaE5ROdDzdppbs34yCQdpOHU36mocXIZq0JC532/wMya45ABR5gr2OuJk+sgA==',
+};
+
+for (const [name, value] of Object.entries(testVectors)) {
+  test(`decrypts ${name}`, () => {
+    assert.strictEqual(createDecryptor(testKey).decrypt(value), 'alice@example.com');
+  });
+}
+
+test('rejects a wrong key', () => {
+  assert.throws(() => createDecryptor('another-key-with-at-least-32-characters').decrypt(testVectors.encrypt), /decryption failed/);
+});
+
+test('rejects unknown envelopes', () => {
+  assert.throws(() => createDecryptor(testKey).decrypt('v9:' + testVectors['no envelope']), /unsupported envelope/);
+});
+
+test('rejects a payload under another algorithm', () => {
+  assert.throws(() => createDecryptor(testKey).decrypt('v1.aes-128-gcm:' + testVectors['no envelope']), /decryption failed/);
+});
+
+// rsa-oaep values for the public key of pkg/forwarded/testdata/rsa-private.pem
+const privateKey = fs.readFileSync(path.join(__dirname, '../../pkg/forwarded/testdata/rsa-private.pem'));
+const rsaVectors = {
+  'encrypt': 'v1.rsa-oaep:dnIIL+kAK6VeorwpvsL9ckSJkkKiNI2lxc2/h+YiMyfM7kBmPxHmrcfkMdOyp+Q6X0CnudVizKBrTVIeQYz0wsAIhHxQ5pcH9eh/dBAZJQoK5bGxoOLi9FqVHE871zUjf4XSAAHhexrTuhlGfOP4idgivfNsld4P7hHhOTAJ4wjgBqZg60OAz3KWd2H9OwfdqRgizHlMyBkIGelt6kEleNnC4OH/wZG4vRovqhlbasj43lhJsST6dQBwjoIMltTEEXLpsGmRBAnb7prT5DsUWa+x5XcoiKFG6F6HxVobW1+T8zNgTftIaxqFYAtPmvFgVogn+aDIAFeKpLBAd+omk6IIRCAiymA7amGrpNKCTfqTBVrU09eFPg/B9O9eBZbIXZKZu5vIKmlsHvZ7fg==',
+  'encrypt,zip': 'v1.rsa-oaep:H4sIAAAAAAAA/wAtAdL+sDiP/9OosGllK6RIrisZnROU3sKs9cG5rOtQc7ji9RuNPpO29oE1LEqOhsda0vtkDsRxCDq6MCnliht3RNLb0t/TJl/Coj4GMLjFNOVOWyy1w47oCpC1hXU0/Ko/joE3n/n1BPMOgwDL3jw+fg1i12z9zCjiqXCJA5FMNsSNv8bcZ9HCFV1udp/otiuOGFu7JVXHJwuRQK8CqjsrlRiqczmMuSYoHvoE2sVRhu6HiMmFgCSkIC1FG1/MCcVrXtoyUXLgFAa7+4Urp0vmWk6dU88vxhsR/srKwnn6L620W2f+6KE+vAl/9Dth60+UUtis0HQ9HN7lFax9if9dh80VKspU15MSxn19r5WFBAKomn9BtzGWRmLpboEAQ8VIZmOP8i6js2FZ8qGcTwHurwMAufR1ny0BAAA=',
+  'zip,encrypt': 'v1.rsa-oaep:iZE5xTpXDACKFFSMvITJxrhYYQTO+Us4kGiYBw5ZfIyEaCXvo364ZUt/4Tv/2v8XcqUg1okRpv+nHR71Q/V2Usk/sf1eMNlRWG0Ic4TzSsADSHs5+cFZEbVIqxqEtbxwFERTagsT+QJXzP3a7irQlO32Y728RrynLr30YulZEd4/A2z4RtdOtTSAl/8VCVKsn2j2A1LJn1yhX5oTsd3Vc/XfgVc829FbMTEyRzLXEbJME6AUSOTAUQAqmO7xpMWeQWaYspVgKqSq/agG4BfJBit2WAxV924BvJgx+5Kc6dGoVkBFFW1znzHj3gNHZNeTSSHZO0NFmumeLfFbYu3+aB0Tas8s8DLRMSMHnFoThhXozzomJiZnRO9FPaWB/AIa1b3/ProNKti+5Mla1stYn7SUODn/XMqqNe65yvQ3KbdmWc2xwzU=',
+};
+
+for (const [name, value] of Object.entries(rsaVectors)) {
+  test(`decrypts rsa-oaep ${name} with the private key`, () => {
+    assert.strictEqual(createDecryptor(null, { privateKey }).decrypt(value), 'alice@example.com');
+  });
+}
+
+test('decrypts shared key and rsa-oaep values with one decryptor', () => {
+  const decryptor = createDecryptor(testKey, { privateKey });
+  assert.strictEqual(decryptor.decrypt(testVectors.encrypt), 'alice@example.com');
+  assert.strictEqual(decryptor.decrypt(rsaVectors.encrypt), 'alice@example.com');
+});
+
+test('rejects rsa-oaep values without the private key', () => {
+  assert.throws(() => createDecryptor(testKey).decrypt(rsaVectors.encrypt), /decryption key is not configured/);
+  assert.throws(() => createDecryptor(null, { privateKey }).decrypt(testVectors.encrypt), /decryption key is not configured/);
+});
+
+// Stamped vectors as in pkg/forwarded/stamp_test.go
+const stampedVectors = {
+  'encrypt': 'v1+stamp:gJdzioClnh3eGlQrwzPB7kxB8xI6pSQwn6A6qwf3HAUlhIHCLfGlIihKSBgbovps5e84vkFD9CT+5SCtuAH5ggmVouSv',
+  'zip,encrypt': 'v1+stamp:eJD3cixSmVp+wbAhEcIj4+xmawX2kZ5gqrndwJgqpVphaEZo3KXw5VGDKAVHKNFAyQY9cYdX8YoghnFg9mZ1YncFJAyztoIXf5vY7gbRZGz3IFeWA6bbg7J7R6TtsA==',
+};
+const stampedAt = 1791986725 * 1000;
+
+test('reads stamps', () => {
+  const { plaintext, stamp } = createDecryptor(testKey).openStamped(stampedVectors.encrypt);
+  assert.strictEqual(plaintext.toString(), 'alice@example.com');
+  assert.strictEqual(stamp.time.getTime(), stampedAt);
+  assert.strictEqual(stamp.nonce, '7bda0c51b502f5fbbb7d7719a23a33c3');
+});
+
+test('verifies stamps once within the window', () => {
+  const decryptor = createDecryptor(testKey);
+  const verifier = createVerifier({ now: () => stampedAt + 10 * 1000 });
+  assert.strictEqual(decryptor.decryptVerified(stampedVectors['zip,encrypt'], verifier), 'alice@example.com');
+  assert.throws(() => decryptor.decryptVerified(stampedVectors['zip,encrypt'], verifier), /replayed/);
+});
+
+test('rejects expired and unstamped values', () => {
+  const decryptor = createDecryptor(testKey);
+  const late = createVerifier({ now: () => stampedAt + 5 * 60 * 1000 + 1000 });
+  assert.throws(() => decryptor.decryptVerified(stampedVectors.encrypt, late), /stamp expired/);
+  assert.throws(() => decryptor.decryptVerified(testVectors.encrypt, createVerifier()), /not stamped/);
+});
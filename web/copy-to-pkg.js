@@ -16,6 +16,12 @@ console.log('Copying CSS files...');
 copyFileSync(join(tmpDir, 'main.css'), join(pkgDir, 'main.css'));
 copyFileSync(join(tmpDir, 'dify.css'), join(pkgDir, 'dify.css'));
 
+// Copy scripts
+console.log('Copying scripts...');
+copyFileSync(join(tmpDir, 'otp.js'), join(pkgDir, 'otp.js'));
+copyFileSync(join(tmpDir, 'fragment.js'), join(pkgDir, 'fragment.js'));
+copyFileSync(join(tmpDir, 'announcement.js'), join(pkgDir, 'announcement.js'));
+
 // Copy icons
 console.log('Copying icons...');
 const icons = [
@@ -0,0 +1,25 @@
+// Dismiss button of the announcement banner on the auth pages
+// The banner ID is stored in a cookie, so the server stops showing the banner
+// until the announcement changes.
+(function () {
+	'use strict';
+
+	var COOKIE_NAME = '_chatbotgate_announcement';
+	var MAX_AGE = 30 * 24 * 60 * 60;
+
+	var banner = document.querySelector('[data-announcement-id]');
+	if (!banner) return;
+	var button = banner.querySelector('.announcement-dismiss');
+	if (!button) return;
+
+	button.hidden = false;
+	button.addEventListener('click', function () {
+		var cookie = COOKIE_NAME + '=' + encodeURIComponent(banner.getAttribute('data-announcement-id')) +
+			'; path=' + (banner.getAttribute('data-cookie-path') || '/') + '; max-age=' + MAX_AGE + '; SameSite=Lax';
+		if (window.location.protocol === 'https:') {
+			cookie += '; Secure';
+		}
+		document.cookie = cookie;
+		banner.parentNode.removeChild(banner);
+	});
+})();
@@ -0,0 +1,22 @@
+// URL fragment capture for the login page
+// Browsers keep the fragment (e.g., "#/chat/123") across the redirect to the login page,
+// but never send it to the server, so the redirect cookie cannot hold it.
+// This script stores it in a short-lived cookie that the server appends to the
+// post-login redirect URL.
+(function () {
+	'use strict';
+
+	var COOKIE_NAME = '_oauth2_redirect_fragment';
+	var MAX_AGE = 600; // Same lifetime as the redirect cookie
+	var MAX_LENGTH = 1024;
+
+	var hash = window.location.hash;
+	if (!hash || hash === '#' || hash.length > MAX_LENGTH) return;
+
+	var cookie = COOKIE_NAME + '=' + encodeURIComponent(hash) +
+		'; path=/; max-age=' + MAX_AGE + '; SameSite=Lax';
+	if (window.location.protocol === 'https:') {
+		cookie += '; Secure';
+	}
+	document.cookie = cookie;
+})();
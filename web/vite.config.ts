@@ -18,6 +18,18 @@ export default defineConfig({
         {
           src: 'styles/dify.css',
           dest: '.'
+        },
+        {
+          src: 'scripts/otp.js',
+          dest: '.'
+        },
+        {
+          src: 'scripts/fragment.js',
+          dest: '.'
+        },
+        {
+          src: 'scripts/announcement.js',
+          dest: '.'
         }
       ]
     })